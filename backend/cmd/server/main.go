@@ -4,20 +4,28 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math/rand/v2"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata"
 
+	"kasirinaja/backend/internal/alerting"
 	"kasirinaja/backend/internal/cache"
 	"kasirinaja/backend/internal/config"
+	"kasirinaja/backend/internal/domain"
 	"kasirinaja/backend/internal/httpapi"
+	"kasirinaja/backend/internal/jobs"
 	"kasirinaja/backend/internal/recommendation"
+	"kasirinaja/backend/internal/reporting"
 	"kasirinaja/backend/internal/service"
 	"kasirinaja/backend/internal/store"
+	"kasirinaja/backend/internal/store/breaker"
 	"kasirinaja/backend/internal/store/memory"
 	pgstore "kasirinaja/backend/internal/store/postgres"
+	"kasirinaja/backend/internal/xid"
 )
 
 func main() {
@@ -25,33 +33,70 @@ func main() {
 	if err := validateSecurityConfig(cfg); err != nil {
 		log.Fatalf("invalid security configuration: %v", err)
 	}
+	ids, err := xid.NewGenerator(cfg.IDStrategy)
+	if err != nil {
+		log.Fatalf("invalid ID_STRATEGY: %v", err)
+	}
+	xid.SetDefault(ids)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	var repo store.Repository
+	var repoBreaker *breaker.Repository
 	closers := make([]func() error, 0, 2)
 
 	if cfg.DatabaseURL != "" {
-		pg, err := pgstore.New(ctx, cfg.DatabaseURL)
+		pool := pgstore.PoolConfig{
+			MaxIdleConns:    cfg.DBMaxIdleConns,
+			MaxOpenConns:    cfg.DBMaxOpenConns,
+			ConnMaxLifetime: time.Duration(cfg.DBConnMaxLifetimeMinutes) * time.Minute,
+		}
+		if err := pool.Validate(); err != nil {
+			log.Fatalf("invalid database pool configuration: %v", err)
+		}
+		pg, err := pgstore.New(ctx, cfg.DatabaseURL, pool)
 		if err != nil {
 			log.Fatalf("postgres unavailable (%v) and DATABASE_URL is set; refusing to start with in-memory fallback", err)
 		} else {
-			repo = pg
+			pg.SetAllowNegativeStock(cfg.AllowNegativeStock)
+			repoBreaker = breaker.New(pg, cfg.DBBreakerFailures, time.Duration(cfg.DBReadCacheSeconds)*time.Second)
+			repo = repoBreaker
 			closers = append(closers, pg.Close)
 			log.Println("repository: postgres")
+			log.Printf("postgres pool: max_open=%d max_idle=%d conn_max_lifetime=%s", pool.MaxOpenConns, pool.MaxIdleConns, pool.ConnMaxLifetime)
 		}
 	} else {
-		repo = memory.NewSeeded()
-		log.Println("repository: in-memory")
+		// SEED_DEMO_DATA and SEED_PRODUCTS_FILE only apply here: a postgres
+		// catalog comes from its own migrations and data.
+		var mem *memory.Store
+		switch {
+		case cfg.SeedProductsFile != "":
+			seed, err := memory.LoadSeedProducts(cfg.SeedProductsFile)
+			if err != nil {
+				log.Fatalf("load seed products: %v", err)
+			}
+			mem = memory.NewFromSeed(seed)
+			log.Printf("repository: in-memory, %d products from %s", len(seed), cfg.SeedProductsFile)
+		case cfg.SeedDemoData:
+			mem = memory.NewSeeded()
+			log.Println("repository: in-memory with demo data")
+		default:
+			mem = memory.NewEmpty()
+			log.Println("repository: in-memory, empty")
+		}
+		mem.SetAllowNegativeStock(cfg.AllowNegativeStock)
+		repo = mem
 	}
 
 	cacheStore := cache.RecommendationCache(cache.NoopRecommendationCache{})
+	var cachePing func(context.Context) error
 	if cfg.RedisAddr != "" {
 		redisCache := cache.NewRedisRecommendationCache(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB)
 		if err := redisCache.Ping(ctx); err != nil {
 			log.Printf("redis unavailable (%v), using noop cache", err)
 		} else {
 			cacheStore = redisCache
+			cachePing = redisCache.Ping
 			closers = append(closers, redisCache.Close)
 			log.Println("cache: redis")
 		}
@@ -60,9 +105,121 @@ func main() {
 	}
 
 	recommender := recommendation.NewEngine(cacheStore, time.Duration(cfg.RecommendationTTLSeconds)*time.Second)
+	recommender.SetMinStock(cfg.MinStockForRecommendation)
+	recommender.SetShowPolicy(recommendation.ShowPolicy{
+		CooldownSeconds:     cfg.PromptCooldownSeconds,
+		MaxPromptsPerBasket: cfg.MaxPromptsPerBasket,
+	})
 	svc := service.New(repo, recommender, cfg.StoreID)
+	svc.SetIDGenerator(ids)
+	svc.SetEnforceShiftOwnership(cfg.EnforceShiftOwnership)
+	svc.SetRequireRegisteredTerminals(cfg.RequireRegisteredTerminals)
+	svc.SetRequireExplicitStoreID(cfg.RequireExplicitStoreID)
+	svc.SetExperimentTreatmentRatio(cfg.RecommendationTreatmentRatio)
+	svc.SetMinLift(cfg.RecommendationMinLift)
+	svc.SetPriceChangeAlertPercent(cfg.PriceChangeAlertPercent)
+	svc.SetAfterHoursSalesThreshold(cfg.AfterHoursSalesThreshold)
+	if err := svc.SetReceiptTemplate(cfg.ReceiptTemplate); err != nil {
+		log.Fatalf("invalid receipt template: %v", err)
+	}
+	svc.SetReceiptLookupURL(cfg.ReceiptLookupURL)
+	if err := svc.SetDefaultLanguage(cfg.DefaultLanguage); err != nil {
+		log.Fatalf("invalid DEFAULT_LANGUAGE: %v", err)
+	}
+	svc.SetKitchenCategories(cfg.KitchenCategories)
+	if len(cfg.PaymentMethods) > 0 {
+		if err := svc.SetPaymentMethods("", cfg.PaymentMethods); err != nil {
+			log.Fatalf("invalid PAYMENT_METHODS: %v", err)
+		}
+	}
+	for storeID, methods := range cfg.StorePaymentMethods {
+		if err := svc.SetPaymentMethods(storeID, methods); err != nil {
+			log.Fatalf("invalid PAYMENT_METHODS_BY_STORE for %s: %v", storeID, err)
+		}
+	}
+	svc.SetOfflineEnvelopeTTL(time.Duration(cfg.OfflineEnvelopeTTLHours) * time.Hour)
+	svc.SetClockSkewTolerance(time.Duration(cfg.ClockSkewToleranceSeconds) * time.Second)
+	svc.SetExpiredLotGraceDays(cfg.ExpiredLotGraceDays)
+	svc.SetRefundWindowDays(cfg.RefundWindowDays)
+	svc.SetDailyCaps(cfg.DailyVoidCap, cfg.DailyRefundCapCents)
+	svc.SetAnomalyThresholds("", cfg.AnomalyThresholds)
+	for storeID, thresholds := range cfg.StoreAnomalyThresholds {
+		svc.SetAnomalyThresholds(storeID, thresholds)
+	}
+	if cfg.BusinessHours != "" {
+		if err := svc.SetBusinessHours("", cfg.BusinessHours); err != nil {
+			log.Fatalf("invalid BUSINESS_HOURS: %v", err)
+		}
+	}
+	for storeID, hours := range cfg.StoreBusinessHours {
+		if err := svc.SetBusinessHours(storeID, hours); err != nil {
+			log.Fatalf("invalid BUSINESS_HOURS_BY_STORE for %s: %v", storeID, err)
+		}
+	}
+	storeLocation, err := time.LoadLocation(cfg.StoreTimezone)
+	if err != nil {
+		log.Fatalf("invalid STORE_TIMEZONE %q: %v", cfg.StoreTimezone, err)
+	}
+	svc.SetStoreLocation(storeLocation)
+	svc.SetLocalTimestamps(cfg.StoreLocalTimestamps)
+	recommendationEvents := service.NewAsyncEventWriter(repo, 1024, 100, time.Second)
+	svc.SetRecommendationEventWriter(recommendationEvents)
+	// Flush buffered events before the repository they write to is closed.
+	closers = append([]func() error{recommendationEvents.Close}, closers...)
+	if cfg.AlertWebhookURL != "" {
+		stockAlerts := alerting.NewWebhookNotifier(cfg.AlertWebhookURL, 256)
+		svc.SetStockAlertNotifier(stockAlerts)
+		closers = append([]func() error{stockAlerts.Close}, closers...)
+		log.Println("stock alerts: webhook")
+	}
 	auth := httpapi.NewAuthManager(cfg.AuthSecret, time.Duration(cfg.AccessTokenTTLMinutes)*time.Minute, cfg.ManagerPIN, repo)
+	auth.SetRefreshTokenTTL(time.Duration(cfg.RefreshTokenTTLHours) * time.Hour)
 	api := httpapi.New(svc, auth, cfg.AllowedOrigin)
+	api.SetCurrency(cfg.Currency)
+	if err := api.SetMaxRequestBytes(cfg.MaxRequestBytes); err != nil {
+		log.Fatalf("invalid MAX_REQUEST_BYTES: %v", err)
+	}
+	if err := api.SetRouteMaxRequestBytes("/api/v1/sync/offline-transactions", cfg.OfflineSyncMaxRequestBytes); err != nil {
+		log.Fatalf("invalid OFFLINE_SYNC_MAX_REQUEST_BYTES: %v", err)
+	}
+	for route, limit := range cfg.RateLimits {
+		api.SetRateLimit(route, limit.PerSecond, limit.Burst)
+	}
+	if cachePing != nil {
+		api.AddReadinessCheck("cache", cachePing)
+	}
+	if repoBreaker != nil {
+		api.SetStorageMode(repoBreaker.Mode)
+	}
+	endOfDayReporter := reporting.NewEndOfDayReporter(svc, cfg.StoreID, cfg.EndOfDayReportRecipients, time.Duration(cfg.EndOfDayReportMinute)*time.Minute, storeLocation)
+	api.SetEndOfDayReporter(endOfDayReporter)
+	jobRegistry := jobs.NewRegistry()
+	svc.SetJobRegistry(jobRegistry)
+	auth.SetJobRegistry(jobRegistry)
+	endOfDayReporter.SetJobRegistry(jobRegistry)
+	api.SetJobRegistry(jobRegistry)
+
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	defer stopScheduler()
+	go runRetrainScheduler(schedulerCtx, time.Duration(cfg.RetrainIntervalHours)*time.Hour, jobRegistry, func(ctx context.Context) (int, error) {
+		resp, err := svc.RetrainAssociations(ctx, domain.RetrainRequest{StoreID: cfg.StoreID})
+		return resp.UpdatedPairs, err
+	})
+	go auth.RunRevocationJanitor(schedulerCtx, time.Hour)
+	go svc.RunOfflineEnvelopeJanitor(schedulerCtx, time.Hour)
+	if repoBreaker != nil {
+		go repoBreaker.Run(schedulerCtx, 5*time.Second)
+	}
+	if cfg.AlertWebhookURL != "" {
+		go svc.RunExpiringLotAlerts(schedulerCtx, cfg.StoreID, cfg.AlertExpiryDays, time.Duration(cfg.AlertSweepIntervalMinutes)*time.Minute)
+	}
+	if cfg.EndOfDayReportEnabled {
+		if len(cfg.EndOfDayReportRecipients) == 0 {
+			log.Println("end-of-day report enabled but EOD_REPORT_RECIPIENTS is empty; not scheduling")
+		} else {
+			go endOfDayReporter.Run(schedulerCtx, time.Minute)
+		}
+	}
 
 	server := &http.Server{
 		Addr:              cfg.Address(),
@@ -83,6 +240,7 @@ func main() {
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
 	<-sig
+	stopScheduler()
 
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 8*time.Second)
 	defer shutdownCancel()
@@ -90,6 +248,7 @@ func main() {
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Printf("shutdown error: %v", err)
 	}
+	api.Stop()
 
 	for _, closeFn := range closers {
 		if err := closeFn(); err != nil {
@@ -100,6 +259,36 @@ func main() {
 	log.Println("server stopped")
 }
 
+// runRetrainScheduler rebuilds association pairs every interval, plus up to
+// 10% jitter so several instances don't retrain in lockstep, and reports each
+// run to registry. It returns immediately when interval is zero and stops
+// when ctx is cancelled.
+func runRetrainScheduler(ctx context.Context, interval time.Duration, registry *jobs.Registry, retrain func(context.Context) (int, error)) {
+	if interval <= 0 {
+		return
+	}
+
+	for {
+		wait := interval + rand.N(interval/10+1)
+		registry.Scheduled(jobs.RecommendationRetrain, time.Now().Add(wait))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		pairs, err := retrain(ctx)
+		registry.Ran(jobs.RecommendationRetrain, time.Now(), err)
+		if err != nil {
+			log.Printf("scheduled retrain failed: %v", err)
+			continue
+		}
+		log.Printf("scheduled retrain: %d association pairs", pairs)
+	}
+}
+
 func validateSecurityConfig(cfg config.Config) error {
 	if len(cfg.AuthSecret) < 32 {
 		return fmt.Errorf("AUTH_SECRET must be set and at least 32 characters")
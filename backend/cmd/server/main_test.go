@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"kasirinaja/backend/internal/config"
 )
@@ -19,3 +21,49 @@ func TestValidateSecurityConfigAcceptsStrongValues(t *testing.T) {
 		t.Fatalf("expected strong config to pass, got %v", err)
 	}
 }
+
+func TestRunRetrainSchedulerIsNoopWithoutInterval(t *testing.T) {
+	called := false
+	done := make(chan struct{})
+	go func() {
+		runRetrainScheduler(context.Background(), 0, nil, func(context.Context) (int, error) {
+			called = true
+			return 0, nil
+		})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected scheduler to return immediately when interval is zero")
+	}
+	if called {
+		t.Fatalf("expected retrain not to run when interval is zero")
+	}
+}
+
+func TestRunRetrainSchedulerStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	runs := make(chan struct{}, 8)
+	done := make(chan struct{})
+	go func() {
+		runRetrainScheduler(ctx, 10*time.Millisecond, nil, func(context.Context) (int, error) {
+			runs <- struct{}{}
+			return 3, nil
+		})
+		close(done)
+	}()
+
+	select {
+	case <-runs:
+	case <-time.After(time.Second):
+		t.Fatalf("expected scheduled retrain to run")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected scheduler to stop after cancel")
+	}
+}
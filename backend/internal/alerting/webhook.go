@@ -0,0 +1,128 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"kasirinaja/backend/internal/domain"
+)
+
+// WebhookNotifier posts stock alerts as JSON to a webhook URL from a
+// background goroutine. Notify never blocks: when the queue is full the alert
+// is dropped and logged, and failed deliveries are given up after a few
+// attempts.
+type WebhookNotifier struct {
+	url         string
+	client      *http.Client
+	maxAttempts int
+	retryDelay  time.Duration
+	alerts      chan domain.StockAlert
+
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+}
+
+func NewWebhookNotifier(url string, bufferSize int) *WebhookNotifier {
+	if bufferSize < 1 {
+		bufferSize = 256
+	}
+
+	n := &WebhookNotifier{
+		url:         url,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		maxAttempts: 3,
+		retryDelay:  2 * time.Second,
+		alerts:      make(chan domain.StockAlert, bufferSize),
+		done:        make(chan struct{}),
+	}
+	go n.run()
+	return n
+}
+
+func (n *WebhookNotifier) Notify(alert domain.StockAlert) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if n.closed {
+		return
+	}
+	select {
+	case n.alerts <- alert:
+	default:
+		log.Printf("stock alerts: queue full, dropping %s alert for %s", alert.Type, alert.SKU)
+	}
+}
+
+// Close stops accepting alerts and blocks until the queued ones have been
+// delivered or given up on.
+func (n *WebhookNotifier) Close() error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		<-n.done
+		return nil
+	}
+	n.closed = true
+	close(n.alerts)
+	n.mu.Unlock()
+
+	<-n.done
+	return nil
+}
+
+func (n *WebhookNotifier) run() {
+	defer close(n.done)
+
+	for alert := range n.alerts {
+		if err := n.deliver(alert); err != nil {
+			log.Printf("stock alerts: deliver %s alert for %s: %v", alert.Type, alert.SKU, err)
+		}
+	}
+}
+
+func (n *WebhookNotifier) deliver(alert domain.StockAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= n.maxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * n.retryDelay)
+		}
+		lastErr = n.post(body)
+		if lastErr == nil {
+			return nil
+		}
+	}
+	return lastErr
+}
+
+func (n *WebhookNotifier) post(body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package alerting
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kasirinaja/backend/internal/domain"
+)
+
+func TestWebhookNotifierPostsQueuedAlertsBeforeClosing(t *testing.T) {
+	received := make(chan domain.StockAlert, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected content type %q", r.Header.Get("Content-Type"))
+		}
+		var alert domain.StockAlert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("decode alert: %v", err)
+		}
+		received <- alert
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(server.URL, 4)
+	notifier.Notify(domain.StockAlert{Type: domain.StockAlertLowStock, StoreID: "main-store", SKU: "SKU-ROTI-01", Qty: 29, ReorderPoint: 30, CreatedAt: time.Now().UTC()})
+	if err := notifier.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	notifier.Notify(domain.StockAlert{Type: domain.StockAlertLowStock, SKU: "SKU-AFTER-CLOSE"})
+
+	if len(received) != 1 {
+		t.Fatalf("expected exactly one delivered alert, got %d", len(received))
+	}
+	if alert := <-received; alert.SKU != "SKU-ROTI-01" || alert.Qty != 29 || alert.ReorderPoint != 30 {
+		t.Fatalf("unexpected alert %+v", alert)
+	}
+}
+
+func TestWebhookNotifierDropsAlertsWhenQueueIsFull(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(server.URL, 1)
+	done := make(chan struct{})
+	go func() {
+		for range 10 {
+			notifier.Notify(domain.StockAlert{Type: domain.StockAlertLowStock, SKU: "SKU-ROTI-01"})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected Notify not to block on a slow webhook")
+	}
+	close(release)
+	_ = notifier.Close()
+}
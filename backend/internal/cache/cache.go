@@ -10,6 +10,13 @@ import (
 type RecommendationCache interface {
 	Get(ctx context.Context, key string) (*domain.RecommendationResponse, bool, error)
 	Set(ctx context.Context, key string, value *domain.RecommendationResponse, ttl time.Duration) error
+	Invalidate(ctx context.Context, storeID string) error
+}
+
+// RecommendationKeyPrefix is the namespace for one store's cached
+// recommendations, so invalidating a store leaves the others untouched.
+func RecommendationKeyPrefix(storeID string) string {
+	return "pos:recommendation:" + storeID + ":"
 }
 
 type NoopRecommendationCache struct{}
@@ -21,3 +28,7 @@ func (NoopRecommendationCache) Get(_ context.Context, _ string) (*domain.Recomme
 func (NoopRecommendationCache) Set(_ context.Context, _ string, _ *domain.RecommendationResponse, _ time.Duration) error {
 	return nil
 }
+
+func (NoopRecommendationCache) Invalidate(_ context.Context, _ string) error {
+	return nil
+}
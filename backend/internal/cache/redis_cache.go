@@ -3,6 +3,7 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"strings"
 	"time"
 
 	redis "github.com/redis/go-redis/v9"
@@ -58,3 +59,27 @@ func (c *RedisRecommendationCache) Set(ctx context.Context, key string, value *d
 	}
 	return c.client.Set(ctx, key, payload, ttl).Err()
 }
+
+// Invalidate deletes every cached recommendation for the store. SCAN is used
+// instead of KEYS so a large keyspace doesn't block Redis.
+func (c *RedisRecommendationCache) Invalidate(ctx context.Context, storeID string) error {
+	pattern := globEscaper.Replace(RecommendationKeyPrefix(storeID)) + "*"
+	var cursor uint64
+	for {
+		keys, next, err := c.client.Scan(ctx, cursor, pattern, 200).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := c.client.Del(ctx, keys...).Err(); err != nil {
+				return err
+			}
+		}
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
@@ -2,27 +2,103 @@ package config
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"strconv"
 	"strings"
+	"time"
+
+	"kasirinaja/backend/internal/domain"
 )
 
 type Config struct {
-	Port                     string
-	AllowedOrigin            string
-	DatabaseURL              string
-	RedisAddr                string
-	RedisPassword            string
-	RedisDB                  int
-	StoreID                  string
-	RecommendationTTLSeconds int
-	AuthSecret               string
-	AccessTokenTTLMinutes    int
-	ManagerPIN               string
+	Port                         string
+	AllowedOrigin                string
+	DatabaseURL                  string
+	DBMaxIdleConns               int
+	DBMaxOpenConns               int
+	DBConnMaxLifetimeMinutes     int
+	DBBreakerFailures            int
+	DBReadCacheSeconds           int
+	IDStrategy                   string
+	SeedDemoData                 bool
+	SeedProductsFile             string
+	RedisAddr                    string
+	RedisPassword                string
+	RedisDB                      int
+	StoreID                      string
+	RecommendationTTLSeconds     int
+	PromptCooldownSeconds        int
+	MaxPromptsPerBasket          int
+	AuthSecret                   string
+	AccessTokenTTLMinutes        int
+	RefreshTokenTTLHours         int
+	ManagerPIN                   string
+	AllowNegativeStock           bool
+	EnforceShiftOwnership        bool
+	RequireRegisteredTerminals   bool
+	RequireExplicitStoreID       bool
+	MinStockForRecommendation    int
+	RecommendationTreatmentRatio float64
+	RecommendationMinLift        float64
+	RetrainIntervalHours         int
+	Currency                     string
+	StoreTimezone                string
+	StoreLocalTimestamps         bool
+	EndOfDayReportEnabled        bool
+	EndOfDayReportRecipients     []string
+	EndOfDayReportMinute         int
+	PriceChangeAlertPercent      float64
+	BusinessHours                string
+	StoreBusinessHours           map[string]string
+	AfterHoursSalesThreshold     int
+	AnomalyThresholds            domain.AnomalyThresholds
+	StoreAnomalyThresholds       map[string]domain.AnomalyThresholds
+	ReceiptTemplate              domain.ReceiptTemplate
+	ReceiptLookupURL             string
+	KitchenCategories            []string
+	PaymentMethods               []string
+	StorePaymentMethods          map[string][]string
+	OfflineEnvelopeTTLHours      int
+	ClockSkewToleranceSeconds    int
+	ExpiredLotGraceDays          int
+	RefundWindowDays             int
+	DailyVoidCap                 int
+	DailyRefundCapCents          int64
+	AlertWebhookURL              string
+	AlertExpiryDays              int
+	AlertSweepIntervalMinutes    int
+	RateLimits                   map[string]RateLimit
+	MaxRequestBytes              int64
+	OfflineSyncMaxRequestBytes   int64
+	DefaultLanguage              string
+}
+
+// RateLimit is a per-user token bucket: PerSecond requests refill the
+// bucket, which holds at most Burst. A zero PerSecond disables the limit.
+type RateLimit struct {
+	PerSecond float64
+	Burst     int
+}
+
+// DefaultRateLimits are generous enough that only a misbehaving client, such
+// as one asking for recommendations on every keystroke, hits them.
+var DefaultRateLimits = map[string]RateLimit{
+	"recommendation": {PerSecond: 10, Burst: 30},
+	"checkout":       {PerSecond: 5, Burst: 20},
+	"checkout_quote": {PerSecond: 10, Burst: 30},
 }
 
 func Load() Config {
 	redisDB, _ := strconv.Atoi(getEnv("REDIS_DB", "0"))
+	// Unparseable pool sizes become zero so startup validation rejects them
+	// instead of silently running with the defaults.
+	dbMaxIdleConns, _ := strconv.Atoi(getEnv("DB_MAX_IDLE_CONNS", "8"))
+	dbMaxOpenConns, _ := strconv.Atoi(getEnv("DB_MAX_OPEN_CONNS", "30"))
+	dbConnMaxLifetime, _ := strconv.Atoi(getEnv("DB_CONN_MAX_LIFETIME_MINUTES", "30"))
+	// Body limits follow the same rule: a bad value fails startup.
+	maxRequestBytes, _ := strconv.ParseInt(getEnv("MAX_REQUEST_BYTES", "1048576"), 10, 64)
+	offlineSyncMaxRequestBytes, _ := strconv.ParseInt(getEnv("OFFLINE_SYNC_MAX_REQUEST_BYTES", "16777216"), 10, 64)
 	ttl, err := strconv.Atoi(getEnv("RECOMMENDATION_TTL_SECONDS", "20"))
 	if err != nil || ttl < 1 {
 		ttl = 20
@@ -31,19 +107,206 @@ func Load() Config {
 	if err != nil || tokenTTL < 1 {
 		tokenTTL = 480
 	}
+	refreshTTL, err := strconv.Atoi(getEnv("REFRESH_TOKEN_TTL_HOURS", "168"))
+	if err != nil || refreshTTL < 1 {
+		refreshTTL = 168
+	}
+	offlineEnvelopeTTL, err := strconv.Atoi(getEnv("OFFLINE_ENVELOPE_TTL_HOURS", "24"))
+	if err != nil || offlineEnvelopeTTL < 1 {
+		offlineEnvelopeTTL = 24
+	}
+	clockSkewTolerance, err := strconv.Atoi(getEnv("CLOCK_SKEW_TOLERANCE_SECONDS", "300"))
+	if err != nil || clockSkewTolerance < 1 {
+		clockSkewTolerance = 300
+	}
+	expiredLotGraceDays, err := strconv.Atoi(getEnv("EXPIRED_LOT_GRACE_DAYS", "0"))
+	if err != nil || expiredLotGraceDays < 0 {
+		expiredLotGraceDays = 0
+	}
+	refundWindowDays, err := strconv.Atoi(getEnv("REFUND_WINDOW_DAYS", "0"))
+	if err != nil || refundWindowDays < 0 {
+		refundWindowDays = 0
+	}
+	dailyVoidCap, err := strconv.Atoi(getEnv("DAILY_VOID_CAP", "0"))
+	if err != nil || dailyVoidCap < 0 {
+		dailyVoidCap = 0
+	}
+	dailyRefundCapCents, err := strconv.ParseInt(getEnv("DAILY_REFUND_CAP_CENTS", "0"), 10, 64)
+	if err != nil || dailyRefundCapCents < 0 {
+		dailyRefundCapCents = 0
+	}
+	recommendationCooldown, err := strconv.Atoi(getEnv("RECOMMENDATION_COOLDOWN_SECONDS", "45"))
+	if err != nil || recommendationCooldown < 1 {
+		recommendationCooldown = 45
+	}
+	recommendationMaxPrompts, err := strconv.Atoi(getEnv("RECOMMENDATION_MAX_PROMPTS_PER_BASKET", "3"))
+	if err != nil || recommendationMaxPrompts < 0 {
+		recommendationMaxPrompts = 3
+	}
+	dbBreakerFailures, err := strconv.Atoi(getEnv("DB_BREAKER_FAILURES", "5"))
+	if err != nil || dbBreakerFailures < 1 {
+		dbBreakerFailures = 5
+	}
+	dbReadCacheSeconds, err := strconv.Atoi(getEnv("DB_READ_CACHE_SECONDS", "300"))
+	if err != nil || dbReadCacheSeconds < 1 {
+		dbReadCacheSeconds = 300
+	}
+	alertExpiryDays, err := strconv.Atoi(getEnv("ALERT_EXPIRY_DAYS", "7"))
+	if err != nil || alertExpiryDays < 0 {
+		alertExpiryDays = 7
+	}
+	alertSweepInterval, err := strconv.Atoi(getEnv("ALERT_SWEEP_INTERVAL_MINUTES", "60"))
+	if err != nil || alertSweepInterval < 1 {
+		alertSweepInterval = 60
+	}
+	seedDemoData, err := strconv.ParseBool(getEnv("SEED_DEMO_DATA", "true"))
+	if err != nil {
+		seedDemoData = true
+	}
+	allowNegativeStock, err := strconv.ParseBool(getEnv("ALLOW_NEGATIVE_STOCK", "false"))
+	if err != nil {
+		allowNegativeStock = false
+	}
+	minStockForRecommendation, err := strconv.Atoi(getEnv("MIN_STOCK_FOR_RECOMMENDATION", "1"))
+	if err != nil || minStockForRecommendation < 1 {
+		minStockForRecommendation = 1
+	}
+	treatmentRatio, err := strconv.ParseFloat(getEnv("RECOMMENDATION_TREATMENT_RATIO", "0.5"), 64)
+	if err != nil || treatmentRatio < 0 || treatmentRatio > 1 {
+		treatmentRatio = 0.5
+	}
+	minLift, err := strconv.ParseFloat(getEnv("RECOMMENDATION_MIN_LIFT", "1"), 64)
+	if err != nil || minLift < 0 {
+		minLift = 1
+	}
+	retrainIntervalHours, err := strconv.Atoi(getEnv("RETRAIN_INTERVAL_HOURS", "0"))
+	if err != nil || retrainIntervalHours < 0 {
+		retrainIntervalHours = 0
+	}
+	enforceShiftOwnership, err := strconv.ParseBool(getEnv("ENFORCE_SHIFT_OWNERSHIP", "false"))
+	if err != nil {
+		enforceShiftOwnership = false
+	}
+	requireRegisteredTerminals, err := strconv.ParseBool(getEnv("REQUIRE_REGISTERED_TERMINALS", "false"))
+	if err != nil {
+		requireRegisteredTerminals = false
+	}
+	requireExplicitStoreID, err := strconv.ParseBool(getEnv("REQUIRE_EXPLICIT_STORE_ID", "false"))
+	if err != nil {
+		requireExplicitStoreID = false
+	}
+	storeLocalTimestamps, err := strconv.ParseBool(getEnv("STORE_LOCAL_TIMESTAMPS", "false"))
+	if err != nil {
+		storeLocalTimestamps = false
+	}
+	endOfDayReportEnabled, err := strconv.ParseBool(getEnv("EOD_REPORT_ENABLED", "false"))
+	if err != nil {
+		endOfDayReportEnabled = false
+	}
+	endOfDayReportMinute, ok := parseClockMinute(getEnv("EOD_REPORT_TIME", "22:00"))
+	if !ok {
+		endOfDayReportMinute = 22 * 60
+	}
+	priceChangeAlertPercent, err := strconv.ParseFloat(getEnv("PRICE_CHANGE_ALERT_PERCENT", "30"), 64)
+	if err != nil || priceChangeAlertPercent <= 0 {
+		priceChangeAlertPercent = 30
+	}
+	afterHoursSalesThreshold, err := strconv.Atoi(getEnv("AFTER_HOURS_SALES_THRESHOLD", "1"))
+	if err != nil || afterHoursSalesThreshold < 1 {
+		afterHoursSalesThreshold = 1
+	}
+	storeBusinessHours := map[string]string{}
+	for _, entry := range splitList(os.Getenv("BUSINESS_HOURS_BY_STORE")) {
+		if storeID, hours, ok := strings.Cut(entry, "="); ok {
+			storeBusinessHours[strings.TrimSpace(storeID)] = strings.TrimSpace(hours)
+		}
+	}
+	storeAnomalyThresholds := map[string]domain.AnomalyThresholds{}
+	for _, entry := range splitList(os.Getenv("ANOMALY_THRESHOLDS_BY_STORE")) {
+		if storeID, spec, ok := strings.Cut(entry, "="); ok {
+			storeAnomalyThresholds[strings.TrimSpace(storeID)] = parseAnomalyThresholds(spec)
+		}
+	}
+	// Per-store lists separate stores with commas like the other _BY_STORE
+	// settings, so their methods are separated with "|".
+	storePaymentMethods := map[string][]string{}
+	for _, entry := range splitList(os.Getenv("PAYMENT_METHODS_BY_STORE")) {
+		if storeID, methods, ok := strings.Cut(entry, "="); ok {
+			storePaymentMethods[strings.TrimSpace(storeID)] = splitLines(methods)
+		}
+	}
+	receiptTemplate := domain.ReceiptTemplate{
+		HeaderLines: splitLines(os.Getenv("RECEIPT_HEADER_LINES")),
+		FooterLines: splitLines(getEnv("RECEIPT_FOOTER_LINES", "Terima kasih")),
+	}
+	if len(receiptTemplate.HeaderLines) == 0 {
+		receiptTemplate.HeaderLines = []string{getEnv("RECEIPT_STORE_NAME", "KasirinAja POS")}
+	}
+	receiptTemplate.ShowCashier, _ = strconv.ParseBool(getEnv("RECEIPT_SHOW_CASHIER", "false"))
+	receiptTemplate.ShowTaxBreakdown, _ = strconv.ParseBool(getEnv("RECEIPT_SHOW_TAX_BREAKDOWN", "false"))
+	receiptTemplate.HideCashLinesForNonCash, _ = strconv.ParseBool(getEnv("RECEIPT_HIDE_CASH_LINES_FOR_NON_CASH", "false"))
 
 	cfg := Config{
-		Port:                     getEnv("PORT", "8080"),
-		AllowedOrigin:            getEnv("ALLOWED_ORIGIN", "http://127.0.0.1:3000"),
-		DatabaseURL:              os.Getenv("DATABASE_URL"),
-		RedisAddr:                os.Getenv("REDIS_ADDR"),
-		RedisPassword:            os.Getenv("REDIS_PASSWORD"),
-		RedisDB:                  redisDB,
-		StoreID:                  getEnv("DEFAULT_STORE_ID", "main-store"),
-		RecommendationTTLSeconds: ttl,
-		AuthSecret:               strings.TrimSpace(os.Getenv("AUTH_SECRET")),
-		AccessTokenTTLMinutes:    tokenTTL,
-		ManagerPIN:               strings.TrimSpace(os.Getenv("MANAGER_PIN")),
+		Port:                         getEnv("PORT", "8080"),
+		AllowedOrigin:                getEnv("ALLOWED_ORIGIN", "http://127.0.0.1:3000"),
+		DatabaseURL:                  os.Getenv("DATABASE_URL"),
+		DBMaxIdleConns:               dbMaxIdleConns,
+		DBMaxOpenConns:               dbMaxOpenConns,
+		DBConnMaxLifetimeMinutes:     dbConnMaxLifetime,
+		DBBreakerFailures:            dbBreakerFailures,
+		DBReadCacheSeconds:           dbReadCacheSeconds,
+		IDStrategy:                   strings.TrimSpace(getEnv("ID_STRATEGY", "random")),
+		SeedDemoData:                 seedDemoData,
+		SeedProductsFile:             strings.TrimSpace(os.Getenv("SEED_PRODUCTS_FILE")),
+		RedisAddr:                    os.Getenv("REDIS_ADDR"),
+		RedisPassword:                os.Getenv("REDIS_PASSWORD"),
+		RedisDB:                      redisDB,
+		StoreID:                      getEnv("DEFAULT_STORE_ID", "main-store"),
+		RecommendationTTLSeconds:     ttl,
+		PromptCooldownSeconds:        recommendationCooldown,
+		MaxPromptsPerBasket:          recommendationMaxPrompts,
+		AuthSecret:                   strings.TrimSpace(os.Getenv("AUTH_SECRET")),
+		AccessTokenTTLMinutes:        tokenTTL,
+		RefreshTokenTTLHours:         refreshTTL,
+		ManagerPIN:                   strings.TrimSpace(os.Getenv("MANAGER_PIN")),
+		AllowNegativeStock:           allowNegativeStock,
+		EnforceShiftOwnership:        enforceShiftOwnership,
+		RequireRegisteredTerminals:   requireRegisteredTerminals,
+		RequireExplicitStoreID:       requireExplicitStoreID,
+		MinStockForRecommendation:    minStockForRecommendation,
+		RecommendationTreatmentRatio: treatmentRatio,
+		RecommendationMinLift:        minLift,
+		RetrainIntervalHours:         retrainIntervalHours,
+		Currency:                     strings.ToUpper(strings.TrimSpace(getEnv("CURRENCY", "IDR"))),
+		StoreTimezone:                strings.TrimSpace(getEnv("STORE_TIMEZONE", "UTC")),
+		StoreLocalTimestamps:         storeLocalTimestamps,
+		EndOfDayReportEnabled:        endOfDayReportEnabled,
+		EndOfDayReportRecipients:     splitList(os.Getenv("EOD_REPORT_RECIPIENTS")),
+		EndOfDayReportMinute:         endOfDayReportMinute,
+		PriceChangeAlertPercent:      priceChangeAlertPercent,
+		BusinessHours:                strings.TrimSpace(os.Getenv("BUSINESS_HOURS")),
+		StoreBusinessHours:           storeBusinessHours,
+		AfterHoursSalesThreshold:     afterHoursSalesThreshold,
+		AnomalyThresholds:            parseAnomalyThresholds(os.Getenv("ANOMALY_THRESHOLDS")),
+		StoreAnomalyThresholds:       storeAnomalyThresholds,
+		ReceiptTemplate:              receiptTemplate,
+		ReceiptLookupURL:             strings.TrimSpace(os.Getenv("RECEIPT_LOOKUP_URL")),
+		KitchenCategories:            splitList(os.Getenv("KITCHEN_CATEGORIES")),
+		PaymentMethods:               splitList(os.Getenv("PAYMENT_METHODS")),
+		StorePaymentMethods:          storePaymentMethods,
+		OfflineEnvelopeTTLHours:      offlineEnvelopeTTL,
+		ClockSkewToleranceSeconds:    clockSkewTolerance,
+		ExpiredLotGraceDays:          expiredLotGraceDays,
+		RefundWindowDays:             refundWindowDays,
+		DailyVoidCap:                 dailyVoidCap,
+		DailyRefundCapCents:          dailyRefundCapCents,
+		AlertWebhookURL:              strings.TrimSpace(os.Getenv("ALERT_WEBHOOK_URL")),
+		AlertExpiryDays:              alertExpiryDays,
+		AlertSweepIntervalMinutes:    alertSweepInterval,
+		RateLimits:                   parseRateLimits(os.Getenv("RATE_LIMITS")),
+		MaxRequestBytes:              maxRequestBytes,
+		OfflineSyncMaxRequestBytes:   offlineSyncMaxRequestBytes,
+		DefaultLanguage:              strings.ToLower(strings.TrimSpace(getEnv("DEFAULT_LANGUAGE", "id"))),
 	}
 
 	return cfg
@@ -53,6 +316,99 @@ func (c Config) Address() string {
 	return fmt.Sprintf(":%s", c.Port)
 }
 
+// parseAnomalyThresholds parses "void:3;refund:2;override:5;opname:3".
+// Missing, unknown or non-positive entries stay zero so the default applies.
+func parseAnomalyThresholds(spec string) domain.AnomalyThresholds {
+	var thresholds domain.AnomalyThresholds
+	for _, part := range strings.Split(spec, ";") {
+		key, value, ok := strings.Cut(part, ":")
+		if !ok {
+			continue
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || count < 1 {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "void":
+			thresholds.VoidsPerActor = count
+		case "refund":
+			thresholds.RefundsPerActor = count
+		case "override":
+			thresholds.ManualOverrides = count
+		case "opname":
+			thresholds.StockOpnames = count
+		}
+	}
+	return thresholds
+}
+
+// parseRateLimits applies "recommendation=10:30;checkout=off" overrides of
+// per-second rate and burst to DefaultRateLimits. "off" or a zero rate
+// disables a route's limit; unknown routes and malformed entries are ignored.
+func parseRateLimits(spec string) map[string]RateLimit {
+	limits := make(map[string]RateLimit, len(DefaultRateLimits))
+	for route, limit := range DefaultRateLimits {
+		limits[route] = limit
+	}
+	for _, part := range strings.Split(spec, ";") {
+		route, value, ok := strings.Cut(part, "=")
+		route = strings.ToLower(strings.TrimSpace(route))
+		if _, known := limits[route]; !ok || !known {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if strings.EqualFold(value, "off") {
+			limits[route] = RateLimit{}
+			continue
+		}
+		rateValue, burstValue, _ := strings.Cut(value, ":")
+		rate, err := strconv.ParseFloat(strings.TrimSpace(rateValue), 64)
+		if err != nil || rate < 0 {
+			continue
+		}
+		burst := int(math.Ceil(rate))
+		if burstValue != "" {
+			if burst, err = strconv.Atoi(strings.TrimSpace(burstValue)); err != nil || burst < 1 {
+				continue
+			}
+		}
+		limits[route] = RateLimit{PerSecond: rate, Burst: max(burst, 1)}
+	}
+	return limits
+}
+
+// parseClockMinute parses an HH:MM wall-clock time into minutes after midnight.
+func parseClockMinute(value string) (int, bool) {
+	parsed, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, false
+	}
+	return parsed.Hour()*60 + parsed.Minute(), true
+}
+
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// splitLines splits a "|"-separated list of receipt lines. Lines are kept
+// as written apart from surrounding whitespace, so they may contain commas.
+func splitLines(value string) []string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(value, "|") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
 func getEnv(key string, fallback string) string {
 	val := os.Getenv(key)
 	if val == "" {
@@ -1,6 +1,11 @@
 package config
 
-import "testing"
+import (
+	"strings"
+	"testing"
+
+	"kasirinaja/backend/internal/domain"
+)
 
 func TestLoadDoesNotInjectWeakAuthDefaults(t *testing.T) {
 	t.Setenv("AUTH_SECRET", "")
@@ -14,3 +19,152 @@ func TestLoadDoesNotInjectWeakAuthDefaults(t *testing.T) {
 		t.Fatalf("expected empty MANAGER_PIN when unset, got %q", cfg.ManagerPIN)
 	}
 }
+
+func TestLoadAllowNegativeStock(t *testing.T) {
+	t.Setenv("ALLOW_NEGATIVE_STOCK", "")
+	if Load().AllowNegativeStock {
+		t.Fatalf("expected negative stock to be disallowed by default")
+	}
+
+	t.Setenv("ALLOW_NEGATIVE_STOCK", "true")
+	if !Load().AllowNegativeStock {
+		t.Fatalf("expected ALLOW_NEGATIVE_STOCK=true to enable negative stock")
+	}
+}
+
+func TestLoadAnomalyThresholds(t *testing.T) {
+	t.Setenv("ANOMALY_THRESHOLDS", "void:4; refund:0; bogus:9")
+	t.Setenv("ANOMALY_THRESHOLDS_BY_STORE", "branch-2=override:10;opname:6")
+
+	cfg := Load()
+	if cfg.AnomalyThresholds != (domain.AnomalyThresholds{VoidsPerActor: 4}) {
+		t.Fatalf("expected only the void threshold to be set, got %+v", cfg.AnomalyThresholds)
+	}
+	want := domain.AnomalyThresholds{ManualOverrides: 10, StockOpnames: 6}
+	if got := cfg.StoreAnomalyThresholds["branch-2"]; got != want {
+		t.Fatalf("expected branch-2 thresholds %+v, got %+v", want, got)
+	}
+}
+
+func TestLoadReceiptTemplate(t *testing.T) {
+	t.Setenv("RECEIPT_HEADER_LINES", "")
+	t.Setenv("RECEIPT_FOOTER_LINES", "")
+	t.Setenv("RECEIPT_STORE_NAME", "Toko Maju")
+	if header := Load().ReceiptTemplate.HeaderLines; len(header) != 1 || header[0] != "Toko Maju" {
+		t.Fatalf("expected RECEIPT_STORE_NAME to be the default header, got %q", header)
+	}
+
+	t.Setenv("RECEIPT_HEADER_LINES", "Toko Maju | Cabang Depok")
+	t.Setenv("RECEIPT_FOOTER_LINES", "Jl. Margonda No. 1, Depok|Terima kasih")
+	t.Setenv("RECEIPT_SHOW_CASHIER", "true")
+
+	template := Load().ReceiptTemplate
+	if len(template.HeaderLines) != 2 || template.HeaderLines[1] != "Cabang Depok" {
+		t.Fatalf("unexpected header lines %q", template.HeaderLines)
+	}
+	if len(template.FooterLines) != 2 || template.FooterLines[0] != "Jl. Margonda No. 1, Depok" {
+		t.Fatalf("expected commas to be kept in footer lines, got %q", template.FooterLines)
+	}
+	if !template.ShowCashier || template.ShowTaxBreakdown {
+		t.Fatalf("unexpected template flags %+v", template)
+	}
+}
+
+func TestLoadSeedSettings(t *testing.T) {
+	t.Setenv("SEED_DEMO_DATA", "")
+	t.Setenv("SEED_PRODUCTS_FILE", "")
+	cfg := Load()
+	if !cfg.SeedDemoData || cfg.SeedProductsFile != "" {
+		t.Fatalf("expected demo data on and no seed file by default, got %t %q", cfg.SeedDemoData, cfg.SeedProductsFile)
+	}
+
+	t.Setenv("SEED_DEMO_DATA", "false")
+	t.Setenv("SEED_PRODUCTS_FILE", " /etc/kasir/products.json ")
+	cfg = Load()
+	if cfg.SeedDemoData || cfg.SeedProductsFile != "/etc/kasir/products.json" {
+		t.Fatalf("expected seed settings to be applied, got %t %q", cfg.SeedDemoData, cfg.SeedProductsFile)
+	}
+}
+
+func TestLoadDatabasePoolSettings(t *testing.T) {
+	t.Setenv("DB_MAX_IDLE_CONNS", "")
+	t.Setenv("DB_MAX_OPEN_CONNS", "")
+	t.Setenv("DB_CONN_MAX_LIFETIME_MINUTES", "")
+	cfg := Load()
+	if cfg.DBMaxIdleConns != 8 || cfg.DBMaxOpenConns != 30 || cfg.DBConnMaxLifetimeMinutes != 30 {
+		t.Fatalf("expected default pool 8/30/30, got %d/%d/%d", cfg.DBMaxIdleConns, cfg.DBMaxOpenConns, cfg.DBConnMaxLifetimeMinutes)
+	}
+
+	t.Setenv("DB_MAX_IDLE_CONNS", "20")
+	t.Setenv("DB_MAX_OPEN_CONNS", "many")
+	t.Setenv("DB_CONN_MAX_LIFETIME_MINUTES", "-5")
+	cfg = Load()
+	if cfg.DBMaxIdleConns != 20 {
+		t.Fatalf("expected DB_MAX_IDLE_CONNS to be applied, got %d", cfg.DBMaxIdleConns)
+	}
+	if cfg.DBMaxOpenConns != 0 || cfg.DBConnMaxLifetimeMinutes != -5 {
+		t.Fatalf("expected invalid pool settings to be kept for validation, got %d/%d", cfg.DBMaxOpenConns, cfg.DBConnMaxLifetimeMinutes)
+	}
+}
+
+func TestLoadRateLimits(t *testing.T) {
+	t.Setenv("RATE_LIMITS", "recommendation=2:4; checkout=off; checkout_quote=3; bogus=1:1; checkout=x")
+
+	limits := Load().RateLimits
+	if got := limits["recommendation"]; got != (RateLimit{PerSecond: 2, Burst: 4}) {
+		t.Fatalf("expected recommendation 2/s burst 4, got %+v", got)
+	}
+	if got := limits["checkout"]; got.PerSecond != 0 {
+		t.Fatalf("expected checkout limit to be off, got %+v", got)
+	}
+	if got := limits["checkout_quote"]; got != (RateLimit{PerSecond: 3, Burst: 3}) {
+		t.Fatalf("expected burst to default to the rate, got %+v", got)
+	}
+	if _, ok := limits["bogus"]; ok {
+		t.Fatalf("expected unknown routes to be ignored")
+	}
+}
+
+func TestLoadMaxRequestBytes(t *testing.T) {
+	t.Setenv("MAX_REQUEST_BYTES", "")
+	t.Setenv("OFFLINE_SYNC_MAX_REQUEST_BYTES", "")
+	cfg := Load()
+	if cfg.MaxRequestBytes != 1<<20 || cfg.OfflineSyncMaxRequestBytes != 16<<20 {
+		t.Fatalf("expected default limits 1 MiB/16 MiB, got %d/%d", cfg.MaxRequestBytes, cfg.OfflineSyncMaxRequestBytes)
+	}
+
+	t.Setenv("MAX_REQUEST_BYTES", "big")
+	t.Setenv("OFFLINE_SYNC_MAX_REQUEST_BYTES", "33554432")
+	cfg = Load()
+	if cfg.MaxRequestBytes != 0 || cfg.OfflineSyncMaxRequestBytes != 32<<20 {
+		t.Fatalf("expected invalid limit kept as zero for validation, got %d/%d", cfg.MaxRequestBytes, cfg.OfflineSyncMaxRequestBytes)
+	}
+}
+
+func TestLoadPaymentMethods(t *testing.T) {
+	t.Setenv("PAYMENT_METHODS", "cash, card")
+	t.Setenv("PAYMENT_METHODS_BY_STORE", "kiosk=cash|qris, ")
+	cfg := Load()
+	if strings.Join(cfg.PaymentMethods, ",") != "cash,card" {
+		t.Fatalf("expected cash and card, got %v", cfg.PaymentMethods)
+	}
+	if len(cfg.StorePaymentMethods) != 1 || strings.Join(cfg.StorePaymentMethods["kiosk"], ",") != "cash,qris" {
+		t.Fatalf("expected kiosk to take cash and qris, got %v", cfg.StorePaymentMethods)
+	}
+}
+
+func TestLoadRecommendationShowPolicy(t *testing.T) {
+	t.Setenv("RECOMMENDATION_COOLDOWN_SECONDS", "")
+	t.Setenv("RECOMMENDATION_MAX_PROMPTS_PER_BASKET", "")
+	cfg := Load()
+	if cfg.PromptCooldownSeconds != 45 || cfg.MaxPromptsPerBasket != 3 {
+		t.Fatalf("expected default 45s cooldown and 3 prompts, got %d/%d", cfg.PromptCooldownSeconds, cfg.MaxPromptsPerBasket)
+	}
+
+	t.Setenv("RECOMMENDATION_COOLDOWN_SECONDS", "60")
+	t.Setenv("RECOMMENDATION_MAX_PROMPTS_PER_BASKET", "0")
+	cfg = Load()
+	if cfg.PromptCooldownSeconds != 60 || cfg.MaxPromptsPerBasket != 0 {
+		t.Fatalf("expected 60s cooldown and no cap, got %d/%d", cfg.PromptCooldownSeconds, cfg.MaxPromptsPerBasket)
+	}
+}
@@ -3,30 +3,76 @@ package domain
 import "time"
 
 type Product struct {
-	SKU        string  `json:"sku"`
-	Name       string  `json:"name"`
-	Category   string  `json:"category"`
-	PriceCents int64   `json:"price_cents"`
-	MarginRate float64 `json:"margin_rate"`
-	Active     bool    `json:"active"`
-}
-
+	SKU             string  `json:"sku"`
+	Name            string  `json:"name"`
+	Category        string  `json:"category"`
+	PriceCents      int64   `json:"price_cents"`
+	MarginRate      float64 `json:"margin_rate"`
+	Active          bool    `json:"active"`
+	Serialized      bool    `json:"serialized"`
+	PickingStrategy string  `json:"picking_strategy"`
+	// TaxRatePercent overrides the sale's tax rate for this product, e.g. 0
+	// for tax-exempt goods. Nil charges the rate given at checkout.
+	TaxRatePercent *float64 `json:"tax_rate_percent,omitempty"`
+	// AvailableFrom and AvailableUntil limit a seasonal product to the
+	// store-local dates between them, inclusive. Outside them it is listed
+	// and sold as if inactive; nil leaves that end open.
+	AvailableFrom  *time.Time `json:"available_from,omitempty"`
+	AvailableUntil *time.Time `json:"available_until,omitempty"`
+	// Brand and Tags group products across categories for filtering and
+	// reporting. Tags are lowercase and unique, e.g. "halal".
+	Brand string   `json:"brand,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+// ProductFilter narrows a product listing. Empty fields match everything;
+// Brand matches regardless of case.
+type ProductFilter struct {
+	Tag   string
+	Brand string
+}
+
+// ProductCreateRequest takes MarginRate as a fraction of the price, e.g. 0.3.
+// Values above 1 and up to 100 are read as percentages, so 30 is stored as
+// 0.3; ProductUpdateRequest follows the same convention. AvailableFrom and
+// AvailableUntil are YYYY-MM-DD dates; empty leaves that end open.
 type ProductCreateRequest struct {
-	StoreID      string  `json:"store_id"`
-	SKU          string  `json:"sku"`
-	Name         string  `json:"name"`
-	Category     string  `json:"category"`
-	PriceCents   int64   `json:"price_cents"`
-	MarginRate   float64 `json:"margin_rate"`
-	InitialStock int     `json:"initial_stock"`
+	StoreID         string   `json:"store_id"`
+	SKU             string   `json:"sku"`
+	Name            string   `json:"name"`
+	Category        string   `json:"category"`
+	PriceCents      int64    `json:"price_cents"`
+	MarginRate      float64  `json:"margin_rate"`
+	InitialStock    int      `json:"initial_stock"`
+	Serialized      bool     `json:"serialized"`
+	PickingStrategy string   `json:"picking_strategy,omitempty"`
+	TaxRatePercent  *float64 `json:"tax_rate_percent,omitempty"`
+	AvailableFrom   string   `json:"available_from,omitempty"`
+	AvailableUntil  string   `json:"available_until,omitempty"`
+	Brand           string   `json:"brand,omitempty"`
+	Tags            []string `json:"tags,omitempty"`
 }
 
 type ProductUpdateRequest struct {
-	Name       *string  `json:"name,omitempty"`
-	Category   *string  `json:"category,omitempty"`
-	PriceCents *int64   `json:"price_cents,omitempty"`
-	MarginRate *float64 `json:"margin_rate,omitempty"`
-	Active     *bool    `json:"active,omitempty"`
+	Name            *string  `json:"name,omitempty"`
+	Category        *string  `json:"category,omitempty"`
+	PriceCents      *int64   `json:"price_cents,omitempty"`
+	MarginRate      *float64 `json:"margin_rate,omitempty"`
+	Active          *bool    `json:"active,omitempty"`
+	Serialized      *bool    `json:"serialized,omitempty"`
+	PickingStrategy *string  `json:"picking_strategy,omitempty"`
+	TaxRatePercent  *float64 `json:"tax_rate_percent,omitempty"`
+	// ClearTaxRate drops the product's own tax rate so it is charged the
+	// checkout rate again.
+	ClearTaxRate bool `json:"clear_tax_rate,omitempty"`
+	// AvailableFrom and AvailableUntil replace the availability dates when
+	// set; an empty string clears that end.
+	AvailableFrom  *string `json:"available_from,omitempty"`
+	AvailableUntil *string `json:"available_until,omitempty"`
+	// Brand and Tags replace the product's when set; an empty brand or tag
+	// list clears them.
+	Brand *string   `json:"brand,omitempty"`
+	Tags  *[]string `json:"tags,omitempty"`
 }
 
 type ProductPriceHistory struct {
@@ -39,8 +85,9 @@ type ProductPriceHistory struct {
 }
 
 type CartItem struct {
-	SKU string `json:"sku"`
-	Qty int    `json:"qty"`
+	SKU     string   `json:"sku"`
+	Qty     int      `json:"qty"`
+	Serials []string `json:"serials,omitempty"`
 }
 
 type RecommendationRequest struct {
@@ -49,6 +96,7 @@ type RecommendationRequest struct {
 	Timestamp      *time.Time `json:"timestamp,omitempty"`
 	QueueSpeedHint float64    `json:"queue_speed_hint"`
 	PromptCount    int        `json:"prompt_count"`
+	Limit          int        `json:"limit,omitempty"`
 	CartItems      []CartItem `json:"cart_items"`
 }
 
@@ -59,6 +107,7 @@ type Recommendation struct {
 	ExpectedMarginLiftCents int64   `json:"expected_margin_lift_cents"`
 	ReasonCode              string  `json:"reason_code"`
 	Confidence              float64 `json:"confidence"`
+	AvailableQty            int     `json:"available_qty"`
 }
 
 type UIPolicy struct {
@@ -67,9 +116,11 @@ type UIPolicy struct {
 }
 
 type RecommendationResponse struct {
-	Recommendation *Recommendation `json:"recommendation,omitempty"`
-	UIPolicy       UIPolicy        `json:"ui_policy"`
-	LatencyMS      int64           `json:"latency_ms"`
+	Recommendation   *Recommendation  `json:"recommendation,omitempty"`
+	Recommendations  []Recommendation `json:"recommendations,omitempty"`
+	UIPolicy         UIPolicy         `json:"ui_policy"`
+	ExperimentBucket string           `json:"experiment_bucket,omitempty"`
+	LatencyMS        int64            `json:"latency_ms"`
 }
 
 type LoginRequest struct {
@@ -78,9 +129,19 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	AccessToken string `json:"access_token"`
-	Role        string `json:"role"`
-	ExpiresAt   string `json:"expires_at"`
+	AccessToken      string `json:"access_token"`
+	Role             string `json:"role"`
+	ExpiresAt        string `json:"expires_at"`
+	RefreshToken     string `json:"refresh_token,omitempty"`
+	RefreshExpiresAt string `json:"refresh_expires_at,omitempty"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
 type Actor struct {
@@ -101,6 +162,14 @@ type CheckoutRequest struct {
 	ManualOverride     bool                       `json:"manual_override"`
 	CartItems          []CartItem                 `json:"cart_items"`
 	RecommendationInfo CheckoutRecommendationInfo `json:"recommendation_info"`
+	// ChangeAsCredit issues the change of an overpaid cash or split payment
+	// as store credit under StoreCreditCode, a customer identifier or
+	// voucher code. A voucher code is generated when it is empty.
+	ChangeAsCredit  bool   `json:"change_as_credit,omitempty"`
+	StoreCreditCode string `json:"store_credit_code,omitempty"`
+	// CustomerID optionally links the sale to a customer by phone number
+	// or member code. Anonymous sales leave it empty.
+	CustomerID string `json:"customer_id,omitempty"`
 }
 
 type CheckoutRecommendationInfo struct {
@@ -127,6 +196,11 @@ type CheckoutResponse struct {
 	Recommendation *string        `json:"recommendation_sku,omitempty"`
 	Duplicate      bool           `json:"duplicate"`
 	CreatedAt      string         `json:"created_at"`
+	// StoreCreditCents is change issued as store credit under
+	// StoreCreditCode instead of ChangeCents.
+	StoreCreditCode  string `json:"store_credit_code,omitempty"`
+	StoreCreditCents int64  `json:"store_credit_cents,omitempty"`
+	CustomerID       string `json:"customer_id,omitempty"`
 }
 
 type CheckoutLookupResponse struct {
@@ -134,9 +208,78 @@ type CheckoutLookupResponse struct {
 	Checkout *CheckoutResponse `json:"checkout,omitempty"`
 }
 
+// CheckoutQuoteResponse is what a checkout request would charge, computed
+// without reserving stock or recording a sale. DiscountCents includes
+// PromoDiscountCents.
+type CheckoutQuoteResponse struct {
+	StoreID            string         `json:"store_id"`
+	Lines              []QuoteLine    `json:"lines"`
+	SubtotalCents      int64          `json:"subtotal_cents"`
+	PromoDiscountCents int64          `json:"promo_discount_cents"`
+	DiscountCents      int64          `json:"discount_cents"`
+	TaxCents           int64          `json:"tax_cents"`
+	TotalCents         int64          `json:"total_cents"`
+	CashReceived       int64          `json:"cash_received_cents"`
+	ChangeCents        int64          `json:"change_cents"`
+	StoreCreditCents   int64          `json:"store_credit_cents"`
+	AppliedPromos      []AppliedPromo `json:"applied_promos"`
+	ItemCount          int            `json:"item_count"`
+}
+
+type QuoteLine struct {
+	SKU            string  `json:"sku"`
+	Name           string  `json:"name"`
+	Qty            int     `json:"qty"`
+	UnitPriceCents int64   `json:"unit_price_cents"`
+	LineTotalCents int64   `json:"line_total_cents"`
+	TaxRatePercent float64 `json:"tax_rate_percent"`
+	TaxCents       int64   `json:"tax_cents"`
+}
+
+type AppliedPromo struct {
+	PromoID       string `json:"promo_id"`
+	Name          string `json:"name"`
+	DiscountCents int64  `json:"discount_cents"`
+}
+
+// Store credit ledger entry kinds. Issued credit is positive, redeemed credit
+// negative; a voided sale reverses the entries it made.
+const (
+	StoreCreditKindIssue  = "issue"
+	StoreCreditKindRedeem = "redeem"
+	StoreCreditKindVoid   = "void"
+)
+
+// StoreCreditEntry is one movement of a store credit balance. Code is the
+// customer identifier or printed voucher code the credit is held under.
+type StoreCreditEntry struct {
+	ID            string    `json:"id"`
+	StoreID       string    `json:"store_id"`
+	Code          string    `json:"code"`
+	Kind          string    `json:"kind"`
+	AmountCents   int64     `json:"amount_cents"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	CreatedBy     string    `json:"created_by,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type StoreCreditBalance struct {
+	Code         string             `json:"code"`
+	BalanceCents int64              `json:"balance_cents"`
+	Entries      []StoreCreditEntry `json:"entries"`
+}
+
+type StoreCreditRedeemRequest struct {
+	StoreID     string `json:"store_id"`
+	AmountCents int64  `json:"amount_cents"`
+}
+
 type OfflineTransaction struct {
 	ClientTransactionID string          `json:"client_transaction_id"`
 	Checkout            CheckoutRequest `json:"checkout"`
+	// QueuedAt is when the terminal rang the sale up. Sales are replayed in
+	// this order; those without it go last in the order sent.
+	QueuedAt time.Time `json:"queued_at,omitempty"`
 }
 
 type OfflineSyncRequest struct {
@@ -144,12 +287,17 @@ type OfflineSyncRequest struct {
 	TerminalID   string               `json:"terminal_id"`
 	EnvelopeID   string               `json:"envelope_id"`
 	Transactions []OfflineTransaction `json:"transactions"`
+	// AllOrNothing stores the envelope only if every sale is accepted. By
+	// default each sale is accepted or rejected on its own.
+	AllOrNothing bool `json:"all_or_nothing,omitempty"`
 }
 
 type OfflineSyncStatus struct {
 	ClientTransactionID string `json:"client_transaction_id"`
 	Status              string `json:"status"`
 	Reason              string `json:"reason,omitempty"`
+	ReasonCode          string `json:"reason_code,omitempty"`
+	ConflictSKU         string `json:"conflict_sku,omitempty"`
 	TransactionID       string `json:"transaction_id,omitempty"`
 }
 
@@ -163,11 +311,13 @@ type Shift struct {
 	StoreID           string     `json:"store_id"`
 	TerminalID        string     `json:"terminal_id"`
 	CashierName       string     `json:"cashier_name"`
+	OpenedBy          string     `json:"opened_by,omitempty"`
 	OpeningFloatCents int64      `json:"opening_float_cents"`
 	ClosingCashCents  int64      `json:"closing_cash_cents,omitempty"`
 	Status            string     `json:"status"`
 	OpenedAt          time.Time  `json:"opened_at"`
 	ClosedAt          *time.Time `json:"closed_at,omitempty"`
+	Notes             string     `json:"notes,omitempty"`
 }
 
 type ShiftOpenRequest struct {
@@ -177,21 +327,120 @@ type ShiftOpenRequest struct {
 	OpeningFloatCents int64  `json:"opening_float_cents"`
 }
 
+// ShiftUpdateRequest corrects an open shift. Fields left out are unchanged.
+type ShiftUpdateRequest struct {
+	OpeningFloatCents *int64  `json:"opening_float_cents,omitempty"`
+	Notes             *string `json:"notes,omitempty"`
+	ManagerPIN        string  `json:"manager_pin"`
+}
+
 type ShiftCloseRequest struct {
 	StoreID          string `json:"store_id"`
 	TerminalID       string `json:"terminal_id"`
 	ClosingCashCents int64  `json:"closing_cash_cents"`
 	Notes            string `json:"notes"`
+	Force            bool   `json:"force,omitempty"`
 }
 
 type ShiftResponse struct {
 	Shift Shift `json:"shift"`
 }
 
+// Terminal is a POS device registered to ring sales under its terminal ID.
+// Only a hash of its token is kept; the token itself is returned once, at
+// registration.
+type Terminal struct {
+	StoreID    string     `json:"store_id"`
+	TerminalID string     `json:"terminal_id"`
+	Label      string     `json:"label"`
+	TokenHash  string     `json:"-"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type TerminalRegisterRequest struct {
+	StoreID    string `json:"store_id"`
+	TerminalID string `json:"terminal_id"`
+	Label      string `json:"label"`
+}
+
+// TerminalRegistration carries the token the device must send in the
+// X-Terminal-Token header. It is not shown again.
+type TerminalRegistration struct {
+	Terminal Terminal `json:"terminal"`
+	Token    string   `json:"token"`
+}
+
+type TerminalListResponse struct {
+	StoreID   string     `json:"store_id"`
+	Terminals []Terminal `json:"terminals"`
+}
+
+type ShiftListResponse struct {
+	StoreID    string    `json:"store_id"`
+	TerminalID string    `json:"terminal_id,omitempty"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Shifts     []Shift   `json:"shifts"`
+}
+
+type ShiftCashMovement struct {
+	ID          string    `json:"id"`
+	ShiftID     string    `json:"shift_id"`
+	Kind        string    `json:"kind"`
+	AmountCents int64     `json:"amount_cents"`
+	Note        string    `json:"note,omitempty"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type ShiftCashMovementRequest struct {
+	Kind        string `json:"kind"`
+	AmountCents int64  `json:"amount_cents"`
+	Note        string `json:"note"`
+}
+
+type ShiftSummary struct {
+	Shift             Shift  `json:"shift"`
+	TransactionCount  int    `json:"transaction_count"`
+	CashSalesCents    int64  `json:"cash_sales_cents"`
+	CashRefundsCents  int64  `json:"cash_refunds_cents"`
+	CashDropsCents    int64  `json:"cash_drops_cents"`
+	PaidInCents       int64  `json:"paid_in_cents"`
+	PaidOutCents      int64  `json:"paid_out_cents"`
+	ExpectedCashCents int64  `json:"expected_cash_cents"`
+	VarianceCents     *int64 `json:"variance_cents,omitempty"`
+}
+
+// CustomerTransaction is one sale in a customer's purchase history.
+type CustomerTransaction struct {
+	TransactionID string    `json:"transaction_id"`
+	StoreID       string    `json:"store_id"`
+	TerminalID    string    `json:"terminal_id"`
+	Status        string    `json:"status"`
+	PaymentMethod string    `json:"payment_method"`
+	TotalCents    int64     `json:"total_cents"`
+	ItemCount     int       `json:"item_count"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// CustomerTransactionsResponse lists a customer's sales, newest first.
+// PaidTotalCents sums the listed sales still paid, leaving out voided and
+// refunded ones.
+type CustomerTransactionsResponse struct {
+	CustomerID     string                `json:"customer_id"`
+	PaidTotalCents int64                 `json:"paid_total_cents"`
+	Transactions   []CustomerTransaction `json:"transactions"`
+}
+
+// VoidTransactionRequest voids a sale. OverrideDailyCap lets an admin void
+// past the daily void cap; the override is audited.
 type VoidTransactionRequest struct {
-	TransactionID string `json:"transaction_id"`
-	Reason        string `json:"reason"`
-	ManagerPIN    string `json:"manager_pin"`
+	TransactionID    string `json:"transaction_id"`
+	Reason           string `json:"reason"`
+	ManagerPIN       string `json:"manager_pin"`
+	OverrideDailyCap bool   `json:"override_daily_cap,omitempty"`
 }
 
 type VoidTransactionResponse struct {
@@ -200,11 +449,17 @@ type VoidTransactionResponse struct {
 	VoidedAt      string `json:"voided_at"`
 }
 
+// RefundRequest refunds part or all of a sale. OverrideRefundWindow lets an
+// admin refund a sale older than the refund window, with OverrideNote saying
+// why, and OverrideDailyCap refund past the daily refund cap.
 type RefundRequest struct {
 	OriginalTransactionID string `json:"original_transaction_id"`
 	Reason                string `json:"reason"`
 	AmountCents           int64  `json:"amount_cents"`
 	ManagerPIN            string `json:"manager_pin"`
+	OverrideRefundWindow  bool   `json:"override_refund_window,omitempty"`
+	OverrideNote          string `json:"override_note,omitempty"`
+	OverrideDailyCap      bool   `json:"override_daily_cap,omitempty"`
 }
 
 type Refund struct {
@@ -238,6 +493,9 @@ type ItemReturnRequest struct {
 	CashReceivedCents     int64            `json:"cash_received_cents,omitempty"`
 	ReturnItems           []ItemReturnLine `json:"return_items"`
 	ExchangeItems         []CartItem       `json:"exchange_items,omitempty"`
+	// OverrideRefundWindow and OverrideNote work as on RefundRequest.
+	OverrideRefundWindow bool   `json:"override_refund_window,omitempty"`
+	OverrideNote         string `json:"override_note,omitempty"`
 }
 
 type ItemReturn struct {
@@ -266,7 +524,34 @@ type Supplier struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+type SupplierUpdateRequest struct {
+	Name  *string `json:"name,omitempty"`
+	Phone *string `json:"phone,omitempty"`
+}
+
+// SupplierProduct records that a supplier carries a SKU, with the price it is
+// usually bought at and how many days an order takes to arrive.
+type SupplierProduct struct {
+	SupplierID       string    `json:"supplier_id"`
+	SKU              string    `json:"sku"`
+	DefaultCostCents int64     `json:"default_cost_cents"`
+	LeadTimeDays     int       `json:"lead_time_days"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+type SupplierProductSetRequest struct {
+	SKU              string `json:"sku"`
+	DefaultCostCents int64  `json:"default_cost_cents"`
+	LeadTimeDays     int    `json:"lead_time_days"`
+}
+
+type SupplierProductListResponse struct {
+	SupplierID string            `json:"supplier_id"`
+	Products   []SupplierProduct `json:"products"`
+}
+
 type SupplierCreateRequest struct {
+	ID    string `json:"id,omitempty"`
 	Name  string `json:"name"`
 	Phone string `json:"phone"`
 }
@@ -288,27 +573,134 @@ type InventoryLot struct {
 	SKU          string     `json:"sku"`
 	LotCode      string     `json:"lot_code"`
 	ExpiryDate   *time.Time `json:"expiry_date,omitempty"`
+	DaysToExpiry *int       `json:"days_to_expiry,omitempty"`
 	QtyReceived  int        `json:"qty_received"`
 	QtyAvailable int        `json:"qty_available"`
 	CostCents    int64      `json:"cost_cents"`
 	SourceType   string     `json:"source_type"`
 	SourceID     string     `json:"source_id,omitempty"`
 	Notes        string     `json:"notes,omitempty"`
+	Serials      []string   `json:"serials,omitempty"`
 	ReceivedAt   time.Time  `json:"received_at"`
 }
 
 type InventoryLotReceiveRequest struct {
+	StoreID    string   `json:"store_id"`
+	SKU        string   `json:"sku"`
+	LotCode    string   `json:"lot_code"`
+	ExpiryDate string   `json:"expiry_date,omitempty"`
+	Qty        int      `json:"qty"`
+	CostCents  int64    `json:"cost_cents"`
+	Notes      string   `json:"notes"`
+	Serials    []string `json:"serials,omitempty"`
+}
+
+type InventoryLotBatchReceiveRequest struct {
+	Lots []InventoryLotReceiveRequest `json:"lots"`
+}
+
+// StockBulkSetRequest overwrites the on-hand quantity of many SKUs at once,
+// e.g. when loading the opening stock of a new store.
+type StockBulkSetRequest struct {
+	StoreID string            `json:"store_id"`
+	Items   []StockAdjustment `json:"items"`
+}
+
+type StockBulkSetResponse struct {
+	StoreID  string `json:"store_id"`
+	SKUCount int    `json:"sku_count"`
+	TotalQty int    `json:"total_qty"`
+}
+
+type InventoryLotUpdateRequest struct {
+	QtyAvailable *int   `json:"qty_available,omitempty"`
+	CostCents    *int64 `json:"cost_cents,omitempty"`
+	Reason       string `json:"reason"`
+}
+
+type InventoryLotListResponse struct {
+	Lots []InventoryLot `json:"lots"`
+}
+
+type InventorySerial struct {
+	Serial        string     `json:"serial"`
+	StoreID       string     `json:"store_id"`
+	SKU           string     `json:"sku"`
+	LotID         string     `json:"lot_id"`
+	Status        string     `json:"status"`
+	TransactionID string     `json:"transaction_id,omitempty"`
+	ReceivedAt    time.Time  `json:"received_at"`
+	SoldAt        *time.Time `json:"sold_at,omitempty"`
+}
+
+type InventorySerialListResponse struct {
+	StoreID string            `json:"store_id"`
+	SKU     string            `json:"sku"`
+	Status  string            `json:"status,omitempty"`
+	Serials []InventorySerial `json:"serials"`
+}
+
+type StockMovement struct {
+	ID        int64     `json:"id"`
+	StoreID   string    `json:"store_id"`
+	SKU       string    `json:"sku"`
+	Delta     int       `json:"delta"`
+	Reason    string    `json:"reason"`
+	RefID     string    `json:"ref_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type StockMovementListResponse struct {
+	StoreID   string          `json:"store_id"`
+	SKU       string          `json:"sku,omitempty"`
+	From      time.Time       `json:"from"`
+	To        time.Time       `json:"to"`
+	Movements []StockMovement `json:"movements"`
+}
+
+type ExpiringLot struct {
+	LotID           string    `json:"lot_id"`
+	StoreID         string    `json:"store_id"`
+	SKU             string    `json:"sku"`
+	ProductName     string    `json:"product_name"`
+	LotCode         string    `json:"lot_code"`
+	ExpiryDate      time.Time `json:"expiry_date"`
+	QtyAvailable    int       `json:"qty_available"`
+	CostCents       int64     `json:"cost_cents"`
+	AtRiskCostCents int64     `json:"at_risk_cost_cents"`
+}
+
+type ExpiringLotListResponse struct {
+	StoreID              string        `json:"store_id"`
+	WithinDays           int           `json:"within_days"`
+	Lots                 []ExpiringLot `json:"lots"`
+	TotalAtRiskCostCents int64         `json:"total_at_risk_cost_cents"`
+}
+
+type StockWriteOffRequest struct {
 	StoreID    string `json:"store_id"`
 	SKU        string `json:"sku"`
-	LotCode    string `json:"lot_code"`
-	ExpiryDate string `json:"expiry_date,omitempty"`
 	Qty        int    `json:"qty"`
-	CostCents  int64  `json:"cost_cents"`
-	Notes      string `json:"notes"`
+	Reason     string `json:"reason"`
+	ManagerPIN string `json:"manager_pin"`
 }
 
-type InventoryLotListResponse struct {
-	Lots []InventoryLot `json:"lots"`
+type StockWriteOff struct {
+	ID        string    `json:"id"`
+	StoreID   string    `json:"store_id"`
+	SKU       string    `json:"sku"`
+	Qty       int       `json:"qty"`
+	CostCents int64     `json:"cost_cents"`
+	Reason    string    `json:"reason"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type StockTransferRequest struct {
+	FromStoreID string `json:"from_store_id"`
+	ToStoreID   string `json:"to_store_id"`
+	SKU         string `json:"sku"`
+	Qty         int    `json:"qty"`
 }
 
 type StockOpnameItem struct {
@@ -329,26 +721,40 @@ type StockOpnameAdjustment struct {
 	DeltaQty   int    `json:"delta_qty"`
 }
 
+type StockOpnameRecord struct {
+	ID        string
+	StoreID   string
+	Notes     string
+	CreatedBy string
+	CreatedAt time.Time
+	Items     []StockOpnameAdjustment
+}
+
 type StockOpnameResponse struct {
 	OpnameID    string                  `json:"opname_id"`
 	StoreID     string                  `json:"store_id"`
 	Notes       string                  `json:"notes"`
+	CreatedBy   string                  `json:"created_by,omitempty"`
 	Adjustments []StockOpnameAdjustment `json:"adjustments"`
 	CreatedAt   string                  `json:"created_at"`
 }
 
 type PurchaseOrder struct {
-	ID         string              `json:"id"`
-	StoreID    string              `json:"store_id"`
-	SupplierID string              `json:"supplier_id"`
-	Status     string              `json:"status"`
-	CreatedAt  time.Time           `json:"created_at"`
-	ReceivedAt *time.Time          `json:"received_at,omitempty"`
-	ReceivedBy string              `json:"received_by,omitempty"`
-	Items      []PurchaseOrderItem `json:"items"`
+	ID           string              `json:"id"`
+	StoreID      string              `json:"store_id"`
+	SupplierID   string              `json:"supplier_id"`
+	Status       string              `json:"status"`
+	CreatedAt    time.Time           `json:"created_at"`
+	ReceivedAt   *time.Time          `json:"received_at,omitempty"`
+	ReceivedBy   string              `json:"received_by,omitempty"`
+	CancelledAt  *time.Time          `json:"cancelled_at,omitempty"`
+	CancelledBy  string              `json:"cancelled_by,omitempty"`
+	CancelReason string              `json:"cancel_reason,omitempty"`
+	Items        []PurchaseOrderItem `json:"items"`
 }
 
 type PurchaseOrderCreateRequest struct {
+	ID         string              `json:"id,omitempty"`
 	StoreID    string              `json:"store_id"`
 	SupplierID string              `json:"supplier_id"`
 	Items      []PurchaseOrderItem `json:"items"`
@@ -358,6 +764,10 @@ type PurchaseOrderReceiveRequest struct {
 	ReceivedBy string `json:"received_by"`
 }
 
+type PurchaseOrderCancelRequest struct {
+	Reason string `json:"reason"`
+}
+
 type PurchaseOrderResponse struct {
 	PurchaseOrder PurchaseOrder `json:"purchase_order"`
 }
@@ -375,14 +785,92 @@ type ReorderSuggestion struct {
 	RecommendedQty         int    `json:"recommended_qty"`
 	LastCostCents          int64  `json:"last_cost_cents"`
 	EstimatedPurchaseCents int64  `json:"estimated_purchase_cents"`
+	// Basis is ReorderBasisVelocity when RecommendedQty was derived from
+	// recent sales and the supplier lead time, ReorderBasisReorderPoint when
+	// there were no recent sales to go on.
+	Basis          string  `json:"basis"`
+	VelocityPerDay float64 `json:"velocity_per_day"`
+	LeadTimeDays   int     `json:"lead_time_days"`
 }
 
+const (
+	ReorderBasisVelocity     = "velocity"
+	ReorderBasisReorderPoint = "reorder_point"
+)
+
 type ReorderSuggestionResponse struct {
 	StoreID     string              `json:"store_id"`
 	GeneratedAt string              `json:"generated_at"`
 	Suggestions []ReorderSuggestion `json:"suggestions"`
 }
 
+// PurchaseOrdersFromReorderRequest picks the supplier of each suggested SKU
+// from SupplierIDBySKU, falling back to DefaultSupplierIDByCategory for the
+// product's category.
+type PurchaseOrdersFromReorderRequest struct {
+	StoreID                     string            `json:"store_id"`
+	SupplierIDBySKU             map[string]string `json:"supplier_id_by_sku"`
+	DefaultSupplierIDByCategory map[string]string `json:"default_supplier_id_by_category"`
+}
+
+type PurchaseOrdersFromReorderResponse struct {
+	StoreID          string   `json:"store_id"`
+	PurchaseOrderIDs []string `json:"purchase_order_ids"`
+	// UnmappedSKUs are suggested SKUs left out because no supplier was given
+	// for them or their category.
+	UnmappedSKUs []string `json:"unmapped_skus"`
+}
+
+const (
+	StockAlertLowStock    = "low_stock"
+	StockAlertLotExpiring = "lot_expiring"
+)
+
+const (
+	JobStatusPending = "pending"
+	JobStatusOK      = "ok"
+	JobStatusFailed  = "failed"
+)
+
+// JobStatus is the health of one background job. LastStatus stays pending
+// until the job has run once.
+type JobStatus struct {
+	Name       string     `json:"name"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	LastStatus string     `json:"last_status"`
+	LastError  string     `json:"last_error,omitempty"`
+	NextRunAt  *time.Time `json:"next_run_at,omitempty"`
+}
+
+type JobListResponse struct {
+	Jobs []JobStatus `json:"jobs"`
+}
+
+// ClientConfigResponse is the store configuration clients need to render the
+// register, such as which payment buttons to show.
+type ClientConfigResponse struct {
+	StoreID        string   `json:"store_id"`
+	Currency       string   `json:"currency"`
+	PaymentMethods []string `json:"payment_methods"`
+}
+
+// StockAlert is pushed to the alert webhook when a SKU drops to its reorder
+// point or a lot is about to expire. Qty is the stock on hand for low-stock
+// alerts and the lot's remaining quantity for expiry alerts.
+type StockAlert struct {
+	Type          string     `json:"type"`
+	StoreID       string     `json:"store_id"`
+	SKU           string     `json:"sku"`
+	ProductName   string     `json:"product_name"`
+	Qty           int        `json:"qty"`
+	ReorderPoint  int        `json:"reorder_point,omitempty"`
+	TransactionID string     `json:"transaction_id,omitempty"`
+	LotID         string     `json:"lot_id,omitempty"`
+	LotCode       string     `json:"lot_code,omitempty"`
+	ExpiryDate    *time.Time `json:"expiry_date,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
 type HoldCartRequest struct {
 	StoreID           string         `json:"store_id"`
 	TerminalID        string         `json:"terminal_id"`
@@ -434,9 +922,19 @@ type OperationalAlert struct {
 }
 
 type OperationalAlertResponse struct {
-	StoreID string             `json:"store_id"`
-	Date    string             `json:"date"`
-	Alerts  []OperationalAlert `json:"alerts"`
+	StoreID    string             `json:"store_id"`
+	Date       string             `json:"date"`
+	Thresholds AnomalyThresholds  `json:"thresholds"`
+	Alerts     []OperationalAlert `json:"alerts"`
+}
+
+// AnomalyThresholds are the counts at which operational alerts fire. A zero
+// field means unset and falls back to the default.
+type AnomalyThresholds struct {
+	VoidsPerActor   int `json:"voids_per_actor"`
+	RefundsPerActor int `json:"refunds_per_actor"`
+	ManualOverrides int `json:"manual_overrides"`
+	StockOpnames    int `json:"stock_opnames"`
 }
 
 type CashierCreateRequest struct {
@@ -444,6 +942,20 @@ type CashierCreateRequest struct {
 	Password string `json:"password"`
 }
 
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ResetPasswordRequest struct {
+	NewPassword string `json:"new_password"`
+}
+
+type UserUpdateRequest struct {
+	Active *bool   `json:"active,omitempty"`
+	Role   *string `json:"role,omitempty"`
+}
+
 type CashierUser struct {
 	Username  string    `json:"username"`
 	Role      string    `json:"role"`
@@ -460,38 +972,81 @@ type UserAccount struct {
 	CreatedAt time.Time
 }
 
+// RefreshToken is a stored refresh token. Only the SHA-256 hash of the
+// opaque token handed to the client is kept.
+type RefreshToken struct {
+	TokenHash string
+	Username  string
+	ExpiresAt time.Time
+	Revoked   bool
+	CreatedAt time.Time
+}
+
 type RetrainRequest struct {
 	StoreID string `json:"store_id"`
 }
 
 type RetrainResponse struct {
-	UpdatedPairs int    `json:"updated_pairs"`
-	UpdatedAt    string `json:"updated_at"`
+	UpdatedPairs int     `json:"updated_pairs"`
+	MinLift      float64 `json:"min_lift"`
+	MaxLift      float64 `json:"max_lift"`
+	UpdatedAt    string  `json:"updated_at"`
 }
 
 type RecommendationEvent struct {
-	StoreID       string
-	TerminalID    string
-	TransactionID string
-	SKU           string
-	Action        string
-	ReasonCode    string
-	Confidence    float64
-	LatencyMS     int64
-	CreatedAt     time.Time
+	StoreID          string
+	TerminalID       string
+	TransactionID    string
+	SKU              string
+	Action           string
+	ReasonCode       string
+	Confidence       float64
+	LatencyMS        int64
+	ExperimentBucket string
+	// ClockSkew marks events served to a terminal whose timestamp was too
+	// far from server time to be trusted.
+	ClockSkew bool
+	CreatedAt time.Time
 }
 
 type AssociationPair struct {
-	SourceSKU string
-	TargetSKU string
-	Affinity  float64
+	SourceSKU  string  `json:"source_sku"`
+	TargetSKU  string  `json:"target_sku"`
+	Affinity   float64 `json:"affinity"`
+	Support    float64 `json:"support"`
+	Confidence float64 `json:"confidence"`
+	Lift       float64 `json:"lift"`
+	Manual     bool    `json:"manual"`
 }
 
+type CategoryAssociationPair struct {
+	SourceCategory string
+	TargetCategory string
+	Affinity       float64
+}
+
+type AssociationPairRequest struct {
+	SourceSKU string  `json:"source_sku"`
+	TargetSKU string  `json:"target_sku"`
+	Affinity  float64 `json:"affinity"`
+}
+
+// TransactionLine is one line of a sale. Name is the product name when it was
+// sold, so a reprinted receipt shows it even after the product is renamed.
 type TransactionLine struct {
 	SKU            string
+	Name           string
 	Qty            int
 	UnitPriceCents int64
+	UnitCostCents  int64
 	MarginRate     float64
+	Serials        []string
+	// TaxRatePercent is the rate charged on the line. TaxableBaseCents is
+	// its amount after its share of the sale's discount, and TaxCents its
+	// share of the tax.
+	TaxRatePercent   float64
+	TaxableBaseCents int64
+	TaxCents         int64
 }
 
 type Transaction struct {
@@ -510,22 +1065,65 @@ type Transaction struct {
 	TotalCents             int64
 	CashReceivedCents      int64
 	ChangeCents            int64
+	StoreCreditCode        string
+	StoreCreditCents       int64
+	CustomerID             string
 	Status                 string
 	VoidReason             string
 	VoidedAt               *time.Time
 	RecommendationShown    bool
 	RecommendationAccepted bool
 	RecommendationSKU      string
+	ExperimentBucket       string
 	CreatedAt              time.Time
 	Items                  []TransactionLine
 }
 
 type AttachMetrics struct {
+	Transactions int64                 `json:"transactions"`
+	Accepted     int64                 `json:"accepted"`
+	AttachRate   float64               `json:"attach_rate"`
+	ByBucket     []AttachBucketMetrics `json:"by_bucket,omitempty"`
+	ByReason     []AttachReasonMetrics `json:"by_reason,omitempty"`
+}
+
+type AttachBucketMetrics struct {
+	Bucket       string  `json:"bucket"`
 	Transactions int64   `json:"transactions"`
 	Accepted     int64   `json:"accepted"`
 	AttachRate   float64 `json:"attach_rate"`
 }
 
+type AttachReasonMetrics struct {
+	ReasonCode string  `json:"reason_code"`
+	Shown      int64   `json:"shown"`
+	Accepted   int64   `json:"accepted"`
+	AttachRate float64 `json:"attach_rate"`
+}
+
+type InventoryValuationLine struct {
+	SKU           string
+	Category      string
+	Qty           int
+	UnitCostCents int64
+}
+
+type InventoryValuationCategory struct {
+	Category   string `json:"category"`
+	SKUs       int    `json:"skus"`
+	Units      int64  `json:"units"`
+	ValueCents int64  `json:"value_cents"`
+}
+
+type InventoryValuationReport struct {
+	StoreID         string                       `json:"store_id"`
+	GeneratedAt     string                       `json:"generated_at"`
+	TotalUnits      int64                        `json:"total_units"`
+	TotalValueCents int64                        `json:"total_value_cents"`
+	MissingCostSKUs int                          `json:"missing_cost_skus"`
+	ByCategory      []InventoryValuationCategory `json:"by_category"`
+}
+
 type DailyReportPayment struct {
 	PaymentMethod string `json:"payment_method"`
 	Transactions  int64  `json:"transactions"`
@@ -547,8 +1145,72 @@ type DailyReport struct {
 	TaxCents             int64                 `json:"tax_cents"`
 	NetSalesCents        int64                 `json:"net_sales_cents"`
 	EstimatedMarginCents int64                 `json:"estimated_margin_cents"`
+	CostOfGoodsCents     int64                 `json:"cost_of_goods_cents"`
+	GrossProfitCents     int64                 `json:"gross_profit_cents"`
+	WriteOffCostCents    int64                 `json:"write_off_cost_cents"`
 	ByPayment            []DailyReportPayment  `json:"by_payment"`
 	ByTerminal           []DailyReportTerminal `json:"by_terminal"`
+	ByTaxRate            []TaxRateTotal        `json:"by_tax_rate"`
+}
+
+// TaxRateTotal is the taxable base and tax of the sale lines charged one
+// rate, as needed for VAT filing.
+type TaxRateTotal struct {
+	RatePercent      float64 `json:"rate"`
+	TaxableBaseCents int64   `json:"taxable_base_cents"`
+	TaxCents         int64   `json:"tax_cents"`
+}
+
+type RangeReportBucket struct {
+	PeriodStart          string `json:"period_start,omitempty"`
+	Transactions         int64  `json:"transactions"`
+	GrossSalesCents      int64  `json:"gross_sales_cents"`
+	DiscountCents        int64  `json:"discount_cents"`
+	TaxCents             int64  `json:"tax_cents"`
+	NetSalesCents        int64  `json:"net_sales_cents"`
+	EstimatedMarginCents int64  `json:"estimated_margin_cents"`
+}
+
+type RangeReport struct {
+	StoreID string              `json:"store_id"`
+	From    string              `json:"from"`
+	To      string              `json:"to"`
+	GroupBy string              `json:"group_by"`
+	Buckets []RangeReportBucket `json:"buckets"`
+	Total   RangeReportBucket   `json:"total"`
+}
+
+// SupplierSalesLine sums the sales of the SKUs attributed to one supplier.
+// RevenueCents is at line prices, before cart discounts and tax, and
+// MarginCents uses the cost frozen on each line. Sales of SKUs with no
+// supplier are reported under an empty SupplierID.
+type SupplierSalesLine struct {
+	SupplierID   string `json:"supplier_id"`
+	SupplierName string `json:"supplier_name,omitempty"`
+	SKUs         int    `json:"skus"`
+	Units        int64  `json:"units"`
+	RevenueCents int64  `json:"revenue_cents"`
+	MarginCents  int64  `json:"margin_cents"`
+}
+
+type SupplierSalesReport struct {
+	StoreID   string              `json:"store_id"`
+	From      string              `json:"from"`
+	To        string              `json:"to"`
+	Suppliers []SupplierSalesLine `json:"suppliers"`
+}
+
+type HourlySalesBucket struct {
+	Hour         int   `json:"hour"`
+	Transactions int64 `json:"transactions"`
+	TotalCents   int64 `json:"total_cents"`
+}
+
+type HourlySalesReport struct {
+	StoreID  string              `json:"store_id"`
+	Date     string              `json:"date"`
+	Timezone string              `json:"timezone"`
+	Hours    []HourlySalesBucket `json:"hours"`
 }
 
 type AuditLog struct {
@@ -563,6 +1225,24 @@ type AuditLog struct {
 	CreatedAt     time.Time `json:"created_at"`
 }
 
+// AuditLogCursor marks the last entry of a page. The next page holds the
+// entries that sort after it in created_at DESC, id DESC order.
+type AuditLogCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// AuditLogFilter narrows an audit log listing. Empty fields match everything.
+type AuditLogFilter struct {
+	Actions []string
+	Actor   string
+}
+
+type AuditLogPage struct {
+	Logs       []AuditLog `json:"logs"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
 type PromoRule struct {
 	ID                string    `json:"id"`
 	Name              string    `json:"name"`
@@ -575,6 +1255,7 @@ type PromoRule struct {
 }
 
 type PromoCreateRequest struct {
+	ID                string  `json:"id,omitempty"`
 	Name              string  `json:"name"`
 	Type              string  `json:"type"`
 	MinSubtotalCents  int64   `json:"min_subtotal_cents"`
@@ -586,8 +1267,25 @@ type PromoToggleRequest struct {
 	Active bool `json:"active"`
 }
 
+// ReceiptTemplate controls what a printed receipt shows around the item
+// lines. Header and footer lines are printed verbatim, e.g. the store name at
+// the top and the address and a thank-you line at the bottom.
+type ReceiptTemplate struct {
+	HeaderLines             []string `json:"header_lines"`
+	FooterLines             []string `json:"footer_lines"`
+	ShowCashier             bool     `json:"show_cashier"`
+	ShowTaxBreakdown        bool     `json:"show_tax_breakdown"`
+	HideCashLinesForNonCash bool     `json:"hide_cash_lines_for_non_cash"`
+}
+
 type HardwareReceiptRequest struct {
 	TransactionID string `json:"transaction_id"`
+	// PrinterWidth is the printer's characters per line: 32 for 58mm paper
+	// or 48 for 80mm. Zero means 48.
+	PrinterWidth int `json:"printer_width,omitempty"`
+	// Language of the receipt labels, e.g. "en". Empty uses the
+	// Accept-Language header, then the configured default.
+	Language string `json:"language,omitempty"`
 }
 
 type HardwareReceiptResponse struct {
@@ -617,6 +1315,12 @@ const (
 	RecommendationShownAction    = "shown"
 	RecommendationAcceptedAction = "accepted"
 	RecommendationRejectedAction = "rejected"
+	RecommendationWithheldAction = "withheld"
+)
+
+const (
+	ExperimentBucketTreatment = "treatment"
+	ExperimentBucketControl   = "control"
 )
 
 const (
@@ -630,7 +1334,100 @@ const (
 	ItemReturnModeExchange = "exchange"
 )
 
+const (
+	OfflineReasonInsufficientStock = "insufficient_stock"
+	OfflineReasonNoActiveShift     = "no_active_shift"
+	OfflineReasonShiftNotOwned     = "shift_not_owned"
+	OfflineReasonInvalid           = "invalid"
+	OfflineReasonBatchAborted      = "batch_aborted"
+	OfflineReasonError             = "error"
+)
+
 const (
 	ShiftStatusOpen   = "open"
 	ShiftStatusClosed = "closed"
 )
+
+const (
+	CashMovementDrop    = "drop"
+	CashMovementPaidIn  = "paid_in"
+	CashMovementPaidOut = "paid_out"
+)
+
+const (
+	MovementReasonSale          = "sale"
+	MovementReasonVoid          = "void"
+	MovementReasonPurchaseOrder = "purchase_order"
+	MovementReasonLotReceive    = "lot_receive"
+	MovementReasonLotAdjust     = "lot_adjust"
+	MovementReasonTransferOut   = "transfer_out"
+	MovementReasonTransferIn    = "transfer_in"
+	MovementReasonOpname        = "opname"
+	MovementReasonWriteOff      = "write_off"
+	MovementReasonRestock       = "restock"
+	MovementReasonManualSet     = "manual_set"
+)
+
+const (
+	PickingStrategyFEFO = "fefo"
+	PickingStrategyFIFO = "fifo"
+)
+
+const (
+	SerialStatusAvailable = "available"
+	SerialStatusSold      = "sold"
+)
+
+// DataSnapshotVersion is the format version written by export. Import
+// rejects snapshots of any other version.
+const DataSnapshotVersion = 1
+
+// DataSnapshot is a store's catalog and on-hand inventory, exported for
+// backup or to move between store backends. Lots only carry what is still
+// on hand: QtyReceived equals QtyAvailable and Serials lists the serials not
+// yet sold. User passwords are never included.
+type DataSnapshot struct {
+	Version          int               `json:"version"`
+	ExportedAt       time.Time         `json:"exported_at"`
+	StoreID          string            `json:"store_id"`
+	Products         []Product         `json:"products"`
+	Stock            map[string]int    `json:"stock"`
+	Lots             []InventoryLot    `json:"lots"`
+	Promos           []PromoRule       `json:"promos"`
+	Suppliers        []Supplier        `json:"suppliers"`
+	SupplierProducts []SupplierProduct `json:"supplier_products"`
+	Users            []SnapshotUser    `json:"users"`
+}
+
+type SnapshotUser struct {
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type DataImportRequest struct {
+	ManagerPIN string       `json:"manager_pin"`
+	Snapshot   DataSnapshot `json:"snapshot"`
+}
+
+// DataImportResponse counts what an import created or updated. Users are
+// created with an unusable password and listed in UsersNeedingPassword until
+// an admin sets one.
+type DataImportResponse struct {
+	StoreID              string   `json:"store_id"`
+	Products             int      `json:"products"`
+	Lots                 int      `json:"lots"`
+	StockSKUs            int      `json:"stock_skus"`
+	Promos               int      `json:"promos"`
+	Suppliers            int      `json:"suppliers"`
+	SupplierProducts     int      `json:"supplier_products"`
+	Users                int      `json:"users"`
+	UsersNeedingPassword []string `json:"users_needing_password"`
+}
+
+const (
+	ReportGroupByDay   = "day"
+	ReportGroupByWeek  = "week"
+	ReportGroupByMonth = "month"
+)
@@ -2,34 +2,73 @@ package httpapi
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
 	"sort"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 
 	jwtlib "github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 
 	"kasirinaja/backend/internal/domain"
+	"kasirinaja/backend/internal/jobs"
+	"kasirinaja/backend/internal/store"
 )
 
 type AuthManager struct {
-	mu         sync.RWMutex
-	secret     []byte
-	tokenTTL   time.Duration
-	managerPIN string
-	userStore  UserStore
-	users      map[string]credential
+	mu           sync.RWMutex
+	secret       []byte
+	tokenTTL     time.Duration
+	refreshTTL   time.Duration
+	managerPIN   string
+	userStore    UserStore
+	refreshStore RefreshTokenStore
+	revocations  TokenRevocationStore
+	users        map[string]credential
+	jobs         *jobs.Registry
 }
 
 type UserStore interface {
 	CreateUser(ctx context.Context, user domain.UserAccount) error
 	ListUsers(ctx context.Context) ([]domain.UserAccount, error)
+	GetUser(ctx context.Context, username string) (*domain.UserAccount, error)
 	UpdateUserPassword(ctx context.Context, username string, password string) error
+	UpdateUserActive(ctx context.Context, username string, active bool) error
+	UpdateUserRole(ctx context.Context, username string, role string) error
 }
 
+// RefreshTokenStore persists refresh token hashes. Refresh tokens are only
+// issued when the user store also implements it.
+type RefreshTokenStore interface {
+	CreateRefreshToken(ctx context.Context, token domain.RefreshToken) error
+	ConsumeRefreshToken(ctx context.Context, tokenHash string, at time.Time) (*domain.RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, tokenHash string) error
+	RevokeUserRefreshTokens(ctx context.Context, username string) error
+	PruneRefreshTokens(ctx context.Context, before time.Time) (int, error)
+}
+
+// TokenRevocationStore records the JTIs of access tokens revoked on logout.
+// Revocation is only enforced when the user store also implements it.
+type TokenRevocationStore interface {
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+	PruneRevokedAccessTokens(ctx context.Context, before time.Time) (int, error)
+}
+
+var (
+	errInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	errUserNotFound        = errors.New("user not found")
+	errLastAdmin           = errors.New("cannot remove the last active admin")
+	errWrongPassword       = errors.New("current password is incorrect")
+)
+
 type credential struct {
 	password string
 	role     string
@@ -61,10 +100,17 @@ func NewAuthManager(secret string, tokenTTL time.Duration, managerPIN string, us
 	manager := &AuthManager{
 		secret:     []byte(secret),
 		tokenTTL:   tokenTTL,
+		refreshTTL: 7 * 24 * time.Hour,
 		managerPIN: managerPIN,
 		userStore:  userStore,
 		users:      make(map[string]credential),
 	}
+	if refreshStore, ok := userStore.(RefreshTokenStore); ok {
+		manager.refreshStore = refreshStore
+	}
+	if revocations, ok := userStore.(TokenRevocationStore); ok {
+		manager.revocations = revocations
+	}
 	// context.Background() is appropriate here because this is a startup operation
 	// that runs before any request context exists.
 	manager.bootstrapUsers(context.Background())
@@ -93,20 +139,101 @@ func (a *AuthManager) Login(req domain.LoginRequest) (domain.LoginResponse, erro
 		return domain.LoginResponse{}, errors.New("account is inactive")
 	}
 
+	return a.issueTokens(username, cred.role)
+}
+
+// SetRefreshTokenTTL sets how long a refresh token stays exchangeable.
+func (a *AuthManager) SetRefreshTokenTTL(ttl time.Duration) {
+	if ttl > 0 {
+		a.refreshTTL = ttl
+	}
+}
+
+// SetJobRegistry makes the revocation janitor report its runs to registry.
+func (a *AuthManager) SetJobRegistry(registry *jobs.Registry) {
+	a.jobs = registry
+}
+
+// Refresh exchanges a refresh token for a new access token. The presented
+// refresh token is revoked and replaced by a new one on every use.
+func (a *AuthManager) Refresh(req domain.RefreshTokenRequest) (domain.LoginResponse, error) {
+	if a.refreshStore == nil {
+		return domain.LoginResponse{}, errInvalidRefreshToken
+	}
+	raw := strings.TrimSpace(req.RefreshToken)
+	if raw == "" {
+		return domain.LoginResponse{}, errInvalidRefreshToken
+	}
+
+	// context.Background() matches Login: the AuthManager API carries no
+	// request context.
+	stored, err := a.refreshStore.ConsumeRefreshToken(context.Background(), hashRefreshToken(raw), time.Now().UTC())
+	if err != nil {
+		return domain.LoginResponse{}, errInvalidRefreshToken
+	}
+
+	a.bootstrapUsers(context.Background())
+	a.mu.RLock()
+	cred, ok := a.users[stored.Username]
+	a.mu.RUnlock()
+	if !ok || !cred.active {
+		return domain.LoginResponse{}, errInvalidRefreshToken
+	}
+	return a.issueTokens(stored.Username, cred.role)
+}
+
+// issueTokens signs an access token and, when refresh tokens are persisted,
+// a new opaque refresh token.
+func (a *AuthManager) issueTokens(username string, role string) (domain.LoginResponse, error) {
 	expiresAt := time.Now().UTC().Add(a.tokenTTL)
-	token, err := a.sign(username, cred.role, expiresAt)
+	token, err := a.sign(username, role, expiresAt)
 	if err != nil {
 		return domain.LoginResponse{}, err
 	}
 
-	return domain.LoginResponse{
+	resp := domain.LoginResponse{
 		AccessToken: token,
-		Role:        cred.role,
+		Role:        role,
 		ExpiresAt:   expiresAt.Format(time.RFC3339),
-	}, nil
+	}
+	if a.refreshStore == nil {
+		return resp, nil
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return domain.LoginResponse{}, err
+	}
+	refreshToken := hex.EncodeToString(secret)
+	refreshExpiresAt := time.Now().UTC().Add(a.refreshTTL)
+	if err := a.refreshStore.CreateRefreshToken(context.Background(), domain.RefreshToken{
+		TokenHash: hashRefreshToken(refreshToken),
+		Username:  username,
+		ExpiresAt: refreshExpiresAt,
+		CreatedAt: time.Now().UTC(),
+	}); err != nil {
+		return domain.LoginResponse{}, err
+	}
+	resp.RefreshToken = refreshToken
+	resp.RefreshExpiresAt = refreshExpiresAt.Format(time.RFC3339)
+	return resp, nil
 }
 
 func (a *AuthManager) ParseToken(tokenStr string) (domain.Actor, error) {
+	claims, err := a.parseClaims(tokenStr)
+	if err != nil {
+		return domain.Actor{}, err
+	}
+	if a.revocations != nil && claims.ID != "" {
+		revoked, err := a.revocations.IsAccessTokenRevoked(context.Background(), claims.ID)
+		if err != nil || revoked {
+			return domain.Actor{}, errors.New("token has been revoked")
+		}
+	}
+	return domain.Actor{Username: claims.Subject, Role: claims.Role}, nil
+}
+
+func (a *AuthManager) parseClaims(tokenStr string) (*posCustomClaims, error) {
 	claims := &posCustomClaims{}
 	token, err := jwtlib.ParseWithClaims(tokenStr, claims, func(t *jwtlib.Token) (interface{}, error) {
 		if _, ok := t.Method.(*jwtlib.SigningMethodHMAC); !ok {
@@ -115,18 +242,100 @@ func (a *AuthManager) ParseToken(tokenStr string) (domain.Actor, error) {
 		return a.secret, nil
 	}, jwtlib.WithValidMethods([]string{"HS256"}))
 	if err != nil || !token.Valid {
-		return domain.Actor{}, errors.New("invalid or expired token")
+		return nil, errors.New("invalid or expired token")
 	}
 	sub, err := claims.GetSubject()
 	if err != nil || sub == "" {
-		return domain.Actor{}, errors.New("invalid token subject")
+		return nil, errors.New("invalid token subject")
+	}
+	return claims, nil
+}
+
+// Logout revokes the access token's JTI until it expires, and the refresh
+// token too when one is given.
+func (a *AuthManager) Logout(ctx context.Context, tokenStr string, refreshToken string) error {
+	if a.revocations == nil {
+		return errors.New("token revocation is not available")
+	}
+	claims, err := a.parseClaims(tokenStr)
+	if err != nil {
+		return err
+	}
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return errors.New("token cannot be revoked")
+	}
+	if err := a.revocations.RevokeAccessToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return err
 	}
-	return domain.Actor{Username: sub, Role: claims.Role}, nil
+
+	refreshToken = strings.TrimSpace(refreshToken)
+	if refreshToken != "" && a.refreshStore != nil {
+		if err := a.refreshStore.RevokeRefreshToken(ctx, hashRefreshToken(refreshToken)); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunRevocationJanitor prunes revocations of already expired tokens, and
+// refresh tokens that expired or were revoked, every interval until ctx is
+// cancelled.
+func (a *AuthManager) RunRevocationJanitor(ctx context.Context, interval time.Duration) {
+	if (a.revocations == nil && a.refreshStore == nil) || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	a.jobs.Scheduled(jobs.RevocationJanitor, time.Now().Add(interval))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			pruned, err := a.pruneTokens(ctx, now.UTC())
+			a.jobs.Ran(jobs.RevocationJanitor, time.Now(), err)
+			a.jobs.Scheduled(jobs.RevocationJanitor, now.Add(interval))
+			if err != nil {
+				log.Printf("[auth] prune revoked tokens: %v", err)
+				continue
+			}
+			if pruned > 0 {
+				log.Printf("[auth] pruned %d expired token revocations and refresh tokens", pruned)
+			}
+		}
+	}
+}
+
+// pruneTokens drops revocations of expired access tokens and refresh tokens
+// that can no longer be exchanged, and reports how many were removed.
+func (a *AuthManager) pruneTokens(ctx context.Context, now time.Time) (int, error) {
+	pruned := 0
+	if a.revocations != nil {
+		count, err := a.revocations.PruneRevokedAccessTokens(ctx, now)
+		if err != nil {
+			return pruned, err
+		}
+		pruned += count
+	}
+	if a.refreshStore != nil {
+		count, err := a.refreshStore.PruneRefreshTokens(ctx, now)
+		if err != nil {
+			return pruned, err
+		}
+		pruned += count
+	}
+	return pruned, nil
 }
 
 func (a *AuthManager) sign(username, role string, expiresAt time.Time) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
 	claims := posCustomClaims{
 		RegisteredClaims: jwtlib.RegisteredClaims{
+			ID:        hex.EncodeToString(jti),
 			Subject:   username,
 			IssuedAt:  jwtlib.NewNumericDate(time.Now().UTC()),
 			ExpiresAt: jwtlib.NewNumericDate(expiresAt),
@@ -152,20 +361,20 @@ func (a *AuthManager) CreateCashier(req domain.CashierCreateRequest) (domain.Cas
 	a.bootstrapUsers(context.Background())
 	username := strings.ToLower(strings.TrimSpace(req.Username))
 	if username == "" || len(username) < 4 {
-		return domain.CashierUser{}, fmt.Errorf("username must be at least 4 characters")
+		return domain.CashierUser{}, fmt.Errorf("%w: username must be at least 4 characters", store.ErrInvalidInput)
 	}
 	if strings.ContainsAny(username, " \t\r\n") {
-		return domain.CashierUser{}, fmt.Errorf("username must not contain spaces")
+		return domain.CashierUser{}, fmt.Errorf("%w: username must not contain spaces", store.ErrInvalidInput)
 	}
 	if strings.TrimSpace(req.Password) == "" || len(req.Password) < 6 {
-		return domain.CashierUser{}, fmt.Errorf("password must be at least 6 characters")
+		return domain.CashierUser{}, fmt.Errorf("%w: password must be at least 6 characters", store.ErrInvalidInput)
 	}
 
 	a.mu.RLock()
 	_, exists := a.users[username]
 	a.mu.RUnlock()
 	if exists {
-		return domain.CashierUser{}, fmt.Errorf("username already exists")
+		return domain.CashierUser{}, fmt.Errorf("%w: username already exists", store.ErrDuplicateID)
 	}
 
 	now := time.Now().UTC()
@@ -228,6 +437,193 @@ func (a *AuthManager) ListCashiers() []domain.CashierUser {
 	return result
 }
 
+// SetUserActive enables or disables a user's login. Disabling the last
+// active admin is rejected.
+func (a *AuthManager) SetUserActive(ctx context.Context, username string, active bool) (domain.CashierUser, error) {
+	return a.updateUser(ctx, username, func(cred *credential) error {
+		if !active && cred.role == "admin" && cred.active && a.activeAdminsLocked() <= 1 {
+			return errLastAdmin
+		}
+		if a.userStore != nil {
+			if err := a.userStore.UpdateUserActive(ctx, strings.ToLower(strings.TrimSpace(username)), active); err != nil {
+				return err
+			}
+		}
+		cred.active = active
+		return nil
+	})
+}
+
+// SetUserRole changes a user's role to admin or cashier. Demoting the last
+// active admin is rejected.
+func (a *AuthManager) SetUserRole(ctx context.Context, username string, role string) (domain.CashierUser, error) {
+	role = strings.ToLower(strings.TrimSpace(role))
+	if role != "admin" && role != "cashier" {
+		return domain.CashierUser{}, fmt.Errorf("%w: role must be admin or cashier", store.ErrInvalidInput)
+	}
+	return a.updateUser(ctx, username, func(cred *credential) error {
+		if role != "admin" && cred.role == "admin" && cred.active && a.activeAdminsLocked() <= 1 {
+			return errLastAdmin
+		}
+		if a.userStore != nil {
+			if err := a.userStore.UpdateUserRole(ctx, strings.ToLower(strings.TrimSpace(username)), role); err != nil {
+				return err
+			}
+		}
+		cred.role = role
+		return nil
+	})
+}
+
+// ChangePassword rotates a user's own password after checking the current
+// one.
+func (a *AuthManager) ChangePassword(ctx context.Context, username string, currentPassword string, newPassword string) error {
+	a.bootstrapUsers(ctx)
+	a.mu.RLock()
+	cred, ok := a.users[username]
+	a.mu.RUnlock()
+	if !ok || !verifyPassword(cred.password, currentPassword) {
+		return errWrongPassword
+	}
+	return a.setPassword(ctx, username, newPassword)
+}
+
+// ResetPassword sets a new password for any user, for admins helping a
+// cashier who forgot theirs.
+func (a *AuthManager) ResetPassword(ctx context.Context, username string, newPassword string) error {
+	a.bootstrapUsers(ctx)
+	username = strings.ToLower(strings.TrimSpace(username))
+	a.mu.RLock()
+	_, ok := a.users[username]
+	a.mu.RUnlock()
+	if !ok {
+		return errUserNotFound
+	}
+	return a.setPassword(ctx, username, newPassword)
+}
+
+// setPassword stores a new password hash and revokes the user's refresh
+// tokens, so sessions started with the old password cannot be extended.
+// bcrypt runs outside a.mu; the lock is only held to swap the cached hash.
+func (a *AuthManager) setPassword(ctx context.Context, username string, newPassword string) error {
+	if err := validatePasswordStrength(newPassword); err != nil {
+		return err
+	}
+
+	a.mu.RLock()
+	cred, ok := a.users[username]
+	a.mu.RUnlock()
+	if !ok {
+		return errUserNotFound
+	}
+	if verifyPassword(cred.password, newPassword) {
+		return fmt.Errorf("%w: new password must differ from the current one", store.ErrInvalidInput)
+	}
+	passwordHash, err := hashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password")
+	}
+	if a.userStore != nil {
+		if err := a.userStore.UpdateUserPassword(ctx, username, passwordHash); err != nil {
+			return err
+		}
+	}
+	if a.refreshStore != nil {
+		if err := a.refreshStore.RevokeUserRefreshTokens(ctx, username); err != nil {
+			return err
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cred, ok = a.users[username]
+	if !ok {
+		return errUserNotFound
+	}
+	cred.password = passwordHash
+	a.users[username] = cred
+	return nil
+}
+
+// validatePasswordStrength requires at least 8 characters mixing letters and
+// digits.
+func validatePasswordStrength(password string) error {
+	if len(password) < 8 {
+		return fmt.Errorf("%w: password must be at least 8 characters", store.ErrInvalidInput)
+	}
+	hasLetter, hasDigit := false, false
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return fmt.Errorf("%w: password must contain both letters and digits", store.ErrInvalidInput)
+	}
+	return nil
+}
+
+// CurrentActor reads the user's stored status so revoked access takes effect
+// before the token expires. Inactive or unknown users are rejected. Only the
+// requesting user's row is read; the cache answers when the store cannot.
+func (a *AuthManager) CurrentActor(ctx context.Context, username string) (domain.Actor, error) {
+	if a.userStore != nil {
+		user, err := a.userStore.GetUser(ctx, username)
+		if errors.Is(err, store.ErrNotFound) || (err == nil && !user.Active) {
+			return domain.Actor{}, errors.New("account is inactive")
+		}
+		if err == nil {
+			return domain.Actor{Username: username, Role: user.Role}, nil
+		}
+	}
+	a.mu.RLock()
+	cred, ok := a.users[username]
+	a.mu.RUnlock()
+	if !ok || !cred.active {
+		return domain.Actor{}, errors.New("account is inactive")
+	}
+	return domain.Actor{Username: username, Role: cred.role}, nil
+}
+
+// updateUser applies change to a user's credential while holding the lock,
+// so the last-admin checks cannot race each other.
+func (a *AuthManager) updateUser(ctx context.Context, username string, change func(cred *credential) error) (domain.CashierUser, error) {
+	a.bootstrapUsers(ctx)
+	username = strings.ToLower(strings.TrimSpace(username))
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cred, ok := a.users[username]
+	if !ok {
+		return domain.CashierUser{}, errUserNotFound
+	}
+	if err := change(&cred); err != nil {
+		return domain.CashierUser{}, err
+	}
+	a.users[username] = cred
+
+	return domain.CashierUser{
+		Username:  username,
+		Role:      cred.role,
+		Active:    cred.active,
+		CreatedAt: cred.created,
+	}, nil
+}
+
+// activeAdminsLocked counts active admins. The caller must hold a.mu.
+func (a *AuthManager) activeAdminsLocked() int {
+	count := 0
+	for _, cred := range a.users {
+		if cred.role == "admin" && cred.active {
+			count++
+		}
+	}
+	return count
+}
+
 // bootstrapUsers loads user accounts from the user store into the in-memory
 // credential cache. It also upgrades any legacy plain-text passwords to bcrypt
 // hashes in the store. The provided ctx is passed through to all store calls.
@@ -266,6 +662,17 @@ func (a *AuthManager) bootstrapUsers(ctx context.Context) {
 	}
 }
 
+// ReloadUsers reloads the credential cache from the user store, picking up
+// accounts written to the store directly, such as by a data import.
+func (a *AuthManager) ReloadUsers(ctx context.Context) {
+	a.bootstrapUsers(ctx)
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func verifyPassword(stored string, input string) bool {
 	if stored == "" || strings.TrimSpace(input) == "" || !isPasswordHash(stored) {
 		return false
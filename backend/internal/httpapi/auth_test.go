@@ -8,12 +8,15 @@ import (
 	"time"
 
 	"kasirinaja/backend/internal/domain"
+	"kasirinaja/backend/internal/store"
 )
 
 type userStoreStub struct {
 	mu      sync.Mutex
 	users   map[string]domain.UserAccount
 	updates int
+	lists   int
+	lookups int
 }
 
 func (s *userStoreStub) CreateUser(_ context.Context, user domain.UserAccount) error {
@@ -29,6 +32,7 @@ func (s *userStoreStub) CreateUser(_ context.Context, user domain.UserAccount) e
 func (s *userStoreStub) ListUsers(_ context.Context) ([]domain.UserAccount, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.lists++
 	out := make([]domain.UserAccount, 0, len(s.users))
 	for _, user := range s.users {
 		out = append(out, user)
@@ -36,6 +40,17 @@ func (s *userStoreStub) ListUsers(_ context.Context) ([]domain.UserAccount, erro
 	return out, nil
 }
 
+func (s *userStoreStub) GetUser(_ context.Context, username string) (*domain.UserAccount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lookups++
+	user, ok := s.users[username]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &user, nil
+}
+
 func (s *userStoreStub) UpdateUserPassword(_ context.Context, username string, password string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -46,6 +61,24 @@ func (s *userStoreStub) UpdateUserPassword(_ context.Context, username string, p
 	return nil
 }
 
+func (s *userStoreStub) UpdateUserActive(_ context.Context, username string, active bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.users[username]
+	user.Active = active
+	s.users[username] = user
+	return nil
+}
+
+func (s *userStoreStub) UpdateUserRole(_ context.Context, username string, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.users[username]
+	user.Role = role
+	s.users[username] = user
+	return nil
+}
+
 func TestAuthManagerUpgradesLegacyPlainPassword(t *testing.T) {
 	store := &userStoreStub{
 		users: map[string]domain.UserAccount{
@@ -154,3 +187,29 @@ func TestManagerPINIsHashedAndStillValidates(t *testing.T) {
 		t.Fatalf("expected wrong manager pin to fail")
 	}
 }
+
+func TestCurrentActorReadsOnlyTheRequestingUser(t *testing.T) {
+	users := &userStoreStub{
+		users: map[string]domain.UserAccount{
+			"kasir1": {Username: "kasir1", Password: "kasir123", Role: "cashier", Active: true, CreatedAt: time.Now().UTC()},
+		},
+	}
+	manager := NewAuthManager("test-secret", time.Hour, "123456", users)
+	lists := users.lists
+
+	actor, err := manager.CurrentActor(context.Background(), "kasir1")
+	if err != nil || actor.Role != "cashier" {
+		t.Fatalf("expected active cashier, got %+v, %v", actor, err)
+	}
+	if users.lists != lists || users.lookups != 1 {
+		t.Fatalf("expected one single-user lookup and no list, got lists=%d lookups=%d", users.lists-lists, users.lookups)
+	}
+
+	_ = users.UpdateUserActive(context.Background(), "kasir1", false)
+	if _, err := manager.CurrentActor(context.Background(), "kasir1"); err == nil {
+		t.Fatalf("expected deactivated user to be rejected")
+	}
+	if _, err := manager.CurrentActor(context.Background(), "ghost"); err == nil {
+		t.Fatalf("expected unknown user to be rejected")
+	}
+}
@@ -0,0 +1,183 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+
+	"kasirinaja/backend/internal/i18n"
+	"kasirinaja/backend/internal/reporting"
+	"kasirinaja/backend/internal/service"
+	"kasirinaja/backend/internal/store"
+)
+
+var (
+	errForbiddenRole     = errors.New("forbidden role")
+	errInvalidManagerPIN = errors.New("invalid manager pin")
+	errInvalidCSRFToken  = errors.New("missing or invalid CSRF token")
+	errIdempotencyReplay = errors.New("idempotency key already used by a recorded checkout")
+)
+
+// errorCodes gives the stable "code" of error responses for known errors.
+// Clients branch on codes instead of messages, so a code must not change once
+// published. Errors that wrap another sentinel, such as store.ErrDuplicateID
+// wrapping store.ErrInvalidTransaction, come before the one they wrap.
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{store.ErrServiceReadOnly, "service_read_only"},
+	{store.ErrInsufficientStock, "insufficient_stock"},
+	{store.ErrInsufficientStoreCredit, "insufficient_store_credit"},
+	{store.ErrDuplicateID, "duplicate_id"},
+	{store.ErrDuplicatePromoName, "duplicate_promo_name"},
+	{store.ErrProductUnavailable, "product_unavailable"},
+	{store.ErrProductOutOfSeason, "product_out_of_season"},
+	{store.ErrEmptyCart, "empty_cart"},
+	{store.ErrInvalidDiscount, "invalid_discount"},
+	{store.ErrInvalidTaxRate, "invalid_tax_rate"},
+	{store.ErrUnsupportedPaymentMethod, "unsupported_payment_method"},
+	{store.ErrInsufficientPayment, "insufficient_payment"},
+	{store.ErrInvalidSplitPayment, "invalid_split_payment"},
+	{store.ErrInvalidSerials, "invalid_serials"},
+	{service.ErrInvalidPaymentReference, "invalid_payment_reference"},
+	{service.ErrDuplicatePaymentReference, "duplicate_payment_reference"},
+	{service.ErrPaymentMethodNotEnabled, "payment_method_not_enabled"},
+	{store.ErrShiftAlreadyOpen, "shift_already_open"},
+	{store.ErrShiftClosed, "shift_closed"},
+	{service.ErrNoActiveShift, "no_active_shift"},
+	{service.ErrRefundWindowExpired, "refund_window_expired"},
+	{service.ErrStoreIDRequired, "store_id_required"},
+	{service.ErrDailyCapExceeded, "daily_cap_exceeded"},
+	{service.ErrTerminalNotRegistered, "terminal_not_registered"},
+	{service.ErrShiftNotOwned, "shift_not_owned"},
+	{service.ErrHeldCartsPending, "held_carts_pending"},
+	{service.ErrNoKitchenItems, "no_kitchen_items"},
+	{reporting.ErrNoRecipients, "no_report_recipients"},
+	{errForbiddenRole, "forbidden_role"},
+	{service.ErrAdminRequired, "forbidden_role"},
+	{errInvalidManagerPIN, "invalid_manager_pin"},
+	{errInvalidCSRFToken, "invalid_csrf_token"},
+	{errIdempotencyReplay, "idempotency_replay"},
+	{store.ErrNotFound, "not_found"},
+	{store.ErrInvalidTransaction, "invalid_transaction"},
+}
+
+// errorPayload is the JSON body of an error response: the error text, kept
+// in English for compatibility, its code and the code's message in the
+// request's language when the catalog has one.
+func errorPayload(w http.ResponseWriter, status int, err error) map[string]any {
+	code := errorCode(status, err)
+	payload := map[string]any{
+		"error": err.Error(),
+		"code":  code,
+	}
+	if message := localizerFor(w).Message("error." + code); message != "" {
+		payload["message"] = message
+	}
+	return payload
+}
+
+// localizedWriter carries the language negotiated for a request down to
+// writeError, which is only handed the ResponseWriter. It also carries the
+// matched route's Allow list for writeMethodNotAllowed.
+type localizedWriter struct {
+	http.ResponseWriter
+	localizer i18n.Localizer
+	allow     string
+}
+
+// localizerFor returns the request language wrapped into w by the
+// middleware, or the default language outside it.
+func localizerFor(w http.ResponseWriter) i18n.Localizer {
+	if localized, ok := w.(*localizedWriter); ok {
+		return localized.localizer
+	}
+	return i18n.Default(i18n.DefaultLanguage)
+}
+
+// statusForError returns the HTTP status for an error from the service or
+// auth layer, so every handler answers the same error with the same status:
+// missing records are 404, missing privileges 403, conflicts with the
+// current state 409, other business-rule errors and invalid settings or
+// account input 400. Anything unrecognised, such as a database failure, is a
+// 500 whose message writeError hides. Conflicts that wrap
+// store.ErrInvalidTransaction are checked before it.
+func statusForError(err error) int {
+	switch {
+	case errors.Is(err, store.ErrServiceReadOnly):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, store.ErrNotFound), errors.Is(err, errUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errWrongPassword):
+		return http.StatusUnauthorized
+	case errors.Is(err, errForbiddenRole),
+		errors.Is(err, errInvalidManagerPIN),
+		errors.Is(err, errInvalidCSRFToken),
+		errors.Is(err, service.ErrShiftNotOwned),
+		errors.Is(err, service.ErrTerminalNotRegistered),
+		errors.Is(err, service.ErrDailyCapExceeded),
+		errors.Is(err, service.ErrAdminRequired):
+		return http.StatusForbidden
+	case errors.Is(err, store.ErrInsufficientStock),
+		errors.Is(err, store.ErrInsufficientStoreCredit),
+		errors.Is(err, store.ErrDuplicateID),
+		errors.Is(err, store.ErrDuplicatePromoName),
+		errors.Is(err, store.ErrShiftAlreadyOpen),
+		errors.Is(err, store.ErrShiftClosed),
+		errors.Is(err, store.ErrInvalidState),
+		errors.Is(err, service.ErrDuplicatePaymentReference),
+		errors.Is(err, service.ErrNoActiveShift),
+		errors.Is(err, service.ErrHeldCartsPending),
+		errors.Is(err, errLastAdmin),
+		errors.Is(err, errIdempotencyReplay):
+		return http.StatusConflict
+	case errors.Is(err, store.ErrInvalidTransaction),
+		errors.Is(err, store.ErrInvalidInput):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrNoKitchenItems),
+		errors.Is(err, reporting.ErrNoRecipients):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// errorCode returns the code for err, falling back to one derived from the
+// response status for errors without a sentinel.
+func errorCode(status int, err error) string {
+	for _, entry := range errorCodes {
+		if errors.Is(err, entry.err) {
+			return entry.code
+		}
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return "request_too_large"
+	}
+
+	switch status {
+	case http.StatusBadRequest:
+		return "bad_request"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusMethodNotAllowed:
+		return "method_not_allowed"
+	case http.StatusConflict:
+		return "conflict"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusUnprocessableEntity:
+		return "unprocessable"
+	case http.StatusTooManyRequests:
+		return "rate_limited"
+	case http.StatusServiceUnavailable:
+		return "service_unavailable"
+	}
+	if status >= 500 {
+		return "internal_error"
+	}
+	return "error"
+}
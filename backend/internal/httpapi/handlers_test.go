@@ -1,18 +1,27 @@
 package httpapi
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
 	"kasirinaja/backend/internal/domain"
+	"kasirinaja/backend/internal/jobs"
 	"kasirinaja/backend/internal/recommendation"
+	"kasirinaja/backend/internal/reporting"
 	"kasirinaja/backend/internal/service"
+	"kasirinaja/backend/internal/store"
 	"kasirinaja/backend/internal/store/memory"
 )
 
@@ -26,7 +35,9 @@ func newTestAPI(t *testing.T) *API {
 	svc := service.New(repo, engine, "test-store")
 	auth := NewAuthManager("test-secret-key", time.Hour, "123456", repo)
 
-	return New(svc, auth, "*")
+	api := New(svc, auth, "*")
+	t.Cleanup(api.Stop)
+	return api
 }
 
 // mustHashPassword generates a bcrypt hash of the given password or fails the test.
@@ -61,6 +72,178 @@ func TestHandleHealth(t *testing.T) {
 	}
 }
 
+func TestHandleReady_ReportsFailedDependencies(t *testing.T) {
+	api := newTestAPI(t)
+
+	ready := httptest.NewRecorder()
+	api.Handler().ServeHTTP(ready, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if ready.Code != http.StatusOK {
+		t.Fatalf("expected 200 with a reachable repository, got %d (body: %s)", ready.Code, ready.Body.String())
+	}
+
+	api.AddReadinessCheck("cache", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	rec := httptest.NewRecorder()
+	api.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 when the cache hangs, got %d", rec.Code)
+	}
+	var body struct {
+		OK     bool              `json:"ok"`
+		Checks map[string]string `json:"checks"`
+		Failed []string          `json:"failed"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if body.OK || len(body.Failed) != 1 || body.Failed[0] != "cache" || body.Checks["repository"] != "ok" {
+		t.Fatalf("expected only the cache to be reported as failed, got %+v", body)
+	}
+}
+
+func TestHandleReady_ReportsStorageMode(t *testing.T) {
+	api := newTestAPI(t)
+	api.SetStorageMode(func() string { return "read_only" })
+
+	rec := httptest.NewRecorder()
+	api.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var body struct {
+		Mode string `json:"mode"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if body.Mode != "read_only" {
+		t.Fatalf("expected mode read_only, got %q", body.Mode)
+	}
+}
+
+func TestWriteError_ReadOnlyIsRetryable503(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeError(rec, http.StatusUnprocessableEntity, fmt.Errorf("checkout: %w", store.ErrServiceReadOnly))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 503 with Retry-After, got %d %v", rec.Code, rec.Header())
+	}
+	if !strings.Contains(rec.Body.String(), "read-only") {
+		t.Fatalf("expected the read-only message to be kept, got %s", rec.Body.String())
+	}
+}
+
+func TestWriteError_IncludesStableCode(t *testing.T) {
+	cases := []struct {
+		status int
+		err    error
+		code   string
+	}{
+		{http.StatusConflict, fmt.Errorf("SKU-1: %w", store.ErrInsufficientStock), "insufficient_stock"},
+		{http.StatusBadRequest, store.ErrDuplicateID, "duplicate_id"},
+		{http.StatusBadRequest, fmt.Errorf("%w: empty cart", store.ErrInvalidTransaction), "invalid_transaction"},
+		{http.StatusBadRequest, store.ErrInvalidDiscount, "invalid_discount"},
+		{http.StatusBadRequest, fmt.Errorf("%w %q", store.ErrUnsupportedPaymentMethod, "bitcoin"), "unsupported_payment_method"},
+		{http.StatusNotFound, store.ErrNotFound, "not_found"},
+		{http.StatusForbidden, errForbiddenRole, "forbidden_role"},
+		{http.StatusForbidden, service.ErrAdminRequired, "forbidden_role"},
+		{http.StatusTooManyRequests, errors.New("too many login attempts"), "rate_limited"},
+		{http.StatusInternalServerError, errors.New("pq: connection reset"), "internal_error"},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		writeError(rec, tc.status, tc.err)
+		var body map[string]string
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("decode %v: %v", tc.err, err)
+		}
+		if rec.Code != tc.status || body["code"] != tc.code || body["error"] == "" {
+			t.Fatalf("%v: expected %d %q, got %d %v", tc.err, tc.status, tc.code, rec.Code, body)
+		}
+		if tc.status >= 500 && body["error"] != "internal server error" {
+			t.Fatalf("%v: expected a generic message, got %q", tc.err, body["error"])
+		}
+	}
+}
+
+func TestStatusForError(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+	}{
+		{store.ErrInvalidTransaction, http.StatusBadRequest},
+		{store.ErrEmptyCart, http.StatusBadRequest},
+		{store.ErrInvalidDiscount, http.StatusBadRequest},
+		{store.ErrInvalidTaxRate, http.StatusBadRequest},
+		{store.ErrUnsupportedPaymentMethod, http.StatusBadRequest},
+		{store.ErrInsufficientPayment, http.StatusBadRequest},
+		{store.ErrInvalidSplitPayment, http.StatusBadRequest},
+		{store.ErrInvalidSerials, http.StatusBadRequest},
+		{store.ErrProductUnavailable, http.StatusBadRequest},
+		{store.ErrProductOutOfSeason, http.StatusBadRequest},
+		{service.ErrInvalidPaymentReference, http.StatusBadRequest},
+		{service.ErrPaymentMethodNotEnabled, http.StatusBadRequest},
+		{service.ErrRefundWindowExpired, http.StatusBadRequest},
+		{service.ErrStoreIDRequired, http.StatusBadRequest},
+		{store.ErrNotFound, http.StatusNotFound},
+		{errUserNotFound, http.StatusNotFound},
+		{errWrongPassword, http.StatusUnauthorized},
+		{errForbiddenRole, http.StatusForbidden},
+		{errInvalidManagerPIN, http.StatusForbidden},
+		{errInvalidCSRFToken, http.StatusForbidden},
+		{service.ErrShiftNotOwned, http.StatusForbidden},
+		{service.ErrTerminalNotRegistered, http.StatusForbidden},
+		{service.ErrDailyCapExceeded, http.StatusForbidden},
+		{service.ErrAdminRequired, http.StatusForbidden},
+		{fmt.Errorf("%w for manual override", service.ErrAdminRequired), http.StatusForbidden},
+		{store.ErrInsufficientStock, http.StatusConflict},
+		{store.ErrInsufficientStoreCredit, http.StatusConflict},
+		{store.ErrDuplicateID, http.StatusConflict},
+		{store.ErrDuplicatePromoName, http.StatusConflict},
+		{store.ErrShiftAlreadyOpen, http.StatusConflict},
+		{store.ErrShiftClosed, http.StatusConflict},
+		{store.ErrInvalidState, http.StatusConflict},
+		{service.ErrDuplicatePaymentReference, http.StatusConflict},
+		{service.ErrNoActiveShift, http.StatusConflict},
+		{service.ErrHeldCartsPending, http.StatusConflict},
+		{errLastAdmin, http.StatusConflict},
+		{errIdempotencyReplay, http.StatusConflict},
+		{store.ErrServiceReadOnly, http.StatusServiceUnavailable},
+		{fmt.Errorf("%w: password must contain a digit", store.ErrInvalidInput), http.StatusBadRequest},
+		{fmt.Errorf("%w: username already exists", store.ErrDuplicateID), http.StatusConflict},
+		{service.ErrNoKitchenItems, http.StatusUnprocessableEntity},
+		{reporting.ErrNoRecipients, http.StatusUnprocessableEntity},
+		{errors.New("pq: connection reset"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		if got := statusForError(fmt.Errorf("wrapped: %w", tc.err)); got != tc.status {
+			t.Errorf("%v: expected %d, got %d", tc.err, tc.status, got)
+		}
+	}
+}
+
+func TestErrorMessageFollowsAcceptLanguage(t *testing.T) {
+	api := newTestAPI(t)
+	for header, want := range map[string]string{
+		"":               "Silakan login kembali.",
+		"en-US,en;q=0.9": "Please log in again.",
+		"fr, id;q=0.5":   "Silakan login kembali.",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/products", nil)
+		if header != "" {
+			req.Header.Set("Accept-Language", header)
+		}
+		rec := httptest.NewRecorder()
+		api.Handler().ServeHTTP(rec, req)
+
+		var body map[string]string
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if rec.Code != http.StatusUnauthorized || body["code"] != "unauthorized" || body["message"] != want || body["error"] != "missing bearer token" {
+			t.Fatalf("Accept-Language %q: unexpected response %d %v", header, rec.Code, body)
+		}
+	}
+}
+
 func TestHandleLogin_Success(t *testing.T) {
 	api := newTestAPI(t)
 	handler := api.Handler()
@@ -198,3 +381,692 @@ func TestMustHashPassword(t *testing.T) {
 		t.Fatalf("hash verification failed: %v", err)
 	}
 }
+
+func TestHandleShiftOpen_AlreadyOpenReturnsConflict(t *testing.T) {
+	api := newTestAPI(t)
+	handler := api.Handler()
+	token := loginAsAdmin(t, api)
+	csrf := fetchCSRFToken(t, api, token)
+
+	openShift := func() *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(domain.ShiftOpenRequest{
+			TerminalID:        "terminal-a1",
+			CashierName:       "Kasir A",
+			OpeningFloatCents: 100000,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/shifts/open", bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("X-CSRF-Token", csrf)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := openShift()
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected first open to succeed, got %d (body: %s)", first.Code, first.Body.String())
+	}
+	var opened domain.ShiftResponse
+	if err := json.NewDecoder(first.Body).Decode(&opened); err != nil {
+		t.Fatalf("decode shift response: %v", err)
+	}
+
+	second := openShift()
+	if second.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d (body: %s)", second.Code, second.Body.String())
+	}
+	var body map[string]any
+	if err := json.NewDecoder(second.Body).Decode(&body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if body["error"] != "shift already open on this terminal" {
+		t.Fatalf("unexpected error message: %v", body["error"])
+	}
+	if body["shift_id"] != opened.Shift.ID {
+		t.Fatalf("expected shift_id %q, got %v", opened.Shift.ID, body["shift_id"])
+	}
+}
+
+func TestHandleDailyReport_XLSXExport(t *testing.T) {
+	api := newTestAPI(t)
+	token := loginAsAdmin(t, api)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/reports/daily?store_id=main-store&date=2026-01-15&format=xlsx", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	api.Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet" {
+		t.Fatalf("unexpected content type %q", got)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="daily-report-2026-01-15.xlsx"` {
+		t.Fatalf("unexpected content disposition %q", got)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("response is not a zip package: %v", err)
+	}
+	parts := make(map[string]string)
+	for _, file := range archive.File {
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", file.Name, err)
+		}
+		var buf bytes.Buffer
+		_, _ = buf.ReadFrom(rc)
+		_ = rc.Close()
+		parts[file.Name] = buf.String()
+	}
+	for _, name := range []string{"xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml", "xl/worksheets/sheet3.xml", "xl/styles.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Fatalf("expected workbook part %s", name)
+		}
+	}
+	for _, sheet := range []string{"Summary", "By Payment", "By Terminal"} {
+		if !strings.Contains(parts["xl/workbook.xml"], `name="`+sheet+`"`) {
+			t.Fatalf("expected sheet %q in workbook", sheet)
+		}
+	}
+	if !strings.Contains(parts["xl/styles.xml"], "IDR") {
+		t.Fatalf("expected currency number format in styles")
+	}
+}
+
+func TestHandleAuditLogs_CSVExport(t *testing.T) {
+	api := newTestAPI(t)
+	token := loginAsAdmin(t, api)
+
+	ctx := service.WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	price := int64(18000)
+	if _, err := api.service.UpdateProduct(ctx, "SKU-ROTI-01", domain.ProductUpdateRequest{PriceCents: &price}); err != nil {
+		t.Fatalf("update product failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/audit-logs?store_id=test-store&format=csv", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	api.Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+		t.Fatalf("unexpected content type %q", got)
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("response is not valid CSV: %v", err)
+	}
+	if len(rows) < 2 || rows[0][4] != "actor_role" {
+		t.Fatalf("expected a header with actor_role and at least one entry, got %v", rows)
+	}
+	if rows[1][4] != "admin" || !strings.Contains(rows[1][8], "price=18000,") {
+		t.Fatalf("expected the actor role and the comma-separated detail intact, got %v", rows[1])
+	}
+}
+
+func TestHandleRefresh_RotatesRefreshToken(t *testing.T) {
+	api := newTestAPI(t)
+
+	login, err := api.auth.Login(domain.LoginRequest{Username: "admin", Password: "admin123"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if login.RefreshToken == "" {
+		t.Fatalf("expected a refresh token on login")
+	}
+
+	refresh := func(token string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(domain.RefreshTokenRequest{RefreshToken: token})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		api.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := refresh(login.RefreshToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", rec.Code, rec.Body.String())
+	}
+	var rotated domain.LoginResponse
+	if err := json.NewDecoder(rec.Body).Decode(&rotated); err != nil {
+		t.Fatalf("decode refresh response: %v", err)
+	}
+	if rotated.RefreshToken == "" || rotated.RefreshToken == login.RefreshToken {
+		t.Fatalf("expected a new refresh token, got %q", rotated.RefreshToken)
+	}
+	actor, err := api.auth.ParseToken(rotated.AccessToken)
+	if err != nil || actor.Username != "admin" || actor.Role != "admin" {
+		t.Fatalf("expected a valid admin access token, got %+v (err: %v)", actor, err)
+	}
+
+	if rec := refresh(login.RefreshToken); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the used refresh token to be rejected, got %d", rec.Code)
+	}
+	if rec := refresh(rotated.RefreshToken); rec.Code != http.StatusOK {
+		t.Fatalf("expected the rotated refresh token to work, got %d", rec.Code)
+	}
+}
+
+func TestHandleLogout_RevokesAccessAndRefreshTokens(t *testing.T) {
+	api := newTestAPI(t)
+	handler := api.Handler()
+
+	login, err := api.auth.Login(domain.LoginRequest{Username: "admin", Password: "admin123"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	other := loginAsAdmin(t, api)
+	csrf := fetchCSRFToken(t, api, login.AccessToken)
+
+	body, _ := json.Marshal(domain.LogoutRequest{RefreshToken: login.RefreshToken})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/logout", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+login.AccessToken)
+	req.Header.Set("X-CSRF-Token", csrf)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (body: %s)", rec.Code, rec.Body.String())
+	}
+
+	if _, err := api.auth.ParseToken(login.AccessToken); err == nil {
+		t.Fatalf("expected the logged out access token to be rejected")
+	}
+	if _, err := api.auth.Refresh(domain.RefreshTokenRequest{RefreshToken: login.RefreshToken}); err == nil {
+		t.Fatalf("expected the logged out refresh token to be rejected")
+	}
+	if _, err := api.auth.ParseToken(other); err != nil {
+		t.Fatalf("expected other sessions to stay valid, got %v", err)
+	}
+}
+
+func TestHandleUserActions_DeactivateAndLastAdminGuard(t *testing.T) {
+	api := newTestAPI(t)
+	handler := api.Handler()
+	adminToken := loginAsAdmin(t, api)
+	csrf := fetchCSRFToken(t, api, adminToken)
+
+	cashier, err := api.auth.Login(domain.LoginRequest{Username: "cashier", Password: "cashier123"})
+	if err != nil {
+		t.Fatalf("cashier login failed: %v", err)
+	}
+	cashierCSRF := fetchCSRFToken(t, api, cashier.AccessToken)
+
+	patchUser := func(username string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/users/"+username, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		req.Header.Set("X-CSRF-Token", csrf)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := patchUser("cashier", `{"active":false}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected deactivation to succeed, got %d (body: %s)", rec.Code, rec.Body.String())
+	}
+	if _, err := api.auth.Login(domain.LoginRequest{Username: "cashier", Password: "cashier123"}); err == nil {
+		t.Fatalf("expected a deactivated user to fail login")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/sync/offline-transactions", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+cashier.AccessToken)
+	req.Header.Set("X-CSRF-Token", cashierCSRF)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the deactivated cashier's token to be refused at offline sync, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/checkout", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+cashier.AccessToken)
+	req.Header.Set("X-CSRF-Token", cashierCSRF)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the deactivated cashier's token to be refused at checkout, got %d", rec.Code)
+	}
+
+	if rec := patchUser("admin", `{"role":"cashier"}`); rec.Code != http.StatusConflict {
+		t.Fatalf("expected demoting the last admin to be rejected, got %d (body: %s)", rec.Code, rec.Body.String())
+	}
+
+	logs, err := api.service.ListAuditLogs(context.Background(), "", "", 10)
+	if err != nil {
+		t.Fatalf("list audit logs failed: %v", err)
+	}
+	if len(logs) == 0 || logs[0].Action != "user_deactivate" || logs[0].EntityID != "cashier" {
+		t.Fatalf("expected the deactivation to be audited, got %+v", logs)
+	}
+}
+
+func TestHandleCashiersCreateStatuses(t *testing.T) {
+	api := newTestAPI(t)
+	handler := api.Handler()
+	token := loginAsAdmin(t, api)
+
+	cases := []struct {
+		body string
+		want int
+	}{
+		{`{"username":"kasir2","password":"kasir123"}`, http.StatusCreated},
+		{`{"username":"kasir2","password":"kasir456"}`, http.StatusConflict},
+		{`{"username":"cashier","password":"kasir456"}`, http.StatusConflict},
+		{`{"username":"kasir3","password":"short"}`, http.StatusBadRequest},
+		{`{"username":"ab","password":"kasir123"}`, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/users/cashiers", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("X-CSRF-Token", fetchCSRFToken(t, api, token))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Fatalf("create cashier %s: expected %d, got %d (body: %s)", tc.body, tc.want, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestHandleChangePasswordAndAdminReset(t *testing.T) {
+	api := newTestAPI(t)
+	handler := api.Handler()
+
+	cashier, err := api.auth.Login(domain.LoginRequest{Username: "cashier", Password: "cashier123"})
+	if err != nil {
+		t.Fatalf("cashier login failed: %v", err)
+	}
+	post := func(path string, token string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("X-CSRF-Token", fetchCSRFToken(t, api, token))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	cases := []struct {
+		body string
+		want int
+	}{
+		{`{"current_password":"wrong-pass1","new_password":"Kasir2026"}`, http.StatusUnauthorized},
+		{`{"current_password":"cashier123","new_password":"short1"}`, http.StatusBadRequest},
+		{`{"current_password":"cashier123","new_password":"lettersonly"}`, http.StatusBadRequest},
+		{`{"current_password":"cashier123","new_password":"cashier123"}`, http.StatusBadRequest},
+		{`{"current_password":"cashier123","new_password":"Kasir2026"}`, http.StatusOK},
+	}
+	for _, tc := range cases {
+		if rec := post("/api/v1/auth/change-password", cashier.AccessToken, tc.body); rec.Code != tc.want {
+			t.Fatalf("change-password %s: expected %d, got %d (body: %s)", tc.body, tc.want, rec.Code, rec.Body.String())
+		}
+	}
+	if _, err := api.auth.Refresh(domain.RefreshTokenRequest{RefreshToken: cashier.RefreshToken}); err == nil {
+		t.Fatalf("expected the password change to revoke the old refresh token")
+	}
+	relogin, err := api.auth.Login(domain.LoginRequest{Username: "cashier", Password: "Kasir2026"})
+	if err != nil {
+		t.Fatalf("expected login with the new password, got %v", err)
+	}
+
+	adminToken := loginAsAdmin(t, api)
+	if rec := post("/api/v1/users/cashier/reset-password", cashier.AccessToken, `{"new_password":"Reset2026x"}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected cashiers to be barred from resets, got %d", rec.Code)
+	}
+	if rec := post("/api/v1/users/cashier/reset-password", adminToken, `{"new_password":"Reset2026x"}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected admin reset to succeed, got %d (body: %s)", rec.Code, rec.Body.String())
+	}
+	if _, err := api.auth.Refresh(domain.RefreshTokenRequest{RefreshToken: relogin.RefreshToken}); err == nil {
+		t.Fatalf("expected the admin reset to revoke the cashier's refresh token")
+	}
+	if _, err := api.auth.Login(domain.LoginRequest{Username: "cashier", Password: "Reset2026x"}); err != nil {
+		t.Fatalf("expected login with the reset password, got %v", err)
+	}
+}
+
+func TestHandleCheckout_ReplayFlagsDuplicate(t *testing.T) {
+	api := newTestAPI(t)
+	handler := api.Handler()
+	token := loginAsAdmin(t, api)
+	csrf := fetchCSRFToken(t, api, token)
+
+	post := func(path string, body any) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("X-CSRF-Token", csrf)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post("/api/v1/shifts/open", domain.ShiftOpenRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		CashierName:       "Kasir A",
+		OpeningFloatCents: 100000,
+	}); rec.Code != http.StatusOK {
+		t.Fatalf("open shift: %d (body: %s)", rec.Code, rec.Body.String())
+	}
+	checkout := domain.CheckoutRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		IdempotencyKey:    "idem-replay-1",
+		PaymentMethod:     "cash",
+		CashReceivedCents: 10000,
+		CartItems:         []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}},
+	}
+
+	first := post("/api/v1/checkout", checkout)
+	if first.Code != http.StatusOK {
+		t.Fatalf("first checkout: %d (body: %s)", first.Code, first.Body.String())
+	}
+	if got := first.Header().Get("X-Idempotent-Replay"); got != "" {
+		t.Fatalf("first checkout flagged as replay: %q", got)
+	}
+	var original domain.CheckoutResponse
+	if err := json.NewDecoder(first.Body).Decode(&original); err != nil {
+		t.Fatalf("decode checkout: %v", err)
+	}
+
+	replay := post("/api/v1/checkout", checkout)
+	if replay.Code != http.StatusOK {
+		t.Fatalf("replay: expected 200, got %d (body: %s)", replay.Code, replay.Body.String())
+	}
+	if got := replay.Header().Get("X-Idempotent-Replay"); got != "true" {
+		t.Fatalf("replay: expected X-Idempotent-Replay true, got %q", got)
+	}
+
+	strict := post("/api/v1/checkout?strict_idempotency=true", checkout)
+	if strict.Code != http.StatusConflict {
+		t.Fatalf("strict replay: expected 409, got %d (body: %s)", strict.Code, strict.Body.String())
+	}
+	var body struct {
+		Error    string                  `json:"error"`
+		Checkout domain.CheckoutResponse `json:"checkout"`
+	}
+	if err := json.NewDecoder(strict.Body).Decode(&body); err != nil {
+		t.Fatalf("decode conflict: %v", err)
+	}
+	if body.Error == "" || !body.Checkout.Duplicate || body.Checkout.TransactionID != original.TransactionID {
+		t.Fatalf("unexpected conflict body: %+v", body)
+	}
+}
+
+func TestHandleJobsListsBackgroundJobs(t *testing.T) {
+	api := newTestAPI(t)
+	registry := jobs.NewRegistry()
+	api.SetJobRegistry(registry)
+	next := time.Now().Add(time.Hour)
+	registry.Scheduled(jobs.OfflineEnvelopeJanitor, next)
+	registry.Ran(jobs.OfflineEnvelopeJanitor, time.Now(), nil)
+
+	adminToken := loginAsAdmin(t, api)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/jobs", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	res := httptest.NewRecorder()
+	api.Handler().ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body.String())
+	}
+	var payload domain.JobListResponse
+	if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+		t.Fatalf("decode jobs failed: %v", err)
+	}
+	if len(payload.Jobs) != 1 || payload.Jobs[0].Name != jobs.OfflineEnvelopeJanitor || payload.Jobs[0].LastStatus != domain.JobStatusOK {
+		t.Fatalf("unexpected jobs: %+v", payload.Jobs)
+	}
+	if payload.Jobs[0].NextRunAt == nil || !payload.Jobs[0].NextRunAt.Equal(next) {
+		t.Fatalf("expected next run %s, got %v", next, payload.Jobs[0].NextRunAt)
+	}
+
+	cashier, err := api.auth.Login(domain.LoginRequest{Username: "cashier", Password: "cashier123"})
+	if err != nil {
+		t.Fatalf("cashier login failed: %v", err)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/admin/jobs", nil)
+	req.Header.Set("Authorization", "Bearer "+cashier.AccessToken)
+	res = httptest.NewRecorder()
+	api.Handler().ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("expected cashier to be forbidden, got %d", res.Code)
+	}
+}
+
+func TestHandleClientConfigListsPaymentMethods(t *testing.T) {
+	api := newTestAPI(t)
+	if err := api.service.SetPaymentMethods("", []string{"cash", "qris"}); err != nil {
+		t.Fatalf("set payment methods failed: %v", err)
+	}
+	cashier, err := api.auth.Login(domain.LoginRequest{Username: "cashier", Password: "cashier123"})
+	if err != nil {
+		t.Fatalf("cashier login failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/config", nil)
+	req.Header.Set("Authorization", "Bearer "+cashier.AccessToken)
+	res := httptest.NewRecorder()
+	api.Handler().ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body.String())
+	}
+	var payload domain.ClientConfigResponse
+	if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+		t.Fatalf("decode config failed: %v", err)
+	}
+	if payload.StoreID != "test-store" || payload.Currency != "IDR" || strings.Join(payload.PaymentMethods, ",") != "cash,qris" {
+		t.Fatalf("unexpected config: %+v", payload)
+	}
+}
+
+func TestHandleGetPromo(t *testing.T) {
+	api := newTestAPI(t)
+	adminToken := loginAsAdmin(t, api)
+	admin := service.WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	created, _, err := api.service.CreatePromo(admin, domain.PromoCreateRequest{Name: "Diskon 10%", Type: "cart_percent", DiscountPercent: 10})
+	if err != nil {
+		t.Fatalf("create promo failed: %v", err)
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		res := httptest.NewRecorder()
+		api.Handler().ServeHTTP(res, req)
+		return res
+	}
+
+	res := get("/api/v1/promos/" + created.ID)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body.String())
+	}
+	var payload struct {
+		Promo domain.PromoRule `json:"promo"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+		t.Fatalf("decode promo failed: %v", err)
+	}
+	if payload.Promo.ID != created.ID || payload.Promo.Name != "Diskon 10%" || payload.Promo.DiscountPercent != 10 {
+		t.Fatalf("unexpected promo: %+v", payload.Promo)
+	}
+
+	if res := get("/api/v1/promos/promo-missing"); res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a missing promo, got %d: %s", res.Code, res.Body.String())
+	}
+}
+
+func TestHandleProductsFiltersByTag(t *testing.T) {
+	api := newTestAPI(t)
+	adminToken := loginAsAdmin(t, api)
+	admin := service.WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	if _, err := api.service.CreateProduct(admin, domain.ProductCreateRequest{
+		SKU: "SKU-RENDANG-01", Name: "Rendang Kaleng", Category: "Makanan", PriceCents: 35000, Tags: []string{"halal"},
+	}); err != nil {
+		t.Fatalf("create product failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/products?tag=halal", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	res := httptest.NewRecorder()
+	api.Handler().ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body.String())
+	}
+	var payload struct {
+		Products []domain.Product `json:"products"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+		t.Fatalf("decode products failed: %v", err)
+	}
+	if len(payload.Products) != 1 || payload.Products[0].SKU != "SKU-RENDANG-01" {
+		t.Fatalf("expected only the halal product, got %+v", payload.Products)
+	}
+}
+
+func TestHandleCreatePromoDuplicateName(t *testing.T) {
+	api := newTestAPI(t)
+	adminToken := loginAsAdmin(t, api)
+	csrf := fetchCSRFToken(t, api, adminToken)
+	create := func() *httptest.ResponseRecorder {
+		raw, _ := json.Marshal(domain.PromoCreateRequest{Name: "Gajian", Type: "flat_cart", FlatDiscountCents: 5000})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/promos", bytes.NewReader(raw))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		req.Header.Set("X-CSRF-Token", csrf)
+		res := httptest.NewRecorder()
+		api.Handler().ServeHTTP(res, req)
+		return res
+	}
+
+	first := create()
+	if first.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", first.Code, first.Body.String())
+	}
+	second := create()
+	if second.Code != http.StatusOK || second.Header().Get("X-Idempotent-Replay") != "true" {
+		t.Fatalf("expected 200 replay for a duplicate name, got %d: %s", second.Code, second.Body.String())
+	}
+	var a, b struct {
+		Promo domain.PromoRule `json:"promo"`
+	}
+	_ = json.Unmarshal(first.Body.Bytes(), &a)
+	_ = json.Unmarshal(second.Body.Bytes(), &b)
+	if a.Promo.ID == "" || a.Promo.ID != b.Promo.ID {
+		t.Fatalf("expected the same promo back, got %q and %q", a.Promo.ID, b.Promo.ID)
+	}
+}
+
+func TestRegisteredTerminalTokenHeader(t *testing.T) {
+	api := newTestAPI(t)
+	api.service.SetRequireRegisteredTerminals(true)
+	adminToken := loginAsAdmin(t, api)
+	csrf := fetchCSRFToken(t, api, adminToken)
+	send := func(method string, path string, body any, terminalToken string) *httptest.ResponseRecorder {
+		raw, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(raw))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		req.Header.Set("X-CSRF-Token", csrf)
+		if terminalToken != "" {
+			req.Header.Set("X-Terminal-Token", terminalToken)
+		}
+		res := httptest.NewRecorder()
+		api.Handler().ServeHTTP(res, req)
+		return res
+	}
+	open := domain.ShiftOpenRequest{StoreID: "test-store", TerminalID: "terminal-a1", CashierName: "Kasir A"}
+
+	res := send(http.MethodPost, "/api/v1/shifts/open", open, "")
+	if res.Code != http.StatusForbidden || !strings.Contains(res.Body.String(), "terminal_not_registered") {
+		t.Fatalf("expected 403 terminal_not_registered, got %d: %s", res.Code, res.Body.String())
+	}
+
+	res = send(http.MethodPost, "/api/v1/terminals", domain.TerminalRegisterRequest{StoreID: "test-store", TerminalID: "terminal-a1", Label: "Kasir depan"}, "")
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", res.Code, res.Body.String())
+	}
+	body := res.Body.String()
+	var registration domain.TerminalRegistration
+	if err := json.Unmarshal([]byte(body), &registration); err != nil {
+		t.Fatalf("decode registration failed: %v", err)
+	}
+	if registration.Token == "" || strings.Contains(body, "token_hash") {
+		t.Fatalf("expected a token and no token hash, got %s", body)
+	}
+
+	if res := send(http.MethodPost, "/api/v1/shifts/open", open, registration.Token); res.Code != http.StatusOK {
+		t.Fatalf("expected the registered terminal to open a shift, got %d: %s", res.Code, res.Body.String())
+	}
+	if res := send(http.MethodPost, "/api/v1/terminals/terminal-a1/revoke?store_id=test-store", nil, ""); res.Code != http.StatusOK {
+		t.Fatalf("expected revoke to succeed, got %d: %s", res.Code, res.Body.String())
+	}
+	if res := send(http.MethodPost, "/api/v1/terminals/terminal-zz/revoke?store_id=test-store", nil, ""); res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown terminal, got %d", res.Code)
+	}
+	res = send(http.MethodPost, "/api/v1/shifts/close", domain.ShiftCloseRequest{StoreID: "test-store", TerminalID: "terminal-a1"}, registration.Token)
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("expected a revoked terminal to be forbidden, got %d: %s", res.Code, res.Body.String())
+	}
+}
+
+func TestHandleShiftUpdateRequiresManagerPIN(t *testing.T) {
+	api := newTestAPI(t)
+	adminToken := loginAsAdmin(t, api)
+	csrf := fetchCSRFToken(t, api, adminToken)
+	send := func(method string, path string, body any) *httptest.ResponseRecorder {
+		raw, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(raw))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		req.Header.Set("X-CSRF-Token", csrf)
+		res := httptest.NewRecorder()
+		api.Handler().ServeHTTP(res, req)
+		return res
+	}
+
+	res := send(http.MethodPost, "/api/v1/shifts/open", domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 1000000,
+	})
+	if res.Code != http.StatusOK {
+		t.Fatalf("open shift failed: %d %s", res.Code, res.Body.String())
+	}
+	var opened domain.ShiftResponse
+	if err := json.NewDecoder(res.Body).Decode(&opened); err != nil {
+		t.Fatalf("decode shift failed: %v", err)
+	}
+	path := "/api/v1/shifts/" + opened.Shift.ID
+	float := int64(100000)
+
+	if res := send(http.MethodPatch, path, domain.ShiftUpdateRequest{OpeningFloatCents: &float, ManagerPIN: "000000"}); res.Code != http.StatusForbidden {
+		t.Fatalf("expected wrong PIN to be forbidden, got %d", res.Code)
+	}
+	res = send(http.MethodPatch, path, domain.ShiftUpdateRequest{OpeningFloatCents: &float, ManagerPIN: "123456"})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected update to pass, got %d %s", res.Code, res.Body.String())
+	}
+	var updated domain.ShiftResponse
+	if err := json.NewDecoder(res.Body).Decode(&updated); err != nil {
+		t.Fatalf("decode shift failed: %v", err)
+	}
+	if updated.Shift.OpeningFloatCents != 100000 {
+		t.Fatalf("expected corrected float, got %d", updated.Shift.OpeningFloatCents)
+	}
+
+	if res := send(http.MethodPost, "/api/v1/shifts/close", domain.ShiftCloseRequest{StoreID: "main-store", TerminalID: "terminal-a1", ClosingCashCents: 100000}); res.Code != http.StatusOK {
+		t.Fatalf("close shift failed: %d %s", res.Code, res.Body.String())
+	}
+	res = send(http.MethodPatch, path, domain.ShiftUpdateRequest{OpeningFloatCents: &float, ManagerPIN: "123456"})
+	if res.Code != http.StatusConflict || !strings.Contains(res.Body.String(), `"code":"shift_closed"`) {
+		t.Fatalf("expected closed shift to conflict, got %d %s", res.Code, res.Body.String())
+	}
+}
@@ -1,15 +1,16 @@
 package httpapi
 
 import (
-	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"html/template"
+	"io"
 	"log"
 	"net/http"
 	"net/netip"
@@ -19,6 +20,9 @@ import (
 	"time"
 
 	"kasirinaja/backend/internal/domain"
+	"kasirinaja/backend/internal/i18n"
+	"kasirinaja/backend/internal/jobs"
+	"kasirinaja/backend/internal/reporting"
 	"kasirinaja/backend/internal/service"
 	"kasirinaja/backend/internal/store"
 )
@@ -29,62 +33,167 @@ type API struct {
 	allowedOrigin string
 	loginLimiter  *attemptLimiter
 	pinLimiter    *attemptLimiter
+	rateLimits    map[string]*tokenBucketLimiter
+	maxBodyBytes  int64
+	routeMaxBody  map[string]int64
 	csrfSecret    []byte
+	currency      string
+	endOfDay      *reporting.EndOfDayReporter
+	jobs          *jobs.Registry
+	readiness     []readinessCheck
+	storageMode   func() string
 }
 
+// readinessCheck is a named dependency probed by /readyz.
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// readinessTimeout bounds all /readyz probes so a hung dependency cannot hang
+// the load balancer's health check.
+const readinessTimeout = 2 * time.Second
+
+// Default JSON body limits. Offline sync gets more room because a terminal
+// that was offline for a shift uploads all of its sales in one envelope.
+const (
+	DefaultMaxRequestBytes            int64 = 1 << 20
+	DefaultOfflineSyncMaxRequestBytes int64 = 16 << 20
+)
+
 func New(svc *service.Service, auth *AuthManager, allowedOrigin string) *API {
 	csrfSecret := make([]byte, 32)
 	if _, err := rand.Read(csrfSecret); err != nil {
 		// Fall back to a deterministic secret if crypto/rand fails (should not happen in practice).
 		csrfSecret = []byte("csrf-fallback-secret-change-me!!")
 	}
+	loginLimiter := newAttemptLimiter(5, time.Minute)
+	pinLimiter := newAttemptLimiter(8, time.Minute)
+	go loginLimiter.runJanitor()
+	go pinLimiter.runJanitor()
 	return &API{
 		service:       svc,
 		auth:          auth,
 		allowedOrigin: allowedOrigin,
-		loginLimiter:  newAttemptLimiter(5, time.Minute),
-		pinLimiter:    newAttemptLimiter(8, time.Minute),
+		loginLimiter:  loginLimiter,
+		pinLimiter:    pinLimiter,
+		maxBodyBytes:  DefaultMaxRequestBytes,
+		routeMaxBody:  map[string]int64{"/api/v1/sync/offline-transactions": DefaultOfflineSyncMaxRequestBytes},
 		csrfSecret:    csrfSecret,
+		currency:      "IDR",
+		readiness:     []readinessCheck{{name: "repository", check: svc.Ping}},
+	}
+}
+
+// Stop ends the background goroutines started by New. Call it once the
+// server has shut down.
+func (a *API) Stop() {
+	a.loginLimiter.Stop()
+	a.pinLimiter.Stop()
+	for _, limiter := range a.rateLimits {
+		limiter.Stop()
+	}
+}
+
+// AddReadinessCheck registers another dependency that must respond for
+// /readyz to report ready, e.g. the Redis cache.
+func (a *API) AddReadinessCheck(name string, check func(ctx context.Context) error) {
+	a.readiness = append(a.readiness, readinessCheck{name: name, check: check})
+}
+
+// SetMaxRequestBytes sets the largest JSON body accepted by routes without
+// their own limit.
+func (a *API) SetMaxRequestBytes(limit int64) error {
+	if limit <= 0 {
+		return fmt.Errorf("max request bytes must be positive, got %d", limit)
+	}
+	a.maxBodyBytes = limit
+	return nil
+}
+
+// SetRouteMaxRequestBytes overrides the JSON body limit for one route path.
+func (a *API) SetRouteMaxRequestBytes(path string, limit int64) error {
+	if limit <= 0 {
+		return fmt.Errorf("max request bytes for %s must be positive, got %d", path, limit)
+	}
+	a.routeMaxBody[path] = limit
+	return nil
+}
+
+// maxRequestBytes returns the JSON body limit for path.
+func (a *API) maxRequestBytes(path string) int64 {
+	if limit, ok := a.routeMaxBody[path]; ok {
+		return limit
+	}
+	return a.maxBodyBytes
+}
+
+// SetStorageMode reports the repository's read/write mode on /readyz, e.g.
+// whether the database circuit breaker has made the service read-only.
+func (a *API) SetStorageMode(mode func() string) {
+	a.storageMode = mode
+}
+
+// SetEndOfDayReporter enables the manual daily report send endpoint.
+func (a *API) SetEndOfDayReporter(reporter *reporting.EndOfDayReporter) {
+	a.endOfDay = reporter
+}
+
+// SetJobRegistry enables the background job health endpoint.
+func (a *API) SetJobRegistry(registry *jobs.Registry) {
+	a.jobs = registry
+}
+
+// SetCurrency sets the ISO currency code used when formatting exported
+// report amounts.
+func (a *API) SetCurrency(currency string) {
+	if currency = strings.ToUpper(strings.TrimSpace(currency)); currency != "" {
+		a.currency = currency
 	}
 }
 
 // csrfTokenForHour computes an HMAC-SHA256 token for the given hour bucket
-// (expressed as Unix time truncated to the hour). The token is hex-encoded.
-func (a *API) csrfTokenForHour(hourBucket int64) string {
+// (expressed as Unix time truncated to the hour) and username, so a token
+// minted for one user is useless to another. The token is hex-encoded.
+func (a *API) csrfTokenForHour(hourBucket int64, username string) string {
 	h := hmac.New(sha256.New, a.csrfSecret)
-	fmt.Fprintf(h, "%d", hourBucket)
+	fmt.Fprintf(h, "%d:%s", hourBucket, username)
 	return hex.EncodeToString(h.Sum(nil))
 }
 
-// generateCSRFToken returns a token valid for the current hour bucket.
-func (a *API) generateCSRFToken() string {
+// generateCSRFToken returns a token for username valid for the current hour
+// bucket.
+func (a *API) generateCSRFToken(username string) string {
 	now := time.Now().UTC()
 	bucket := now.Truncate(time.Hour).Unix()
-	return a.csrfTokenForHour(bucket)
+	return a.csrfTokenForHour(bucket, username)
 }
 
-// validateCSRFToken checks whether the provided token matches the current or
-// previous hour bucket, giving a 2-hour validity window.
-func (a *API) validateCSRFToken(token string) bool {
-	if token == "" {
+// validateCSRFToken checks whether the provided token was minted for username
+// in the current or previous hour bucket, giving a 2-hour validity window.
+func (a *API) validateCSRFToken(token string, username string) bool {
+	if token == "" || username == "" {
 		return false
 	}
 	now := time.Now().UTC()
 	currentBucket := now.Truncate(time.Hour).Unix()
 	prevBucket := currentBucket - 3600
 
-	expected1 := a.csrfTokenForHour(currentBucket)
-	expected2 := a.csrfTokenForHour(prevBucket)
+	expected1 := a.csrfTokenForHour(currentBucket, username)
+	expected2 := a.csrfTokenForHour(prevBucket, username)
 
 	return hmac.Equal([]byte(token), []byte(expected1)) ||
 		hmac.Equal([]byte(token), []byte(expected2))
 }
 
 type attemptLimiter struct {
-	mu      sync.Mutex
-	max     int
-	window  time.Duration
-	entries map[string][]time.Time
+	mu       sync.Mutex
+	max      int
+	window   time.Duration
+	now      func() time.Time
+	entries  map[string][]time.Time
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
 func newAttemptLimiter(max int, window time.Duration) *attemptLimiter {
@@ -94,14 +203,20 @@ func newAttemptLimiter(max int, window time.Duration) *attemptLimiter {
 	if window <= 0 {
 		window = time.Minute
 	}
-	return &attemptLimiter{max: max, window: window, entries: make(map[string][]time.Time)}
+	return &attemptLimiter{
+		max:     max,
+		window:  window,
+		now:     time.Now,
+		entries: make(map[string][]time.Time),
+		stop:    make(chan struct{}),
+	}
 }
 
 func (l *attemptLimiter) Allow(key string) bool {
 	if l == nil {
 		return true
 	}
-	now := time.Now()
+	now := l.now()
 	cutoff := now.Add(-l.window)
 
 	l.mu.Lock()
@@ -123,6 +238,44 @@ func (l *attemptLimiter) Allow(key string) bool {
 	return true
 }
 
+// sweep deletes keys with no attempts left in the window. Allow only prunes
+// the key it is asked about, so without this every client that ever failed a
+// login or PIN would stay in the map.
+func (l *attemptLimiter) sweep() {
+	cutoff := l.now().Add(-l.window)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, history := range l.entries {
+		if len(history) == 0 || !history[len(history)-1].After(cutoff) {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// runJanitor sweeps once per window until Stop is called.
+func (l *attemptLimiter) runJanitor() {
+	ticker := time.NewTicker(l.window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.sweep()
+		}
+	}
+}
+
+// Stop ends the janitor goroutine. It is safe to call more than once.
+func (l *attemptLimiter) Stop() {
+	if l == nil {
+		return
+	}
+	l.stopOnce.Do(func() { close(l.stop) })
+}
+
 func clientKey(r *http.Request) string {
 	host := strings.TrimSpace(r.RemoteAddr)
 	if host == "" {
@@ -138,70 +291,166 @@ func clientKey(r *http.Request) string {
 }
 
 func (a *API) Handler() http.Handler {
-	mux := http.NewServeMux()
-
-	mux.HandleFunc("/healthz", a.handleHealth)
-	mux.HandleFunc("/api/v1/auth/login", a.handleLogin)
-	mux.HandleFunc("/api/v1/auth/csrf-token", a.handleCSRFToken)
-
-	mux.HandleFunc("/api/v1/products", a.requireAuth(a.handleProducts, "cashier", "admin"))
-	mux.HandleFunc("/api/v1/products/", a.requireAuth(a.handleProductActions, "admin"))
-	mux.HandleFunc("/api/v1/cart/recommendation", a.requireAuth(a.handleRecommendation, "cashier", "admin"))
-	mux.HandleFunc("/api/v1/checkout", a.requireAuth(a.handleCheckout, "cashier", "admin"))
-	mux.HandleFunc("/api/v1/checkout/idempotency/", a.requireAuth(a.handleCheckoutLookup, "cashier", "admin"))
-	mux.HandleFunc("/api/v1/carts/hold", a.requireAuth(a.handleHeldCarts, "cashier", "admin"))
-	mux.HandleFunc("/api/v1/carts/hold/", a.requireAuth(a.handleHeldCartActions, "cashier", "admin"))
-	mux.HandleFunc("/api/v1/sync/offline-transactions", a.requireAuth(a.handleOfflineSync, "cashier", "admin"))
-	mux.HandleFunc("/api/v1/metrics/attach-rate", a.requireAuth(a.handleAttachMetrics, "cashier", "admin"))
-
-	mux.HandleFunc("/api/v1/shifts/open", a.requireAuth(a.handleShiftOpen, "cashier", "admin"))
-	mux.HandleFunc("/api/v1/shifts/close", a.requireAuth(a.handleShiftClose, "cashier", "admin"))
-	mux.HandleFunc("/api/v1/shifts/active", a.requireAuth(a.handleShiftActive, "cashier", "admin"))
-
-	mux.HandleFunc("/api/v1/transactions/", a.requireAuth(a.handleTransactionActions, "admin"))
-	mux.HandleFunc("/api/v1/refunds", a.requireAuth(a.handleRefunds, "admin"))
-	mux.HandleFunc("/api/v1/returns/items", a.requireAuth(a.handleItemReturns, "admin"))
-	mux.HandleFunc("/api/v1/stock-opname", a.requireAuth(a.handleStockOpname, "admin"))
-	mux.HandleFunc("/api/v1/inventory/lots", a.requireAuth(a.handleInventoryLots, "admin"))
-	mux.HandleFunc("/api/v1/audit-logs", a.requireAuth(a.handleAuditLogs, "admin"))
-	mux.HandleFunc("/api/v1/reports/daily", a.requireAuth(a.handleDailyReport, "admin"))
-	mux.HandleFunc("/api/v1/reorder-suggestions", a.requireAuth(a.handleReorderSuggestions, "admin"))
-	mux.HandleFunc("/api/v1/alerts/anomalies", a.requireAuth(a.handleAnomalyAlerts, "admin"))
-	mux.HandleFunc("/api/v1/promos", a.requireAuth(a.handlePromos, "admin"))
-	mux.HandleFunc("/api/v1/promos/", a.requireAuth(a.handlePromoActions, "admin"))
-	mux.HandleFunc("/api/v1/suppliers", a.requireAuth(a.handleSuppliers, "admin"))
-	mux.HandleFunc("/api/v1/purchase-orders", a.requireAuth(a.handlePurchaseOrders, "admin"))
-	mux.HandleFunc("/api/v1/purchase-orders/", a.requireAuth(a.handlePurchaseOrderActions, "admin"))
-	mux.HandleFunc("/api/v1/users/cashiers", a.requireAuth(a.handleCashiers, "admin"))
-	mux.HandleFunc("/api/v1/hardware/receipt/escpos", a.requireAuth(a.handleHardwareReceiptEscpos, "cashier", "admin"))
-	mux.HandleFunc("/api/v1/hardware/cash-drawer/open", a.requireAuth(a.handleCashDrawerOpen, "cashier", "admin"))
-	mux.HandleFunc("/api/v1/recommendation/retrain", a.requireAuth(a.handleRetrain, "admin"))
-
-	return a.withMiddleware(mux)
+	routes := newRouteTable()
+
+	routes.handle("/healthz", a.handleHealth, http.MethodGet)
+	routes.handle("/readyz", a.handleReady, http.MethodGet)
+	routes.handle("/api/v1/auth/login", a.handleLogin, http.MethodPost)
+	routes.handle("/api/v1/auth/refresh", a.handleRefresh, http.MethodPost)
+	routes.handle("/api/v1/auth/logout", a.requireAuth(a.handleLogout, "cashier", "admin"), http.MethodPost)
+	routes.handle("/api/v1/auth/change-password", a.requireActiveAuth(a.handleChangePassword, "cashier", "admin"), http.MethodPost)
+	routes.handle("/api/v1/auth/csrf-token", a.requireAuth(a.handleCSRFToken, "cashier", "admin"), http.MethodGet)
+
+	routes.handle("/api/v1/config", a.requireAuth(a.handleClientConfig, "cashier", "admin"), http.MethodGet)
+	routes.handle("/api/v1/products", a.requireAuth(a.handleProducts, "cashier", "admin"), http.MethodGet, http.MethodPost)
+	routes.handle("/api/v1/products/", a.requireActiveAuth(a.handleProductActions, "admin"), http.MethodGet, http.MethodPatch)
+	routes.handle("/api/v1/cart/recommendation", a.requireAuth(a.rateLimited("recommendation", a.handleRecommendation), "cashier", "admin"), http.MethodPost)
+	routes.handle("/api/v1/checkout", a.requireActiveAuth(a.rateLimited("checkout", a.handleCheckout), "cashier", "admin"), http.MethodPost)
+	routes.handle("/api/v1/customers/", a.requireAuth(a.handleCustomerTransactions, "cashier", "admin"), http.MethodGet)
+	routes.handle("/api/v1/store-credits/", a.requireActiveAuth(a.handleStoreCredits, "cashier", "admin"), http.MethodGet, http.MethodPost)
+	routes.handle("/api/v1/checkout/quote", a.requireAuth(a.rateLimited("checkout_quote", a.handleCheckoutQuote), "cashier", "admin"), http.MethodPost)
+	routes.handle("/api/v1/checkout/idempotency/", a.requireAuth(a.handleCheckoutLookup, "cashier", "admin"), http.MethodGet)
+	routes.handle("/api/v1/carts/hold", a.requireAuth(a.handleHeldCarts, "cashier", "admin"), http.MethodGet, http.MethodPost)
+	routes.handle("/api/v1/carts/hold/", a.requireAuth(a.handleHeldCartActions, "cashier", "admin"), http.MethodPost)
+	routes.handle("/api/v1/sync/offline-transactions", a.requireActiveAuth(a.handleOfflineSync, "cashier", "admin"), http.MethodPost)
+	routes.handle("/api/v1/metrics/attach-rate", a.requireAuth(a.handleAttachMetrics, "cashier", "admin"), http.MethodGet)
+
+	routes.handle("/api/v1/shifts", a.requireAuth(a.handleShifts, "admin"), http.MethodGet)
+	routes.handle("/api/v1/shifts/open", a.requireAuth(a.handleShiftOpen, "cashier", "admin"), http.MethodPost)
+	routes.handle("/api/v1/shifts/close", a.requireAuth(a.handleShiftClose, "cashier", "admin"), http.MethodPost)
+	routes.handle("/api/v1/shifts/active", a.requireAuth(a.handleShiftActive, "cashier", "admin"), http.MethodGet)
+	routes.handle("/api/v1/shifts/", a.requireAuth(a.handleShiftActions, "cashier", "admin"), http.MethodGet, http.MethodPost, http.MethodPatch)
+	routes.handle("/api/v1/terminals", a.requireActiveAuth(a.handleTerminals, "admin"), http.MethodGet, http.MethodPost)
+	routes.handle("/api/v1/terminals/", a.requireActiveAuth(a.handleTerminalActions, "admin"), http.MethodPost)
+
+	routes.handle("/api/v1/transactions/", a.requireActiveAuth(a.handleTransactionActions, "admin"), http.MethodPost)
+	routes.handle("/api/v1/refunds", a.requireActiveAuth(a.handleRefunds, "admin"), http.MethodPost)
+	routes.handle("/api/v1/returns/items", a.requireActiveAuth(a.handleItemReturns, "admin"), http.MethodPost)
+	routes.handle("/api/v1/stock-opname", a.requireActiveAuth(a.handleStockOpname, "admin"), http.MethodPost)
+	routes.handle("/api/v1/stock-opname/", a.requireAuth(a.handleStockOpnameDetail, "admin"), http.MethodGet)
+	routes.handle("/api/v1/inventory/lots", a.requireActiveAuth(a.handleInventoryLots, "admin"), http.MethodGet, http.MethodPost)
+	routes.handle("/api/v1/inventory/lots/", a.requireActiveAuth(a.handleInventoryLotActions, "admin"), http.MethodPatch)
+	routes.handle("/api/v1/inventory/lots/batch", a.requireActiveAuth(a.handleInventoryLotBatch, "admin"), http.MethodPost)
+	routes.handle("/api/v1/inventory/expiring", a.requireAuth(a.handleExpiringLots, "admin"), http.MethodGet)
+	routes.handle("/api/v1/inventory/serials", a.requireAuth(a.handleInventorySerials, "cashier", "admin"), http.MethodGet)
+	routes.handle("/api/v1/inventory/movements", a.requireAuth(a.handleStockMovements, "admin"), http.MethodGet)
+	routes.handle("/api/v1/inventory/write-off", a.requireActiveAuth(a.handleStockWriteOff, "admin"), http.MethodPost)
+	routes.handle("/api/v1/inventory/stock/bulk", a.requireActiveAuth(a.handleStockBulkSet, "admin"), http.MethodPost)
+	routes.handle("/api/v1/inventory/transfer", a.requireActiveAuth(a.handleStockTransfer, "admin"), http.MethodPost)
+	routes.handle("/api/v1/audit-logs", a.requireAuth(a.handleAuditLogs, "admin"), http.MethodGet)
+	routes.handle("/api/v1/reports/daily", a.requireAuth(a.handleDailyReport, "admin"), http.MethodGet)
+	routes.handle("/api/v1/reports/daily/send", a.requireAuth(a.handleDailyReportSend, "admin"), http.MethodPost)
+	routes.handle("/api/v1/reports/hourly", a.requireAuth(a.handleHourlySales, "admin"), http.MethodGet)
+	routes.handle("/api/v1/reports/range", a.requireAuth(a.handleRangeReport, "admin"), http.MethodGet)
+	routes.handle("/api/v1/reports/by-supplier", a.requireAuth(a.handleSupplierSalesReport, "admin"), http.MethodGet)
+	routes.handle("/api/v1/reports/inventory-valuation", a.requireAuth(a.handleInventoryValuation, "admin"), http.MethodGet)
+	routes.handle("/api/v1/reorder-suggestions", a.requireAuth(a.handleReorderSuggestions, "admin"), http.MethodGet)
+	routes.handle("/api/v1/alerts/anomalies", a.requireAuth(a.handleAnomalyAlerts, "admin"), http.MethodGet)
+	routes.handle("/api/v1/promos", a.requireActiveAuth(a.handlePromos, "admin"), http.MethodGet, http.MethodPost)
+	routes.handle("/api/v1/promos/", a.requireActiveAuth(a.handlePromoActions, "admin"), http.MethodGet, http.MethodPost)
+	routes.handle("/api/v1/suppliers", a.requireAuth(a.handleSuppliers, "admin"), http.MethodGet, http.MethodPost)
+	routes.handle("/api/v1/suppliers/", a.requireAuth(a.handleSupplierActions, "admin"), http.MethodGet, http.MethodPost, http.MethodPatch)
+	routes.handle("/api/v1/purchase-orders", a.requireAuth(a.handlePurchaseOrders, "admin"), http.MethodGet, http.MethodPost)
+	routes.handle("/api/v1/purchase-orders/", a.requireAuth(a.handlePurchaseOrderActions, "admin"), http.MethodPost)
+	routes.handle("/api/v1/purchase-orders/from-reorder", a.requireAuth(a.handlePurchaseOrdersFromReorder, "admin"), http.MethodPost)
+	routes.handle("/api/v1/users/cashiers", a.requireActiveAuth(a.handleCashiers, "admin"), http.MethodGet, http.MethodPost)
+	routes.handle("/api/v1/admin/export", a.requireActiveAuth(a.handleDataExport, "admin"), http.MethodGet)
+	routes.handle("/api/v1/admin/import", a.requireActiveAuth(a.handleDataImport, "admin"), http.MethodPost)
+	routes.handle("/api/v1/admin/jobs", a.requireAuth(a.handleJobs, "admin"), http.MethodGet)
+	routes.handle("/api/v1/users/", a.requireActiveAuth(a.handleUserActions, "admin"), http.MethodPost, http.MethodPatch)
+	routes.handle("/api/v1/hardware/receipt/escpos", a.requireAuth(a.handleHardwareReceiptEscpos, "cashier", "admin"), http.MethodPost)
+	routes.handle("/api/v1/hardware/kitchen-ticket", a.requireAuth(a.handleKitchenTicket, "cashier", "admin"), http.MethodPost)
+	routes.handle("/api/v1/hardware/cash-drawer/open", a.requireAuth(a.handleCashDrawerOpen, "cashier", "admin"), http.MethodPost)
+	routes.handle("/api/v1/recommendation/retrain", a.requireAuth(a.handleRetrain, "admin"), http.MethodPost)
+	routes.handle("/api/v1/recommendation/pairs", a.requireAuth(a.handleAssociationPairs, "admin"), http.MethodPost, http.MethodDelete)
+
+	return a.withMiddleware(routes.mux)
 }
 
 func (a *API) requireAuth(next http.HandlerFunc, roles ...string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		authorization := strings.TrimSpace(r.Header.Get("Authorization"))
-		if !strings.HasPrefix(strings.ToLower(authorization), "bearer ") {
+		actor, ok, err := a.bearerActor(r)
+		if !ok {
 			writeError(w, http.StatusUnauthorized, errors.New("missing bearer token"))
 			return
 		}
-
-		token := strings.TrimSpace(authorization[len("Bearer "):])
-		actor, err := a.auth.ParseToken(token)
 		if err != nil {
 			writeError(w, http.StatusUnauthorized, err)
 			return
 		}
 
 		if len(roles) > 0 && !isRoleAllowed(actor.Role, roles) {
-			writeError(w, http.StatusForbidden, errors.New("forbidden role"))
+			writeError(w, http.StatusForbidden, errForbiddenRole)
 			return
 		}
 
-		next(w, r.WithContext(service.WithActor(r.Context(), actor)))
+		ctx := service.WithActor(r.Context(), actor)
+		if terminalToken := strings.TrimSpace(r.Header.Get("X-Terminal-Token")); terminalToken != "" {
+			ctx = service.WithTerminalToken(ctx, terminalToken)
+		}
+		next(w, r.WithContext(ctx))
+	}
+}
+
+type bearerContextKey struct{}
+
+// bearerResult is the outcome of verifying a request's bearer token.
+type bearerResult struct {
+	actor domain.Actor
+	err   error
+}
+
+// authenticate verifies the request's bearer token once and keeps the result
+// in the context, so checkCSRF and requireAuth share one signature check and
+// revocation lookup.
+func (a *API) authenticate(r *http.Request) *http.Request {
+	actor, ok, err := a.bearerActor(r)
+	if !ok {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), bearerContextKey{}, bearerResult{actor: actor, err: err}))
+}
+
+// bearerActor returns the actor of the request's bearer token, reusing the
+// result authenticate stored. ok is false when there is no bearer token.
+func (a *API) bearerActor(r *http.Request) (actor domain.Actor, ok bool, err error) {
+	if cached, found := r.Context().Value(bearerContextKey{}).(bearerResult); found {
+		return cached.actor, true, cached.err
+	}
+	token, ok := bearerToken(r)
+	if !ok {
+		return domain.Actor{}, false, nil
+	}
+	actor, err = a.auth.ParseToken(token)
+	return actor, true, err
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	authorization := strings.TrimSpace(r.Header.Get("Authorization"))
+	if !strings.HasPrefix(strings.ToLower(authorization), "bearer ") {
+		return "", false
 	}
+	return strings.TrimSpace(authorization[len("Bearer "):]), true
+}
+
+// requireActiveAuth is requireAuth plus a fresh lookup of the account, so a
+// deactivated or demoted user's unexpired token is not honoured on routes that
+// move money or stock, change prices or terminal trust, or manage users.
+func (a *API) requireActiveAuth(next http.HandlerFunc, roles ...string) http.HandlerFunc {
+	return a.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		actor, _ := service.ActorFromContext(r.Context())
+		current, err := a.auth.CurrentActor(r.Context(), actor.Username)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+		if len(roles) > 0 && !isRoleAllowed(current.Role, roles) {
+			writeError(w, http.StatusForbidden, errForbiddenRole)
+			return
+		}
+		next(w, r.WithContext(service.WithActor(r.Context(), current)))
+	}, roles...)
 }
 
 func isRoleAllowed(role string, allowed []string) bool {
@@ -225,6 +474,56 @@ func (a *API) handleHealth(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleReady probes every registered dependency concurrently and answers 503
+// listing the failed ones, so load balancers stop routing to a broken
+// instance. /healthz stays a cheap liveness check.
+func (a *API) handleReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	results := make([]error, len(a.readiness))
+	var wg sync.WaitGroup
+	for i, probe := range a.readiness {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = probe.check(ctx)
+		}()
+	}
+	wg.Wait()
+
+	checks := make(map[string]string, len(a.readiness))
+	failed := make([]string, 0)
+	for i, probe := range a.readiness {
+		if results[i] != nil {
+			checks[probe.name] = results[i].Error()
+			failed = append(failed, probe.name)
+			continue
+		}
+		checks[probe.name] = "ok"
+	}
+
+	status := http.StatusOK
+	if len(failed) > 0 {
+		status = http.StatusServiceUnavailable
+	}
+	payload := map[string]any{
+		"ok":     len(failed) == 0,
+		"checks": checks,
+		"failed": failed,
+		"at":     time.Now().UTC().Format(time.RFC3339),
+	}
+	if a.storageMode != nil {
+		payload["mode"] = a.storageMode()
+	}
+	writeJSON(w, status, payload)
+}
+
 func (a *API) handleLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeMethodNotAllowed(w)
@@ -250,22 +549,103 @@ func (a *API) handleLogin(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, resp)
 }
 
-// handleCSRFToken returns a stateless CSRF token valid for the current hour bucket.
+// handleRefresh exchanges a refresh token for a new access and refresh token
+// pair. It shares the login rate limit since it is also unauthenticated.
+func (a *API) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+	if !a.loginLimiter.Allow(clientKey(r)) {
+		writeError(w, http.StatusTooManyRequests, errors.New("too many login attempts"))
+		return
+	}
+
+	var req domain.RefreshTokenRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := a.auth.Refresh(req)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleLogout revokes the caller's access token and, when sent in the body,
+// their refresh token.
+func (a *API) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	var req domain.LogoutRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	token, _ := bearerToken(r)
+	if err := a.auth.Logout(r.Context(), token, req.RefreshToken); err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"logged_out": true})
+}
+
+// handleChangePassword lets the logged-in user rotate their own password. It
+// is rate limited like login to slow down guessing of the current password.
+func (a *API) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+	if !a.loginLimiter.Allow("password:" + clientKey(r)) {
+		writeError(w, http.StatusTooManyRequests, errors.New("too many password attempts"))
+		return
+	}
+
+	var req domain.ChangePasswordRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	actor, _ := service.ActorFromContext(r.Context())
+	if err := a.auth.ChangePassword(r.Context(), actor.Username, req.CurrentPassword, req.NewPassword); err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	a.service.RecordUserChange(r.Context(), "password_change", actor.Username, "")
+	writeJSON(w, http.StatusOK, map[string]any{"password_changed": true})
+}
+
+// handleCSRFToken returns a stateless CSRF token for the caller valid for the current hour bucket.
 // Clients must include this token in the X-CSRF-Token header for all mutating requests.
 func (a *API) handleCSRFToken(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		writeMethodNotAllowed(w)
 		return
 	}
+	actor, _ := service.ActorFromContext(r.Context())
 	writeJSON(w, http.StatusOK, map[string]any{
-		"csrf_token": a.generateCSRFToken(),
+		"csrf_token": a.generateCSRFToken(actor.Username),
 	})
 }
 
 // csrfExemptPaths lists paths that are exempt from CSRF validation.
-// Login and offline-sync are excluded because they are called without a prior CSRF token fetch.
+// Login and token refresh run before the client has an identity to bind a CSRF token to,
+// and offline-sync is replayed by devices without a prior CSRF token fetch.
 var csrfExemptPaths = []string{
 	"/api/v1/auth/login",
+	"/api/v1/auth/refresh",
 	"/api/v1/sync/offline-transactions",
 }
 
@@ -281,9 +661,14 @@ func (a *API) checkCSRF(w http.ResponseWriter, r *http.Request) bool {
 			return true
 		}
 	}
+	// The token must have been minted for the identity making the request.
+	username := ""
+	if actor, ok, err := a.bearerActor(r); ok && err == nil {
+		username = actor.Username
+	}
 	token := strings.TrimSpace(r.Header.Get("X-CSRF-Token"))
-	if !a.validateCSRFToken(token) {
-		writeError(w, http.StatusForbidden, errors.New("missing or invalid CSRF token"))
+	if !a.validateCSRFToken(token, username) {
+		writeError(w, http.StatusForbidden, errInvalidCSRFToken)
 		return false
 	}
 	return true
@@ -292,7 +677,8 @@ func (a *API) checkCSRF(w http.ResponseWriter, r *http.Request) bool {
 func (a *API) handleProducts(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		products, err := a.service.ListProducts(r.Context())
+		query := r.URL.Query()
+		products, err := a.service.ListProducts(r.Context(), domain.ProductFilter{Tag: query.Get("tag"), Brand: query.Get("brand")})
 		if err != nil {
 			writeError(w, http.StatusInternalServerError, err)
 			return
@@ -301,7 +687,7 @@ func (a *API) handleProducts(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPost:
 		actor, ok := service.ActorFromContext(r.Context())
 		if !ok || actor.Role != "admin" {
-			writeError(w, http.StatusForbidden, errors.New("forbidden role"))
+			writeError(w, http.StatusForbidden, errForbiddenRole)
 			return
 		}
 
@@ -313,14 +699,7 @@ func (a *API) handleProducts(w http.ResponseWriter, r *http.Request) {
 
 		product, err := a.service.CreateProduct(r.Context(), req)
 		if err != nil {
-			status := http.StatusUnprocessableEntity
-			if errors.Is(err, store.ErrInvalidTransaction) {
-				status = http.StatusBadRequest
-			}
-			if strings.Contains(strings.ToLower(err.Error()), "admin role required") {
-				status = http.StatusForbidden
-			}
-			writeError(w, status, err)
+			writeError(w, statusForError(err), err)
 			return
 		}
 		writeJSON(w, http.StatusCreated, map[string]any{"product": product})
@@ -358,11 +737,7 @@ func (a *API) handleProductActions(w http.ResponseWriter, r *http.Request) {
 
 		history, err := a.service.ListProductPriceHistory(r.Context(), sku, limit)
 		if err != nil {
-			status := http.StatusUnprocessableEntity
-			if errors.Is(err, store.ErrInvalidTransaction) {
-				status = http.StatusBadRequest
-			}
-			writeError(w, status, err)
+			writeError(w, statusForError(err), err)
 			return
 		}
 		writeJSON(w, http.StatusOK, map[string]any{"history": history})
@@ -382,17 +757,7 @@ func (a *API) handleProductActions(w http.ResponseWriter, r *http.Request) {
 
 	updated, err := a.service.UpdateProduct(r.Context(), tail, req)
 	if err != nil {
-		status := http.StatusUnprocessableEntity
-		if errors.Is(err, store.ErrNotFound) {
-			status = http.StatusNotFound
-		}
-		if errors.Is(err, store.ErrInvalidTransaction) {
-			status = http.StatusBadRequest
-		}
-		if strings.Contains(strings.ToLower(err.Error()), "admin role required") {
-			status = http.StatusForbidden
-		}
-		writeError(w, status, err)
+		writeError(w, statusForError(err), err)
 		return
 	}
 
@@ -417,7 +782,7 @@ func (a *API) handleRecommendation(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := a.service.Recommend(r.Context(), req)
 	if err != nil {
-		writeError(w, http.StatusUnprocessableEntity, err)
+		writeError(w, statusForError(err), err)
 		return
 	}
 
@@ -438,19 +803,109 @@ func (a *API) handleCheckout(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := a.service.Checkout(r.Context(), req)
 	if err != nil {
-		switch {
-		case errors.Is(err, store.ErrInsufficientStock):
-			writeError(w, http.StatusConflict, err)
-		case errors.Is(err, store.ErrInvalidTransaction):
+		writeError(w, statusForError(err), err)
+		return
+	}
+
+	// A replayed idempotency key answers 200 with the recorded sale and
+	// X-Idempotent-Replay: true, or 409 carrying that sale when the client
+	// asks for strict_idempotency.
+	if resp.Duplicate {
+		w.Header().Set("X-Idempotent-Replay", "true")
+		if strict, _ := strconv.ParseBool(r.URL.Query().Get("strict_idempotency")); strict {
+			payload := errorPayload(w, http.StatusConflict, errIdempotencyReplay)
+			payload["checkout"] = resp
+			writeJSON(w, http.StatusConflict, payload)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *API) handleCustomerTransactions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/customers/"), "/")
+	customerID, action, _ := strings.Cut(rest, "/")
+	if action != "transactions" {
+		writeError(w, http.StatusNotFound, errors.New("unknown customer action"))
+		return
+	}
+	limit := parsePositiveLimit(r.URL.Query().Get("limit"), 100, 500)
+
+	resp, err := a.service.ListCustomerTransactions(r.Context(), customerID, limit)
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *API) handleStoreCredits(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/store-credits/"), "/")
+	code, action, _ := strings.Cut(rest, "/")
+	code = strings.TrimSpace(code)
+	if code == "" {
+		writeError(w, http.StatusBadRequest, errors.New("store credit code required"))
+		return
+	}
+
+	writeStoreCreditError := func(err error) {
+		writeError(w, statusForError(err), err)
+	}
+
+	switch action {
+	case "":
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w)
+			return
+		}
+		balance, err := a.service.GetStoreCreditBalance(r.Context(), code)
+		if err != nil {
+			writeStoreCreditError(err)
+			return
+		}
+		writeJSON(w, http.StatusOK, balance)
+	case "redeem":
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w)
+			return
+		}
+		var req domain.StoreCreditRedeemRequest
+		if err := decodeJSON(r, &req); err != nil {
 			writeError(w, http.StatusBadRequest, err)
-		case strings.Contains(strings.ToLower(err.Error()), "manual override"):
-			writeError(w, http.StatusForbidden, err)
-		default:
-			writeError(w, http.StatusUnprocessableEntity, err)
+			return
 		}
+		entry, err := a.service.RedeemStoreCredit(r.Context(), code, req)
+		if err != nil {
+			writeStoreCreditError(err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"entry": entry})
+	default:
+		writeError(w, http.StatusNotFound, errors.New("unknown store credit action"))
+	}
+}
+
+func (a *API) handleCheckoutQuote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	var req domain.CheckoutRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
 		return
 	}
 
+	resp, err := a.service.QuoteCheckout(r.Context(), req)
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
 	writeJSON(w, http.StatusOK, resp)
 }
 
@@ -473,7 +928,7 @@ func (a *API) handleCheckoutLookup(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := a.service.LookupCheckoutByIdempotency(r.Context(), idempotencyKey)
 	if err != nil {
-		writeError(w, http.StatusUnprocessableEntity, err)
+		writeError(w, statusForError(err), err)
 		return
 	}
 	writeJSON(w, http.StatusOK, resp)
@@ -486,11 +941,7 @@ func (a *API) handleHeldCarts(w http.ResponseWriter, r *http.Request) {
 		terminalID := r.URL.Query().Get("terminal_id")
 		resp, err := a.service.ListHeldCarts(r.Context(), storeID, terminalID)
 		if err != nil {
-			status := http.StatusUnprocessableEntity
-			if errors.Is(err, store.ErrInvalidTransaction) {
-				status = http.StatusBadRequest
-			}
-			writeError(w, status, err)
+			writeError(w, statusForError(err), err)
 			return
 		}
 		writeJSON(w, http.StatusOK, resp)
@@ -502,11 +953,7 @@ func (a *API) handleHeldCarts(w http.ResponseWriter, r *http.Request) {
 		}
 		resp, err := a.service.HoldCart(r.Context(), req)
 		if err != nil {
-			status := http.StatusUnprocessableEntity
-			if errors.Is(err, store.ErrInvalidTransaction) {
-				status = http.StatusBadRequest
-			}
-			writeError(w, status, err)
+			writeError(w, statusForError(err), err)
 			return
 		}
 		writeJSON(w, http.StatusOK, resp)
@@ -537,14 +984,7 @@ func (a *API) handleHeldCartActions(w http.ResponseWriter, r *http.Request) {
 		holdID := strings.Trim(strings.TrimSuffix(tail, "/resume"), "/")
 		resp, err := a.service.ResumeHeldCart(r.Context(), holdID)
 		if err != nil {
-			status := http.StatusUnprocessableEntity
-			if errors.Is(err, store.ErrNotFound) {
-				status = http.StatusNotFound
-			}
-			if errors.Is(err, store.ErrInvalidTransaction) {
-				status = http.StatusBadRequest
-			}
-			writeError(w, status, err)
+			writeError(w, statusForError(err), err)
 			return
 		}
 		writeJSON(w, http.StatusOK, resp)
@@ -555,14 +995,7 @@ func (a *API) handleHeldCartActions(w http.ResponseWriter, r *http.Request) {
 		holdID := strings.Trim(strings.TrimSuffix(tail, "/discard"), "/")
 		err := a.service.DiscardHeldCart(r.Context(), holdID)
 		if err != nil {
-			status := http.StatusUnprocessableEntity
-			if errors.Is(err, store.ErrNotFound) {
-				status = http.StatusNotFound
-			}
-			if errors.Is(err, store.ErrInvalidTransaction) {
-				status = http.StatusBadRequest
-			}
-			writeError(w, status, err)
+			writeError(w, statusForError(err), err)
 			return
 		}
 		writeJSON(w, http.StatusOK, map[string]any{"ok": true})
@@ -586,7 +1019,7 @@ func (a *API) handleOfflineSync(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := a.service.SyncOffline(r.Context(), req)
 	if err != nil {
-		writeError(w, http.StatusUnprocessableEntity, err)
+		writeError(w, statusForError(err), err)
 		return
 	}
 
@@ -610,13 +1043,37 @@ func (a *API) handleAttachMetrics(w http.ResponseWriter, r *http.Request) {
 
 	metrics, err := a.service.AttachMetrics(r.Context(), storeID, days)
 	if err != nil {
-		writeError(w, http.StatusUnprocessableEntity, err)
+		writeError(w, statusForError(err), err)
 		return
 	}
+	if strings.EqualFold(strings.TrimSpace(r.URL.Query().Get("breakdown")), "reason") {
+		byReason, err := a.service.AttachMetricsByReason(r.Context(), storeID, days)
+		if err != nil {
+			writeError(w, statusForError(err), err)
+			return
+		}
+		metrics.ByReason = byReason
+	}
 
 	writeJSON(w, http.StatusOK, metrics)
 }
 
+func (a *API) handleShifts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := parsePositiveLimit(query.Get("limit"), 100, 500)
+	resp, err := a.service.ListShifts(r.Context(), strings.TrimSpace(query.Get("store_id")), query.Get("terminal_id"), query.Get("from"), query.Get("to"), limit)
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
 func (a *API) handleShiftOpen(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeMethodNotAllowed(w)
@@ -631,7 +1088,15 @@ func (a *API) handleShiftOpen(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := a.service.OpenShift(r.Context(), req)
 	if err != nil {
-		writeError(w, http.StatusUnprocessableEntity, err)
+		if errors.Is(err, store.ErrShiftAlreadyOpen) {
+			payload := errorPayload(w, http.StatusConflict, store.ErrShiftAlreadyOpen)
+			if active, activeErr := a.service.GetActiveShift(r.Context(), req.StoreID, req.TerminalID); activeErr == nil {
+				payload["shift_id"] = active.Shift.ID
+			}
+			writeJSON(w, http.StatusConflict, payload)
+			return
+		}
+		writeError(w, statusForError(err), err)
 		return
 	}
 	writeJSON(w, http.StatusOK, resp)
@@ -651,11 +1116,7 @@ func (a *API) handleShiftClose(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := a.service.CloseShift(r.Context(), req)
 	if err != nil {
-		status := http.StatusUnprocessableEntity
-		if errors.Is(err, store.ErrNotFound) {
-			status = http.StatusNotFound
-		}
-		writeError(w, status, err)
+		writeError(w, statusForError(err), err)
 		return
 	}
 	writeJSON(w, http.StatusOK, resp)
@@ -671,17 +1132,159 @@ func (a *API) handleShiftActive(w http.ResponseWriter, r *http.Request) {
 	terminalID := r.URL.Query().Get("terminal_id")
 	resp, err := a.service.GetActiveShift(r.Context(), storeID, terminalID)
 	if err != nil {
-		status := http.StatusUnprocessableEntity
-		if errors.Is(err, store.ErrNotFound) {
-			status = http.StatusNotFound
-		}
-		writeError(w, status, err)
+		writeError(w, statusForError(err), err)
 		return
 	}
 	writeJSON(w, http.StatusOK, resp)
 }
 
-func (a *API) handleTransactionActions(w http.ResponseWriter, r *http.Request) {
+func (a *API) handleTerminals(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		resp, err := a.service.ListTerminals(r.Context(), r.URL.Query().Get("store_id"))
+		if err != nil {
+			writeError(w, statusForError(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	case http.MethodPost:
+		var req domain.TerminalRegisterRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		resp, err := a.service.RegisterTerminal(r.Context(), req.StoreID, req.TerminalID, req.Label)
+		if err != nil {
+			writeError(w, statusForError(err), err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, resp)
+	default:
+		writeMethodNotAllowed(w)
+	}
+}
+
+// handleTerminalActions serves POST /api/v1/terminals/{id}/revoke. The store
+// comes from the store_id query parameter, defaulting to the default store.
+func (a *API) handleTerminalActions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	prefix := "/api/v1/terminals/"
+	if !strings.HasPrefix(r.URL.Path, prefix) || !strings.HasSuffix(r.URL.Path, "/revoke") {
+		writeError(w, http.StatusNotFound, errors.New("unknown terminal action"))
+		return
+	}
+	terminalID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, prefix), "/revoke")
+	terminalID = strings.TrimSpace(strings.Trim(terminalID, "/"))
+	if terminalID == "" {
+		writeError(w, http.StatusBadRequest, errors.New("terminal id required"))
+		return
+	}
+
+	terminal, err := a.service.RevokeTerminal(r.Context(), r.URL.Query().Get("store_id"), terminalID)
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"terminal": terminal})
+}
+
+func (a *API) handleShiftActions(w http.ResponseWriter, r *http.Request) {
+	prefix := "/api/v1/shifts/"
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	parts := strings.Split(rest, "/")
+	if !strings.HasPrefix(r.URL.Path, prefix) || len(parts) > 2 {
+		writeError(w, http.StatusNotFound, errors.New("unknown shift action"))
+		return
+	}
+	shiftID := strings.TrimSpace(parts[0])
+	if shiftID == "" {
+		writeError(w, http.StatusBadRequest, errors.New("shift id required"))
+		return
+	}
+	if len(parts) == 1 {
+		a.handleShiftUpdate(w, r, shiftID)
+		return
+	}
+
+	switch parts[1] {
+	case "summary":
+		a.handleShiftSummary(w, r, shiftID)
+	case "cash-movement":
+		a.handleShiftCashMovement(w, r, shiftID)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("unknown shift action"))
+	}
+}
+
+// handleShiftUpdate serves PATCH /api/v1/shifts/{id}, which corrects an open
+// shift's opening float or notes under a manager PIN.
+func (a *API) handleShiftUpdate(w http.ResponseWriter, r *http.Request, shiftID string) {
+	if r.Method != http.MethodPatch {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	var req domain.ShiftUpdateRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !a.pinLimiter.Allow("pin:shift-update:" + clientKey(r)) {
+		writeError(w, http.StatusTooManyRequests, errors.New("too many manager pin attempts"))
+		return
+	}
+	if !a.auth.ValidateManagerPIN(req.ManagerPIN) {
+		writeError(w, http.StatusForbidden, errInvalidManagerPIN)
+		return
+	}
+
+	resp, err := a.service.UpdateShift(r.Context(), shiftID, req)
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *API) handleShiftSummary(w http.ResponseWriter, r *http.Request, shiftID string) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	summary, err := a.service.GetShiftSummary(r.Context(), shiftID)
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"summary": summary})
+}
+
+func (a *API) handleShiftCashMovement(w http.ResponseWriter, r *http.Request, shiftID string) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	var req domain.ShiftCashMovementRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	movement, err := a.service.RecordCashMovement(r.Context(), shiftID, req.Kind, req.AmountCents, req.Note)
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"movement": movement})
+}
+
+func (a *API) handleTransactionActions(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeMethodNotAllowed(w)
 		return
@@ -709,21 +1312,14 @@ func (a *API) handleTransactionActions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if !a.auth.ValidateManagerPIN(req.ManagerPIN) {
-		writeError(w, http.StatusForbidden, errors.New("invalid manager pin"))
+		writeError(w, http.StatusForbidden, errInvalidManagerPIN)
 		return
 	}
 	req.TransactionID = transactionID
 
 	resp, err := a.service.VoidTransaction(r.Context(), req)
 	if err != nil {
-		status := http.StatusUnprocessableEntity
-		if errors.Is(err, store.ErrNotFound) {
-			status = http.StatusNotFound
-		}
-		if errors.Is(err, store.ErrInvalidTransaction) {
-			status = http.StatusConflict
-		}
-		writeError(w, status, err)
+		writeError(w, statusForError(err), err)
 		return
 	}
 	writeJSON(w, http.StatusOK, resp)
@@ -745,20 +1341,13 @@ func (a *API) handleRefunds(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if !a.auth.ValidateManagerPIN(req.ManagerPIN) {
-		writeError(w, http.StatusForbidden, errors.New("invalid manager pin"))
+		writeError(w, http.StatusForbidden, errInvalidManagerPIN)
 		return
 	}
 
 	resp, err := a.service.Refund(r.Context(), req)
 	if err != nil {
-		status := http.StatusUnprocessableEntity
-		if errors.Is(err, store.ErrNotFound) {
-			status = http.StatusNotFound
-		}
-		if errors.Is(err, store.ErrInvalidTransaction) {
-			status = http.StatusBadRequest
-		}
-		writeError(w, status, err)
+		writeError(w, statusForError(err), err)
 		return
 	}
 	writeJSON(w, http.StatusOK, resp)
@@ -780,20 +1369,34 @@ func (a *API) handleItemReturns(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if !a.auth.ValidateManagerPIN(req.ManagerPIN) {
-		writeError(w, http.StatusForbidden, errors.New("invalid manager pin"))
+		writeError(w, http.StatusForbidden, errInvalidManagerPIN)
 		return
 	}
 
 	resp, err := a.service.ProcessItemReturn(r.Context(), req)
 	if err != nil {
-		status := http.StatusUnprocessableEntity
-		if errors.Is(err, store.ErrNotFound) {
-			status = http.StatusNotFound
-		}
-		if errors.Is(err, store.ErrInvalidTransaction) {
-			status = http.StatusBadRequest
-		}
-		writeError(w, status, err)
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *API) handleStockOpnameDetail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	prefix := "/api/v1/stock-opname/"
+	opnameID := strings.TrimSpace(strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/"))
+	if opnameID == "" || strings.Contains(opnameID, "/") {
+		writeError(w, http.StatusBadRequest, errors.New("invalid stock opname path"))
+		return
+	}
+
+	resp, err := a.service.GetStockOpname(r.Context(), opnameID)
+	if err != nil {
+		writeError(w, statusForError(err), err)
 		return
 	}
 	writeJSON(w, http.StatusOK, resp)
@@ -809,11 +1412,7 @@ func (a *API) handleInventoryLots(w http.ResponseWriter, r *http.Request) {
 
 		resp, err := a.service.ListInventoryLots(r.Context(), storeID, sku, includeExpired, limit)
 		if err != nil {
-			status := http.StatusUnprocessableEntity
-			if errors.Is(err, store.ErrInvalidTransaction) {
-				status = http.StatusBadRequest
-			}
-			writeError(w, status, err)
+			writeError(w, statusForError(err), err)
 			return
 		}
 		writeJSON(w, http.StatusOK, resp)
@@ -825,103 +1424,469 @@ func (a *API) handleInventoryLots(w http.ResponseWriter, r *http.Request) {
 		}
 		lot, err := a.service.ReceiveInventoryLot(r.Context(), req)
 		if err != nil {
-			status := http.StatusUnprocessableEntity
-			if errors.Is(err, store.ErrInvalidTransaction) {
-				status = http.StatusBadRequest
-			}
-			if strings.Contains(strings.ToLower(err.Error()), "admin role required") {
-				status = http.StatusForbidden
-			}
-			writeError(w, status, err)
+			writeError(w, statusForError(err), err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]any{"lot": lot})
+	default:
+		writeMethodNotAllowed(w)
+	}
+}
+
+func (a *API) handleInventoryLotBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	var req domain.InventoryLotBatchReceiveRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	lots, err := a.service.ReceiveInventoryLots(r.Context(), req.Lots)
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"lots": lots})
+}
+
+func (a *API) handleInventoryLotActions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	prefix := "/api/v1/inventory/lots/"
+	lotID := strings.TrimSpace(strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/"))
+	if lotID == "" || strings.Contains(lotID, "/") {
+		writeError(w, http.StatusBadRequest, errors.New("invalid inventory lot path"))
+		return
+	}
+
+	var req domain.InventoryLotUpdateRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	actor, _ := service.ActorFromContext(r.Context())
+	lot, err := a.service.UpdateInventoryLot(r.Context(), lotID, req, actor)
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"lot": lot})
+}
+
+func (a *API) handleExpiringLots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	storeID := strings.TrimSpace(r.URL.Query().Get("store_id"))
+	days := parsePositiveLimit(r.URL.Query().Get("days"), 7, 365)
+
+	resp, err := a.service.ListExpiringLots(r.Context(), storeID, days)
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *API) handleInventorySerials(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	query := r.URL.Query()
+	resp, err := a.service.ListSerials(r.Context(), strings.TrimSpace(query.Get("store_id")), query.Get("sku"), query.Get("status"))
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *API) handleStockMovements(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	query := r.URL.Query()
+	resp, err := a.service.ListStockMovements(r.Context(), strings.TrimSpace(query.Get("store_id")), query.Get("sku"), query.Get("from"), query.Get("to"))
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *API) handleStockBulkSet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	var req domain.StockBulkSetRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := a.service.SetStockBulk(r.Context(), req)
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *API) handleStockWriteOff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	var req domain.StockWriteOffRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !a.pinLimiter.Allow("pin:write-off:" + clientKey(r)) {
+		writeError(w, http.StatusTooManyRequests, errors.New("too many manager pin attempts"))
+		return
+	}
+	if !a.auth.ValidateManagerPIN(req.ManagerPIN) {
+		writeError(w, http.StatusForbidden, errInvalidManagerPIN)
+		return
+	}
+
+	actor, _ := service.ActorFromContext(r.Context())
+	writeOff, err := a.service.WriteOffStock(r.Context(), req.StoreID, req.SKU, req.Qty, req.Reason, actor)
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"write_off": writeOff})
+}
+
+// handleDataExport takes the manager PIN from the X-Manager-PIN header since
+// a GET has no body.
+func (a *API) handleDataExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	if !a.pinLimiter.Allow("pin:export:" + clientKey(r)) {
+		writeError(w, http.StatusTooManyRequests, errors.New("too many manager pin attempts"))
+		return
+	}
+	if !a.auth.ValidateManagerPIN(r.Header.Get("X-Manager-PIN")) {
+		writeError(w, http.StatusForbidden, errInvalidManagerPIN)
+		return
+	}
+
+	snapshot, err := a.service.ExportAll(r.Context(), r.URL.Query().Get("store_id"))
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+func (a *API) handleDataImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	var req domain.DataImportRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !a.pinLimiter.Allow("pin:import:" + clientKey(r)) {
+		writeError(w, http.StatusTooManyRequests, errors.New("too many manager pin attempts"))
+		return
+	}
+	if !a.auth.ValidateManagerPIN(req.ManagerPIN) {
+		writeError(w, http.StatusForbidden, errInvalidManagerPIN)
+		return
+	}
+
+	resp, err := a.service.ImportAll(r.Context(), req.Snapshot)
+	if resp.Users > 0 {
+		a.auth.ReloadUsers(r.Context())
+	}
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *API) handleStockTransfer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	var req domain.StockTransferRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	actor, _ := service.ActorFromContext(r.Context())
+	lots, err := a.service.TransferStock(r.Context(), req.FromStoreID, req.ToStoreID, req.SKU, req.Qty, actor)
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"lots": lots})
+}
+
+func (a *API) handleStockOpname(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	var req domain.StockOpnameRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := a.service.StockOpname(r.Context(), req)
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *API) handleAuditLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	storeID := r.URL.Query().Get("store_id")
+	date := r.URL.Query().Get("date")
+	limit := parsePositiveLimit(r.URL.Query().Get("limit"), 100, 500)
+	filter := domain.AuditLogFilter{
+		Actions: strings.Split(r.URL.Query().Get("action"), ","),
+		Actor:   r.URL.Query().Get("actor"),
+	}
+
+	if strings.EqualFold(strings.TrimSpace(r.URL.Query().Get("format")), "csv") {
+		logs, err := a.service.ExportAuditLogs(r.Context(), storeID, date, filter)
+		if err != nil {
+			writeError(w, statusForError(err), err)
+			return
+		}
+		filename := "audit-logs.csv"
+		if date != "" {
+			filename = fmt.Sprintf("audit-logs-%s.csv", date)
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		w.WriteHeader(http.StatusOK)
+		_ = writeAuditLogsCSV(w, logs)
+		return
+	}
+
+	page, err := a.service.ListAuditLogPage(r.Context(), storeID, date, filter, r.URL.Query().Get("before"), limit)
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// writeAuditLogsCSV writes one row per audit entry, newest first.
+func writeAuditLogsCSV(w io.Writer, logs []domain.AuditLog) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"created_at", "id", "store_id", "actor_username", "actor_role", "action", "entity_type", "entity_id", "detail"})
+	for _, entry := range logs {
+		_ = cw.Write([]string{
+			entry.CreatedAt.UTC().Format(time.RFC3339),
+			entry.ID,
+			entry.StoreID,
+			entry.ActorUsername,
+			entry.ActorRole,
+			entry.Action,
+			entry.EntityType,
+			entry.EntityID,
+			entry.Detail,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (a *API) handleDailyReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	storeID := r.URL.Query().Get("store_id")
+	date := r.URL.Query().Get("date")
+	format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format")))
+
+	report, err := a.service.DailyReport(r.Context(), storeID, date)
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"daily-report-%s.csv\"", report.Date))
+		_, _ = w.Write([]byte(reporting.DailyCSV(report)))
+	case "pdf":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(reporting.DailyHTML(report)))
+	case "xlsx":
+		workbook, err := dailyReportToXLSX(report, a.currency)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
-		writeJSON(w, http.StatusCreated, map[string]any{"lot": lot})
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"daily-report-%s.xlsx\"", report.Date))
+		_, _ = w.Write(workbook)
 	default:
-		writeMethodNotAllowed(w)
+		writeJSON(w, http.StatusOK, report)
 	}
 }
 
-func (a *API) handleStockOpname(w http.ResponseWriter, r *http.Request) {
+func (a *API) handleDailyReportSend(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeMethodNotAllowed(w)
 		return
 	}
-
-	var req domain.StockOpnameRequest
-	if err := decodeJSON(r, &req); err != nil {
-		writeError(w, http.StatusBadRequest, err)
+	if a.endOfDay == nil {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("end-of-day reporter not configured"))
 		return
 	}
 
-	resp, err := a.service.StockOpname(r.Context(), req)
+	date := r.URL.Query().Get("date")
+	sent, err := a.endOfDay.Send(r.Context(), date)
 	if err != nil {
-		status := http.StatusUnprocessableEntity
-		if errors.Is(err, store.ErrInvalidTransaction) {
+		status := http.StatusBadGateway
+		switch {
+		case errors.Is(err, reporting.ErrNoRecipients):
+			status = http.StatusUnprocessableEntity
+		case errors.Is(err, store.ErrInvalidTransaction):
 			status = http.StatusBadRequest
 		}
-		if strings.Contains(strings.ToLower(err.Error()), "admin role required") {
-			status = http.StatusForbidden
-		}
-		writeError(w, status, err)
+		log.Printf("manual end-of-day report send: %v", err)
+		payload := errorPayload(w, status, err)
+		payload["sent"] = sent
+		writeJSON(w, status, payload)
 		return
 	}
+	writeJSON(w, http.StatusOK, map[string]any{"sent": sent})
+}
 
-	writeJSON(w, http.StatusOK, resp)
+func (a *API) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, domain.JobListResponse{Jobs: a.jobs.List()})
 }
 
-func (a *API) handleAuditLogs(w http.ResponseWriter, r *http.Request) {
+func (a *API) handleClientConfig(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		writeMethodNotAllowed(w)
 		return
 	}
+	storeID, err := a.service.ResolveStoreID(strings.TrimSpace(r.URL.Query().Get("store_id")))
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	methods, err := a.service.PaymentMethods(storeID)
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, domain.ClientConfigResponse{
+		StoreID:        storeID,
+		Currency:       a.currency,
+		PaymentMethods: methods,
+	})
+}
 
-	storeID := r.URL.Query().Get("store_id")
-	date := r.URL.Query().Get("date")
-	limit := parsePositiveLimit(r.URL.Query().Get("limit"), 100, 500)
+func (a *API) handleHourlySales(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
 
-	logs, err := a.service.ListAuditLogs(r.Context(), storeID, date, limit)
+	report, err := a.service.GetHourlySales(r.Context(), r.URL.Query().Get("store_id"), r.URL.Query().Get("date"))
 	if err != nil {
-		status := http.StatusUnprocessableEntity
-		if errors.Is(err, store.ErrInvalidTransaction) {
-			status = http.StatusBadRequest
-		}
-		writeError(w, status, err)
+		writeError(w, statusForError(err), err)
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]any{"logs": logs})
+	writeJSON(w, http.StatusOK, report)
 }
 
-func (a *API) handleDailyReport(w http.ResponseWriter, r *http.Request) {
+func (a *API) handleRangeReport(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		writeMethodNotAllowed(w)
 		return
 	}
 
-	storeID := r.URL.Query().Get("store_id")
-	date := r.URL.Query().Get("date")
-	format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format")))
+	query := r.URL.Query()
+	report, err := a.service.RangeReport(r.Context(), query.Get("store_id"), query.Get("from"), query.Get("to"), query.Get("group_by"))
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
 
-	report, err := a.service.DailyReport(r.Context(), storeID, date)
+func (a *API) handleSupplierSalesReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	query := r.URL.Query()
+	report, err := a.service.SalesBySupplier(r.Context(), query.Get("store_id"), query.Get("from"), query.Get("to"))
 	if err != nil {
-		status := http.StatusUnprocessableEntity
-		if errors.Is(err, store.ErrInvalidTransaction) {
-			status = http.StatusBadRequest
-		}
-		writeError(w, status, err)
+		writeError(w, statusForError(err), err)
 		return
 	}
+	writeJSON(w, http.StatusOK, report)
+}
 
-	switch format {
-	case "csv":
-		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
-		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"daily-report-%s.csv\"", report.Date))
-		_, _ = w.Write([]byte(dailyReportToCSV(report)))
-	case "pdf":
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		_, _ = w.Write([]byte(dailyReportToPrintableHTML(report)))
-	default:
-		writeJSON(w, http.StatusOK, report)
+func (a *API) handleInventoryValuation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
 	}
+
+	storeID := strings.TrimSpace(r.URL.Query().Get("store_id"))
+	report, err := a.service.GetInventoryValuation(r.Context(), storeID)
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
 }
 
 func (a *API) handleReorderSuggestions(w http.ResponseWriter, r *http.Request) {
@@ -933,11 +1898,7 @@ func (a *API) handleReorderSuggestions(w http.ResponseWriter, r *http.Request) {
 	storeID := r.URL.Query().Get("store_id")
 	resp, err := a.service.ReorderSuggestions(r.Context(), storeID)
 	if err != nil {
-		status := http.StatusUnprocessableEntity
-		if errors.Is(err, store.ErrInvalidTransaction) {
-			status = http.StatusBadRequest
-		}
-		writeError(w, status, err)
+		writeError(w, statusForError(err), err)
 		return
 	}
 	writeJSON(w, http.StatusOK, resp)
@@ -953,11 +1914,7 @@ func (a *API) handleAnomalyAlerts(w http.ResponseWriter, r *http.Request) {
 	date := r.URL.Query().Get("date")
 	resp, err := a.service.DetectOperationalAnomalies(r.Context(), storeID, date)
 	if err != nil {
-		status := http.StatusUnprocessableEntity
-		if errors.Is(err, store.ErrInvalidTransaction) {
-			status = http.StatusBadRequest
-		}
-		writeError(w, status, err)
+		writeError(w, statusForError(err), err)
 		return
 	}
 	writeJSON(w, http.StatusOK, resp)
@@ -968,7 +1925,7 @@ func (a *API) handlePromos(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		promos, err := a.service.ListPromos(r.Context())
 		if err != nil {
-			writeError(w, http.StatusUnprocessableEntity, err)
+			writeError(w, statusForError(err), err)
 			return
 		}
 		writeJSON(w, http.StatusOK, map[string]any{"promos": promos})
@@ -979,16 +1936,16 @@ func (a *API) handlePromos(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		promo, err := a.service.CreatePromo(r.Context(), req)
+		promo, created, err := a.service.CreatePromo(r.Context(), req)
 		if err != nil {
-			status := http.StatusUnprocessableEntity
-			if errors.Is(err, store.ErrInvalidTransaction) {
-				status = http.StatusBadRequest
-			}
-			if strings.Contains(strings.ToLower(err.Error()), "admin role required") {
-				status = http.StatusForbidden
-			}
-			writeError(w, status, err)
+			writeError(w, statusForError(err), err)
+			return
+		}
+		// Creating a promo whose name an active promo already has returns
+		// that promo, like a replayed checkout.
+		if !created {
+			w.Header().Set("X-Idempotent-Replay", "true")
+			writeJSON(w, http.StatusOK, map[string]any{"promo": promo})
 			return
 		}
 		writeJSON(w, http.StatusCreated, map[string]any{"promo": promo})
@@ -998,12 +1955,26 @@ func (a *API) handlePromos(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *API) handlePromoActions(w http.ResponseWriter, r *http.Request) {
+	prefix := "/api/v1/promos/"
+	if r.Method == http.MethodGet {
+		promoID := strings.TrimSpace(strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/"))
+		if promoID == "" || strings.Contains(promoID, "/") {
+			writeError(w, http.StatusBadRequest, errors.New("invalid promo path"))
+			return
+		}
+		promo, err := a.service.GetPromo(r.Context(), promoID)
+		if err != nil {
+			writeError(w, statusForError(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"promo": promo})
+		return
+	}
 	if r.Method != http.MethodPost {
 		writeMethodNotAllowed(w)
 		return
 	}
 
-	prefix := "/api/v1/promos/"
 	if !strings.HasPrefix(r.URL.Path, prefix) || !strings.HasSuffix(r.URL.Path, "/toggle") {
 		writeError(w, http.StatusBadRequest, errors.New("invalid promo action path"))
 		return
@@ -1023,14 +1994,7 @@ func (a *API) handlePromoActions(w http.ResponseWriter, r *http.Request) {
 
 	promo, err := a.service.SetPromoActive(r.Context(), promoID, req.Active)
 	if err != nil {
-		status := http.StatusUnprocessableEntity
-		if errors.Is(err, store.ErrNotFound) {
-			status = http.StatusNotFound
-		}
-		if strings.Contains(strings.ToLower(err.Error()), "admin role required") {
-			status = http.StatusForbidden
-		}
-		writeError(w, status, err)
+		writeError(w, statusForError(err), err)
 		return
 	}
 
@@ -1047,21 +2011,14 @@ func (a *API) handleSuppliers(w http.ResponseWriter, r *http.Request) {
 		}
 		supplier, err := a.service.CreateSupplier(r.Context(), req)
 		if err != nil {
-			status := http.StatusUnprocessableEntity
-			if errors.Is(err, store.ErrInvalidTransaction) {
-				status = http.StatusBadRequest
-			}
-			if strings.Contains(strings.ToLower(err.Error()), "admin role required") {
-				status = http.StatusForbidden
-			}
-			writeError(w, status, err)
+			writeError(w, statusForError(err), err)
 			return
 		}
 		writeJSON(w, http.StatusOK, map[string]any{"supplier": supplier})
 	case http.MethodGet:
 		suppliers, err := a.service.ListSuppliers(r.Context())
 		if err != nil {
-			writeError(w, http.StatusUnprocessableEntity, err)
+			writeError(w, statusForError(err), err)
 			return
 		}
 		writeJSON(w, http.StatusOK, map[string]any{"suppliers": suppliers})
@@ -1070,13 +2027,73 @@ func (a *API) handleSuppliers(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleSupplierActions serves PATCH /api/v1/suppliers/{id} and
+// GET/POST /api/v1/suppliers/{id}/products.
+func (a *API) handleSupplierActions(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/suppliers/"), "/")
+	supplierID, action, _ := strings.Cut(rest, "/")
+	supplierID = strings.TrimSpace(supplierID)
+	if supplierID == "" {
+		writeError(w, http.StatusBadRequest, errors.New("supplier id required"))
+		return
+	}
+
+	writeSupplierError := func(err error) {
+		writeError(w, statusForError(err), err)
+	}
+
+	switch action {
+	case "":
+		if r.Method != http.MethodPatch {
+			writeMethodNotAllowed(w)
+			return
+		}
+		var req domain.SupplierUpdateRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		supplier, err := a.service.UpdateSupplier(r.Context(), supplierID, req)
+		if err != nil {
+			writeSupplierError(err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"supplier": supplier})
+	case "products":
+		switch r.Method {
+		case http.MethodGet:
+			resp, err := a.service.ListSupplierProducts(r.Context(), supplierID)
+			if err != nil {
+				writeSupplierError(err)
+				return
+			}
+			writeJSON(w, http.StatusOK, resp)
+		case http.MethodPost:
+			var req domain.SupplierProductSetRequest
+			if err := decodeJSON(r, &req); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			product, err := a.service.SetSupplierProduct(r.Context(), supplierID, req)
+			if err != nil {
+				writeSupplierError(err)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"product": product})
+		default:
+			writeMethodNotAllowed(w)
+		}
+	default:
+		writeError(w, http.StatusNotFound, errors.New("unknown supplier action"))
+	}
+}
+
 func (a *API) handlePurchaseOrders(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		status := r.URL.Query().Get("status")
-		resp, err := a.service.ListPurchaseOrders(r.Context(), status)
+		resp, err := a.service.ListPurchaseOrders(r.Context(), r.URL.Query().Get("store_id"), r.URL.Query().Get("status"))
 		if err != nil {
-			writeError(w, http.StatusUnprocessableEntity, err)
+			writeError(w, statusForError(err), err)
 			return
 		}
 		writeJSON(w, http.StatusOK, resp)
@@ -1089,14 +2106,7 @@ func (a *API) handlePurchaseOrders(w http.ResponseWriter, r *http.Request) {
 
 		resp, err := a.service.CreatePurchaseOrder(r.Context(), req)
 		if err != nil {
-			status := http.StatusUnprocessableEntity
-			if errors.Is(err, store.ErrNotFound) {
-				status = http.StatusNotFound
-			}
-			if errors.Is(err, store.ErrInvalidTransaction) {
-				status = http.StatusBadRequest
-			}
-			writeError(w, status, err)
+			writeError(w, statusForError(err), err)
 			return
 		}
 
@@ -1106,6 +2116,27 @@ func (a *API) handlePurchaseOrders(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (a *API) handlePurchaseOrdersFromReorder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	var req domain.PurchaseOrdersFromReorderRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := a.service.CreatePurchaseOrdersFromReorder(r.Context(), req)
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
 func (a *API) handlePurchaseOrderActions(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeMethodNotAllowed(w)
@@ -1113,40 +2144,73 @@ func (a *API) handlePurchaseOrderActions(w http.ResponseWriter, r *http.Request)
 	}
 
 	prefix := "/api/v1/purchase-orders/"
-	if !strings.HasPrefix(r.URL.Path, prefix) || !strings.HasSuffix(r.URL.Path, "/receive") {
+	action := ""
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/receive"):
+		action = "receive"
+	case strings.HasSuffix(r.URL.Path, "/cancel"):
+		action = "cancel"
+	}
+	if !strings.HasPrefix(r.URL.Path, prefix) || action == "" {
 		writeError(w, http.StatusBadRequest, errors.New("invalid purchase order action path"))
 		return
 	}
-	purchaseOrderID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, prefix), "/receive")
+	purchaseOrderID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, prefix), "/"+action)
 	purchaseOrderID = strings.TrimSpace(strings.Trim(purchaseOrderID, "/"))
 	if purchaseOrderID == "" {
 		writeError(w, http.StatusBadRequest, errors.New("purchase order id required"))
 		return
 	}
 
-	var req domain.PurchaseOrderReceiveRequest
+	var resp domain.PurchaseOrderResponse
+	var err error
+	if action == "cancel" {
+		var req domain.PurchaseOrderCancelRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		resp, err = a.service.CancelPurchaseOrder(r.Context(), purchaseOrderID, req)
+	} else {
+		var req domain.PurchaseOrderReceiveRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		resp, err = a.service.ReceivePurchaseOrder(r.Context(), purchaseOrderID, req)
+	}
+	if err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *API) handleHardwareReceiptEscpos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	var req domain.HardwareReceiptRequest
 	if err := decodeJSON(r, &req); err != nil {
 		writeError(w, http.StatusBadRequest, err)
 		return
 	}
+	if req.Language == "" {
+		req.Language = localizerFor(w).Language()
+	}
 
-	resp, err := a.service.ReceivePurchaseOrder(r.Context(), purchaseOrderID, req)
+	resp, err := a.service.BuildHardwareReceipt(r.Context(), req)
 	if err != nil {
-		status := http.StatusUnprocessableEntity
-		if errors.Is(err, store.ErrNotFound) {
-			status = http.StatusNotFound
-		}
-		if errors.Is(err, store.ErrInvalidTransaction) {
-			status = http.StatusConflict
-		}
-		writeError(w, status, err)
+		writeError(w, statusForError(err), err)
 		return
 	}
-
 	writeJSON(w, http.StatusOK, resp)
 }
 
-func (a *API) handleHardwareReceiptEscpos(w http.ResponseWriter, r *http.Request) {
+func (a *API) handleKitchenTicket(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeMethodNotAllowed(w)
 		return
@@ -1158,16 +2222,9 @@ func (a *API) handleHardwareReceiptEscpos(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	resp, err := a.service.BuildHardwareReceipt(r.Context(), req)
+	resp, err := a.service.BuildKitchenTicket(r.Context(), req)
 	if err != nil {
-		status := http.StatusUnprocessableEntity
-		if errors.Is(err, store.ErrNotFound) {
-			status = http.StatusNotFound
-		}
-		if errors.Is(err, store.ErrInvalidTransaction) {
-			status = http.StatusBadRequest
-		}
-		writeError(w, status, err)
+		writeError(w, statusForError(err), err)
 		return
 	}
 	writeJSON(w, http.StatusOK, resp)
@@ -1187,11 +2244,7 @@ func (a *API) handleCashDrawerOpen(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := a.service.OpenCashDrawer(r.Context(), req)
 	if err != nil {
-		status := http.StatusUnprocessableEntity
-		if errors.Is(err, store.ErrInvalidTransaction) {
-			status = http.StatusBadRequest
-		}
-		writeError(w, status, err)
+		writeError(w, statusForError(err), err)
 		return
 	}
 	writeJSON(w, http.StatusOK, resp)
@@ -1211,12 +2264,38 @@ func (a *API) handleRetrain(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := a.service.RetrainAssociations(r.Context(), req)
 	if err != nil {
-		writeError(w, http.StatusUnprocessableEntity, err)
+		writeError(w, statusForError(err), err)
 		return
 	}
 	writeJSON(w, http.StatusOK, resp)
 }
 
+func (a *API) handleAssociationPairs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var req domain.AssociationPairRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		pair, err := a.service.UpsertAssociationPair(r.Context(), req)
+		if err != nil {
+			writeError(w, statusForError(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"pair": pair})
+	case http.MethodDelete:
+		query := r.URL.Query()
+		if err := a.service.DeleteAssociationPair(r.Context(), query.Get("source_sku"), query.Get("target_sku")); err != nil {
+			writeError(w, statusForError(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"deleted": true})
+	default:
+		writeMethodNotAllowed(w)
+	}
+}
+
 func (a *API) handleCashiers(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -1231,7 +2310,7 @@ func (a *API) handleCashiers(w http.ResponseWriter, r *http.Request) {
 
 		cashier, err := a.auth.CreateCashier(req)
 		if err != nil {
-			writeError(w, http.StatusBadRequest, err)
+			writeError(w, statusForError(err), err)
 			return
 		}
 
@@ -1241,26 +2320,110 @@ func (a *API) handleCashiers(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleUserActions updates a user's active flag and/or role via
+// PATCH /api/v1/users/{username} and resets their password via
+// POST /api/v1/users/{username}/reset-password. Each change is audited.
+func (a *API) handleUserActions(w http.ResponseWriter, r *http.Request) {
+	tail := strings.TrimSpace(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/users/"), "/"))
+	if strings.HasSuffix(tail, "/reset-password") {
+		a.handleUserPasswordReset(w, r, strings.TrimSuffix(tail, "/reset-password"))
+		return
+	}
+
+	if r.Method != http.MethodPatch {
+		writeMethodNotAllowed(w)
+		return
+	}
+	username := tail
+	if username == "" || strings.Contains(username, "/") {
+		writeError(w, http.StatusBadRequest, errors.New("username required"))
+		return
+	}
+
+	var req domain.UserUpdateRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Active == nil && req.Role == nil {
+		writeError(w, http.StatusBadRequest, errors.New("active or role is required"))
+		return
+	}
+
+	var (
+		user domain.CashierUser
+		err  error
+	)
+	if req.Role != nil {
+		if user, err = a.auth.SetUserRole(r.Context(), username, *req.Role); err != nil {
+			writeError(w, statusForError(err), err)
+			return
+		}
+		a.service.RecordUserChange(r.Context(), "user_role_change", user.Username, fmt.Sprintf("role=%s", user.Role))
+	}
+	if req.Active != nil {
+		if user, err = a.auth.SetUserActive(r.Context(), username, *req.Active); err != nil {
+			writeError(w, statusForError(err), err)
+			return
+		}
+		action := "user_deactivate"
+		if user.Active {
+			action = "user_activate"
+		}
+		a.service.RecordUserChange(r.Context(), action, user.Username, fmt.Sprintf("active=%t", user.Active))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"user": user})
+}
+
+func (a *API) handleUserPasswordReset(w http.ResponseWriter, r *http.Request, username string) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+	if username == "" || strings.Contains(username, "/") {
+		writeError(w, http.StatusBadRequest, errors.New("username required"))
+		return
+	}
+
+	var req domain.ResetPasswordRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := a.auth.ResetPassword(r.Context(), username, req.NewPassword); err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+	a.service.RecordUserChange(r.Context(), "password_reset", strings.ToLower(username), "")
+	writeJSON(w, http.StatusOK, map[string]any{"password_reset": true})
+}
+
 func (a *API) withMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w = &localizedWriter{ResponseWriter: w, localizer: i18n.Negotiate(r.Header.Get("Accept-Language"), a.service.DefaultLanguage())}
 		w.Header().Set("X-Content-Type-Options", "nosniff")
 		w.Header().Set("X-Frame-Options", "DENY")
 		w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
 		w.Header().Set("Cross-Origin-Opener-Policy", "same-origin")
 		w.Header().Set("Access-Control-Allow-Origin", a.allowedOrigin)
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
-		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PATCH,OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token, X-Manager-PIN, X-Terminal-ID, X-Terminal-Token")
+		w.Header().Set("Access-Control-Expose-Headers", "Retry-After, X-Idempotent-Replay")
 		w.Header().Set("Vary", "Origin")
 
 		if (r.Method == http.MethodPost || r.Method == http.MethodPatch || r.Method == http.MethodPut) && strings.Contains(strings.ToLower(r.Header.Get("Content-Type")), "application/json") {
-			r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
-		}
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
+			limit := a.maxRequestBytes(r.URL.Path)
+			// A declared length over the limit is refused before reading;
+			// chunked bodies are cut off by MaxBytesReader and reported as
+			// 413 by writeError.
+			if r.ContentLength > limit {
+				writeError(w, http.StatusRequestEntityTooLarge, &http.MaxBytesError{Limit: limit})
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
 		}
 
+		r = a.authenticate(r)
 		// Enforce CSRF protection for all state-changing requests.
 		if !a.checkCSRF(w, r) {
 			return
@@ -1272,73 +2435,6 @@ func (a *API) withMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func dailyReportToCSV(report domain.DailyReport) string {
-	lines := []string{
-		"section,key,value",
-		fmt.Sprintf("summary,date,%s", report.Date),
-		fmt.Sprintf("summary,store_id,%s", report.StoreID),
-		fmt.Sprintf("summary,transactions,%d", report.Transactions),
-		fmt.Sprintf("summary,gross_sales_cents,%d", report.GrossSalesCents),
-		fmt.Sprintf("summary,discount_cents,%d", report.DiscountCents),
-		fmt.Sprintf("summary,tax_cents,%d", report.TaxCents),
-		fmt.Sprintf("summary,net_sales_cents,%d", report.NetSalesCents),
-		fmt.Sprintf("summary,estimated_margin_cents,%d", report.EstimatedMarginCents),
-	}
-	for _, payment := range report.ByPayment {
-		lines = append(lines, fmt.Sprintf("payment,%s_transactions,%d", payment.PaymentMethod, payment.Transactions))
-		lines = append(lines, fmt.Sprintf("payment,%s_total_cents,%d", payment.PaymentMethod, payment.TotalCents))
-	}
-	for _, terminal := range report.ByTerminal {
-		lines = append(lines, fmt.Sprintf("terminal,%s_transactions,%d", terminal.TerminalID, terminal.Transactions))
-		lines = append(lines, fmt.Sprintf("terminal,%s_total_cents,%d", terminal.TerminalID, terminal.TotalCents))
-	}
-	return strings.Join(lines, "\n") + "\n"
-}
-
-// dailyReportHTMLTmpl is the html/template used to render printable daily reports.
-// All user-controlled fields are auto-escaped by html/template to prevent XSS.
-var dailyReportHTMLTmpl = template.Must(template.New("daily-report").Parse(`<!doctype html>
-<html>
-<head>
-  <meta charset="utf-8" />
-  <title>Daily Report {{.Date}}</title>
-  <style>
-    body { font-family: sans-serif; margin: 24px; }
-    table { width: 100%; border-collapse: collapse; margin-top: 8px; }
-    th, td { border: 1px solid #ddd; padding: 6px; font-size: 13px; }
-    h2, h3 { margin-bottom: 4px; }
-  </style>
-</head>
-<body>
-  <h2>Daily Report {{.Date}}</h2>
-  <p>Store: {{.StoreID}}</p>
-  <p>Transactions: {{.Transactions}}</p>
-  <p>Gross: {{.GrossSalesCents}} | Discount: {{.DiscountCents}} | Tax: {{.TaxCents}} | Net: {{.NetSalesCents}} | Margin: {{.EstimatedMarginCents}}</p>
-
-  <h3>By Payment</h3>
-  <table>
-    <thead><tr><th>Payment</th><th>Transactions</th><th>Total Cents</th></tr></thead>
-    <tbody>{{range .ByPayment}}<tr><td>{{.PaymentMethod}}</td><td style="text-align:right;">{{.Transactions}}</td><td style="text-align:right;">{{.TotalCents}}</td></tr>{{end}}</tbody>
-  </table>
-
-  <h3>By Terminal</h3>
-  <table>
-    <thead><tr><th>Terminal</th><th>Transactions</th><th>Total Cents</th></tr></thead>
-    <tbody>{{range .ByTerminal}}<tr><td>{{.TerminalID}}</td><td style="text-align:right;">{{.Transactions}}</td><td style="text-align:right;">{{.TotalCents}}</td></tr>{{end}}</tbody>
-  </table>
-</body>
-</html>
-`))
-
-func dailyReportToPrintableHTML(report domain.DailyReport) string {
-	var buf bytes.Buffer
-	if err := dailyReportHTMLTmpl.Execute(&buf, report); err != nil {
-		// Fallback: return a plain-text error page rather than leaking internal details.
-		return "<!doctype html><html><body><p>Report rendering error.</p></body></html>"
-	}
-	return buf.String()
-}
-
 func decodeJSON(r *http.Request, dest any) error {
 	decoder := json.NewDecoder(r.Body)
 	decoder.DisallowUnknownFields()
@@ -1363,6 +2459,9 @@ func parsePositiveLimit(raw string, fallback int, max int) int {
 }
 
 func writeMethodNotAllowed(w http.ResponseWriter) {
+	if localized, ok := w.(*localizedWriter); ok && localized.allow != "" {
+		w.Header().Set("Allow", localized.allow)
+	}
 	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
 }
 
@@ -1370,14 +2469,27 @@ func writeError(w http.ResponseWriter, status int, err error) {
 	// For 5xx responses, return a generic message to avoid leaking internal
 	// implementation details (stack traces, SQL errors, file paths, etc.).
 	// 4xx responses are user-facing so we return the original error message.
-	msg := err.Error()
+	// Writes refused in read-only mode are always a 503 the client can retry.
+	// Every body also carries a stable code and a localized message, see
+	// errorPayload.
+	if errors.Is(err, store.ErrServiceReadOnly) {
+		w.Header().Set("Retry-After", "30")
+		writeJSON(w, http.StatusServiceUnavailable, errorPayload(w, http.StatusServiceUnavailable, err))
+		return
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		payload := errorPayload(w, http.StatusRequestEntityTooLarge, err)
+		payload["error"] = fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit)
+		writeJSON(w, http.StatusRequestEntityTooLarge, payload)
+		return
+	}
+	payload := errorPayload(w, status, err)
 	if status >= 500 {
 		log.Printf("internal error (status %d): %v", status, err)
-		msg = "internal server error"
+		payload["error"] = "internal server error"
 	}
-	writeJSON(w, status, map[string]any{
-		"error": msg,
-	})
+	writeJSON(w, status, payload)
 }
 
 func writeJSON(w http.ResponseWriter, status int, payload any) {
@@ -0,0 +1,150 @@
+package httpapi
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"kasirinaja/backend/internal/service"
+)
+
+// tokenBucketSweepInterval is how often idle buckets are dropped.
+const tokenBucketSweepInterval = time.Minute
+
+// tokenBucketLimiter rate-limits requests per key. Each key's bucket holds up
+// to burst tokens and refills at rate tokens per second; a request takes one.
+// Unlike attemptLimiter's fixed window it lets a steady client through while
+// smoothing out bursts.
+type tokenBucketLimiter struct {
+	mu       sync.Mutex
+	rate     float64
+	burst    float64
+	now      func() time.Time
+	buckets  map[string]*tokenBucket
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newTokenBucketLimiter(rate float64, burst int) *tokenBucketLimiter {
+	return &tokenBucketLimiter{
+		rate:    rate,
+		burst:   float64(max(burst, 1)),
+		now:     time.Now,
+		buckets: make(map[string]*tokenBucket),
+		stop:    make(chan struct{}),
+	}
+}
+
+// Allow takes a token from key's bucket. When the bucket is empty it reports
+// how long until the next token.
+func (l *tokenBucketLimiter) Allow(key string) (bool, time.Duration) {
+	if l == nil || l.rate <= 0 {
+		return true, 0
+	}
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[key] = bucket
+	}
+	if elapsed := now.Sub(bucket.updated).Seconds(); elapsed > 0 {
+		bucket.tokens = math.Min(l.burst, bucket.tokens+elapsed*l.rate)
+		bucket.updated = now
+	}
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// sweep deletes buckets that have refilled to burst. A full bucket behaves
+// exactly like a missing one, so dropping it only frees memory; without this
+// every key ever seen would stay in the map.
+func (l *tokenBucketLimiter) sweep() {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// runJanitor sweeps every tokenBucketSweepInterval until Stop is called.
+func (l *tokenBucketLimiter) runJanitor() {
+	ticker := time.NewTicker(tokenBucketSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.sweep()
+		}
+	}
+}
+
+// Stop ends the janitor goroutine. It is safe to call more than once.
+func (l *tokenBucketLimiter) Stop() {
+	if l == nil {
+		return
+	}
+	l.stopOnce.Do(func() { close(l.stop) })
+}
+
+// SetRateLimit limits a named route to perSecond requests per user with
+// bursts of up to burst. A perSecond of zero removes the limit. Routes are
+// "recommendation", "checkout" and "checkout_quote".
+func (a *API) SetRateLimit(route string, perSecond float64, burst int) {
+	if a.rateLimits == nil {
+		a.rateLimits = map[string]*tokenBucketLimiter{}
+	}
+	a.rateLimits[route].Stop()
+	if perSecond <= 0 {
+		delete(a.rateLimits, route)
+		return
+	}
+	limiter := newTokenBucketLimiter(perSecond, burst)
+	go limiter.runJanitor()
+	a.rateLimits[route] = limiter
+}
+
+// rateLimited applies route's limit to next, keyed by rateLimitKey. Rejected
+// requests get 429 with Retry-After in whole seconds.
+func (a *API) rateLimited(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := a.rateLimits[route].Allow(rateLimitKey(r)); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(max(int(math.Ceil(wait.Seconds())), 1)))
+			writeError(w, http.StatusTooManyRequests, errors.New("too many requests, slow down"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// rateLimitKey keys a request on its authenticated user, or on the client
+// address when there is none. The X-Terminal-ID header is not trusted here:
+// a client could send a fresh value on every request to get a fresh bucket.
+func rateLimitKey(r *http.Request) string {
+	if actor, ok := service.ActorFromContext(r.Context()); ok && actor.Username != "" {
+		return "user:" + actor.Username
+	}
+	return clientKey(r)
+}
@@ -0,0 +1,59 @@
+package httpapi
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// routeTable registers handlers on a ServeMux together with the methods each
+// one serves, so preflights and 405s can tell the client what a route takes
+// instead of advertising one fixed list for the whole API.
+type routeTable struct {
+	mux *http.ServeMux
+}
+
+func newRouteTable() *routeTable {
+	return &routeTable{mux: http.NewServeMux()}
+}
+
+// handle registers handler for pattern. For a prefix pattern, methods is
+// every method served under it; handlers still reject methods a particular
+// sub-path does not take, and their 405 carries the same Allow list.
+func (t *routeTable) handle(pattern string, handler http.HandlerFunc, methods ...string) {
+	t.mux.HandleFunc(pattern, allowMethods(handler, methods))
+}
+
+// allowMethods answers OPTIONS with the route's methods, serves HEAD as a
+// GET without a body, and rejects any other method outside methods with 405
+// before the request reaches authentication.
+func allowMethods(next http.HandlerFunc, methods []string) http.HandlerFunc {
+	allowed := slices.Clone(methods)
+	if slices.Contains(allowed, http.MethodGet) {
+		allowed = append(allowed, http.MethodHead)
+	}
+	allowed = append(allowed, http.MethodOptions)
+	allow := strings.Join(allowed, ", ")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if localized, ok := w.(*localizedWriter); ok {
+			localized.allow = allow
+		}
+		switch {
+		case r.Method == http.MethodOptions:
+			w.Header().Set("Allow", allow)
+			w.Header().Set("Access-Control-Allow-Methods", allow)
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodHead && slices.Contains(allowed, http.MethodHead):
+			// The server drops the body of a HEAD response, so the GET
+			// handler can run unchanged.
+			get := r.WithContext(r.Context())
+			get.Method = http.MethodGet
+			next(w, get)
+		case !slices.Contains(allowed, r.Method):
+			writeMethodNotAllowed(w)
+		default:
+			next(w, r)
+		}
+	}
+}
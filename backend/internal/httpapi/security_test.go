@@ -2,12 +2,15 @@ package httpapi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"kasirinaja/backend/internal/domain"
 )
@@ -30,6 +33,62 @@ func TestMiddlewareSetsSecurityHeaders(t *testing.T) {
 	}
 }
 
+func TestPreflightAdvertisesRouteMethods(t *testing.T) {
+	api := newTestAPI(t)
+	cases := []struct {
+		path string
+		want string
+	}{
+		{"/api/v1/audit-logs", "GET, HEAD, OPTIONS"},
+		{"/api/v1/checkout", "POST, OPTIONS"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodOptions, tc.path, nil)
+		req.Header.Set("Origin", "http://localhost:3000")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		res := httptest.NewRecorder()
+
+		api.Handler().ServeHTTP(res, req)
+
+		if res.Code != http.StatusNoContent {
+			t.Fatalf("%s: expected preflight 204, got %d", tc.path, res.Code)
+		}
+		if got := res.Header().Get("Access-Control-Allow-Methods"); got != tc.want {
+			t.Fatalf("%s: expected Access-Control-Allow-Methods %q, got %q", tc.path, tc.want, got)
+		}
+		if got := res.Header().Get("Allow"); got != tc.want {
+			t.Fatalf("%s: expected Allow %q, got %q", tc.path, tc.want, got)
+		}
+	}
+}
+
+func TestMethodNotAllowedSetsAllowHeader(t *testing.T) {
+	api := newTestAPI(t)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/checkout", nil)
+	res := httptest.NewRecorder()
+
+	api.Handler().ServeHTTP(res, req)
+
+	if res.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 before authentication, got %d", res.Code)
+	}
+	if got := res.Header().Get("Allow"); got != "POST, OPTIONS" {
+		t.Fatalf("expected Allow \"POST, OPTIONS\", got %q", got)
+	}
+}
+
+func TestHeadServedAsGet(t *testing.T) {
+	api := newTestAPI(t)
+	req := httptest.NewRequest(http.MethodHead, "/healthz", nil)
+	res := httptest.NewRecorder()
+
+	api.Handler().ServeHTTP(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected HEAD /healthz to succeed, got %d", res.Code)
+	}
+}
+
 func TestLoginRateLimitReturns429(t *testing.T) {
 	api := newTestAPI(t)
 	body, _ := json.Marshal(domain.LoginRequest{Username: "admin", Password: "wrong-pass"})
@@ -62,15 +121,51 @@ func TestJSONBodyTooLargeRejected(t *testing.T) {
 
 	api.Handler().ServeHTTP(res, req)
 
-	if res.Code != http.StatusBadRequest {
-		t.Fatalf("expected 400 for too large body, got %d", res.Code)
+	if res.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for too large body, got %d", res.Code)
+	}
+}
+
+func TestJSONBodyLimitIsConfigurablePerRoute(t *testing.T) {
+	api := newTestAPI(t)
+	if err := api.SetMaxRequestBytes(0); err == nil {
+		t.Fatal("expected a zero limit to be rejected")
+	}
+	token := loginAsAdmin(t, api)
+	csrf := fetchCSRFToken(t, api, token)
+	if err := api.SetMaxRequestBytes(64); err != nil {
+		t.Fatalf("set limit: %v", err)
+	}
+	body := fmt.Sprintf(`{"envelopes":[],"padding":"%s"}`, strings.Repeat("a", 128))
+
+	post := func(path string, reader io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, reader)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("X-CSRF-Token", csrf)
+		res := httptest.NewRecorder()
+		api.Handler().ServeHTTP(res, req)
+		return res
+	}
+
+	if res := post("/api/v1/checkout", strings.NewReader(body)); res.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 over the default limit, got %d (body: %s)", res.Code, res.Body.String())
+	}
+	// Without a declared length the body is cut off while decoding.
+	if res := post("/api/v1/checkout", io.MultiReader(strings.NewReader(body))); res.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for an oversized chunked body, got %d (body: %s)", res.Code, res.Body.String())
+	}
+	// The offline sync route keeps its larger limit, so the body reaches
+	// the handler and fails there instead.
+	if res := post("/api/v1/sync/offline-transactions", strings.NewReader(body)); res.Code == http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected offline sync to accept the body size, got 413")
 	}
 }
 
 func TestManagerPINRateLimitReturns429(t *testing.T) {
 	api := newTestAPI(t)
 	token := loginAsAdmin(t, api)
-	csrf := fetchCSRFToken(t, api)
+	csrf := fetchCSRFToken(t, api, token)
 
 	body, _ := json.Marshal(map[string]string{
 		"reason":      "test",
@@ -96,6 +191,123 @@ func TestManagerPINRateLimitReturns429(t *testing.T) {
 	}
 }
 
+func TestRecommendationRateLimitPerUser(t *testing.T) {
+	api := newTestAPI(t)
+	api.SetRateLimit("recommendation", 1, 2)
+	defer api.Stop()
+	adminToken := loginAsAdmin(t, api)
+	adminCSRF := fetchCSRFToken(t, api, adminToken)
+	cashier, err := api.auth.Login(domain.LoginRequest{Username: "cashier", Password: "cashier123"})
+	if err != nil {
+		t.Fatalf("cashier login failed: %v", err)
+	}
+	cashierCSRF := fetchCSRFToken(t, api, cashier.AccessToken)
+	handler := api.Handler()
+
+	recommend := func(token string, csrf string, terminalID string) *httptest.ResponseRecorder {
+		body := []byte(`{"store_id":"test-store","terminal_id":"` + terminalID + `","cart_items":[{"sku":"SKU-MIE-01","qty":1}]}`)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/cart/recommendation", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("X-CSRF-Token", csrf)
+		req.Header.Set("X-Terminal-ID", terminalID)
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	for i := 0; i < 2; i++ {
+		if res := recommend(adminToken, adminCSRF, "terminal-a1"); res.Code == http.StatusTooManyRequests {
+			t.Fatalf("request %d within burst was limited", i+1)
+		}
+	}
+	res := recommend(adminToken, adminCSRF, "terminal-a1")
+	if res.Code != http.StatusTooManyRequests || res.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expected 429 with Retry-After 1, got %d %q", res.Code, res.Header().Get("Retry-After"))
+	}
+	if res := recommend(adminToken, adminCSRF, "terminal-spoofed"); res.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected a new X-Terminal-ID not to reset the limit, got %d", res.Code)
+	}
+	if res := recommend(cashier.AccessToken, cashierCSRF, "terminal-b1"); res.Code == http.StatusTooManyRequests {
+		t.Fatalf("expected another user to have their own bucket")
+	}
+}
+
+func TestTokenBucketRefills(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	limiter := newTokenBucketLimiter(2, 1)
+	limiter.now = func() time.Time { return now }
+
+	if ok, _ := limiter.Allow("k"); !ok {
+		t.Fatalf("expected first request to pass")
+	}
+	ok, wait := limiter.Allow("k")
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("expected to wait 500ms for the next token, got %v %v", ok, wait)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := limiter.Allow("k"); !ok {
+		t.Fatalf("expected a refilled token after 500ms")
+	}
+}
+
+func TestTokenBucketSweepDropsIdleBuckets(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	limiter := newTokenBucketLimiter(1, 2)
+	limiter.now = func() time.Time { return now }
+	defer limiter.Stop()
+
+	for i := 0; i < 1000; i++ {
+		limiter.Allow(fmt.Sprintf("client-%d", i))
+	}
+	now = now.Add(500 * time.Millisecond)
+	limiter.Allow("busy")
+	limiter.Allow("busy")
+	now = now.Add(time.Second)
+	limiter.sweep()
+
+	if len(limiter.buckets) != 1 {
+		t.Fatalf("expected only the drained bucket to survive the sweep, got %d buckets", len(limiter.buckets))
+	}
+	if _, ok := limiter.buckets["busy"]; !ok {
+		t.Fatalf("expected the bucket still refilling to be kept")
+	}
+
+	now = now.Add(2 * time.Second)
+	limiter.sweep()
+	if len(limiter.buckets) != 0 {
+		t.Fatalf("expected an empty map once every bucket refilled, got %d buckets", len(limiter.buckets))
+	}
+}
+
+func TestAttemptLimiterSweepDropsExpiredKeys(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	limiter := newAttemptLimiter(5, time.Minute)
+	limiter.now = func() time.Time { return now }
+	defer limiter.Stop()
+
+	for i := 0; i < 1000; i++ {
+		limiter.Allow(fmt.Sprintf("client-%d", i))
+	}
+	now = now.Add(30 * time.Second)
+	limiter.Allow("recent")
+	now = now.Add(45 * time.Second)
+	limiter.sweep()
+
+	if len(limiter.entries) != 1 {
+		t.Fatalf("expected only the recent key to survive the sweep, got %d keys", len(limiter.entries))
+	}
+	if _, ok := limiter.entries["recent"]; !ok {
+		t.Fatalf("expected the key still inside the window to be kept")
+	}
+
+	now = now.Add(time.Minute)
+	limiter.sweep()
+	if len(limiter.entries) != 0 {
+		t.Fatalf("expected an empty map once every window expired, got %d keys", len(limiter.entries))
+	}
+}
+
 func TestParsePositiveLimitCaps(t *testing.T) {
 	if got := parsePositiveLimit("9999", 50, 200); got != 200 {
 		t.Fatalf("expected capped limit 200, got %d", got)
@@ -108,10 +320,12 @@ func TestParsePositiveLimitCaps(t *testing.T) {
 	}
 }
 
-// fetchCSRFToken calls the CSRF token endpoint and returns the token string.
-func fetchCSRFToken(t *testing.T, api *API) string {
+// fetchCSRFToken calls the CSRF token endpoint as the holder of accessToken
+// and returns the token string.
+func fetchCSRFToken(t *testing.T, api *API, accessToken string) string {
 	t.Helper()
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/csrf-token", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
 	res := httptest.NewRecorder()
 	api.Handler().ServeHTTP(res, req)
 	if res.Code != http.StatusOK {
@@ -150,3 +364,71 @@ func loginAsAdmin(t *testing.T, api *API) string {
 	}
 	return payload.AccessToken
 }
+
+func TestCSRFTokenIsBoundToUser(t *testing.T) {
+	api := newTestAPI(t)
+	adminToken := loginAsAdmin(t, api)
+	cashier, err := api.auth.Login(domain.LoginRequest{Username: "cashier", Password: "cashier123"})
+	if err != nil {
+		t.Fatalf("cashier login failed: %v", err)
+	}
+	adminCSRF := fetchCSRFToken(t, api, adminToken)
+
+	openShift := func(accessToken string, csrf string) int {
+		body, _ := json.Marshal(domain.ShiftOpenRequest{TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 100000})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/shifts/open", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		req.Header.Set("X-CSRF-Token", csrf)
+		res := httptest.NewRecorder()
+		api.Handler().ServeHTTP(res, req)
+		return res.Code
+	}
+
+	if code := openShift(cashier.AccessToken, adminCSRF); code != http.StatusForbidden {
+		t.Fatalf("expected the admin's CSRF token to fail for the cashier, got %d", code)
+	}
+	if code := openShift(cashier.AccessToken, fetchCSRFToken(t, api, cashier.AccessToken)); code != http.StatusOK {
+		t.Fatalf("expected the cashier's own CSRF token to pass, got %d", code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/csrf-token", nil)
+	res := httptest.NewRecorder()
+	api.Handler().ServeHTTP(res, req)
+	if res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the csrf-token endpoint to require auth, got %d", res.Code)
+	}
+}
+
+type countingRevocations struct {
+	TokenRevocationStore
+	lookups int
+}
+
+func (c *countingRevocations) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	c.lookups++
+	return c.TokenRevocationStore.IsAccessTokenRevoked(ctx, jti)
+}
+
+func TestMutatingRequestVerifiesBearerTokenOnce(t *testing.T) {
+	api := newTestAPI(t)
+	token := loginAsAdmin(t, api)
+	csrf := fetchCSRFToken(t, api, token)
+	counter := &countingRevocations{TokenRevocationStore: api.auth.revocations}
+	api.auth.revocations = counter
+
+	body, _ := json.Marshal(domain.ShiftOpenRequest{TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 100000})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shifts/open", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-CSRF-Token", csrf)
+	res := httptest.NewRecorder()
+	api.Handler().ServeHTTP(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected shift open to succeed, got %d (body: %s)", res.Code, res.Body.String())
+	}
+	if counter.lookups != 1 {
+		t.Fatalf("expected one revocation lookup per request, got %d", counter.lookups)
+	}
+}
@@ -0,0 +1,241 @@
+package httpapi
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"kasirinaja/backend/internal/domain"
+)
+
+// Cell styles, indexes into cellXfs in xlsxStyles.
+const (
+	xlsxStyleDefault = iota
+	xlsxStyleHeader
+	xlsxStyleInteger
+	xlsxStyleMoney
+)
+
+type xlsxCell struct {
+	text    string
+	number  int64
+	numeric bool
+	style   int
+}
+
+type xlsxSheet struct {
+	name string
+	rows [][]xlsxCell
+}
+
+func xlsxText(value string) xlsxCell {
+	return xlsxCell{text: value}
+}
+
+func xlsxHeader(value string) xlsxCell {
+	return xlsxCell{text: value, style: xlsxStyleHeader}
+}
+
+func xlsxInt(value int64) xlsxCell {
+	return xlsxCell{number: value, numeric: true, style: xlsxStyleInteger}
+}
+
+func xlsxMoney(value int64) xlsxCell {
+	return xlsxCell{number: value, numeric: true, style: xlsxStyleMoney}
+}
+
+// dailyReportToXLSX renders the daily report as a workbook with summary,
+// by-payment, by-terminal and by-tax-rate sheets. Amounts stay in integer minor units and
+// are displayed with the currency's number format.
+func dailyReportToXLSX(report domain.DailyReport, currency string) ([]byte, error) {
+	summary := xlsxSheet{name: "Summary", rows: [][]xlsxCell{
+		{xlsxHeader("Metric"), xlsxHeader("Value")},
+		{xlsxText("Date"), xlsxText(report.Date)},
+		{xlsxText("Store"), xlsxText(report.StoreID)},
+		{xlsxText("Transactions"), xlsxInt(report.Transactions)},
+		{xlsxText("Gross sales"), xlsxMoney(report.GrossSalesCents)},
+		{xlsxText("Discount"), xlsxMoney(report.DiscountCents)},
+		{xlsxText("Tax"), xlsxMoney(report.TaxCents)},
+		{xlsxText("Net sales"), xlsxMoney(report.NetSalesCents)},
+		{xlsxText("Estimated margin"), xlsxMoney(report.EstimatedMarginCents)},
+		{xlsxText("Cost of goods"), xlsxMoney(report.CostOfGoodsCents)},
+		{xlsxText("Gross profit"), xlsxMoney(report.GrossProfitCents)},
+		{xlsxText("Write-off cost"), xlsxMoney(report.WriteOffCostCents)},
+	}}
+
+	byPayment := xlsxSheet{name: "By Payment", rows: [][]xlsxCell{
+		{xlsxHeader("Payment method"), xlsxHeader("Transactions"), xlsxHeader("Total")},
+	}}
+	for _, payment := range report.ByPayment {
+		byPayment.rows = append(byPayment.rows, []xlsxCell{
+			xlsxText(payment.PaymentMethod), xlsxInt(payment.Transactions), xlsxMoney(payment.TotalCents),
+		})
+	}
+
+	byTerminal := xlsxSheet{name: "By Terminal", rows: [][]xlsxCell{
+		{xlsxHeader("Terminal"), xlsxHeader("Transactions"), xlsxHeader("Total")},
+	}}
+	for _, terminal := range report.ByTerminal {
+		byTerminal.rows = append(byTerminal.rows, []xlsxCell{
+			xlsxText(terminal.TerminalID), xlsxInt(terminal.Transactions), xlsxMoney(terminal.TotalCents),
+		})
+	}
+
+	byTaxRate := xlsxSheet{name: "By Tax Rate", rows: [][]xlsxCell{
+		{xlsxHeader("Tax rate"), xlsxHeader("Taxable base"), xlsxHeader("Tax")},
+	}}
+	for _, rate := range report.ByTaxRate {
+		byTaxRate.rows = append(byTaxRate.rows, []xlsxCell{
+			xlsxText(strconv.FormatFloat(rate.RatePercent, 'f', -1, 64) + "%"), xlsxMoney(rate.TaxableBaseCents), xlsxMoney(rate.TaxCents),
+		})
+	}
+
+	return writeXLSX([]xlsxSheet{summary, byPayment, byTerminal, byTaxRate}, currency)
+}
+
+// writeXLSX builds a minimal SpreadsheetML package using inline strings, so no
+// shared string table is needed.
+func writeXLSX(sheets []xlsxSheet, currency string) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	files := []struct {
+		name string
+		body string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes(len(sheets))},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook(sheets)},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels(len(sheets))},
+		{"xl/styles.xml", xlsxStyles(currency)},
+	}
+	for i, sheet := range sheets {
+		files = append(files, struct {
+			name string
+			body string
+		}{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), xlsxWorksheet(sheet)})
+	}
+
+	for _, file := range files {
+		fw, err := zw.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fw.Write([]byte(file.body)); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+const xlsxHeaderXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+const xlsxRootRels = xlsxHeaderXML +
+	`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+func xlsxContentTypes(sheetCount int) string {
+	var b strings.Builder
+	b.WriteString(xlsxHeaderXML)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := 1; i <= sheetCount; i++ {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	b.WriteString(`</Types>`)
+	return b.String()
+}
+
+func xlsxWorkbook(sheets []xlsxSheet) string {
+	var b strings.Builder
+	b.WriteString(xlsxHeaderXML)
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, sheet := range sheets {
+		fmt.Fprintf(&b, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xlsxEscape(sheet.name), i+1, i+1)
+	}
+	b.WriteString(`</sheets></workbook>`)
+	return b.String()
+}
+
+func xlsxWorkbookRels(sheetCount int) string {
+	var b strings.Builder
+	b.WriteString(xlsxHeaderXML)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 1; i <= sheetCount; i++ {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, sheetCount+1)
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
+
+// xlsxStyles declares the cell formats referenced by the xlsxStyle* constants.
+// Money cells use a custom format that prefixes the currency code.
+func xlsxStyles(currency string) string {
+	moneyFormat := "#,##0"
+	if code := strings.ToUpper(strings.TrimSpace(currency)); code != "" {
+		moneyFormat = `"` + strings.ReplaceAll(code, `"`, "") + ` "#,##0`
+	}
+
+	var b strings.Builder
+	b.WriteString(xlsxHeaderXML)
+	b.WriteString(`<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	fmt.Fprintf(&b, `<numFmts count="1"><numFmt numFmtId="164" formatCode="%s"/></numFmts>`, xlsxEscape(moneyFormat))
+	b.WriteString(`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>`)
+	b.WriteString(`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>`)
+	b.WriteString(`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>`)
+	b.WriteString(`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>`)
+	b.WriteString(`<cellXfs count="4">`)
+	b.WriteString(`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>`)
+	b.WriteString(`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>`)
+	b.WriteString(`<xf numFmtId="3" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>`)
+	b.WriteString(`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>`)
+	b.WriteString(`</cellXfs></styleSheet>`)
+	return b.String()
+}
+
+func xlsxWorksheet(sheet xlsxSheet) string {
+	var b strings.Builder
+	b.WriteString(xlsxHeaderXML)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for r, row := range sheet.rows {
+		fmt.Fprintf(&b, `<row r="%d">`, r+1)
+		for c, cell := range row {
+			ref := xlsxColumn(c) + strconv.Itoa(r+1)
+			if cell.numeric {
+				fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%d</v></c>`, ref, cell.style, cell.number)
+				continue
+			}
+			fmt.Fprintf(&b, `<c r="%s" s="%d" t="inlineStr"><is><t>%s</t></is></c>`, ref, cell.style, xlsxEscape(cell.text))
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	return b.String()
+}
+
+// xlsxColumn converts a zero-based column index to its A1 letter form.
+func xlsxColumn(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+func xlsxEscape(value string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
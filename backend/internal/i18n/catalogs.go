@@ -0,0 +1,132 @@
+package i18n
+
+// Receipt labels use "receipt." keys; error messages use "error." followed
+// by the error code of the JSON error response.
+
+var indonesian = &Catalog{Lang: "id", Messages: map[string]string{
+	"receipt.transaction":       "TX: %s",
+	"receipt.store":             "Store: %s",
+	"receipt.terminal":          "Terminal: %s",
+	"receipt.cashier":           "Kasir: %s",
+	"receipt.date":              "Date: %s",
+	"receipt.subtotal":          "Subtotal",
+	"receipt.discount":          "Diskon",
+	"receipt.tax_base":          "DPP",
+	"receipt.tax":               "Pajak",
+	"receipt.total":             "Total",
+	"receipt.paid":              "Bayar",
+	"receipt.change":            "Kembali",
+	"receipt.store_credit":      "Kredit toko",
+	"receipt.store_credit_code": "Kode kredit: %s",
+	"receipt.digital":           "Struk digital: %s",
+	"receipt.thanks":            "Terima kasih",
+
+	"error.service_read_only":           "Layanan sedang baca-saja karena database tidak tersedia. Coba lagi sebentar lagi.",
+	"error.insufficient_stock":          "Stok tidak cukup.",
+	"error.insufficient_store_credit":   "Saldo kredit toko tidak cukup.",
+	"error.duplicate_id":                "ID sudah dipakai.",
+	"error.duplicate_promo_name":        "Nama ini sudah dipakai promo aktif lain.",
+	"error.product_unavailable":         "Produk tidak ditemukan atau tidak aktif.",
+	"error.product_out_of_season":       "Produk tidak tersedia pada tanggal ini.",
+	"error.empty_cart":                  "Keranjang masih kosong.",
+	"error.invalid_discount":            "Diskon tidak valid.",
+	"error.invalid_tax_rate":            "Tarif pajak harus antara 0 dan 100.",
+	"error.unsupported_payment_method":  "Metode pembayaran tidak didukung.",
+	"error.insufficient_payment":        "Pembayaran kurang dari total.",
+	"error.invalid_split_payment":       "Pembayaran terpisah tidak valid.",
+	"error.invalid_serials":             "Nomor seri tidak sesuai atau tidak tersedia.",
+	"error.invalid_payment_reference":   "Referensi pembayaran tidak valid.",
+	"error.duplicate_payment_reference": "Referensi pembayaran dipakai lebih dari sekali.",
+	"error.payment_method_not_enabled":  "Metode pembayaran ini tidak tersedia di toko ini.",
+	"error.shift_already_open":          "Shift sudah dibuka di terminal ini.",
+	"error.shift_closed":                "Shift sudah ditutup.",
+	"error.no_active_shift":             "Belum ada shift yang dibuka.",
+	"error.refund_window_expired":       "Batas waktu refund transaksi ini sudah lewat.",
+	"error.daily_cap_exceeded":          "Batas harian void atau refund sudah tercapai. Minta override manajer.",
+	"error.store_id_required":           "Permintaan harus menyebutkan store_id.",
+	"error.terminal_not_registered":     "Terminal belum terdaftar atau token terminal tidak valid.",
+	"error.shift_not_owned":             "Shift aktif milik kasir lain.",
+	"error.held_carts_pending":          "Masih ada keranjang tertahan di terminal ini.",
+	"error.no_kitchen_items":            "Transaksi tidak memiliki item dapur.",
+	"error.no_report_recipients":        "Penerima laporan belum diatur.",
+	"error.forbidden_role":              "Peran Anda tidak diizinkan melakukan ini.",
+	"error.invalid_manager_pin":         "PIN manajer salah.",
+	"error.invalid_csrf_token":          "Token CSRF tidak ada atau tidak valid.",
+	"error.not_found":                   "Data tidak ditemukan.",
+	"error.invalid_transaction":         "Permintaan transaksi tidak valid.",
+	"error.idempotency_replay":          "Kunci idempotensi sudah dipakai transaksi lain.",
+	"error.request_too_large":           "Ukuran permintaan terlalu besar.",
+	"error.bad_request":                 "Permintaan tidak valid.",
+	"error.unauthorized":                "Silakan login kembali.",
+	"error.forbidden":                   "Akses ditolak.",
+	"error.method_not_allowed":          "Metode tidak didukung.",
+	"error.conflict":                    "Permintaan bentrok dengan data yang ada.",
+	"error.unprocessable":               "Permintaan tidak dapat diproses.",
+	"error.rate_limited":                "Terlalu banyak permintaan. Tunggu sebentar.",
+	"error.service_unavailable":         "Layanan sedang tidak tersedia.",
+	"error.internal_error":              "Terjadi kesalahan pada server.",
+}}
+
+var english = &Catalog{Lang: "en", Fallback: indonesian, Messages: map[string]string{
+	"receipt.transaction":       "TX: %s",
+	"receipt.store":             "Store: %s",
+	"receipt.terminal":          "Terminal: %s",
+	"receipt.cashier":           "Cashier: %s",
+	"receipt.date":              "Date: %s",
+	"receipt.subtotal":          "Subtotal",
+	"receipt.discount":          "Discount",
+	"receipt.tax_base":          "Tax base",
+	"receipt.tax":               "Tax",
+	"receipt.total":             "Total",
+	"receipt.paid":              "Paid",
+	"receipt.change":            "Change",
+	"receipt.store_credit":      "Store credit",
+	"receipt.store_credit_code": "Credit code: %s",
+	"receipt.digital":           "Digital receipt: %s",
+	"receipt.thanks":            "Thank you",
+
+	"error.service_read_only":           "The service is read-only while the database is unavailable. Try again shortly.",
+	"error.insufficient_stock":          "Not enough stock.",
+	"error.insufficient_store_credit":   "Not enough store credit.",
+	"error.duplicate_id":                "This ID is already in use.",
+	"error.duplicate_promo_name":        "This name is already used by an active promo.",
+	"error.product_unavailable":         "Product not found or inactive.",
+	"error.product_out_of_season":       "Product is not available on this date.",
+	"error.empty_cart":                  "The cart is empty.",
+	"error.invalid_discount":            "Invalid discount.",
+	"error.invalid_tax_rate":            "The tax rate must be between 0 and 100.",
+	"error.unsupported_payment_method":  "Unsupported payment method.",
+	"error.insufficient_payment":        "The payment is less than the total.",
+	"error.invalid_split_payment":       "Invalid split payment.",
+	"error.invalid_serials":             "Serial numbers do not match or are not available.",
+	"error.invalid_payment_reference":   "Invalid payment reference.",
+	"error.duplicate_payment_reference": "A payment reference is used more than once.",
+	"error.payment_method_not_enabled":  "This store does not accept this payment method.",
+	"error.shift_already_open":          "A shift is already open on this terminal.",
+	"error.shift_closed":                "The shift is already closed.",
+	"error.no_active_shift":             "No shift is open.",
+	"error.refund_window_expired":       "The refund window for this sale has passed.",
+	"error.daily_cap_exceeded":          "The daily void or refund cap is reached. Ask a manager to override.",
+	"error.store_id_required":           "The request must name a store_id.",
+	"error.terminal_not_registered":     "This terminal is not registered or its terminal token is invalid.",
+	"error.shift_not_owned":             "The open shift belongs to another cashier.",
+	"error.held_carts_pending":          "There are held carts on this terminal.",
+	"error.no_kitchen_items":            "The transaction has no kitchen items.",
+	"error.no_report_recipients":        "No report recipients are configured.",
+	"error.forbidden_role":              "Your role is not allowed to do this.",
+	"error.invalid_manager_pin":         "Wrong manager PIN.",
+	"error.invalid_csrf_token":          "Missing or invalid CSRF token.",
+	"error.not_found":                   "Not found.",
+	"error.invalid_transaction":         "Invalid transaction request.",
+	"error.idempotency_replay":          "The idempotency key was already used by a recorded sale.",
+	"error.request_too_large":           "The request is too large.",
+	"error.bad_request":                 "Invalid request.",
+	"error.unauthorized":                "Please log in again.",
+	"error.forbidden":                   "Access denied.",
+	"error.method_not_allowed":          "Method not allowed.",
+	"error.conflict":                    "The request conflicts with existing data.",
+	"error.unprocessable":               "The request could not be processed.",
+	"error.rate_limited":                "Too many requests. Please wait a moment.",
+	"error.service_unavailable":         "The service is unavailable.",
+	"error.internal_error":              "Something went wrong on the server.",
+}}
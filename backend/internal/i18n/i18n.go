@@ -0,0 +1,121 @@
+// Package i18n holds the message catalogs for customer and cashier facing
+// text: receipt labels and error messages. Indonesian is the default.
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLanguage is used when neither the request nor the configuration
+// names a supported language.
+const DefaultLanguage = "id"
+
+// Localizer turns message keys into text in one language.
+type Localizer interface {
+	// Language is the lowercase base language code, e.g. "en".
+	Language() string
+	// Message formats the text for key with args. Unknown keys return "".
+	Message(key string, args ...any) string
+}
+
+// Catalog is a Localizer backed by fmt format strings. Keys it lacks are
+// looked up in Fallback, if set.
+type Catalog struct {
+	Lang     string
+	Messages map[string]string
+	Fallback Localizer
+}
+
+func (c *Catalog) Language() string {
+	return c.Lang
+}
+
+func (c *Catalog) Message(key string, args ...any) string {
+	format, ok := c.Messages[key]
+	if !ok {
+		if c.Fallback != nil {
+			return c.Fallback.Message(key, args...)
+		}
+		return ""
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+var (
+	mu         sync.RWMutex
+	localizers = map[string]Localizer{}
+)
+
+func init() {
+	Register(indonesian)
+	Register(english)
+}
+
+// Register adds or replaces the localizer for its language.
+func Register(localizer Localizer) {
+	mu.Lock()
+	defer mu.Unlock()
+	localizers[baseLanguage(localizer.Language())] = localizer
+}
+
+// Lookup returns the localizer for a language tag such as "en" or "en-US".
+func Lookup(lang string) (Localizer, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	localizer, ok := localizers[baseLanguage(lang)]
+	return localizer, ok
+}
+
+// Default returns the localizer for lang, or Indonesian when lang is not
+// supported.
+func Default(lang string) Localizer {
+	if localizer, ok := Lookup(lang); ok {
+		return localizer
+	}
+	localizer, _ := Lookup(DefaultLanguage)
+	return localizer
+}
+
+// Negotiate picks the supported language the client prefers most in an
+// Accept-Language header, falling back to Default(fallback).
+func Negotiate(acceptLanguage string, fallback string) Localizer {
+	type preference struct {
+		lang    string
+		quality float64
+	}
+	var preferences []preference
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if lang != "" && lang != "*" && quality > 0 {
+			preferences = append(preferences, preference{lang: lang, quality: quality})
+		}
+	}
+	sort.SliceStable(preferences, func(i, j int) bool { return preferences[i].quality > preferences[j].quality })
+	for _, preferred := range preferences {
+		if localizer, ok := Lookup(preferred.lang); ok {
+			return localizer
+		}
+	}
+	return Default(fallback)
+}
+
+func baseLanguage(tag string) string {
+	base, _, _ := strings.Cut(strings.TrimSpace(tag), "-")
+	base, _, _ = strings.Cut(base, "_")
+	return strings.ToLower(base)
+}
@@ -0,0 +1,40 @@
+package i18n
+
+import "testing"
+
+func TestNegotiatePicksPreferredSupportedLanguage(t *testing.T) {
+	cases := []struct {
+		header   string
+		fallback string
+		want     string
+	}{
+		{"", "", "id"},
+		{"", "en", "en"},
+		{"en-US,en;q=0.9,id;q=0.8", "id", "en"},
+		{"fr-FR, id;q=0.5, en;q=0.7", "id", "en"},
+		{"ja, en;q=0", "id", "id"},
+		{"de", "en", "en"},
+	}
+	for _, tc := range cases {
+		if got := Negotiate(tc.header, tc.fallback).Language(); got != tc.want {
+			t.Fatalf("Negotiate(%q, %q) = %q, want %q", tc.header, tc.fallback, got, tc.want)
+		}
+	}
+}
+
+func TestCatalogFallsBackForMissingKeys(t *testing.T) {
+	Register(&Catalog{Lang: "jv", Fallback: english, Messages: map[string]string{"receipt.thanks": "Matur nuwun"}})
+	localizer, ok := Lookup("jv-ID")
+	if !ok {
+		t.Fatal("expected the registered language to be found")
+	}
+	if got := localizer.Message("receipt.thanks"); got != "Matur nuwun" {
+		t.Fatalf("expected own message, got %q", got)
+	}
+	if got := localizer.Message("receipt.store", "main-store"); got != "Store: main-store" {
+		t.Fatalf("expected the fallback message, got %q", got)
+	}
+	if got := localizer.Message("receipt.unknown"); got != "" {
+		t.Fatalf("expected unknown keys to be empty, got %q", got)
+	}
+}
@@ -0,0 +1,84 @@
+package jobs
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"kasirinaja/backend/internal/domain"
+)
+
+// Names of the background jobs started by the server.
+const (
+	RecommendationRetrain  = "recommendation_retrain"
+	EndOfDayReport         = "end_of_day_report"
+	ExpiringLotAlerts      = "expiring_lot_alerts"
+	OfflineEnvelopeJanitor = "offline_envelope_janitor"
+	RevocationJanitor      = "token_revocation_janitor"
+)
+
+// Registry keeps the last run and next scheduled run of each background job
+// in memory, for operators to check that schedulers are alive. All methods
+// are safe on a nil Registry, which records nothing, so schedulers can report
+// unconditionally.
+type Registry struct {
+	mu   sync.Mutex
+	jobs map[string]*domain.JobStatus
+}
+
+func NewRegistry() *Registry {
+	return &Registry{jobs: map[string]*domain.JobStatus{}}
+}
+
+// Scheduled records when name runs next, registering the job on first use.
+func (r *Registry) Scheduled(name string, next time.Time) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	next = next.UTC()
+	r.job(name).NextRunAt = &next
+}
+
+// Ran records a run of name that finished at at, failed when err is not nil.
+func (r *Registry) Ran(name string, at time.Time, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job := r.job(name)
+	at = at.UTC()
+	job.LastRunAt = &at
+	job.LastStatus = domain.JobStatusOK
+	job.LastError = ""
+	if err != nil {
+		job.LastStatus = domain.JobStatusFailed
+		job.LastError = err.Error()
+	}
+}
+
+// List returns every registered job sorted by name.
+func (r *Registry) List() []domain.JobStatus {
+	if r == nil {
+		return []domain.JobStatus{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	jobs := make([]domain.JobStatus, 0, len(r.jobs))
+	for _, job := range r.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs
+}
+
+func (r *Registry) job(name string) *domain.JobStatus {
+	job, ok := r.jobs[name]
+	if !ok {
+		job = &domain.JobStatus{Name: name, LastStatus: domain.JobStatusPending}
+		r.jobs[name] = job
+	}
+	return job
+}
@@ -0,0 +1,48 @@
+package jobs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"kasirinaja/backend/internal/domain"
+)
+
+func TestRegistryTracksRunsAndNextSchedule(t *testing.T) {
+	registry := NewRegistry()
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	registry.Scheduled(RecommendationRetrain, at)
+	registry.Scheduled(EndOfDayReport, at.Add(time.Hour))
+	jobs := registry.List()
+	if len(jobs) != 2 || jobs[0].Name != EndOfDayReport || jobs[1].Name != RecommendationRetrain {
+		t.Fatalf("expected both jobs sorted by name, got %+v", jobs)
+	}
+	if jobs[1].LastStatus != domain.JobStatusPending || jobs[1].LastRunAt != nil || !jobs[1].NextRunAt.Equal(at) {
+		t.Fatalf("expected a pending job with its next run, got %+v", jobs[1])
+	}
+
+	registry.Ran(RecommendationRetrain, at, errors.New("database down"))
+	registry.Scheduled(RecommendationRetrain, at.Add(6*time.Hour))
+	failed := registry.List()[1]
+	if failed.LastStatus != domain.JobStatusFailed || failed.LastError != "database down" || !failed.LastRunAt.Equal(at) {
+		t.Fatalf("expected the failed run to be recorded, got %+v", failed)
+	}
+	if !failed.NextRunAt.Equal(at.Add(6 * time.Hour)) {
+		t.Fatalf("expected the next run to move on, got %s", failed.NextRunAt)
+	}
+
+	registry.Ran(RecommendationRetrain, at.Add(6*time.Hour), nil)
+	if ok := registry.List()[1]; ok.LastStatus != domain.JobStatusOK || ok.LastError != "" {
+		t.Fatalf("expected a successful run to clear the error, got %+v", ok)
+	}
+}
+
+func TestNilRegistryRecordsNothing(t *testing.T) {
+	var registry *Registry
+	registry.Scheduled(RevocationJanitor, time.Now())
+	registry.Ran(RevocationJanitor, time.Now(), nil)
+	if jobs := registry.List(); len(jobs) != 0 {
+		t.Fatalf("expected no jobs, got %+v", jobs)
+	}
+}
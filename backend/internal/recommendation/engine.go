@@ -14,10 +14,45 @@ import (
 	"kasirinaja/backend/internal/domain"
 )
 
+const (
+	defaultRecommendationLimit = 1
+	maxRecommendationLimit     = 5
+)
+
+// CategoryFallbackReason marks suggestions that came from category
+// co-occurrence rather than a SKU-level pair.
+const CategoryFallbackReason = "category_fallback"
+
+// CategoryCandidates loads what the category fallback needs for the given
+// cart categories: the category pairs, the products in their target
+// categories and those products' stock. It is only called when no SKU-level
+// pair produced a suggestion.
+type CategoryCandidates func(ctx context.Context, categories []string) ([]domain.CategoryAssociationPair, []domain.Product, map[string]int, error)
+
+// ShowPolicy controls how often a terminal is prompted with suggestions.
+type ShowPolicy struct {
+	// CooldownSeconds is how long the terminal waits before asking again.
+	// Busy queues always wait at least busyQueueCooldownSeconds.
+	CooldownSeconds int
+	// MaxPromptsPerBasket hides suggestions once a basket has been prompted
+	// this many times. Zero means no cap.
+	MaxPromptsPerBasket int
+}
+
+// DefaultShowPolicy is used until SetShowPolicy is called.
+var DefaultShowPolicy = ShowPolicy{CooldownSeconds: 45, MaxPromptsPerBasket: 3}
+
+const (
+	busyQueueCooldownSeconds = 70
+	rushQueueCooldownSeconds = 90
+)
+
 type Engine struct {
 	cache         cache.RecommendationCache
 	cacheTTL      time.Duration
 	minConfidence float64
+	minStock      int
+	policy        ShowPolicy
 }
 
 func NewEngine(cacheStore cache.RecommendationCache, cacheTTL time.Duration) *Engine {
@@ -32,7 +67,49 @@ func NewEngine(cacheStore cache.RecommendationCache, cacheTTL time.Duration) *En
 		cache:         cacheStore,
 		cacheTTL:      cacheTTL,
 		minConfidence: 0.35,
+		minStock:      1,
+		policy:        DefaultShowPolicy,
+	}
+}
+
+// SetShowPolicy replaces the prompt cooldown and per-basket cap. A cooldown
+// below one second keeps the default; a negative cap disables it.
+func (e *Engine) SetShowPolicy(policy ShowPolicy) {
+	if policy.CooldownSeconds < 1 {
+		policy.CooldownSeconds = DefaultShowPolicy.CooldownSeconds
 	}
+	if policy.MaxPromptsPerBasket < 0 {
+		policy.MaxPromptsPerBasket = 0
+	}
+	e.policy = policy
+}
+
+// IdlePolicy is the UI policy for a request that gets no suggestion, such
+// as an empty cart.
+func (e *Engine) IdlePolicy() domain.UIPolicy {
+	return domain.UIPolicy{Show: false, CooldownSeconds: e.policy.CooldownSeconds}
+}
+
+// promptCapReached reports whether a basket already prompted promptCount
+// times must not be prompted again.
+func (e *Engine) promptCapReached(promptCount int) bool {
+	return e.policy.MaxPromptsPerBasket > 0 && promptCount >= e.policy.MaxPromptsPerBasket
+}
+
+// SetMinStock sets how many units a target SKU must have on hand before it
+// can be suggested. Values below 1 are raised to 1 so sold-out items are
+// never recommended.
+func (e *Engine) SetMinStock(minStock int) {
+	if minStock < 1 {
+		minStock = 1
+	}
+	e.minStock = minStock
+}
+
+// Invalidate drops cached recommendations for a store, typically after its
+// association pairs were rebuilt.
+func (e *Engine) Invalidate(ctx context.Context, storeID string) error {
+	return e.cache.Invalidate(ctx, storeID)
 }
 
 func (e *Engine) Recommend(
@@ -41,19 +118,20 @@ func (e *Engine) Recommend(
 	products map[string]domain.Product,
 	stockMap map[string]int,
 	pairs []domain.AssociationPair,
+	fallback CategoryCandidates,
 ) domain.RecommendationResponse {
 	startedAt := time.Now()
 
-	if len(req.CartItems) == 0 {
+	if len(req.CartItems) == 0 || e.promptCapReached(req.PromptCount) {
 		return domain.RecommendationResponse{
-			UIPolicy:  domain.UIPolicy{Show: false, CooldownSeconds: 30},
+			UIPolicy:  e.IdlePolicy(),
 			LatencyMS: time.Since(startedAt).Milliseconds(),
 		}
 	}
 
 	if req.QueueSpeedHint >= 28 {
 		return domain.RecommendationResponse{
-			UIPolicy:  domain.UIPolicy{Show: false, CooldownSeconds: 90},
+			UIPolicy:  domain.UIPolicy{Show: false, CooldownSeconds: max(e.policy.CooldownSeconds, rushQueueCooldownSeconds)},
 			LatencyMS: time.Since(startedAt).Milliseconds(),
 		}
 	}
@@ -71,10 +149,13 @@ func (e *Engine) Recommend(
 	}
 
 	pairSignal := make(map[string]float64)
-	for _, pair := range pairs {
+	for _, pair := range mergeManualPairs(pairs) {
 		if _, exists := cartSet[pair.TargetSKU]; exists {
 			continue
 		}
+		if stockMap[pair.TargetSKU] < e.minStock {
+			continue
+		}
 		pairSignal[pair.TargetSKU] += pair.Affinity
 	}
 
@@ -83,11 +164,7 @@ func (e *Engine) Recommend(
 		hour = req.Timestamp.Hour()
 	}
 
-	bestSKU := ""
-	bestScore := 0.0
-	bestReason := ""
-	bestConfidence := 0.0
-	bestMarginLift := int64(0)
+	candidates := make([]domain.Recommendation, 0, len(pairSignal))
 
 	for sku, pairAffinityRaw := range pairSignal {
 		product, ok := products[sku]
@@ -96,7 +173,7 @@ func (e *Engine) Recommend(
 		}
 
 		stock := stockMap[sku]
-		if stock <= 0 {
+		if stock < e.minStock {
 			continue
 		}
 
@@ -121,33 +198,47 @@ func (e *Engine) Recommend(
 		reasonCode := deriveReason(pairAffinity, marginScore, stockScore, timeRelevance)
 		expectedMarginLift := int64(math.Round(float64(product.PriceCents) * product.MarginRate))
 
-		if confidence > bestScore {
-			bestScore = confidence
-			bestSKU = sku
-			bestReason = reasonCode
-			bestConfidence = confidence
-			bestMarginLift = expectedMarginLift
+		candidates = append(candidates, domain.Recommendation{
+			SKU:                     product.SKU,
+			Name:                    product.Name,
+			PriceCents:              product.PriceCents,
+			ExpectedMarginLiftCents: expectedMarginLift,
+			ReasonCode:              reasonCode,
+			Confidence:              confidence,
+			AvailableQty:            stock,
+		})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Confidence != candidates[j].Confidence {
+			return candidates[i].Confidence > candidates[j].Confidence
+		}
+		return candidates[i].SKU < candidates[j].SKU
+	})
+	if limit := recommendationLimit(req.Limit); len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	for i := range candidates {
+		candidates[i].Confidence = round2(candidates[i].Confidence)
+	}
+	if len(candidates) == 0 && fallback != nil {
+		if rec := e.categoryFallback(ctx, products, cartSet, fallback); rec != nil {
+			candidates = append(candidates, *rec)
 		}
 	}
 
 	resp := domain.RecommendationResponse{
-		UIPolicy: domain.UIPolicy{Show: false, CooldownSeconds: 45},
+		UIPolicy: e.IdlePolicy(),
 	}
 
-	if bestSKU != "" {
-		product := products[bestSKU]
-		resp.Recommendation = &domain.Recommendation{
-			SKU:                     product.SKU,
-			Name:                    product.Name,
-			PriceCents:              product.PriceCents,
-			ExpectedMarginLiftCents: bestMarginLift,
-			ReasonCode:              bestReason,
-			Confidence:              round2(bestConfidence),
-		}
+	if len(candidates) > 0 {
+		resp.Recommendations = candidates
+		top := candidates[0]
+		resp.Recommendation = &top
 
-		cooldown := 45
+		cooldown := e.policy.CooldownSeconds
 		if req.QueueSpeedHint > 18 {
-			cooldown = 70
+			cooldown = max(cooldown, busyQueueCooldownSeconds)
 		}
 		resp.UIPolicy = domain.UIPolicy{Show: true, CooldownSeconds: cooldown}
 	}
@@ -157,6 +248,114 @@ func (e *Engine) Recommend(
 	return resp
 }
 
+// categoryFallback picks the highest-margin in-stock product from the
+// category most often bought alongside the cart's categories.
+func (e *Engine) categoryFallback(
+	ctx context.Context,
+	products map[string]domain.Product,
+	cartSet map[string]struct{},
+	fallback CategoryCandidates,
+) *domain.Recommendation {
+	categorySet := make(map[string]struct{})
+	for sku := range cartSet {
+		if product, ok := products[sku]; ok && product.Category != "" {
+			categorySet[product.Category] = struct{}{}
+		}
+	}
+	if len(categorySet) == 0 {
+		return nil
+	}
+	categories := make([]string, 0, len(categorySet))
+	for category := range categorySet {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	categoryPairs, candidates, stockMap, err := fallback(ctx, categories)
+	if err != nil || len(categoryPairs) == 0 {
+		return nil
+	}
+
+	categoryAffinity := make(map[string]float64)
+	for _, pair := range categoryPairs {
+		if _, inCart := categorySet[pair.TargetCategory]; inCart {
+			continue
+		}
+		categoryAffinity[pair.TargetCategory] += pair.Affinity / float64(len(categories))
+	}
+
+	var best *domain.Product
+	bestAffinity := 0.0
+	for i := range candidates {
+		product := candidates[i]
+		affinity, ok := categoryAffinity[product.Category]
+		if !ok || !product.Active {
+			continue
+		}
+		if _, inCart := cartSet[product.SKU]; inCart {
+			continue
+		}
+		if stockMap[product.SKU] < e.minStock {
+			continue
+		}
+		if best == nil ||
+			product.MarginRate > best.MarginRate ||
+			(product.MarginRate == best.MarginRate && affinity > bestAffinity) ||
+			(product.MarginRate == best.MarginRate && affinity == bestAffinity && product.SKU < best.SKU) {
+			best = &candidates[i]
+			bestAffinity = affinity
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	return &domain.Recommendation{
+		SKU:                     best.SKU,
+		Name:                    best.Name,
+		PriceCents:              best.PriceCents,
+		ExpectedMarginLiftCents: int64(math.Round(float64(best.PriceCents) * best.MarginRate)),
+		ReasonCode:              CategoryFallbackReason,
+		Confidence:              round2(clamp(bestAffinity, 0, 1)),
+		AvailableQty:            stockMap[best.SKU],
+	}
+}
+
+// mergeManualPairs drops computed pairs that a manual override covers, so a
+// curated affinity replaces the mined one instead of adding to it.
+func mergeManualPairs(pairs []domain.AssociationPair) []domain.AssociationPair {
+	manual := make(map[string]struct{})
+	for _, pair := range pairs {
+		if pair.Manual {
+			manual[pair.SourceSKU+"->"+pair.TargetSKU] = struct{}{}
+		}
+	}
+	if len(manual) == 0 {
+		return pairs
+	}
+
+	merged := make([]domain.AssociationPair, 0, len(pairs))
+	for _, pair := range pairs {
+		if _, overridden := manual[pair.SourceSKU+"->"+pair.TargetSKU]; overridden && !pair.Manual {
+			continue
+		}
+		merged = append(merged, pair)
+	}
+	return merged
+}
+
+// recommendationLimit clamps the requested number of suggestions to what the
+// upsell screen can show.
+func recommendationLimit(limit int) int {
+	if limit < 1 {
+		return defaultRecommendationLimit
+	}
+	if limit > maxRecommendationLimit {
+		return maxRecommendationLimit
+	}
+	return limit
+}
+
 func normalizeCartItems(items []domain.CartItem) []domain.CartItem {
 	aggregated := make(map[string]int, len(items))
 	for _, item := range items {
@@ -221,9 +420,10 @@ func buildCacheKey(req domain.RecommendationRequest) string {
 	}
 	parts = append(parts, fmt.Sprintf("q:%d", int(req.QueueSpeedHint)))
 	parts = append(parts, fmt.Sprintf("p:%d", req.PromptCount))
+	parts = append(parts, fmt.Sprintf("n:%d", recommendationLimit(req.Limit)))
 
 	hash := sha1.Sum([]byte(strings.Join(parts, "|")))
-	return "pos:recommendation:" + hex.EncodeToString(hash[:])
+	return cache.RecommendationKeyPrefix(req.StoreID) + hex.EncodeToString(hash[:])
 }
 
 func clamp(val float64, minVal float64, maxVal float64) float64 {
@@ -0,0 +1,241 @@
+package reporting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"kasirinaja/backend/internal/domain"
+	"kasirinaja/backend/internal/jobs"
+)
+
+// ErrNoRecipients is returned when a report is sent without any configured
+// recipient.
+var ErrNoRecipients = errors.New("no end-of-day report recipients configured")
+
+// DailyReportSource loads the daily report for a store-local date.
+type DailyReportSource interface {
+	DailyReport(ctx context.Context, storeID string, date string) (domain.DailyReport, error)
+}
+
+// DailyReportDelivery is the JSON body posted to every recipient. Email
+// gateways are expected to turn it into a message with the HTML as body and
+// the CSV as attachment.
+type DailyReportDelivery struct {
+	StoreID string `json:"store_id"`
+	Date    string `json:"date"`
+	Subject string `json:"subject"`
+	CSV     string `json:"csv"`
+	HTML    string `json:"html"`
+}
+
+// BuildDelivery renders a daily report into the payload pushed to recipients.
+func BuildDelivery(report domain.DailyReport) DailyReportDelivery {
+	return DailyReportDelivery{
+		StoreID: report.StoreID,
+		Date:    report.Date,
+		Subject: fmt.Sprintf("Daily report %s - %s", report.StoreID, report.Date),
+		CSV:     DailyCSV(report),
+		HTML:    DailyHTML(report),
+	}
+}
+
+// EndOfDayReporter pushes a store's daily report to a list of webhook or
+// email gateway URLs once the store's local send time has passed.
+type EndOfDayReporter struct {
+	source      DailyReportSource
+	storeID     string
+	recipients  []string
+	sendAfter   time.Duration
+	loc         *time.Location
+	client      *http.Client
+	maxAttempts int
+	retryDelay  time.Duration
+	jobs        *jobs.Registry
+
+	mu        sync.Mutex
+	delivered map[string]string
+}
+
+// NewEndOfDayReporter creates a reporter for storeID. sendAfter is the offset
+// from local midnight after which the day's report is pushed.
+func NewEndOfDayReporter(source DailyReportSource, storeID string, recipients []string, sendAfter time.Duration, loc *time.Location) *EndOfDayReporter {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &EndOfDayReporter{
+		source:      source,
+		storeID:     storeID,
+		recipients:  recipients,
+		sendAfter:   sendAfter,
+		loc:         loc,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		maxAttempts: 3,
+		retryDelay:  2 * time.Second,
+		delivered:   make(map[string]string),
+	}
+}
+
+// Send pushes the report for date to every recipient, even those that already
+// received it, and returns how many deliveries succeeded.
+func (r *EndOfDayReporter) Send(ctx context.Context, date string) (int, error) {
+	return r.send(ctx, date, false)
+}
+
+// SetJobRegistry makes Run report scheduled sends to registry.
+func (r *EndOfDayReporter) SetJobRegistry(registry *jobs.Registry) {
+	r.jobs = registry
+}
+
+// Run checks every interval whether the day's report is due and sends it to
+// recipients that have not received it yet. Failed deliveries are retried on
+// the next check. It stops when ctx is cancelled.
+func (r *EndOfDayReporter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	r.jobs.Scheduled(jobs.EndOfDayReport, r.nextRun(time.Now(), interval))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			r.tick(ctx, now)
+			r.jobs.Scheduled(jobs.EndOfDayReport, r.nextRun(now, interval))
+		}
+	}
+}
+
+// nextRun returns when Run will next try to send: today's send time, the
+// next check while today's report is still undelivered, or tomorrow's send
+// time once it has gone out.
+func (r *EndOfDayReporter) nextRun(now time.Time, interval time.Duration) time.Time {
+	local := now.In(r.loc)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, r.loc)
+	if sendAt := midnight.Add(r.sendAfter); local.Before(sendAt) {
+		return sendAt
+	}
+	if r.deliveredAll(local.Format("2006-01-02")) {
+		return midnight.AddDate(0, 0, 1).Add(r.sendAfter)
+	}
+	return now.Add(interval)
+}
+
+func (r *EndOfDayReporter) tick(ctx context.Context, now time.Time) {
+	local := now.In(r.loc)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, r.loc)
+	if local.Sub(midnight) < r.sendAfter {
+		return
+	}
+
+	date := local.Format("2006-01-02")
+	if r.deliveredAll(date) {
+		return
+	}
+	sent, err := r.send(ctx, date, true)
+	r.jobs.Ran(jobs.EndOfDayReport, time.Now(), err)
+	if err != nil {
+		log.Printf("end-of-day report %s: %v", date, err)
+		return
+	}
+	log.Printf("end-of-day report %s delivered to %d recipients", date, sent)
+}
+
+func (r *EndOfDayReporter) send(ctx context.Context, date string, skipDelivered bool) (int, error) {
+	if len(r.recipients) == 0 {
+		return 0, ErrNoRecipients
+	}
+
+	report, err := r.source.DailyReport(ctx, r.storeID, date)
+	if err != nil {
+		return 0, err
+	}
+	body, err := json.Marshal(BuildDelivery(report))
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	var errs []error
+	for _, recipient := range r.recipients {
+		if skipDelivered && r.deliveredTo(recipient, report.Date) {
+			continue
+		}
+		if err := r.deliver(ctx, recipient, body); err != nil {
+			errs = append(errs, fmt.Errorf("deliver to %s: %w", recipient, err))
+			continue
+		}
+		r.markDelivered(recipient, report.Date)
+		sent++
+	}
+	return sent, errors.Join(errs...)
+}
+
+func (r *EndOfDayReporter) deliver(ctx context.Context, url string, body []byte) error {
+	var lastErr error
+	for attempt := 1; attempt <= r.maxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt-1) * r.retryDelay):
+			}
+		}
+
+		lastErr = r.post(ctx, url, body)
+		if lastErr == nil {
+			return nil
+		}
+	}
+	return lastErr
+}
+
+func (r *EndOfDayReporter) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return nil
+}
+
+func (r *EndOfDayReporter) deliveredTo(recipient string, date string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.delivered[recipient] == date
+}
+
+func (r *EndOfDayReporter) deliveredAll(date string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, recipient := range r.recipients {
+		if r.delivered[recipient] != date {
+			return false
+		}
+	}
+	return len(r.recipients) > 0
+}
+
+func (r *EndOfDayReporter) markDelivered(recipient string, date string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.delivered[recipient] = date
+}
@@ -0,0 +1,108 @@
+package reporting
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"kasirinaja/backend/internal/domain"
+)
+
+type staticReportSource struct{}
+
+func (staticReportSource) DailyReport(_ context.Context, storeID string, date string) (domain.DailyReport, error) {
+	return domain.DailyReport{
+		StoreID:       storeID,
+		Date:          date,
+		Transactions:  4,
+		NetSalesCents: 120000,
+		ByPayment:     []domain.DailyReportPayment{{PaymentMethod: "cash", Transactions: 4, TotalCents: 120000}},
+	}, nil
+}
+
+func TestBuildDeliveryRendersCSVAndHTML(t *testing.T) {
+	delivery := BuildDelivery(domain.DailyReport{StoreID: "main-store", Date: "2026-03-10", Transactions: 2})
+
+	if !strings.Contains(delivery.CSV, "summary,transactions,2") {
+		t.Fatalf("expected CSV summary rows, got %q", delivery.CSV)
+	}
+	if !strings.Contains(delivery.HTML, "Daily Report 2026-03-10") {
+		t.Fatalf("expected printable HTML, got %q", delivery.HTML)
+	}
+	if delivery.Subject != "Daily report main-store - 2026-03-10" {
+		t.Fatalf("unexpected subject %q", delivery.Subject)
+	}
+}
+
+func TestEndOfDayReporterRetriesAndSendsOncePerDay(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	var received DailyReportDelivery
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	callCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+
+	loc := time.FixedZone("UTC+7", 7*3600)
+	reporter := NewEndOfDayReporter(staticReportSource{}, "main-store", []string{server.URL}, 22*time.Hour, loc)
+	reporter.retryDelay = time.Millisecond
+
+	reporter.tick(context.Background(), time.Date(2026, 3, 10, 21, 59, 0, 0, loc))
+	if callCount() != 0 {
+		t.Fatalf("expected no delivery before the send time, got %d calls", callCount())
+	}
+
+	reporter.tick(context.Background(), time.Date(2026, 3, 10, 22, 5, 0, 0, loc))
+	if callCount() != 2 {
+		t.Fatalf("expected one failed attempt and one retry, got %d calls", callCount())
+	}
+	mu.Lock()
+	payload := received
+	mu.Unlock()
+	if payload.Date != "2026-03-10" || !strings.Contains(payload.CSV, "payment,cash_total_cents,120000") {
+		t.Fatalf("unexpected delivery payload: %+v", payload)
+	}
+
+	reporter.tick(context.Background(), time.Date(2026, 3, 10, 23, 0, 0, 0, loc))
+	if callCount() != 2 {
+		t.Fatalf("expected the day's report to be sent only once, got %d calls", callCount())
+	}
+}
+
+func TestEndOfDayReporterNextRun(t *testing.T) {
+	loc := time.FixedZone("UTC+7", 7*3600)
+	reporter := NewEndOfDayReporter(staticReportSource{}, "main-store", []string{"http://example.invalid"}, 22*time.Hour, loc)
+
+	before := time.Date(2026, 3, 10, 9, 0, 0, 0, loc)
+	if next := reporter.nextRun(before, time.Minute); !next.Equal(time.Date(2026, 3, 10, 22, 0, 0, 0, loc)) {
+		t.Fatalf("expected today's send time, got %s", next)
+	}
+
+	due := time.Date(2026, 3, 10, 22, 5, 0, 0, loc)
+	if next := reporter.nextRun(due, time.Minute); !next.Equal(due.Add(time.Minute)) {
+		t.Fatalf("expected the next check while undelivered, got %s", next)
+	}
+
+	reporter.markDelivered("http://example.invalid", "2026-03-10")
+	if next := reporter.nextRun(due, time.Minute); !next.Equal(time.Date(2026, 3, 11, 22, 0, 0, 0, loc)) {
+		t.Fatalf("expected tomorrow's send time once delivered, got %s", next)
+	}
+}
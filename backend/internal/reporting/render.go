@@ -0,0 +1,94 @@
+package reporting
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+
+	"kasirinaja/backend/internal/domain"
+)
+
+// DailyCSV renders a daily report as section,key,value CSV rows.
+func DailyCSV(report domain.DailyReport) string {
+	lines := []string{
+		"section,key,value",
+		fmt.Sprintf("summary,date,%s", report.Date),
+		fmt.Sprintf("summary,store_id,%s", report.StoreID),
+		fmt.Sprintf("summary,transactions,%d", report.Transactions),
+		fmt.Sprintf("summary,gross_sales_cents,%d", report.GrossSalesCents),
+		fmt.Sprintf("summary,discount_cents,%d", report.DiscountCents),
+		fmt.Sprintf("summary,tax_cents,%d", report.TaxCents),
+		fmt.Sprintf("summary,net_sales_cents,%d", report.NetSalesCents),
+		fmt.Sprintf("summary,estimated_margin_cents,%d", report.EstimatedMarginCents),
+		fmt.Sprintf("summary,cost_of_goods_cents,%d", report.CostOfGoodsCents),
+		fmt.Sprintf("summary,gross_profit_cents,%d", report.GrossProfitCents),
+		fmt.Sprintf("summary,write_off_cost_cents,%d", report.WriteOffCostCents),
+	}
+	for _, payment := range report.ByPayment {
+		lines = append(lines, fmt.Sprintf("payment,%s_transactions,%d", payment.PaymentMethod, payment.Transactions))
+		lines = append(lines, fmt.Sprintf("payment,%s_total_cents,%d", payment.PaymentMethod, payment.TotalCents))
+	}
+	for _, terminal := range report.ByTerminal {
+		lines = append(lines, fmt.Sprintf("terminal,%s_transactions,%d", terminal.TerminalID, terminal.Transactions))
+		lines = append(lines, fmt.Sprintf("terminal,%s_total_cents,%d", terminal.TerminalID, terminal.TotalCents))
+	}
+	for _, rate := range report.ByTaxRate {
+		label := strconv.FormatFloat(rate.RatePercent, 'f', -1, 64)
+		lines = append(lines, fmt.Sprintf("tax_rate,%s_taxable_base_cents,%d", label, rate.TaxableBaseCents))
+		lines = append(lines, fmt.Sprintf("tax_rate,%s_tax_cents,%d", label, rate.TaxCents))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// dailyHTMLTmpl is the html/template used to render printable daily reports.
+// All user-controlled fields are auto-escaped by html/template to prevent XSS.
+var dailyHTMLTmpl = template.Must(template.New("daily-report").Parse(`<!doctype html>
+<html>
+<head>
+  <meta charset="utf-8" />
+  <title>Daily Report {{.Date}}</title>
+  <style>
+    body { font-family: sans-serif; margin: 24px; }
+    table { width: 100%; border-collapse: collapse; margin-top: 8px; }
+    th, td { border: 1px solid #ddd; padding: 6px; font-size: 13px; }
+    h2, h3 { margin-bottom: 4px; }
+  </style>
+</head>
+<body>
+  <h2>Daily Report {{.Date}}</h2>
+  <p>Store: {{.StoreID}}</p>
+  <p>Transactions: {{.Transactions}}</p>
+  <p>Gross: {{.GrossSalesCents}} | Discount: {{.DiscountCents}} | Tax: {{.TaxCents}} | Net: {{.NetSalesCents}} | Margin: {{.EstimatedMarginCents}} | COGS: {{.CostOfGoodsCents}} | Gross profit: {{.GrossProfitCents}} | Write-off: {{.WriteOffCostCents}}</p>
+
+  <h3>By Payment</h3>
+  <table>
+    <thead><tr><th>Payment</th><th>Transactions</th><th>Total Cents</th></tr></thead>
+    <tbody>{{range .ByPayment}}<tr><td>{{.PaymentMethod}}</td><td style="text-align:right;">{{.Transactions}}</td><td style="text-align:right;">{{.TotalCents}}</td></tr>{{end}}</tbody>
+  </table>
+
+  <h3>By Terminal</h3>
+  <table>
+    <thead><tr><th>Terminal</th><th>Transactions</th><th>Total Cents</th></tr></thead>
+    <tbody>{{range .ByTerminal}}<tr><td>{{.TerminalID}}</td><td style="text-align:right;">{{.Transactions}}</td><td style="text-align:right;">{{.TotalCents}}</td></tr>{{end}}</tbody>
+  </table>
+
+  <h3>By Tax Rate</h3>
+  <table>
+    <thead><tr><th>Rate %</th><th>Taxable Base Cents</th><th>Tax Cents</th></tr></thead>
+    <tbody>{{range .ByTaxRate}}<tr><td>{{.RatePercent}}</td><td style="text-align:right;">{{.TaxableBaseCents}}</td><td style="text-align:right;">{{.TaxCents}}</td></tr>{{end}}</tbody>
+  </table>
+</body>
+</html>
+`))
+
+// DailyHTML renders a daily report as a printable HTML page.
+func DailyHTML(report domain.DailyReport) string {
+	var buf bytes.Buffer
+	if err := dailyHTMLTmpl.Execute(&buf, report); err != nil {
+		// Fallback: return a plain-text error page rather than leaking internal details.
+		return "<!doctype html><html><body><p>Report rendering error.</p></body></html>"
+	}
+	return buf.String()
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"kasirinaja/backend/internal/domain"
+	"kasirinaja/backend/internal/jobs"
+)
+
+// StockAlertNotifier delivers stock alerts. Notify is called from checkout
+// and sweep goroutines and must not block.
+type StockAlertNotifier interface {
+	Notify(alert domain.StockAlert)
+}
+
+// SetStockAlertNotifier enables low-stock and expiring-lot alerts. A nil
+// notifier disables them.
+func (s *Service) SetStockAlertNotifier(notifier StockAlertNotifier) {
+	s.stockAlerts = notifier
+}
+
+// alertLowStock checks the SKUs sold by a checkout against their reorder
+// point and alerts once when a SKU drops to or below it. Later sales while the
+// SKU stays low do not alert again until it is seen above the point, either
+// by a later check or by the expiring-lot sweep. Failures are only logged:
+// alerting never affects the sale.
+func (s *Service) alertLowStock(ctx context.Context, created domain.Transaction) {
+	skus := make([]string, 0, len(created.Items))
+	for _, item := range created.Items {
+		if !slices.Contains(skus, item.SKU) {
+			skus = append(skus, item.SKU)
+		}
+	}
+	sort.Strings(skus)
+
+	products, err := s.repo.GetProductsBySKUs(ctx, skus)
+	if err != nil {
+		log.Printf("[service] WARN: low-stock check for %s: %v", created.ID, err)
+		return
+	}
+	stockMap, err := s.repo.GetStockMap(ctx, created.StoreID, skus)
+	if err != nil {
+		log.Printf("[service] WARN: low-stock check for %s: %v", created.ID, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, sku := range skus {
+		product, ok := products[sku]
+		if !ok || !product.Active {
+			continue
+		}
+		current := stockMap[sku]
+		reorderPoint := defaultReorderPoint(product)
+		if !s.lowStock.update(created.StoreID, sku, current <= reorderPoint) {
+			continue
+		}
+		s.stockAlerts.Notify(domain.StockAlert{
+			Type:          domain.StockAlertLowStock,
+			StoreID:       created.StoreID,
+			SKU:           sku,
+			ProductName:   product.Name,
+			Qty:           current,
+			ReorderPoint:  reorderPoint,
+			TransactionID: created.ID,
+			CreatedAt:     now,
+		})
+	}
+}
+
+// lowStockAlerts remembers which SKUs are known to be at or below their
+// reorder point, so each crossing alerts once. It is kept in memory only: a
+// SKU that is still low after a restart alerts again on its next sale.
+type lowStockAlerts struct {
+	mu  sync.Mutex
+	low map[string]bool
+}
+
+// update records whether storeID's sku is low and reports whether it just
+// became low.
+func (a *lowStockAlerts) update(storeID string, sku string, low bool) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := storeID + "|" + sku
+	if !low {
+		delete(a.low, key)
+		return false
+	}
+	if a.low[key] {
+		return false
+	}
+	if a.low == nil {
+		a.low = map[string]bool{}
+	}
+	a.low[key] = true
+	return true
+}
+
+// skus returns the SKUs of storeID currently recorded as low.
+func (a *lowStockAlerts) skus(storeID string) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var skus []string
+	for key := range a.low {
+		if sku, ok := strings.CutPrefix(key, storeID+"|"); ok {
+			skus = append(skus, sku)
+		}
+	}
+	return skus
+}
+
+// clearRestockedSKUs forgets low SKUs of storeID that have been restocked
+// above their reorder point since they alerted, so the next drop alerts
+// again even if no sale saw the stock in between.
+func (s *Service) clearRestockedSKUs(ctx context.Context, storeID string) error {
+	skus := s.lowStock.skus(storeID)
+	if len(skus) == 0 {
+		return nil
+	}
+	products, err := s.repo.GetProductsBySKUs(ctx, skus)
+	if err != nil {
+		return err
+	}
+	stockMap, err := s.repo.GetStockMap(ctx, storeID, skus)
+	if err != nil {
+		return err
+	}
+	for _, sku := range skus {
+		if product, ok := products[sku]; !ok || stockMap[sku] > defaultReorderPoint(product) {
+			s.lowStock.update(storeID, sku, false)
+		}
+	}
+	return nil
+}
+
+// RunExpiringLotAlerts sweeps storeID every interval for lots expiring within
+// withinDays and alerts once for each lot, until ctx is cancelled. Lots
+// already alerted are remembered in memory only, so a restart alerts for
+// them again. The sweep also rearms low-stock alerts for restocked SKUs.
+func (s *Service) RunExpiringLotAlerts(ctx context.Context, storeID string, withinDays int, interval time.Duration) {
+	if interval <= 0 || withinDays < 0 {
+		return
+	}
+	if storeID == "" {
+		storeID = s.defaultStoreID
+	}
+	alerted := map[string]bool{}
+	sweep := func() {
+		defer s.jobs.Scheduled(jobs.ExpiringLotAlerts, time.Now().Add(interval))
+		if s.stockAlerts == nil {
+			return
+		}
+		lotErr := s.alertExpiringLots(ctx, storeID, withinDays, alerted)
+		if lotErr != nil {
+			log.Printf("[service] WARN: expiring lot sweep: %v", lotErr)
+		}
+		stockErr := s.clearRestockedSKUs(ctx, storeID)
+		if stockErr != nil {
+			log.Printf("[service] WARN: low-stock sweep: %v", stockErr)
+		}
+		s.jobs.Ran(jobs.ExpiringLotAlerts, time.Now(), errors.Join(lotErr, stockErr))
+	}
+
+	sweep()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sweep()
+		}
+	}
+}
+
+// alertExpiringLots alerts for expiring lots not in alerted and records them
+// there. Lots that dropped off the list, because they were sold out or
+// written off, are forgotten.
+func (s *Service) alertExpiringLots(ctx context.Context, storeID string, withinDays int, alerted map[string]bool) error {
+	lots, err := s.repo.ListExpiringLots(ctx, storeID, withinDays)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	current := make(map[string]bool, len(lots))
+	for _, lot := range lots {
+		current[lot.LotID] = true
+		if alerted[lot.LotID] || lot.QtyAvailable < 1 {
+			continue
+		}
+		expiry := lot.ExpiryDate
+		s.stockAlerts.Notify(domain.StockAlert{
+			Type:        domain.StockAlertLotExpiring,
+			StoreID:     storeID,
+			SKU:         lot.SKU,
+			ProductName: lot.ProductName,
+			Qty:         lot.QtyAvailable,
+			LotID:       lot.LotID,
+			LotCode:     lot.LotCode,
+			ExpiryDate:  &expiry,
+			CreatedAt:   now,
+		})
+		alerted[lot.LotID] = true
+	}
+	for lotID := range alerted {
+		if !current[lotID] {
+			delete(alerted, lotID)
+		}
+	}
+	return nil
+}
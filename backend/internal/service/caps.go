@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"kasirinaja/backend/internal/domain"
+)
+
+// ErrDailyCapExceeded is returned when a void or refund would take the
+// acting user past their daily cap and the cap was not overridden.
+var ErrDailyCapExceeded = errors.New("daily void or refund cap exceeded")
+
+// SetDailyCaps limits how many sales each user may void and how much they
+// may refund per store day. Zero disables a cap; both are off by default.
+func (s *Service) SetDailyCaps(voids int, refundCents int64) {
+	s.dailyVoidCap = max(voids, 0)
+	s.dailyRefundCapCents = max(refundCents, 0)
+}
+
+// dailyCapLocks serializes each user's voids and refunds while daily caps
+// are on. Usage is read back from audit rows written after the sale is
+// changed, so without it two concurrent refunds could both pass the check.
+type dailyCapLocks struct {
+	mu    sync.Mutex
+	users map[string]*sync.Mutex
+}
+
+// lock takes username's lock and returns the function releasing it.
+func (l *dailyCapLocks) lock(username string) func() {
+	l.mu.Lock()
+	if l.users == nil {
+		l.users = map[string]*sync.Mutex{}
+	}
+	userMu := l.users[username]
+	if userMu == nil {
+		userMu = &sync.Mutex{}
+		l.users[username] = userMu
+	}
+	l.mu.Unlock()
+
+	userMu.Lock()
+	return userMu.Unlock
+}
+
+// lockDailyCaps holds the acting user's cap lock until the returned function
+// is called, from the cap check until the void or refund has been audited.
+// It does nothing while both caps are off.
+func (s *Service) lockDailyCaps(ctx context.Context) func() {
+	actor, ok := ActorFromContext(ctx)
+	if !ok || (s.dailyVoidCap == 0 && s.dailyRefundCapCents == 0) {
+		return func() {}
+	}
+	return s.capLocks.lock(actor.Username)
+}
+
+// dailyUsage counts the voids and sums the refunds the acting user has made
+// in storeID today, from the audit log.
+func (s *Service) dailyUsage(ctx context.Context, storeID string) (int, int64, error) {
+	actor, ok := ActorFromContext(ctx)
+	if !ok {
+		return 0, 0, nil
+	}
+	from, to, err := s.storeDay("")
+	if err != nil {
+		return 0, 0, err
+	}
+	filter := domain.AuditLogFilter{Actions: []string{"void_transaction", "refund_transaction"}, Actor: actor.Username}
+
+	const pageSize = 500
+	voids := 0
+	refundCents := int64(0)
+	var before *domain.AuditLogCursor
+	for {
+		logs, err := s.repo.ListAuditLogs(ctx, storeID, from, to, filter, before, pageSize)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, entry := range logs {
+			if entry.Action == "void_transaction" {
+				voids++
+				continue
+			}
+			refundCents += auditRefundAmount(entry.Detail)
+		}
+		if len(logs) < pageSize {
+			return voids, refundCents, nil
+		}
+		last := logs[len(logs)-1]
+		before = &domain.AuditLogCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+}
+
+// auditRefundAmount reads the amount out of a refund_transaction detail,
+// which Refund writes as "amount=<cents>,reason=<reason>".
+func auditRefundAmount(detail string) int64 {
+	rest, ok := strings.CutPrefix(detail, "amount=")
+	if !ok {
+		return 0
+	}
+	amount, _, _ := strings.Cut(rest, ",")
+	cents, err := strconv.ParseInt(amount, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return cents
+}
+
+// checkDailyCaps rejects a void (voids > 0) or a refund of refundCents that
+// would exceed the acting user's daily cap. An admin may override the cap;
+// the handlers have already checked the manager PIN. Overrides are audited
+// as high severity.
+func (s *Service) checkDailyCaps(ctx context.Context, tx *domain.Transaction, voids int, refundCents int64, override bool) error {
+	if (voids == 0 || s.dailyVoidCap == 0) && (refundCents == 0 || s.dailyRefundCapCents == 0) {
+		return nil
+	}
+	usedVoids, usedRefundCents, err := s.dailyUsage(ctx, tx.StoreID)
+	if err != nil {
+		return err
+	}
+
+	var exceeded string
+	switch {
+	case voids > 0 && s.dailyVoidCap > 0 && usedVoids+voids > s.dailyVoidCap:
+		exceeded = fmt.Sprintf("voids=%d,cap=%d", usedVoids+voids, s.dailyVoidCap)
+	case refundCents > 0 && s.dailyRefundCapCents > 0 && usedRefundCents+refundCents > s.dailyRefundCapCents:
+		exceeded = fmt.Sprintf("refund_cents=%d,cap=%d", usedRefundCents+refundCents, s.dailyRefundCapCents)
+	default:
+		return nil
+	}
+	if !override {
+		return fmt.Errorf("%w: %s", ErrDailyCapExceeded, exceeded)
+	}
+	actor, ok := ActorFromContext(ctx)
+	if !ok || actor.Role != "admin" {
+		return fmt.Errorf("%w for daily cap override", ErrAdminRequired)
+	}
+	s.logAudit(ctx, tx.StoreID, "daily_cap_override", "transaction", tx.ID, "severity=high,"+exceeded)
+	return nil
+}
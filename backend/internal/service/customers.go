@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"kasirinaja/backend/internal/domain"
+	"kasirinaja/backend/internal/store"
+)
+
+// customerIDPattern accepts phone numbers, optionally with a leading '+', and
+// member codes of letters, digits, '.', '_' or '-'.
+var customerIDPattern = regexp.MustCompile(`^\+?[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+func validCustomerID(customerID string) bool {
+	return customerIDPattern.MatchString(customerID)
+}
+
+// ListCustomerTransactions returns up to limit of a customer's sales, newest
+// first, and what they have spent on the ones still paid.
+func (s *Service) ListCustomerTransactions(ctx context.Context, customerID string, limit int) (domain.CustomerTransactionsResponse, error) {
+	customerID = strings.TrimSpace(customerID)
+	if !validCustomerID(customerID) {
+		return domain.CustomerTransactionsResponse{}, store.ErrInvalidTransaction
+	}
+	if limit < 1 || limit > 500 {
+		limit = 100
+	}
+
+	transactions, err := s.repo.ListTransactionsByCustomer(ctx, customerID, limit)
+	if err != nil {
+		return domain.CustomerTransactionsResponse{}, err
+	}
+	resp := domain.CustomerTransactionsResponse{
+		CustomerID:   customerID,
+		Transactions: make([]domain.CustomerTransaction, 0, len(transactions)),
+	}
+	for _, tx := range transactions {
+		itemCount := 0
+		for _, item := range tx.Items {
+			itemCount += item.Qty
+		}
+		if tx.Status == domain.TxStatusPaid {
+			resp.PaidTotalCents += tx.TotalCents
+		}
+		resp.Transactions = append(resp.Transactions, domain.CustomerTransaction{
+			TransactionID: tx.ID,
+			StoreID:       tx.StoreID,
+			TerminalID:    tx.TerminalID,
+			Status:        tx.Status,
+			PaymentMethod: tx.PaymentMethod,
+			TotalCents:    tx.TotalCents,
+			ItemCount:     itemCount,
+			CreatedAt:     tx.CreatedAt,
+		})
+	}
+	return resp, nil
+}
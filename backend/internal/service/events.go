@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"kasirinaja/backend/internal/domain"
+	"kasirinaja/backend/internal/store"
+)
+
+// RecommendationEventWriter persists recommendation events produced on the
+// request path.
+type RecommendationEventWriter interface {
+	Write(ctx context.Context, events []domain.RecommendationEvent)
+	Close() error
+}
+
+type syncEventWriter struct {
+	repo store.Repository
+}
+
+func (w syncEventWriter) Write(ctx context.Context, events []domain.RecommendationEvent) {
+	for _, event := range events {
+		_ = w.repo.CreateRecommendationEvent(ctx, event)
+	}
+}
+
+func (w syncEventWriter) Close() error {
+	return nil
+}
+
+// AsyncEventWriter buffers recommendation events in memory and inserts them in
+// batches from a background goroutine. When the buffer is full the event is
+// written synchronously instead of being dropped, and a failed batch is
+// retried one event at a time.
+type AsyncEventWriter struct {
+	repo          store.Repository
+	events        chan domain.RecommendationEvent
+	batchSize     int
+	flushInterval time.Duration
+	dropped       atomic.Int64
+
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+}
+
+func NewAsyncEventWriter(repo store.Repository, bufferSize int, batchSize int, flushInterval time.Duration) *AsyncEventWriter {
+	if bufferSize < 1 {
+		bufferSize = 1024
+	}
+	if batchSize < 1 {
+		batchSize = 100
+	}
+	if flushInterval <= 0 {
+		flushInterval = time.Second
+	}
+
+	w := &AsyncEventWriter{
+		repo:          repo,
+		events:        make(chan domain.RecommendationEvent, bufferSize),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		done:          make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *AsyncEventWriter) Write(ctx context.Context, events []domain.RecommendationEvent) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	for _, event := range events {
+		if w.closed {
+			_ = w.repo.CreateRecommendationEvent(ctx, event)
+			continue
+		}
+		select {
+		case w.events <- event:
+		default:
+			_ = w.repo.CreateRecommendationEvent(ctx, event)
+		}
+	}
+}
+
+// Dropped returns how many events could not be persisted, even one at a
+// time after their batch failed.
+func (w *AsyncEventWriter) Dropped() int64 {
+	return w.dropped.Load()
+}
+
+// Close stops accepting buffered writes and blocks until everything already
+// queued has been flushed.
+func (w *AsyncEventWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		<-w.done
+		return nil
+	}
+	w.closed = true
+	close(w.events)
+	w.mu.Unlock()
+
+	<-w.done
+	return nil
+}
+
+func (w *AsyncEventWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]domain.RecommendationEvent, 0, w.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := w.repo.CreateRecommendationEventsBatch(context.Background(), batch); err != nil {
+			log.Printf("recommendation events: batch insert of %d failed, retrying one by one: %v", len(batch), err)
+			for _, event := range batch {
+				if err := w.repo.CreateRecommendationEvent(context.Background(), event); err != nil {
+					w.dropped.Add(1)
+				}
+			}
+		}
+		batch = make([]domain.RecommendationEvent, 0, w.batchSize)
+	}
+
+	for {
+		select {
+		case event, ok := <-w.events:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= w.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
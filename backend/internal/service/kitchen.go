@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"kasirinaja/backend/internal/domain"
+)
+
+// ErrNoKitchenItems is returned when a kitchen ticket is requested for a
+// sale without any item in a kitchen category.
+var ErrNoKitchenItems = errors.New("transaction has no kitchen items")
+
+var (
+	escposLargeText  = []byte{0x1d, 0x21, 0x11}
+	escposNormalText = []byte{0x1d, 0x21, 0x00}
+)
+
+// SetKitchenCategories limits kitchen tickets to items in the given product
+// categories. With no categories every item is sent to the kitchen.
+func (s *Service) SetKitchenCategories(categories []string) {
+	s.kitchenCategories = map[string]bool{}
+	for _, category := range categories {
+		if category = strings.ToLower(strings.TrimSpace(category)); category != "" {
+			s.kitchenCategories[category] = true
+		}
+	}
+}
+
+// BuildKitchenTicket renders a prep ticket for a sale: the transaction ID and
+// time in large print, then item names and quantities grouped by category,
+// without any prices.
+func (s *Service) BuildKitchenTicket(ctx context.Context, req domain.HardwareReceiptRequest) (domain.HardwareReceiptResponse, error) {
+	tx, width, err := s.printableTransaction(ctx, req)
+	if err != nil {
+		return domain.HardwareReceiptResponse{}, err
+	}
+	products, err := s.receiptProducts(ctx, *tx)
+	if err != nil {
+		return domain.HardwareReceiptResponse{}, err
+	}
+
+	stations := map[string][]domain.TransactionLine{}
+	for _, item := range tx.Items {
+		category := strings.ToLower(products[item.SKU].Category)
+		if len(s.kitchenCategories) > 0 && !s.kitchenCategories[category] {
+			continue
+		}
+		stations[category] = append(stations[category], item)
+	}
+	if len(stations) == 0 {
+		return domain.HardwareReceiptResponse{}, ErrNoKitchenItems
+	}
+	categories := make([]string, 0, len(stations))
+	for category := range stations {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	// Large print is double width, so it gets half the columns.
+	title := receiptLayout{width: width / 2}
+	title.text(tx.ID)
+	title.text(tx.CreatedAt.In(s.storeLocation).Format("15:04"))
+
+	layout := receiptLayout{width: width}
+	layout.text("Terminal: " + tx.TerminalID)
+	layout.text("Date: " + tx.CreatedAt.In(s.storeLocation).Format("2006-01-02 15:04:05"))
+	for _, category := range categories {
+		layout.rule('=')
+		station := strings.ToUpper(category)
+		if station == "" {
+			station = "LAINNYA"
+		}
+		layout.text(station)
+		layout.rule('-')
+		for _, item := range stations[category] {
+			layout.text(fmt.Sprintf("%dx %s", item.Qty, lineName(item, products)))
+		}
+	}
+	layout.rule('=')
+	layout.lines = append(layout.lines, "")
+
+	escpos := append([]byte{}, escposInit...)
+	escpos = append(escpos, escposLargeText...)
+	escpos = append(escpos, escposLines(title.lines)...)
+	escpos = append(escpos, escposNormalText...)
+	escpos = append(escpos, escposLines(layout.lines)...)
+	escpos = append(escpos, escposCut...)
+
+	return domain.HardwareReceiptResponse{
+		TransactionID: tx.ID,
+		EscposBase64:  base64.StdEncoding.EncodeToString(escpos),
+		PreviewText:   strings.Join(append(title.lines, layout.lines...), "\n"),
+		FileName:      fmt.Sprintf("kitchen-%s.bin", tx.ID),
+	}, nil
+}
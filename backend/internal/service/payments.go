@@ -0,0 +1,136 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"kasirinaja/backend/internal/domain"
+	"kasirinaja/backend/internal/store"
+)
+
+var (
+	// ErrInvalidPaymentReference is returned when a non-cash payment or split
+	// leg has no reference or one that does not fit its method's format.
+	ErrInvalidPaymentReference = fmt.Errorf("%w: invalid payment reference", store.ErrInvalidTransaction)
+	// ErrDuplicatePaymentReference is returned when two legs of a split
+	// payment carry the same reference.
+	ErrDuplicatePaymentReference = fmt.Errorf("%w: duplicate payment reference", store.ErrInvalidTransaction)
+	// ErrPaymentMethodNotEnabled is returned when a sale, or one of its split
+	// legs, is paid with a method the store does not accept.
+	ErrPaymentMethodNotEnabled = fmt.Errorf("%w: payment method not enabled", store.ErrInvalidTransaction)
+)
+
+// DefaultPaymentMethods are the methods a store accepts when neither it nor
+// the default configuration lists its own. Split payments and store credit
+// legs are not methods of their own and are always accepted.
+var DefaultPaymentMethods = []string{"cash", "card", "qris", "ewallet"}
+
+// SetPaymentMethods sets the payment methods storeID accepts, or the default
+// for every store without its own list when storeID is empty. Every method
+// must be one of DefaultPaymentMethods and at least one is required.
+func (s *Service) SetPaymentMethods(storeID string, methods []string) error {
+	requested := map[string]bool{}
+	for _, method := range methods {
+		method = strings.ToLower(strings.TrimSpace(method))
+		if method == "" {
+			continue
+		}
+		if !slices.Contains(DefaultPaymentMethods, method) {
+			return fmt.Errorf("%w: unknown payment method %q, want one of %s", store.ErrInvalidInput, method, strings.Join(DefaultPaymentMethods, ", "))
+		}
+		requested[method] = true
+	}
+	if len(requested) == 0 {
+		return fmt.Errorf("%w: at least one payment method is required", store.ErrInvalidInput)
+	}
+	// Listed in the order of DefaultPaymentMethods, so clients show the
+	// buttons the same way in every store.
+	enabled := make([]string, 0, len(requested))
+	for _, method := range DefaultPaymentMethods {
+		if requested[method] {
+			enabled = append(enabled, method)
+		}
+	}
+	s.paymentMethods[strings.TrimSpace(storeID)] = enabled
+	return nil
+}
+
+// PaymentMethods returns the payment methods storeID accepts.
+func (s *Service) PaymentMethods(storeID string) ([]string, error) {
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return nil, err
+	}
+	if methods, ok := s.paymentMethods[storeID]; ok {
+		return slices.Clone(methods), nil
+	}
+	if methods, ok := s.paymentMethods[""]; ok {
+		return slices.Clone(methods), nil
+	}
+	return slices.Clone(DefaultPaymentMethods), nil
+}
+
+// checkPaymentMethodEnabled rejects method when storeID does not accept it.
+// Store credit is a balance the store issued rather than a way of paying, so
+// it is always accepted.
+func (s *Service) checkPaymentMethodEnabled(storeID string, method string) error {
+	if method == "store_credit" {
+		return nil
+	}
+	methods, err := s.PaymentMethods(storeID)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(methods, method) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is not accepted in store %s", ErrPaymentMethodNotEnabled, method, storeID)
+}
+
+// paymentReferenceLength bounds reference length per non-cash method: card
+// approval codes are short, QRIS and e-wallet providers issue longer
+// transaction IDs.
+var paymentReferenceLength = map[string]struct{ min, max int }{
+	"card":    {4, 32},
+	"qris":    {8, 64},
+	"ewallet": {6, 64},
+}
+
+var paymentReferencePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+
+// validatePaymentReference checks reference against method's format. Methods
+// without a rule accept any non-empty reference.
+func validatePaymentReference(method string, reference string) error {
+	if reference == "" {
+		return fmt.Errorf("%w: %s reference required", ErrInvalidPaymentReference, method)
+	}
+	bounds, ok := paymentReferenceLength[method]
+	if !ok {
+		return nil
+	}
+	if len(reference) < bounds.min || len(reference) > bounds.max || !paymentReferencePattern.MatchString(reference) {
+		return fmt.Errorf("%w: %s reference %q must be %d to %d letters, digits, '.', '_', '/' or '-'", ErrInvalidPaymentReference, method, reference, bounds.min, bounds.max)
+	}
+	return nil
+}
+
+// validateSplitReferences checks the reference of every non-cash leg and
+// rejects a reference used by more than one leg, ignoring case.
+func validateSplitReferences(splits []domain.PaymentSplit) error {
+	seen := make(map[string]bool, len(splits))
+	for _, split := range splits {
+		if split.Method == "cash" {
+			continue
+		}
+		if err := validatePaymentReference(split.Method, split.Reference); err != nil {
+			return err
+		}
+		key := strings.ToUpper(split.Reference)
+		if seen[key] {
+			return fmt.Errorf("%w: %q", ErrDuplicatePaymentReference, split.Reference)
+		}
+		seen[key] = true
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"kasirinaja/backend/internal/domain"
+	"kasirinaja/backend/internal/store"
+	"kasirinaja/backend/internal/xid"
+)
+
+// checkoutPricing is the priced cart shared by checkout and quotes.
+type checkoutPricing struct {
+	products           map[string]domain.Product
+	lines              []domain.TransactionLine
+	subtotalCents      int64
+	promo              *domain.PromoRule
+	promoDiscountCents int64
+	discountCents      int64
+	taxCents           int64
+	totalCents         int64
+}
+
+// normalizeCheckoutRequest fills in the store and payment method defaults of
+// req and rejects payment methods, tax rates, discounts and customer IDs
+// checkout does not accept.
+func (s *Service) normalizeCheckoutRequest(req *domain.CheckoutRequest) error {
+	if err := s.resolveStoreID(&req.StoreID); err != nil {
+		return err
+	}
+	req.PaymentSplits = normalizePaymentSplits(req.PaymentSplits)
+	if len(req.PaymentSplits) > 0 {
+		req.PaymentMethod = "split"
+	}
+	if req.PaymentMethod == "" {
+		req.PaymentMethod = "cash"
+	}
+
+	if !isSupportedPaymentMethod(req.PaymentMethod) {
+		return fmt.Errorf("%w %q", store.ErrUnsupportedPaymentMethod, req.PaymentMethod)
+	}
+	if req.PaymentMethod != "split" {
+		if err := s.checkPaymentMethodEnabled(req.StoreID, req.PaymentMethod); err != nil {
+			return err
+		}
+	}
+	if req.TaxRatePercent < 0 || req.TaxRatePercent > 100 {
+		return store.ErrInvalidTaxRate
+	}
+	if req.DiscountCents < 0 {
+		return store.ErrInvalidDiscount
+	}
+
+	req.CustomerID = strings.TrimSpace(req.CustomerID)
+	if req.CustomerID != "" && !validCustomerID(req.CustomerID) {
+		return fmt.Errorf("%w: invalid customer id %q", store.ErrInvalidTransaction, req.CustomerID)
+	}
+
+	req.StoreCreditCode = strings.TrimSpace(req.StoreCreditCode)
+	if !req.ChangeAsCredit {
+		req.StoreCreditCode = ""
+		return nil
+	}
+	if req.PaymentMethod != "cash" && req.PaymentMethod != "split" {
+		return fmt.Errorf("%w: change as credit needs a cash or split payment", store.ErrInvalidTransaction)
+	}
+	if req.StoreCreditCode != "" && !xid.ValidClientID(req.StoreCreditCode) {
+		return fmt.Errorf("%w: invalid store credit code %q", store.ErrInvalidTransaction, req.StoreCreditCode)
+	}
+	return nil
+}
+
+// priceCart prices normalized cart items at current catalog prices, applies
+// the best promo on top of the manual discount and adds tax per line, at the
+// product's own rate or taxRatePercent. The combined discount never exceeds
+// the subtotal.
+func (s *Service) priceCart(ctx context.Context, items []domain.CartItem, manualDiscountCents int64, taxRatePercent float64) (checkoutPricing, error) {
+	skus := make([]string, 0, len(items))
+	for _, item := range items {
+		skus = append(skus, item.SKU)
+	}
+	products, missing, err := s.repo.GetProductsBySKUsDetailed(ctx, skus)
+	if err != nil {
+		return checkoutPricing{}, err
+	}
+	if len(missing) > 0 {
+		return checkoutPricing{}, &store.SKUError{SKU: missing[0], Err: store.ErrProductUnavailable}
+	}
+
+	today := s.storeDate()
+	pricing := checkoutPricing{products: products, lines: make([]domain.TransactionLine, 0, len(items))}
+	for _, item := range items {
+		product := products[item.SKU]
+		if !store.AvailableOn(product, today) {
+			return checkoutPricing{}, &store.SKUError{SKU: item.SKU, Err: store.ErrProductOutOfSeason}
+		}
+		if product.Serialized && len(item.Serials) != item.Qty {
+			return checkoutPricing{}, fmt.Errorf("%w: sku %s needs one serial per unit", store.ErrInvalidSerials, item.SKU)
+		}
+		if !product.Serialized && len(item.Serials) > 0 {
+			return checkoutPricing{}, fmt.Errorf("%w: sku %s is not serialized", store.ErrInvalidSerials, item.SKU)
+		}
+		pricing.lines = append(pricing.lines, domain.TransactionLine{
+			SKU:            item.SKU,
+			Qty:            item.Qty,
+			UnitPriceCents: product.PriceCents,
+			TaxRatePercent: store.LineTaxRate(product, taxRatePercent),
+		})
+		pricing.subtotalCents += int64(item.Qty) * product.PriceCents
+	}
+
+	pricing.promo, pricing.promoDiscountCents, err = s.bestPromo(ctx, pricing.subtotalCents)
+	if err != nil {
+		return checkoutPricing{}, err
+	}
+	pricing.discountCents = min(manualDiscountCents+pricing.promoDiscountCents, pricing.subtotalCents)
+	pricing.taxCents = store.ApplyLineTaxes(pricing.lines, pricing.discountCents)
+	pricing.totalCents = pricing.subtotalCents - pricing.discountCents + pricing.taxCents
+	return pricing, nil
+}
+
+// QuoteCheckout prices a checkout request the way Checkout would, without
+// reserving stock, needing an open shift or recording anything. Change, or
+// the store credit replacing it, is reported for cash payments that cover
+// the total and for splits whose cash legs overpay into store credit.
+func (s *Service) QuoteCheckout(ctx context.Context, req domain.CheckoutRequest) (domain.CheckoutQuoteResponse, error) {
+	if err := s.normalizeCheckoutRequest(&req); err != nil {
+		return domain.CheckoutQuoteResponse{}, err
+	}
+	normalized := normalizeItems(req.CartItems)
+	if len(normalized) == 0 {
+		return domain.CheckoutQuoteResponse{}, store.ErrInvalidTransaction
+	}
+	sort.Slice(normalized, func(i, j int) bool { return normalized[i].SKU < normalized[j].SKU })
+
+	pricing, err := s.priceCart(ctx, normalized, req.DiscountCents, req.TaxRatePercent)
+	if err != nil {
+		return domain.CheckoutQuoteResponse{}, err
+	}
+
+	resp := domain.CheckoutQuoteResponse{
+		StoreID:            req.StoreID,
+		Lines:              make([]domain.QuoteLine, 0, len(normalized)),
+		SubtotalCents:      pricing.subtotalCents,
+		PromoDiscountCents: pricing.promoDiscountCents,
+		DiscountCents:      pricing.discountCents,
+		TaxCents:           pricing.taxCents,
+		TotalCents:         pricing.totalCents,
+		AppliedPromos:      []domain.AppliedPromo{},
+	}
+	for _, line := range pricing.lines {
+		resp.Lines = append(resp.Lines, domain.QuoteLine{
+			SKU:            line.SKU,
+			Name:           pricing.products[line.SKU].Name,
+			Qty:            line.Qty,
+			UnitPriceCents: line.UnitPriceCents,
+			LineTotalCents: int64(line.Qty) * line.UnitPriceCents,
+			TaxRatePercent: line.TaxRatePercent,
+			TaxCents:       line.TaxCents,
+		})
+		resp.ItemCount += line.Qty
+	}
+	if pricing.promo != nil && pricing.promoDiscountCents > 0 {
+		resp.AppliedPromos = append(resp.AppliedPromos, domain.AppliedPromo{
+			PromoID:       pricing.promo.ID,
+			Name:          pricing.promo.Name,
+			DiscountCents: pricing.promoDiscountCents,
+		})
+	}
+	if req.PaymentMethod == "cash" {
+		resp.CashReceived = req.CashReceivedCents
+		resp.ChangeCents = max(req.CashReceivedCents-pricing.totalCents, 0)
+		if req.ChangeAsCredit {
+			resp.StoreCreditCents, resp.ChangeCents = resp.ChangeCents, 0
+		}
+	}
+	if req.PaymentMethod == "split" {
+		// Mirrors prepareCheckout: a split only overpays when the change,
+		// taken from its cash legs, is kept as store credit.
+		splitTotal, splitCash := int64(0), int64(0)
+		for _, split := range req.PaymentSplits {
+			splitTotal += split.AmountCents
+			if split.Method == "cash" {
+				splitCash += split.AmountCents
+			}
+		}
+		resp.CashReceived = splitTotal
+		if overpaid := splitTotal - pricing.totalCents; overpaid > 0 && req.ChangeAsCredit && overpaid <= splitCash {
+			resp.StoreCreditCents = overpaid
+		}
+	}
+	return resp, nil
+}
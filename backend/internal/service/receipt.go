@@ -0,0 +1,375 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"kasirinaja/backend/internal/domain"
+	"kasirinaja/backend/internal/i18n"
+	"kasirinaja/backend/internal/store"
+)
+
+// Receipt template limits: a header or footer may not push the items off a
+// short roll, and no template line may be wider than an 80mm printer.
+const (
+	maxReceiptTemplateLines = 8
+	maxReceiptLineWidth     = receiptWidthWide
+)
+
+// Characters per line on 58mm and 80mm thermal printers.
+const (
+	receiptWidthNarrow = 32
+	receiptWidthWide   = 48
+)
+
+var (
+	escposInit = []byte{0x1b, 0x40}
+	escposCut  = []byte{0x1d, 0x56, 0x41, 0x10}
+)
+
+func defaultReceiptTemplate() domain.ReceiptTemplate {
+	return domain.ReceiptTemplate{
+		HeaderLines: []string{"KasirinAja POS"},
+		FooterLines: []string{i18n.Default(i18n.DefaultLanguage).Message("receipt.thanks")},
+	}
+}
+
+// SetReceiptTemplate sets the header, footer and optional sections of
+// hardware receipts. Lines are trimmed; blank lines are dropped.
+func (s *Service) SetReceiptTemplate(template domain.ReceiptTemplate) error {
+	header, err := receiptTemplateLines("header", template.HeaderLines)
+	if err != nil {
+		return err
+	}
+	if len(header) == 0 {
+		return fmt.Errorf("%w: receipt header needs at least one line", store.ErrInvalidInput)
+	}
+	footer, err := receiptTemplateLines("footer", template.FooterLines)
+	if err != nil {
+		return err
+	}
+	template.HeaderLines = header
+	template.FooterLines = footer
+	s.receiptTemplate = template
+	return nil
+}
+
+func receiptTemplateLines(section string, lines []string) ([]string, error) {
+	cleaned := make([]string, 0, len(lines))
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if utf8.RuneCountInString(line) > maxReceiptLineWidth {
+			return nil, fmt.Errorf("%w: receipt %s line %q is longer than %d characters", store.ErrInvalidInput, section, line, maxReceiptLineWidth)
+		}
+		if strings.IndexFunc(line, unicode.IsControl) >= 0 {
+			return nil, fmt.Errorf("%w: receipt %s line %q contains control characters", store.ErrInvalidInput, section, line)
+		}
+		cleaned = append(cleaned, line)
+	}
+	if len(cleaned) > maxReceiptTemplateLines {
+		return nil, fmt.Errorf("%w: receipt %s has %d lines, at most %d are allowed", store.ErrInvalidInput, section, len(cleaned), maxReceiptTemplateLines)
+	}
+	return cleaned, nil
+}
+
+// SetDefaultLanguage sets the language of receipts that do not ask for one.
+func (s *Service) SetDefaultLanguage(lang string) error {
+	localizer, ok := i18n.Lookup(lang)
+	if !ok {
+		return fmt.Errorf("%w: unsupported language %q", store.ErrInvalidInput, lang)
+	}
+	s.defaultLanguage = localizer.Language()
+	return nil
+}
+
+// DefaultLanguage returns the language used when a request names none.
+func (s *Service) DefaultLanguage() string {
+	return s.defaultLanguage
+}
+
+// receiptFooterLine translates the stock Indonesian thank-you footer; other
+// footer lines are the operator's own text and are printed as configured.
+func receiptFooterLine(localizer i18n.Localizer, line string) string {
+	if line == i18n.Default(i18n.DefaultLanguage).Message("receipt.thanks") {
+		return localizer.Message("receipt.thanks")
+	}
+	return line
+}
+
+// SetReceiptLookupURL sets the digital receipt URL encoded in the receipt QR
+// code. A {transaction_id} placeholder is replaced with the transaction ID;
+// without one the ID is appended. An empty URL disables the QR code.
+func (s *Service) SetReceiptLookupURL(url string) {
+	s.receiptLookupURL = strings.TrimSpace(url)
+}
+
+func (s *Service) receiptURL(transactionID string) string {
+	if s.receiptLookupURL == "" {
+		return ""
+	}
+	if strings.Contains(s.receiptLookupURL, "{transaction_id}") {
+		return strings.ReplaceAll(s.receiptLookupURL, "{transaction_id}", transactionID)
+	}
+	return s.receiptLookupURL + transactionID
+}
+
+func (s *Service) BuildHardwareReceipt(ctx context.Context, req domain.HardwareReceiptRequest) (domain.HardwareReceiptResponse, error) {
+	tx, width, err := s.printableTransaction(ctx, req)
+	if err != nil {
+		return domain.HardwareReceiptResponse{}, err
+	}
+	products, err := s.receiptProducts(ctx, *tx)
+	if err != nil {
+		return domain.HardwareReceiptResponse{}, err
+	}
+
+	template := s.receiptTemplate
+	localizer, ok := i18n.Lookup(req.Language)
+	if !ok {
+		localizer = i18n.Default(s.defaultLanguage)
+	}
+	msg := localizer.Message
+	layout := receiptLayout{width: width}
+	for _, line := range template.HeaderLines {
+		layout.text(line)
+	}
+	layout.rule('=')
+	layout.text(msg("receipt.transaction", tx.ID))
+	layout.text(msg("receipt.store", tx.StoreID))
+	layout.text(msg("receipt.terminal", tx.TerminalID))
+	if template.ShowCashier {
+		if cashier := s.receiptCashier(ctx, *tx); cashier != "" {
+			layout.text(msg("receipt.cashier", cashier))
+		}
+	}
+	layout.text(msg("receipt.date", tx.CreatedAt.Format("2006-01-02 15:04:05")))
+	layout.rule('-')
+	for _, item := range tx.Items {
+		layout.row(lineName(item, products), fmt.Sprintf("x%d %d", item.Qty, item.UnitPriceCents*int64(item.Qty)))
+	}
+	layout.rule('-')
+	layout.row(msg("receipt.subtotal"), strconv.FormatInt(tx.SubtotalCents, 10))
+	layout.row(msg("receipt.discount"), strconv.FormatInt(tx.DiscountCents, 10))
+	if breakdown := store.TaxBreakdown(tx.Items); template.ShowTaxBreakdown && len(breakdown) > 1 {
+		for _, rate := range breakdown {
+			label := strconv.FormatFloat(rate.RatePercent, 'f', -1, 64) + "%"
+			layout.row(msg("receipt.tax_base")+" "+label, strconv.FormatInt(rate.TaxableBaseCents, 10))
+			layout.row(msg("receipt.tax")+" "+label, strconv.FormatInt(rate.TaxCents, 10))
+		}
+	} else if template.ShowTaxBreakdown {
+		rate := tx.TaxRatePercent
+		if len(breakdown) == 1 {
+			rate = breakdown[0].RatePercent
+		}
+		layout.row(msg("receipt.tax_base"), strconv.FormatInt(tx.SubtotalCents-tx.DiscountCents, 10))
+		layout.row(msg("receipt.tax")+" "+strconv.FormatFloat(rate, 'f', -1, 64)+"%", strconv.FormatInt(tx.TaxCents, 10))
+	} else {
+		layout.row(msg("receipt.tax"), strconv.FormatInt(tx.TaxCents, 10))
+	}
+	layout.row(msg("receipt.total"), strconv.FormatInt(tx.TotalCents, 10))
+	for _, split := range tx.PaymentSplits {
+		label := split.Method
+		if split.Reference != "" {
+			label += " (" + split.Reference + ")"
+		}
+		layout.row(label, strconv.FormatInt(split.AmountCents, 10))
+	}
+	if tx.PaymentMethod == "cash" || !template.HideCashLinesForNonCash {
+		layout.row(msg("receipt.paid"), strconv.FormatInt(tx.CashReceivedCents, 10))
+		layout.row(msg("receipt.change"), strconv.FormatInt(tx.ChangeCents, 10))
+	}
+	if tx.StoreCreditCents > 0 {
+		layout.row(msg("receipt.store_credit"), strconv.FormatInt(tx.StoreCreditCents, 10))
+		layout.text(msg("receipt.store_credit_code", tx.StoreCreditCode))
+	}
+	layout.rule('=')
+	for _, line := range template.FooterLines {
+		layout.text(receiptFooterLine(localizer, line))
+	}
+
+	lookupURL := s.receiptURL(tx.ID)
+	if lookupURL != "" {
+		layout.text(msg("receipt.digital", lookupURL))
+	}
+	lines := append(layout.lines, "")
+
+	escpos := append([]byte{}, escposInit...)
+	escpos = append(escpos, escposLines(lines)...)
+	if lookupURL != "" {
+		escpos = append(escpos, escposQRCode(lookupURL)...)
+	}
+	escpos = append(escpos, escposCut...)
+
+	return domain.HardwareReceiptResponse{
+		TransactionID: tx.ID,
+		EscposBase64:  base64.StdEncoding.EncodeToString(escpos),
+		PreviewText:   strings.Join(lines, "\n"),
+		FileName:      fmt.Sprintf("receipt-%s.bin", tx.ID),
+	}, nil
+}
+
+// printableTransaction loads the transaction a receipt or ticket is printed
+// for and resolves the requested printer width.
+func (s *Service) printableTransaction(ctx context.Context, req domain.HardwareReceiptRequest) (*domain.Transaction, int, error) {
+	req.TransactionID = strings.TrimSpace(req.TransactionID)
+	if req.TransactionID == "" {
+		return nil, 0, store.ErrInvalidTransaction
+	}
+	width := req.PrinterWidth
+	if width == 0 {
+		width = receiptWidthWide
+	}
+	if width != receiptWidthNarrow && width != receiptWidthWide {
+		return nil, 0, store.ErrInvalidTransaction
+	}
+	tx, err := s.repo.FindTransactionByID(ctx, req.TransactionID)
+	if err != nil {
+		return nil, 0, err
+	}
+	return tx, width, nil
+}
+
+// receiptLayout lays out receipt text for a fixed-width thermal printer.
+type receiptLayout struct {
+	width int
+	lines []string
+}
+
+// text adds free text, word-wrapped to the printer width.
+func (l *receiptLayout) text(value string) {
+	l.lines = append(l.lines, wrapReceiptText(value, l.width)...)
+}
+
+// rule adds a separator spanning the printer width.
+func (l *receiptLayout) rule(char rune) {
+	l.lines = append(l.lines, strings.Repeat(string(char), l.width))
+}
+
+// row adds a label with its value right-aligned to the printer width. A label
+// too long to share the line is wrapped and the value goes on the last
+// wrapped line, or on its own line when that does not fit either.
+func (l *receiptLayout) row(label string, value string) {
+	valueWidth := utf8.RuneCountInString(value)
+	wrapped := wrapReceiptText(label, l.width)
+	last := wrapped[len(wrapped)-1]
+	l.lines = append(l.lines, wrapped[:len(wrapped)-1]...)
+	if gap := l.width - utf8.RuneCountInString(last) - valueWidth; gap >= 1 {
+		l.lines = append(l.lines, last+strings.Repeat(" ", gap)+value)
+		return
+	}
+	l.lines = append(l.lines, last, strings.Repeat(" ", max(l.width-valueWidth, 0))+value)
+}
+
+// wrapReceiptText breaks value into lines of at most width characters,
+// splitting on spaces and hard-breaking words longer than a line.
+func wrapReceiptText(value string, width int) []string {
+	var lines []string
+	current := ""
+	for _, word := range strings.Fields(value) {
+		for utf8.RuneCountInString(word) > width {
+			if current != "" {
+				lines = append(lines, current)
+				current = ""
+			}
+			runes := []rune(word)
+			lines = append(lines, string(runes[:width]))
+			word = string(runes[width:])
+		}
+		switch {
+		case word == "":
+		case current == "":
+			current = word
+		case utf8.RuneCountInString(current)+1+utf8.RuneCountInString(word) <= width:
+			current += " " + word
+		default:
+			lines = append(lines, current)
+			current = word
+		}
+	}
+	if current != "" || len(lines) == 0 {
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+// receiptProducts maps each SKU on the transaction to its product.
+// Products that were deactivated since the sale fall back to the SKU as name.
+func (s *Service) receiptProducts(ctx context.Context, tx domain.Transaction) (map[string]domain.Product, error) {
+	skus := make([]string, 0, len(tx.Items))
+	for _, item := range tx.Items {
+		skus = append(skus, item.SKU)
+	}
+	products, err := s.repo.GetProductsBySKUs(ctx, skus)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sku := range skus {
+		if product, ok := products[sku]; !ok || product.Name == "" {
+			product.SKU = sku
+			product.Name = sku
+			products[sku] = product
+		}
+	}
+	return products, nil
+}
+
+// lineName is the name a line was sold under, or the product's current name
+// for lines recorded before names were kept.
+func lineName(item domain.TransactionLine, products map[string]domain.Product) string {
+	if item.Name != "" {
+		return item.Name
+	}
+	return products[item.SKU].Name
+}
+
+// receiptCashier returns the cashier of the shift the sale was rung under,
+// or an empty string when the shift cannot be found.
+func (s *Service) receiptCashier(ctx context.Context, tx domain.Transaction) string {
+	if tx.ShiftID == "" {
+		return ""
+	}
+	shift, err := s.repo.GetShift(ctx, tx.ShiftID)
+	if err != nil {
+		return ""
+	}
+	return shift.CashierName
+}
+
+func escposLines(lines []string) []byte {
+	var out []byte
+	for _, line := range lines {
+		out = append(out, []byte(line)...)
+		out = append(out, '\n')
+	}
+	return out
+}
+
+// escposQRCode renders data as a centred model 2 QR code using the GS ( k
+// command set: select model, module size, error correction level, store the
+// data, then print it.
+func escposQRCode(data string) []byte {
+	storeLen := len(data) + 3
+	out := []byte{
+		0x1b, 0x61, 0x01,
+		0x1d, 0x28, 0x6b, 0x04, 0x00, 0x31, 0x41, 0x32, 0x00,
+		0x1d, 0x28, 0x6b, 0x03, 0x00, 0x31, 0x43, 0x06,
+		0x1d, 0x28, 0x6b, 0x03, 0x00, 0x31, 0x45, 0x31,
+		0x1d, 0x28, 0x6b, byte(storeLen % 256), byte(storeLen / 256), 0x31, 0x50, 0x30,
+	}
+	out = append(out, []byte(data)...)
+	out = append(out,
+		0x1d, 0x28, 0x6b, 0x03, 0x00, 0x31, 0x51, 0x30,
+		'\n',
+		0x1b, 0x61, 0x00,
+	)
+	return out
+}
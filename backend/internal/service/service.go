@@ -6,18 +6,49 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
+	"maps"
 	"math"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"kasirinaja/backend/internal/domain"
+	"kasirinaja/backend/internal/i18n"
+	"kasirinaja/backend/internal/jobs"
 	"kasirinaja/backend/internal/recommendation"
 	"kasirinaja/backend/internal/store"
 	"kasirinaja/backend/internal/xid"
 )
 
+// ErrAdminRequired is returned when the acting user lacks the admin role the
+// action needs.
+var ErrAdminRequired = errors.New("admin role required")
+
+// ErrHeldCartsPending is returned when a shift close is attempted while the
+// terminal still has parked carts and the close was not forced.
+var ErrHeldCartsPending = errors.New("held carts pending on terminal")
+
+// ErrShiftNotOwned is returned by checkout when shift ownership is enforced
+// and the active shift was opened by a different cashier.
+var ErrShiftNotOwned = errors.New("active shift belongs to another cashier")
+
+// ErrNoActiveShift is returned by checkout when the terminal has no open
+// shift to ring the sale under.
+var ErrNoActiveShift = errors.New("active shift required")
+
+// ErrRefundWindowExpired is returned by refunds and item returns for sales
+// older than the refund window, unless the window is overridden.
+var ErrRefundWindowExpired = fmt.Errorf("%w: refund window has expired", store.ErrInvalidTransaction)
+
+// ErrStoreIDRequired is returned when explicit store IDs are required and a
+// request names no store.
+var ErrStoreIDRequired = fmt.Errorf("%w: store_id is required", store.ErrInvalidTransaction)
+
 type actorContextKey struct{}
 
 func WithActor(ctx context.Context, actor domain.Actor) context.Context {
@@ -30,9 +61,52 @@ func ActorFromContext(ctx context.Context) (domain.Actor, bool) {
 }
 
 type Service struct {
-	repo           store.Repository
-	recommender    *recommendation.Engine
-	defaultStoreID string
+	repo                    store.Repository
+	recommender             *recommendation.Engine
+	defaultStoreID          string
+	enforceShiftOwnership   bool
+	registeredTerminalsOnly bool
+	explicitStoreIDOnly     bool
+	events                  RecommendationEventWriter
+	treatmentRatio          float64
+	minLift                 float64
+	storeLocation           *time.Location
+	localTimestamps         bool
+	priceChangeAlertPercent float64
+	businessHours           map[string]businessHours
+	afterHoursThreshold     int
+	anomalyThresholds       map[string]domain.AnomalyThresholds
+	receiptTemplate         domain.ReceiptTemplate
+	receiptLookupURL        string
+	defaultLanguage         string
+	kitchenCategories       map[string]bool
+	offlineEnvelopeTTL      time.Duration
+	clockSkewTolerance      time.Duration
+	expiredLotGraceDays     int
+	refundWindowDays        int
+	dailyVoidCap            int
+	dailyRefundCapCents     int64
+	capLocks                dailyCapLocks
+	paymentMethods          map[string][]string
+	stockAlerts             StockAlertNotifier
+	lowStock                lowStockAlerts
+	jobs                    *jobs.Registry
+	ids                     xid.Generator
+	retrainMu               sync.Mutex
+}
+
+// businessHours is a store's trading window in local whole hours. Close may
+// be smaller than open for stores trading past midnight.
+type businessHours struct {
+	open  int
+	close int
+}
+
+func (h businessHours) contains(hour int) bool {
+	if h.open < h.close {
+		return hour >= h.open && hour < h.close
+	}
+	return hour >= h.open || hour < h.close
 }
 
 func New(repo store.Repository, recommender *recommendation.Engine, defaultStoreID string) *Service {
@@ -41,24 +115,321 @@ func New(repo store.Repository, recommender *recommendation.Engine, defaultStore
 	}
 
 	return &Service{
-		repo:           repo,
-		recommender:    recommender,
-		defaultStoreID: defaultStoreID,
+		repo:                    repo,
+		recommender:             recommender,
+		defaultStoreID:          defaultStoreID,
+		events:                  syncEventWriter{repo: repo},
+		treatmentRatio:          0.5,
+		minLift:                 1,
+		storeLocation:           time.UTC,
+		priceChangeAlertPercent: 30,
+		businessHours:           map[string]businessHours{},
+		afterHoursThreshold:     1,
+		anomalyThresholds:       map[string]domain.AnomalyThresholds{},
+		receiptTemplate:         defaultReceiptTemplate(),
+		defaultLanguage:         i18n.DefaultLanguage,
+		offlineEnvelopeTTL:      24 * time.Hour,
+		clockSkewTolerance:      DefaultClockSkewTolerance,
+		paymentMethods:          map[string][]string{},
+	}
+}
+
+// DefaultStoreID returns the store used when a request names none.
+func (s *Service) DefaultStoreID() string {
+	return s.defaultStoreID
+}
+
+// SetRequireExplicitStoreID makes requests that name no store fail with
+// ErrStoreIDRequired instead of falling back to the default store, so a
+// client of a multi-store deployment cannot write to the wrong store by
+// omitting it. It is off by default for single-store deployments.
+func (s *Service) SetRequireExplicitStoreID(require bool) {
+	s.explicitStoreIDOnly = require
+}
+
+// ResolveStoreID returns storeID, or the default store when it is empty. It
+// fails with ErrStoreIDRequired when explicit store IDs are required.
+func (s *Service) ResolveStoreID(storeID string) (string, error) {
+	err := s.resolveStoreID(&storeID)
+	return storeID, err
+}
+
+// resolveStoreID fills an empty *storeID with the default store, or rejects
+// it when explicit store IDs are required.
+func (s *Service) resolveStoreID(storeID *string) error {
+	if *storeID != "" {
+		return nil
+	}
+	if s.explicitStoreIDOnly {
+		return ErrStoreIDRequired
+	}
+	*storeID = s.defaultStoreID
+	return nil
+}
+
+// SetBusinessHours sets a store's trading hours as "open-close" in local
+// whole hours, e.g. "7-22". An empty storeID sets the default for every store
+// without its own hours. After-hours sales are only checked for stores with
+// configured hours.
+func (s *Service) SetBusinessHours(storeID string, spec string) error {
+	openText, closeText, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return fmt.Errorf("%w: business hours %q must look like open-close, e.g. 7-22", store.ErrInvalidInput, spec)
+	}
+	open, err := strconv.Atoi(strings.TrimSpace(openText))
+	if err != nil || open < 0 || open > 23 {
+		return fmt.Errorf("%w: invalid opening hour in %q", store.ErrInvalidInput, spec)
+	}
+	closing, err := strconv.Atoi(strings.TrimSpace(closeText))
+	if err != nil || closing < 0 || closing > 24 || closing == open {
+		return fmt.Errorf("%w: invalid closing hour in %q", store.ErrInvalidInput, spec)
+	}
+	s.businessHours[strings.TrimSpace(storeID)] = businessHours{open: open, close: closing % 24}
+	return nil
+}
+
+// defaultAnomalyThresholds apply wherever neither the store nor the global
+// configuration sets a threshold.
+var defaultAnomalyThresholds = domain.AnomalyThresholds{
+	VoidsPerActor:   3,
+	RefundsPerActor: 2,
+	ManualOverrides: 5,
+	StockOpnames:    3,
+}
+
+// SetAnomalyThresholds overrides the operational alert thresholds for
+// storeID, or for every store when storeID is empty. Zero fields are unset.
+func (s *Service) SetAnomalyThresholds(storeID string, thresholds domain.AnomalyThresholds) {
+	s.anomalyThresholds[strings.TrimSpace(storeID)] = thresholds
+}
+
+// effectiveAnomalyThresholds layers the store's thresholds over the global
+// ones over the defaults.
+func (s *Service) effectiveAnomalyThresholds(storeID string) domain.AnomalyThresholds {
+	effective := defaultAnomalyThresholds
+	for _, layer := range []domain.AnomalyThresholds{s.anomalyThresholds[""], s.anomalyThresholds[storeID]} {
+		if layer.VoidsPerActor > 0 {
+			effective.VoidsPerActor = layer.VoidsPerActor
+		}
+		if layer.RefundsPerActor > 0 {
+			effective.RefundsPerActor = layer.RefundsPerActor
+		}
+		if layer.ManualOverrides > 0 {
+			effective.ManualOverrides = layer.ManualOverrides
+		}
+		if layer.StockOpnames > 0 {
+			effective.StockOpnames = layer.StockOpnames
+		}
+	}
+	return effective
+}
+
+// SetAfterHoursSalesThreshold sets how many after-hours sales in a day raise
+// an after_hours_sales alert.
+func (s *Service) SetAfterHoursSalesThreshold(threshold int) {
+	if threshold < 1 {
+		threshold = 1
+	}
+	s.afterHoursThreshold = threshold
+}
+
+// SetPriceChangeAlertPercent sets how far a single price edit may move a
+// price, in percent, before it counts towards a price_change_spike alert.
+func (s *Service) SetPriceChangeAlertPercent(percent float64) {
+	if percent <= 0 {
+		percent = 30
+	}
+	s.priceChangeAlertPercent = percent
+}
+
+// SetStoreLocation sets the store's local timezone used to bucket reports.
+func (s *Service) SetStoreLocation(loc *time.Location) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	s.storeLocation = loc
+}
+
+// storeDay returns the [from, to) window of a calendar day in the store's
+// timezone. An empty date means the store's current day.
+func (s *Service) storeDay(date string) (time.Time, time.Time, error) {
+	loc := s.storeLocation
+	var from time.Time
+	if strings.TrimSpace(date) == "" {
+		now := time.Now().In(loc)
+		from = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	} else {
+		parsed, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(date), loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, store.ErrInvalidTransaction
+		}
+		from = parsed
+	}
+	return from, from.AddDate(0, 0, 1), nil
+}
+
+// SetMinLift sets the lift a mined pair needs to be kept when retraining.
+// A lift of 1 means the items are bought together no more often than chance.
+func (s *Service) SetMinLift(minLift float64) {
+	if minLift < 0 {
+		minLift = 0
+	}
+	s.minLift = minLift
+}
+
+// SetExperimentTreatmentRatio sets the share of terminal-days that receive
+// recommendations; the rest form the control group.
+func (s *Service) SetExperimentTreatmentRatio(ratio float64) {
+	if ratio < 0 {
+		ratio = 0
 	}
+	if ratio > 1 {
+		ratio = 1
+	}
+	s.treatmentRatio = ratio
+}
+
+// experimentBucket assigns a terminal to the treatment or control group for
+// the day, so a cashier sees consistent behaviour through a shift.
+func (s *Service) experimentBucket(terminalID string, at time.Time) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(terminalID + "|" + at.UTC().Format("2006-01-02")))
+	if float64(h.Sum32()%10000)/10000 < s.treatmentRatio {
+		return domain.ExperimentBucketTreatment
+	}
+	return domain.ExperimentBucketControl
+}
+
+// SetRecommendationEventWriter replaces the default synchronous writer used
+// for events logged while serving recommendations.
+func (s *Service) SetRecommendationEventWriter(writer RecommendationEventWriter) {
+	if writer == nil {
+		writer = syncEventWriter{repo: s.repo}
+	}
+	s.events = writer
+}
+
+// SetOfflineEnvelopeTTL sets how long a synced offline envelope is
+// remembered, so a retried upload within that time gets the original
+// response instead of being replayed.
+func (s *Service) SetOfflineEnvelopeTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	s.offlineEnvelopeTTL = ttl
+}
+
+// DefaultClockSkewTolerance is how far a terminal's clock may drift from the
+// server's before its recommendation timestamps are ignored.
+const DefaultClockSkewTolerance = 5 * time.Minute
+
+// SetClockSkewTolerance sets how far a client timestamp may be from server
+// time before Recommend falls back to server time.
+func (s *Service) SetClockSkewTolerance(tolerance time.Duration) {
+	if tolerance <= 0 {
+		tolerance = DefaultClockSkewTolerance
+	}
+	s.clockSkewTolerance = tolerance
+}
+
+// SetJobRegistry makes the service's background loops report their runs to
+// registry.
+func (s *Service) SetJobRegistry(registry *jobs.Registry) {
+	s.jobs = registry
+}
+
+// SetIDGenerator sets how the service creates IDs for new records. Without
+// one it uses the xid package default.
+func (s *Service) SetIDGenerator(ids xid.Generator) {
+	s.ids = ids
+}
+
+func (s *Service) newID(prefix string) string {
+	if s.ids == nil {
+		return xid.New(prefix)
+	}
+	return s.ids.New(prefix)
+}
+
+// clientOrNewID returns a caller-supplied ID after checking its format, or a
+// generated one when none was supplied. Uniqueness is left to the repository,
+// which reports store.ErrDuplicateID.
+func (s *Service) clientOrNewID(prefix string, id string) (string, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return s.newID(prefix), nil
+	}
+	if !xid.ValidClientID(id) {
+		return "", fmt.Errorf("%w: id %q must be 1-64 letters, digits, '.', '_' or '-'", store.ErrInvalidTransaction, id)
+	}
+	return id, nil
+}
+
+// SetEnforceShiftOwnership makes checkout reject cashiers ringing sales under
+// a shift someone else opened. Admins are never restricted.
+func (s *Service) SetEnforceShiftOwnership(enforce bool) {
+	s.enforceShiftOwnership = enforce
+}
+
+// ListProducts returns the active products, leaving out seasonal ones
+// outside their availability dates.
+// ListProducts returns the active products on sale today that match filter.
+func (s *Service) ListProducts(ctx context.Context, filter domain.ProductFilter) ([]domain.Product, error) {
+	products, err := s.repo.ListProducts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	today := s.storeDate()
+	tag := strings.ToLower(strings.TrimSpace(filter.Tag))
+	brand := strings.TrimSpace(filter.Brand)
+	available := make([]domain.Product, 0, len(products))
+	for _, product := range products {
+		if !store.AvailableOn(product, today) {
+			continue
+		}
+		if tag != "" && !slices.Contains(product.Tags, tag) {
+			continue
+		}
+		if brand != "" && !strings.EqualFold(product.Brand, brand) {
+			continue
+		}
+		available = append(available, product)
+	}
+	return available, nil
 }
 
-func (s *Service) ListProducts(ctx context.Context) ([]domain.Product, error) {
-	return s.repo.ListProducts(ctx)
+// storeDate returns today's store-local calendar date at midnight UTC, the
+// form product availability dates are kept in.
+func (s *Service) storeDate() time.Time {
+	today := time.Now().In(s.storeLocation)
+	return time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// errInvalidTags rejects tag lists that are still too long once normalized.
+var errInvalidTags = fmt.Errorf("%w: at most %d tags of up to %d characters each", store.ErrInvalidTransaction, store.MaxProductTags, store.MaxProductTagLen)
+
+// parseAvailabilityDate parses a YYYY-MM-DD availability date. Empty means
+// no date.
+func parseAvailabilityDate(value string) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: availability date %q must be YYYY-MM-DD", store.ErrInvalidTransaction, value)
+	}
+	return &parsed, nil
 }
 
 func (s *Service) CreateProduct(ctx context.Context, req domain.ProductCreateRequest) (domain.Product, error) {
 	actor, ok := ActorFromContext(ctx)
 	if !ok || actor.Role != "admin" {
-		return domain.Product{}, fmt.Errorf("admin role required")
+		return domain.Product{}, ErrAdminRequired
 	}
 
-	if req.StoreID == "" {
-		req.StoreID = s.defaultStoreID
+	if err := s.resolveStoreID(&req.StoreID); err != nil {
+		return domain.Product{}, err
 	}
 
 	req.SKU = strings.ToUpper(strings.TrimSpace(req.SKU))
@@ -68,17 +439,49 @@ func (s *Service) CreateProduct(ctx context.Context, req domain.ProductCreateReq
 	if req.SKU == "" || req.Name == "" || req.Category == "" {
 		return domain.Product{}, store.ErrInvalidTransaction
 	}
-	if req.PriceCents < 1 || req.MarginRate < 0 || req.MarginRate > 1 || req.InitialStock < 0 {
+	if req.PriceCents < 1 || req.InitialStock < 0 {
+		return domain.Product{}, store.ErrInvalidTransaction
+	}
+	marginRate, ok := store.NormalizeMarginRate(req.MarginRate)
+	if !ok {
+		return domain.Product{}, fmt.Errorf("%w: margin_rate %v must be a fraction from 0 to 1 or a percentage up to 100", store.ErrInvalidTransaction, req.MarginRate)
+	}
+	strategy, ok := normalizePickingStrategy(req.PickingStrategy)
+	if !ok {
 		return domain.Product{}, store.ErrInvalidTransaction
 	}
+	availableFrom, err := parseAvailabilityDate(req.AvailableFrom)
+	if err != nil {
+		return domain.Product{}, err
+	}
+	availableUntil, err := parseAvailabilityDate(req.AvailableUntil)
+	if err != nil {
+		return domain.Product{}, err
+	}
 
 	product := domain.Product{
-		SKU:        req.SKU,
-		Name:       req.Name,
-		Category:   req.Category,
-		PriceCents: req.PriceCents,
-		MarginRate: req.MarginRate,
-		Active:     true,
+		SKU:             req.SKU,
+		Name:            req.Name,
+		Category:        req.Category,
+		PriceCents:      req.PriceCents,
+		MarginRate:      marginRate,
+		Active:          true,
+		Serialized:      req.Serialized,
+		PickingStrategy: strategy,
+		TaxRatePercent:  req.TaxRatePercent,
+		AvailableFrom:   availableFrom,
+		AvailableUntil:  availableUntil,
+		Brand:           strings.TrimSpace(req.Brand),
+		Tags:            store.NormalizeTags(req.Tags),
+	}
+	if !store.ValidTaxRate(product) {
+		return domain.Product{}, store.ErrInvalidTransaction
+	}
+	if !store.ValidAvailability(product) {
+		return domain.Product{}, fmt.Errorf("%w: available_until is before available_from", store.ErrInvalidTransaction)
+	}
+	if !store.ValidTags(product) {
+		return domain.Product{}, errInvalidTags
 	}
 
 	created, err := s.repo.CreateProduct(ctx, product)
@@ -107,7 +510,7 @@ func (s *Service) CreateProduct(ctx context.Context, req domain.ProductCreateReq
 func (s *Service) UpdateProduct(ctx context.Context, sku string, req domain.ProductUpdateRequest) (domain.Product, error) {
 	actor, ok := ActorFromContext(ctx)
 	if !ok || actor.Role != "admin" {
-		return domain.Product{}, fmt.Errorf("admin role required")
+		return domain.Product{}, ErrAdminRequired
 	}
 
 	sku = strings.ToUpper(strings.TrimSpace(sku))
@@ -142,14 +545,57 @@ func (s *Service) UpdateProduct(ctx context.Context, sku string, req domain.Prod
 		updated.PriceCents = *req.PriceCents
 	}
 	if req.MarginRate != nil {
-		if *req.MarginRate < 0 || *req.MarginRate > 1 {
-			return domain.Product{}, store.ErrInvalidTransaction
+		marginRate, ok := store.NormalizeMarginRate(*req.MarginRate)
+		if !ok {
+			return domain.Product{}, fmt.Errorf("%w: margin_rate %v must be a fraction from 0 to 1 or a percentage up to 100", store.ErrInvalidTransaction, *req.MarginRate)
 		}
-		updated.MarginRate = *req.MarginRate
+		updated.MarginRate = marginRate
 	}
 	if req.Active != nil {
 		updated.Active = *req.Active
 	}
+	if req.Serialized != nil {
+		updated.Serialized = *req.Serialized
+	}
+	if req.PickingStrategy != nil {
+		strategy, ok := normalizePickingStrategy(*req.PickingStrategy)
+		if !ok {
+			return domain.Product{}, store.ErrInvalidTransaction
+		}
+		updated.PickingStrategy = strategy
+	}
+	if req.TaxRatePercent != nil {
+		rate := *req.TaxRatePercent
+		updated.TaxRatePercent = &rate
+	}
+	if req.ClearTaxRate {
+		updated.TaxRatePercent = nil
+	}
+	if req.AvailableFrom != nil {
+		if updated.AvailableFrom, err = parseAvailabilityDate(*req.AvailableFrom); err != nil {
+			return domain.Product{}, err
+		}
+	}
+	if req.AvailableUntil != nil {
+		if updated.AvailableUntil, err = parseAvailabilityDate(*req.AvailableUntil); err != nil {
+			return domain.Product{}, err
+		}
+	}
+	if req.Brand != nil {
+		updated.Brand = strings.TrimSpace(*req.Brand)
+	}
+	if req.Tags != nil {
+		updated.Tags = store.NormalizeTags(*req.Tags)
+	}
+	if !store.ValidTaxRate(updated) {
+		return domain.Product{}, store.ErrInvalidTransaction
+	}
+	if !store.ValidAvailability(updated) {
+		return domain.Product{}, fmt.Errorf("%w: available_until is before available_from", store.ErrInvalidTransaction)
+	}
+	if !store.ValidTags(updated) {
+		return domain.Product{}, errInvalidTags
+	}
 
 	saved, err := s.repo.UpdateProduct(ctx, updated)
 	if err != nil {
@@ -158,7 +604,7 @@ func (s *Service) UpdateProduct(ctx context.Context, sku string, req domain.Prod
 
 	if existing.PriceCents != saved.PriceCents {
 		if err := s.repo.CreatePriceHistory(ctx, domain.ProductPriceHistory{
-			ID:            xid.New("ph"),
+			ID:            s.newID("ph"),
 			SKU:           saved.SKU,
 			OldPriceCents: existing.PriceCents,
 			NewPriceCents: saved.PriceCents,
@@ -190,16 +636,26 @@ func (s *Service) ListProductPriceHistory(ctx context.Context, sku string, limit
 
 func (s *Service) Recommend(ctx context.Context, req domain.RecommendationRequest) (domain.RecommendationResponse, error) {
 	if len(req.CartItems) == 0 {
-		return domain.RecommendationResponse{UIPolicy: domain.UIPolicy{Show: false, CooldownSeconds: 30}}, nil
+		return domain.RecommendationResponse{UIPolicy: s.recommender.IdlePolicy()}, nil
 	}
 
-	if req.StoreID == "" {
-		req.StoreID = s.defaultStoreID
+	if err := s.resolveStoreID(&req.StoreID); err != nil {
+		return domain.RecommendationResponse{}, err
 	}
 
 	req.CartItems = normalizeItems(req.CartItems)
 	if len(req.CartItems) == 0 {
-		return domain.RecommendationResponse{UIPolicy: domain.UIPolicy{Show: false, CooldownSeconds: 30}}, nil
+		return domain.RecommendationResponse{UIPolicy: s.recommender.IdlePolicy()}, nil
+	}
+
+	now := time.Now().UTC()
+	clockSkew := false
+	if req.Timestamp != nil {
+		if skew := req.Timestamp.Sub(now).Abs(); skew > s.clockSkewTolerance {
+			log.Printf("[service] WARN: terminal %s clock is %s off server time, ignoring its timestamp", req.TerminalID, skew.Round(time.Second))
+			req.Timestamp = nil
+			clockSkew = true
+		}
 	}
 
 	cartSKUs := make([]string, 0, len(req.CartItems))
@@ -235,45 +691,66 @@ func (s *Service) Recommend(ctx context.Context, req domain.RecommendationReques
 		return domain.RecommendationResponse{}, err
 	}
 
-	resp := s.recommender.Recommend(ctx, req, products, stockMap, pairs)
+	resp := s.recommender.Recommend(ctx, req, products, stockMap, pairs, s.categoryCandidates(req.StoreID))
+	resp.ExperimentBucket = s.experimentBucket(req.TerminalID, now)
 
-	if resp.UIPolicy.Show && resp.Recommendation != nil {
-		_ = s.repo.CreateRecommendationEvent(ctx, domain.RecommendationEvent{
-			StoreID:    req.StoreID,
-			TerminalID: req.TerminalID,
-			SKU:        resp.Recommendation.SKU,
-			Action:     domain.RecommendationShownAction,
-			ReasonCode: resp.Recommendation.ReasonCode,
-			Confidence: resp.Recommendation.Confidence,
-			LatencyMS:  resp.LatencyMS,
-			CreatedAt:  time.Now().UTC(),
-		})
+	if resp.UIPolicy.Show {
+		action := domain.RecommendationShownAction
+		if resp.ExperimentBucket == domain.ExperimentBucketControl {
+			action = domain.RecommendationWithheldAction
+		}
+		events := make([]domain.RecommendationEvent, 0, len(resp.Recommendations))
+		for _, rec := range resp.Recommendations {
+			events = append(events, domain.RecommendationEvent{
+				StoreID:          req.StoreID,
+				TerminalID:       req.TerminalID,
+				SKU:              rec.SKU,
+				Action:           action,
+				ReasonCode:       rec.ReasonCode,
+				Confidence:       rec.Confidence,
+				LatencyMS:        resp.LatencyMS,
+				ExperimentBucket: resp.ExperimentBucket,
+				ClockSkew:        clockSkew,
+				CreatedAt:        now,
+			})
+		}
+		s.events.Write(ctx, events)
+	}
+	if resp.ExperimentBucket == domain.ExperimentBucketControl {
+		resp.Recommendation = nil
+		resp.Recommendations = nil
+		resp.UIPolicy.Show = false
 	}
 
 	return resp, nil
 }
 
 func (s *Service) OpenShift(ctx context.Context, req domain.ShiftOpenRequest) (domain.ShiftResponse, error) {
-	if req.StoreID == "" {
-		req.StoreID = s.defaultStoreID
+	if err := s.resolveStoreID(&req.StoreID); err != nil {
+		return domain.ShiftResponse{}, err
 	}
 	if req.TerminalID == "" || req.CashierName == "" {
 		return domain.ShiftResponse{}, store.ErrInvalidTransaction
 	}
+	if err := s.checkTerminal(ctx, req.StoreID, req.TerminalID); err != nil {
+		return domain.ShiftResponse{}, err
+	}
 
+	actor, _ := ActorFromContext(ctx)
 	shift := domain.Shift{
-		ID:                xid.New("shift"),
+		ID:                s.newID("shift"),
 		StoreID:           req.StoreID,
 		TerminalID:        req.TerminalID,
 		CashierName:       req.CashierName,
+		OpenedBy:          actor.Username,
 		OpeningFloatCents: req.OpeningFloatCents,
 		Status:            domain.ShiftStatusOpen,
 		OpenedAt:          time.Now().UTC(),
 	}
 	saved, err := s.repo.CreateShift(ctx, shift)
 	if err != nil {
-		if errors.Is(err, store.ErrInvalidTransaction) {
-			return domain.ShiftResponse{}, fmt.Errorf("shift already open")
+		if errors.Is(err, store.ErrShiftAlreadyOpen) {
+			return domain.ShiftResponse{}, fmt.Errorf("open shift on %s: %w", req.TerminalID, err)
 		}
 		return domain.ShiftResponse{}, err
 	}
@@ -284,25 +761,86 @@ func (s *Service) OpenShift(ctx context.Context, req domain.ShiftOpenRequest) (d
 }
 
 func (s *Service) CloseShift(ctx context.Context, req domain.ShiftCloseRequest) (domain.ShiftResponse, error) {
-	if req.StoreID == "" {
-		req.StoreID = s.defaultStoreID
+	if err := s.resolveStoreID(&req.StoreID); err != nil {
+		return domain.ShiftResponse{}, err
 	}
 	if req.TerminalID == "" {
 		return domain.ShiftResponse{}, store.ErrInvalidTransaction
 	}
+	if err := s.checkTerminal(ctx, req.StoreID, req.TerminalID); err != nil {
+		return domain.ShiftResponse{}, err
+	}
+
+	held, err := s.repo.ListHeldCarts(ctx, req.StoreID, req.TerminalID, 200)
+	if err != nil {
+		return domain.ShiftResponse{}, err
+	}
+	if len(held) > 0 && !req.Force {
+		return domain.ShiftResponse{}, fmt.Errorf("%w: %d held cart(s)", ErrHeldCartsPending, len(held))
+	}
 
 	active, err := s.repo.CloseActiveShift(ctx, req.StoreID, req.TerminalID, req.ClosingCashCents, time.Now().UTC())
 	if err != nil {
 		return domain.ShiftResponse{}, err
 	}
-	s.logAudit(ctx, req.StoreID, "shift_close", "shift", active.ID, fmt.Sprintf("closing_cash=%d", req.ClosingCashCents))
+	detail := fmt.Sprintf("closing_cash=%d", req.ClosingCashCents)
+	if len(held) > 0 {
+		// Forced close: the carts stay parked on the terminal for the next shift.
+		detail += fmt.Sprintf(",forced=true,held_carts_carried=%d", len(held))
+	}
+	s.logAudit(ctx, req.StoreID, "shift_close", "shift", active.ID, detail)
 
 	return domain.ShiftResponse{Shift: *active}, nil
 }
 
+// UpdateShift corrects an open shift's opening float or notes, e.g. when the
+// cashier mistyped their starting cash. The audit entry keeps the float from
+// before the change.
+func (s *Service) UpdateShift(ctx context.Context, shiftID string, req domain.ShiftUpdateRequest) (domain.ShiftResponse, error) {
+	actor, ok := ActorFromContext(ctx)
+	if !ok || actor.Role != "admin" {
+		return domain.ShiftResponse{}, ErrAdminRequired
+	}
+	shiftID = strings.TrimSpace(shiftID)
+	if shiftID == "" || (req.OpeningFloatCents == nil && req.Notes == nil) {
+		return domain.ShiftResponse{}, store.ErrInvalidTransaction
+	}
+	if req.OpeningFloatCents != nil && *req.OpeningFloatCents < 0 {
+		return domain.ShiftResponse{}, fmt.Errorf("%w: opening float must not be negative", store.ErrInvalidTransaction)
+	}
+
+	current, err := s.repo.GetShift(ctx, shiftID)
+	if err != nil {
+		return domain.ShiftResponse{}, err
+	}
+	if current.Status != domain.ShiftStatusOpen {
+		return domain.ShiftResponse{}, fmt.Errorf("%w: %s", store.ErrShiftClosed, shiftID)
+	}
+	openingFloat := current.OpeningFloatCents
+	if req.OpeningFloatCents != nil {
+		openingFloat = *req.OpeningFloatCents
+	}
+	notes := current.Notes
+	if req.Notes != nil {
+		notes = strings.TrimSpace(*req.Notes)
+	}
+
+	updated, err := s.repo.UpdateOpenShift(ctx, shiftID, openingFloat, notes)
+	if err != nil {
+		return domain.ShiftResponse{}, err
+	}
+	detail := fmt.Sprintf("opening_float=%d->%d", current.OpeningFloatCents, updated.OpeningFloatCents)
+	if updated.Notes != current.Notes {
+		detail += ",notes_changed=true"
+	}
+	s.logAudit(ctx, updated.StoreID, "shift_update", "shift", updated.ID, detail)
+
+	return domain.ShiftResponse{Shift: *updated}, nil
+}
+
 func (s *Service) GetActiveShift(ctx context.Context, storeID string, terminalID string) (domain.ShiftResponse, error) {
-	if storeID == "" {
-		storeID = s.defaultStoreID
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.ShiftResponse{}, err
 	}
 	if terminalID == "" {
 		return domain.ShiftResponse{}, store.ErrInvalidTransaction
@@ -316,126 +854,316 @@ func (s *Service) GetActiveShift(ctx context.Context, storeID string, terminalID
 	return domain.ShiftResponse{Shift: *shift}, nil
 }
 
-func (s *Service) Checkout(ctx context.Context, req domain.CheckoutRequest) (domain.CheckoutResponse, error) {
-	if req.StoreID == "" {
-		req.StoreID = s.defaultStoreID
+// ListShifts returns the shifts opened in a date range, newest first. The range
+// defaults to the last seven days and `to` is inclusive.
+func (s *Service) ListShifts(ctx context.Context, storeID string, terminalID string, fromDate string, toDate string, limit int) (domain.ShiftListResponse, error) {
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.ShiftListResponse{}, err
 	}
-	req.PaymentSplits = normalizePaymentSplits(req.PaymentSplits)
-	if len(req.PaymentSplits) > 0 {
-		req.PaymentMethod = "split"
+	terminalID = strings.TrimSpace(terminalID)
+
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if strings.TrimSpace(toDate) != "" {
+		parsed, err := time.Parse("2006-01-02", toDate)
+		if err != nil {
+			return domain.ShiftListResponse{}, store.ErrInvalidTransaction
+		}
+		to = parsed.UTC()
 	}
-	if req.PaymentMethod == "" {
-		req.PaymentMethod = "cash"
+	from := to.AddDate(0, 0, -6)
+	if strings.TrimSpace(fromDate) != "" {
+		parsed, err := time.Parse("2006-01-02", fromDate)
+		if err != nil {
+			return domain.ShiftListResponse{}, store.ErrInvalidTransaction
+		}
+		from = parsed.UTC()
 	}
-	if req.IdempotencyKey == "" {
-		req.IdempotencyKey = xid.New("idem")
+	to = to.Add(24 * time.Hour)
+	if !from.Before(to) {
+		return domain.ShiftListResponse{}, store.ErrInvalidTransaction
 	}
 
-	if !isSupportedPaymentMethod(req.PaymentMethod) {
-		return domain.CheckoutResponse{}, store.ErrInvalidTransaction
+	shifts, err := s.repo.ListShifts(ctx, storeID, terminalID, from, to, limit)
+	if err != nil {
+		return domain.ShiftListResponse{}, err
 	}
-	if req.TaxRatePercent < 0 || req.TaxRatePercent > 100 {
-		return domain.CheckoutResponse{}, store.ErrInvalidTransaction
+	return domain.ShiftListResponse{StoreID: storeID, TerminalID: terminalID, From: from, To: to, Shifts: shifts}, nil
+}
+
+// RecordCashMovement logs cash put into or taken out of an open shift's
+// drawer outside of a sale, such as a mid-shift drop or paying a supplier.
+func (s *Service) RecordCashMovement(ctx context.Context, shiftID string, kind string, amountCents int64, note string) (domain.ShiftCashMovement, error) {
+	shiftID = strings.TrimSpace(shiftID)
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	if shiftID == "" || amountCents < 1 {
+		return domain.ShiftCashMovement{}, store.ErrInvalidTransaction
 	}
-	if req.DiscountCents < 0 {
-		return domain.CheckoutResponse{}, store.ErrInvalidTransaction
+	switch kind {
+	case domain.CashMovementDrop, domain.CashMovementPaidIn, domain.CashMovementPaidOut:
+	default:
+		return domain.ShiftCashMovement{}, store.ErrInvalidTransaction
 	}
 
-	if req.ManualOverride {
-		actor, ok := ActorFromContext(ctx)
-		if !ok || actor.Role != "admin" {
-			return domain.CheckoutResponse{}, fmt.Errorf("manual override requires admin role")
-		}
+	shift, err := s.repo.GetShift(ctx, shiftID)
+	if err != nil {
+		return domain.ShiftCashMovement{}, err
+	}
+	if err := s.checkTerminal(ctx, shift.StoreID, shift.TerminalID); err != nil {
+		return domain.ShiftCashMovement{}, err
 	}
 
-	shift, err := s.GetActiveShift(ctx, req.StoreID, req.TerminalID)
+	actor, _ := ActorFromContext(ctx)
+	created, err := s.repo.CreateShiftCashMovement(ctx, domain.ShiftCashMovement{
+		ID:          s.newID("cash"),
+		ShiftID:     shiftID,
+		Kind:        kind,
+		AmountCents: amountCents,
+		Note:        strings.TrimSpace(note),
+		CreatedBy:   actor.Username,
+		CreatedAt:   time.Now().UTC(),
+	})
 	if err != nil {
-		if errors.Is(err, store.ErrNotFound) {
-			return domain.CheckoutResponse{}, fmt.Errorf("active shift required")
-		}
-		return domain.CheckoutResponse{}, err
+		return domain.ShiftCashMovement{}, err
 	}
 
-	normalized := normalizeItems(req.CartItems)
-	if len(normalized) == 0 {
-		return domain.CheckoutResponse{}, store.ErrInvalidTransaction
-	}
+	s.logAudit(ctx, shift.StoreID, "shift_cash_movement", "shift", shiftID, fmt.Sprintf("kind=%s,amount=%d", kind, amountCents))
+	return *created, nil
+}
 
-	if existing, err := s.repo.FindTransactionByIdempotency(ctx, req.IdempotencyKey); err == nil {
-		return toCheckoutResponse(existing, true), nil
-	} else if !errors.Is(err, store.ErrNotFound) {
-		return domain.CheckoutResponse{}, err
+// GetShiftSummary works out how much cash should be in the drawer for a
+// shift: the opening float plus cash taken on the shift's sales and paid in,
+// minus cash handed back for refunds on the terminal, dropped to the safe or
+// paid out while the shift was open. Once the shift is closed the counted
+// cash is compared against that figure.
+func (s *Service) GetShiftSummary(ctx context.Context, shiftID string) (domain.ShiftSummary, error) {
+	shiftID = strings.TrimSpace(shiftID)
+	if shiftID == "" {
+		return domain.ShiftSummary{}, store.ErrInvalidTransaction
 	}
 
-	skus := make([]string, 0, len(normalized))
-	for _, item := range normalized {
-		skus = append(skus, item.SKU)
+	shift, err := s.repo.GetShift(ctx, shiftID)
+	if err != nil {
+		return domain.ShiftSummary{}, err
 	}
-	products, err := s.repo.GetProductsBySKUs(ctx, skus)
+	transactions, err := s.repo.ListShiftTransactions(ctx, shift.ID)
 	if err != nil {
-		return domain.CheckoutResponse{}, err
+		return domain.ShiftSummary{}, err
 	}
 
-	subtotal := int64(0)
-	for _, item := range normalized {
-		product, exists := products[item.SKU]
-		if !exists {
-			return domain.CheckoutResponse{}, store.ErrInvalidTransaction
+	summary := domain.ShiftSummary{Shift: *shift}
+	for _, tx := range transactions {
+		if tx.Status == domain.TxStatusVoided {
+			continue
 		}
-		subtotal += int64(item.Qty) * product.PriceCents
+		summary.TransactionCount++
+		summary.CashSalesCents += cashPortionCents(tx)
 	}
 
-	promoDiscount, err := s.calculatePromoDiscount(ctx, subtotal)
+	until := time.Now().UTC()
+	if shift.ClosedAt != nil {
+		until = *shift.ClosedAt
+	}
+	refunds, err := s.repo.ListRefundsByTerminal(ctx, shift.StoreID, shift.TerminalID, shift.OpenedAt, until)
 	if err != nil {
-		return domain.CheckoutResponse{}, err
+		return domain.ShiftSummary{}, err
+	}
+	originals := map[string]*domain.Transaction{}
+	for _, refund := range refunds {
+		if refund.Status != domain.TxStatusRefunded {
+			continue
+		}
+		original, ok := originals[refund.OriginalTransactionID]
+		if !ok {
+			original, err = s.repo.FindTransactionByID(ctx, refund.OriginalTransactionID)
+			if err != nil {
+				return domain.ShiftSummary{}, err
+			}
+			originals[refund.OriginalTransactionID] = original
+		}
+		summary.CashRefundsCents += min(refund.AmountCents, cashPortionCents(*original))
 	}
-	req.DiscountCents += promoDiscount
-	if req.DiscountCents > subtotal {
-		req.DiscountCents = subtotal
+
+	movements, err := s.repo.ListShiftCashMovements(ctx, shift.ID)
+	if err != nil {
+		return domain.ShiftSummary{}, err
+	}
+	for _, movement := range movements {
+		switch movement.Kind {
+		case domain.CashMovementDrop:
+			summary.CashDropsCents += movement.AmountCents
+		case domain.CashMovementPaidIn:
+			summary.PaidInCents += movement.AmountCents
+		case domain.CashMovementPaidOut:
+			summary.PaidOutCents += movement.AmountCents
+		}
 	}
 
-	taxBase := subtotal - req.DiscountCents
-	taxCents := int64(math.Round(float64(taxBase) * req.TaxRatePercent / 100))
-	totalCents := taxBase + taxCents
+	summary.ExpectedCashCents = shift.OpeningFloatCents + summary.CashSalesCents + summary.PaidInCents -
+		summary.CashRefundsCents - summary.CashDropsCents - summary.PaidOutCents
+	if shift.Status == domain.ShiftStatusClosed {
+		variance := shift.ClosingCashCents - summary.ExpectedCashCents
+		summary.VarianceCents = &variance
+	}
+	return summary, nil
+}
 
-	switch req.PaymentMethod {
+// cashPortionCents is the part of a sale that was settled in cash and stays
+// in the drawer, including change kept as store credit. Split payments are
+// decoded from the stored reference when the store does not hand back the
+// splits themselves.
+func cashPortionCents(tx domain.Transaction) int64 {
+	switch tx.PaymentMethod {
 	case "cash":
-		if req.CashReceivedCents < totalCents {
-			return domain.CheckoutResponse{}, store.ErrInvalidTransaction
-		}
+		return tx.TotalCents + tx.StoreCreditCents
 	case "split":
-		if len(req.PaymentSplits) < 2 {
-			return domain.CheckoutResponse{}, store.ErrInvalidTransaction
+		splits := tx.PaymentSplits
+		if len(splits) == 0 {
+			splits = decodePaymentSplits(tx.PaymentReference)
 		}
-		splitTotal := int64(0)
-		for _, split := range req.PaymentSplits {
-			if !isSplitMethodSupported(split.Method) || split.AmountCents < 1 {
-				return domain.CheckoutResponse{}, store.ErrInvalidTransaction
+		cash := int64(0)
+		for _, split := range splits {
+			if split.Method == "cash" {
+				cash += split.AmountCents
 			}
-			if split.Method != "cash" && strings.TrimSpace(split.Reference) == "" {
-				return domain.CheckoutResponse{}, store.ErrInvalidTransaction
+		}
+		return cash
+	default:
+		return 0
+	}
+}
+
+func (s *Service) Checkout(ctx context.Context, req domain.CheckoutRequest) (domain.CheckoutResponse, error) {
+	tx, existing, err := s.prepareCheckout(ctx, &req)
+	if err != nil {
+		return domain.CheckoutResponse{}, err
+	}
+	if existing != nil {
+		return s.toCheckoutResponse(existing, true), nil
+	}
+
+	created, err := s.repo.CreateCheckout(ctx, tx)
+	if err != nil {
+		return domain.CheckoutResponse{}, err
+	}
+	// A concurrent request with the same idempotency key can win the race
+	// after the lookup above; the repository then hands back its sale.
+	if created.ID != tx.ID {
+		return s.toCheckoutResponse(created, true), nil
+	}
+	s.recordCheckout(ctx, req, created)
+	return s.toCheckoutResponse(created, false), nil
+}
+
+// prepareCheckout validates a checkout request, normalising req in place, and
+// builds the transaction to persist. A replayed idempotency key returns the
+// stored transaction instead.
+func (s *Service) prepareCheckout(ctx context.Context, req *domain.CheckoutRequest) (domain.Transaction, *domain.Transaction, error) {
+	if err := s.normalizeCheckoutRequest(req); err != nil {
+		return domain.Transaction{}, nil, err
+	}
+	if req.IdempotencyKey == "" {
+		req.IdempotencyKey = s.newID("idem")
+	}
+
+	if req.ManualOverride {
+		actor, ok := ActorFromContext(ctx)
+		if !ok || actor.Role != "admin" {
+			return domain.Transaction{}, nil, fmt.Errorf("%w for manual override", ErrAdminRequired)
+		}
+	}
+
+	if err := s.checkTerminal(ctx, req.StoreID, req.TerminalID); err != nil {
+		return domain.Transaction{}, nil, err
+	}
+	shift, err := s.GetActiveShift(ctx, req.StoreID, req.TerminalID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return domain.Transaction{}, nil, ErrNoActiveShift
+		}
+		return domain.Transaction{}, nil, err
+	}
+	if s.enforceShiftOwnership {
+		actor, _ := ActorFromContext(ctx)
+		if actor.Role != "admin" && shift.Shift.OpenedBy != "" && shift.Shift.OpenedBy != actor.Username {
+			return domain.Transaction{}, nil, ErrShiftNotOwned
+		}
+	}
+
+	normalized := normalizeItems(req.CartItems)
+	if len(normalized) == 0 {
+		return domain.Transaction{}, nil, store.ErrEmptyCart
+	}
+
+	if existing, err := s.repo.FindTransactionByIdempotency(ctx, req.IdempotencyKey); err == nil {
+		return domain.Transaction{}, existing, nil
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return domain.Transaction{}, nil, err
+	}
+
+	pricing, err := s.priceCart(ctx, normalized, req.DiscountCents, req.TaxRatePercent)
+	if err != nil {
+		return domain.Transaction{}, nil, err
+	}
+	req.DiscountCents = pricing.discountCents
+	if req.ChangeAsCredit && req.StoreCreditCode == "" {
+		req.StoreCreditCode = s.newID("voucher")
+	}
+	totalCents := pricing.totalCents
+
+	switch req.PaymentMethod {
+	case "cash":
+		if req.CashReceivedCents < totalCents {
+			return domain.Transaction{}, nil, store.ErrInsufficientPayment
+		}
+	case "split":
+		if len(req.PaymentSplits) < 2 {
+			return domain.Transaction{}, nil, fmt.Errorf("%w: at least two legs required", store.ErrInvalidSplitPayment)
+		}
+		splitTotal := int64(0)
+		splitCash := int64(0)
+		for _, split := range req.PaymentSplits {
+			if !isSplitMethodSupported(split.Method) {
+				return domain.Transaction{}, nil, fmt.Errorf("%w %q", store.ErrUnsupportedPaymentMethod, split.Method)
+			}
+			if err := s.checkPaymentMethodEnabled(req.StoreID, split.Method); err != nil {
+				return domain.Transaction{}, nil, err
+			}
+			if split.AmountCents < 1 {
+				return domain.Transaction{}, nil, fmt.Errorf("%w: %s leg amount must be positive", store.ErrInvalidSplitPayment, split.Method)
 			}
 			splitTotal += split.AmountCents
+			if split.Method == "cash" {
+				splitCash += split.AmountCents
+			}
+		}
+		if err := validateSplitReferences(req.PaymentSplits); err != nil {
+			return domain.Transaction{}, nil, err
 		}
-		if splitTotal != totalCents {
-			return domain.CheckoutResponse{}, store.ErrInvalidTransaction
+		// A split only overpays when its change is kept as store credit,
+		// and the change can only come out of the cash legs.
+		overpaid := splitTotal - totalCents
+		if overpaid < 0 {
+			return domain.Transaction{}, nil, store.ErrInsufficientPayment
+		}
+		if overpaid > 0 && (!req.ChangeAsCredit || overpaid > splitCash) {
+			return domain.Transaction{}, nil, fmt.Errorf("%w: legs exceed the total by more than change kept as credit", store.ErrInvalidSplitPayment)
 		}
 		req.CashReceivedCents = splitTotal
 		req.PaymentReference = encodePaymentSplits(req.PaymentSplits)
 	default:
 		// Non-cash single payment.
 		if strings.TrimSpace(req.PaymentReference) == "" {
-			return domain.CheckoutResponse{}, store.ErrInvalidTransaction
+			return domain.Transaction{}, nil, ErrInvalidPaymentReference
 		}
 	}
 
 	lineItems := make([]domain.TransactionLine, 0, len(normalized))
 	for _, item := range normalized {
-		lineItems = append(lineItems, domain.TransactionLine{SKU: item.SKU, Qty: item.Qty})
+		lineItems = append(lineItems, domain.TransactionLine{SKU: item.SKU, Qty: item.Qty, Serials: item.Serials})
 	}
 
 	tx := domain.Transaction{
-		ID:                     xid.New("tx"),
+		ID:                     s.newID("tx"),
 		StoreID:                req.StoreID,
 		TerminalID:             req.TerminalID,
 		ShiftID:                shift.Shift.ID,
@@ -446,6 +1174,8 @@ func (s *Service) Checkout(ctx context.Context, req domain.CheckoutRequest) (dom
 		CashReceivedCents:      req.CashReceivedCents,
 		DiscountCents:          req.DiscountCents,
 		TaxRatePercent:         req.TaxRatePercent,
+		StoreCreditCode:        req.StoreCreditCode,
+		CustomerID:             req.CustomerID,
 		Status:                 domain.TxStatusPaid,
 		RecommendationShown:    req.RecommendationInfo.Shown,
 		RecommendationAccepted: req.RecommendationInfo.Accepted,
@@ -453,12 +1183,14 @@ func (s *Service) Checkout(ctx context.Context, req domain.CheckoutRequest) (dom
 		CreatedAt:              time.Now().UTC(),
 		Items:                  lineItems,
 	}
+	tx.ExperimentBucket = s.experimentBucket(tx.TerminalID, tx.CreatedAt)
+	return tx, nil, nil
+}
 
-	created, err := s.repo.CreateCheckout(ctx, tx)
-	if err != nil {
-		return domain.CheckoutResponse{}, err
-	}
-
+// recordCheckout logs the recommendation outcome and audit entry of a sale
+// that has just been persisted, and checks its SKUs for low stock in the
+// background.
+func (s *Service) recordCheckout(ctx context.Context, req domain.CheckoutRequest, created *domain.Transaction) {
 	if req.RecommendationInfo.Shown {
 		action := domain.RecommendationRejectedAction
 		if req.RecommendationInfo.Accepted {
@@ -466,14 +1198,15 @@ func (s *Service) Checkout(ctx context.Context, req domain.CheckoutRequest) (dom
 		}
 
 		_ = s.repo.CreateRecommendationEvent(ctx, domain.RecommendationEvent{
-			StoreID:       req.StoreID,
-			TerminalID:    req.TerminalID,
-			TransactionID: created.ID,
-			SKU:           req.RecommendationInfo.SKU,
-			Action:        action,
-			ReasonCode:    req.RecommendationInfo.ReasonCode,
-			Confidence:    req.RecommendationInfo.Confidence,
-			CreatedAt:     time.Now().UTC(),
+			StoreID:          req.StoreID,
+			TerminalID:       req.TerminalID,
+			TransactionID:    created.ID,
+			SKU:              req.RecommendationInfo.SKU,
+			Action:           action,
+			ReasonCode:       req.RecommendationInfo.ReasonCode,
+			Confidence:       req.RecommendationInfo.Confidence,
+			ExperimentBucket: created.ExperimentBucket,
+			CreatedAt:        time.Now().UTC(),
 		})
 	}
 
@@ -493,7 +1226,9 @@ func (s *Service) Checkout(ctx context.Context, req domain.CheckoutRequest) (dom
 		),
 	)
 
-	return toCheckoutResponse(created, false), nil
+	if s.stockAlerts != nil {
+		go s.alertLowStock(context.WithoutCancel(ctx), *created)
+	}
 }
 
 func (s *Service) LookupCheckoutByIdempotency(ctx context.Context, idempotencyKey string) (domain.CheckoutLookupResponse, error) {
@@ -508,7 +1243,7 @@ func (s *Service) LookupCheckoutByIdempotency(ctx context.Context, idempotencyKe
 		}
 		return domain.CheckoutLookupResponse{}, err
 	}
-	checkout := toCheckoutResponse(tx, false)
+	checkout := s.toCheckoutResponse(tx, false)
 	return domain.CheckoutLookupResponse{Found: true, Checkout: &checkout}, nil
 }
 
@@ -519,6 +1254,16 @@ func (s *Service) VoidTransaction(ctx context.Context, req domain.VoidTransactio
 	if req.Reason == "" {
 		req.Reason = "unspecified"
 	}
+	defer s.lockDailyCaps(ctx)()
+	if s.dailyVoidCap > 0 {
+		original, err := s.repo.FindTransactionByID(ctx, req.TransactionID)
+		if err != nil {
+			return domain.VoidTransactionResponse{}, err
+		}
+		if err := s.checkDailyCaps(ctx, original, 1, 0, req.OverrideDailyCap); err != nil {
+			return domain.VoidTransactionResponse{}, err
+		}
+	}
 
 	voidedAt := time.Now().UTC()
 	tx, err := s.repo.VoidTransaction(ctx, req.TransactionID, req.Reason, voidedAt)
@@ -531,10 +1276,45 @@ func (s *Service) VoidTransaction(ctx context.Context, req domain.VoidTransactio
 	return domain.VoidTransactionResponse{
 		TransactionID: tx.ID,
 		Status:        tx.Status,
-		VoidedAt:      voidedAt.Format(time.RFC3339),
+		VoidedAt:      s.formatTimestamp(voidedAt),
 	}, nil
 }
 
+// SetRefundWindowDays limits refunds and item returns to sales made within
+// the last days. Zero, the default, allows them at any age.
+func (s *Service) SetRefundWindowDays(days int) {
+	if days < 0 {
+		days = 0
+	}
+	s.refundWindowDays = days
+}
+
+// checkRefundWindow rejects refunding tx once the refund window has passed.
+// An admin may override the window with a note, which is audited; the
+// handlers have already checked the manager PIN.
+func (s *Service) checkRefundWindow(ctx context.Context, tx *domain.Transaction, override bool, note string) error {
+	if s.refundWindowDays == 0 {
+		return nil
+	}
+	deadline := tx.CreatedAt.AddDate(0, 0, s.refundWindowDays)
+	if !time.Now().After(deadline) {
+		return nil
+	}
+	if !override {
+		return fmt.Errorf("%w: transaction %s was sold %s, more than %d days ago", ErrRefundWindowExpired, tx.ID, tx.CreatedAt.Format("2006-01-02"), s.refundWindowDays)
+	}
+	actor, ok := ActorFromContext(ctx)
+	if !ok || actor.Role != "admin" {
+		return fmt.Errorf("%w for refund window override", ErrAdminRequired)
+	}
+	note = strings.TrimSpace(note)
+	if note == "" {
+		return fmt.Errorf("%w: override_note is required to override the refund window", store.ErrInvalidTransaction)
+	}
+	s.logAudit(ctx, tx.StoreID, "refund_window_override", "transaction", tx.ID, fmt.Sprintf("sold_at=%s,window_days=%d,note=%s", tx.CreatedAt.Format(time.RFC3339), s.refundWindowDays, note))
+	return nil
+}
+
 func (s *Service) Refund(ctx context.Context, req domain.RefundRequest) (domain.RefundResponse, error) {
 	if req.OriginalTransactionID == "" || req.AmountCents <= 0 {
 		return domain.RefundResponse{}, store.ErrInvalidTransaction
@@ -553,9 +1333,16 @@ func (s *Service) Refund(ctx context.Context, req domain.RefundRequest) (domain.
 	if req.AmountCents > tx.TotalCents {
 		return domain.RefundResponse{}, store.ErrInvalidTransaction
 	}
+	if err := s.checkRefundWindow(ctx, tx, req.OverrideRefundWindow, req.OverrideNote); err != nil {
+		return domain.RefundResponse{}, err
+	}
+	defer s.lockDailyCaps(ctx)()
+	if err := s.checkDailyCaps(ctx, tx, 0, req.AmountCents, req.OverrideDailyCap); err != nil {
+		return domain.RefundResponse{}, err
+	}
 
 	refund := domain.Refund{
-		ID:                    xid.New("refund"),
+		ID:                    s.newID("refund"),
 		OriginalTransactionID: req.OriginalTransactionID,
 		Reason:                req.Reason,
 		AmountCents:           req.AmountCents,
@@ -573,179 +1360,825 @@ func (s *Service) Refund(ctx context.Context, req domain.RefundRequest) (domain.
 	return domain.RefundResponse{Refund: *created}, nil
 }
 
+// SyncOffline replays sales rung up while a terminal was offline, oldest
+// first by QueuedAt. Statuses come back in request order. By default each
+// sale is accepted or rejected on its own; with AllOrNothing one rejection
+// rolls back the whole envelope. A retried envelope gets the response of its
+// first upload; rejected sales must be resent in a new envelope.
 func (s *Service) SyncOffline(ctx context.Context, req domain.OfflineSyncRequest) (domain.OfflineSyncResponse, error) {
+	if req.EnvelopeID == "" {
+		return s.replayOffline(ctx, req)
+	}
+
+	storeID := req.StoreID
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.OfflineSyncResponse{}, err
+	}
+	cached, err := s.repo.GetOfflineEnvelope(ctx, storeID, req.TerminalID, req.EnvelopeID, time.Now().UTC())
+	if err == nil {
+		return *cached, nil
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return domain.OfflineSyncResponse{}, err
+	}
+
+	resp, err := s.replayOffline(ctx, req)
+	if err != nil {
+		return domain.OfflineSyncResponse{}, err
+	}
+	if err := s.repo.SaveOfflineEnvelope(ctx, storeID, req.TerminalID, resp, time.Now().UTC().Add(s.offlineEnvelopeTTL)); err != nil {
+		log.Printf("[service] WARN: failed to record offline envelope %s: %v", req.EnvelopeID, err)
+	}
+	return resp, nil
+}
+
+// RunOfflineEnvelopeJanitor prunes expired offline envelope records every
+// interval until ctx is cancelled.
+func (s *Service) RunOfflineEnvelopeJanitor(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	s.jobs.Scheduled(jobs.OfflineEnvelopeJanitor, time.Now().Add(interval))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			pruned, err := s.repo.PruneOfflineEnvelopes(ctx, now.UTC())
+			s.jobs.Ran(jobs.OfflineEnvelopeJanitor, time.Now(), err)
+			s.jobs.Scheduled(jobs.OfflineEnvelopeJanitor, now.Add(interval))
+			if err != nil {
+				log.Printf("[service] WARN: prune offline envelopes: %v", err)
+				continue
+			}
+			if pruned > 0 {
+				log.Printf("[service] pruned %d expired offline envelopes", pruned)
+			}
+		}
+	}
+}
+
+func (s *Service) replayOffline(ctx context.Context, req domain.OfflineSyncRequest) (domain.OfflineSyncResponse, error) {
 	resp := domain.OfflineSyncResponse{
 		EnvelopeID: req.EnvelopeID,
-		Statuses:   make([]domain.OfflineSyncStatus, 0, len(req.Transactions)),
+		Statuses:   make([]domain.OfflineSyncStatus, len(req.Transactions)),
 	}
-
-	for _, tx := range req.Transactions {
-		checkoutReq := tx.Checkout
-		if checkoutReq.StoreID == "" {
-			checkoutReq.StoreID = req.StoreID
+	order := offlineReplayOrder(req.Transactions)
+	if req.AllOrNothing {
+		if err := s.syncOfflineBatch(ctx, req, order, resp.Statuses); err != nil {
+			return domain.OfflineSyncResponse{}, err
 		}
-		if checkoutReq.TerminalID == "" {
-			checkoutReq.TerminalID = req.TerminalID
+		return resp, nil
+	}
+
+	for _, i := range order {
+		tx := req.Transactions[i]
+		checkoutResp, err := s.Checkout(ctx, offlineCheckoutRequest(req, tx))
+		if errors.Is(err, store.ErrServiceReadOnly) {
+			// Fail the upload so the terminal keeps the sales and retries.
+			return domain.OfflineSyncResponse{}, err
 		}
-		if checkoutReq.IdempotencyKey == "" {
-			checkoutReq.IdempotencyKey = tx.ClientTransactionID
+		if err != nil {
+			resp.Statuses[i] = rejectedOfflineStatus(tx.ClientTransactionID, err)
+			continue
 		}
 
-		checkoutResp, err := s.Checkout(ctx, checkoutReq)
 		status := domain.OfflineSyncStatus{
 			ClientTransactionID: tx.ClientTransactionID,
+			Status:              "accepted",
+			TransactionID:       checkoutResp.TransactionID,
+		}
+		if checkoutResp.Duplicate {
+			status.Status = "duplicate"
 		}
+		resp.Statuses[i] = status
+	}
+
+	return resp, nil
+}
+
+// syncOfflineBatch replays an AllOrNothing envelope: every new sale is
+// validated first and then stored in a single repository batch.
+func (s *Service) syncOfflineBatch(ctx context.Context, req domain.OfflineSyncRequest, order []int, statuses []domain.OfflineSyncStatus) error {
+	pending := make([]int, 0, len(order))
+	checkouts := make([]domain.CheckoutRequest, 0, len(order))
+	txs := make([]domain.Transaction, 0, len(order))
+	for _, i := range order {
+		checkoutReq := offlineCheckoutRequest(req, req.Transactions[i])
+		tx, existing, err := s.prepareCheckout(ctx, &checkoutReq)
 		if err != nil {
-			status.Status = "rejected"
-			status.Reason = err.Error()
-			resp.Statuses = append(resp.Statuses, status)
+			abortOfflineBatch(req, statuses, i, err)
+			return nil
+		}
+		if existing != nil {
+			statuses[i] = domain.OfflineSyncStatus{
+				ClientTransactionID: req.Transactions[i].ClientTransactionID,
+				Status:              "duplicate",
+				TransactionID:       existing.ID,
+			}
 			continue
 		}
+		pending = append(pending, i)
+		checkouts = append(checkouts, checkoutReq)
+		txs = append(txs, tx)
+	}
+	if len(txs) == 0 {
+		return nil
+	}
 
-		if checkoutResp.Duplicate {
-			status.Status = "duplicate"
-		} else {
-			status.Status = "accepted"
+	created, err := s.repo.CreateCheckoutBatch(ctx, txs)
+	if err != nil {
+		var batchErr *store.BatchError
+		if !errors.As(err, &batchErr) {
+			return err
+		}
+		abortOfflineBatch(req, statuses, pending[batchErr.Index], batchErr.Err)
+		return nil
+	}
+	for j, i := range pending {
+		s.recordCheckout(ctx, checkouts[j], created[j])
+		statuses[i] = domain.OfflineSyncStatus{
+			ClientTransactionID: req.Transactions[i].ClientTransactionID,
+			Status:              "accepted",
+			TransactionID:       created[j].ID,
 		}
-		status.TransactionID = checkoutResp.TransactionID
-		resp.Statuses = append(resp.Statuses, status)
 	}
+	return nil
+}
 
-	return resp, nil
+// abortOfflineBatch rejects the sale that failed and marks every other sale
+// that is not already stored as rolled back with it.
+func abortOfflineBatch(req domain.OfflineSyncRequest, statuses []domain.OfflineSyncStatus, failed int, err error) {
+	failedID := req.Transactions[failed].ClientTransactionID
+	for i, tx := range req.Transactions {
+		switch {
+		case i == failed:
+			statuses[i] = rejectedOfflineStatus(failedID, err)
+		case statuses[i].Status != "duplicate":
+			statuses[i] = domain.OfflineSyncStatus{
+				ClientTransactionID: tx.ClientTransactionID,
+				Status:              "rejected",
+				Reason:              "rolled back because " + failedID + " was rejected",
+				ReasonCode:          domain.OfflineReasonBatchAborted,
+			}
+		}
+	}
+}
+
+// offlineReplayOrder returns the indexes of txs sorted by QueuedAt. Sales
+// without a timestamp keep their relative order after the timestamped ones.
+func offlineReplayOrder(txs []domain.OfflineTransaction) []int {
+	order := make([]int, len(txs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		left, right := txs[order[a]].QueuedAt, txs[order[b]].QueuedAt
+		if left.IsZero() || right.IsZero() {
+			return !left.IsZero() && right.IsZero()
+		}
+		return left.Before(right)
+	})
+	return order
+}
+
+func offlineCheckoutRequest(req domain.OfflineSyncRequest, tx domain.OfflineTransaction) domain.CheckoutRequest {
+	checkoutReq := tx.Checkout
+	if checkoutReq.StoreID == "" {
+		checkoutReq.StoreID = req.StoreID
+	}
+	if checkoutReq.TerminalID == "" {
+		checkoutReq.TerminalID = req.TerminalID
+	}
+	if checkoutReq.IdempotencyKey == "" {
+		checkoutReq.IdempotencyKey = tx.ClientTransactionID
+	}
+	return checkoutReq
+}
+
+func rejectedOfflineStatus(clientTransactionID string, err error) domain.OfflineSyncStatus {
+	status := domain.OfflineSyncStatus{
+		ClientTransactionID: clientTransactionID,
+		Status:              "rejected",
+		Reason:              err.Error(),
+		ReasonCode:          offlineReasonCode(err),
+	}
+	var skuErr *store.SKUError
+	if errors.As(err, &skuErr) {
+		status.ConflictSKU = skuErr.SKU
+	}
+	return status
+}
+
+// offlineReasonCode classifies why a replayed sale was rejected so offline
+// clients can react without parsing the human-readable reason.
+func offlineReasonCode(err error) string {
+	switch {
+	case errors.Is(err, store.ErrInsufficientStock):
+		return domain.OfflineReasonInsufficientStock
+	case errors.Is(err, ErrNoActiveShift):
+		return domain.OfflineReasonNoActiveShift
+	case errors.Is(err, ErrShiftNotOwned):
+		return domain.OfflineReasonShiftNotOwned
+	case errors.Is(err, store.ErrInvalidTransaction):
+		return domain.OfflineReasonInvalid
+	default:
+		return domain.OfflineReasonError
+	}
 }
 
 func (s *Service) AttachMetrics(ctx context.Context, storeID string, days int) (domain.AttachMetrics, error) {
-	if storeID == "" {
-		storeID = s.defaultStoreID
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.AttachMetrics{}, err
 	}
 	if days < 1 {
 		days = 30
 	}
-	to := time.Now().UTC()
-	from := to.Add(-time.Duration(days) * 24 * time.Hour)
+	from, to := s.attachWindow(days)
+
+	metrics, err := s.repo.GetAttachMetrics(ctx, storeID, from, to)
+	if err != nil {
+		return domain.AttachMetrics{}, err
+	}
+	return metrics, nil
+}
+
+// AttachMetricsByReason returns shown/accepted counts and attach rate per
+// recommendation reason code over the same window as AttachMetrics.
+func (s *Service) AttachMetricsByReason(ctx context.Context, storeID string, days int) ([]domain.AttachReasonMetrics, error) {
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return nil, err
+	}
+	if days < 1 {
+		days = 30
+	}
+	from, to := s.attachWindow(days)
+	return s.repo.GetAttachMetricsByReason(ctx, storeID, from, to)
+}
+
+// attachWindow covers the store's current day plus the days-1 days before it.
+func (s *Service) attachWindow(days int) (time.Time, time.Time) {
+	today, _, _ := s.storeDay("")
+	return today.AddDate(0, 0, -(days - 1)), time.Now().UTC()
+}
+
+func (s *Service) StockOpname(ctx context.Context, req domain.StockOpnameRequest) (domain.StockOpnameResponse, error) {
+	actor, ok := ActorFromContext(ctx)
+	if !ok || actor.Role != "admin" {
+		return domain.StockOpnameResponse{}, ErrAdminRequired
+	}
+
+	if err := s.resolveStoreID(&req.StoreID); err != nil {
+		return domain.StockOpnameResponse{}, err
+	}
+	if len(req.Items) == 0 {
+		return domain.StockOpnameResponse{}, store.ErrInvalidTransaction
+	}
+
+	items := make([]domain.StockOpnameAdjustment, 0, len(req.Items))
+	skus := make([]string, 0, len(req.Items))
+	for _, item := range req.Items {
+		sku := strings.ToUpper(strings.TrimSpace(item.SKU))
+		if sku == "" || item.CountedQty < 0 {
+			return domain.StockOpnameResponse{}, store.ErrInvalidTransaction
+		}
+		items = append(items, domain.StockOpnameAdjustment{SKU: sku, CountedQty: item.CountedQty})
+		skus = append(skus, sku)
+	}
+	if err := s.rejectSerialized(ctx, skus...); err != nil {
+		return domain.StockOpnameResponse{}, err
+	}
+
+	record, err := s.repo.CreateStockOpname(ctx, domain.StockOpnameRecord{
+		ID:        s.newID("opname"),
+		StoreID:   req.StoreID,
+		Notes:     req.Notes,
+		CreatedBy: actor.Username,
+		CreatedAt: time.Now().UTC(),
+		Items:     items,
+	})
+	if err != nil {
+		return domain.StockOpnameResponse{}, err
+	}
+
+	s.logAudit(ctx, req.StoreID, "stock_opname", "inventory", record.ID, fmt.Sprintf("items=%d,notes=%s", len(record.Items), req.Notes))
+
+	return s.toStockOpnameResponse(*record), nil
+}
+
+// maxStockBulkItems caps a bulk stock set so it stays one reasonably sized
+// statement.
+const maxStockBulkItems = 5000
+
+// SetStockBulk overwrites the on-hand quantity of many SKUs in one
+// transaction, e.g. to load the opening stock of a new store. Unlike an
+// opname it records no counted-versus-system variance. Any unknown SKU,
+// negative quantity or repeated SKU fails the whole batch.
+func (s *Service) SetStockBulk(ctx context.Context, req domain.StockBulkSetRequest) (domain.StockBulkSetResponse, error) {
+	actor, ok := ActorFromContext(ctx)
+	if !ok || actor.Role != "admin" {
+		return domain.StockBulkSetResponse{}, ErrAdminRequired
+	}
+
+	if err := s.resolveStoreID(&req.StoreID); err != nil {
+		return domain.StockBulkSetResponse{}, err
+	}
+	if len(req.Items) == 0 || len(req.Items) > maxStockBulkItems {
+		return domain.StockBulkSetResponse{}, fmt.Errorf("%w: between 1 and %d items required", store.ErrInvalidTransaction, maxStockBulkItems)
+	}
+
+	quantities := make(map[string]int, len(req.Items))
+	skus := make([]string, 0, len(req.Items))
+	totalQty := 0
+	for _, item := range req.Items {
+		sku := strings.ToUpper(strings.TrimSpace(item.SKU))
+		if sku == "" || item.Qty < 0 {
+			return domain.StockBulkSetResponse{}, &store.SKUError{SKU: sku, Err: store.ErrInvalidTransaction}
+		}
+		if _, seen := quantities[sku]; seen {
+			return domain.StockBulkSetResponse{}, &store.SKUError{SKU: sku, Err: fmt.Errorf("%w: duplicate sku", store.ErrInvalidTransaction)}
+		}
+		quantities[sku] = item.Qty
+		skus = append(skus, sku)
+		totalQty += item.Qty
+	}
+
+	products, err := s.repo.GetProductsBySKUs(ctx, skus)
+	if err != nil {
+		return domain.StockBulkSetResponse{}, err
+	}
+	for _, sku := range skus {
+		product, ok := products[sku]
+		if !ok {
+			return domain.StockBulkSetResponse{}, &store.SKUError{SKU: sku, Err: store.ErrNotFound}
+		}
+		if product.Serialized {
+			return domain.StockBulkSetResponse{}, &store.SKUError{SKU: sku, Err: store.ErrInvalidSerials}
+		}
+	}
+
+	if err := s.repo.SetStockBulk(ctx, req.StoreID, quantities); err != nil {
+		return domain.StockBulkSetResponse{}, err
+	}
+
+	s.logAudit(ctx, req.StoreID, "stock_bulk_set", "inventory", req.StoreID, fmt.Sprintf("skus=%d,total_qty=%d", len(skus), totalQty))
+
+	return domain.StockBulkSetResponse{StoreID: req.StoreID, SKUCount: len(skus), TotalQty: totalQty}, nil
+}
+
+func (s *Service) GetStockOpname(ctx context.Context, opnameID string) (domain.StockOpnameResponse, error) {
+	opnameID = strings.TrimSpace(opnameID)
+	if opnameID == "" {
+		return domain.StockOpnameResponse{}, store.ErrInvalidTransaction
+	}
+	record, err := s.repo.GetStockOpname(ctx, opnameID)
+	if err != nil {
+		return domain.StockOpnameResponse{}, err
+	}
+	return s.toStockOpnameResponse(*record), nil
+}
+
+func (s *Service) ReceiveInventoryLot(ctx context.Context, req domain.InventoryLotReceiveRequest) (domain.InventoryLot, error) {
+	actor, ok := ActorFromContext(ctx)
+	if !ok || actor.Role != "admin" {
+		return domain.InventoryLot{}, ErrAdminRequired
+	}
+	lot, err := s.buildReceivedLot(ctx, req)
+	if err != nil {
+		return domain.InventoryLot{}, err
+	}
+
+	created, err := s.repo.CreateInventoryLot(ctx, lot)
+	if err != nil {
+		return domain.InventoryLot{}, err
+	}
+	s.logLotReceive(ctx, *created)
+	return *created, nil
+}
+
+// ReceiveInventoryLots receives a whole delivery at once. Every entry is
+// validated up front and the lots are stored in a single transaction, so one
+// bad line rejects the batch.
+func (s *Service) ReceiveInventoryLots(ctx context.Context, reqs []domain.InventoryLotReceiveRequest) ([]domain.InventoryLot, error) {
+	actor, ok := ActorFromContext(ctx)
+	if !ok || actor.Role != "admin" {
+		return nil, ErrAdminRequired
+	}
+	if len(reqs) == 0 {
+		return nil, store.ErrInvalidTransaction
+	}
+
+	lots := make([]domain.InventoryLot, 0, len(reqs))
+	for i, req := range reqs {
+		lot, err := s.buildReceivedLot(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("lot %d: %w", i+1, err)
+		}
+		lots = append(lots, lot)
+	}
+
+	created, err := s.repo.CreateInventoryLots(ctx, lots)
+	if err != nil {
+		return nil, err
+	}
+	for _, lot := range created {
+		s.logLotReceive(ctx, lot)
+	}
+	return created, nil
+}
+
+// SetExpiredLotGraceDays lets received lots carry an expiry date up to days
+// before today in the store's time zone. The default of zero only accepts
+// lots expiring today or later.
+func (s *Service) SetExpiredLotGraceDays(days int) {
+	if days < 0 {
+		days = 0
+	}
+	s.expiredLotGraceDays = days
+}
+
+func (s *Service) earliestReceivableExpiry() time.Time {
+	today := time.Now().In(s.storeLocation)
+	return time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, -s.expiredLotGraceDays)
+}
+
+func (s *Service) buildReceivedLot(ctx context.Context, req domain.InventoryLotReceiveRequest) (domain.InventoryLot, error) {
+	if err := s.resolveStoreID(&req.StoreID); err != nil {
+		return domain.InventoryLot{}, err
+	}
+	req.SKU = strings.ToUpper(strings.TrimSpace(req.SKU))
+	req.LotCode = strings.TrimSpace(req.LotCode)
+	req.Notes = strings.TrimSpace(req.Notes)
+	if req.SKU == "" || req.Qty < 1 || req.CostCents < 1 {
+		return domain.InventoryLot{}, store.ErrInvalidTransaction
+	}
+	product, err := s.repo.GetProductBySKU(ctx, req.SKU)
+	if err != nil {
+		return domain.InventoryLot{}, err
+	}
+	// Checkout sells serialized units by serial only, so a serialized lot
+	// received without one serial per unit could never be sold.
+	serials := normalizeSerials(req.Serials)
+	if (product.Serialized || len(req.Serials) > 0) && len(serials) != req.Qty {
+		return domain.InventoryLot{}, fmt.Errorf("%w: %d serials for qty %d", store.ErrInvalidTransaction, len(serials), req.Qty)
+	}
+
+	var expiryDate *time.Time
+	if strings.TrimSpace(req.ExpiryDate) != "" {
+		parsed, err := time.Parse("2006-01-02", req.ExpiryDate)
+		if err != nil {
+			return domain.InventoryLot{}, store.ErrInvalidTransaction
+		}
+		exp := parsed.UTC()
+		if earliest := s.earliestReceivableExpiry(); exp.Before(earliest) {
+			return domain.InventoryLot{}, fmt.Errorf("%w: expiry date %s is before %s; write expired stock off instead of receiving it", store.ErrInvalidTransaction, req.ExpiryDate, earliest.Format("2006-01-02"))
+		}
+		expiryDate = &exp
+	}
+
+	return domain.InventoryLot{
+		ID:           s.newID("lot"),
+		StoreID:      req.StoreID,
+		SKU:          req.SKU,
+		LotCode:      req.LotCode,
+		ExpiryDate:   expiryDate,
+		QtyReceived:  req.Qty,
+		QtyAvailable: req.Qty,
+		CostCents:    req.CostCents,
+		SourceType:   "manual",
+		Notes:        req.Notes,
+		Serials:      serials,
+		ReceivedAt:   time.Now().UTC(),
+	}, nil
+}
+
+func (s *Service) logLotReceive(ctx context.Context, lot domain.InventoryLot) {
+	expiry := ""
+	if lot.ExpiryDate != nil {
+		expiry = lot.ExpiryDate.Format("2006-01-02")
+	}
+	s.logAudit(ctx, lot.StoreID, "inventory_lot_receive", "inventory_lot", lot.ID, fmt.Sprintf("sku=%s,qty=%d,expiry=%s", lot.SKU, lot.QtyReceived, expiry))
+}
+
+// ListSerials returns the serial numbers recorded for a SKU, optionally
+// narrowed to one status.
+func (s *Service) ListSerials(ctx context.Context, storeID string, sku string, status string) (domain.InventorySerialListResponse, error) {
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.InventorySerialListResponse{}, err
+	}
+	sku = strings.ToUpper(strings.TrimSpace(sku))
+	status = strings.ToLower(strings.TrimSpace(status))
+	if sku == "" {
+		return domain.InventorySerialListResponse{}, store.ErrInvalidTransaction
+	}
+	switch status {
+	case "", domain.SerialStatusAvailable, domain.SerialStatusSold:
+	default:
+		return domain.InventorySerialListResponse{}, store.ErrInvalidTransaction
+	}
+
+	serials, err := s.repo.ListSerials(ctx, storeID, sku, status)
+	if err != nil {
+		return domain.InventorySerialListResponse{}, err
+	}
+	return domain.InventorySerialListResponse{StoreID: storeID, SKU: sku, Status: status, Serials: serials}, nil
+}
+
+// ListStockMovements returns the stock ledger for a store between two
+// calendar dates (inclusive). Without dates it covers the last 30 days.
+func (s *Service) ListStockMovements(ctx context.Context, storeID string, sku string, fromDate string, toDate string) (domain.StockMovementListResponse, error) {
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.StockMovementListResponse{}, err
+	}
+	sku = strings.ToUpper(strings.TrimSpace(sku))
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	to := today
+	if strings.TrimSpace(toDate) != "" {
+		parsed, err := time.Parse("2006-01-02", toDate)
+		if err != nil {
+			return domain.StockMovementListResponse{}, store.ErrInvalidTransaction
+		}
+		to = parsed.UTC()
+	}
+	from := to.AddDate(0, 0, -29)
+	if strings.TrimSpace(fromDate) != "" {
+		parsed, err := time.Parse("2006-01-02", fromDate)
+		if err != nil {
+			return domain.StockMovementListResponse{}, store.ErrInvalidTransaction
+		}
+		from = parsed.UTC()
+	}
+	to = to.Add(24 * time.Hour)
+	if !from.Before(to) {
+		return domain.StockMovementListResponse{}, store.ErrInvalidTransaction
+	}
+
+	movements, err := s.repo.ListStockMovements(ctx, storeID, sku, from, to)
+	if err != nil {
+		return domain.StockMovementListResponse{}, err
+	}
+	return domain.StockMovementListResponse{StoreID: storeID, SKU: sku, From: from, To: to, Movements: movements}, nil
+}
+
+func (s *Service) ListInventoryLots(ctx context.Context, storeID string, sku string, includeExpired bool, limit int) (domain.InventoryLotListResponse, error) {
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.InventoryLotListResponse{}, err
+	}
+	lots, err := s.repo.ListInventoryLots(ctx, storeID, strings.ToUpper(strings.TrimSpace(sku)), includeExpired, limit)
+	if err != nil {
+		return domain.InventoryLotListResponse{}, err
+	}
+	now := time.Now().UTC()
+	for i := range lots {
+		lots[i].DaysToExpiry = daysToExpiry(lots[i].ExpiryDate, now)
+	}
+	return domain.InventoryLotListResponse{Lots: lots}, nil
+}
+
+func (s *Service) AdjustLotQty(ctx context.Context, lotID string, newQtyAvailable int, reason string, actor domain.Actor) (domain.InventoryLot, error) {
+	if actor.Role != "admin" {
+		return domain.InventoryLot{}, ErrAdminRequired
+	}
+	lotID = strings.TrimSpace(lotID)
+	reason = strings.TrimSpace(reason)
+	if lotID == "" || reason == "" {
+		return domain.InventoryLot{}, store.ErrInvalidTransaction
+	}
+
+	current, err := s.repo.GetInventoryLot(ctx, lotID)
+	if err != nil {
+		return domain.InventoryLot{}, err
+	}
+	if newQtyAvailable < 0 || newQtyAvailable > current.QtyReceived {
+		return domain.InventoryLot{}, fmt.Errorf("%w: qty_available must be between 0 and %d", store.ErrInvalidTransaction, current.QtyReceived)
+	}
+	if err := s.rejectSerialized(ctx, current.SKU); err != nil {
+		return domain.InventoryLot{}, err
+	}
+
+	lot, err := s.repo.AdjustLotQty(ctx, lotID, newQtyAvailable, domain.AuditLog{
+		ID:            s.newID("audit"),
+		StoreID:       current.StoreID,
+		ActorUsername: actor.Username,
+		ActorRole:     actor.Role,
+		Action:        "inventory_lot_adjust",
+		EntityType:    "inventory_lot",
+		EntityID:      lotID,
+		Detail:        fmt.Sprintf("sku=%s,from=%d,to=%d,reason=%s", current.SKU, current.QtyAvailable, newQtyAvailable, reason),
+		CreatedAt:     time.Now().UTC(),
+	})
+	if err != nil {
+		return domain.InventoryLot{}, err
+	}
+	return *lot, nil
+}
+
+func (s *Service) CorrectLotCost(ctx context.Context, lotID string, newCostCents int64, actor domain.Actor) (domain.InventoryLot, error) {
+	if actor.Role != "admin" {
+		return domain.InventoryLot{}, ErrAdminRequired
+	}
+	lotID = strings.TrimSpace(lotID)
+	if lotID == "" || newCostCents < 1 {
+		return domain.InventoryLot{}, store.ErrInvalidTransaction
+	}
+
+	current, err := s.repo.GetInventoryLot(ctx, lotID)
+	if err != nil {
+		return domain.InventoryLot{}, err
+	}
 
-	metrics, err := s.repo.GetAttachMetrics(ctx, storeID, from, to)
+	lot, err := s.repo.CorrectLotCost(ctx, lotID, newCostCents, domain.AuditLog{
+		ID:            s.newID("audit"),
+		StoreID:       current.StoreID,
+		ActorUsername: actor.Username,
+		ActorRole:     actor.Role,
+		Action:        "inventory_lot_cost_correct",
+		EntityType:    "inventory_lot",
+		EntityID:      lotID,
+		Detail:        fmt.Sprintf("sku=%s,from=%d,to=%d", current.SKU, current.CostCents, newCostCents),
+		CreatedAt:     time.Now().UTC(),
+	})
 	if err != nil {
-		return domain.AttachMetrics{}, err
+		return domain.InventoryLot{}, err
 	}
-	return metrics, nil
+	return *lot, nil
 }
 
-func (s *Service) StockOpname(ctx context.Context, req domain.StockOpnameRequest) (domain.StockOpnameResponse, error) {
-	actor, ok := ActorFromContext(ctx)
-	if !ok || actor.Role != "admin" {
-		return domain.StockOpnameResponse{}, fmt.Errorf("admin role required")
+// UpdateInventoryLot applies a lot edit that may change the quantity, the
+// cost or both. Both values are validated before either is written, so a
+// rejected cost cannot leave the quantity change behind.
+func (s *Service) UpdateInventoryLot(ctx context.Context, lotID string, req domain.InventoryLotUpdateRequest, actor domain.Actor) (domain.InventoryLot, error) {
+	if actor.Role != "admin" {
+		return domain.InventoryLot{}, ErrAdminRequired
 	}
-
-	if req.StoreID == "" {
-		req.StoreID = s.defaultStoreID
+	if req.QtyAvailable == nil && req.CostCents == nil {
+		return domain.InventoryLot{}, fmt.Errorf("%w: qty_available or cost_cents required", store.ErrInvalidTransaction)
 	}
-	if len(req.Items) == 0 {
-		return domain.StockOpnameResponse{}, store.ErrInvalidTransaction
+	if req.CostCents != nil && *req.CostCents < 1 {
+		return domain.InventoryLot{}, fmt.Errorf("%w: cost_cents must be positive", store.ErrInvalidTransaction)
 	}
-
-	skus := make([]string, 0, len(req.Items))
-	for _, item := range req.Items {
-		item.SKU = strings.ToUpper(strings.TrimSpace(item.SKU))
-		if item.SKU == "" || item.CountedQty < 0 {
-			return domain.StockOpnameResponse{}, store.ErrInvalidTransaction
+	if req.QtyAvailable != nil && req.CostCents != nil {
+		current, err := s.repo.GetInventoryLot(ctx, strings.TrimSpace(lotID))
+		if err != nil {
+			return domain.InventoryLot{}, err
+		}
+		if strings.TrimSpace(req.Reason) == "" || *req.QtyAvailable < 0 || *req.QtyAvailable > current.QtyReceived {
+			return domain.InventoryLot{}, fmt.Errorf("%w: qty_available must be between 0 and %d with a reason", store.ErrInvalidTransaction, current.QtyReceived)
+		}
+		if err := s.rejectSerialized(ctx, current.SKU); err != nil {
+			return domain.InventoryLot{}, err
 		}
-		skus = append(skus, item.SKU)
 	}
 
-	systemStock, err := s.repo.GetStockMap(ctx, req.StoreID, skus)
-	if err != nil {
-		return domain.StockOpnameResponse{}, err
+	var lot domain.InventoryLot
+	var err error
+	if req.QtyAvailable != nil {
+		if lot, err = s.AdjustLotQty(ctx, lotID, *req.QtyAvailable, req.Reason, actor); err != nil {
+			return domain.InventoryLot{}, err
+		}
 	}
-
-	adjustments := make([]domain.StockOpnameAdjustment, 0, len(req.Items))
-	for _, item := range req.Items {
-		systemQty := systemStock[item.SKU]
-		if systemQty != item.CountedQty {
-			if err := s.repo.SetStock(ctx, req.StoreID, item.SKU, item.CountedQty); err != nil {
-				return domain.StockOpnameResponse{}, err
-			}
+	if req.CostCents != nil {
+		if lot, err = s.CorrectLotCost(ctx, lotID, *req.CostCents, actor); err != nil {
+			return domain.InventoryLot{}, err
 		}
-		adjustments = append(adjustments, domain.StockOpnameAdjustment{
-			SKU:        item.SKU,
-			SystemQty:  systemQty,
-			CountedQty: item.CountedQty,
-			DeltaQty:   item.CountedQty - systemQty,
-		})
 	}
+	return lot, nil
+}
 
-	opnameID := xid.New("opname")
-	s.logAudit(ctx, req.StoreID, "stock_opname", "inventory", opnameID, fmt.Sprintf("items=%d,notes=%s", len(req.Items), req.Notes))
+func (s *Service) ListExpiringLots(ctx context.Context, storeID string, withinDays int) (domain.ExpiringLotListResponse, error) {
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.ExpiringLotListResponse{}, err
+	}
+	if withinDays < 0 {
+		return domain.ExpiringLotListResponse{}, store.ErrInvalidTransaction
+	}
+	lots, err := s.repo.ListExpiringLots(ctx, storeID, withinDays)
+	if err != nil {
+		return domain.ExpiringLotListResponse{}, err
+	}
 
-	return domain.StockOpnameResponse{
-		OpnameID:    opnameID,
-		StoreID:     req.StoreID,
-		Notes:       req.Notes,
-		Adjustments: adjustments,
-		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+	var totalAtRisk int64
+	for _, lot := range lots {
+		totalAtRisk += lot.AtRiskCostCents
+	}
+	return domain.ExpiringLotListResponse{
+		StoreID:              storeID,
+		WithinDays:           withinDays,
+		Lots:                 lots,
+		TotalAtRiskCostCents: totalAtRisk,
 	}, nil
 }
 
-func (s *Service) ReceiveInventoryLot(ctx context.Context, req domain.InventoryLotReceiveRequest) (domain.InventoryLot, error) {
-	actor, ok := ActorFromContext(ctx)
-	if !ok || actor.Role != "admin" {
-		return domain.InventoryLot{}, fmt.Errorf("admin role required")
+func (s *Service) WriteOffStock(ctx context.Context, storeID string, sku string, qty int, reason string, actor domain.Actor) (domain.StockWriteOff, error) {
+	if actor.Role != "admin" {
+		return domain.StockWriteOff{}, ErrAdminRequired
 	}
-	if req.StoreID == "" {
-		req.StoreID = s.defaultStoreID
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.StockWriteOff{}, err
 	}
-	req.SKU = strings.ToUpper(strings.TrimSpace(req.SKU))
-	req.LotCode = strings.TrimSpace(req.LotCode)
-	req.Notes = strings.TrimSpace(req.Notes)
-	if req.SKU == "" || req.Qty < 1 || req.CostCents < 1 {
-		return domain.InventoryLot{}, store.ErrInvalidTransaction
+	sku = strings.ToUpper(strings.TrimSpace(sku))
+	reason = strings.TrimSpace(reason)
+	if sku == "" || qty < 1 || reason == "" {
+		return domain.StockWriteOff{}, store.ErrInvalidTransaction
 	}
-
-	var expiryDate *time.Time
-	if strings.TrimSpace(req.ExpiryDate) != "" {
-		parsed, err := time.Parse("2006-01-02", req.ExpiryDate)
-		if err != nil {
-			return domain.InventoryLot{}, store.ErrInvalidTransaction
-		}
-		exp := parsed.UTC()
-		expiryDate = &exp
+	if err := s.rejectSerialized(ctx, sku); err != nil {
+		return domain.StockWriteOff{}, err
 	}
 
-	lot, err := s.repo.CreateInventoryLot(ctx, domain.InventoryLot{
-		ID:           xid.New("lot"),
-		StoreID:      req.StoreID,
-		SKU:          req.SKU,
-		LotCode:      req.LotCode,
-		ExpiryDate:   expiryDate,
-		QtyReceived:  req.Qty,
-		QtyAvailable: req.Qty,
-		CostCents:    req.CostCents,
-		SourceType:   "manual",
-		Notes:        req.Notes,
-		ReceivedAt:   time.Now().UTC(),
+	now := time.Now().UTC()
+	writeOff, err := s.repo.WriteOffStock(ctx, domain.StockWriteOff{
+		ID:        s.newID("wo"),
+		StoreID:   storeID,
+		SKU:       sku,
+		Qty:       qty,
+		Reason:    reason,
+		CreatedBy: actor.Username,
+		CreatedAt: now,
+	}, domain.AuditLog{
+		ID:            s.newID("audit"),
+		StoreID:       storeID,
+		ActorUsername: actor.Username,
+		ActorRole:     actor.Role,
+		Action:        "write_off",
+		EntityType:    "stock_write_off",
+		Detail:        fmt.Sprintf("sku=%s,qty=%d,reason=%s", sku, qty, reason),
+		CreatedAt:     now,
 	})
 	if err != nil {
-		return domain.InventoryLot{}, err
+		return domain.StockWriteOff{}, err
 	}
-	s.logAudit(ctx, req.StoreID, "inventory_lot_receive", "inventory_lot", lot.ID, fmt.Sprintf("sku=%s,qty=%d,expiry=%s", lot.SKU, lot.QtyReceived, req.ExpiryDate))
-	return *lot, nil
+	return *writeOff, nil
 }
 
-func (s *Service) ListInventoryLots(ctx context.Context, storeID string, sku string, includeExpired bool, limit int) (domain.InventoryLotListResponse, error) {
-	if storeID == "" {
-		storeID = s.defaultStoreID
+func (s *Service) TransferStock(ctx context.Context, fromStoreID string, toStoreID string, sku string, qty int, actor domain.Actor) ([]domain.InventoryLot, error) {
+	if actor.Role != "admin" {
+		return nil, ErrAdminRequired
 	}
-	lots, err := s.repo.ListInventoryLots(ctx, storeID, strings.ToUpper(strings.TrimSpace(sku)), includeExpired, limit)
+	if err := s.resolveStoreID(&fromStoreID); err != nil {
+		return nil, err
+	}
+	fromStoreID = strings.TrimSpace(fromStoreID)
+	toStoreID = strings.TrimSpace(toStoreID)
+	sku = strings.ToUpper(strings.TrimSpace(sku))
+	if toStoreID == "" || sku == "" || qty < 1 {
+		return nil, store.ErrInvalidTransaction
+	}
+	if fromStoreID == toStoreID {
+		return nil, fmt.Errorf("%w: source and destination store must differ", store.ErrInvalidTransaction)
+	}
+	if err := s.rejectSerialized(ctx, sku); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	lotID := s.newID("lot")
+	detail := fmt.Sprintf("sku=%s,qty=%d,from=%s,to=%s", sku, qty, fromStoreID, toStoreID)
+	lots, err := s.repo.TransferStock(ctx, fromStoreID, domain.InventoryLot{
+		ID:          lotID,
+		StoreID:     toStoreID,
+		SKU:         sku,
+		QtyReceived: qty,
+		SourceType:  "transfer",
+		SourceID:    fromStoreID,
+		ReceivedAt:  now,
+	}, []domain.AuditLog{
+		{
+			ID:            s.newID("audit"),
+			StoreID:       fromStoreID,
+			ActorUsername: actor.Username,
+			ActorRole:     actor.Role,
+			Action:        "stock_transfer_out",
+			EntityType:    "inventory_lot",
+			EntityID:      lotID,
+			Detail:        detail,
+			CreatedAt:     now,
+		},
+		{
+			ID:            s.newID("audit"),
+			StoreID:       toStoreID,
+			ActorUsername: actor.Username,
+			ActorRole:     actor.Role,
+			Action:        "stock_transfer_in",
+			EntityType:    "inventory_lot",
+			EntityID:      lotID,
+			Detail:        detail,
+			CreatedAt:     now,
+		},
+	})
 	if err != nil {
-		return domain.InventoryLotListResponse{}, err
+		return nil, err
 	}
-	return domain.InventoryLotListResponse{Lots: lots}, nil
+	return lots, nil
 }
 
 func (s *Service) ProcessItemReturn(ctx context.Context, req domain.ItemReturnRequest) (domain.ItemReturnResponse, error) {
 	actor, ok := ActorFromContext(ctx)
 	if !ok || actor.Role != "admin" {
-		return domain.ItemReturnResponse{}, fmt.Errorf("admin role required")
+		return domain.ItemReturnResponse{}, ErrAdminRequired
 	}
 	req.Mode = strings.ToLower(strings.TrimSpace(req.Mode))
 	if req.Mode == "" {
@@ -765,6 +2198,9 @@ func (s *Service) ProcessItemReturn(ctx context.Context, req domain.ItemReturnRe
 	if originalTx.Status == domain.TxStatusVoided {
 		return domain.ItemReturnResponse{}, store.ErrInvalidTransaction
 	}
+	if err := s.checkRefundWindow(ctx, originalTx, req.OverrideRefundWindow, req.OverrideNote); err != nil {
+		return domain.ItemReturnResponse{}, err
+	}
 	storeID := strings.TrimSpace(req.StoreID)
 	if storeID == "" {
 		storeID = originalTx.StoreID
@@ -796,6 +2232,9 @@ func (s *Service) ProcessItemReturn(ctx context.Context, req domain.ItemReturnRe
 		}
 		returnQtyBySKU[sku] += line.Qty
 	}
+	if err := s.rejectSerialized(ctx, slices.Collect(maps.Keys(returnQtyBySKU))...); err != nil {
+		return domain.ItemReturnResponse{}, err
+	}
 
 	returnLines := make([]domain.ItemReturnLine, 0, len(returnQtyBySKU))
 	returnAmount := int64(0)
@@ -825,7 +2264,7 @@ func (s *Service) ProcessItemReturn(ctx context.Context, req domain.ItemReturnRe
 
 	if req.Mode == domain.ItemReturnModeRefund {
 		_, err := s.repo.CreateRefund(ctx, domain.Refund{
-			ID:                    xid.New("refund"),
+			ID:                    s.newID("refund"),
 			OriginalTransactionID: originalTx.ID,
 			Reason:                strings.TrimSpace(req.Reason),
 			AmountCents:           returnAmount,
@@ -853,7 +2292,7 @@ func (s *Service) ProcessItemReturn(ctx context.Context, req domain.ItemReturnRe
 		exchangeSubtotal := int64(0)
 		for _, item := range normalizedExchange {
 			product, exists := exchangeProducts[item.SKU]
-			if !exists || !product.Active {
+			if !exists || !product.Active || !store.AvailableOn(product, s.storeDate()) {
 				return domain.ItemReturnResponse{}, store.ErrInvalidTransaction
 			}
 			exchangeSubtotal += int64(item.Qty) * product.PriceCents
@@ -882,7 +2321,7 @@ func (s *Service) ProcessItemReturn(ctx context.Context, req domain.ItemReturnRe
 		checkoutResp, err := s.Checkout(ctx, domain.CheckoutRequest{
 			StoreID:           storeID,
 			TerminalID:        defaultString(strings.TrimSpace(req.TerminalID), originalTx.TerminalID),
-			IdempotencyKey:    xid.New("retx"),
+			IdempotencyKey:    s.newID("retx"),
 			PaymentMethod:     paymentMethod,
 			PaymentReference:  strings.TrimSpace(req.PaymentReference),
 			CashReceivedCents: req.CashReceivedCents,
@@ -899,7 +2338,7 @@ func (s *Service) ProcessItemReturn(ctx context.Context, req domain.ItemReturnRe
 		remainingCredit := returnAmount - creditUsed
 		if remainingCredit > 0 {
 			_, err = s.repo.CreateRefund(ctx, domain.Refund{
-				ID:                    xid.New("refund"),
+				ID:                    s.newID("refund"),
 				OriginalTransactionID: originalTx.ID,
 				Reason:                "remaining credit from exchange",
 				AmountCents:           remainingCredit,
@@ -915,7 +2354,7 @@ func (s *Service) ProcessItemReturn(ctx context.Context, req domain.ItemReturnRe
 
 	for _, line := range returnLines {
 		_, err := s.repo.CreateInventoryLot(ctx, domain.InventoryLot{
-			ID:           xid.New("lot"),
+			ID:           s.newID("lot"),
 			StoreID:      storeID,
 			SKU:          line.SKU,
 			LotCode:      "RET-" + originalTx.ID,
@@ -933,7 +2372,7 @@ func (s *Service) ProcessItemReturn(ctx context.Context, req domain.ItemReturnRe
 	}
 
 	itemReturn, err := s.repo.CreateItemReturn(ctx, domain.ItemReturn{
-		ID:                     xid.New("ret"),
+		ID:                     s.newID("ret"),
 		StoreID:                storeID,
 		OriginalTransactionID:  originalTx.ID,
 		Mode:                   req.Mode,
@@ -954,57 +2393,6 @@ func (s *Service) ProcessItemReturn(ctx context.Context, req domain.ItemReturnRe
 	return domain.ItemReturnResponse{ItemReturn: *itemReturn}, nil
 }
 
-func (s *Service) BuildHardwareReceipt(ctx context.Context, req domain.HardwareReceiptRequest) (domain.HardwareReceiptResponse, error) {
-	req.TransactionID = strings.TrimSpace(req.TransactionID)
-	if req.TransactionID == "" {
-		return domain.HardwareReceiptResponse{}, store.ErrInvalidTransaction
-	}
-	tx, err := s.repo.FindTransactionByID(ctx, req.TransactionID)
-	if err != nil {
-		return domain.HardwareReceiptResponse{}, err
-	}
-
-	lines := []string{
-		"KasirinAja POS",
-		"========================",
-		"TX: " + tx.ID,
-		"Store: " + tx.StoreID,
-		"Terminal: " + tx.TerminalID,
-		"Date: " + tx.CreatedAt.Format("2006-01-02 15:04:05"),
-		"------------------------",
-	}
-	for _, item := range tx.Items {
-		lines = append(lines, fmt.Sprintf("%s x%d", item.SKU, item.Qty))
-		lines = append(lines, fmt.Sprintf("  %d", item.UnitPriceCents*int64(item.Qty)))
-	}
-	lines = append(lines,
-		"------------------------",
-		fmt.Sprintf("Subtotal : %d", tx.SubtotalCents),
-		fmt.Sprintf("Diskon   : %d", tx.DiscountCents),
-		fmt.Sprintf("Pajak    : %d", tx.TaxCents),
-		fmt.Sprintf("Total    : %d", tx.TotalCents),
-		fmt.Sprintf("Bayar    : %d", tx.CashReceivedCents),
-		fmt.Sprintf("Kembali  : %d", tx.ChangeCents),
-		"========================",
-		"Terima kasih",
-		"",
-	)
-
-	escpos := []byte{0x1b, 0x40}
-	for _, line := range lines {
-		escpos = append(escpos, []byte(line)...)
-		escpos = append(escpos, '\n')
-	}
-	escpos = append(escpos, []byte{0x1d, 0x56, 0x41, 0x10}...)
-
-	return domain.HardwareReceiptResponse{
-		TransactionID: tx.ID,
-		EscposBase64:  base64.StdEncoding.EncodeToString(escpos),
-		PreviewText:   strings.Join(lines, "\n"),
-		FileName:      fmt.Sprintf("receipt-%s.bin", tx.ID),
-	}, nil
-}
-
 func (s *Service) OpenCashDrawer(_ context.Context, req domain.CashDrawerOpenRequest) (domain.CashDrawerOpenResponse, error) {
 	terminalID := strings.TrimSpace(req.TerminalID)
 	if terminalID == "" {
@@ -1020,23 +2408,14 @@ func (s *Service) OpenCashDrawer(_ context.Context, req domain.CashDrawerOpenReq
 }
 
 func (s *Service) DailyReport(ctx context.Context, storeID string, date string) (domain.DailyReport, error) {
-	if storeID == "" {
-		storeID = s.defaultStoreID
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.DailyReport{}, err
 	}
 
-	var day time.Time
-	if strings.TrimSpace(date) == "" {
-		now := time.Now().UTC()
-		day = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
-	} else {
-		parsed, err := time.Parse("2006-01-02", date)
-		if err != nil {
-			return domain.DailyReport{}, store.ErrInvalidTransaction
-		}
-		day = parsed.UTC()
+	from, to, err := s.storeDay(date)
+	if err != nil {
+		return domain.DailyReport{}, err
 	}
-	from := day
-	to := from.Add(24 * time.Hour)
 
 	report, err := s.repo.GetDailyReport(ctx, storeID, from, to)
 	if err != nil {
@@ -1044,35 +2423,345 @@ func (s *Service) DailyReport(ctx context.Context, storeID string, date string)
 	}
 	report.StoreID = storeID
 	report.Date = from.Format("2006-01-02")
+	report.GrossProfitCents = report.NetSalesCents - report.CostOfGoodsCents - report.TaxCents
+	return report, nil
+}
+
+// GetHourlySales returns 24 hourly buckets for a store-local day, so hour 0
+// is local midnight. Voided transactions are excluded.
+func (s *Service) GetHourlySales(ctx context.Context, storeID string, date string) (domain.HourlySalesReport, error) {
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.HourlySalesReport{}, err
+	}
+
+	loc := s.storeLocation
+	from, to, err := s.storeDay(date)
+	if err != nil {
+		return domain.HourlySalesReport{}, err
+	}
+
+	rows, err := s.repo.GetHourlySales(ctx, storeID, from, to, loc)
+	if err != nil {
+		return domain.HourlySalesReport{}, err
+	}
+
+	report := domain.HourlySalesReport{
+		StoreID:  storeID,
+		Date:     from.Format("2006-01-02"),
+		Timezone: loc.String(),
+		Hours:    make([]domain.HourlySalesBucket, 24),
+	}
+	for hour := range report.Hours {
+		report.Hours[hour].Hour = hour
+	}
+	for _, row := range rows {
+		if row.Hour < 0 || row.Hour > 23 {
+			continue
+		}
+		report.Hours[row.Hour].Transactions += row.Transactions
+		report.Hours[row.Hour].TotalCents += row.TotalCents
+	}
+	return report, nil
+}
+
+// maxRangeReportDays bounds a single range report to a little over a year.
+const maxRangeReportDays = 400
+
+// RangeReport aggregates sales between two dates (inclusive) into day, week
+// or month buckets. Periods without sales are returned as zero buckets so the
+// series has no gaps.
+func (s *Service) RangeReport(ctx context.Context, storeID string, fromDate string, toDate string, groupBy string) (domain.RangeReport, error) {
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.RangeReport{}, err
+	}
+	groupBy = strings.ToLower(strings.TrimSpace(groupBy))
+	if groupBy == "" {
+		groupBy = domain.ReportGroupByDay
+	}
+	switch groupBy {
+	case domain.ReportGroupByDay, domain.ReportGroupByWeek, domain.ReportGroupByMonth:
+	default:
+		return domain.RangeReport{}, fmt.Errorf("%w: group_by must be day, week or month", store.ErrInvalidTransaction)
+	}
+
+	from, _, err := s.storeDay(fromDate)
+	if err != nil || strings.TrimSpace(fromDate) == "" {
+		return domain.RangeReport{}, store.ErrInvalidTransaction
+	}
+	lastDay, to, err := s.storeDay(toDate)
+	if err != nil || strings.TrimSpace(toDate) == "" {
+		return domain.RangeReport{}, store.ErrInvalidTransaction
+	}
+	if !from.Before(to) {
+		return domain.RangeReport{}, store.ErrInvalidTransaction
+	}
+	if to.After(from.AddDate(0, 0, maxRangeReportDays)) {
+		return domain.RangeReport{}, fmt.Errorf("%w: range cannot exceed %d days", store.ErrInvalidTransaction, maxRangeReportDays)
+	}
+
+	rows, err := s.repo.GetRangeReport(ctx, storeID, from, to, groupBy, s.storeLocation)
+	if err != nil {
+		return domain.RangeReport{}, err
+	}
+	byPeriod := make(map[string]domain.RangeReportBucket, len(rows))
+	for _, row := range rows {
+		byPeriod[row.PeriodStart] = row
+	}
+
+	report := domain.RangeReport{
+		StoreID: storeID,
+		From:    from.Format("2006-01-02"),
+		To:      lastDay.Format("2006-01-02"),
+		GroupBy: groupBy,
+		Buckets: make([]domain.RangeReportBucket, 0),
+	}
+	for period := rangeBucketStart(from, groupBy, s.storeLocation); period.Before(to); period = nextRangeBucket(period, groupBy) {
+		key := period.Format("2006-01-02")
+		bucket, ok := byPeriod[key]
+		if !ok {
+			bucket = domain.RangeReportBucket{PeriodStart: key}
+		}
+		report.Buckets = append(report.Buckets, bucket)
+
+		report.Total.Transactions += bucket.Transactions
+		report.Total.GrossSalesCents += bucket.GrossSalesCents
+		report.Total.DiscountCents += bucket.DiscountCents
+		report.Total.TaxCents += bucket.TaxCents
+		report.Total.NetSalesCents += bucket.NetSalesCents
+		report.Total.EstimatedMarginCents += bucket.EstimatedMarginCents
+	}
+	return report, nil
+}
+
+// SalesBySupplier totals sales between two dates (inclusive) per supplier,
+// for vendor negotiations. See Repository.GetSalesBySupplier for how a SKU
+// sold by several suppliers is attributed to one.
+func (s *Service) SalesBySupplier(ctx context.Context, storeID string, fromDate string, toDate string) (domain.SupplierSalesReport, error) {
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.SupplierSalesReport{}, err
+	}
+	from, _, err := s.storeDay(fromDate)
+	if err != nil || strings.TrimSpace(fromDate) == "" {
+		return domain.SupplierSalesReport{}, store.ErrInvalidTransaction
+	}
+	lastDay, to, err := s.storeDay(toDate)
+	if err != nil || strings.TrimSpace(toDate) == "" {
+		return domain.SupplierSalesReport{}, store.ErrInvalidTransaction
+	}
+	if !from.Before(to) {
+		return domain.SupplierSalesReport{}, store.ErrInvalidTransaction
+	}
+	if to.After(from.AddDate(0, 0, maxRangeReportDays)) {
+		return domain.SupplierSalesReport{}, fmt.Errorf("%w: range cannot exceed %d days", store.ErrInvalidTransaction, maxRangeReportDays)
+	}
+
+	lines, err := s.repo.GetSalesBySupplier(ctx, storeID, from, to)
+	if err != nil {
+		return domain.SupplierSalesReport{}, err
+	}
+	return domain.SupplierSalesReport{
+		StoreID:   storeID,
+		From:      from.Format("2006-01-02"),
+		To:        lastDay.Format("2006-01-02"),
+		Suppliers: lines,
+	}, nil
+}
+
+// rangeBucketStart truncates t to the start of its day, ISO week (Monday) or
+// month in loc.
+func rangeBucketStart(t time.Time, groupBy string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	switch groupBy {
+	case domain.ReportGroupByWeek:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case domain.ReportGroupByMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	default:
+		return day
+	}
+}
+
+func nextRangeBucket(periodStart time.Time, groupBy string) time.Time {
+	switch groupBy {
+	case domain.ReportGroupByWeek:
+		return periodStart.AddDate(0, 0, 7)
+	case domain.ReportGroupByMonth:
+		return periodStart.AddDate(0, 1, 0)
+	default:
+		return periodStart.AddDate(0, 0, 1)
+	}
+}
+
+// GetInventoryValuation values on-hand stock at the store's weighted cost.
+// SKUs without a recorded cost fall back to a margin-derived estimate and are
+// counted in MissingCostSKUs so they can be corrected.
+func (s *Service) GetInventoryValuation(ctx context.Context, storeID string) (domain.InventoryValuationReport, error) {
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.InventoryValuationReport{}, err
+	}
+
+	lines, err := s.repo.GetInventoryValuation(ctx, storeID)
+	if err != nil {
+		return domain.InventoryValuationReport{}, err
+	}
+	// Inactive products still hold stock, so the fallback cost has to see
+	// them too.
+	products, err := s.repo.ListAllProducts(ctx)
+	if err != nil {
+		return domain.InventoryValuationReport{}, err
+	}
+	productBySKU := make(map[string]domain.Product, len(products))
+	for _, product := range products {
+		productBySKU[product.SKU] = product
+	}
+
+	report := domain.InventoryValuationReport{
+		StoreID:     storeID,
+		GeneratedAt: s.formatTimestamp(time.Now()),
+		ByCategory:  make([]domain.InventoryValuationCategory, 0, 8),
+	}
+	byCategory := map[string]*domain.InventoryValuationCategory{}
+	for _, line := range lines {
+		unitCost := line.UnitCostCents
+		if unitCost < 1 {
+			report.MissingCostSKUs++
+			unitCost = deriveUnitCost(productBySKU[line.SKU])
+		}
+		value := unitCost * int64(line.Qty)
+
+		category := byCategory[line.Category]
+		if category == nil {
+			category = &domain.InventoryValuationCategory{Category: line.Category}
+			byCategory[line.Category] = category
+		}
+		category.SKUs++
+		category.Units += int64(line.Qty)
+		category.ValueCents += value
+
+		report.TotalUnits += int64(line.Qty)
+		report.TotalValueCents += value
+	}
+	for _, category := range byCategory {
+		report.ByCategory = append(report.ByCategory, *category)
+	}
+	sort.Slice(report.ByCategory, func(i, j int) bool {
+		return report.ByCategory[i].Category < report.ByCategory[j].Category
+	})
 	return report, nil
 }
 
 func (s *Service) ListAuditLogs(ctx context.Context, storeID string, date string, limit int) ([]domain.AuditLog, error) {
-	if storeID == "" {
-		storeID = s.defaultStoreID
+	page, err := s.ListAuditLogPage(ctx, storeID, date, domain.AuditLogFilter{}, "", limit)
+	if err != nil {
+		return nil, err
+	}
+	return page.Logs, nil
+}
+
+// ListAuditLogPage returns up to limit entries matching filter that are older
+// than cursor, newest first. NextCursor is set when more entries remain.
+func (s *Service) ListAuditLogPage(ctx context.Context, storeID string, date string, filter domain.AuditLogFilter, cursor string, limit int) (domain.AuditLogPage, error) {
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.AuditLogPage{}, err
 	}
 	if limit < 1 {
 		limit = 100
 	}
 
-	var from time.Time
-	if strings.TrimSpace(date) == "" {
-		from = time.Now().UTC().Add(-24 * time.Hour)
-	} else {
-		parsed, err := time.Parse("2006-01-02", date)
+	from, to, err := s.auditWindow(date)
+	if err != nil {
+		return domain.AuditLogPage{}, err
+	}
+	before, err := decodeAuditCursor(cursor)
+	if err != nil {
+		return domain.AuditLogPage{}, err
+	}
+
+	filter = normalizeAuditFilter(filter)
+
+	logs, err := s.repo.ListAuditLogs(ctx, storeID, from, to, filter, before, limit+1)
+	if err != nil {
+		return domain.AuditLogPage{}, err
+	}
+	page := domain.AuditLogPage{Logs: logs}
+	if len(logs) > limit {
+		page.Logs = logs[:limit]
+		last := page.Logs[limit-1]
+		page.NextCursor = encodeAuditCursor(domain.AuditLogCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	return page, nil
+}
+
+// ExportAuditLogs pages through the whole audit window for a full export.
+func (s *Service) ExportAuditLogs(ctx context.Context, storeID string, date string, filter domain.AuditLogFilter) ([]domain.AuditLog, error) {
+	const pageSize = 500
+
+	logs := make([]domain.AuditLog, 0, pageSize)
+	cursor := ""
+	for {
+		page, err := s.ListAuditLogPage(ctx, storeID, date, filter, cursor, pageSize)
 		if err != nil {
-			return nil, store.ErrInvalidTransaction
+			return nil, err
+		}
+		logs = append(logs, page.Logs...)
+		if page.NextCursor == "" {
+			return logs, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// normalizeAuditFilter trims the filter values and drops empty actions.
+func normalizeAuditFilter(filter domain.AuditLogFilter) domain.AuditLogFilter {
+	actions := make([]string, 0, len(filter.Actions))
+	for _, action := range filter.Actions {
+		if action = strings.ToLower(strings.TrimSpace(action)); action != "" {
+			actions = append(actions, action)
 		}
-		from = parsed.UTC()
 	}
-	to := from.Add(24 * time.Hour)
+	return domain.AuditLogFilter{Actions: actions, Actor: strings.TrimSpace(filter.Actor)}
+}
+
+// encodeAuditCursor packs a cursor into an opaque URL-safe token.
+func encodeAuditCursor(cursor domain.AuditLogCursor) string {
+	raw := cursor.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + cursor.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeAuditCursor(token string) (*domain.AuditLogCursor, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, store.ErrInvalidTransaction
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return nil, store.ErrInvalidTransaction
+	}
+	parsed, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, store.ErrInvalidTransaction
+	}
+	return &domain.AuditLogCursor{CreatedAt: parsed, ID: id}, nil
+}
 
-	return s.repo.ListAuditLogs(ctx, storeID, from, to, limit)
+// auditWindow is the store-local day for date, or the last 24 hours when no
+// date is given.
+func (s *Service) auditWindow(date string) (time.Time, time.Time, error) {
+	if strings.TrimSpace(date) == "" {
+		to := time.Now().UTC()
+		return to.Add(-24 * time.Hour), to, nil
+	}
+	return s.storeDay(date)
 }
 
 func (s *Service) HoldCart(ctx context.Context, req domain.HoldCartRequest) (domain.HoldCartResponse, error) {
-	if req.StoreID == "" {
-		req.StoreID = s.defaultStoreID
+	if err := s.resolveStoreID(&req.StoreID); err != nil {
+		return domain.HoldCartResponse{}, err
 	}
 	req.TerminalID = strings.TrimSpace(req.TerminalID)
 	req.Note = strings.TrimSpace(req.Note)
@@ -1094,7 +2783,7 @@ func (s *Service) HoldCart(ctx context.Context, req domain.HoldCartRequest) (dom
 
 	actor, _ := ActorFromContext(ctx)
 	held := domain.HeldCart{
-		ID:                xid.New("hold"),
+		ID:                s.newID("hold"),
 		StoreID:           req.StoreID,
 		TerminalID:        req.TerminalID,
 		CashierUsername:   actor.Username,
@@ -1123,8 +2812,8 @@ func (s *Service) HoldCart(ctx context.Context, req domain.HoldCartRequest) (dom
 }
 
 func (s *Service) ListHeldCarts(ctx context.Context, storeID string, terminalID string) (domain.HeldCartListResponse, error) {
-	if storeID == "" {
-		storeID = s.defaultStoreID
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.HeldCartListResponse{}, err
 	}
 	terminalID = strings.TrimSpace(terminalID)
 	if terminalID == "" {
@@ -1169,8 +2858,8 @@ func (s *Service) DiscardHeldCart(ctx context.Context, holdID string) error {
 }
 
 func (s *Service) DetectOperationalAnomalies(ctx context.Context, storeID string, date string) (domain.OperationalAlertResponse, error) {
-	if storeID == "" {
-		storeID = s.defaultStoreID
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.OperationalAlertResponse{}, err
 	}
 
 	logs, err := s.ListAuditLogs(ctx, storeID, date, 500)
@@ -1198,60 +2887,75 @@ func (s *Service) DetectOperationalAnomalies(ctx context.Context, storeID string
 		}
 	}
 
+	thresholds := s.effectiveAnomalyThresholds(storeID)
 	alerts := make([]domain.OperationalAlert, 0, 16)
 	for actor, count := range voidByActor {
-		if count >= 3 {
+		if count >= thresholds.VoidsPerActor {
 			alerts = append(alerts, domain.OperationalAlert{
-				ID:          xid.New("alert"),
+				ID:          s.newID("alert"),
 				Code:        "void_spike",
 				Severity:    "high",
 				Title:       "Void transaksi meningkat",
 				Description: fmt.Sprintf("Actor %s melakukan %d void transaksi dalam 1 hari.", actor, count),
 				MetricValue: float64(count),
-				Threshold:   3,
-				CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+				Threshold:   float64(thresholds.VoidsPerActor),
+				CreatedAt:   s.formatTimestamp(time.Now()),
 			})
 		}
 	}
 	for actor, count := range refundByActor {
-		if count >= 2 {
+		if count >= thresholds.RefundsPerActor {
 			alerts = append(alerts, domain.OperationalAlert{
-				ID:          xid.New("alert"),
+				ID:          s.newID("alert"),
 				Code:        "refund_spike",
 				Severity:    "high",
 				Title:       "Refund transaksi meningkat",
 				Description: fmt.Sprintf("Actor %s melakukan %d refund dalam 1 hari.", actor, count),
 				MetricValue: float64(count),
-				Threshold:   2,
-				CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+				Threshold:   float64(thresholds.RefundsPerActor),
+				CreatedAt:   s.formatTimestamp(time.Now()),
 			})
 		}
 	}
-	if checkoutManualOverrideCount >= 5 {
+	if checkoutManualOverrideCount >= thresholds.ManualOverrides {
 		alerts = append(alerts, domain.OperationalAlert{
-			ID:          xid.New("alert"),
+			ID:          s.newID("alert"),
 			Code:        "manual_override_spike",
 			Severity:    "medium",
 			Title:       "Manual override tinggi",
 			Description: fmt.Sprintf("Terdapat %d checkout dengan manual override.", checkoutManualOverrideCount),
 			MetricValue: float64(checkoutManualOverrideCount),
-			Threshold:   5,
-			CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+			Threshold:   float64(thresholds.ManualOverrides),
+			CreatedAt:   s.formatTimestamp(time.Now()),
 		})
 	}
-	if opnameBatchCount >= 3 {
+	if opnameBatchCount >= thresholds.StockOpnames {
 		alerts = append(alerts, domain.OperationalAlert{
-			ID:          xid.New("alert"),
+			ID:          s.newID("alert"),
 			Code:        "stock_opname_frequency",
 			Severity:    "medium",
 			Title:       "Frekuensi stock opname tinggi",
 			Description: fmt.Sprintf("Stock opname dijalankan %d kali hari ini.", opnameBatchCount),
 			MetricValue: float64(opnameBatchCount),
-			Threshold:   3,
-			CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+			Threshold:   float64(thresholds.StockOpnames),
+			CreatedAt:   s.formatTimestamp(time.Now()),
 		})
 	}
 
+	priceAlerts, err := s.detectPriceChangeSpikes(ctx, date)
+	if err != nil {
+		return domain.OperationalAlertResponse{}, err
+	}
+	alerts = append(alerts, priceAlerts...)
+
+	afterHours, err := s.detectAfterHoursSales(ctx, storeID, date)
+	if err != nil {
+		return domain.OperationalAlertResponse{}, err
+	}
+	if afterHours != nil {
+		alerts = append(alerts, *afterHours)
+	}
+
 	sort.Slice(alerts, func(i, j int) bool {
 		if alerts[i].Severity == alerts[j].Severity {
 			return alerts[i].MetricValue > alerts[j].MetricValue
@@ -1261,42 +2965,153 @@ func (s *Service) DetectOperationalAnomalies(ctx context.Context, storeID string
 
 	reportDate := strings.TrimSpace(date)
 	if reportDate == "" {
-		reportDate = time.Now().UTC().Format("2006-01-02")
+		reportDate = time.Now().In(s.storeLocation).Format("2006-01-02")
 	}
 
 	return domain.OperationalAlertResponse{
-		StoreID: storeID,
-		Date:    reportDate,
-		Alerts:  alerts,
+		StoreID:    storeID,
+		Date:       reportDate,
+		Thresholds: thresholds,
+		Alerts:     alerts,
+	}, nil
+}
+
+// detectPriceChangeSpikes raises one price_change_spike alert per actor whose
+// price edits moved a price by more than the configured percent. Any such
+// price cut makes the alert high severity.
+func (s *Service) detectPriceChangeSpikes(ctx context.Context, date string) ([]domain.OperationalAlert, error) {
+	from, to, err := s.auditWindow(date)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := s.repo.ListPriceChanges(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	type actorChanges struct {
+		count    int
+		dropped  bool
+		skuIndex map[string]struct{}
+	}
+	byActor := map[string]*actorChanges{}
+	for _, change := range changes {
+		if change.OldPriceCents < 1 {
+			continue
+		}
+		percent := float64(change.NewPriceCents-change.OldPriceCents) / float64(change.OldPriceCents) * 100
+		if math.Abs(percent) <= s.priceChangeAlertPercent {
+			continue
+		}
+		entry := byActor[change.ChangedBy]
+		if entry == nil {
+			entry = &actorChanges{skuIndex: map[string]struct{}{}}
+			byActor[change.ChangedBy] = entry
+		}
+		entry.count++
+		entry.dropped = entry.dropped || percent < 0
+		entry.skuIndex[change.SKU] = struct{}{}
+	}
+
+	alerts := make([]domain.OperationalAlert, 0, len(byActor))
+	for actor, entry := range byActor {
+		skus := make([]string, 0, len(entry.skuIndex))
+		for sku := range entry.skuIndex {
+			skus = append(skus, sku)
+		}
+		sort.Strings(skus)
+
+		severity := "medium"
+		if entry.dropped {
+			severity = "high"
+		}
+		alerts = append(alerts, domain.OperationalAlert{
+			ID:          s.newID("alert"),
+			Code:        "price_change_spike",
+			Severity:    severity,
+			Title:       "Perubahan harga ekstrem",
+			Description: fmt.Sprintf("Actor %s mengubah harga %d kali lebih dari %.0f%% (SKU: %s).", actor, entry.count, s.priceChangeAlertPercent, strings.Join(skus, ", ")),
+			MetricValue: float64(entry.count),
+			Threshold:   s.priceChangeAlertPercent,
+			CreatedAt:   s.formatTimestamp(time.Now()),
+		})
+	}
+	return alerts, nil
+}
+
+// detectAfterHoursSales counts sales rung up outside the store's business
+// hours, bucketed by local hour.
+func (s *Service) detectAfterHoursSales(ctx context.Context, storeID string, date string) (*domain.OperationalAlert, error) {
+	hours, ok := s.businessHours[storeID]
+	if !ok {
+		if hours, ok = s.businessHours[""]; !ok {
+			return nil, nil
+		}
+	}
+
+	from, to, err := s.auditWindow(date)
+	if err != nil {
+		return nil, err
+	}
+	buckets, err := s.repo.GetHourlySales(ctx, storeID, from, to, s.storeLocation)
+	if err != nil {
+		return nil, err
+	}
+
+	count := int64(0)
+	for _, bucket := range buckets {
+		if !hours.contains(bucket.Hour) {
+			count += bucket.Transactions
+		}
+	}
+	if count < int64(s.afterHoursThreshold) {
+		return nil, nil
+	}
+	return &domain.OperationalAlert{
+		ID:          s.newID("alert"),
+		Code:        "after_hours_sales",
+		Severity:    "medium",
+		Title:       "Transaksi di luar jam operasional",
+		Description: fmt.Sprintf("Terdapat %d transaksi di luar jam operasional %02d:00-%02d:00.", count, hours.open, hours.close),
+		MetricValue: float64(count),
+		Threshold:   float64(s.afterHoursThreshold),
+		CreatedAt:   s.formatTimestamp(time.Now()),
 	}, nil
 }
 
-func (s *Service) CreatePromo(ctx context.Context, req domain.PromoCreateRequest) (domain.PromoRule, error) {
+// CreatePromo creates an active promo rule. When an active promo already has
+// that name, it is returned unchanged with created false, so provisioning
+// scripts can safely run again.
+func (s *Service) CreatePromo(ctx context.Context, req domain.PromoCreateRequest) (domain.PromoRule, bool, error) {
 	actor, ok := ActorFromContext(ctx)
 	if !ok || actor.Role != "admin" {
-		return domain.PromoRule{}, fmt.Errorf("admin role required")
+		return domain.PromoRule{}, false, ErrAdminRequired
 	}
 
 	req.Name = strings.TrimSpace(req.Name)
 	req.Type = strings.TrimSpace(req.Type)
 	if req.Name == "" {
-		return domain.PromoRule{}, store.ErrInvalidTransaction
+		return domain.PromoRule{}, false, store.ErrInvalidTransaction
 	}
 	if req.MinSubtotalCents < 0 || req.DiscountPercent < 0 || req.DiscountPercent > 100 || req.FlatDiscountCents < 0 {
-		return domain.PromoRule{}, store.ErrInvalidTransaction
+		return domain.PromoRule{}, false, store.ErrInvalidTransaction
 	}
 	if req.Type != "cart_percent" && req.Type != "flat_cart" {
-		return domain.PromoRule{}, store.ErrInvalidTransaction
+		return domain.PromoRule{}, false, store.ErrInvalidTransaction
 	}
 	if req.Type == "cart_percent" && req.DiscountPercent <= 0 {
-		return domain.PromoRule{}, store.ErrInvalidTransaction
+		return domain.PromoRule{}, false, store.ErrInvalidTransaction
 	}
 	if req.Type == "flat_cart" && req.FlatDiscountCents <= 0 {
-		return domain.PromoRule{}, store.ErrInvalidTransaction
+		return domain.PromoRule{}, false, store.ErrInvalidTransaction
 	}
 
+	id, err := s.clientOrNewID("promo", req.ID)
+	if err != nil {
+		return domain.PromoRule{}, false, err
+	}
 	rule := domain.PromoRule{
-		ID:                xid.New("promo"),
+		ID:                id,
 		Name:              req.Name,
 		Type:              req.Type,
 		MinSubtotalCents:  req.MinSubtotalCents,
@@ -1307,22 +3122,39 @@ func (s *Service) CreatePromo(ctx context.Context, req domain.PromoCreateRequest
 	}
 	saved, err := s.repo.CreatePromo(ctx, rule)
 	if err != nil {
-		return domain.PromoRule{}, err
+		return domain.PromoRule{}, false, err
+	}
+	if saved.ID != rule.ID {
+		return *saved, false, nil
 	}
 
 	s.logAudit(ctx, s.defaultStoreID, "promo_create", "promo", saved.ID, fmt.Sprintf("type=%s,name=%s", saved.Type, saved.Name))
 
-	return *saved, nil
+	return *saved, true, nil
 }
 
 func (s *Service) ListPromos(ctx context.Context) ([]domain.PromoRule, error) {
 	return s.repo.ListPromos(ctx)
 }
 
+// GetPromo returns one promo rule, active or not, so it can be shown before
+// editing.
+func (s *Service) GetPromo(ctx context.Context, promoID string) (domain.PromoRule, error) {
+	promoID = strings.TrimSpace(promoID)
+	if promoID == "" {
+		return domain.PromoRule{}, store.ErrNotFound
+	}
+	rule, err := s.repo.GetPromo(ctx, promoID)
+	if err != nil {
+		return domain.PromoRule{}, err
+	}
+	return *rule, nil
+}
+
 func (s *Service) SetPromoActive(ctx context.Context, promoID string, active bool) (domain.PromoRule, error) {
 	actor, ok := ActorFromContext(ctx)
 	if !ok || actor.Role != "admin" {
-		return domain.PromoRule{}, fmt.Errorf("admin role required")
+		return domain.PromoRule{}, ErrAdminRequired
 	}
 
 	rule, err := s.repo.UpdatePromoActive(ctx, promoID, active)
@@ -1337,7 +3169,7 @@ func (s *Service) SetPromoActive(ctx context.Context, promoID string, active boo
 func (s *Service) CreateSupplier(ctx context.Context, req domain.SupplierCreateRequest) (domain.Supplier, error) {
 	actor, ok := ActorFromContext(ctx)
 	if !ok || actor.Role != "admin" {
-		return domain.Supplier{}, fmt.Errorf("admin role required")
+		return domain.Supplier{}, ErrAdminRequired
 	}
 
 	req.Name = strings.TrimSpace(req.Name)
@@ -1346,9 +3178,13 @@ func (s *Service) CreateSupplier(ctx context.Context, req domain.SupplierCreateR
 		return domain.Supplier{}, store.ErrInvalidTransaction
 	}
 
+	id, err := s.clientOrNewID("sup", req.ID)
+	if err != nil {
+		return domain.Supplier{}, err
+	}
 	now := time.Now().UTC()
 	supplier := domain.Supplier{
-		ID:        xid.New("sup"),
+		ID:        id,
 		Name:      req.Name,
 		Phone:     req.Phone,
 		CreatedAt: now,
@@ -1367,14 +3203,93 @@ func (s *Service) ListSuppliers(ctx context.Context) ([]domain.Supplier, error)
 	return s.repo.ListSuppliers(ctx)
 }
 
+func (s *Service) UpdateSupplier(ctx context.Context, supplierID string, req domain.SupplierUpdateRequest) (domain.Supplier, error) {
+	actor, ok := ActorFromContext(ctx)
+	if !ok || actor.Role != "admin" {
+		return domain.Supplier{}, ErrAdminRequired
+	}
+
+	existing, err := s.repo.GetSupplierByID(ctx, strings.TrimSpace(supplierID))
+	if err != nil {
+		return domain.Supplier{}, err
+	}
+	updated := *existing
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return domain.Supplier{}, store.ErrInvalidTransaction
+		}
+		updated.Name = name
+	}
+	if req.Phone != nil {
+		updated.Phone = strings.TrimSpace(*req.Phone)
+	}
+
+	saved, err := s.repo.UpdateSupplier(ctx, updated)
+	if err != nil {
+		return domain.Supplier{}, err
+	}
+	s.logAudit(ctx, s.defaultStoreID, "supplier_update", "supplier", saved.ID, fmt.Sprintf("name=%s phone=%s", saved.Name, saved.Phone))
+	return *saved, nil
+}
+
+// SetSupplierProduct adds a SKU to a supplier's catalog or replaces its cost
+// and lead time. A zero cost means the price is not known yet.
+func (s *Service) SetSupplierProduct(ctx context.Context, supplierID string, req domain.SupplierProductSetRequest) (domain.SupplierProduct, error) {
+	actor, ok := ActorFromContext(ctx)
+	if !ok || actor.Role != "admin" {
+		return domain.SupplierProduct{}, ErrAdminRequired
+	}
+
+	supplierID = strings.TrimSpace(supplierID)
+	sku := strings.ToUpper(strings.TrimSpace(req.SKU))
+	if supplierID == "" || sku == "" || req.DefaultCostCents < 0 || req.LeadTimeDays < 0 || req.LeadTimeDays > 365 {
+		return domain.SupplierProduct{}, store.ErrInvalidTransaction
+	}
+	if _, err := s.repo.GetSupplierByID(ctx, supplierID); err != nil {
+		return domain.SupplierProduct{}, err
+	}
+	if _, err := s.repo.GetProductBySKU(ctx, sku); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return domain.SupplierProduct{}, &store.SKUError{SKU: sku, Err: store.ErrNotFound}
+		}
+		return domain.SupplierProduct{}, err
+	}
+
+	saved, err := s.repo.SetSupplierProduct(ctx, domain.SupplierProduct{
+		SupplierID:       supplierID,
+		SKU:              sku,
+		DefaultCostCents: req.DefaultCostCents,
+		LeadTimeDays:     req.LeadTimeDays,
+		UpdatedAt:        time.Now().UTC(),
+	})
+	if err != nil {
+		return domain.SupplierProduct{}, err
+	}
+	s.logAudit(ctx, s.defaultStoreID, "supplier_product_set", "supplier", supplierID, fmt.Sprintf("sku=%s cost=%d lead_time_days=%d", sku, saved.DefaultCostCents, saved.LeadTimeDays))
+	return *saved, nil
+}
+
+func (s *Service) ListSupplierProducts(ctx context.Context, supplierID string) (domain.SupplierProductListResponse, error) {
+	supplierID = strings.TrimSpace(supplierID)
+	if _, err := s.repo.GetSupplierByID(ctx, supplierID); err != nil {
+		return domain.SupplierProductListResponse{}, err
+	}
+	products, err := s.repo.ListSupplierProducts(ctx, supplierID, nil)
+	if err != nil {
+		return domain.SupplierProductListResponse{}, err
+	}
+	return domain.SupplierProductListResponse{SupplierID: supplierID, Products: products}, nil
+}
+
 func (s *Service) CreatePurchaseOrder(ctx context.Context, req domain.PurchaseOrderCreateRequest) (domain.PurchaseOrderResponse, error) {
 	actor, ok := ActorFromContext(ctx)
 	if !ok || actor.Role != "admin" {
-		return domain.PurchaseOrderResponse{}, fmt.Errorf("admin role required")
+		return domain.PurchaseOrderResponse{}, ErrAdminRequired
 	}
 
-	if req.StoreID == "" {
-		req.StoreID = s.defaultStoreID
+	if err := s.resolveStoreID(&req.StoreID); err != nil {
+		return domain.PurchaseOrderResponse{}, err
 	}
 	if req.SupplierID == "" || len(req.Items) == 0 {
 		return domain.PurchaseOrderResponse{}, store.ErrInvalidTransaction
@@ -1389,8 +3304,12 @@ func (s *Service) CreatePurchaseOrder(ctx context.Context, req domain.PurchaseOr
 		normalizedItems = append(normalizedItems, item)
 	}
 
+	id, err := s.clientOrNewID("po", req.ID)
+	if err != nil {
+		return domain.PurchaseOrderResponse{}, err
+	}
 	po := domain.PurchaseOrder{
-		ID:         xid.New("po"),
+		ID:         id,
 		StoreID:    req.StoreID,
 		SupplierID: req.SupplierID,
 		Status:     "draft",
@@ -1406,9 +3325,12 @@ func (s *Service) CreatePurchaseOrder(ctx context.Context, req domain.PurchaseOr
 	return domain.PurchaseOrderResponse{PurchaseOrder: *saved}, nil
 }
 
-func (s *Service) ListPurchaseOrders(ctx context.Context, status string) (domain.PurchaseOrderListResponse, error) {
+func (s *Service) ListPurchaseOrders(ctx context.Context, storeID string, status string) (domain.PurchaseOrderListResponse, error) {
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.PurchaseOrderListResponse{}, err
+	}
 	status = strings.ToLower(strings.TrimSpace(status))
-	pos, err := s.repo.ListPurchaseOrders(ctx, s.defaultStoreID, status, 200)
+	pos, err := s.repo.ListPurchaseOrders(ctx, storeID, status, 200)
 	if err != nil {
 		return domain.PurchaseOrderListResponse{}, err
 	}
@@ -1418,7 +3340,7 @@ func (s *Service) ListPurchaseOrders(ctx context.Context, status string) (domain
 func (s *Service) ReceivePurchaseOrder(ctx context.Context, purchaseOrderID string, req domain.PurchaseOrderReceiveRequest) (domain.PurchaseOrderResponse, error) {
 	actor, ok := ActorFromContext(ctx)
 	if !ok || actor.Role != "admin" {
-		return domain.PurchaseOrderResponse{}, fmt.Errorf("admin role required")
+		return domain.PurchaseOrderResponse{}, ErrAdminRequired
 	}
 
 	if purchaseOrderID == "" {
@@ -1433,8 +3355,8 @@ func (s *Service) ReceivePurchaseOrder(ctx context.Context, purchaseOrderID stri
 	if err != nil {
 		return domain.PurchaseOrderResponse{}, err
 	}
-	if po.Status == "received" {
-		return domain.PurchaseOrderResponse{}, store.ErrInvalidTransaction
+	if po.Status == "received" || po.Status == "cancelled" {
+		return domain.PurchaseOrderResponse{}, store.ErrInvalidState
 	}
 
 	received, err := s.repo.ReceivePurchaseOrder(ctx, purchaseOrderID, req.ReceivedBy, time.Now().UTC())
@@ -1445,9 +3367,50 @@ func (s *Service) ReceivePurchaseOrder(ctx context.Context, purchaseOrderID stri
 	return domain.PurchaseOrderResponse{PurchaseOrder: *received}, nil
 }
 
+// CancelPurchaseOrder cancels a purchase order that has not been received.
+// Received and already cancelled orders are rejected with
+// store.ErrInvalidState.
+func (s *Service) CancelPurchaseOrder(ctx context.Context, purchaseOrderID string, req domain.PurchaseOrderCancelRequest) (domain.PurchaseOrderResponse, error) {
+	actor, ok := ActorFromContext(ctx)
+	if !ok || actor.Role != "admin" {
+		return domain.PurchaseOrderResponse{}, ErrAdminRequired
+	}
+
+	if purchaseOrderID == "" {
+		return domain.PurchaseOrderResponse{}, store.ErrInvalidTransaction
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) > 500 {
+		return domain.PurchaseOrderResponse{}, fmt.Errorf("%w: reason must be at most 500 characters", store.ErrInvalidTransaction)
+	}
+
+	cancelled, err := s.repo.CancelPurchaseOrder(ctx, purchaseOrderID, req.Reason, actor.Username, time.Now().UTC())
+	if err != nil {
+		return domain.PurchaseOrderResponse{}, err
+	}
+	s.logAudit(ctx, cancelled.StoreID, "purchase_order_cancel", "purchase_order", cancelled.ID, fmt.Sprintf("reason=%s", req.Reason))
+	return domain.PurchaseOrderResponse{PurchaseOrder: *cancelled}, nil
+}
+
+const (
+	// reorderVelocityWindowDays is how far back sales are averaged into a
+	// units-per-day velocity for reorder quantities.
+	reorderVelocityWindowDays = 30
+	// reorderSafetyDays of demand are ordered on top of the lead time.
+	reorderSafetyDays = 7
+	// defaultLeadTimeDays is assumed for SKUs no supplier catalog lists.
+	defaultLeadTimeDays = 7
+)
+
+// ReorderSuggestions lists active products at or below their reorder point.
+// For SKUs that sold in the last reorderVelocityWindowDays the recommended
+// quantity covers the demand until a reorder arrives plus a safety margin,
+// velocity*(leadTime+safetyDays) minus stock on hand, using the lead time of
+// the supplier the SKU would be ordered from. SKUs without recent sales are
+// topped up to twice their reorder point.
 func (s *Service) ReorderSuggestions(ctx context.Context, storeID string) (domain.ReorderSuggestionResponse, error) {
-	if storeID == "" {
-		storeID = s.defaultStoreID
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.ReorderSuggestionResponse{}, err
 	}
 
 	products, err := s.repo.ListProducts(ctx)
@@ -1467,6 +3430,19 @@ func (s *Service) ReorderSuggestions(ctx context.Context, storeID string) (domai
 	if err != nil {
 		return domain.ReorderSuggestionResponse{}, err
 	}
+	now := time.Now().UTC()
+	unitsSold, err := s.repo.GetUnitsSoldBySKU(ctx, storeID, skus, now.AddDate(0, 0, -reorderVelocityWindowDays), now)
+	if err != nil {
+		return domain.ReorderSuggestionResponse{}, err
+	}
+	catalogEntries, err := s.repo.ListSupplierProducts(ctx, "", skus)
+	if err != nil {
+		return domain.ReorderSuggestionResponse{}, err
+	}
+	catalog := make(map[string][]domain.SupplierProduct, len(catalogEntries))
+	for _, entry := range catalogEntries {
+		catalog[entry.SKU] = append(catalog[entry.SKU], entry)
+	}
 
 	suggestions := make([]domain.ReorderSuggestion, 0, 24)
 	for _, product := range products {
@@ -1478,7 +3454,19 @@ func (s *Service) ReorderSuggestions(ctx context.Context, storeID string) (domai
 		if current > reorderPoint {
 			continue
 		}
+		leadTime := defaultLeadTimeDays
+		if entry, ok := preferredSupplierProduct(catalog[product.SKU]); ok {
+			leadTime = entry.LeadTimeDays
+		}
+		sold := unitsSold[product.SKU]
+		velocity := float64(sold) / reorderVelocityWindowDays
+		basis := domain.ReorderBasisReorderPoint
 		targetStock := reorderPoint * 2
+		if sold > 0 {
+			// Integer ceiling of velocity*(leadTime+safetyDays).
+			basis = domain.ReorderBasisVelocity
+			targetStock = (sold*(leadTime+reorderSafetyDays) + reorderVelocityWindowDays - 1) / reorderVelocityWindowDays
+		}
 		recommendedQty := targetStock - current
 		if recommendedQty < 1 {
 			continue
@@ -1496,6 +3484,9 @@ func (s *Service) ReorderSuggestions(ctx context.Context, storeID string) (domai
 			RecommendedQty:         recommendedQty,
 			LastCostCents:          cost,
 			EstimatedPurchaseCents: int64(recommendedQty) * cost,
+			Basis:                  basis,
+			VelocityPerDay:         math.Round(velocity*100) / 100,
+			LeadTimeDays:           leadTime,
 		})
 	}
 
@@ -1508,29 +3499,269 @@ func (s *Service) ReorderSuggestions(ctx context.Context, storeID string) (domai
 
 	return domain.ReorderSuggestionResponse{
 		StoreID:     storeID,
-		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		GeneratedAt: s.formatTimestamp(now),
 		Suggestions: suggestions,
 	}, nil
 }
 
+// CreatePurchaseOrdersFromReorder turns the current reorder suggestions into
+// one draft purchase order per supplier, using the recommended quantities.
+// A SKU's supplier comes from the request's SKU mapping, then the supplier
+// catalog, then the request's category defaults. Costs come from the chosen
+// supplier's catalog entry when it has one, otherwise the last known cost.
+// Every supplier in the mapping must exist; suggested SKUs without a supplier
+// are reported back instead of failing the request.
+func (s *Service) CreatePurchaseOrdersFromReorder(ctx context.Context, req domain.PurchaseOrdersFromReorderRequest) (domain.PurchaseOrdersFromReorderResponse, error) {
+	actor, ok := ActorFromContext(ctx)
+	if !ok || actor.Role != "admin" {
+		return domain.PurchaseOrdersFromReorderResponse{}, ErrAdminRequired
+	}
+	if err := s.resolveStoreID(&req.StoreID); err != nil {
+		return domain.PurchaseOrdersFromReorderResponse{}, err
+	}
+	suppliers, err := s.repo.ListSuppliers(ctx)
+	if err != nil {
+		return domain.PurchaseOrdersFromReorderResponse{}, err
+	}
+	knownSuppliers := make(map[string]bool, len(suppliers))
+	for _, supplier := range suppliers {
+		knownSuppliers[supplier.ID] = true
+	}
+	bySKU := make(map[string]string, len(req.SupplierIDBySKU))
+	for sku, supplierID := range req.SupplierIDBySKU {
+		supplierID = strings.TrimSpace(supplierID)
+		if !knownSuppliers[supplierID] {
+			return domain.PurchaseOrdersFromReorderResponse{}, fmt.Errorf("supplier %q: %w", supplierID, store.ErrNotFound)
+		}
+		bySKU[strings.ToUpper(strings.TrimSpace(sku))] = supplierID
+	}
+	byCategory := make(map[string]string, len(req.DefaultSupplierIDByCategory))
+	for category, supplierID := range req.DefaultSupplierIDByCategory {
+		supplierID = strings.TrimSpace(supplierID)
+		if !knownSuppliers[supplierID] {
+			return domain.PurchaseOrdersFromReorderResponse{}, fmt.Errorf("supplier %q: %w", supplierID, store.ErrNotFound)
+		}
+		byCategory[strings.ToLower(strings.TrimSpace(category))] = supplierID
+	}
+
+	suggestions, err := s.ReorderSuggestions(ctx, req.StoreID)
+	if err != nil {
+		return domain.PurchaseOrdersFromReorderResponse{}, err
+	}
+	suggestedSKUs := make([]string, 0, len(suggestions.Suggestions))
+	for _, suggestion := range suggestions.Suggestions {
+		suggestedSKUs = append(suggestedSKUs, suggestion.SKU)
+	}
+	catalog := map[string][]domain.SupplierProduct{}
+	if len(suggestedSKUs) > 0 {
+		entries, err := s.repo.ListSupplierProducts(ctx, "", suggestedSKUs)
+		if err != nil {
+			return domain.PurchaseOrdersFromReorderResponse{}, err
+		}
+		for _, entry := range entries {
+			catalog[entry.SKU] = append(catalog[entry.SKU], entry)
+		}
+	}
+	if len(bySKU) == 0 && len(byCategory) == 0 && len(catalog) == 0 {
+		return domain.PurchaseOrdersFromReorderResponse{}, fmt.Errorf("%w: supplier mapping required", store.ErrInvalidTransaction)
+	}
+
+	itemsBySupplier := map[string][]domain.PurchaseOrderItem{}
+	unmapped := make([]string, 0)
+	for _, suggestion := range suggestions.Suggestions {
+		supplierID, ok := bySKU[suggestion.SKU]
+		if !ok {
+			if entry, found := preferredSupplierProduct(catalog[suggestion.SKU]); found {
+				supplierID, ok = entry.SupplierID, true
+			}
+		}
+		if !ok {
+			supplierID, ok = byCategory[strings.ToLower(suggestion.Category)]
+		}
+		if !ok {
+			unmapped = append(unmapped, suggestion.SKU)
+			continue
+		}
+		cost := suggestion.LastCostCents
+		for _, entry := range catalog[suggestion.SKU] {
+			if entry.SupplierID == supplierID && entry.DefaultCostCents > 0 {
+				cost = entry.DefaultCostCents
+			}
+		}
+		itemsBySupplier[supplierID] = append(itemsBySupplier[supplierID], domain.PurchaseOrderItem{
+			SKU:       suggestion.SKU,
+			Qty:       suggestion.RecommendedQty,
+			CostCents: cost,
+		})
+	}
+	sort.Strings(unmapped)
+
+	supplierIDs := make([]string, 0, len(itemsBySupplier))
+	for supplierID := range itemsBySupplier {
+		supplierIDs = append(supplierIDs, supplierID)
+	}
+	sort.Strings(supplierIDs)
+
+	resp := domain.PurchaseOrdersFromReorderResponse{
+		StoreID:          req.StoreID,
+		PurchaseOrderIDs: make([]string, 0, len(supplierIDs)),
+		UnmappedSKUs:     unmapped,
+	}
+	for _, supplierID := range supplierIDs {
+		created, err := s.CreatePurchaseOrder(ctx, domain.PurchaseOrderCreateRequest{
+			StoreID:    req.StoreID,
+			SupplierID: supplierID,
+			Items:      itemsBySupplier[supplierID],
+		})
+		if err != nil {
+			return resp, fmt.Errorf("create purchase order for supplier %s: %w", supplierID, err)
+		}
+		resp.PurchaseOrderIDs = append(resp.PurchaseOrderIDs, created.PurchaseOrder.ID)
+	}
+	return resp, nil
+}
+
+// preferredSupplierProduct picks the catalog entry to reorder a SKU from: the
+// cheapest known cost, then the shortest lead time. Entries without a cost
+// are only used when no supplier has one.
+func preferredSupplierProduct(entries []domain.SupplierProduct) (domain.SupplierProduct, bool) {
+	if len(entries) == 0 {
+		return domain.SupplierProduct{}, false
+	}
+	best := entries[0]
+	for _, entry := range entries[1:] {
+		switch {
+		case (entry.DefaultCostCents > 0) != (best.DefaultCostCents > 0):
+			if entry.DefaultCostCents > 0 {
+				best = entry
+			}
+		case entry.DefaultCostCents != best.DefaultCostCents:
+			if entry.DefaultCostCents < best.DefaultCostCents {
+				best = entry
+			}
+		case entry.LeadTimeDays < best.LeadTimeDays:
+			best = entry
+		}
+	}
+	return best, true
+}
+
 func (s *Service) RetrainAssociations(ctx context.Context, req domain.RetrainRequest) (domain.RetrainResponse, error) {
 	storeID := req.StoreID
-	if storeID == "" {
-		storeID = s.defaultStoreID
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.RetrainResponse{}, err
 	}
 
-	updatedPairs, err := s.repo.RebuildAssociationPairs(ctx, storeID)
+	// Manual and scheduled retrains share the same pair table; run one at a time.
+	s.retrainMu.Lock()
+	defer s.retrainMu.Unlock()
+
+	pairs, err := s.repo.RebuildAssociationPairs(ctx, storeID, s.minLift)
 	if err != nil {
 		return domain.RetrainResponse{}, err
 	}
 
-	return domain.RetrainResponse{
-		UpdatedPairs: updatedPairs,
-		UpdatedAt:    time.Now().UTC().Format(time.RFC3339),
-	}, nil
+	resp := domain.RetrainResponse{
+		UpdatedPairs: len(pairs),
+		UpdatedAt:    s.formatTimestamp(time.Now()),
+	}
+	for i, pair := range pairs {
+		if i == 0 || pair.Lift < resp.MinLift {
+			resp.MinLift = pair.Lift
+		}
+		if i == 0 || pair.Lift > resp.MaxLift {
+			resp.MaxLift = pair.Lift
+		}
+	}
+	resp.MinLift = math.Round(resp.MinLift*1000) / 1000
+	resp.MaxLift = math.Round(resp.MaxLift*1000) / 1000
+
+	if err := s.recommender.Invalidate(ctx, storeID); err != nil {
+		log.Printf("[service] WARN: failed to invalidate recommendation cache store=%s: %v", storeID, err)
+	}
+	return resp, nil
+}
+
+// categoryCandidates loads the data for the engine's category fallback.
+func (s *Service) categoryCandidates(storeID string) recommendation.CategoryCandidates {
+	return func(ctx context.Context, categories []string) ([]domain.CategoryAssociationPair, []domain.Product, map[string]int, error) {
+		pairs, err := s.repo.GetCategoryAssociationPairs(ctx, categories)
+		if err != nil || len(pairs) == 0 {
+			return nil, nil, nil, err
+		}
+		targets := make(map[string]struct{}, len(pairs))
+		for _, pair := range pairs {
+			targets[pair.TargetCategory] = struct{}{}
+		}
+
+		all, err := s.repo.ListProducts(ctx)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		candidates := make([]domain.Product, 0)
+		skus := make([]string, 0)
+		for _, product := range all {
+			if _, ok := targets[product.Category]; ok && product.Active {
+				candidates = append(candidates, product)
+				skus = append(skus, product.SKU)
+			}
+		}
+		if len(candidates) == 0 {
+			return pairs, nil, nil, nil
+		}
+
+		stockMap, err := s.repo.GetStockMap(ctx, storeID, skus)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return pairs, candidates, stockMap, nil
+	}
+}
+
+// UpsertAssociationPair records a merchandiser-curated pair that the engine
+// uses even before sales data supports it.
+func (s *Service) UpsertAssociationPair(ctx context.Context, req domain.AssociationPairRequest) (domain.AssociationPair, error) {
+	actor, ok := ActorFromContext(ctx)
+	if !ok || actor.Role != "admin" {
+		return domain.AssociationPair{}, ErrAdminRequired
+	}
+
+	source := strings.ToUpper(strings.TrimSpace(req.SourceSKU))
+	target := strings.ToUpper(strings.TrimSpace(req.TargetSKU))
+	if source == "" || target == "" || source == target {
+		return domain.AssociationPair{}, store.ErrInvalidTransaction
+	}
+	if req.Affinity <= 0 || req.Affinity > 1 {
+		return domain.AssociationPair{}, store.ErrInvalidTransaction
+	}
+
+	pair, err := s.repo.UpsertAssociationPair(ctx, source, target, req.Affinity)
+	if err != nil {
+		return domain.AssociationPair{}, err
+	}
+	s.logAudit(ctx, s.defaultStoreID, "association_pair_upsert", "association_pair", source+"->"+target, fmt.Sprintf("affinity=%.2f", req.Affinity))
+	return *pair, nil
+}
+
+func (s *Service) DeleteAssociationPair(ctx context.Context, sourceSKU string, targetSKU string) error {
+	actor, ok := ActorFromContext(ctx)
+	if !ok || actor.Role != "admin" {
+		return ErrAdminRequired
+	}
+
+	source := strings.ToUpper(strings.TrimSpace(sourceSKU))
+	target := strings.ToUpper(strings.TrimSpace(targetSKU))
+	if source == "" || target == "" {
+		return store.ErrInvalidTransaction
+	}
+	if err := s.repo.DeleteAssociationPair(ctx, source, target); err != nil {
+		return err
+	}
+	s.logAudit(ctx, s.defaultStoreID, "association_pair_delete", "association_pair", source+"->"+target, "")
+	return nil
 }
 
-func toCheckoutResponse(tx *domain.Transaction, duplicate bool) domain.CheckoutResponse {
+func (s *Service) toCheckoutResponse(tx *domain.Transaction, duplicate bool) domain.CheckoutResponse {
 	itemCount := 0
 	for _, item := range tx.Items {
 		itemCount += item.Qty
@@ -1547,52 +3778,107 @@ func toCheckoutResponse(tx *domain.Transaction, duplicate bool) domain.CheckoutR
 	}
 
 	return domain.CheckoutResponse{
-		TransactionID:  tx.ID,
-		Status:         tx.Status,
-		PaymentMethod:  tx.PaymentMethod,
-		PaymentSplits:  paymentSplits,
-		SubtotalCents:  tx.SubtotalCents,
-		DiscountCents:  tx.DiscountCents,
-		TaxCents:       tx.TaxCents,
-		TotalCents:     tx.TotalCents,
-		CashReceived:   tx.CashReceivedCents,
-		ChangeCents:    tx.ChangeCents,
-		ItemCount:      itemCount,
-		ShiftID:        tx.ShiftID,
-		Recommendation: recommendation,
-		Duplicate:      duplicate,
-		CreatedAt:      tx.CreatedAt.Format(time.RFC3339),
+		TransactionID:    tx.ID,
+		Status:           tx.Status,
+		PaymentMethod:    tx.PaymentMethod,
+		PaymentSplits:    paymentSplits,
+		SubtotalCents:    tx.SubtotalCents,
+		DiscountCents:    tx.DiscountCents,
+		TaxCents:         tx.TaxCents,
+		TotalCents:       tx.TotalCents,
+		CashReceived:     tx.CashReceivedCents,
+		ChangeCents:      tx.ChangeCents,
+		StoreCreditCode:  tx.StoreCreditCode,
+		StoreCreditCents: tx.StoreCreditCents,
+		CustomerID:       tx.CustomerID,
+		ItemCount:        itemCount,
+		ShiftID:          tx.ShiftID,
+		Recommendation:   recommendation,
+		Duplicate:        duplicate,
+		CreatedAt:        s.formatTimestamp(tx.CreatedAt),
 	}
 }
 
 func normalizeItems(items []domain.CartItem) []domain.CartItem {
 	agg := make(map[string]int, len(items))
+	serials := make(map[string][]string)
 	for _, item := range items {
 		if item.SKU == "" || item.Qty < 1 {
 			continue
 		}
 		agg[item.SKU] += item.Qty
+		serials[item.SKU] = append(serials[item.SKU], normalizeSerials(item.Serials)...)
 	}
 
 	normalized := make([]domain.CartItem, 0, len(agg))
 	for sku, qty := range agg {
-		normalized = append(normalized, domain.CartItem{SKU: sku, Qty: qty})
+		item := domain.CartItem{SKU: sku, Qty: qty}
+		if len(serials[sku]) > 0 {
+			item.Serials = serials[sku]
+		}
+		normalized = append(normalized, item)
 	}
 	return normalized
 }
 
-func (s *Service) calculatePromoDiscount(ctx context.Context, subtotalCents int64) (int64, error) {
+// normalizePickingStrategy defaults an empty strategy to FEFO and reports
+// whether the value is one checkout knows how to apply.
+func normalizePickingStrategy(strategy string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(strategy)) {
+	case "", domain.PickingStrategyFEFO:
+		return domain.PickingStrategyFEFO, true
+	case domain.PickingStrategyFIFO:
+		return domain.PickingStrategyFIFO, true
+	default:
+		return "", false
+	}
+}
+
+// rejectSerialized refuses a stock change that does not name serials for any
+// serialized SKU among skus. Their units only enter and leave a store by
+// serial, so a plain quantity change would leave the serials behind.
+func (s *Service) rejectSerialized(ctx context.Context, skus ...string) error {
+	products, err := s.repo.GetProductsBySKUs(ctx, skus)
+	if err != nil {
+		return err
+	}
+	for _, sku := range skus {
+		if products[sku].Serialized {
+			return &store.SKUError{SKU: sku, Err: store.ErrInvalidSerials}
+		}
+	}
+	return nil
+}
+
+// normalizeSerials trims serial numbers and drops blanks.
+func normalizeSerials(serials []string) []string {
+	out := make([]string, 0, len(serials))
+	for _, serial := range serials {
+		serial = strings.TrimSpace(serial)
+		if serial == "" {
+			continue
+		}
+		out = append(out, serial)
+	}
+	return out
+}
+
+// bestPromo returns the active promo giving the largest discount on
+// subtotalCents and that discount, capped at the subtotal. It returns nil when
+// no promo applies.
+func (s *Service) bestPromo(ctx context.Context, subtotalCents int64) (*domain.PromoRule, int64, error) {
 	if subtotalCents < 1 {
-		return 0, nil
+		return nil, 0, nil
 	}
 
 	promos, err := s.repo.ListPromos(ctx)
 	if err != nil {
-		return 0, err
+		return nil, 0, err
 	}
 
-	var best int64
-	for _, rule := range promos {
+	var best *domain.PromoRule
+	var bestDiscount int64
+	for i, rule := range promos {
 		if !rule.Active || subtotalCents < rule.MinSubtotalCents {
 			continue
 		}
@@ -1605,14 +3891,33 @@ func (s *Service) calculatePromoDiscount(ctx context.Context, subtotalCents int6
 			discount = rule.FlatDiscountCents
 		}
 
-		if discount > best {
-			best = discount
+		if discount > bestDiscount {
+			best = &promos[i]
+			bestDiscount = discount
 		}
 	}
-	if best > subtotalCents {
-		return subtotalCents, nil
+	return best, min(bestDiscount, subtotalCents), nil
+}
+
+func (s *Service) toStockOpnameResponse(record domain.StockOpnameRecord) domain.StockOpnameResponse {
+	return domain.StockOpnameResponse{
+		OpnameID:    record.ID,
+		StoreID:     record.StoreID,
+		Notes:       record.Notes,
+		CreatedBy:   record.CreatedBy,
+		Adjustments: record.Items,
+		CreatedAt:   s.formatTimestamp(record.CreatedAt),
 	}
-	return best, nil
+}
+
+// Ping reports whether the repository is reachable.
+func (s *Service) Ping(ctx context.Context) error {
+	return s.repo.Ping(ctx)
+}
+
+// RecordUserChange audits an account change made through the auth manager.
+func (s *Service) RecordUserChange(ctx context.Context, action string, username string, detail string) {
+	s.logAudit(ctx, s.defaultStoreID, action, "user", username, detail)
 }
 
 func (s *Service) logAudit(ctx context.Context, storeID string, action string, entityType string, entityID string, detail string) {
@@ -1626,7 +3931,7 @@ func (s *Service) logAudit(ctx context.Context, storeID string, action string, e
 	}
 
 	if err := s.repo.CreateAuditLog(ctx, domain.AuditLog{
-		ID:            xid.New("audit"),
+		ID:            s.newID("audit"),
 		StoreID:       storeID,
 		ActorUsername: actor.Username,
 		ActorRole:     actor.Role,
@@ -1640,6 +3945,18 @@ func (s *Service) logAudit(ctx context.Context, storeID string, action string, e
 	}
 }
 
+// daysToExpiry counts whole UTC calendar days from now until expiry. It is
+// negative once the lot has expired and nil when the lot has no expiry date.
+func daysToExpiry(expiry *time.Time, now time.Time) *int {
+	if expiry == nil {
+		return nil
+	}
+	today := time.Date(now.UTC().Year(), now.UTC().Month(), now.UTC().Day(), 0, 0, 0, 0, time.UTC)
+	expiryDay := time.Date(expiry.UTC().Year(), expiry.UTC().Month(), expiry.UTC().Day(), 0, 0, 0, 0, time.UTC)
+	days := int(expiryDay.Sub(today).Hours() / 24)
+	return &days
+}
+
 func deriveUnitCost(product domain.Product) int64 {
 	if product.PriceCents < 1 {
 		return 0
@@ -1703,7 +4020,7 @@ func decodePaymentSplits(raw string) []domain.PaymentSplit {
 
 func isSplitMethodSupported(method string) bool {
 	switch method {
-	case "cash", "card", "qris", "ewallet":
+	case "cash", "card", "qris", "ewallet", "store_credit":
 		return true
 	default:
 		return false
@@ -1723,7 +4040,7 @@ func severityRank(severity string) int {
 
 func ValidateStoreID(storeID string) error {
 	if storeID == "" {
-		return fmt.Errorf("store_id is required")
+		return ErrStoreIDRequired
 	}
 	return nil
 }
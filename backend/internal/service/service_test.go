@@ -1,9 +1,16 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
+	"math"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -12,6 +19,7 @@ import (
 	"kasirinaja/backend/internal/recommendation"
 	"kasirinaja/backend/internal/store"
 	"kasirinaja/backend/internal/store/memory"
+	"kasirinaja/backend/internal/xid"
 )
 
 func newTestService() *Service {
@@ -80,6 +88,313 @@ func TestCheckoutWithOpenShiftSupportsNonCash(t *testing.T) {
 	}
 }
 
+func TestCheckoutNamesUnavailableSKU(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		CashierName:       "Kasir A",
+		OpeningFloatCents: 250000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	inactive := false
+	if _, err := svc.UpdateProduct(ctx, "SKU-ROTI-01", domain.ProductUpdateRequest{Active: &inactive}); err != nil {
+		t.Fatalf("deactivate product failed: %v", err)
+	}
+
+	for _, sku := range []string{"SKU-GHOST-01", "SKU-ROTI-01"} {
+		_, err := svc.Checkout(ctx, domain.CheckoutRequest{
+			StoreID:          "main-store",
+			TerminalID:       "terminal-a1",
+			IdempotencyKey:   "idem-unavailable-" + sku,
+			PaymentMethod:    "card",
+			PaymentReference: "CARD-REF-UNAVAIL",
+			ManualOverride:   true,
+			CartItems: []domain.CartItem{
+				{SKU: "SKU-MIE-01", Qty: 1},
+				{SKU: sku, Qty: 1},
+			},
+		})
+		var skuErr *store.SKUError
+		if !errors.As(err, &skuErr) || skuErr.SKU != sku {
+			t.Fatalf("expected SKUError naming %s, got %v", sku, err)
+		}
+		if !errors.Is(err, store.ErrProductUnavailable) || !errors.Is(err, store.ErrInvalidTransaction) {
+			t.Fatalf("expected ErrProductUnavailable for %s, got %v", sku, err)
+		}
+	}
+}
+
+func TestQuoteCheckoutMatchesCheckoutWithoutSelling(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	promo, _, err := svc.CreatePromo(ctx, domain.PromoCreateRequest{Name: "Diskon 10%", Type: "cart_percent", DiscountPercent: 10})
+	if err != nil {
+		t.Fatalf("create promo failed: %v", err)
+	}
+	req := domain.CheckoutRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		IdempotencyKey:    "idem-quote-1",
+		PaymentMethod:     "cash",
+		CashReceivedCents: 100000,
+		DiscountCents:     1000,
+		TaxRatePercent:    11,
+		CartItems: []domain.CartItem{
+			{SKU: "SKU-SUSU-01", Qty: 2},
+			{SKU: "SKU-MIE-01", Qty: 3},
+		},
+	}
+
+	// No shift is open: quoting must not need one.
+	quote, err := svc.QuoteCheckout(ctx, req)
+	if err != nil {
+		t.Fatalf("quote failed: %v", err)
+	}
+	if quote.SubtotalCents != 2*18900+3*3500 || quote.ItemCount != 5 || len(quote.Lines) != 2 {
+		t.Fatalf("unexpected quote lines: %+v", quote)
+	}
+	if len(quote.AppliedPromos) != 1 || quote.AppliedPromos[0].PromoID != promo.ID || quote.DiscountCents != 1000+quote.PromoDiscountCents {
+		t.Fatalf("expected promo %s on top of the manual discount, got %+v", promo.ID, quote)
+	}
+	stock, _ := svc.repo.GetStockMap(ctx, "main-store", []string{"SKU-SUSU-01"})
+	if lookup, err := svc.LookupCheckoutByIdempotency(ctx, req.IdempotencyKey); err != nil || lookup.Found {
+		t.Fatalf("expected quote to record nothing, got %+v err %v", lookup, err)
+	}
+
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		CashierName:       "Kasir A",
+		OpeningFloatCents: 250000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	sold, err := svc.Checkout(ctx, req)
+	if err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+	if sold.SubtotalCents != quote.SubtotalCents || sold.DiscountCents != quote.DiscountCents ||
+		sold.TaxCents != quote.TaxCents || sold.TotalCents != quote.TotalCents || sold.ChangeCents != quote.ChangeCents {
+		t.Fatalf("quote %+v drifted from checkout %+v", quote, sold)
+	}
+	after, _ := svc.repo.GetStockMap(ctx, "main-store", []string{"SKU-SUSU-01"})
+	if after["SKU-SUSU-01"] != stock["SKU-SUSU-01"]-2 {
+		t.Fatalf("expected only the checkout to take stock, got %d -> %d", stock["SKU-SUSU-01"], after["SKU-SUSU-01"])
+	}
+}
+
+func TestQuoteCheckoutReportsSplitChangeAsCredit(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	req := domain.CheckoutRequest{
+		StoreID:         "main-store",
+		TerminalID:      "terminal-a1",
+		IdempotencyKey:  "idem-quote-split-credit",
+		ChangeAsCredit:  true,
+		StoreCreditCode: "MEMBER-0813",
+		PaymentSplits: []domain.PaymentSplit{
+			{Method: "cash", AmountCents: 5000},
+			{Method: "qris", AmountCents: 4000, Reference: "TRX-QRIS-QUOTE"},
+		},
+		CartItems: []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 2}},
+	}
+	quote, err := svc.QuoteCheckout(ctx, req)
+	if err != nil {
+		t.Fatalf("quote failed: %v", err)
+	}
+	if quote.CashReceived != 9000 || quote.StoreCreditCents != 9000-quote.TotalCents || quote.ChangeCents != 0 {
+		t.Fatalf("expected the overpaid split to be quoted as store credit, got %+v", quote)
+	}
+
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		CashierName:       "Kasir A",
+		OpeningFloatCents: 250000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	sold, err := svc.Checkout(ctx, req)
+	if err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+	if sold.StoreCreditCents != quote.StoreCreditCents || sold.ChangeCents != quote.ChangeCents {
+		t.Fatalf("quote %+v drifted from checkout %+v", quote, sold)
+	}
+}
+
+func TestCheckoutReturnsTypedValidationErrors(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		CashierName:       "Kasir A",
+		OpeningFloatCents: 250000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+
+	cart := []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}}
+	cases := []struct {
+		name string
+		req  domain.CheckoutRequest
+		want error
+	}{
+		{"unsupported method", domain.CheckoutRequest{PaymentMethod: "bitcoin", CartItems: cart}, store.ErrUnsupportedPaymentMethod},
+		{"tax rate", domain.CheckoutRequest{TaxRatePercent: 150, CartItems: cart}, store.ErrInvalidTaxRate},
+		{"negative discount", domain.CheckoutRequest{DiscountCents: -1, CartItems: cart}, store.ErrInvalidDiscount},
+		{"empty cart", domain.CheckoutRequest{CashReceivedCents: 100000}, store.ErrEmptyCart},
+		{"cash short", domain.CheckoutRequest{CashReceivedCents: 1, CartItems: cart}, store.ErrInsufficientPayment},
+		{"single leg split", domain.CheckoutRequest{
+			PaymentSplits: []domain.PaymentSplit{{Method: "cash", AmountCents: 100000}},
+			CartItems:     cart,
+		}, store.ErrInvalidSplitPayment},
+	}
+	for i, tc := range cases {
+		tc.req.StoreID = "main-store"
+		tc.req.TerminalID = "terminal-a1"
+		tc.req.IdempotencyKey = "idem-typed-" + strconv.Itoa(i)
+		_, err := svc.Checkout(ctx, tc.req)
+		if !errors.Is(err, tc.want) || !errors.Is(err, store.ErrInvalidTransaction) {
+			t.Fatalf("%s: expected %v wrapping ErrInvalidTransaction, got %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+func TestProductAvailabilityWindow(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	today := svc.storeDate()
+	date := func(days int) string { return today.AddDate(0, 0, days).Format("2006-01-02") }
+
+	windows := []struct {
+		sku       string
+		from      string
+		until     string
+		available bool
+	}{
+		{"SEASON-TODAY", date(0), date(0), true},
+		{"SEASON-OPEN-END", date(-30), "", true},
+		{"SEASON-ENDED", date(-30), date(-1), false},
+		{"SEASON-UPCOMING", date(1), date(30), false},
+	}
+	for _, w := range windows {
+		if _, err := svc.CreateProduct(ctx, domain.ProductCreateRequest{
+			SKU:            w.sku,
+			Name:           w.sku,
+			Category:       "Musiman",
+			PriceCents:     10000,
+			InitialStock:   5,
+			AvailableFrom:  w.from,
+			AvailableUntil: w.until,
+		}); err != nil {
+			t.Fatalf("create %s failed: %v", w.sku, err)
+		}
+	}
+
+	products, err := svc.ListProducts(ctx, domain.ProductFilter{})
+	if err != nil {
+		t.Fatalf("list products failed: %v", err)
+	}
+	listed := map[string]bool{}
+	for _, product := range products {
+		listed[product.SKU] = true
+	}
+	for _, w := range windows {
+		if listed[w.sku] != w.available {
+			t.Fatalf("%s: expected listed=%t", w.sku, w.available)
+		}
+		_, err := svc.QuoteCheckout(ctx, domain.CheckoutRequest{
+			StoreID:           "main-store",
+			PaymentMethod:     "cash",
+			CashReceivedCents: 100000,
+			CartItems:         []domain.CartItem{{SKU: w.sku, Qty: 1}},
+		})
+		if w.available && err != nil {
+			t.Fatalf("%s: expected a quote, got %v", w.sku, err)
+		}
+		if !w.available && !errors.Is(err, store.ErrProductOutOfSeason) {
+			t.Fatalf("%s: expected ErrProductOutOfSeason, got %v", w.sku, err)
+		}
+	}
+
+	if _, err := svc.CreateProduct(ctx, domain.ProductCreateRequest{
+		SKU: "SEASON-BACKWARDS", Name: "Backwards", Category: "Musiman", PriceCents: 10000,
+		AvailableFrom: date(1), AvailableUntil: date(0),
+	}); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected until before from to be rejected, got %v", err)
+	}
+
+	clear := ""
+	updated, err := svc.UpdateProduct(ctx, "SEASON-ENDED", domain.ProductUpdateRequest{AvailableUntil: &clear})
+	if err != nil {
+		t.Fatalf("update product failed: %v", err)
+	}
+	if updated.AvailableUntil != nil || updated.AvailableFrom == nil {
+		t.Fatalf("expected only the end date to be cleared, got %+v", updated)
+	}
+	if _, err := svc.QuoteCheckout(ctx, domain.CheckoutRequest{
+		StoreID:           "main-store",
+		PaymentMethod:     "cash",
+		CashReceivedCents: 100000,
+		CartItems:         []domain.CartItem{{SKU: "SEASON-ENDED", Qty: 1}},
+	}); err != nil {
+		t.Fatalf("expected a cleared end date to sell again, got %v", err)
+	}
+}
+
+func TestProductBrandAndTagsNormalizedAndFiltered(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	created, err := svc.CreateProduct(ctx, domain.ProductCreateRequest{
+		SKU: "SKU-RENDANG-01", Name: "Rendang Kaleng", Category: "Makanan", PriceCents: 35000,
+		Brand: " Padang Jaya ", Tags: []string{"Halal", " promo", "halal", ""},
+	})
+	if err != nil {
+		t.Fatalf("create product failed: %v", err)
+	}
+	if created.Brand != "Padang Jaya" || !slices.Equal(created.Tags, []string{"halal", "promo"}) {
+		t.Fatalf("expected trimmed brand and lowercase unique tags, got %q %v", created.Brand, created.Tags)
+	}
+
+	halal, err := svc.ListProducts(ctx, domain.ProductFilter{Tag: "HALAL"})
+	if err != nil {
+		t.Fatalf("list products failed: %v", err)
+	}
+	if len(halal) != 1 || halal[0].SKU != "SKU-RENDANG-01" {
+		t.Fatalf("expected only the halal product, got %+v", halal)
+	}
+	if byBrand, _ := svc.ListProducts(ctx, domain.ProductFilter{Brand: "padang jaya"}); len(byBrand) != 1 {
+		t.Fatalf("expected a case-insensitive brand match, got %+v", byBrand)
+	}
+
+	noTags := []string{}
+	updated, err := svc.UpdateProduct(ctx, "SKU-RENDANG-01", domain.ProductUpdateRequest{Tags: &noTags})
+	if err != nil {
+		t.Fatalf("update product failed: %v", err)
+	}
+	if len(updated.Tags) != 0 || updated.Brand != "Padang Jaya" {
+		t.Fatalf("expected tags cleared and brand kept, got %q %v", updated.Brand, updated.Tags)
+	}
+	if halal, _ := svc.ListProducts(ctx, domain.ProductFilter{Tag: "halal"}); len(halal) != 0 {
+		t.Fatalf("expected no halal products after clearing tags, got %+v", halal)
+	}
+
+	tooLong := []string{strings.Repeat("x", store.MaxProductTagLen+1)}
+	if _, err := svc.UpdateProduct(ctx, "SKU-RENDANG-01", domain.ProductUpdateRequest{Tags: &tooLong}); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected an over-long tag to be rejected, got %v", err)
+	}
+}
+
 func TestCheckoutLookupByIdempotency(t *testing.T) {
 	svc := newTestService()
 	ctx := context.Background()
@@ -117,6 +432,221 @@ func TestCheckoutLookupByIdempotency(t *testing.T) {
 	}
 }
 
+func TestResponseTimestampsAreRFC3339WithOffset(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		CashierName:       "Kasir A",
+		OpeningFloatCents: 250000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+
+	checkout := func(key string) domain.CheckoutResponse {
+		t.Helper()
+		resp, err := svc.Checkout(ctx, domain.CheckoutRequest{
+			StoreID:           "main-store",
+			TerminalID:        "terminal-a1",
+			IdempotencyKey:    key,
+			PaymentMethod:     "cash",
+			CashReceivedCents: 100000,
+			CartItems:         []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}},
+		})
+		if err != nil {
+			t.Fatalf("checkout failed: %v", err)
+		}
+		return resp
+	}
+	parse := func(name string, value string, wantOffset int) time.Time {
+		t.Helper()
+		parsed, err := time.Parse(TimestampFormat, value)
+		if err != nil {
+			t.Fatalf("%s %q does not parse: %v", name, value, err)
+		}
+		if _, offset := parsed.Zone(); offset != wantOffset {
+			t.Fatalf("%s %q: expected offset %d, got %d", name, value, wantOffset, offset)
+		}
+		return parsed
+	}
+
+	utc := checkout("idem-ts-utc")
+	if !strings.HasSuffix(utc.CreatedAt, "Z") {
+		t.Fatalf("expected a UTC created_at by default, got %q", utc.CreatedAt)
+	}
+	parse("created_at", utc.CreatedAt, 0)
+
+	svc.SetStoreLocation(time.FixedZone("WIB", 7*60*60))
+	svc.SetLocalTimestamps(true)
+	local := checkout("idem-ts-local")
+	createdAt := parse("created_at", local.CreatedAt, 7*60*60)
+	if time.Since(createdAt) > time.Minute {
+		t.Fatalf("expected created_at to be the same instant, got %q", local.CreatedAt)
+	}
+	voided, err := svc.VoidTransaction(ctx, domain.VoidTransactionRequest{TransactionID: local.TransactionID, Reason: "salah input"})
+	if err != nil {
+		t.Fatalf("void failed: %v", err)
+	}
+	parse("voided_at", voided.VoidedAt, 7*60*60)
+	opname, err := svc.StockOpname(ctx, domain.StockOpnameRequest{
+		StoreID: "main-store",
+		Items:   []domain.StockOpnameItem{{SKU: "SKU-MIE-01", CountedQty: 5}},
+	})
+	if err != nil {
+		t.Fatalf("stock opname failed: %v", err)
+	}
+	parse("opname created_at", opname.CreatedAt, 7*60*60)
+}
+
+func TestRegisteredTerminalsRequired(t *testing.T) {
+	svc := newTestService()
+	admin := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	openShift := func(ctx context.Context) error {
+		_, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+			StoreID:           "main-store",
+			TerminalID:        "terminal-a1",
+			CashierName:       "Kasir A",
+			OpeningFloatCents: 250000,
+		})
+		return err
+	}
+
+	svc.SetRequireRegisteredTerminals(true)
+	if err := openShift(admin); !errors.Is(err, ErrTerminalNotRegistered) {
+		t.Fatalf("expected an unregistered terminal to be rejected, got %v", err)
+	}
+
+	cashier := WithActor(context.Background(), domain.Actor{Username: "cashier", Role: "cashier"})
+	if _, err := svc.RegisterTerminal(cashier, "main-store", "terminal-a1", "Kasir depan"); err == nil {
+		t.Fatalf("expected a cashier registration to be rejected")
+	}
+	registration, err := svc.RegisterTerminal(admin, "main-store", "terminal-a1", "Kasir depan")
+	if err != nil {
+		t.Fatalf("register terminal failed: %v", err)
+	}
+	if registration.Token == "" || registration.Terminal.TokenHash == registration.Token {
+		t.Fatalf("expected a token distinct from its stored hash, got %+v", registration)
+	}
+
+	if err := openShift(WithTerminalToken(admin, "wrong-token")); !errors.Is(err, ErrTerminalNotRegistered) {
+		t.Fatalf("expected a wrong token to be rejected, got %v", err)
+	}
+	terminalCtx := WithTerminalToken(admin, registration.Token)
+	if err := openShift(terminalCtx); err != nil {
+		t.Fatalf("expected the registered terminal to open a shift, got %v", err)
+	}
+	checkout := domain.CheckoutRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		IdempotencyKey:    "idem-terminal-1",
+		PaymentMethod:     "cash",
+		CashReceivedCents: 100000,
+		CartItems:         []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}},
+	}
+	if _, err := svc.Checkout(terminalCtx, checkout); err != nil {
+		t.Fatalf("expected the registered terminal to check out, got %v", err)
+	}
+
+	if _, err := svc.RevokeTerminal(admin, "main-store", "terminal-a1"); err != nil {
+		t.Fatalf("revoke terminal failed: %v", err)
+	}
+	checkout.IdempotencyKey = "idem-terminal-2"
+	if _, err := svc.Checkout(terminalCtx, checkout); !errors.Is(err, ErrTerminalNotRegistered) {
+		t.Fatalf("expected a revoked terminal to be rejected, got %v", err)
+	}
+	list, err := svc.ListTerminals(admin, "main-store")
+	if err != nil {
+		t.Fatalf("list terminals failed: %v", err)
+	}
+	if len(list.Terminals) != 1 || list.Terminals[0].RevokedAt == nil || list.Terminals[0].Label != "Kasir depan" {
+		t.Fatalf("expected one revoked terminal, got %+v", list.Terminals)
+	}
+	if _, err := svc.RevokeTerminal(admin, "main-store", "terminal-missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for an unknown terminal, got %v", err)
+	}
+
+	svc.SetRequireRegisteredTerminals(false)
+	checkout.IdempotencyKey = "idem-terminal-3"
+	if _, err := svc.Checkout(admin, checkout); err != nil {
+		t.Fatalf("expected any terminal to check out when registration is off, got %v", err)
+	}
+}
+
+func TestRecordCashMovementRequiresRegisteredTerminal(t *testing.T) {
+	svc := newTestService()
+	admin := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	svc.SetRequireRegisteredTerminals(true)
+
+	registration, err := svc.RegisterTerminal(admin, "main-store", "terminal-a1", "Kasir depan")
+	if err != nil {
+		t.Fatalf("register terminal failed: %v", err)
+	}
+	terminalCtx := WithTerminalToken(admin, registration.Token)
+	shift, err := svc.OpenShift(terminalCtx, domain.ShiftOpenRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		CashierName:       "Kasir A",
+		OpeningFloatCents: 250000,
+	})
+	if err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+
+	if _, err := svc.RecordCashMovement(admin, shift.Shift.ID, domain.CashMovementPaidOut, 50000, "galon"); !errors.Is(err, ErrTerminalNotRegistered) {
+		t.Fatalf("expected a cash movement without the terminal token to be rejected, got %v", err)
+	}
+	if _, err := svc.RecordCashMovement(WithTerminalToken(admin, "wrong-token"), shift.Shift.ID, domain.CashMovementDrop, 50000, ""); !errors.Is(err, ErrTerminalNotRegistered) {
+		t.Fatalf("expected a wrong terminal token to be rejected, got %v", err)
+	}
+	if _, err := svc.RecordCashMovement(terminalCtx, shift.Shift.ID, domain.CashMovementPaidOut, 50000, "galon"); err != nil {
+		t.Fatalf("expected the registered terminal to record a cash movement, got %v", err)
+	}
+}
+
+func TestRequireExplicitStoreID(t *testing.T) {
+	svc := newTestService()
+	admin := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	report, err := svc.DailyReport(admin, "", "")
+	if err != nil {
+		t.Fatalf("daily report failed: %v", err)
+	}
+	if report.StoreID != "main-store" {
+		t.Fatalf("expected an empty store to default to main-store, got %q", report.StoreID)
+	}
+
+	svc.SetRequireExplicitStoreID(true)
+	if _, err := svc.DailyReport(admin, "", ""); !errors.Is(err, ErrStoreIDRequired) {
+		t.Fatalf("expected ErrStoreIDRequired for a report, got %v", err)
+	}
+	if _, err := svc.OpenShift(admin, domain.ShiftOpenRequest{TerminalID: "terminal-a1", CashierName: "Kasir A"}); !errors.Is(err, ErrStoreIDRequired) {
+		t.Fatalf("expected ErrStoreIDRequired for a shift, got %v", err)
+	}
+	_, err = svc.Checkout(admin, domain.CheckoutRequest{
+		TerminalID:        "terminal-a1",
+		IdempotencyKey:    "idem-no-store",
+		PaymentMethod:     "cash",
+		CashReceivedCents: 100000,
+		CartItems:         []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}},
+	})
+	if !errors.Is(err, ErrStoreIDRequired) || !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected ErrStoreIDRequired for a checkout, got %v", err)
+	}
+	if _, err := svc.ListPurchaseOrders(admin, "", ""); !errors.Is(err, ErrStoreIDRequired) {
+		t.Fatalf("expected ErrStoreIDRequired for purchase orders, got %v", err)
+	}
+	if _, err := svc.PaymentMethods(""); !errors.Is(err, ErrStoreIDRequired) {
+		t.Fatalf("expected ErrStoreIDRequired for payment methods, got %v", err)
+	}
+	if _, err := svc.DailyReport(admin, "main-store", ""); err != nil {
+		t.Fatalf("expected a named store to be accepted, got %v", err)
+	}
+	if _, err := svc.ListPurchaseOrders(admin, "main-store", ""); err != nil {
+		t.Fatalf("expected purchase orders for a named store, got %v", err)
+	}
+}
+
 func TestVoidAndRefundLifecycle(t *testing.T) {
 	svc := newTestService()
 	ctx := context.Background()
@@ -211,7 +741,7 @@ func TestCreateProductAdminSuccess(t *testing.T) {
 		t.Fatalf("unexpected sku: %s", product.SKU)
 	}
 
-	products, err := svc.ListProducts(ctx)
+	products, err := svc.ListProducts(ctx, domain.ProductFilter{})
 	if err != nil {
 		t.Fatalf("list products failed: %v", err)
 	}
@@ -249,227 +779,284 @@ func TestCreateProductRequiresAdmin(t *testing.T) {
 	}
 }
 
-func TestCheckoutSplitPayment(t *testing.T) {
+func TestProductMarginRateAcceptsPercentages(t *testing.T) {
 	svc := newTestService()
-	ctx := WithActor(context.Background(), domain.Actor{
-		Username: "admin",
-		Role:     "admin",
-	})
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
 
-	_, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
-		StoreID:           "main-store",
-		TerminalID:        "terminal-a1",
-		CashierName:       "Kasir Split",
-		OpeningFloatCents: 200000,
-	})
-	if err != nil {
-		t.Fatalf("open shift failed: %v", err)
+	cases := []struct {
+		input float64
+		want  float64
+		ok    bool
+	}{
+		{input: 0.3, want: 0.3, ok: true},
+		{input: 30, want: 0.3, ok: true},
+		{input: 100, want: 1, ok: true},
+		{input: 150, ok: false},
+		{input: -0.1, ok: false},
 	}
-
-	resp, err := svc.Checkout(ctx, domain.CheckoutRequest{
-		StoreID:           "main-store",
-		TerminalID:        "terminal-a1",
-		IdempotencyKey:    "idem-split",
-		PaymentMethod:     "split",
-		TaxRatePercent:    0,
-		CashReceivedCents: 0,
-		PaymentSplits: []domain.PaymentSplit{
-			{Method: "cash", AmountCents: 3000},
-			{Method: "qris", AmountCents: 4000, Reference: "TRX-QRIS-001"},
-		},
-		CartItems: []domain.CartItem{
-			{SKU: "SKU-MIE-01", Qty: 2},
-		},
-	})
-	if err != nil {
-		t.Fatalf("split checkout failed: %v", err)
-	}
-	if resp.PaymentMethod != "split" {
-		t.Fatalf("expected split payment, got %s", resp.PaymentMethod)
+	for i, tc := range cases {
+		sku := "SKU-MARGIN-" + strconv.Itoa(i)
+		product, err := svc.CreateProduct(ctx, domain.ProductCreateRequest{
+			StoreID:    "main-store",
+			SKU:        sku,
+			Name:       "Margin " + sku,
+			Category:   "snack",
+			PriceCents: 10000,
+			MarginRate: tc.input,
+		})
+		if !tc.ok {
+			if !errors.Is(err, store.ErrInvalidTransaction) {
+				t.Fatalf("margin %v: expected rejection, got %v", tc.input, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("margin %v: create failed: %v", tc.input, err)
+		}
+		if math.Abs(product.MarginRate-tc.want) > 1e-9 {
+			t.Fatalf("margin %v: expected %v, got %v", tc.input, tc.want, product.MarginRate)
+		}
+
+		updated, err := svc.UpdateProduct(ctx, sku, domain.ProductUpdateRequest{MarginRate: &tc.input})
+		if err != nil {
+			t.Fatalf("margin %v: update failed: %v", tc.input, err)
+		}
+		if math.Abs(updated.MarginRate-tc.want) > 1e-9 {
+			t.Fatalf("margin %v: expected update to store %v, got %v", tc.input, tc.want, updated.MarginRate)
+		}
 	}
-	if len(resp.PaymentSplits) != 2 {
-		t.Fatalf("expected 2 payment splits, got %d", len(resp.PaymentSplits))
+
+	over := 150.0
+	if _, err := svc.UpdateProduct(ctx, "SKU-MIE-01", domain.ProductUpdateRequest{MarginRate: &over}); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected update with margin 150 to be rejected, got %v", err)
 	}
 }
 
-func TestHoldAndResumeCart(t *testing.T) {
+func TestSyncOfflineReportsReasonCodes(t *testing.T) {
 	svc := newTestService()
-	ctx := WithActor(context.Background(), domain.Actor{
-		Username: "cashier",
-		Role:     "cashier",
-	})
-
-	held, err := svc.HoldCart(ctx, domain.HoldCartRequest{
-		StoreID:        "main-store",
-		TerminalID:     "terminal-a1",
-		Note:           "customer ambil dompet",
-		PaymentMethod:  "cash",
-		DiscountCents:  0,
-		TaxRatePercent: 11,
-		CartItems: []domain.CartItem{
-			{SKU: "SKU-MIE-01", Qty: 1},
-			{SKU: "SKU-TELUR-01", Qty: 1},
-		},
-	})
-	if err != nil {
-		t.Fatalf("hold cart failed: %v", err)
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	offlineSale := func(id string, sku string, qty int) domain.OfflineTransaction {
+		return domain.OfflineTransaction{
+			ClientTransactionID: id,
+			Checkout: domain.CheckoutRequest{
+				PaymentMethod: "cash", CashReceivedCents: 500000,
+				CartItems: []domain.CartItem{{SKU: sku, Qty: qty}},
+			},
+		}
 	}
 
-	list, err := svc.ListHeldCarts(ctx, "main-store", "terminal-a1")
+	resp, err := svc.SyncOffline(ctx, domain.OfflineSyncRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", EnvelopeID: "env-no-shift",
+		Transactions: []domain.OfflineTransaction{offlineSale("offline-0", "SKU-MIE-01", 1)},
+	})
 	if err != nil {
-		t.Fatalf("list held carts failed: %v", err)
+		t.Fatalf("sync failed: %v", err)
 	}
-	if len(list.Items) != 1 {
-		t.Fatalf("expected 1 held cart, got %d", len(list.Items))
+	if got := resp.Statuses[0]; got.Status != "rejected" || got.ReasonCode != domain.OfflineReasonNoActiveShift || got.Reason == "" {
+		t.Fatalf("expected a no_active_shift rejection with a reason, got %+v", got)
 	}
 
-	resumed, err := svc.ResumeHeldCart(ctx, held.HeldCart.ID)
-	if err != nil {
-		t.Fatalf("resume held cart failed: %v", err)
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir Offline", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
 	}
-	if len(resumed.HeldCart.CartItems) != 2 {
-		t.Fatalf("expected resumed cart with 2 items")
+	if err := svc.repo.SetStock(ctx, "main-store", "SKU-TELUR-01", 1); err != nil {
+		t.Fatalf("set stock failed: %v", err)
 	}
 
-	afterResume, err := svc.ListHeldCarts(ctx, "main-store", "terminal-a1")
+	resp, err = svc.SyncOffline(ctx, domain.OfflineSyncRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", EnvelopeID: "env-conflicts",
+		Transactions: []domain.OfflineTransaction{
+			offlineSale("offline-1", "SKU-MIE-01", 1),
+			offlineSale("offline-2", "SKU-TELUR-01", 5),
+			offlineSale("offline-3", "SKU-HILANG-01", 1),
+		},
+	})
 	if err != nil {
-		t.Fatalf("list after resume failed: %v", err)
+		t.Fatalf("sync failed: %v", err)
 	}
-	if len(afterResume.Items) != 0 {
-		t.Fatalf("expected held carts to be empty after resume")
+	want := []domain.OfflineSyncStatus{
+		{ClientTransactionID: "offline-1", Status: "accepted"},
+		{ClientTransactionID: "offline-2", Status: "rejected", ReasonCode: domain.OfflineReasonInsufficientStock, ConflictSKU: "SKU-TELUR-01"},
+		{ClientTransactionID: "offline-3", Status: "rejected", ReasonCode: domain.OfflineReasonInvalid, ConflictSKU: "SKU-HILANG-01"},
+	}
+	for i, status := range resp.Statuses {
+		status.Reason, status.TransactionID = "", ""
+		if status != want[i] {
+			t.Fatalf("status %d: expected %+v, got %+v", i, want[i], status)
+		}
 	}
 }
 
-func TestProcurementReceiveAndReorderSuggestions(t *testing.T) {
+func TestSyncOfflineReplaysSalesInQueuedOrder(t *testing.T) {
 	svc := newTestService()
-	ctx := WithActor(context.Background(), domain.Actor{
-		Username: "admin",
-		Role:     "admin",
-	})
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir Offline", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	if err := svc.repo.SetStock(ctx, "main-store", "SKU-TELUR-01", 1); err != nil {
+		t.Fatalf("set stock failed: %v", err)
+	}
 
-	_, err := svc.StockOpname(ctx, domain.StockOpnameRequest{
-		StoreID: "main-store",
-		Notes:   "set low stock",
-		Items: []domain.StockOpnameItem{
-			{SKU: "SKU-MIE-01", CountedQty: 5},
+	queued := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	sale := func(id string, at time.Time) domain.OfflineTransaction {
+		return domain.OfflineTransaction{
+			ClientTransactionID: id,
+			QueuedAt:            at,
+			Checkout: domain.CheckoutRequest{
+				PaymentMethod: "cash", CashReceivedCents: 100000,
+				CartItems: []domain.CartItem{{SKU: "SKU-TELUR-01", Qty: 1}},
+			},
+		}
+	}
+	// The later sale arrives first; the earlier one must get the last egg.
+	resp, err := svc.SyncOffline(ctx, domain.OfflineSyncRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", EnvelopeID: "env-out-of-order",
+		Transactions: []domain.OfflineTransaction{
+			sale("offline-late", queued.Add(10*time.Minute)),
+			sale("offline-early", queued),
 		},
 	})
 	if err != nil {
-		t.Fatalf("stock opname failed: %v", err)
+		t.Fatalf("sync failed: %v", err)
+	}
+	late, early := resp.Statuses[0], resp.Statuses[1]
+	if early.ClientTransactionID != "offline-early" || early.Status != "accepted" {
+		t.Fatalf("expected the earlier sale to be accepted, got %+v", early)
 	}
+	if late.ClientTransactionID != "offline-late" || late.ReasonCode != domain.OfflineReasonInsufficientStock {
+		t.Fatalf("expected the later sale to run out of stock, got %+v", late)
+	}
+}
 
-	supplier, err := svc.CreateSupplier(ctx, domain.SupplierCreateRequest{
-		Name:  "Supplier Test",
-		Phone: "08123456789",
-	})
+func TestSyncOfflineAllOrNothingRollsBackEnvelope(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir Offline", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	if err := svc.repo.SetStock(ctx, "main-store", "SKU-TELUR-01", 1); err != nil {
+		t.Fatalf("set stock failed: %v", err)
+	}
+	stockBefore, err := svc.repo.GetStockMap(ctx, "main-store", []string{"SKU-MIE-01", "SKU-TELUR-01"})
 	if err != nil {
-		t.Fatalf("create supplier failed: %v", err)
+		t.Fatalf("get stock failed: %v", err)
 	}
 
-	poResp, err := svc.CreatePurchaseOrder(ctx, domain.PurchaseOrderCreateRequest{
-		StoreID:    "main-store",
-		SupplierID: supplier.ID,
-		Items: []domain.PurchaseOrderItem{
-			{SKU: "SKU-MIE-01", Qty: 20, CostCents: 2000},
+	sale := func(id string, sku string, qty int) domain.OfflineTransaction {
+		return domain.OfflineTransaction{
+			ClientTransactionID: id,
+			Checkout: domain.CheckoutRequest{
+				PaymentMethod: "cash", CashReceivedCents: 500000,
+				CartItems: []domain.CartItem{{SKU: sku, Qty: qty}},
+			},
+		}
+	}
+	envelope := domain.OfflineSyncRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", EnvelopeID: "env-atomic", AllOrNothing: true,
+		Transactions: []domain.OfflineTransaction{
+			sale("atomic-1", "SKU-MIE-01", 2),
+			sale("atomic-2", "SKU-TELUR-01", 1),
+			sale("atomic-3", "SKU-TELUR-01", 1),
 		},
-	})
-	if err != nil {
-		t.Fatalf("create purchase order failed: %v", err)
 	}
-
-	received, err := svc.ReceivePurchaseOrder(ctx, poResp.PurchaseOrder.ID, domain.PurchaseOrderReceiveRequest{
-		ReceivedBy: "manager-a",
-	})
+	resp, err := svc.SyncOffline(ctx, envelope)
 	if err != nil {
-		t.Fatalf("receive purchase order failed: %v", err)
+		t.Fatalf("sync failed: %v", err)
 	}
-	if received.PurchaseOrder.Status != "received" {
-		t.Fatalf("expected PO status received, got %s", received.PurchaseOrder.Status)
+	wantCodes := []string{domain.OfflineReasonBatchAborted, domain.OfflineReasonBatchAborted, domain.OfflineReasonInsufficientStock}
+	for i, status := range resp.Statuses {
+		if status.Status != "rejected" || status.ReasonCode != wantCodes[i] {
+			t.Fatalf("status %d: expected rejected with %s, got %+v", i, wantCodes[i], status)
+		}
 	}
-	if received.PurchaseOrder.ReceivedBy != "manager-a" {
-		t.Fatalf("expected received_by manager-a, got %s", received.PurchaseOrder.ReceivedBy)
+	for _, key := range []string{"atomic-1", "atomic-2"} {
+		if _, err := svc.repo.FindTransactionByIdempotency(ctx, key); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("expected %s to be rolled back, got %v", key, err)
+		}
 	}
-
-	suggestions, err := svc.ReorderSuggestions(ctx, "main-store")
+	stockAfter, err := svc.repo.GetStockMap(ctx, "main-store", []string{"SKU-MIE-01", "SKU-TELUR-01"})
 	if err != nil {
-		t.Fatalf("reorder suggestions failed: %v", err)
+		t.Fatalf("get stock failed: %v", err)
+	}
+	if stockAfter["SKU-MIE-01"] != stockBefore["SKU-MIE-01"] || stockAfter["SKU-TELUR-01"] != stockBefore["SKU-TELUR-01"] {
+		t.Fatalf("expected stock to be restored, before %v after %v", stockBefore, stockAfter)
 	}
 
-	found := false
-	for _, item := range suggestions.Suggestions {
-		if item.SKU == "SKU-MIE-01" {
-			found = true
-			if item.CurrentStock != 25 {
-				t.Fatalf("expected current stock 25 after receive, got %d", item.CurrentStock)
-			}
-			if item.LastCostCents != 2000 {
-				t.Fatalf("expected last cost 2000, got %d", item.LastCostCents)
-			}
-		}
+	envelope.EnvelopeID = "env-atomic-retry"
+	envelope.Transactions = envelope.Transactions[:2]
+	resp, err = svc.SyncOffline(ctx, envelope)
+	if err != nil {
+		t.Fatalf("sync failed: %v", err)
 	}
-	if !found {
-		t.Fatalf("expected reorder suggestion for SKU-MIE-01")
+	for i, status := range resp.Statuses {
+		if status.Status != "accepted" || status.TransactionID == "" {
+			t.Fatalf("status %d: expected accepted, got %+v", i, status)
+		}
 	}
 }
 
-func TestDetectOperationalAnomalies(t *testing.T) {
+func TestSyncOfflineReturnsRecordedResponseForRetriedEnvelope(t *testing.T) {
 	svc := newTestService()
-	ctx := WithActor(context.Background(), domain.Actor{
-		Username: "admin",
-		Role:     "admin",
-	})
-
-	_, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
-		StoreID:           "main-store",
-		TerminalID:        "terminal-a1",
-		CashierName:       "Kasir A",
-		OpeningFloatCents: 250000,
-	})
-	if err != nil {
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir Offline", OpeningFloatCents: 100000,
+	}); err != nil {
 		t.Fatalf("open shift failed: %v", err)
 	}
 
-	for i := 0; i < 3; i++ {
-		resp, checkoutErr := svc.Checkout(ctx, domain.CheckoutRequest{
-			StoreID:           "main-store",
-			TerminalID:        "terminal-a1",
-			IdempotencyKey:    "idem-anom-" + strconv.Itoa(i),
-			PaymentMethod:     "cash",
-			CashReceivedCents: 100000,
-			CartItems: []domain.CartItem{
-				{SKU: "SKU-MIE-01", Qty: 1},
-			},
-		})
-		if checkoutErr != nil {
-			t.Fatalf("checkout #%d failed: %v", i, checkoutErr)
-		}
-		_, voidErr := svc.VoidTransaction(ctx, domain.VoidTransactionRequest{
-			TransactionID: resp.TransactionID,
-			Reason:        "void test",
-		})
-		if voidErr != nil {
-			t.Fatalf("void #%d failed: %v", i, voidErr)
-		}
+	envelope := domain.OfflineSyncRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", EnvelopeID: "env-retried",
+		Transactions: []domain.OfflineTransaction{
+			{ClientTransactionID: "retry-1", Checkout: domain.CheckoutRequest{
+				PaymentMethod: "cash", CashReceivedCents: 100000,
+				CartItems: []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}},
+			}},
+			{ClientTransactionID: "retry-2", Checkout: domain.CheckoutRequest{
+				PaymentMethod: "cash", CashReceivedCents: 100000,
+				CartItems: []domain.CartItem{{SKU: "SKU-HILANG-01", Qty: 1}},
+			}},
+		},
 	}
-
-	alerts, err := svc.DetectOperationalAnomalies(ctx, "main-store", time.Now().UTC().Format("2006-01-02"))
+	first, err := svc.SyncOffline(ctx, envelope)
 	if err != nil {
-		t.Fatalf("detect anomalies failed: %v", err)
+		t.Fatalf("first sync failed: %v", err)
+	}
+	second, err := svc.SyncOffline(ctx, envelope)
+	if err != nil {
+		t.Fatalf("retried sync failed: %v", err)
+	}
+	if !slices.Equal(first.Statuses, second.Statuses) {
+		t.Fatalf("expected identical statuses, first %+v second %+v", first.Statuses, second.Statuses)
+	}
+	if second.Statuses[0].Status != "accepted" {
+		t.Fatalf("expected the retry to report the original acceptance, got %+v", second.Statuses[0])
 	}
 
-	foundVoidSpike := false
-	for _, alert := range alerts.Alerts {
-		if alert.Code == "void_spike" {
-			foundVoidSpike = true
-			break
-		}
+	shift, err := svc.GetActiveShift(ctx, "main-store", "terminal-a1")
+	if err != nil {
+		t.Fatalf("get active shift failed: %v", err)
 	}
-	if !foundVoidSpike {
-		t.Fatalf("expected void_spike anomaly to be detected")
+	txs, err := svc.repo.ListShiftTransactions(ctx, shift.Shift.ID)
+	if err != nil {
+		t.Fatalf("list shift transactions failed: %v", err)
+	}
+	if len(txs) != 1 {
+		t.Fatalf("expected the retried envelope to create no extra transactions, got %d", len(txs))
+	}
+
+	pruned, err := svc.repo.PruneOfflineEnvelopes(ctx, time.Now().Add(25*time.Hour))
+	if err != nil || pruned != 1 {
+		t.Fatalf("expected the envelope record to expire after its TTL, pruned %d err %v", pruned, err)
 	}
 }
 
-func TestRefundRejectsCumulativeOverRefund(t *testing.T) {
+func TestCheckoutSplitPayment(t *testing.T) {
 	svc := newTestService()
 	ctx := WithActor(context.Background(), domain.Actor{
 		Username: "admin",
@@ -479,8 +1066,8 @@ func TestRefundRejectsCumulativeOverRefund(t *testing.T) {
 	_, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
 		StoreID:           "main-store",
 		TerminalID:        "terminal-a1",
-		CashierName:       "Kasir A",
-		OpeningFloatCents: 250000,
+		CashierName:       "Kasir Split",
+		OpeningFloatCents: 200000,
 	})
 	if err != nil {
 		t.Fatalf("open shift failed: %v", err)
@@ -489,133 +1076,3985 @@ func TestRefundRejectsCumulativeOverRefund(t *testing.T) {
 	resp, err := svc.Checkout(ctx, domain.CheckoutRequest{
 		StoreID:           "main-store",
 		TerminalID:        "terminal-a1",
-		IdempotencyKey:    "idem-refund-cumulative",
-		PaymentMethod:     "cash",
-		CashReceivedCents: 100000,
+		IdempotencyKey:    "idem-split",
+		PaymentMethod:     "split",
 		TaxRatePercent:    0,
+		CashReceivedCents: 0,
+		PaymentSplits: []domain.PaymentSplit{
+			{Method: "cash", AmountCents: 3000},
+			{Method: "qris", AmountCents: 4000, Reference: "TRX-QRIS-001"},
+		},
 		CartItems: []domain.CartItem{
-			{SKU: "SKU-MIE-01", Qty: 1},
+			{SKU: "SKU-MIE-01", Qty: 2},
 		},
 	})
 	if err != nil {
-		t.Fatalf("checkout failed: %v", err)
+		t.Fatalf("split checkout failed: %v", err)
 	}
-
-	_, err = svc.Refund(ctx, domain.RefundRequest{
-		OriginalTransactionID: resp.TransactionID,
-		Reason:                "partial refund",
-		AmountCents:           2000,
-	})
-	if err != nil {
-		t.Fatalf("first refund failed: %v", err)
+	if resp.PaymentMethod != "split" {
+		t.Fatalf("expected split payment, got %s", resp.PaymentMethod)
 	}
-
-	_, err = svc.Refund(ctx, domain.RefundRequest{
-		OriginalTransactionID: resp.TransactionID,
-		Reason:                "over refund",
-		AmountCents:           2000,
-	})
-	if err == nil {
-		t.Fatalf("expected second refund to fail due cumulative over-refund")
+	if len(resp.PaymentSplits) != 2 {
+		t.Fatalf("expected 2 payment splits, got %d", len(resp.PaymentSplits))
 	}
 }
 
-func TestVoidRejectedForRefundedTransaction(t *testing.T) {
+func TestCheckoutRejectsPaymentMethodNotEnabled(t *testing.T) {
 	svc := newTestService()
-	ctx := WithActor(context.Background(), domain.Actor{
-		Username: "admin",
-		Role:     "admin",
-	})
-
-	_, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	if err := svc.SetPaymentMethods("main-store", []string{"card", "CASH"}); err != nil {
+		t.Fatalf("set payment methods failed: %v", err)
+	}
+	if got, _ := svc.PaymentMethods("main-store"); !slices.Equal(got, []string{"cash", "card"}) {
+		t.Fatalf("expected cash and card, got %v", got)
+	}
+	if got, _ := svc.PaymentMethods("branch-store"); !slices.Equal(got, DefaultPaymentMethods) {
+		t.Fatalf("expected other stores to keep the defaults, got %v", got)
+	}
+	if err := svc.SetPaymentMethods("", []string{"cash", "bitcoin"}); err == nil {
+		t.Fatalf("expected an unknown method to be rejected")
+	}
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
 		StoreID:           "main-store",
 		TerminalID:        "terminal-a1",
 		CashierName:       "Kasir A",
 		OpeningFloatCents: 250000,
-	})
-	if err != nil {
+	}); err != nil {
 		t.Fatalf("open shift failed: %v", err)
 	}
 
-	resp, err := svc.Checkout(ctx, domain.CheckoutRequest{
-		StoreID:           "main-store",
-		TerminalID:        "terminal-a1",
-		IdempotencyKey:    "idem-refund-before-void",
-		PaymentMethod:     "cash",
-		CashReceivedCents: 100000,
-		TaxRatePercent:    0,
-		CartItems: []domain.CartItem{
+	_, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID:          "main-store",
+		TerminalID:       "terminal-a1",
+		IdempotencyKey:   "idem-qris-disabled",
+		PaymentMethod:    "qris",
+		PaymentReference: "TRX-QRIS-001",
+		CartItems:        []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}},
+	})
+	if !errors.Is(err, ErrPaymentMethodNotEnabled) || !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected ErrPaymentMethodNotEnabled, got %v", err)
+	}
+
+	_, err = svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID:        "main-store",
+		TerminalID:     "terminal-a1",
+		IdempotencyKey: "idem-qris-leg-disabled",
+		PaymentSplits: []domain.PaymentSplit{
+			{Method: "cash", AmountCents: 3000},
+			{Method: "qris", AmountCents: 4000, Reference: "TRX-QRIS-002"},
+		},
+		CartItems: []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 2}},
+	})
+	if !errors.Is(err, ErrPaymentMethodNotEnabled) {
+		t.Fatalf("expected the qris leg to be rejected, got %v", err)
+	}
+}
+
+func TestCheckoutSplitPaymentValidatesReferences(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		CashierName:       "Kasir A",
+		OpeningFloatCents: 250000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		splits []domain.PaymentSplit
+		want   error
+	}{
+		{
+			name: "duplicate qris reference",
+			splits: []domain.PaymentSplit{
+				{Method: "qris", AmountCents: 3000, Reference: "TRX-QRIS-DUP"},
+				{Method: "qris", AmountCents: 4000, Reference: "trx-qris-dup"},
+			},
+			want: ErrDuplicatePaymentReference,
+		},
+		{
+			name: "empty ewallet reference",
+			splits: []domain.PaymentSplit{
+				{Method: "cash", AmountCents: 3000},
+				{Method: "ewallet", AmountCents: 4000, Reference: "  "},
+			},
+			want: ErrInvalidPaymentReference,
+		},
+		{
+			name: "malformed card reference",
+			splits: []domain.PaymentSplit{
+				{Method: "cash", AmountCents: 3000},
+				{Method: "card", AmountCents: 4000, Reference: "12"},
+			},
+			want: ErrInvalidPaymentReference,
+		},
+	}
+	for _, tc := range cases {
+		_, err := svc.Checkout(ctx, domain.CheckoutRequest{
+			StoreID:        "main-store",
+			TerminalID:     "terminal-a1",
+			IdempotencyKey: "idem-split-ref-" + tc.name,
+			PaymentSplits:  tc.splits,
+			CartItems:      []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 2}},
+		})
+		if !errors.Is(err, tc.want) || !errors.Is(err, store.ErrInvalidTransaction) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+func TestCheckoutChangeAsStoreCreditAndRedeemInSplit(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		CashierName:       "Kasir A",
+		OpeningFloatCents: 250000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+
+	issued, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		IdempotencyKey:    "idem-credit-issue",
+		PaymentMethod:     "cash",
+		CashReceivedCents: 10000,
+		ChangeAsCredit:    true,
+		StoreCreditCode:   "MEMBER-0812",
+		CartItems:         []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 2}},
+	})
+	if err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+	if issued.ChangeCents != 0 || issued.StoreCreditCents != 3000 || issued.StoreCreditCode != "MEMBER-0812" {
+		t.Fatalf("expected 3000 change kept as credit, got %+v", issued)
+	}
+	balance, err := svc.GetStoreCreditBalance(ctx, "MEMBER-0812")
+	if err != nil || balance.BalanceCents != 3000 {
+		t.Fatalf("expected balance 3000, got %+v err %v", balance, err)
+	}
+
+	redeem := func(key string, creditCents int64) (domain.CheckoutResponse, error) {
+		return svc.Checkout(ctx, domain.CheckoutRequest{
+			StoreID:        "main-store",
+			TerminalID:     "terminal-a1",
+			IdempotencyKey: key,
+			PaymentSplits: []domain.PaymentSplit{
+				{Method: "store_credit", AmountCents: creditCents, Reference: "MEMBER-0812"},
+				{Method: "cash", AmountCents: 7000 - creditCents},
+			},
+			CartItems: []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 2}},
+		})
+	}
+	if _, err := redeem("idem-credit-over", 4000); !errors.Is(err, store.ErrInsufficientStoreCredit) {
+		t.Fatalf("expected insufficient store credit, got %v", err)
+	}
+	spent, err := redeem("idem-credit-redeem", 2500)
+	if err != nil {
+		t.Fatalf("split with store credit failed: %v", err)
+	}
+	if balance, _ := svc.GetStoreCreditBalance(ctx, "MEMBER-0812"); balance.BalanceCents != 500 {
+		t.Fatalf("expected balance 500 after redeeming, got %d", balance.BalanceCents)
+	}
+
+	if _, err := svc.VoidTransaction(ctx, domain.VoidTransactionRequest{TransactionID: spent.TransactionID, Reason: "salah input"}); err != nil {
+		t.Fatalf("void failed: %v", err)
+	}
+	if balance, _ := svc.GetStoreCreditBalance(ctx, "MEMBER-0812"); balance.BalanceCents != 3000 {
+		t.Fatalf("expected void to give the credit back, got %d", balance.BalanceCents)
+	}
+
+	if _, err := svc.RedeemStoreCredit(ctx, "MEMBER-0812", domain.StoreCreditRedeemRequest{AmountCents: 3000}); err != nil {
+		t.Fatalf("redeem failed: %v", err)
+	}
+	if balance, _ := svc.GetStoreCreditBalance(ctx, "MEMBER-0812"); balance.BalanceCents != 0 {
+		t.Fatalf("expected balance 0 after paying out, got %d", balance.BalanceCents)
+	}
+}
+
+func TestListCustomerTransactions(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		CashierName:       "Kasir A",
+		OpeningFloatCents: 250000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+
+	sell := func(key string, customerID string) (domain.CheckoutResponse, error) {
+		return svc.Checkout(ctx, domain.CheckoutRequest{
+			StoreID:           "main-store",
+			TerminalID:        "terminal-a1",
+			IdempotencyKey:    key,
+			PaymentMethod:     "cash",
+			CashReceivedCents: 10000,
+			CustomerID:        customerID,
+			CartItems:         []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 2}},
+		})
+	}
+	first, err := sell("idem-customer-1", " +6281234567890 ")
+	if err != nil {
+		t.Fatalf("first checkout failed: %v", err)
+	}
+	if first.CustomerID != "+6281234567890" {
+		t.Fatalf("expected trimmed customer id, got %q", first.CustomerID)
+	}
+	if _, err := sell("idem-anonymous", ""); err != nil {
+		t.Fatalf("anonymous checkout failed: %v", err)
+	}
+	second, err := sell("idem-customer-2", "+6281234567890")
+	if err != nil {
+		t.Fatalf("second checkout failed: %v", err)
+	}
+	if _, err := svc.VoidTransaction(ctx, domain.VoidTransactionRequest{TransactionID: first.TransactionID, Reason: "batal"}); err != nil {
+		t.Fatalf("void failed: %v", err)
+	}
+	if _, err := sell("idem-customer-bad", "budi santoso"); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected malformed customer id to be rejected, got %v", err)
+	}
+
+	history, err := svc.ListCustomerTransactions(ctx, "+6281234567890", 0)
+	if err != nil {
+		t.Fatalf("list customer transactions failed: %v", err)
+	}
+	if len(history.Transactions) != 2 {
+		t.Fatalf("expected 2 customer transactions, got %d", len(history.Transactions))
+	}
+	if history.Transactions[0].TransactionID != second.TransactionID || history.Transactions[0].ItemCount != 2 {
+		t.Fatalf("expected newest sale first, got %+v", history.Transactions[0])
+	}
+	if history.PaidTotalCents != second.TotalCents {
+		t.Fatalf("expected voided sale left out of the paid total, got %d", history.PaidTotalCents)
+	}
+}
+
+func TestBuildHardwareReceiptPrintsNamesSplitsAndQRCode(t *testing.T) {
+	svc := newTestService()
+	if err := svc.SetReceiptTemplate(domain.ReceiptTemplate{HeaderLines: []string{"Toko Maju"}}); err != nil {
+		t.Fatalf("set receipt template: %v", err)
+	}
+	svc.SetReceiptLookupURL("https://struk.example.com/r/{transaction_id}")
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir Struk", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	tx, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: "idem-receipt",
+		PaymentMethod: "split",
+		PaymentSplits: []domain.PaymentSplit{
+			{Method: "cash", AmountCents: 3000},
+			{Method: "qris", AmountCents: 4000, Reference: "TRX-QRIS-RCPT"},
+		},
+		CartItems: []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 2}},
+	})
+	if err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+
+	receipt, err := svc.BuildHardwareReceipt(ctx, domain.HardwareReceiptRequest{TransactionID: tx.TransactionID})
+	if err != nil {
+		t.Fatalf("build receipt failed: %v", err)
+	}
+	url := "https://struk.example.com/r/" + tx.TransactionID
+	preview := strings.Join(strings.Fields(receipt.PreviewText), " ")
+	for _, want := range []string{"Toko Maju", "Mie Goreng Instan x2 7000", "qris (TRX-QRIS-RCPT) 4000"} {
+		if !strings.Contains(preview, want) {
+			t.Fatalf("expected preview to contain %q, got:\n%s", want, receipt.PreviewText)
+		}
+	}
+	if !strings.Contains(strings.ReplaceAll(receipt.PreviewText, "\n", ""), url) {
+		t.Fatalf("expected preview to print the lookup URL, got:\n%s", receipt.PreviewText)
+	}
+	if strings.Contains(receipt.PreviewText, "KasirinAja POS") {
+		t.Fatalf("expected configured store name to replace the default header")
+	}
+
+	escpos, err := base64.StdEncoding.DecodeString(receipt.EscposBase64)
+	if err != nil {
+		t.Fatalf("decode escpos: %v", err)
+	}
+	storeQR := append([]byte{0x1d, 0x28, 0x6b, byte(len(url) + 3), 0x00, 0x31, 0x50, 0x30}, url...)
+	if !bytes.Contains(escpos, storeQR) {
+		t.Fatalf("expected escpos output to store the lookup URL as a QR code")
+	}
+	if !bytes.HasPrefix(escpos, []byte{0x1b, 0x40}) || !bytes.HasSuffix(escpos, []byte{0x1d, 0x56, 0x41, 0x10}) {
+		t.Fatalf("expected escpos output to keep the init and cut commands")
+	}
+}
+
+func TestBuildHardwareReceiptKeepsNameAsSold(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir Struk", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	tx, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: "idem-receipt-rename",
+		PaymentMethod: "cash", CashReceivedCents: 10000,
+		CartItems: []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}},
+	})
+	if err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+	renamed := "Mie Goreng Jumbo"
+	if _, err := svc.UpdateProduct(ctx, "SKU-MIE-01", domain.ProductUpdateRequest{Name: &renamed}); err != nil {
+		t.Fatalf("rename product failed: %v", err)
+	}
+
+	stored, err := svc.repo.FindTransactionByID(ctx, tx.TransactionID)
+	if err != nil {
+		t.Fatalf("find transaction failed: %v", err)
+	}
+	if stored.Items[0].Name != "Mie Goreng Instan" {
+		t.Fatalf("expected the line to keep the name as sold, got %q", stored.Items[0].Name)
+	}
+	receipt, err := svc.BuildHardwareReceipt(ctx, domain.HardwareReceiptRequest{TransactionID: tx.TransactionID})
+	if err != nil {
+		t.Fatalf("build receipt failed: %v", err)
+	}
+	if !strings.Contains(receipt.PreviewText, "Mie Goreng Instan") || strings.Contains(receipt.PreviewText, renamed) {
+		t.Fatalf("expected the reprint to show the name as sold, got:\n%s", receipt.PreviewText)
+	}
+}
+
+func TestBuildHardwareReceiptRendersTemplate(t *testing.T) {
+	svc := newTestService()
+	err := svc.SetReceiptTemplate(domain.ReceiptTemplate{
+		HeaderLines:             []string{"Toko Maju", " "},
+		FooterLines:             []string{"Jl. Margonda No. 1, Depok", "Terima kasih atas kunjungan Anda"},
+		ShowCashier:             true,
+		ShowTaxBreakdown:        true,
+		HideCashLinesForNonCash: true,
+	})
+	if err != nil {
+		t.Fatalf("set receipt template: %v", err)
+	}
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir Template", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	tx, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: "idem-receipt-template",
+		PaymentMethod: "card", PaymentReference: "CARD-TPL", TaxRatePercent: 11,
+		CartItems: []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 2}},
+	})
+	if err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+
+	receipt, err := svc.BuildHardwareReceipt(ctx, domain.HardwareReceiptRequest{TransactionID: tx.TransactionID})
+	if err != nil {
+		t.Fatalf("build receipt failed: %v", err)
+	}
+	if !strings.HasPrefix(receipt.PreviewText, "Toko Maju\n") {
+		t.Fatalf("expected the header to open the receipt, got:\n%s", receipt.PreviewText)
+	}
+	preview := strings.Join(strings.Fields(receipt.PreviewText), " ")
+	for _, want := range []string{"Kasir: Kasir Template", "DPP 7000", "Pajak 11% 770", "Jl. Margonda No. 1, Depok", "Terima kasih atas kunjungan Anda"} {
+		if !strings.Contains(preview, want) {
+			t.Fatalf("expected preview to contain %q, got:\n%s", want, receipt.PreviewText)
+		}
+	}
+	for _, unwanted := range []string{"Bayar", "Kembali"} {
+		if strings.Contains(receipt.PreviewText, unwanted) {
+			t.Fatalf("expected %q to be hidden for a card sale, got:\n%s", unwanted, receipt.PreviewText)
+		}
+	}
+}
+
+func TestBuildHardwareReceiptLocalizesLabels(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	if err := svc.SetDefaultLanguage("fr"); err == nil {
+		t.Fatal("expected an unsupported default language to be rejected")
+	}
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	tx, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: "idem-receipt-en",
+		PaymentMethod: "cash", CashReceivedCents: 10000,
+		CartItems: []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}},
+	})
+	if err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+
+	preview := func(req domain.HardwareReceiptRequest) string {
+		t.Helper()
+		req.TransactionID = tx.TransactionID
+		receipt, err := svc.BuildHardwareReceipt(ctx, req)
+		if err != nil {
+			t.Fatalf("build receipt failed: %v", err)
+		}
+		return receipt.PreviewText
+	}
+	if text := preview(domain.HardwareReceiptRequest{}); !strings.Contains(text, "Kembali") || !strings.Contains(text, "Terima kasih") {
+		t.Fatalf("expected Indonesian labels by default, got:\n%s", text)
+	}
+	english := preview(domain.HardwareReceiptRequest{Language: "en-GB"})
+	for _, want := range []string{"Discount", "Paid", "Change", "Thank you"} {
+		if !strings.Contains(english, want) {
+			t.Fatalf("expected %q on the English receipt, got:\n%s", want, english)
+		}
+	}
+
+	if err := svc.SetDefaultLanguage("en"); err != nil {
+		t.Fatalf("set default language: %v", err)
+	}
+	if text := preview(domain.HardwareReceiptRequest{Language: "ja"}); !strings.Contains(text, "Change") {
+		t.Fatalf("expected an unsupported language to fall back to the default, got:\n%s", text)
+	}
+}
+
+func TestBuildHardwareReceiptWrapsLongNamesAtNarrowWidth(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	if _, err := svc.CreateProduct(ctx, domain.ProductCreateRequest{
+		StoreID: "main-store", SKU: "SKU-MINYAK-02", Name: "Minyak Goreng Kemasan Premium Pouch 2 Liter",
+		Category: "grocery", PriceCents: 38500, MarginRate: 0.15, InitialStock: 10,
+	}); err != nil {
+		t.Fatalf("create product failed: %v", err)
+	}
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir Sempit", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	tx, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: "idem-receipt-narrow",
+		PaymentMethod: "cash", CashReceivedCents: 100000,
+		CartItems: []domain.CartItem{{SKU: "SKU-MINYAK-02", Qty: 2}},
+	})
+	if err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+
+	receipt, err := svc.BuildHardwareReceipt(ctx, domain.HardwareReceiptRequest{TransactionID: tx.TransactionID, PrinterWidth: 32})
+	if err != nil {
+		t.Fatalf("build receipt failed: %v", err)
+	}
+	lines := strings.Split(receipt.PreviewText, "\n")
+	for _, line := range lines {
+		if len([]rune(line)) > 32 {
+			t.Fatalf("line %q is wider than 32 columns", line)
+		}
+	}
+	nameAt := -1
+	for i, line := range lines {
+		if line == "Minyak Goreng Kemasan Premium" {
+			nameAt = i
+		}
+	}
+	if nameAt < 0 || lines[nameAt+1] != "Pouch 2 Liter"+strings.Repeat(" ", 11)+"x2 77000" {
+		t.Fatalf("expected the product name to wrap onto a second line with the price right-aligned, got:\n%s", receipt.PreviewText)
+	}
+	if !slices.Contains(lines, strings.Repeat("=", 32)) || slices.Contains(lines, strings.Repeat("=", 48)) {
+		t.Fatalf("expected separators to match the 32 column width, got:\n%s", receipt.PreviewText)
+	}
+	if !slices.Contains(lines, "Total"+strings.Repeat(" ", 22)+"77000") {
+		t.Fatalf("expected totals to be right-aligned at 32 columns, got:\n%s", receipt.PreviewText)
+	}
+
+	if _, err := svc.BuildHardwareReceipt(ctx, domain.HardwareReceiptRequest{TransactionID: tx.TransactionID, PrinterWidth: 40}); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected unsupported printer width to be rejected, got %v", err)
+	}
+}
+
+func TestBuildKitchenTicketListsKitchenItemsWithoutPrices(t *testing.T) {
+	svc := newTestService()
+	svc.SetKitchenCategories([]string{"Bakery", "beverage"})
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir Dapur", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	tx, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: "idem-kitchen",
+		PaymentMethod: "cash", CashReceivedCents: 100000,
+		CartItems: []domain.CartItem{
+			{SKU: "SKU-ROTI-01", Qty: 1},
+			{SKU: "SKU-KOPI-01", Qty: 3},
+			{SKU: "SKU-SABUN-01", Qty: 1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+
+	ticket, err := svc.BuildKitchenTicket(ctx, domain.HardwareReceiptRequest{TransactionID: tx.TransactionID})
+	if err != nil {
+		t.Fatalf("build kitchen ticket failed: %v", err)
+	}
+	preview := ticket.PreviewText
+	bakery, beverage := strings.Index(preview, "BAKERY"), strings.Index(preview, "BEVERAGE")
+	if bakery < 0 || beverage < bakery {
+		t.Fatalf("expected items grouped by station, got:\n%s", preview)
+	}
+	if !strings.Contains(preview, "1x Roti Tawar") || !strings.Contains(preview, "3x Kopi Sachet") {
+		t.Fatalf("expected kitchen items with quantities, got:\n%s", preview)
+	}
+	for _, unwanted := range []string{"Sabun Mandi", "17800", "Total"} {
+		if strings.Contains(preview, unwanted) {
+			t.Fatalf("expected %q to be left off the kitchen ticket, got:\n%s", unwanted, preview)
+		}
+	}
+
+	escpos, err := base64.StdEncoding.DecodeString(ticket.EscposBase64)
+	if err != nil {
+		t.Fatalf("decode escpos: %v", err)
+	}
+	if !bytes.HasPrefix(escpos, append([]byte{0x1b, 0x40, 0x1d, 0x21, 0x11}, tx.TransactionID[:24]...)) {
+		t.Fatalf("expected the transaction ID to open the ticket in large print")
+	}
+	if !bytes.HasSuffix(escpos, []byte{0x1d, 0x56, 0x41, 0x10}) {
+		t.Fatalf("expected the ticket to end with a cut")
+	}
+
+	svc.SetKitchenCategories([]string{"frozen"})
+	if _, err := svc.BuildKitchenTicket(ctx, domain.HardwareReceiptRequest{TransactionID: tx.TransactionID}); !errors.Is(err, ErrNoKitchenItems) {
+		t.Fatalf("expected ErrNoKitchenItems without kitchen items, got %v", err)
+	}
+}
+
+func TestSetReceiptTemplateRejectsInvalidTemplates(t *testing.T) {
+	svc := newTestService()
+	cases := map[string]domain.ReceiptTemplate{
+		"empty header":   {HeaderLines: []string{"  "}},
+		"wide line":      {HeaderLines: []string{strings.Repeat("x", 49)}},
+		"control bytes":  {HeaderLines: []string{"Toko"}, FooterLines: []string{"\x1b@"}},
+		"too many lines": {HeaderLines: []string{"1", "2", "3", "4", "5", "6", "7", "8", "9"}},
+	}
+	for name, template := range cases {
+		if err := svc.SetReceiptTemplate(template); err == nil {
+			t.Fatalf("%s: expected template to be rejected", name)
+		}
+	}
+}
+
+func TestHoldAndResumeCart(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{
+		Username: "cashier",
+		Role:     "cashier",
+	})
+
+	held, err := svc.HoldCart(ctx, domain.HoldCartRequest{
+		StoreID:        "main-store",
+		TerminalID:     "terminal-a1",
+		Note:           "customer ambil dompet",
+		PaymentMethod:  "cash",
+		DiscountCents:  0,
+		TaxRatePercent: 11,
+		CartItems: []domain.CartItem{
 			{SKU: "SKU-MIE-01", Qty: 1},
+			{SKU: "SKU-TELUR-01", Qty: 1},
 		},
 	})
+	if err != nil {
+		t.Fatalf("hold cart failed: %v", err)
+	}
+
+	list, err := svc.ListHeldCarts(ctx, "main-store", "terminal-a1")
+	if err != nil {
+		t.Fatalf("list held carts failed: %v", err)
+	}
+	if len(list.Items) != 1 {
+		t.Fatalf("expected 1 held cart, got %d", len(list.Items))
+	}
+
+	resumed, err := svc.ResumeHeldCart(ctx, held.HeldCart.ID)
+	if err != nil {
+		t.Fatalf("resume held cart failed: %v", err)
+	}
+	if len(resumed.HeldCart.CartItems) != 2 {
+		t.Fatalf("expected resumed cart with 2 items")
+	}
+
+	afterResume, err := svc.ListHeldCarts(ctx, "main-store", "terminal-a1")
+	if err != nil {
+		t.Fatalf("list after resume failed: %v", err)
+	}
+	if len(afterResume.Items) != 0 {
+		t.Fatalf("expected held carts to be empty after resume")
+	}
+}
+
+func TestProcurementReceiveAndReorderSuggestions(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{
+		Username: "admin",
+		Role:     "admin",
+	})
+
+	_, err := svc.StockOpname(ctx, domain.StockOpnameRequest{
+		StoreID: "main-store",
+		Notes:   "set low stock",
+		Items: []domain.StockOpnameItem{
+			{SKU: "SKU-MIE-01", CountedQty: 5},
+		},
+	})
+	if err != nil {
+		t.Fatalf("stock opname failed: %v", err)
+	}
+
+	supplier, err := svc.CreateSupplier(ctx, domain.SupplierCreateRequest{
+		Name:  "Supplier Test",
+		Phone: "08123456789",
+	})
+	if err != nil {
+		t.Fatalf("create supplier failed: %v", err)
+	}
+
+	poResp, err := svc.CreatePurchaseOrder(ctx, domain.PurchaseOrderCreateRequest{
+		StoreID:    "main-store",
+		SupplierID: supplier.ID,
+		Items: []domain.PurchaseOrderItem{
+			{SKU: "SKU-MIE-01", Qty: 20, CostCents: 2000},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create purchase order failed: %v", err)
+	}
+
+	received, err := svc.ReceivePurchaseOrder(ctx, poResp.PurchaseOrder.ID, domain.PurchaseOrderReceiveRequest{
+		ReceivedBy: "manager-a",
+	})
+	if err != nil {
+		t.Fatalf("receive purchase order failed: %v", err)
+	}
+	if received.PurchaseOrder.Status != "received" {
+		t.Fatalf("expected PO status received, got %s", received.PurchaseOrder.Status)
+	}
+	if received.PurchaseOrder.ReceivedBy != "manager-a" {
+		t.Fatalf("expected received_by manager-a, got %s", received.PurchaseOrder.ReceivedBy)
+	}
+
+	suggestions, err := svc.ReorderSuggestions(ctx, "main-store")
+	if err != nil {
+		t.Fatalf("reorder suggestions failed: %v", err)
+	}
+
+	found := false
+	for _, item := range suggestions.Suggestions {
+		if item.SKU == "SKU-MIE-01" {
+			found = true
+			if item.CurrentStock != 25 {
+				t.Fatalf("expected current stock 25 after receive, got %d", item.CurrentStock)
+			}
+			if item.LastCostCents != 2000 {
+				t.Fatalf("expected last cost 2000, got %d", item.LastCostCents)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("expected reorder suggestion for SKU-MIE-01")
+	}
+}
+
+func TestCreatePurchaseOrdersFromReorderGroupsBySupplier(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{
+		Username: "admin",
+		Role:     "admin",
+	})
+
+	_, err := svc.StockOpname(ctx, domain.StockOpnameRequest{
+		StoreID: "main-store",
+		Notes:   "set low stock",
+		Items: []domain.StockOpnameItem{
+			{SKU: "SKU-MIE-01", CountedQty: 5},
+			{SKU: "SKU-SUSU-01", CountedQty: 3},
+			{SKU: "SKU-KOPI-01", CountedQty: 2},
+		},
+	})
+	if err != nil {
+		t.Fatalf("stock opname failed: %v", err)
+	}
+	suggestions, err := svc.ReorderSuggestions(ctx, "main-store")
+	if err != nil {
+		t.Fatalf("reorder suggestions failed: %v", err)
+	}
+	suggested := map[string]domain.ReorderSuggestion{}
+	for _, suggestion := range suggestions.Suggestions {
+		suggested[suggestion.SKU] = suggestion
+	}
+
+	if _, err := svc.CreatePurchaseOrdersFromReorder(ctx, domain.PurchaseOrdersFromReorderRequest{}); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected missing mapping to fail with ErrInvalidTransaction, got %v", err)
+	}
+	if _, err := svc.CreatePurchaseOrdersFromReorder(ctx, domain.PurchaseOrdersFromReorderRequest{
+		SupplierIDBySKU: map[string]string{"SKU-MIE-01": "sup-missing"},
+	}); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected unknown supplier to fail with ErrNotFound, got %v", err)
+	}
+
+	supplierA, err := svc.CreateSupplier(ctx, domain.SupplierCreateRequest{Name: "Supplier A"})
+	if err != nil {
+		t.Fatalf("create supplier failed: %v", err)
+	}
+	supplierB, err := svc.CreateSupplier(ctx, domain.SupplierCreateRequest{Name: "Supplier B"})
+	if err != nil {
+		t.Fatalf("create supplier failed: %v", err)
+	}
+
+	resp, err := svc.CreatePurchaseOrdersFromReorder(ctx, domain.PurchaseOrdersFromReorderRequest{
+		StoreID:                     "main-store",
+		SupplierIDBySKU:             map[string]string{"sku-mie-01": supplierA.ID},
+		DefaultSupplierIDByCategory: map[string]string{"Dairy": supplierB.ID},
+	})
+	if err != nil {
+		t.Fatalf("create purchase orders from reorder failed: %v", err)
+	}
+	if len(resp.PurchaseOrderIDs) != 2 {
+		t.Fatalf("expected one PO per supplier, got %v", resp.PurchaseOrderIDs)
+	}
+	if !slices.Contains(resp.UnmappedSKUs, "SKU-KOPI-01") {
+		t.Fatalf("expected SKU-KOPI-01 to be reported unmapped, got %v", resp.UnmappedSKUs)
+	}
+
+	supplierBySKU := map[string]string{}
+	for _, id := range resp.PurchaseOrderIDs {
+		po, err := svc.repo.GetPurchaseOrderByID(ctx, id)
+		if err != nil {
+			t.Fatalf("get purchase order %s failed: %v", id, err)
+		}
+		if po.Status != "draft" {
+			t.Fatalf("expected draft PO, got %s", po.Status)
+		}
+		for _, item := range po.Items {
+			supplierBySKU[item.SKU] = po.SupplierID
+			want := suggested[item.SKU]
+			if item.Qty != want.RecommendedQty || item.CostCents != want.LastCostCents {
+				t.Fatalf("expected %s qty %d cost %d, got %+v", item.SKU, want.RecommendedQty, want.LastCostCents, item)
+			}
+		}
+	}
+	if supplierBySKU["SKU-MIE-01"] != supplierA.ID || supplierBySKU["SKU-SUSU-01"] != supplierB.ID {
+		t.Fatalf("unexpected supplier assignment: %v", supplierBySKU)
+	}
+	if _, ok := supplierBySKU["SKU-KOPI-01"]; ok {
+		t.Fatalf("unmapped SKU should not be ordered")
+	}
+}
+
+func TestReorderSuggestionsUseSalesVelocityAndLeadTime(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{
+		Username: "admin",
+		Role:     "admin",
+	})
+
+	if _, err := svc.StockOpname(ctx, domain.StockOpnameRequest{
+		StoreID: "main-store",
+		Items:   []domain.StockOpnameItem{{SKU: "SKU-TEH-01", CountedQty: 100}},
+	}); err != nil {
+		t.Fatalf("stock opname failed: %v", err)
+	}
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		CashierName:       "Kasir A",
+		OpeningFloatCents: 250000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	if _, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID:          "main-store",
+		TerminalID:       "terminal-a1",
+		IdempotencyKey:   "idem-velocity",
+		PaymentMethod:    "card",
+		PaymentReference: "CARD-REF-VEL",
+		ManualOverride:   true,
+		CartItems:        []domain.CartItem{{SKU: "SKU-TEH-01", Qty: 45}},
+	}); err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+
+	supplier, err := svc.CreateSupplier(ctx, domain.SupplierCreateRequest{Name: "Supplier Teh"})
+	if err != nil {
+		t.Fatalf("create supplier failed: %v", err)
+	}
+	if _, err := svc.SetSupplierProduct(ctx, supplier.ID, domain.SupplierProductSetRequest{SKU: "SKU-TEH-01", LeadTimeDays: 13}); err != nil {
+		t.Fatalf("set supplier product failed: %v", err)
+	}
+	if _, err := svc.StockOpname(ctx, domain.StockOpnameRequest{
+		StoreID: "main-store",
+		Items: []domain.StockOpnameItem{
+			{SKU: "SKU-TEH-01", CountedQty: 4},
+			{SKU: "SKU-MIE-01", CountedQty: 5},
+		},
+	}); err != nil {
+		t.Fatalf("stock opname failed: %v", err)
+	}
+
+	resp, err := svc.ReorderSuggestions(ctx, "main-store")
+	if err != nil {
+		t.Fatalf("reorder suggestions failed: %v", err)
+	}
+	suggested := map[string]domain.ReorderSuggestion{}
+	for _, suggestion := range resp.Suggestions {
+		suggested[suggestion.SKU] = suggestion
+	}
+
+	// 45 units over 30 days is 1.5/day; (13 lead + 7 safety) days need 30.
+	teh := suggested["SKU-TEH-01"]
+	if teh.Basis != domain.ReorderBasisVelocity || teh.LeadTimeDays != 13 || teh.VelocityPerDay != 1.5 {
+		t.Fatalf("expected velocity-based suggestion, got %+v", teh)
+	}
+	if teh.RecommendedQty != 26 {
+		t.Fatalf("expected recommended qty 26, got %d", teh.RecommendedQty)
+	}
+
+	mie := suggested["SKU-MIE-01"]
+	if mie.Basis != domain.ReorderBasisReorderPoint || mie.RecommendedQty != mie.ReorderPoint*2-5 {
+		t.Fatalf("expected reorder point fallback without sales, got %+v", mie)
+	}
+}
+
+func TestSupplierCatalogDrivesReorderPurchaseOrders(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{
+		Username: "admin",
+		Role:     "admin",
+	})
+
+	cheap, err := svc.CreateSupplier(ctx, domain.SupplierCreateRequest{Name: "Grosir Murah"})
+	if err != nil {
+		t.Fatalf("create supplier failed: %v", err)
+	}
+	pricey, err := svc.CreateSupplier(ctx, domain.SupplierCreateRequest{Name: "Grosir Cepat"})
+	if err != nil {
+		t.Fatalf("create supplier failed: %v", err)
+	}
+
+	newName := "Grosir Murah Jaya"
+	newPhone := " 0811 "
+	updated, err := svc.UpdateSupplier(ctx, cheap.ID, domain.SupplierUpdateRequest{Name: &newName, Phone: &newPhone})
+	if err != nil {
+		t.Fatalf("update supplier failed: %v", err)
+	}
+	if updated.Name != newName || updated.Phone != "0811" || !updated.CreatedAt.Equal(cheap.CreatedAt) {
+		t.Fatalf("unexpected updated supplier: %+v", updated)
+	}
+	if _, err := svc.UpdateSupplier(ctx, "sup-missing", domain.SupplierUpdateRequest{Name: &newName}); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for unknown supplier, got %v", err)
+	}
+
+	_, err = svc.SetSupplierProduct(ctx, cheap.ID, domain.SupplierProductSetRequest{SKU: "SKU-NOPE"})
+	var skuErr *store.SKUError
+	if !errors.As(err, &skuErr) || skuErr.SKU != "SKU-NOPE" || !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected SKUError for unknown sku, got %v", err)
+	}
+	if _, err := svc.SetSupplierProduct(ctx, cheap.ID, domain.SupplierProductSetRequest{SKU: "SKU-MIE-01", LeadTimeDays: -1}); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected negative lead time to be rejected, got %v", err)
+	}
+
+	if _, err := svc.SetSupplierProduct(ctx, cheap.ID, domain.SupplierProductSetRequest{SKU: "sku-mie-01", DefaultCostCents: 2500, LeadTimeDays: 7}); err != nil {
+		t.Fatalf("set supplier product failed: %v", err)
+	}
+	if _, err := svc.SetSupplierProduct(ctx, cheap.ID, domain.SupplierProductSetRequest{SKU: "SKU-MIE-01", DefaultCostCents: 2400, LeadTimeDays: 5}); err != nil {
+		t.Fatalf("overwrite supplier product failed: %v", err)
+	}
+	if _, err := svc.SetSupplierProduct(ctx, pricey.ID, domain.SupplierProductSetRequest{SKU: "SKU-MIE-01", DefaultCostCents: 2900, LeadTimeDays: 1}); err != nil {
+		t.Fatalf("set supplier product failed: %v", err)
+	}
+
+	list, err := svc.ListSupplierProducts(ctx, cheap.ID)
+	if err != nil {
+		t.Fatalf("list supplier products failed: %v", err)
+	}
+	if len(list.Products) != 1 || list.Products[0].DefaultCostCents != 2400 || list.Products[0].LeadTimeDays != 5 {
+		t.Fatalf("expected one overwritten catalog entry, got %+v", list.Products)
+	}
+
+	if _, err := svc.StockOpname(ctx, domain.StockOpnameRequest{
+		StoreID: "main-store",
+		Items:   []domain.StockOpnameItem{{SKU: "SKU-MIE-01", CountedQty: 5}},
+	}); err != nil {
+		t.Fatalf("stock opname failed: %v", err)
+	}
+	resp, err := svc.CreatePurchaseOrdersFromReorder(ctx, domain.PurchaseOrdersFromReorderRequest{StoreID: "main-store"})
+	if err != nil {
+		t.Fatalf("create purchase orders from reorder failed: %v", err)
+	}
+	if len(resp.PurchaseOrderIDs) != 1 {
+		t.Fatalf("expected a single PO from the catalog, got %v", resp.PurchaseOrderIDs)
+	}
+	po, err := svc.repo.GetPurchaseOrderByID(ctx, resp.PurchaseOrderIDs[0])
+	if err != nil {
+		t.Fatalf("get purchase order failed: %v", err)
+	}
+	if po.SupplierID != cheap.ID || len(po.Items) != 1 || po.Items[0].CostCents != 2400 {
+		t.Fatalf("expected cheapest supplier with catalog cost, got %+v", po)
+	}
+}
+
+func TestCancelPurchaseOrderRejectsReceivedAndCancelled(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{
+		Username: "admin",
+		Role:     "admin",
+	})
+
+	supplier, err := svc.CreateSupplier(ctx, domain.SupplierCreateRequest{Name: "Supplier Cancel"})
+	if err != nil {
+		t.Fatalf("create supplier failed: %v", err)
+	}
+	createPO := func() string {
+		t.Helper()
+		resp, err := svc.CreatePurchaseOrder(ctx, domain.PurchaseOrderCreateRequest{
+			StoreID:    "main-store",
+			SupplierID: supplier.ID,
+			Items: []domain.PurchaseOrderItem{
+				{SKU: "SKU-MIE-01", Qty: 10, CostCents: 2000},
+			},
+		})
+		if err != nil {
+			t.Fatalf("create purchase order failed: %v", err)
+		}
+		return resp.PurchaseOrder.ID
+	}
+
+	draftID := createPO()
+	cancelled, err := svc.CancelPurchaseOrder(ctx, draftID, domain.PurchaseOrderCancelRequest{Reason: " supplier out of stock "})
+	if err != nil {
+		t.Fatalf("cancel purchase order failed: %v", err)
+	}
+	po := cancelled.PurchaseOrder
+	if po.Status != "cancelled" || po.CancelledBy != "admin" || po.CancelReason != "supplier out of stock" || po.CancelledAt == nil {
+		t.Fatalf("unexpected cancelled purchase order: %+v", po)
+	}
+
+	if _, err := svc.CancelPurchaseOrder(ctx, draftID, domain.PurchaseOrderCancelRequest{}); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected second cancel to fail with ErrInvalidTransaction, got %v", err)
+	}
+	if _, err := svc.ReceivePurchaseOrder(ctx, draftID, domain.PurchaseOrderReceiveRequest{}); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected receive of cancelled PO to fail, got %v", err)
+	}
+
+	receivedID := createPO()
+	if _, err := svc.ReceivePurchaseOrder(ctx, receivedID, domain.PurchaseOrderReceiveRequest{}); err != nil {
+		t.Fatalf("receive purchase order failed: %v", err)
+	}
+	if _, err := svc.CancelPurchaseOrder(ctx, receivedID, domain.PurchaseOrderCancelRequest{}); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected cancel of received PO to fail, got %v", err)
+	}
+
+	if _, err := svc.CancelPurchaseOrder(ctx, "po-missing", domain.PurchaseOrderCancelRequest{}); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for missing PO, got %v", err)
+	}
+
+	cashierCtx := WithActor(context.Background(), domain.Actor{Username: "kasir", Role: "cashier"})
+	if _, err := svc.CancelPurchaseOrder(cashierCtx, createPO(), domain.PurchaseOrderCancelRequest{}); err == nil {
+		t.Fatalf("expected cashier cancel to be rejected")
+	}
+}
+
+func TestDetectOperationalAnomalies(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{
+		Username: "admin",
+		Role:     "admin",
+	})
+
+	_, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		CashierName:       "Kasir A",
+		OpeningFloatCents: 250000,
+	})
+	if err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		resp, checkoutErr := svc.Checkout(ctx, domain.CheckoutRequest{
+			StoreID:           "main-store",
+			TerminalID:        "terminal-a1",
+			IdempotencyKey:    "idem-anom-" + strconv.Itoa(i),
+			PaymentMethod:     "cash",
+			CashReceivedCents: 100000,
+			CartItems: []domain.CartItem{
+				{SKU: "SKU-MIE-01", Qty: 1},
+			},
+		})
+		if checkoutErr != nil {
+			t.Fatalf("checkout #%d failed: %v", i, checkoutErr)
+		}
+		_, voidErr := svc.VoidTransaction(ctx, domain.VoidTransactionRequest{
+			TransactionID: resp.TransactionID,
+			Reason:        "void test",
+		})
+		if voidErr != nil {
+			t.Fatalf("void #%d failed: %v", i, voidErr)
+		}
+	}
+
+	alerts, err := svc.DetectOperationalAnomalies(ctx, "main-store", time.Now().UTC().Format("2006-01-02"))
+	if err != nil {
+		t.Fatalf("detect anomalies failed: %v", err)
+	}
+
+	foundVoidSpike := false
+	for _, alert := range alerts.Alerts {
+		if alert.Code == "void_spike" {
+			foundVoidSpike = true
+			break
+		}
+	}
+	if !foundVoidSpike {
+		t.Fatalf("expected void_spike anomaly to be detected")
+	}
+}
+
+func TestRefundRejectsCumulativeOverRefund(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{
+		Username: "admin",
+		Role:     "admin",
+	})
+
+	_, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		CashierName:       "Kasir A",
+		OpeningFloatCents: 250000,
+	})
+	if err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+
+	resp, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		IdempotencyKey:    "idem-refund-cumulative",
+		PaymentMethod:     "cash",
+		CashReceivedCents: 100000,
+		TaxRatePercent:    0,
+		CartItems: []domain.CartItem{
+			{SKU: "SKU-MIE-01", Qty: 1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+
+	_, err = svc.Refund(ctx, domain.RefundRequest{
+		OriginalTransactionID: resp.TransactionID,
+		Reason:                "partial refund",
+		AmountCents:           2000,
+	})
+	if err != nil {
+		t.Fatalf("first refund failed: %v", err)
+	}
+
+	_, err = svc.Refund(ctx, domain.RefundRequest{
+		OriginalTransactionID: resp.TransactionID,
+		Reason:                "over refund",
+		AmountCents:           2000,
+	})
+	if err == nil {
+		t.Fatalf("expected second refund to fail due cumulative over-refund")
+	}
+}
+
+func TestVoidRestocksAtSoldCost(t *testing.T) {
+	svc := newTestService()
+	ctx := context.Background()
+
+	if err := svc.repo.UpsertProductCost(ctx, "main-store", "SKU-MIE-01", 2500); err != nil {
+		t.Fatalf("upsert cost failed: %v", err)
+	}
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		CashierName:       "Kasir A",
+		OpeningFloatCents: 250000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	resp, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		IdempotencyKey:    "idem-void-cost",
+		PaymentMethod:     "cash",
+		CashReceivedCents: 100000,
+		CartItems:         []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 3}},
+	})
+	if err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+	if _, err := svc.VoidTransaction(ctx, domain.VoidTransactionRequest{
+		TransactionID: resp.TransactionID,
+		Reason:        "wrong scan",
+	}); err != nil {
+		t.Fatalf("void failed: %v", err)
+	}
+
+	costs, err := svc.repo.GetProductCosts(ctx, "main-store", []string{"SKU-MIE-01"})
+	if err != nil {
+		t.Fatalf("get costs failed: %v", err)
+	}
+	if costs["SKU-MIE-01"] != 2500 {
+		t.Fatalf("expected the cost to stay 2500 after the void, got %d", costs["SKU-MIE-01"])
+	}
+	lots, err := svc.repo.ListInventoryLots(ctx, "main-store", "SKU-MIE-01", false, 10)
+	if err != nil {
+		t.Fatalf("list lots failed: %v", err)
+	}
+	found := false
+	for _, lot := range lots {
+		if lot.SourceType == "void" {
+			found = true
+			if lot.CostCents != 2500 || lot.QtyAvailable != 3 {
+				t.Fatalf("expected the void lot to hold 3 at 2500, got %+v", lot)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("expected a void restock lot, got %+v", lots)
+	}
+}
+
+func TestRefundWindow(t *testing.T) {
+	svc := newTestService()
+	svc.SetRefundWindowDays(30)
+	admin := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	sold := func(id string, age time.Duration) {
+		t.Helper()
+		if _, err := svc.repo.CreateCheckout(admin, domain.Transaction{
+			ID:                id,
+			StoreID:           "main-store",
+			TerminalID:        "terminal-a1",
+			IdempotencyKey:    "idem-" + id,
+			PaymentMethod:     "cash",
+			CashReceivedCents: 100000,
+			Status:            domain.TxStatusPaid,
+			Items:             []domain.TransactionLine{{SKU: "SKU-ROTI-01", Qty: 2}},
+			CreatedAt:         time.Now().UTC().Add(-age),
+		}); err != nil {
+			t.Fatalf("create transaction %s failed: %v", id, err)
+		}
+	}
+	sold("tx-recent", 29*24*time.Hour)
+	sold("tx-old", 31*24*time.Hour)
+
+	if _, err := svc.Refund(admin, domain.RefundRequest{OriginalTransactionID: "tx-recent", Reason: "rusak", AmountCents: 1000}); err != nil {
+		t.Fatalf("expected a refund inside the window, got %v", err)
+	}
+
+	_, err := svc.Refund(admin, domain.RefundRequest{OriginalTransactionID: "tx-old", Reason: "rusak", AmountCents: 1000})
+	if !errors.Is(err, ErrRefundWindowExpired) {
+		t.Fatalf("expected ErrRefundWindowExpired, got %v", err)
+	}
+	_, err = svc.ProcessItemReturn(admin, domain.ItemReturnRequest{
+		OriginalTransactionID: "tx-old",
+		ReturnItems:           []domain.ItemReturnLine{{SKU: "SKU-ROTI-01", Qty: 1}},
+	})
+	if !errors.Is(err, ErrRefundWindowExpired) {
+		t.Fatalf("expected item returns to honor the window, got %v", err)
+	}
+
+	override := domain.RefundRequest{OriginalTransactionID: "tx-old", Reason: "rusak", AmountCents: 1000, OverrideRefundWindow: true}
+	if _, err := svc.Refund(admin, override); !errors.Is(err, store.ErrInvalidTransaction) || errors.Is(err, ErrRefundWindowExpired) {
+		t.Fatalf("expected an override without a note to be rejected, got %v", err)
+	}
+	cashier := WithActor(context.Background(), domain.Actor{Username: "cashier", Role: "cashier"})
+	override.OverrideNote = "struk hilang, disetujui manajer"
+	if _, err := svc.Refund(cashier, override); err == nil {
+		t.Fatalf("expected a cashier override to be rejected")
+	}
+	if _, err := svc.Refund(admin, override); err != nil {
+		t.Fatalf("expected the override to refund, got %v", err)
+	}
+	page, err := svc.ListAuditLogPage(admin, "main-store", "", domain.AuditLogFilter{Actions: []string{"refund_window_override"}}, "", 10)
+	if err != nil {
+		t.Fatalf("list audit logs failed: %v", err)
+	}
+	if len(page.Logs) != 1 || page.Logs[0].EntityID != "tx-old" || !strings.Contains(page.Logs[0].Detail, override.OverrideNote) {
+		t.Fatalf("expected the override to be audited with its note, got %+v", page.Logs)
+	}
+}
+
+func TestDailyVoidAndRefundCaps(t *testing.T) {
+	svc := newTestService()
+	svc.SetDailyCaps(1, 5000)
+	admin := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	cashier := WithActor(context.Background(), domain.Actor{Username: "cashier", Role: "cashier"})
+
+	for _, id := range []string{"tx-1", "tx-2", "tx-3", "tx-4"} {
+		if _, err := svc.repo.CreateCheckout(admin, domain.Transaction{
+			ID:                id,
+			StoreID:           "main-store",
+			TerminalID:        "terminal-a1",
+			IdempotencyKey:    "idem-" + id,
+			PaymentMethod:     "cash",
+			CashReceivedCents: 100000,
+			Status:            domain.TxStatusPaid,
+			Items:             []domain.TransactionLine{{SKU: "SKU-ROTI-01", Qty: 2}},
+			CreatedAt:         time.Now().UTC(),
+		}); err != nil {
+			t.Fatalf("create transaction %s failed: %v", id, err)
+		}
+	}
+
+	if _, err := svc.VoidTransaction(cashier, domain.VoidTransactionRequest{TransactionID: "tx-1", Reason: "salah input"}); err != nil {
+		t.Fatalf("expected the first void to pass, got %v", err)
+	}
+	if _, err := svc.VoidTransaction(cashier, domain.VoidTransactionRequest{TransactionID: "tx-2", Reason: "salah input"}); !errors.Is(err, ErrDailyCapExceeded) {
+		t.Fatalf("expected the second void to hit the cap, got %v", err)
+	}
+	if _, err := svc.VoidTransaction(admin, domain.VoidTransactionRequest{TransactionID: "tx-2", Reason: "salah input"}); err != nil {
+		t.Fatalf("expected the cap to count per user, got %v", err)
+	}
+	if _, err := svc.VoidTransaction(cashier, domain.VoidTransactionRequest{TransactionID: "tx-3", Reason: "salah input", OverrideDailyCap: true}); err == nil {
+		t.Fatalf("expected a cashier override to be rejected")
+	}
+
+	if _, err := svc.Refund(cashier, domain.RefundRequest{OriginalTransactionID: "tx-4", Reason: "rusak", AmountCents: 3000}); err != nil {
+		t.Fatalf("expected a refund under the cap, got %v", err)
+	}
+	if _, err := svc.Refund(cashier, domain.RefundRequest{OriginalTransactionID: "tx-4", Reason: "rusak", AmountCents: 3000}); !errors.Is(err, ErrDailyCapExceeded) {
+		t.Fatalf("expected the refund total to hit the cap, got %v", err)
+	}
+
+	override := WithActor(context.Background(), domain.Actor{Username: "cashier", Role: "admin"})
+	if _, err := svc.Refund(override, domain.RefundRequest{OriginalTransactionID: "tx-4", Reason: "rusak", AmountCents: 3000, OverrideDailyCap: true}); err != nil {
+		t.Fatalf("expected the override to refund, got %v", err)
+	}
+	page, err := svc.ListAuditLogPage(admin, "main-store", "", domain.AuditLogFilter{Actions: []string{"daily_cap_override"}}, "", 10)
+	if err != nil {
+		t.Fatalf("list audit logs failed: %v", err)
+	}
+	if len(page.Logs) != 1 || page.Logs[0].EntityID != "tx-4" || !strings.Contains(page.Logs[0].Detail, "severity=high") {
+		t.Fatalf("expected one high-severity override entry, got %+v", page.Logs)
+	}
+}
+
+// slowRefundRepo delays refunds so concurrent callers overlap between the
+// daily cap check and the audit entry it reads.
+type slowRefundRepo struct {
+	store.Repository
+}
+
+func (r slowRefundRepo) CreateRefund(ctx context.Context, refund domain.Refund) (*domain.Refund, error) {
+	time.Sleep(20 * time.Millisecond)
+	return r.Repository.CreateRefund(ctx, refund)
+}
+
+func TestDailyRefundCapHoldsUnderConcurrentRefunds(t *testing.T) {
+	svc := newTestService()
+	svc.repo = slowRefundRepo{Repository: svc.repo}
+	svc.SetDailyCaps(0, 5000)
+	admin := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	cashier := WithActor(context.Background(), domain.Actor{Username: "cashier", Role: "cashier"})
+
+	const refunds = 8
+	for i := range refunds {
+		id := "tx-cap-" + strconv.Itoa(i)
+		if _, err := svc.repo.CreateCheckout(admin, domain.Transaction{
+			ID:                id,
+			StoreID:           "main-store",
+			TerminalID:        "terminal-a1",
+			IdempotencyKey:    "idem-" + id,
+			PaymentMethod:     "cash",
+			CashReceivedCents: 100000,
+			Status:            domain.TxStatusPaid,
+			Items:             []domain.TransactionLine{{SKU: "SKU-ROTI-01", Qty: 2}},
+			CreatedAt:         time.Now().UTC(),
+		}); err != nil {
+			t.Fatalf("create transaction %s failed: %v", id, err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, refunds)
+	for i := range refunds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.Refund(cashier, domain.RefundRequest{OriginalTransactionID: "tx-cap-" + strconv.Itoa(i), Reason: "rusak", AmountCents: 3000})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	passed := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			passed++
+		case !errors.Is(err, ErrDailyCapExceeded):
+			t.Fatalf("expected ErrDailyCapExceeded, got %v", err)
+		}
+	}
+	if passed != 1 {
+		t.Fatalf("expected exactly one refund under the 5000 cap, got %d", passed)
+	}
+}
+
+func TestVoidRejectedForRefundedTransaction(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{
+		Username: "admin",
+		Role:     "admin",
+	})
+
+	_, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		CashierName:       "Kasir A",
+		OpeningFloatCents: 250000,
+	})
+	if err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+
+	resp, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		IdempotencyKey:    "idem-refund-before-void",
+		PaymentMethod:     "cash",
+		CashReceivedCents: 100000,
+		TaxRatePercent:    0,
+		CartItems: []domain.CartItem{
+			{SKU: "SKU-MIE-01", Qty: 1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+
+	_, err = svc.Refund(ctx, domain.RefundRequest{
+		OriginalTransactionID: resp.TransactionID,
+		Reason:                "full refund",
+		AmountCents:           resp.TotalCents,
+	})
+	if err != nil {
+		t.Fatalf("refund failed: %v", err)
+	}
+
+	_, err = svc.VoidTransaction(ctx, domain.VoidTransactionRequest{
+		TransactionID: resp.TransactionID,
+		Reason:        "void after refund",
+	})
+	if err == nil {
+		t.Fatalf("expected void to fail for refunded transaction")
+	}
+}
+
+func TestRefundRejectsVoidedTransactionWithInvalidTransactionError(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{
+		Username: "admin",
+		Role:     "admin",
+	})
+
+	_, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		CashierName:       "Kasir A",
+		OpeningFloatCents: 250000,
+	})
+	if err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+
+	resp, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		IdempotencyKey:    "idem-void-before-refund",
+		PaymentMethod:     "cash",
+		CashReceivedCents: 100000,
+		TaxRatePercent:    0,
+		CartItems: []domain.CartItem{
+			{SKU: "SKU-MIE-01", Qty: 1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+
+	_, err = svc.VoidTransaction(ctx, domain.VoidTransactionRequest{
+		TransactionID: resp.TransactionID,
+		Reason:        "void before refund",
+	})
+	if err != nil {
+		t.Fatalf("void failed: %v", err)
+	}
+
+	_, err = svc.Refund(ctx, domain.RefundRequest{
+		OriginalTransactionID: resp.TransactionID,
+		Reason:                "refund should be rejected",
+		AmountCents:           1000,
+	})
+	if !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected ErrInvalidTransaction for refund on voided transaction, got %v", err)
+	}
+}
+
+func TestListExpiringLotsFiltersByWindow(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	today := time.Now().UTC()
+	soon, err := svc.ReceiveInventoryLot(ctx, domain.InventoryLotReceiveRequest{
+		StoreID:    "main-store",
+		SKU:        "SKU-SUSU-01",
+		LotCode:    "LOT-SOON",
+		ExpiryDate: today.AddDate(0, 0, 3).Format("2006-01-02"),
+		Qty:        4,
+		CostCents:  5000,
+	})
+	if err != nil {
+		t.Fatalf("receive soon lot failed: %v", err)
+	}
+	if _, err := svc.ReceiveInventoryLot(ctx, domain.InventoryLotReceiveRequest{
+		StoreID:    "main-store",
+		SKU:        "SKU-SUSU-01",
+		LotCode:    "LOT-LATER",
+		ExpiryDate: today.AddDate(0, 0, 30).Format("2006-01-02"),
+		Qty:        6,
+		CostCents:  5000,
+	}); err != nil {
+		t.Fatalf("receive later lot failed: %v", err)
+	}
+
+	resp, err := svc.ListExpiringLots(ctx, "main-store", 7)
+	if err != nil {
+		t.Fatalf("list expiring lots failed: %v", err)
+	}
+	if len(resp.Lots) != 1 || resp.Lots[0].LotID != soon.ID {
+		t.Fatalf("expected only the soon-expiring lot, got %+v", resp.Lots)
+	}
+	if resp.Lots[0].ProductName == "" {
+		t.Fatalf("expected product name to be populated")
+	}
+	if resp.TotalAtRiskCostCents != 20000 {
+		t.Fatalf("expected at-risk cost 20000, got %d", resp.TotalAtRiskCostCents)
+	}
+}
+
+type recordingAlertNotifier struct {
+	alerts chan domain.StockAlert
+}
+
+func (n recordingAlertNotifier) Notify(alert domain.StockAlert) {
+	n.alerts <- alert
+}
+
+func TestCheckoutAlertsOnceWhenStockDropsToReorderPoint(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	notifier := recordingAlertNotifier{alerts: make(chan domain.StockAlert, 8)}
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir Pagi", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	// Roti Tawar is bakery with a 30% margin, so its reorder point is 30.
+	if err := svc.repo.SetStock(ctx, "main-store", "SKU-ROTI-01", 32); err != nil {
+		t.Fatalf("set stock failed: %v", err)
+	}
+	sell := func(key string, qty int) domain.Transaction {
+		t.Helper()
+		resp, err := svc.Checkout(ctx, domain.CheckoutRequest{
+			StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: key,
+			PaymentMethod: "cash", CashReceivedCents: 1000000,
+			CartItems: []domain.CartItem{{SKU: "SKU-ROTI-01", Qty: qty}},
+		})
+		if err != nil {
+			t.Fatalf("checkout %s failed: %v", key, err)
+		}
+		tx, err := svc.repo.FindTransactionByID(ctx, resp.TransactionID)
+		if err != nil {
+			t.Fatalf("find transaction failed: %v", err)
+		}
+		return *tx
+	}
+
+	svc.SetStockAlertNotifier(notifier)
+	crossing := sell("idem-alert-1", 3)
+	select {
+	case alert := <-notifier.alerts:
+		if alert.Type != domain.StockAlertLowStock || alert.SKU != "SKU-ROTI-01" || alert.Qty != 29 || alert.ReorderPoint != 30 || alert.TransactionID != crossing.ID {
+			t.Fatalf("unexpected alert %+v", alert)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected a low-stock alert after crossing the reorder point")
+	}
+
+	// Checks run in the background; later ones are driven directly so the
+	// absence of an alert can be asserted.
+	svc.SetStockAlertNotifier(nil)
+	stillLow := sell("idem-alert-2", 1)
+	svc.SetStockAlertNotifier(notifier)
+	svc.alertLowStock(ctx, stillLow)
+	if len(notifier.alerts) != 0 {
+		t.Fatalf("expected no alert while stock stays below the reorder point, got %+v", <-notifier.alerts)
+	}
+
+	if err := svc.repo.SetStock(ctx, "main-store", "SKU-ROTI-01", 45); err != nil {
+		t.Fatalf("restock failed: %v", err)
+	}
+	if err := svc.clearRestockedSKUs(ctx, "main-store"); err != nil {
+		t.Fatalf("clear restocked skus failed: %v", err)
+	}
+	svc.SetStockAlertNotifier(nil)
+	again := sell("idem-alert-3", 20)
+	svc.SetStockAlertNotifier(notifier)
+	svc.alertLowStock(ctx, again)
+	if len(notifier.alerts) != 1 {
+		t.Fatalf("expected one alert after restocking and dropping again, got %d", len(notifier.alerts))
+	}
+	if alert := <-notifier.alerts; alert.Qty != 25 || alert.TransactionID != again.ID {
+		t.Fatalf("unexpected alert %+v", alert)
+	}
+}
+
+func TestExpiringLotSweepAlertsOncePerLot(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	notifier := recordingAlertNotifier{alerts: make(chan domain.StockAlert, 8)}
+	svc.SetStockAlertNotifier(notifier)
+
+	lot, err := svc.ReceiveInventoryLot(ctx, domain.InventoryLotReceiveRequest{
+		StoreID:    "main-store",
+		SKU:        "SKU-SUSU-01",
+		LotCode:    "LOT-ALERT",
+		ExpiryDate: time.Now().UTC().AddDate(0, 0, 2).Format("2006-01-02"),
+		Qty:        5,
+		CostCents:  5000,
+	})
+	if err != nil {
+		t.Fatalf("receive lot failed: %v", err)
+	}
+
+	alerted := map[string]bool{}
+	for range 2 {
+		if err := svc.alertExpiringLots(ctx, "main-store", 7, alerted); err != nil {
+			t.Fatalf("sweep failed: %v", err)
+		}
+	}
+	if len(notifier.alerts) != 1 {
+		t.Fatalf("expected one alert across two sweeps, got %d", len(notifier.alerts))
+	}
+	alert := <-notifier.alerts
+	if alert.Type != domain.StockAlertLotExpiring || alert.LotID != lot.ID || alert.LotCode != "LOT-ALERT" || alert.Qty != 5 || alert.ExpiryDate == nil {
+		t.Fatalf("unexpected alert %+v", alert)
+	}
+}
+
+func TestWriteOffStockConsumesLotsAndShowsInDailyReport(t *testing.T) {
+	svc := newTestService()
+	admin := domain.Actor{Username: "admin", Role: "admin"}
+	ctx := WithActor(context.Background(), admin)
+
+	if _, err := svc.ReceiveInventoryLot(ctx, domain.InventoryLotReceiveRequest{
+		StoreID:   "main-store",
+		SKU:       "SKU-TELUR-01",
+		LotCode:   "LOT-EGG",
+		Qty:       5,
+		CostCents: 2000,
+	}); err != nil {
+		t.Fatalf("receive lot failed: %v", err)
+	}
+
+	writeOff, err := svc.WriteOffStock(ctx, "main-store", "SKU-TELUR-01", 3, "cracked in transit", admin)
+	if err != nil {
+		t.Fatalf("write-off failed: %v", err)
+	}
+	if writeOff.CostCents != 6000 {
+		t.Fatalf("expected write-off cost 6000, got %d", writeOff.CostCents)
+	}
+
+	stock, err := svc.repo.GetStockMap(ctx, "main-store", []string{"SKU-TELUR-01"})
+	if err != nil {
+		t.Fatalf("get stock failed: %v", err)
+	}
+	if stock["SKU-TELUR-01"] != 122 {
+		t.Fatalf("expected stock 122 after write-off, got %d", stock["SKU-TELUR-01"])
+	}
+
+	report, err := svc.DailyReport(ctx, "main-store", "")
+	if err != nil {
+		t.Fatalf("daily report failed: %v", err)
+	}
+	if report.WriteOffCostCents != 6000 {
+		t.Fatalf("expected daily write-off cost 6000, got %d", report.WriteOffCostCents)
+	}
+
+	_, err = svc.WriteOffStock(ctx, "main-store", "SKU-TELUR-01", 1000, "flood", admin)
+	if !errors.Is(err, store.ErrInsufficientStock) {
+		t.Fatalf("expected insufficient stock error, got %v", err)
+	}
+
+	_, err = svc.WriteOffStock(ctx, "main-store", "SKU-TELUR-01", 1, "dropped", domain.Actor{Username: "kasir", Role: "cashier"})
+	if err == nil {
+		t.Fatalf("expected cashier write-off to be rejected")
+	}
+}
+
+func TestTransferStockMovesLotToDestination(t *testing.T) {
+	svc := newTestService()
+	admin := domain.Actor{Username: "admin", Role: "admin"}
+	ctx := WithActor(context.Background(), admin)
+
+	expiry := time.Now().UTC().AddDate(0, 0, 10).Format("2006-01-02")
+	if _, err := svc.ReceiveInventoryLot(ctx, domain.InventoryLotReceiveRequest{
+		StoreID:    "main-store",
+		SKU:        "SKU-ROTI-01",
+		LotCode:    "LOT-BREAD",
+		ExpiryDate: expiry,
+		Qty:        10,
+		CostCents:  12000,
+	}); err != nil {
+		t.Fatalf("receive lot failed: %v", err)
+	}
+
+	lots, err := svc.TransferStock(ctx, "main-store", "branch-store", "SKU-ROTI-01", 4, admin)
+	if err != nil {
+		t.Fatalf("transfer failed: %v", err)
+	}
+	if len(lots) != 1 {
+		t.Fatalf("expected one destination lot, got %+v", lots)
+	}
+	lot := lots[0]
+	if lot.StoreID != "branch-store" || lot.SourceType != "transfer" || lot.QtyAvailable != 4 {
+		t.Fatalf("unexpected destination lot: %+v", lot)
+	}
+	if lot.CostCents != 12000 {
+		t.Fatalf("expected transferred cost 12000, got %d", lot.CostCents)
+	}
+	if lot.ExpiryDate == nil || lot.ExpiryDate.Format("2006-01-02") != expiry {
+		t.Fatalf("expected expiry %s to be preserved, got %v", expiry, lot.ExpiryDate)
+	}
+
+	source, _ := svc.repo.GetStockMap(ctx, "main-store", []string{"SKU-ROTI-01"})
+	dest, _ := svc.repo.GetStockMap(ctx, "branch-store", []string{"SKU-ROTI-01"})
+	if source["SKU-ROTI-01"] != 126 || dest["SKU-ROTI-01"] != 4 {
+		t.Fatalf("unexpected stock after transfer: source=%d dest=%d", source["SKU-ROTI-01"], dest["SKU-ROTI-01"])
+	}
+
+	if _, err := svc.TransferStock(ctx, "main-store", "main-store", "SKU-ROTI-01", 1, admin); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected same-store transfer to be rejected, got %v", err)
+	}
+	if _, err := svc.TransferStock(ctx, "branch-store", "main-store", "SKU-ROTI-01", 5, admin); !errors.Is(err, store.ErrInsufficientStock) {
+		t.Fatalf("expected short transfer to be rejected, got %v", err)
+	}
+}
+
+func TestTransferStockSkipsExpiredLotsAndKeepsLotExpiry(t *testing.T) {
+	svc := newTestService()
+	admin := domain.Actor{Username: "admin", Role: "admin"}
+	ctx := WithActor(context.Background(), admin)
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	expired := today.AddDate(0, 0, -2)
+	soon := today.AddDate(0, 0, 5)
+	later := today.AddDate(0, 0, 20)
+	for _, lot := range []domain.InventoryLot{
+		{ID: "lot-expired", StoreID: "main-store", SKU: "SKU-SUSU-01", QtyReceived: 5, CostCents: 5000, ExpiryDate: &expired, ReceivedAt: today.AddDate(0, 0, -30)},
+		{ID: "lot-soon", StoreID: "main-store", SKU: "SKU-SUSU-01", QtyReceived: 3, CostCents: 8000, ExpiryDate: &soon, ReceivedAt: today.AddDate(0, 0, -10)},
+		{ID: "lot-later", StoreID: "main-store", SKU: "SKU-SUSU-01", QtyReceived: 3, CostCents: 10000, ExpiryDate: &later, ReceivedAt: today},
+	} {
+		if _, err := svc.repo.CreateInventoryLot(ctx, lot); err != nil {
+			t.Fatalf("create lot %s failed: %v", lot.ID, err)
+		}
+	}
+
+	lots, err := svc.TransferStock(ctx, "main-store", "branch-store", "SKU-SUSU-01", 5, admin)
+	if err != nil {
+		t.Fatalf("transfer failed: %v", err)
+	}
+	if len(lots) != 2 {
+		t.Fatalf("expected two destination lots, got %+v", lots)
+	}
+	if lots[0].QtyAvailable != 3 || lots[0].CostCents != 8000 || lots[0].ExpiryDate == nil || !lots[0].ExpiryDate.Equal(soon) {
+		t.Fatalf("unexpected first destination lot: %+v", lots[0])
+	}
+	if lots[1].QtyAvailable != 2 || lots[1].CostCents != 10000 || lots[1].ExpiryDate == nil || !lots[1].ExpiryDate.Equal(later) {
+		t.Fatalf("unexpected second destination lot: %+v", lots[1])
+	}
+	if lots[0].ID == lots[1].ID {
+		t.Fatalf("expected distinct destination lot IDs, got %s", lots[0].ID)
+	}
+
+	sourceLots, err := svc.repo.ListInventoryLots(ctx, "main-store", "SKU-SUSU-01", true, 0)
+	if err != nil {
+		t.Fatalf("list source lots failed: %v", err)
+	}
+	expiredLeft := -1
+	for _, lot := range sourceLots {
+		if lot.ID == "lot-expired" {
+			expiredLeft = lot.QtyAvailable
+		}
+	}
+	if expiredLeft != 5 {
+		t.Fatalf("expected expired lot to stay behind with 5 units, got %d", expiredLeft)
+	}
+
+	costs, err := svc.repo.GetProductCosts(ctx, "branch-store", []string{"SKU-SUSU-01"})
+	if err != nil {
+		t.Fatalf("get destination cost failed: %v", err)
+	}
+	if costs["SKU-SUSU-01"] != 8800 {
+		t.Fatalf("expected destination cost 8800, got %d", costs["SKU-SUSU-01"])
+	}
+}
+
+func TestUpdateInventoryLotRejectsBadCostBeforeQtyChange(t *testing.T) {
+	svc := newTestService()
+	admin := domain.Actor{Username: "admin", Role: "admin"}
+	ctx := WithActor(context.Background(), admin)
+
+	lot, err := svc.ReceiveInventoryLot(ctx, domain.InventoryLotReceiveRequest{
+		StoreID:   "main-store",
+		SKU:       "SKU-GULA-01",
+		LotCode:   "LOT-SUGAR",
+		Qty:       10,
+		CostCents: 15000,
+	})
+	if err != nil {
+		t.Fatalf("receive lot failed: %v", err)
+	}
+
+	qty := 7
+	badCost := int64(0)
+	if _, err := svc.UpdateInventoryLot(ctx, lot.ID, domain.InventoryLotUpdateRequest{QtyAvailable: &qty, CostCents: &badCost, Reason: "recount"}, admin); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected a zero cost to be rejected, got %v", err)
+	}
+	current, err := svc.repo.GetInventoryLot(ctx, lot.ID)
+	if err != nil {
+		t.Fatalf("get lot failed: %v", err)
+	}
+	if current.QtyAvailable != 10 || current.CostCents != 15000 {
+		t.Fatalf("expected the lot unchanged after a rejected edit, got qty=%d cost=%d", current.QtyAvailable, current.CostCents)
+	}
+	stock, _ := svc.repo.GetStockMap(ctx, "main-store", []string{"SKU-GULA-01"})
+	if stock["SKU-GULA-01"] != 130 {
+		t.Fatalf("expected stock 130 after a rejected edit, got %d", stock["SKU-GULA-01"])
+	}
+
+	cost := int64(16000)
+	updated, err := svc.UpdateInventoryLot(ctx, lot.ID, domain.InventoryLotUpdateRequest{QtyAvailable: &qty, CostCents: &cost, Reason: "recount"}, admin)
+	if err != nil {
+		t.Fatalf("update lot failed: %v", err)
+	}
+	if updated.QtyAvailable != 7 || updated.CostCents != 16000 {
+		t.Fatalf("expected qty 7 and cost 16000, got %+v", updated)
+	}
+}
+
+func TestAdjustLotQtyReconcilesStock(t *testing.T) {
+	svc := newTestService()
+	admin := domain.Actor{Username: "admin", Role: "admin"}
+	ctx := WithActor(context.Background(), admin)
+
+	lot, err := svc.ReceiveInventoryLot(ctx, domain.InventoryLotReceiveRequest{
+		StoreID:   "main-store",
+		SKU:       "SKU-GULA-01",
+		LotCode:   "LOT-SUGAR",
+		Qty:       10,
+		CostCents: 15000,
+	})
+	if err != nil {
+		t.Fatalf("receive lot failed: %v", err)
+	}
+
+	adjusted, err := svc.AdjustLotQty(ctx, lot.ID, 7, "recount", admin)
+	if err != nil {
+		t.Fatalf("adjust lot failed: %v", err)
+	}
+	if adjusted.QtyAvailable != 7 {
+		t.Fatalf("expected lot qty 7, got %d", adjusted.QtyAvailable)
+	}
+	stock, _ := svc.repo.GetStockMap(ctx, "main-store", []string{"SKU-GULA-01"})
+	if stock["SKU-GULA-01"] != 127 {
+		t.Fatalf("expected stock 127 after lot adjustment, got %d", stock["SKU-GULA-01"])
+	}
+
+	if _, err := svc.AdjustLotQty(ctx, lot.ID, 11, "typo", admin); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected qty above received to be rejected, got %v", err)
+	}
+	if _, err := svc.AdjustLotQty(ctx, "lot-missing", 1, "recount", admin); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected missing lot to return not found, got %v", err)
+	}
+}
+
+func TestStockOpnameRecordIsRetrievable(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	resp, err := svc.StockOpname(ctx, domain.StockOpnameRequest{
+		StoreID: "main-store",
+		Notes:   "monthly count",
+		Items: []domain.StockOpnameItem{
+			{SKU: "sku-kopi-01", CountedQty: 110},
+			{SKU: "SKU-TEH-01", CountedQty: 120},
+		},
+	})
+	if err != nil {
+		t.Fatalf("stock opname failed: %v", err)
+	}
+
+	record, err := svc.GetStockOpname(ctx, resp.OpnameID)
+	if err != nil {
+		t.Fatalf("get stock opname failed: %v", err)
+	}
+	if record.CreatedBy != "admin" || len(record.Adjustments) != 2 {
+		t.Fatalf("unexpected opname record: %+v", record)
+	}
+	if record.Adjustments[0].SKU != "SKU-KOPI-01" || record.Adjustments[0].DeltaQty != -10 {
+		t.Fatalf("expected kopi delta -10, got %+v", record.Adjustments[0])
+	}
+	if record.Adjustments[1].DeltaQty != 0 {
+		t.Fatalf("expected teh delta 0, got %+v", record.Adjustments[1])
+	}
+
+	if _, err := svc.GetStockOpname(ctx, "opname-missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected not found for unknown opname, got %v", err)
+	}
+}
+
+func TestInventoryValuationFallsBackToDerivedCost(t *testing.T) {
+	svc := newTestService()
+	ctx := context.Background()
+
+	if err := svc.repo.UpsertProductCost(ctx, "main-store", "SKU-MIE-01", 2500); err != nil {
+		t.Fatalf("upsert cost failed: %v", err)
+	}
+
+	report, err := svc.GetInventoryValuation(ctx, "main-store")
+	if err != nil {
+		t.Fatalf("inventory valuation failed: %v", err)
+	}
+
+	products, _ := svc.repo.ListProducts(ctx)
+	expectedValue := int64(0)
+	for _, product := range products {
+		cost := deriveUnitCost(product)
+		if product.SKU == "SKU-MIE-01" {
+			cost = 2500
+		}
+		expectedValue += cost * 120
+	}
+	if report.TotalValueCents != expectedValue {
+		t.Fatalf("expected total value %d, got %d", expectedValue, report.TotalValueCents)
+	}
+	if report.TotalUnits != int64(120*len(products)) {
+		t.Fatalf("expected %d units, got %d", 120*len(products), report.TotalUnits)
+	}
+	if report.MissingCostSKUs != len(products)-1 {
+		t.Fatalf("expected %d SKUs with missing cost, got %d", len(products)-1, report.MissingCostSKUs)
+	}
+	if len(report.ByCategory) == 0 {
+		t.Fatalf("expected category breakdown")
+	}
+}
+
+func TestInventoryValuationDerivesCostForInactiveProducts(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	inactive := false
+	product, err := svc.UpdateProduct(ctx, "SKU-ROTI-01", domain.ProductUpdateRequest{Active: &inactive})
+	if err != nil {
+		t.Fatalf("deactivate product failed: %v", err)
+	}
+
+	report, err := svc.GetInventoryValuation(ctx, "main-store")
+	if err != nil {
+		t.Fatalf("inventory valuation failed: %v", err)
+	}
+
+	products, _ := svc.repo.ListAllProducts(ctx)
+	expectedValue := int64(0)
+	for _, p := range products {
+		expectedValue += deriveUnitCost(p) * 120
+	}
+	if deriveUnitCost(product) < 1 {
+		t.Fatalf("expected a derived cost for %s", product.SKU)
+	}
+	if report.TotalValueCents != expectedValue {
+		t.Fatalf("expected total value %d including the inactive SKU, got %d", expectedValue, report.TotalValueCents)
+	}
+}
+
+func TestReceiveInventoryLotsIsAtomic(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	_, err := svc.ReceiveInventoryLots(ctx, []domain.InventoryLotReceiveRequest{
+		{StoreID: "main-store", SKU: "SKU-AIR-01", Qty: 24, CostCents: 3000},
+		{StoreID: "main-store", SKU: "SKU-TEH-01", Qty: 0, CostCents: 7000},
+	})
+	if !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected invalid batch to be rejected, got %v", err)
+	}
+	stock, _ := svc.repo.GetStockMap(ctx, "main-store", []string{"SKU-AIR-01"})
+	if stock["SKU-AIR-01"] != 120 {
+		t.Fatalf("expected no stock change after rejected batch, got %d", stock["SKU-AIR-01"])
+	}
+
+	_, err = svc.ReceiveInventoryLots(ctx, []domain.InventoryLotReceiveRequest{
+		{StoreID: "main-store", SKU: "SKU-AIR-01", Qty: 24, CostCents: 3000},
+		{StoreID: "main-store", SKU: "SKU-UNKNOWN", Qty: 5, CostCents: 1000},
+	})
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected unknown sku to reject the batch, got %v", err)
+	}
+
+	lots, err := svc.ReceiveInventoryLots(ctx, []domain.InventoryLotReceiveRequest{
+		{StoreID: "main-store", SKU: "SKU-AIR-01", Qty: 24, CostCents: 3000},
+		{StoreID: "main-store", SKU: "SKU-TEH-01", Qty: 12, CostCents: 7000},
+	})
+	if err != nil {
+		t.Fatalf("batch receive failed: %v", err)
+	}
+	if len(lots) != 2 {
+		t.Fatalf("expected 2 created lots, got %d", len(lots))
+	}
+	stock, _ = svc.repo.GetStockMap(ctx, "main-store", []string{"SKU-AIR-01", "SKU-TEH-01"})
+	if stock["SKU-AIR-01"] != 144 || stock["SKU-TEH-01"] != 132 {
+		t.Fatalf("unexpected stock after batch: %+v", stock)
+	}
+}
+
+func TestReceiveInventoryLotRejectsPastExpiry(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format("2006-01-02")
+	req := domain.InventoryLotReceiveRequest{StoreID: "main-store", SKU: "SKU-SUSU-01", Qty: 6, CostCents: 12000, ExpiryDate: yesterday}
+
+	if _, err := svc.ReceiveInventoryLot(ctx, req); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected yesterday-dated lot to be rejected, got %v", err)
+	}
+	stock, _ := svc.repo.GetStockMap(ctx, "main-store", []string{"SKU-SUSU-01"})
+	if stock["SKU-SUSU-01"] != 120 {
+		t.Fatalf("expected no stock change after rejected lot, got %d", stock["SKU-SUSU-01"])
+	}
+
+	svc.SetExpiredLotGraceDays(2)
+	if _, err := svc.ReceiveInventoryLot(ctx, req); err != nil {
+		t.Fatalf("expected lot within the grace period to be received, got %v", err)
+	}
+}
+
+func TestDaysToExpiryAcrossDayBoundary(t *testing.T) {
+	expiry := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	lateEvening := time.Date(2026, 3, 8, 23, 59, 59, 0, time.UTC)
+	if days := daysToExpiry(&expiry, lateEvening); days == nil || *days != 2 {
+		t.Fatalf("expected 2 days before midnight, got %v", days)
+	}
+	justAfterMidnight := time.Date(2026, 3, 9, 0, 0, 1, 0, time.UTC)
+	if days := daysToExpiry(&expiry, justAfterMidnight); days == nil || *days != 1 {
+		t.Fatalf("expected 1 day after midnight, got %v", days)
+	}
+	expiredYesterday := time.Date(2026, 3, 11, 8, 0, 0, 0, time.UTC)
+	if days := daysToExpiry(&expiry, expiredYesterday); days == nil || *days != -1 {
+		t.Fatalf("expected -1 for an expired lot, got %v", days)
+	}
+
+	jakarta := time.FixedZone("WIB", 7*3600)
+	localMorning := time.Date(2026, 3, 9, 6, 0, 0, 0, jakarta)
+	if days := daysToExpiry(&expiry, localMorning); days == nil || *days != 2 {
+		t.Fatalf("expected UTC date math for non-UTC clock, got %v", days)
+	}
+
+	if days := daysToExpiry(nil, lateEvening); days != nil {
+		t.Fatalf("expected nil for lots without expiry, got %d", *days)
+	}
+}
+
+func TestCorrectLotCostFixesReorderCost(t *testing.T) {
+	svc := newTestService()
+	admin := domain.Actor{Username: "admin", Role: "admin"}
+	ctx := WithActor(context.Background(), admin)
+
+	if err := svc.repo.SetStock(ctx, "main-store", "SKU-SHAMPOO-01", 0); err != nil {
+		t.Fatalf("set stock failed: %v", err)
+	}
+	if _, err := svc.ReceiveInventoryLot(ctx, domain.InventoryLotReceiveRequest{
+		StoreID: "main-store", SKU: "SKU-SHAMPOO-01", Qty: 6, CostCents: 2000,
+	}); err != nil {
+		t.Fatalf("receive good lot failed: %v", err)
+	}
+	bad, err := svc.ReceiveInventoryLot(ctx, domain.InventoryLotReceiveRequest{
+		StoreID: "main-store", SKU: "SKU-SHAMPOO-01", Qty: 2, CostCents: 220000,
+	})
+	if err != nil {
+		t.Fatalf("receive mistyped lot failed: %v", err)
+	}
+	if err := svc.repo.UpsertProductCost(ctx, "main-store", "SKU-SHAMPOO-01", 56500); err != nil {
+		t.Fatalf("upsert poisoned cost failed: %v", err)
+	}
+
+	corrected, err := svc.CorrectLotCost(ctx, bad.ID, 2400, admin)
+	if err != nil {
+		t.Fatalf("correct lot cost failed: %v", err)
+	}
+	if corrected.CostCents != 2400 {
+		t.Fatalf("expected corrected lot cost 2400, got %d", corrected.CostCents)
+	}
+
+	resp, err := svc.ReorderSuggestions(ctx, "main-store")
+	if err != nil {
+		t.Fatalf("reorder suggestions failed: %v", err)
+	}
+	var found bool
+	for _, suggestion := range resp.Suggestions {
+		if suggestion.SKU != "SKU-SHAMPOO-01" {
+			continue
+		}
+		found = true
+		// (6*2000 + 2*2400) / 8 = 2100
+		if suggestion.LastCostCents != 2100 {
+			t.Fatalf("expected re-weighted cost 2100, got %d", suggestion.LastCostCents)
+		}
+	}
+	if !found {
+		t.Fatalf("expected shampoo in reorder suggestions")
+	}
+}
+
+func TestCheckoutConsumesSerialsForSerializedProduct(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	if _, err := svc.CreateProduct(ctx, domain.ProductCreateRequest{
+		StoreID:    "main-store",
+		SKU:        "SKU-HP-01",
+		Name:       "Handphone A1",
+		Category:   "electronics",
+		PriceCents: 1500000,
+		MarginRate: 0.10,
+		Serialized: true,
+	}); err != nil {
+		t.Fatalf("create product failed: %v", err)
+	}
+	if _, err := svc.ReceiveInventoryLot(ctx, domain.InventoryLotReceiveRequest{
+		StoreID: "main-store", SKU: "SKU-HP-01", Qty: 3, CostCents: 1300000,
+		Serials: []string{"IMEI-001", "IMEI-002"},
+	}); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected serial count mismatch to be rejected, got %v", err)
+	}
+	if _, err := svc.ReceiveInventoryLot(ctx, domain.InventoryLotReceiveRequest{
+		StoreID: "main-store", SKU: "SKU-HP-01", Qty: 3, CostCents: 1300000,
+	}); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected a serialized lot without serials to be rejected, got %v", err)
+	}
+	if _, err := svc.ReceiveInventoryLot(ctx, domain.InventoryLotReceiveRequest{
+		StoreID: "main-store", SKU: "SKU-HP-01", Qty: 3, CostCents: 1300000,
+		Serials: []string{"IMEI-001", "IMEI-002", "IMEI-003"},
+	}); err != nil {
+		t.Fatalf("receive lot failed: %v", err)
+	}
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+
+	checkout := func(key string, serials ...string) error {
+		_, err := svc.Checkout(ctx, domain.CheckoutRequest{
+			StoreID:          "main-store",
+			TerminalID:       "terminal-a1",
+			IdempotencyKey:   key,
+			PaymentMethod:    "card",
+			PaymentReference: "CARD-" + key,
+			CartItems:        []domain.CartItem{{SKU: "SKU-HP-01", Qty: 1, Serials: serials}},
+		})
+		return err
+	}
+	if err := checkout("idem-hp-none"); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected checkout without serial to fail, got %v", err)
+	}
+	if err := checkout("idem-hp-unknown", "IMEI-999"); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected unknown serial to fail, got %v", err)
+	}
+	if err := checkout("idem-hp-1", "IMEI-002"); err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+	if err := checkout("idem-hp-2", "IMEI-002"); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected sold serial to be rejected, got %v", err)
+	}
+
+	available, err := svc.ListSerials(ctx, "main-store", "sku-hp-01", "available")
+	if err != nil {
+		t.Fatalf("list serials failed: %v", err)
+	}
+	if len(available.Serials) != 2 || available.Serials[0].Serial != "IMEI-001" || available.Serials[1].Serial != "IMEI-003" {
+		t.Fatalf("unexpected available serials: %+v", available.Serials)
+	}
+	sold, err := svc.ListSerials(ctx, "main-store", "SKU-HP-01", "sold")
+	if err != nil {
+		t.Fatalf("list serials failed: %v", err)
+	}
+	if len(sold.Serials) != 1 || sold.Serials[0].TransactionID == "" || sold.Serials[0].SoldAt == nil {
+		t.Fatalf("expected sold serial linked to transaction, got %+v", sold.Serials)
+	}
+}
+
+func TestSerializedStockRejectsChangesWithoutSerials(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	admin := domain.Actor{Username: "admin", Role: "admin"}
+
+	if _, err := svc.CreateProduct(ctx, domain.ProductCreateRequest{
+		StoreID: "main-store", SKU: "SKU-HP-02", Name: "Handphone A2", Category: "electronics",
+		PriceCents: 1500000, MarginRate: 0.10, Serialized: true,
+	}); err != nil {
+		t.Fatalf("create product failed: %v", err)
+	}
+	lot, err := svc.ReceiveInventoryLot(ctx, domain.InventoryLotReceiveRequest{
+		StoreID: "main-store", SKU: "SKU-HP-02", Qty: 3, CostCents: 1300000,
+		Serials: []string{"IMEI-101", "IMEI-102", "IMEI-103"},
+	})
+	if err != nil {
+		t.Fatalf("receive lot failed: %v", err)
+	}
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	sale, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: "idem-hp-serial-sale",
+		PaymentMethod: "card", PaymentReference: "CARD-HP-SERIAL",
+		CartItems: []domain.CartItem{{SKU: "SKU-HP-02", Qty: 1, Serials: []string{"IMEI-101"}}},
+	})
+	if err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+
+	if _, err := svc.WriteOffStock(ctx, "main-store", "SKU-HP-02", 1, "rusak", admin); !errors.Is(err, store.ErrInvalidSerials) {
+		t.Fatalf("expected write-off of serialized stock to be rejected, got %v", err)
+	}
+	if _, err := svc.TransferStock(ctx, "main-store", "branch-store", "SKU-HP-02", 1, admin); !errors.Is(err, store.ErrInvalidSerials) {
+		t.Fatalf("expected transfer of serialized stock to be rejected, got %v", err)
+	}
+	if _, err := svc.AdjustLotQty(ctx, lot.ID, 1, "hitung ulang", admin); !errors.Is(err, store.ErrInvalidSerials) {
+		t.Fatalf("expected lot adjustment of serialized stock to be rejected, got %v", err)
+	}
+	if _, err := svc.StockOpname(ctx, domain.StockOpnameRequest{
+		StoreID: "main-store", Items: []domain.StockOpnameItem{{SKU: "SKU-HP-02", CountedQty: 1}},
+	}); !errors.Is(err, store.ErrInvalidSerials) {
+		t.Fatalf("expected opname of serialized stock to be rejected, got %v", err)
+	}
+	if _, err := svc.ProcessItemReturn(ctx, domain.ItemReturnRequest{
+		OriginalTransactionID: sale.TransactionID,
+		ReturnItems:           []domain.ItemReturnLine{{SKU: "SKU-HP-02", Qty: 1}},
+	}); !errors.Is(err, store.ErrInvalidSerials) {
+		t.Fatalf("expected return of serialized stock to be rejected, got %v", err)
+	}
+
+	available, err := svc.ListSerials(ctx, "main-store", "SKU-HP-02", "available")
+	if err != nil {
+		t.Fatalf("list serials failed: %v", err)
+	}
+	if len(available.Serials) != 2 {
+		t.Fatalf("expected the two unsold serials to stay available, got %+v", available.Serials)
+	}
+	branch, err := svc.ListInventoryLots(ctx, "branch-store", "SKU-HP-02", false, 10)
+	if err != nil {
+		t.Fatalf("list branch lots failed: %v", err)
+	}
+	if len(branch.Lots) != 0 {
+		t.Fatalf("expected no lot in the destination store, got %+v", branch.Lots)
+	}
+}
+
+func TestCheckoutFIFOConsumesOldestReceivedLot(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	fifo := domain.PickingStrategyFIFO
+	if _, err := svc.UpdateProduct(ctx, "SKU-SABUN-01", domain.ProductUpdateRequest{PickingStrategy: &fifo}); err != nil {
+		t.Fatalf("update product failed: %v", err)
+	}
+
+	now := time.Now().UTC()
+	expired := now.AddDate(0, 0, -2)
+	soon := now.AddDate(0, 0, 5)
+	for _, lot := range []domain.InventoryLot{
+		{ID: "lot-expired", StoreID: "main-store", SKU: "SKU-SABUN-01", QtyReceived: 5, CostCents: 5000, ExpiryDate: &expired, ReceivedAt: now.AddDate(0, 0, -30)},
+		{ID: "lot-old", StoreID: "main-store", SKU: "SKU-SABUN-01", QtyReceived: 5, CostCents: 5000, ReceivedAt: now.AddDate(0, 0, -10)},
+		{ID: "lot-new", StoreID: "main-store", SKU: "SKU-SABUN-01", QtyReceived: 5, CostCents: 5000, ExpiryDate: &soon, ReceivedAt: now},
+	} {
+		if _, err := svc.repo.CreateInventoryLot(ctx, lot); err != nil {
+			t.Fatalf("create lot %s failed: %v", lot.ID, err)
+		}
+	}
+
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	if _, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		IdempotencyKey:    "idem-fifo",
+		PaymentMethod:     "cash",
+		CashReceivedCents: 50000,
+		CartItems:         []domain.CartItem{{SKU: "SKU-SABUN-01", Qty: 2}},
+	}); err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+
+	want := map[string]int{"lot-expired": 5, "lot-old": 3, "lot-new": 5}
+	for lotID, qty := range want {
+		lot, err := svc.repo.GetInventoryLot(ctx, lotID)
+		if err != nil {
+			t.Fatalf("get lot %s failed: %v", lotID, err)
+		}
+		if lot.QtyAvailable != qty {
+			t.Fatalf("expected %s to have %d available, got %d", lotID, qty, lot.QtyAvailable)
+		}
+	}
+}
+
+func TestStockMovementsRecordEveryStockChange(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	if _, err := svc.ReceiveInventoryLot(ctx, domain.InventoryLotReceiveRequest{
+		StoreID: "main-store", SKU: "SKU-TEH-01", Qty: 10, CostCents: 7000,
+	}); err != nil {
+		t.Fatalf("receive lot failed: %v", err)
+	}
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	sale, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID:           "main-store",
+		TerminalID:        "terminal-a1",
+		IdempotencyKey:    "idem-ledger",
+		PaymentMethod:     "cash",
+		CashReceivedCents: 100000,
+		CartItems:         []domain.CartItem{{SKU: "SKU-TEH-01", Qty: 3}},
+	})
+	if err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+	if _, err := svc.VoidTransaction(ctx, domain.VoidTransactionRequest{TransactionID: sale.TransactionID, Reason: "salah input"}); err != nil {
+		t.Fatalf("void failed: %v", err)
+	}
+	if _, err := svc.StockOpname(ctx, domain.StockOpnameRequest{
+		StoreID: "main-store",
+		Items:   []domain.StockOpnameItem{{SKU: "SKU-TEH-01", CountedQty: 125}},
+	}); err != nil {
+		t.Fatalf("stock opname failed: %v", err)
+	}
+
+	resp, err := svc.ListStockMovements(ctx, "main-store", "sku-teh-01", "", "")
+	if err != nil {
+		t.Fatalf("list movements failed: %v", err)
+	}
+	wantReasons := []string{
+		domain.MovementReasonLotReceive,
+		domain.MovementReasonSale,
+		domain.MovementReasonVoid,
+		domain.MovementReasonOpname,
+	}
+	if len(resp.Movements) != len(wantReasons) {
+		t.Fatalf("expected %d movements, got %+v", len(wantReasons), resp.Movements)
+	}
+	total := 0
+	for i, movement := range resp.Movements {
+		if movement.Reason != wantReasons[i] {
+			t.Fatalf("movement %d: expected reason %s, got %s", i, wantReasons[i], movement.Reason)
+		}
+		total += movement.Delta
+	}
+	if resp.Movements[1].RefID != sale.TransactionID || resp.Movements[1].Delta != -3 {
+		t.Fatalf("unexpected sale movement: %+v", resp.Movements[1])
+	}
+	if total != 125-120 {
+		t.Fatalf("expected ledger to net to +5, got %d", total)
+	}
+}
+
+func TestShiftSummaryComputesExpectedCashAndVariance(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	opened, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 100000,
+	})
+	if err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+
+	cashSale, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: "idem-sum-cash",
+		PaymentMethod: "cash", CashReceivedCents: 10000,
+		CartItems: []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}},
+	})
+	if err != nil {
+		t.Fatalf("cash checkout failed: %v", err)
+	}
+	if _, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: "idem-sum-split",
+		PaymentMethod: "split",
+		PaymentSplits: []domain.PaymentSplit{
+			{Method: "cash", AmountCents: 3000},
+			{Method: "qris", AmountCents: 4000, Reference: "TRX-QRIS-SUM"},
+		},
+		CartItems: []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 2}},
+	}); err != nil {
+		t.Fatalf("split checkout failed: %v", err)
+	}
+	if _, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: "idem-sum-card",
+		PaymentMethod: "card", PaymentReference: "CARD-SUM",
+		CartItems: []domain.CartItem{{SKU: "SKU-SUSU-01", Qty: 1}},
+	}); err != nil {
+		t.Fatalf("card checkout failed: %v", err)
+	}
+	if _, err := svc.Refund(ctx, domain.RefundRequest{
+		OriginalTransactionID: cashSale.TransactionID, Reason: "kemasan rusak", AmountCents: 1000,
+	}); err != nil {
+		t.Fatalf("refund failed: %v", err)
+	}
+
+	open, err := svc.GetShiftSummary(ctx, opened.Shift.ID)
+	if err != nil {
+		t.Fatalf("shift summary failed: %v", err)
+	}
+	if open.ExpectedCashCents != 105500 || open.VarianceCents != nil {
+		t.Fatalf("unexpected open shift summary: %+v", open)
+	}
+	if open.TransactionCount != 3 || open.CashSalesCents != 6500 || open.CashRefundsCents != 1000 {
+		t.Fatalf("unexpected totals: %+v", open)
+	}
+
+	if _, err := svc.CloseShift(ctx, domain.ShiftCloseRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", ClosingCashCents: 105000,
+	}); err != nil {
+		t.Fatalf("close shift failed: %v", err)
+	}
+	closed, err := svc.GetShiftSummary(ctx, opened.Shift.ID)
+	if err != nil {
+		t.Fatalf("shift summary failed: %v", err)
+	}
+	if closed.VarianceCents == nil || *closed.VarianceCents != -500 {
+		t.Fatalf("expected variance -500, got %+v", closed.VarianceCents)
+	}
+}
+
+func TestCashMovementsAdjustExpectedShiftCash(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "cashier", Role: "cashier"})
+
+	opened, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 100000,
+	})
+	if err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+
+	if _, err := svc.RecordCashMovement(ctx, opened.Shift.ID, "drop", 50000, "setor ke brankas"); err != nil {
+		t.Fatalf("record drop failed: %v", err)
+	}
+	if _, err := svc.RecordCashMovement(ctx, opened.Shift.ID, "paid_in", 20000, "tambah kembalian"); err != nil {
+		t.Fatalf("record paid in failed: %v", err)
+	}
+	movement, err := svc.RecordCashMovement(ctx, opened.Shift.ID, "paid_out", 7500, "beli galon")
+	if err != nil {
+		t.Fatalf("record paid out failed: %v", err)
+	}
+	if movement.CreatedBy != "cashier" || movement.Kind != domain.CashMovementPaidOut {
+		t.Fatalf("unexpected movement: %+v", movement)
+	}
+	if _, err := svc.RecordCashMovement(ctx, opened.Shift.ID, "tip", 1000, ""); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected invalid kind to be rejected, got %v", err)
+	}
+	if _, err := svc.RecordCashMovement(ctx, "shift-missing", "drop", 1000, ""); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected unknown shift to be not found, got %v", err)
+	}
+
+	summary, err := svc.GetShiftSummary(ctx, opened.Shift.ID)
+	if err != nil {
+		t.Fatalf("shift summary failed: %v", err)
+	}
+	if summary.CashDropsCents != 50000 || summary.PaidInCents != 20000 || summary.PaidOutCents != 7500 {
+		t.Fatalf("unexpected movement totals: %+v", summary)
+	}
+	if summary.ExpectedCashCents != 62500 {
+		t.Fatalf("expected cash 62500, got %d", summary.ExpectedCashCents)
+	}
+
+	if _, err := svc.CloseShift(ctx, domain.ShiftCloseRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", ClosingCashCents: 62500,
+	}); err != nil {
+		t.Fatalf("close shift failed: %v", err)
+	}
+	if _, err := svc.RecordCashMovement(ctx, opened.Shift.ID, "drop", 1000, ""); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected closed shift to reject movements, got %v", err)
+	}
+}
+
+func TestListShiftsReturnsNewestFirst(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	first, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 100000,
+	})
+	if err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	if _, err := svc.CloseShift(ctx, domain.ShiftCloseRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", ClosingCashCents: 100000,
+	}); err != nil {
+		t.Fatalf("close shift failed: %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	second, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir B", OpeningFloatCents: 50000,
+	})
+	if err != nil {
+		t.Fatalf("open second shift failed: %v", err)
+	}
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-b1", CashierName: "Kasir C", OpeningFloatCents: 50000,
+	}); err != nil {
+		t.Fatalf("open other terminal shift failed: %v", err)
+	}
+
+	resp, err := svc.ListShifts(ctx, "main-store", "terminal-a1", "", "", 10)
+	if err != nil {
+		t.Fatalf("list shifts failed: %v", err)
+	}
+	if len(resp.Shifts) != 2 {
+		t.Fatalf("expected 2 shifts on terminal-a1, got %d", len(resp.Shifts))
+	}
+	if resp.Shifts[0].ID != second.Shift.ID || resp.Shifts[1].ID != first.Shift.ID {
+		t.Fatalf("expected newest shift first, got %+v", resp.Shifts)
+	}
+	if resp.Shifts[1].Status != domain.ShiftStatusClosed || resp.Shifts[1].ClosedAt == nil {
+		t.Fatalf("expected first shift to be closed: %+v", resp.Shifts[1])
+	}
+
+	all, err := svc.ListShifts(ctx, "main-store", "", "", "", 10)
+	if err != nil {
+		t.Fatalf("list all shifts failed: %v", err)
+	}
+	if len(all.Shifts) != 3 {
+		t.Fatalf("expected 3 shifts in store, got %d", len(all.Shifts))
+	}
+	if _, err := svc.ListShifts(ctx, "main-store", "", "yesterday", "", 10); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected invalid date to be rejected, got %v", err)
+	}
+}
+
+func TestCheckoutEnforcesShiftOwnership(t *testing.T) {
+	svc := newTestService()
+	svc.SetEnforceShiftOwnership(true)
+	owner := WithActor(context.Background(), domain.Actor{Username: "kasir-a", Role: "cashier"})
+	other := WithActor(context.Background(), domain.Actor{Username: "kasir-b", Role: "cashier"})
+	admin := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	opened, err := svc.OpenShift(owner, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 100000,
+	})
+	if err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	if opened.Shift.OpenedBy != "kasir-a" {
+		t.Fatalf("expected shift opened by kasir-a, got %q", opened.Shift.OpenedBy)
+	}
+
+	checkout := func(ctx context.Context, key string) error {
+		_, err := svc.Checkout(ctx, domain.CheckoutRequest{
+			StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: key,
+			PaymentMethod: "cash", CashReceivedCents: 10000,
+			CartItems: []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}},
+		})
+		return err
+	}
+
+	if err := checkout(owner, "idem-owner"); err != nil {
+		t.Fatalf("expected owner checkout to succeed, got %v", err)
+	}
+	if err := checkout(other, "idem-other"); !errors.Is(err, ErrShiftNotOwned) {
+		t.Fatalf("expected ErrShiftNotOwned for other cashier, got %v", err)
+	}
+	if err := checkout(admin, "idem-admin"); err != nil {
+		t.Fatalf("expected admin checkout to bypass ownership, got %v", err)
+	}
+
+	svc.SetEnforceShiftOwnership(false)
+	if err := checkout(other, "idem-other-unenforced"); err != nil {
+		t.Fatalf("expected checkout to succeed without enforcement, got %v", err)
+	}
+}
+
+func TestRecommendReturnsTopNOutsideCart(t *testing.T) {
+	svc := newTestService()
+	svc.SetExperimentTreatmentRatio(1)
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	resp, err := svc.Recommend(context.Background(), domain.RecommendationRequest{
+		StoreID:   "main-store",
+		Timestamp: &at,
+		Limit:     2,
+		CartItems: []domain.CartItem{
+			{SKU: "SKU-MIE-01", Qty: 1},
+			{SKU: "SKU-KOPI-01", Qty: 1},
+			{SKU: "SKU-AIR-01", Qty: 1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("recommend failed: %v", err)
+	}
+	if !resp.UIPolicy.Show || len(resp.Recommendations) != 2 {
+		t.Fatalf("expected 2 recommendations, got %+v", resp)
+	}
+	for i, rec := range resp.Recommendations {
+		if rec.SKU == "SKU-MIE-01" || rec.SKU == "SKU-KOPI-01" || rec.SKU == "SKU-AIR-01" {
+			t.Fatalf("recommended %s which is already in the cart", rec.SKU)
+		}
+		if i > 0 && rec.Confidence > resp.Recommendations[i-1].Confidence {
+			t.Fatalf("recommendations not ranked by confidence: %+v", resp.Recommendations)
+		}
+	}
+	if resp.Recommendation == nil || resp.Recommendation.SKU != resp.Recommendations[0].SKU {
+		t.Fatalf("expected single recommendation to mirror the top pick, got %+v", resp.Recommendation)
+	}
+
+	single, err := svc.Recommend(context.Background(), domain.RecommendationRequest{
+		StoreID:   "main-store",
+		Timestamp: &at,
+		CartItems: []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}, {SKU: "SKU-KOPI-01", Qty: 1}, {SKU: "SKU-AIR-01", Qty: 1}},
+	})
+	if err != nil {
+		t.Fatalf("recommend failed: %v", err)
+	}
+	if len(single.Recommendations) != 1 {
+		t.Fatalf("expected default limit of 1, got %d", len(single.Recommendations))
+	}
+}
+
+func TestRecommendReportsAvailableQty(t *testing.T) {
+	svc := newTestService()
+	svc.SetExperimentTreatmentRatio(1)
+	ctx := context.Background()
+	if err := svc.repo.SetStock(ctx, "main-store", "SKU-TELUR-01", 3); err != nil {
+		t.Fatalf("set stock failed: %v", err)
+	}
+
+	resp, err := svc.Recommend(ctx, domain.RecommendationRequest{
+		StoreID:   "main-store",
+		Limit:     5,
+		CartItems: []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}},
+	})
+	if err != nil {
+		t.Fatalf("recommend failed: %v", err)
+	}
+	if len(resp.Recommendations) == 0 {
+		t.Fatalf("expected recommendations, got %+v", resp)
+	}
+	skus := make([]string, 0, len(resp.Recommendations))
+	for _, rec := range resp.Recommendations {
+		skus = append(skus, rec.SKU)
+	}
+	stock, err := svc.repo.GetStockMap(ctx, "main-store", skus)
+	if err != nil {
+		t.Fatalf("get stock failed: %v", err)
+	}
+	for _, rec := range resp.Recommendations {
+		if rec.AvailableQty != stock[rec.SKU] {
+			t.Fatalf("expected %s available qty %d, got %d", rec.SKU, stock[rec.SKU], rec.AvailableQty)
+		}
+	}
+	if resp.Recommendation.AvailableQty != resp.Recommendations[0].AvailableQty {
+		t.Fatalf("expected top pick to carry its qty, got %+v", resp.Recommendation)
+	}
+}
+
+func TestRecommendUsesDefaultCooldown(t *testing.T) {
+	svc := newTestService()
+	svc.SetExperimentTreatmentRatio(1)
+	ctx := context.Background()
+
+	empty, err := svc.Recommend(ctx, domain.RecommendationRequest{StoreID: "main-store"})
+	if err != nil {
+		t.Fatalf("recommend failed: %v", err)
+	}
+	if empty.UIPolicy.Show || empty.UIPolicy.CooldownSeconds != recommendation.DefaultShowPolicy.CooldownSeconds {
+		t.Fatalf("expected hidden policy with default cooldown for an empty cart, got %+v", empty.UIPolicy)
+	}
+
+	shown, err := svc.Recommend(ctx, domain.RecommendationRequest{
+		StoreID:   "main-store",
+		CartItems: []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}},
+	})
+	if err != nil {
+		t.Fatalf("recommend failed: %v", err)
+	}
+	if !shown.UIPolicy.Show || shown.UIPolicy.CooldownSeconds != 45 {
+		t.Fatalf("expected shown policy with a 45 second cooldown, got %+v", shown.UIPolicy)
+	}
+
+	svc.recommender.SetShowPolicy(recommendation.ShowPolicy{CooldownSeconds: 20})
+	busy, err := svc.Recommend(ctx, domain.RecommendationRequest{
+		StoreID:        "main-store",
+		QueueSpeedHint: 20,
+		CartItems:      []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 2}},
+	})
+	if err != nil {
+		t.Fatalf("recommend failed: %v", err)
+	}
+	if busy.UIPolicy.CooldownSeconds != 70 {
+		t.Fatalf("expected a busy queue to keep its longer cooldown, got %+v", busy.UIPolicy)
+	}
+}
+
+func TestRecommendStopsAtPromptCap(t *testing.T) {
+	svc := newTestService()
+	svc.SetExperimentTreatmentRatio(1)
+	svc.recommender.SetShowPolicy(recommendation.ShowPolicy{CooldownSeconds: 30, MaxPromptsPerBasket: 2})
+	ctx := context.Background()
+	req := domain.RecommendationRequest{
+		StoreID:     "main-store",
+		PromptCount: 1,
+		CartItems:   []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}},
+	}
+
+	resp, err := svc.Recommend(ctx, req)
+	if err != nil {
+		t.Fatalf("recommend failed: %v", err)
+	}
+	if !resp.UIPolicy.Show || resp.Recommendation == nil {
+		t.Fatalf("expected a prompt below the cap, got %+v", resp)
+	}
+
+	req.PromptCount = 2
+	capped, err := svc.Recommend(ctx, req)
+	if err != nil {
+		t.Fatalf("recommend failed: %v", err)
+	}
+	if capped.UIPolicy.Show || capped.Recommendation != nil || capped.UIPolicy.CooldownSeconds != 30 {
+		t.Fatalf("expected no prompt once the basket hit the cap, got %+v", capped)
+	}
+
+	svc.recommender.SetShowPolicy(recommendation.ShowPolicy{MaxPromptsPerBasket: 0})
+	req.PromptCount = 10
+	uncapped, err := svc.Recommend(ctx, req)
+	if err != nil {
+		t.Fatalf("recommend failed: %v", err)
+	}
+	if uncapped.Recommendation == nil {
+		t.Fatalf("expected a zero cap to disable the limit, got %+v", uncapped)
+	}
+}
+
+type recordingEventWriter struct {
+	events []domain.RecommendationEvent
+}
+
+func (w *recordingEventWriter) Write(_ context.Context, events []domain.RecommendationEvent) {
+	w.events = append(w.events, events...)
+}
+
+func (w *recordingEventWriter) Close() error { return nil }
+
+func TestRecommendIgnoresSkewedClientTimestamp(t *testing.T) {
+	svc := newTestService()
+	svc.SetExperimentTreatmentRatio(1)
+	svc.SetClockSkewTolerance(2 * time.Minute)
+	writer := &recordingEventWriter{}
+	svc.SetRecommendationEventWriter(writer)
+	ctx := context.Background()
+
+	recommend := func(at time.Time) []domain.RecommendationEvent {
+		t.Helper()
+		writer.events = nil
+		resp, err := svc.Recommend(ctx, domain.RecommendationRequest{
+			StoreID:    "main-store",
+			TerminalID: "terminal-a1",
+			Timestamp:  &at,
+			CartItems:  []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}},
+		})
+		if err != nil {
+			t.Fatalf("recommend failed: %v", err)
+		}
+		if !resp.UIPolicy.Show || len(writer.events) == 0 {
+			t.Fatalf("expected a logged recommendation, got %+v", resp)
+		}
+		return writer.events
+	}
+
+	for _, event := range recommend(time.Now().Add(-time.Minute)) {
+		if event.ClockSkew {
+			t.Fatalf("expected timestamp within tolerance to be trusted, got %+v", event)
+		}
+	}
+	for _, event := range recommend(time.Now().Add(3 * time.Hour)) {
+		if !event.ClockSkew {
+			t.Fatalf("expected skewed timestamp to be flagged, got %+v", event)
+		}
+		if time.Since(event.CreatedAt).Abs() > time.Minute {
+			t.Fatalf("expected event stamped with server time, got %s", event.CreatedAt)
+		}
+	}
+}
+
+func TestRecommendSkipsTargetsBelowMinStock(t *testing.T) {
+	svc := newTestService()
+	svc.SetExperimentTreatmentRatio(1)
+	ctx := context.Background()
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	req := domain.RecommendationRequest{
+		StoreID:   "main-store",
+		Timestamp: &at,
+		Limit:     5,
+		CartItems: []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}},
+	}
+
+	if err := svc.repo.SetStock(ctx, "main-store", "SKU-TELUR-01", 0); err != nil {
+		t.Fatalf("set stock failed: %v", err)
+	}
+	resp, err := svc.Recommend(ctx, req)
+	if err != nil {
+		t.Fatalf("recommend failed: %v", err)
+	}
+	for _, rec := range resp.Recommendations {
+		if rec.SKU == "SKU-TELUR-01" {
+			t.Fatalf("recommended out-of-stock SKU-TELUR-01: %+v", resp)
+		}
+	}
+	if resp.Recommendation != nil && resp.Recommendation.SKU == "SKU-TELUR-01" {
+		t.Fatalf("recommended out-of-stock SKU-TELUR-01: %+v", resp)
+	}
+
+	if err := svc.repo.SetStock(ctx, "main-store", "SKU-TELUR-01", 3); err != nil {
+		t.Fatalf("set stock failed: %v", err)
+	}
+	svc.recommender.SetMinStock(5)
+	buffered, err := svc.Recommend(ctx, req)
+	if err != nil {
+		t.Fatalf("recommend failed: %v", err)
+	}
+	if buffered.Recommendation != nil {
+		t.Fatalf("expected no recommendation below the stock buffer, got %+v", buffered.Recommendation)
+	}
+
+	svc.recommender.SetMinStock(1)
+	restocked, err := svc.Recommend(ctx, req)
+	if err != nil {
+		t.Fatalf("recommend failed: %v", err)
+	}
+	if restocked.Recommendation == nil || restocked.Recommendation.SKU != "SKU-TELUR-01" {
+		t.Fatalf("expected SKU-TELUR-01 once stock clears the buffer, got %+v", restocked.Recommendation)
+	}
+}
+
+func TestRecommendControlBucketWithholdsSuggestions(t *testing.T) {
+	svc := newTestService()
+	ctx := context.Background()
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	req := domain.RecommendationRequest{
+		StoreID:    "main-store",
+		TerminalID: "terminal-a1",
+		Timestamp:  &at,
+		CartItems:  []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}},
+	}
+
+	svc.SetExperimentTreatmentRatio(0)
+	control, err := svc.Recommend(ctx, req)
+	if err != nil {
+		t.Fatalf("recommend failed: %v", err)
+	}
+	if control.ExperimentBucket != domain.ExperimentBucketControl {
+		t.Fatalf("expected control bucket, got %q", control.ExperimentBucket)
+	}
+	if control.UIPolicy.Show || control.Recommendation != nil || len(control.Recommendations) != 0 {
+		t.Fatalf("expected control to withhold recommendations, got %+v", control)
+	}
+
+	svc.SetExperimentTreatmentRatio(1)
+	treatment, err := svc.Recommend(ctx, req)
+	if err != nil {
+		t.Fatalf("recommend failed: %v", err)
+	}
+	if treatment.ExperimentBucket != domain.ExperimentBucketTreatment || !treatment.UIPolicy.Show || treatment.Recommendation == nil {
+		t.Fatalf("expected treatment to show a recommendation, got %+v", treatment)
+	}
+
+	adminCtx := WithActor(ctx, domain.Actor{Username: "admin", Role: "admin"})
+	if _, err := svc.OpenShift(adminCtx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	svc.SetExperimentTreatmentRatio(0)
+	if _, err := svc.Checkout(adminCtx, domain.CheckoutRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: "idem-bucket-control",
+		PaymentMethod: "cash", CashReceivedCents: 10000,
+		CartItems: []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}},
+	}); err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+	svc.SetExperimentTreatmentRatio(1)
+	if _, err := svc.Checkout(adminCtx, domain.CheckoutRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: "idem-bucket-treatment",
+		PaymentMethod: "cash", CashReceivedCents: 40000,
+		RecommendationInfo: domain.CheckoutRecommendationInfo{Shown: true, Accepted: true, SKU: "SKU-TELUR-01"},
+		CartItems:          []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}, {SKU: "SKU-TELUR-01", Qty: 1}},
+	}); err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+
+	metrics, err := svc.AttachMetrics(ctx, "main-store", 1)
+	if err != nil {
+		t.Fatalf("attach metrics failed: %v", err)
+	}
+	if len(metrics.ByBucket) != 2 {
+		t.Fatalf("expected metrics for both buckets, got %+v", metrics.ByBucket)
+	}
+	for _, bucket := range metrics.ByBucket {
+		switch bucket.Bucket {
+		case domain.ExperimentBucketControl:
+			if bucket.Transactions != 1 || bucket.Accepted != 0 {
+				t.Fatalf("unexpected control metrics: %+v", bucket)
+			}
+		case domain.ExperimentBucketTreatment:
+			if bucket.Transactions != 1 || bucket.Accepted != 1 || bucket.AttachRate != 100 {
+				t.Fatalf("unexpected treatment metrics: %+v", bucket)
+			}
+		default:
+			t.Fatalf("unexpected bucket %q", bucket.Bucket)
+		}
+	}
+}
+
+func TestManualAssociationPairSurvivesRetrain(t *testing.T) {
+	svc := newTestService()
+	svc.SetExperimentTreatmentRatio(1)
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	pair, err := svc.UpsertAssociationPair(ctx, domain.AssociationPairRequest{
+		SourceSKU: "sku-sabun-01", TargetSKU: "SKU-SHAMPOO-01", Affinity: 0.95,
+	})
+	if err != nil {
+		t.Fatalf("upsert pair failed: %v", err)
+	}
+	if !pair.Manual || pair.SourceSKU != "SKU-SABUN-01" {
+		t.Fatalf("unexpected pair: %+v", pair)
+	}
+	if _, err := svc.UpsertAssociationPair(ctx, domain.AssociationPairRequest{
+		SourceSKU: "SKU-SABUN-01", TargetSKU: "SKU-MISSING", Affinity: 0.5,
+	}); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected unknown target to be not found, got %v", err)
+	}
+
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	if _, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: "idem-manual-pair",
+		PaymentMethod: "cash", CashReceivedCents: 50000,
+		CartItems: []domain.CartItem{{SKU: "SKU-KOPI-01", Qty: 1}, {SKU: "SKU-GULA-01", Qty: 1}},
+	}); err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+	if _, err := svc.RetrainAssociations(ctx, domain.RetrainRequest{StoreID: "main-store"}); err != nil {
+		t.Fatalf("retrain failed: %v", err)
+	}
+
+	pairs, err := svc.repo.GetAssociationPairs(ctx, []string{"SKU-SABUN-01"})
+	if err != nil {
+		t.Fatalf("get pairs failed: %v", err)
+	}
+	if len(pairs) != 1 || !pairs[0].Manual || pairs[0].Affinity != 0.95 {
+		t.Fatalf("expected manual pair to survive retrain, got %+v", pairs)
+	}
+
+	if err := svc.DeleteAssociationPair(ctx, "SKU-SABUN-01", "SKU-SHAMPOO-01"); err != nil {
+		t.Fatalf("delete pair failed: %v", err)
+	}
+	if err := svc.DeleteAssociationPair(ctx, "SKU-SABUN-01", "SKU-SHAMPOO-01"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected second delete to be not found, got %v", err)
+	}
+}
+
+func TestRetrainComputesLiftAndFiltersByMinLift(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	baskets := [][]string{
+		{"SKU-KOPI-01", "SKU-GULA-01"},
+		{"SKU-KOPI-01", "SKU-GULA-01"},
+		{"SKU-MIE-01", "SKU-GULA-01"},
+		{"SKU-MIE-01"},
+	}
+	for i, basket := range baskets {
+		items := make([]domain.CartItem, 0, len(basket))
+		for _, sku := range basket {
+			items = append(items, domain.CartItem{SKU: sku, Qty: 1})
+		}
+		if _, err := svc.Checkout(ctx, domain.CheckoutRequest{
+			StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: "idem-lift-" + strconv.Itoa(i),
+			PaymentMethod: "cash", CashReceivedCents: 100000, CartItems: items,
+		}); err != nil {
+			t.Fatalf("checkout %d failed: %v", i, err)
+		}
+	}
+
+	resp, err := svc.RetrainAssociations(ctx, domain.RetrainRequest{StoreID: "main-store"})
+	if err != nil {
+		t.Fatalf("retrain failed: %v", err)
+	}
+	if resp.UpdatedPairs != 2 || resp.MinLift != 1.333 || resp.MaxLift != 1.333 {
+		t.Fatalf("unexpected retrain result with default min lift: %+v", resp)
+	}
+
+	pairs, err := svc.repo.GetAssociationPairs(ctx, []string{"SKU-KOPI-01"})
+	if err != nil {
+		t.Fatalf("get pairs failed: %v", err)
+	}
+	if len(pairs) != 1 || pairs[0].TargetSKU != "SKU-GULA-01" {
+		t.Fatalf("expected KOPI->GULA pair, got %+v", pairs)
+	}
+	if pairs[0].Support != 0.5 || pairs[0].Confidence != 1 {
+		t.Fatalf("unexpected support/confidence: %+v", pairs[0])
+	}
+
+	svc.SetMinLift(0)
+	all, err := svc.RetrainAssociations(ctx, domain.RetrainRequest{StoreID: "main-store"})
+	if err != nil {
+		t.Fatalf("retrain failed: %v", err)
+	}
+	if all.UpdatedPairs != 4 || all.MinLift != 0.667 || all.MaxLift != 1.333 {
+		t.Fatalf("unexpected retrain result without lift filter: %+v", all)
+	}
+}
+
+func TestCloseShiftBlockedByHeldCartsUnlessForced(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "cashier", Role: "cashier"})
+
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 50000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	if _, err := svc.HoldCart(ctx, domain.HoldCartRequest{
+		StoreID:    "main-store",
+		TerminalID: "terminal-a1",
+		Note:       "pelanggan ambil uang",
+		CartItems:  []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}},
+	}); err != nil {
+		t.Fatalf("hold cart failed: %v", err)
+	}
+
+	_, err := svc.CloseShift(ctx, domain.ShiftCloseRequest{StoreID: "main-store", TerminalID: "terminal-a1", ClosingCashCents: 50000})
+	if !errors.Is(err, ErrHeldCartsPending) {
+		t.Fatalf("expected held carts to block close, got %v", err)
+	}
+	if _, err := svc.GetActiveShift(ctx, "main-store", "terminal-a1"); err != nil {
+		t.Fatalf("expected shift to stay open, got %v", err)
+	}
+
+	closed, err := svc.CloseShift(ctx, domain.ShiftCloseRequest{StoreID: "main-store", TerminalID: "terminal-a1", ClosingCashCents: 50000, Force: true})
+	if err != nil {
+		t.Fatalf("forced close failed: %v", err)
+	}
+	if closed.Shift.Status != domain.ShiftStatusClosed {
+		t.Fatalf("expected closed shift, got %s", closed.Shift.Status)
+	}
+	carried, err := svc.ListHeldCarts(ctx, "main-store", "terminal-a1")
+	if err != nil {
+		t.Fatalf("list held carts failed: %v", err)
+	}
+	if len(carried.Items) != 1 {
+		t.Fatalf("expected held cart to be carried over, got %d", len(carried.Items))
+	}
+}
+
+func TestUpdateShiftCorrectsOpenShift(t *testing.T) {
+	svc := newTestService()
+	admin := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	opened, err := svc.OpenShift(admin, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 2500000,
+	})
+	if err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	shiftID := opened.Shift.ID
+
+	float := int64(250000)
+	cashier := WithActor(context.Background(), domain.Actor{Username: "cashier", Role: "cashier"})
+	if _, err := svc.UpdateShift(cashier, shiftID, domain.ShiftUpdateRequest{OpeningFloatCents: &float}); err == nil {
+		t.Fatalf("expected cashier update to be rejected")
+	}
+	negative := int64(-1)
+	if _, err := svc.UpdateShift(admin, shiftID, domain.ShiftUpdateRequest{OpeningFloatCents: &negative}); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected negative float to be rejected, got %v", err)
+	}
+
+	notes := "  salah ketik modal awal  "
+	updated, err := svc.UpdateShift(admin, shiftID, domain.ShiftUpdateRequest{OpeningFloatCents: &float, Notes: &notes})
+	if err != nil {
+		t.Fatalf("update shift failed: %v", err)
+	}
+	if updated.Shift.OpeningFloatCents != 250000 || updated.Shift.Notes != "salah ketik modal awal" {
+		t.Fatalf("unexpected updated shift: %+v", updated.Shift)
+	}
+	page, err := svc.ListAuditLogPage(admin, "main-store", "", domain.AuditLogFilter{Actions: []string{"shift_update"}}, "", 10)
+	if err != nil {
+		t.Fatalf("list audit logs failed: %v", err)
+	}
+	if len(page.Logs) != 1 || !strings.Contains(page.Logs[0].Detail, "opening_float=2500000->250000") {
+		t.Fatalf("expected audit entry with before and after float, got %+v", page.Logs)
+	}
+
+	if _, err := svc.CloseShift(admin, domain.ShiftCloseRequest{StoreID: "main-store", TerminalID: "terminal-a1", ClosingCashCents: 250000}); err != nil {
+		t.Fatalf("close shift failed: %v", err)
+	}
+	if _, err := svc.UpdateShift(admin, shiftID, domain.ShiftUpdateRequest{Notes: &notes}); !errors.Is(err, store.ErrShiftClosed) {
+		t.Fatalf("expected closed shift edit to be rejected, got %v", err)
+	}
+}
+
+type eventRecordingRepo struct {
+	store.Repository
+
+	mu      sync.Mutex
+	single  int
+	batched int
+	// failBatch makes every batch insert fail; events for failSKU also fail
+	// when inserted one at a time.
+	failBatch bool
+	failSKU   string
+}
+
+func (r *eventRecordingRepo) CreateRecommendationEvent(_ context.Context, event domain.RecommendationEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failSKU != "" && event.SKU == r.failSKU {
+		return errors.New("insert failed")
+	}
+	r.single++
+	return nil
+}
+
+func (r *eventRecordingRepo) CreateRecommendationEventsBatch(_ context.Context, events []domain.RecommendationEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failBatch {
+		return errors.New("batch insert failed")
+	}
+	r.batched += len(events)
+	return nil
+}
+
+func (r *eventRecordingRepo) persisted() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.single + r.batched
+}
+
+func TestAsyncEventWriterFlushesOnClose(t *testing.T) {
+	repo := &eventRecordingRepo{Repository: memory.NewSeeded()}
+	writer := NewAsyncEventWriter(repo, 4, 100, time.Hour)
+
+	events := make([]domain.RecommendationEvent, 10)
+	for i := range events {
+		events[i] = domain.RecommendationEvent{StoreID: "main-store", SKU: "SKU-TELUR-01", Action: domain.RecommendationShownAction}
+	}
+	writer.Write(context.Background(), events)
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	if got := repo.persisted(); got != len(events) {
+		t.Fatalf("expected %d events persisted, got %d", len(events), got)
+	}
+
+	writer.Write(context.Background(), events[:1])
+	if got := repo.persisted(); got != len(events)+1 {
+		t.Fatalf("expected writes after close to fall back to synchronous inserts")
+	}
+}
+
+func TestAsyncEventWriterRetriesFailedBatchPerEvent(t *testing.T) {
+	repo := &eventRecordingRepo{Repository: memory.NewSeeded(), failBatch: true, failSKU: "SKU-BROKEN"}
+	writer := NewAsyncEventWriter(repo, 16, 100, time.Hour)
+
+	events := make([]domain.RecommendationEvent, 5)
+	for i := range events {
+		events[i] = domain.RecommendationEvent{StoreID: "main-store", SKU: "SKU-TELUR-01", Action: domain.RecommendationShownAction}
+	}
+	events[2].SKU = "SKU-BROKEN"
+	writer.Write(context.Background(), events)
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	if got := repo.persisted(); got != len(events)-1 {
+		t.Fatalf("expected %d events persisted after the batch failed, got %d", len(events)-1, got)
+	}
+	if got := writer.Dropped(); got != 1 {
+		t.Fatalf("expected 1 dropped event, got %d", got)
+	}
+}
+
+type recordingCache struct {
+	cache.NoopRecommendationCache
+
+	mu          sync.Mutex
+	invalidated []string
+}
+
+func (c *recordingCache) Invalidate(_ context.Context, storeID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidated = append(c.invalidated, storeID)
+	return nil
+}
+
+func TestRetrainInvalidatesRecommendationCacheForStore(t *testing.T) {
+	fake := &recordingCache{}
+	svc := New(memory.NewSeeded(), recommendation.NewEngine(fake, 5*time.Second), "main-store")
+
+	if _, err := svc.RetrainAssociations(context.Background(), domain.RetrainRequest{StoreID: "branch-store"}); err != nil {
+		t.Fatalf("retrain failed: %v", err)
+	}
+	if _, err := svc.RetrainAssociations(context.Background(), domain.RetrainRequest{}); err != nil {
+		t.Fatalf("retrain failed: %v", err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.invalidated) != 2 || fake.invalidated[0] != "branch-store" || fake.invalidated[1] != "main-store" {
+		t.Fatalf("expected invalidation for branch-store then main-store, got %v", fake.invalidated)
+	}
+}
+
+func TestRecommendFallsBackToCategoryAffinity(t *testing.T) {
+	svc := newTestService()
+	svc.SetExperimentTreatmentRatio(1)
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := svc.Checkout(ctx, domain.CheckoutRequest{
+			StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: "idem-category-" + strconv.Itoa(i),
+			PaymentMethod: "cash", CashReceivedCents: 100000,
+			CartItems: []domain.CartItem{{SKU: "SKU-SABUN-01", Qty: 1}, {SKU: "SKU-COKLAT-01", Qty: 1}},
+		}); err != nil {
+			t.Fatalf("checkout %d failed: %v", i, err)
+		}
+	}
+	if _, err := svc.RetrainAssociations(ctx, domain.RetrainRequest{StoreID: "main-store"}); err != nil {
+		t.Fatalf("retrain failed: %v", err)
+	}
+
+	resp, err := svc.Recommend(ctx, domain.RecommendationRequest{
+		StoreID:    "main-store",
+		TerminalID: "terminal-a1",
+		CartItems:  []domain.CartItem{{SKU: "SKU-SHAMPOO-01", Qty: 1}},
+	})
+	if err != nil {
+		t.Fatalf("recommend failed: %v", err)
+	}
+	if resp.Recommendation == nil {
+		t.Fatalf("expected a category fallback recommendation")
+	}
+	if resp.Recommendation.ReasonCode != "category_fallback" || resp.Recommendation.SKU != "SKU-KERIPIK-01" {
+		t.Fatalf("expected highest-margin snack via category fallback, got %+v", resp.Recommendation)
+	}
+}
+
+func TestRangeReportBucketsByWeekWithGrandTotal(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := svc.Checkout(ctx, domain.CheckoutRequest{
+			StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: "idem-range-" + strconv.Itoa(i),
+			PaymentMethod: "cash", CashReceivedCents: 100000,
+			CartItems: []domain.CartItem{{SKU: "SKU-ROTI-01", Qty: 1}},
+		}); err != nil {
+			t.Fatalf("checkout %d failed: %v", i, err)
+		}
+	}
+
+	today := time.Now().UTC()
+	from := today.AddDate(0, 0, -20).Format("2006-01-02")
+	report, err := svc.RangeReport(ctx, "main-store", from, today.Format("2006-01-02"), "week")
+	if err != nil {
+		t.Fatalf("range report failed: %v", err)
+	}
+	if len(report.Buckets) < 3 || len(report.Buckets) > 4 {
+		t.Fatalf("expected 3-4 weekly buckets over 21 days, got %d", len(report.Buckets))
+	}
+	last := report.Buckets[len(report.Buckets)-1]
+	if last.Transactions != 2 || last.NetSalesCents != report.Total.NetSalesCents {
+		t.Fatalf("expected current week to hold both sales, got %+v (total %+v)", last, report.Total)
+	}
+	if report.Total.Transactions != 2 || report.Total.EstimatedMarginCents == 0 {
+		t.Fatalf("unexpected grand total: %+v", report.Total)
+	}
+	for _, bucket := range report.Buckets {
+		if start, _ := time.Parse("2006-01-02", bucket.PeriodStart); start.Weekday() != time.Monday {
+			t.Fatalf("expected weekly buckets to start on Monday, got %s", bucket.PeriodStart)
+		}
+	}
+
+	if _, err := svc.RangeReport(ctx, "main-store", from, today.Format("2006-01-02"), "quarter"); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected invalid group_by to be rejected, got %v", err)
+	}
+}
+
+func TestSalesBySupplierUsesLatestReceivedPurchaseOrder(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	supplierA, err := svc.CreateSupplier(ctx, domain.SupplierCreateRequest{Name: "Supplier A"})
+	if err != nil {
+		t.Fatalf("create supplier failed: %v", err)
+	}
+	supplierB, err := svc.CreateSupplier(ctx, domain.SupplierCreateRequest{Name: "Supplier B"})
+	if err != nil {
+		t.Fatalf("create supplier failed: %v", err)
+	}
+	// Both carry roti; B was mapped first but is the one actually ordered from.
+	for _, mapping := range []struct {
+		supplierID string
+		sku        string
+	}{{supplierB.ID, "SKU-ROTI-01"}, {supplierA.ID, "SKU-ROTI-01"}, {supplierA.ID, "SKU-KOPI-01"}} {
+		if _, err := svc.SetSupplierProduct(ctx, mapping.supplierID, domain.SupplierProductSetRequest{SKU: mapping.sku, DefaultCostCents: 1000}); err != nil {
+			t.Fatalf("map %s to %s failed: %v", mapping.sku, mapping.supplierID, err)
+		}
+	}
+	po, err := svc.CreatePurchaseOrder(ctx, domain.PurchaseOrderCreateRequest{
+		StoreID: "main-store", SupplierID: supplierB.ID,
+		Items: []domain.PurchaseOrderItem{{SKU: "SKU-ROTI-01", Qty: 10, CostCents: 3000}},
+	})
+	if err != nil {
+		t.Fatalf("create purchase order failed: %v", err)
+	}
+	if _, err := svc.ReceivePurchaseOrder(ctx, po.PurchaseOrder.ID, domain.PurchaseOrderReceiveRequest{ReceivedBy: "admin"}); err != nil {
+		t.Fatalf("receive purchase order failed: %v", err)
+	}
+
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	sale, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: "idem-by-supplier",
+		PaymentMethod: "cash", CashReceivedCents: 500000,
+		CartItems: []domain.CartItem{{SKU: "SKU-ROTI-01", Qty: 2}, {SKU: "SKU-KOPI-01", Qty: 1}, {SKU: "SKU-SUSU-01", Qty: 1}},
+	})
+	if err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+	tx, err := svc.repo.FindTransactionByID(ctx, sale.TransactionID)
+	if err != nil {
+		t.Fatalf("find sale failed: %v", err)
+	}
+	lineTotals := map[string]int64{}
+	for _, item := range tx.Items {
+		lineTotals[item.SKU] = item.UnitPriceCents * int64(item.Qty)
+	}
+
+	today := time.Now().UTC().Format("2006-01-02")
+	report, err := svc.SalesBySupplier(ctx, "main-store", today, today)
+	if err != nil {
+		t.Fatalf("sales by supplier failed: %v", err)
+	}
+	bySupplier := map[string]domain.SupplierSalesLine{}
+	for _, line := range report.Suppliers {
+		bySupplier[line.SupplierID] = line
+	}
+	if len(bySupplier) != 3 {
+		t.Fatalf("expected lines for A, B and unassigned, got %+v", report.Suppliers)
+	}
+	if b := bySupplier[supplierB.ID]; b.Units != 2 || b.RevenueCents != lineTotals["SKU-ROTI-01"] || b.SupplierName != "Supplier B" || b.MarginCents == 0 {
+		t.Fatalf("expected roti attributed to the PO supplier B, got %+v", b)
+	}
+	if a := bySupplier[supplierA.ID]; a.SKUs != 1 || a.Units != 1 || a.RevenueCents != lineTotals["SKU-KOPI-01"] {
+		t.Fatalf("expected only kopi under supplier A, got %+v", a)
+	}
+	if none := bySupplier[""]; none.Units != 1 || none.RevenueCents != lineTotals["SKU-SUSU-01"] {
+		t.Fatalf("expected unmapped susu under no supplier, got %+v", none)
+	}
+
+	if _, err := svc.SalesBySupplier(ctx, "main-store", today, ""); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected a missing to date to be rejected, got %v", err)
+	}
+}
+
+func TestHourlySalesBucketsByStoreLocalHour(t *testing.T) {
+	svc := newTestService()
+	loc := time.FixedZone("UTC+7", 7*3600)
+	svc.SetStoreLocation(loc)
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	tx, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: "idem-hourly-1",
+		PaymentMethod: "cash", CashReceivedCents: 100000,
+		CartItems: []domain.CartItem{{SKU: "SKU-SUSU-01", Qty: 1}},
+	})
 	if err != nil {
 		t.Fatalf("checkout failed: %v", err)
 	}
 
-	_, err = svc.Refund(ctx, domain.RefundRequest{
-		OriginalTransactionID: resp.TransactionID,
-		Reason:                "full refund",
-		AmountCents:           resp.TotalCents,
-	})
+	createdAt, err := time.Parse(time.RFC3339, tx.CreatedAt)
 	if err != nil {
-		t.Fatalf("refund failed: %v", err)
+		t.Fatalf("parse created_at: %v", err)
+	}
+	local := createdAt.In(loc)
+	report, err := svc.GetHourlySales(ctx, "main-store", local.Format("2006-01-02"))
+	if err != nil {
+		t.Fatalf("hourly sales failed: %v", err)
+	}
+	if len(report.Hours) != 24 {
+		t.Fatalf("expected 24 hourly buckets, got %d", len(report.Hours))
+	}
+	for _, bucket := range report.Hours {
+		if bucket.Hour == local.Hour() {
+			if bucket.Transactions != 1 || bucket.TotalCents != tx.TotalCents {
+				t.Fatalf("expected sale in local hour %d, got %+v", local.Hour(), bucket)
+			}
+		} else if bucket.Transactions != 0 {
+			t.Fatalf("unexpected sales in hour %d: %+v", bucket.Hour, bucket)
+		}
 	}
+}
 
-	_, err = svc.VoidTransaction(ctx, domain.VoidTransactionRequest{
-		TransactionID: resp.TransactionID,
-		Reason:        "void after refund",
-	})
-	if err == nil {
-		t.Fatalf("expected void to fail for refunded transaction")
+func TestDailyReportUsesStoreTimezoneDayBoundary(t *testing.T) {
+	svc := newTestService()
+	loc := time.FixedZone("UTC+7", 7*3600)
+	svc.SetStoreLocation(loc)
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	sales := []time.Time{
+		time.Date(2026, 3, 10, 23, 30, 0, 0, loc),
+		time.Date(2026, 3, 11, 0, 30, 0, 0, loc),
+	}
+	for i, at := range sales {
+		if _, err := svc.repo.CreateCheckout(ctx, domain.Transaction{
+			ID:                "tx-tz-" + strconv.Itoa(i),
+			StoreID:           "main-store",
+			TerminalID:        "terminal-a1",
+			IdempotencyKey:    "idem-tz-" + strconv.Itoa(i),
+			PaymentMethod:     "cash",
+			CashReceivedCents: 100000,
+			Status:            domain.TxStatusPaid,
+			Items:             []domain.TransactionLine{{SKU: "SKU-ROTI-01", Qty: 1, UnitPriceCents: 17800, MarginRate: 0.30}},
+			CreatedAt:         at.UTC(),
+		}); err != nil {
+			t.Fatalf("create transaction %d failed: %v", i, err)
+		}
+	}
+
+	for _, date := range []string{"2026-03-10", "2026-03-11"} {
+		report, err := svc.DailyReport(ctx, "main-store", date)
+		if err != nil {
+			t.Fatalf("daily report %s failed: %v", date, err)
+		}
+		if report.Date != date || report.Transactions != 1 {
+			t.Fatalf("expected exactly one sale on local day %s, got %+v", date, report)
+		}
+	}
+
+	hourly, err := svc.GetHourlySales(ctx, "main-store", "2026-03-10")
+	if err != nil {
+		t.Fatalf("hourly sales failed: %v", err)
+	}
+	if hourly.Hours[23].Transactions != 1 {
+		t.Fatalf("expected the 23:30 sale in local hour 23, got %+v", hourly.Hours[23])
 	}
 }
 
-func TestRefundRejectsVoidedTransactionWithInvalidTransactionError(t *testing.T) {
+func TestAttachMetricsByReasonCountsShownAndAccepted(t *testing.T) {
 	svc := newTestService()
-	ctx := WithActor(context.Background(), domain.Actor{
-		Username: "admin",
-		Role:     "admin",
+	svc.SetExperimentTreatmentRatio(1)
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+
+	var shown *domain.Recommendation
+	for i := 0; i < 2; i++ {
+		resp, err := svc.Recommend(ctx, domain.RecommendationRequest{
+			StoreID:    "main-store",
+			TerminalID: "terminal-a1",
+			CartItems:  []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}},
+		})
+		if err != nil || resp.Recommendation == nil {
+			t.Fatalf("expected a recommendation, got %+v (err %v)", resp, err)
+		}
+		shown = resp.Recommendation
+	}
+
+	if _, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: "idem-reason-1",
+		PaymentMethod: "cash", CashReceivedCents: 100000,
+		RecommendationInfo: domain.CheckoutRecommendationInfo{
+			Shown: true, Accepted: true, SKU: shown.SKU, ReasonCode: shown.ReasonCode, Confidence: shown.Confidence,
+		},
+		CartItems: []domain.CartItem{{SKU: "SKU-MIE-01", Qty: 1}, {SKU: shown.SKU, Qty: 1}},
+	}); err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+
+	byReason, err := svc.AttachMetricsByReason(ctx, "main-store", 1)
+	if err != nil {
+		t.Fatalf("attach metrics by reason failed: %v", err)
+	}
+	if len(byReason) != 1 {
+		t.Fatalf("expected a single reason code, got %+v", byReason)
+	}
+	got := byReason[0]
+	if got.ReasonCode != shown.ReasonCode || got.Shown != 2 || got.Accepted != 1 || got.AttachRate != 50 {
+		t.Fatalf("unexpected reason breakdown: %+v", got)
+	}
+}
+
+func TestDailyReportCostOfGoodsUsesCostFrozenAtSale(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	if err := svc.repo.UpsertProductCost(ctx, "main-store", "SKU-ROTI-01", 12000); err != nil {
+		t.Fatalf("upsert cost failed: %v", err)
+	}
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	if _, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: "idem-cogs-1",
+		PaymentMethod: "cash", CashReceivedCents: 100000,
+		CartItems: []domain.CartItem{{SKU: "SKU-ROTI-01", Qty: 2}},
+	}); err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+
+	if err := svc.repo.UpsertProductCost(ctx, "main-store", "SKU-ROTI-01", 15000); err != nil {
+		t.Fatalf("upsert cost failed: %v", err)
+	}
+
+	report, err := svc.DailyReport(ctx, "main-store", "")
+	if err != nil {
+		t.Fatalf("daily report failed: %v", err)
+	}
+	if report.CostOfGoodsCents != 24000 {
+		t.Fatalf("expected COGS from the cost at sale time (24000), got %d", report.CostOfGoodsCents)
+	}
+	if report.GrossProfitCents != report.NetSalesCents-report.CostOfGoodsCents-report.TaxCents {
+		t.Fatalf("unexpected gross profit: %+v", report)
+	}
+}
+
+func TestDailyReportMarginIsImmutableAfterCostChanges(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	if err := svc.repo.UpsertProductCost(ctx, "main-store", "SKU-ROTI-01", 12000); err != nil {
+		t.Fatalf("upsert cost failed: %v", err)
+	}
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", CashierName: "Kasir A", OpeningFloatCents: 100000,
+	}); err != nil {
+		t.Fatalf("open shift failed: %v", err)
+	}
+	if _, err := svc.Checkout(ctx, domain.CheckoutRequest{
+		StoreID: "main-store", TerminalID: "terminal-a1", IdempotencyKey: "idem-margin-1",
+		PaymentMethod: "cash", CashReceivedCents: 100000,
+		CartItems: []domain.CartItem{{SKU: "SKU-ROTI-01", Qty: 2}},
+	}); err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+
+	before, err := svc.DailyReport(ctx, "main-store", "")
+	if err != nil {
+		t.Fatalf("daily report failed: %v", err)
+	}
+	if before.EstimatedMarginCents != (17800-12000)*2 {
+		t.Fatalf("expected margin from the cost at sale time, got %d", before.EstimatedMarginCents)
+	}
+
+	if err := svc.repo.UpsertProductCost(ctx, "main-store", "SKU-ROTI-01", 17000); err != nil {
+		t.Fatalf("upsert cost failed: %v", err)
+	}
+	after, err := svc.DailyReport(ctx, "main-store", "")
+	if err != nil {
+		t.Fatalf("daily report failed: %v", err)
+	}
+	if after.EstimatedMarginCents != before.EstimatedMarginCents {
+		t.Fatalf("expected historical margin to stay %d after a cost change, got %d", before.EstimatedMarginCents, after.EstimatedMarginCents)
+	}
+}
+
+func TestDetectAnomaliesFlagsPriceChangeSpike(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	cut := int64(9000)
+	if _, err := svc.UpdateProduct(ctx, "SKU-ROTI-01", domain.ProductUpdateRequest{PriceCents: &cut}); err != nil {
+		t.Fatalf("update price failed: %v", err)
+	}
+	small := int64(3700)
+	if _, err := svc.UpdateProduct(ctx, "SKU-AIR-01", domain.ProductUpdateRequest{PriceCents: &small}); err != nil {
+		t.Fatalf("update price failed: %v", err)
+	}
+
+	resp, err := svc.DetectOperationalAnomalies(ctx, "main-store", "")
+	if err != nil {
+		t.Fatalf("detect anomalies failed: %v", err)
+	}
+	var found *domain.OperationalAlert
+	for i := range resp.Alerts {
+		if resp.Alerts[i].Code == "price_change_spike" {
+			found = &resp.Alerts[i]
+		}
+	}
+	if found == nil {
+		t.Fatalf("expected a price_change_spike alert, got %+v", resp.Alerts)
+	}
+	if found.Severity != "high" || found.MetricValue != 1 {
+		t.Fatalf("expected one high severity price cut, got %+v", found)
+	}
+	if !strings.Contains(found.Description, "SKU-ROTI-01") || strings.Contains(found.Description, "SKU-AIR-01") {
+		t.Fatalf("expected only the large change's SKU in the description, got %q", found.Description)
+	}
+}
+
+func TestDetectAnomaliesFlagsAfterHoursSales(t *testing.T) {
+	svc := newTestService()
+	loc := time.FixedZone("UTC+7", 7*3600)
+	svc.SetStoreLocation(loc)
+	if err := svc.SetBusinessHours("", "7-22"); err != nil {
+		t.Fatalf("set default hours failed: %v", err)
+	}
+	if err := svc.SetBusinessHours("main-store", "8-21"); err != nil {
+		t.Fatalf("set store hours failed: %v", err)
+	}
+	svc.SetAfterHoursSalesThreshold(2)
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	sales := []time.Time{
+		time.Date(2026, 3, 10, 6, 30, 0, 0, loc),
+		time.Date(2026, 3, 10, 12, 0, 0, 0, loc),
+		time.Date(2026, 3, 10, 21, 30, 0, 0, loc),
+	}
+	for i, at := range sales {
+		if _, err := svc.repo.CreateCheckout(ctx, domain.Transaction{
+			ID:                "tx-after-" + strconv.Itoa(i),
+			StoreID:           "main-store",
+			TerminalID:        "terminal-a1",
+			IdempotencyKey:    "idem-after-" + strconv.Itoa(i),
+			PaymentMethod:     "cash",
+			CashReceivedCents: 100000,
+			Status:            domain.TxStatusPaid,
+			Items:             []domain.TransactionLine{{SKU: "SKU-ROTI-01", Qty: 1, UnitPriceCents: 17800, MarginRate: 0.30}},
+			CreatedAt:         at.UTC(),
+		}); err != nil {
+			t.Fatalf("create transaction %d failed: %v", i, err)
+		}
+	}
+
+	resp, err := svc.DetectOperationalAnomalies(ctx, "main-store", "2026-03-10")
+	if err != nil {
+		t.Fatalf("detect anomalies failed: %v", err)
+	}
+	var found *domain.OperationalAlert
+	for i := range resp.Alerts {
+		if resp.Alerts[i].Code == "after_hours_sales" {
+			found = &resp.Alerts[i]
+		}
+	}
+	if found == nil {
+		t.Fatalf("expected an after_hours_sales alert, got %+v", resp.Alerts)
+	}
+	if found.Severity != "medium" || found.MetricValue != 2 {
+		t.Fatalf("expected two after-hours sales at medium severity, got %+v", found)
+	}
+	if !strings.Contains(found.Description, "08:00-21:00") {
+		t.Fatalf("expected the store's business hours in the description, got %q", found.Description)
+	}
+
+	if err := svc.SetBusinessHours("main-store", "22-6"); err != nil {
+		t.Fatalf("set overnight hours failed: %v", err)
+	}
+	resp, err = svc.DetectOperationalAnomalies(ctx, "main-store", "2026-03-10")
+	if err != nil {
+		t.Fatalf("detect anomalies failed: %v", err)
+	}
+	for _, alert := range resp.Alerts {
+		if alert.Code == "after_hours_sales" && alert.MetricValue != 3 {
+			t.Fatalf("expected every sale outside 22:00-06:00 hours, got %+v", alert)
+		}
+	}
+	if err := svc.SetBusinessHours("main-store", "9-9"); err == nil {
+		t.Fatalf("expected empty business hours to be rejected")
+	}
+}
+
+func TestDetectAnomaliesHonoursConfiguredThresholds(t *testing.T) {
+	cases := []struct {
+		name       string
+		global     domain.AnomalyThresholds
+		store      domain.AnomalyThresholds
+		want       domain.AnomalyThresholds
+		wantAlerts []string
+	}{
+		{
+			name:       "defaults",
+			want:       domain.AnomalyThresholds{VoidsPerActor: 3, RefundsPerActor: 2, ManualOverrides: 5, StockOpnames: 3},
+			wantAlerts: []string{"refund_spike"},
+		},
+		{
+			name:       "stricter global",
+			global:     domain.AnomalyThresholds{VoidsPerActor: 2, StockOpnames: 1},
+			want:       domain.AnomalyThresholds{VoidsPerActor: 2, RefundsPerActor: 2, ManualOverrides: 5, StockOpnames: 1},
+			wantAlerts: []string{"refund_spike", "stock_opname_frequency", "void_spike"},
+		},
+		{
+			name:       "lenient store override",
+			global:     domain.AnomalyThresholds{VoidsPerActor: 2},
+			store:      domain.AnomalyThresholds{VoidsPerActor: 10, RefundsPerActor: 4},
+			want:       domain.AnomalyThresholds{VoidsPerActor: 10, RefundsPerActor: 4, ManualOverrides: 5, StockOpnames: 3},
+			wantAlerts: []string{},
+		},
+	}
+
+	actions := map[string]int{"void_transaction": 2, "refund_transaction": 2, "stock_opname": 1}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := newTestService()
+			svc.SetAnomalyThresholds("", tc.global)
+			svc.SetAnomalyThresholds("main-store", tc.store)
+			ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+			for action, count := range actions {
+				for i := 0; i < count; i++ {
+					svc.logAudit(ctx, "main-store", action, "transaction", action+"-"+strconv.Itoa(i), "")
+				}
+			}
+
+			resp, err := svc.DetectOperationalAnomalies(ctx, "main-store", "")
+			if err != nil {
+				t.Fatalf("detect anomalies failed: %v", err)
+			}
+			if resp.Thresholds != tc.want {
+				t.Fatalf("expected thresholds %+v, got %+v", tc.want, resp.Thresholds)
+			}
+			codes := []string{}
+			for _, alert := range resp.Alerts {
+				codes = append(codes, alert.Code)
+			}
+			sort.Strings(codes)
+			if strings.Join(codes, ",") != strings.Join(tc.wantAlerts, ",") {
+				t.Fatalf("expected alerts %v, got %v", tc.wantAlerts, codes)
+			}
+		})
+	}
+}
+
+func TestListAuditLogPageWalksCursorWithoutGaps(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	at := time.Now().UTC().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		// Two entries share each timestamp so the id tie-break is exercised.
+		if err := svc.repo.CreateAuditLog(ctx, domain.AuditLog{
+			ID:            "audit-page-" + strconv.Itoa(i),
+			StoreID:       "main-store",
+			ActorUsername: "admin",
+			ActorRole:     "admin",
+			Action:        "update_product",
+			CreatedAt:     at.Add(time.Duration(i/2) * time.Minute),
+		}); err != nil {
+			t.Fatalf("create audit log failed: %v", err)
+		}
+	}
+
+	seen := []string{}
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatalf("cursor did not terminate, seen %v", seen)
+		}
+		page, err := svc.ListAuditLogPage(ctx, "main-store", "", domain.AuditLogFilter{}, cursor, 2)
+		if err != nil {
+			t.Fatalf("list page failed: %v", err)
+		}
+		for _, entry := range page.Logs {
+			seen = append(seen, entry.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	want := "audit-page-4,audit-page-3,audit-page-2,audit-page-1,audit-page-0"
+	if strings.Join(seen, ",") != want {
+		t.Fatalf("expected %s, got %v", want, seen)
+	}
+
+	if _, err := svc.ListAuditLogPage(ctx, "main-store", "", domain.AuditLogFilter{}, "not-a-cursor", 2); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected invalid cursor to be rejected, got %v", err)
+	}
+}
+
+func TestListAuditLogPageFiltersByActionAndActor(t *testing.T) {
+	svc := newTestService()
+	ctx := context.Background()
+
+	entries := []struct{ actor, action string }{
+		{"kasir-a", "void_transaction"},
+		{"kasir-a", "refund_transaction"},
+		{"kasir-a", "checkout"},
+		{"kasir-b", "void_transaction"},
+	}
+	for i, entry := range entries {
+		svc.logAudit(WithActor(ctx, domain.Actor{Username: entry.actor, Role: "cashier"}), "main-store", entry.action, "transaction", "tx-"+strconv.Itoa(i), "")
+	}
+
+	admin := WithActor(ctx, domain.Actor{Username: "admin", Role: "admin"})
+	page, err := svc.ListAuditLogPage(admin, "main-store", "", domain.AuditLogFilter{
+		Actions: []string{"void_transaction", " refund_transaction", ""},
+		Actor:   "kasir-a",
+	}, "", 50)
+	if err != nil {
+		t.Fatalf("list audit logs failed: %v", err)
+	}
+	if len(page.Logs) != 2 {
+		t.Fatalf("expected kasir-a's void and refund only, got %+v", page.Logs)
+	}
+	for _, entry := range page.Logs {
+		if entry.ActorUsername != "kasir-a" || entry.Action == "checkout" {
+			t.Fatalf("unexpected entry in filtered page: %+v", entry)
+		}
+	}
+}
+
+func TestCreatePromoAcceptsClientSuppliedID(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	req := domain.PromoCreateRequest{ID: "promo-ramadan-2026", Name: "Ramadan", Type: "cart_percent", DiscountPercent: 10}
+
+	promo, _, err := svc.CreatePromo(ctx, req)
+	if err != nil {
+		t.Fatalf("create promo failed: %v", err)
+	}
+	if promo.ID != "promo-ramadan-2026" {
+		t.Fatalf("expected the client ID to be kept, got %q", promo.ID)
+	}
+	if _, _, err := svc.CreatePromo(ctx, req); !errors.Is(err, store.ErrDuplicateID) {
+		t.Fatalf("expected ErrDuplicateID for a reused ID, got %v", err)
+	}
+	req.ID = "promo ramadan"
+	if _, _, err := svc.CreatePromo(ctx, req); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected a malformed ID to be rejected, got %v", err)
+	}
+
+	svc.SetIDGenerator(xid.ULID{})
+	req.ID = ""
+	req.Name = "Ramadan Pekan 2"
+	generated, _, err := svc.CreatePromo(ctx, req)
+	if err != nil {
+		t.Fatalf("create promo failed: %v", err)
+	}
+	if !strings.HasPrefix(generated.ID, "promo-") || len(generated.ID) != len("promo-")+26 {
+		t.Fatalf("expected a ULID promo ID, got %q", generated.ID)
+	}
+}
+
+func TestCreatePromoReturnsActivePromoWithSameName(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	req := domain.PromoCreateRequest{Name: "Gajian", Type: "flat_cart", FlatDiscountCents: 5000}
+
+	first, created, err := svc.CreatePromo(ctx, req)
+	if err != nil || !created {
+		t.Fatalf("create promo failed: created=%v err=%v", created, err)
+	}
+	req.Name = " gajian "
+	again, created, err := svc.CreatePromo(ctx, req)
+	if err != nil {
+		t.Fatalf("repeat create failed: %v", err)
+	}
+	if created || again.ID != first.ID {
+		t.Fatalf("expected the existing promo %s back, got created=%v id=%s", first.ID, created, again.ID)
+	}
+	promos, _ := svc.ListPromos(ctx)
+	if len(promos) != 1 {
+		t.Fatalf("expected one promo, got %d", len(promos))
+	}
+
+	if _, err := svc.SetPromoActive(ctx, first.ID, false); err != nil {
+		t.Fatalf("deactivate failed: %v", err)
+	}
+	reused, created, err := svc.CreatePromo(ctx, req)
+	if err != nil || !created || reused.ID == first.ID {
+		t.Fatalf("expected a deactivated promo's name to be reusable, got created=%v id=%s err=%v", created, reused.ID, err)
+	}
+	if _, err := svc.SetPromoActive(ctx, first.ID, true); !errors.Is(err, store.ErrDuplicatePromoName) {
+		t.Fatalf("expected ErrDuplicatePromoName when reactivating a taken name, got %v", err)
+	}
+}
+
+func TestSetStockBulkOverwritesQuantitiesAllOrNothing(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	resp, err := svc.SetStockBulk(ctx, domain.StockBulkSetRequest{
+		StoreID: "branch-2",
+		Items:   []domain.StockAdjustment{{SKU: "sku-mie-01", Qty: 50}, {SKU: "SKU-KOPI-01", Qty: 0}},
 	})
+	if err != nil {
+		t.Fatalf("bulk set failed: %v", err)
+	}
+	if resp.SKUCount != 2 || resp.TotalQty != 50 {
+		t.Fatalf("unexpected summary %+v", resp)
+	}
+	stock, err := svc.repo.GetStockMap(ctx, "branch-2", []string{"SKU-MIE-01", "SKU-KOPI-01"})
+	if err != nil {
+		t.Fatalf("get stock failed: %v", err)
+	}
+	if stock["SKU-MIE-01"] != 50 || stock["SKU-KOPI-01"] != 0 {
+		t.Fatalf("unexpected stock %+v", stock)
+	}
 
-	_, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
+	_, err = svc.SetStockBulk(ctx, domain.StockBulkSetRequest{
+		StoreID: "branch-2",
+		Items:   []domain.StockAdjustment{{SKU: "SKU-MIE-01", Qty: 7}, {SKU: "SKU-HILANG-01", Qty: 3}},
+	})
+	var skuErr *store.SKUError
+	if !errors.Is(err, store.ErrNotFound) || !errors.As(err, &skuErr) || skuErr.SKU != "SKU-HILANG-01" {
+		t.Fatalf("expected the unknown SKU to fail the batch, got %v", err)
+	}
+	if _, err := svc.SetStockBulk(ctx, domain.StockBulkSetRequest{
+		Items: []domain.StockAdjustment{{SKU: "SKU-MIE-01", Qty: 7}, {SKU: "SKU-MIE-01", Qty: 8}},
+	}); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected a repeated SKU to be rejected, got %v", err)
+	}
+	stock, _ = svc.repo.GetStockMap(ctx, "branch-2", []string{"SKU-MIE-01"})
+	if stock["SKU-MIE-01"] != 50 {
+		t.Fatalf("expected a failed batch to leave stock untouched, got %d", stock["SKU-MIE-01"])
+	}
+}
+
+func TestCheckoutTaxesLinesAtProductRates(t *testing.T) {
+	svc := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+	exempt := 0.0
+	if _, err := svc.UpdateProduct(ctx, "SKU-SUSU-01", domain.ProductUpdateRequest{TaxRatePercent: &exempt}); err != nil {
+		t.Fatalf("tag product exempt: %v", err)
+	}
+	invalid := 120.0
+	if _, err := svc.UpdateProduct(ctx, "SKU-ROTI-01", domain.ProductUpdateRequest{TaxRatePercent: &invalid}); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected a rate over 100 to be rejected, got %v", err)
+	}
+	if _, err := svc.OpenShift(ctx, domain.ShiftOpenRequest{
 		StoreID:           "main-store",
 		TerminalID:        "terminal-a1",
 		CashierName:       "Kasir A",
 		OpeningFloatCents: 250000,
-	})
-	if err != nil {
+	}); err != nil {
 		t.Fatalf("open shift failed: %v", err)
 	}
 
 	resp, err := svc.Checkout(ctx, domain.CheckoutRequest{
 		StoreID:           "main-store",
 		TerminalID:        "terminal-a1",
-		IdempotencyKey:    "idem-void-before-refund",
+		IdempotencyKey:    "idem-tax-rates",
 		PaymentMethod:     "cash",
 		CashReceivedCents: 100000,
-		TaxRatePercent:    0,
-		CartItems: []domain.CartItem{
-			{SKU: "SKU-MIE-01", Qty: 1},
-		},
+		DiscountCents:     2590,
+		TaxRatePercent:    11,
+		CartItems:         []domain.CartItem{{SKU: "SKU-SUSU-01", Qty: 1}, {SKU: "SKU-MIE-01", Qty: 2}},
 	})
 	if err != nil {
 		t.Fatalf("checkout failed: %v", err)
 	}
 
-	_, err = svc.VoidTransaction(ctx, domain.VoidTransactionRequest{
-		TransactionID: resp.TransactionID,
-		Reason:        "void before refund",
-	})
+	report, err := svc.DailyReport(ctx, "main-store", "")
 	if err != nil {
-		t.Fatalf("void failed: %v", err)
+		t.Fatalf("daily report failed: %v", err)
 	}
-
-	_, err = svc.Refund(ctx, domain.RefundRequest{
-		OriginalTransactionID: resp.TransactionID,
-		Reason:                "refund should be rejected",
-		AmountCents:           1000,
-	})
-	if !errors.Is(err, store.ErrInvalidTransaction) {
-		t.Fatalf("expected ErrInvalidTransaction for refund on voided transaction, got %v", err)
+	if len(report.ByTaxRate) != 2 || report.ByTaxRate[0].RatePercent != 0 || report.ByTaxRate[1].RatePercent != 11 {
+		t.Fatalf("expected 0%% and 11%% buckets, got %+v", report.ByTaxRate)
+	}
+	exemptBucket, standard := report.ByTaxRate[0], report.ByTaxRate[1]
+	if exemptBucket.TaxCents != 0 || exemptBucket.TaxableBaseCents+standard.TaxableBaseCents != resp.SubtotalCents-resp.DiscountCents {
+		t.Fatalf("bases do not add up to the discounted subtotal: %+v", report.ByTaxRate)
+	}
+	// The mie lines are 7000 of the 25900 subtotal, so they carry that
+	// share of the discount and are the only taxed amount.
+	wantBase := 7000 - 7000*resp.DiscountCents/resp.SubtotalCents
+	if standard.TaxableBaseCents < wantBase-1 || standard.TaxableBaseCents > wantBase+1 {
+		t.Fatalf("expected 11%% base near %d, got %d", wantBase, standard.TaxableBaseCents)
+	}
+	wantTax := int64(math.Round(float64(standard.TaxableBaseCents) * 0.11))
+	if standard.TaxCents != wantTax || resp.TaxCents != wantTax || report.TaxCents != wantTax {
+		t.Fatalf("expected tax %d, got bucket %d sale %d report %d", wantTax, standard.TaxCents, resp.TaxCents, report.TaxCents)
 	}
 }
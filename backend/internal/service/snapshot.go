@@ -0,0 +1,294 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"kasirinaja/backend/internal/domain"
+	"kasirinaja/backend/internal/store"
+)
+
+// ExportAll snapshots storeID's catalog, stock, on-hand lots, promos,
+// suppliers and user accounts.
+func (s *Service) ExportAll(ctx context.Context, storeID string) (domain.DataSnapshot, error) {
+	actor, ok := ActorFromContext(ctx)
+	if !ok || actor.Role != "admin" {
+		return domain.DataSnapshot{}, ErrAdminRequired
+	}
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.DataSnapshot{}, err
+	}
+
+	products, err := s.repo.ListAllProducts(ctx)
+	if err != nil {
+		return domain.DataSnapshot{}, err
+	}
+	skus := make([]string, 0, len(products))
+	for _, product := range products {
+		skus = append(skus, product.SKU)
+	}
+	stock, err := s.repo.GetStockMap(ctx, storeID, skus)
+	if err != nil {
+		return domain.DataSnapshot{}, err
+	}
+
+	// Serials still in stock, by lot, so exported lots only carry what a
+	// cashier could still sell.
+	availableSerials := map[string][]string{}
+	for _, product := range products {
+		if !product.Serialized {
+			continue
+		}
+		serials, err := s.repo.ListSerials(ctx, storeID, product.SKU, domain.SerialStatusAvailable)
+		if err != nil {
+			return domain.DataSnapshot{}, err
+		}
+		for _, serial := range serials {
+			availableSerials[serial.LotID] = append(availableSerials[serial.LotID], serial.Serial)
+		}
+	}
+	allLots, err := s.repo.ListInventoryLots(ctx, storeID, "", true, 100000)
+	if err != nil {
+		return domain.DataSnapshot{}, err
+	}
+	lots := make([]domain.InventoryLot, 0, len(allLots))
+	for _, lot := range allLots {
+		if lot.QtyAvailable < 1 {
+			continue
+		}
+		lot.QtyReceived = lot.QtyAvailable
+		lot.DaysToExpiry = nil
+		if len(lot.Serials) > 0 {
+			lot.Serials = availableSerials[lot.ID]
+		}
+		lots = append(lots, lot)
+	}
+
+	promos, err := s.repo.ListPromos(ctx)
+	if err != nil {
+		return domain.DataSnapshot{}, err
+	}
+	suppliers, err := s.repo.ListSuppliers(ctx)
+	if err != nil {
+		return domain.DataSnapshot{}, err
+	}
+	supplierProducts, err := s.repo.ListSupplierProducts(ctx, "", nil)
+	if err != nil {
+		return domain.DataSnapshot{}, err
+	}
+	accounts, err := s.repo.ListUsers(ctx)
+	if err != nil {
+		return domain.DataSnapshot{}, err
+	}
+	users := make([]domain.SnapshotUser, 0, len(accounts))
+	for _, account := range accounts {
+		users = append(users, domain.SnapshotUser{
+			Username:  account.Username,
+			Role:      account.Role,
+			Active:    account.Active,
+			CreatedAt: account.CreatedAt,
+		})
+	}
+
+	s.logAudit(ctx, storeID, "data_export", "store", storeID, fmt.Sprintf("products=%d lots=%d users=%d", len(products), len(lots), len(users)))
+	return domain.DataSnapshot{
+		Version:          domain.DataSnapshotVersion,
+		ExportedAt:       time.Now().UTC(),
+		StoreID:          storeID,
+		Products:         products,
+		Stock:            stock,
+		Lots:             lots,
+		Promos:           promos,
+		Suppliers:        suppliers,
+		SupplierProducts: supplierProducts,
+		Users:            users,
+	}, nil
+}
+
+// ImportAll loads a snapshot made by ExportAll into the repository, which may
+// be a different backend than the one exported from. Products, promos and
+// suppliers that already exist are updated, lots that already exist are
+// skipped and stock is set to the snapshot's quantities, so an import can be
+// rerun. The import is not one transaction: a failure stops it part-way with
+// the records written so far kept.
+func (s *Service) ImportAll(ctx context.Context, snapshot domain.DataSnapshot) (domain.DataImportResponse, error) {
+	actor, ok := ActorFromContext(ctx)
+	if !ok || actor.Role != "admin" {
+		return domain.DataImportResponse{}, ErrAdminRequired
+	}
+	if snapshot.Version != domain.DataSnapshotVersion {
+		return domain.DataImportResponse{}, fmt.Errorf("%w: unsupported snapshot version %d, want %d", store.ErrInvalidTransaction, snapshot.Version, domain.DataSnapshotVersion)
+	}
+	storeID := strings.TrimSpace(snapshot.StoreID)
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.DataImportResponse{}, err
+	}
+	resp := domain.DataImportResponse{StoreID: storeID, UsersNeedingPassword: []string{}}
+
+	for _, product := range snapshot.Products {
+		if err := s.importProduct(ctx, product); err != nil {
+			return resp, &store.SKUError{SKU: product.SKU, Err: err}
+		}
+		resp.Products++
+	}
+
+	newLots := make([]domain.InventoryLot, 0, len(snapshot.Lots))
+	for _, lot := range snapshot.Lots {
+		if lot.ID != "" {
+			if _, err := s.repo.GetInventoryLot(ctx, lot.ID); err == nil {
+				continue
+			} else if !errors.Is(err, store.ErrNotFound) {
+				return resp, err
+			}
+		}
+		lot.StoreID = storeID
+		lot.DaysToExpiry = nil
+		newLots = append(newLots, lot)
+	}
+	if len(newLots) > 0 {
+		if _, err := s.repo.CreateInventoryLots(ctx, newLots); err != nil {
+			return resp, fmt.Errorf("import lots: %w", err)
+		}
+		resp.Lots = len(newLots)
+	}
+	// Lots add their quantity to stock, so the snapshot's stock is applied
+	// after them to land on the exported quantities.
+	if len(snapshot.Stock) > 0 {
+		if err := s.repo.SetStockBulk(ctx, storeID, snapshot.Stock); err != nil {
+			return resp, fmt.Errorf("import stock: %w", err)
+		}
+		resp.StockSKUs = len(snapshot.Stock)
+	}
+
+	for _, promo := range snapshot.Promos {
+		if err := s.importPromo(ctx, promo); err != nil {
+			return resp, fmt.Errorf("import promo %s: %w", promo.ID, err)
+		}
+		resp.Promos++
+	}
+	for _, supplier := range snapshot.Suppliers {
+		if _, err := s.repo.CreateSupplier(ctx, supplier); errors.Is(err, store.ErrDuplicateID) {
+			_, err = s.repo.UpdateSupplier(ctx, supplier)
+			if err != nil {
+				return resp, fmt.Errorf("import supplier %s: %w", supplier.ID, err)
+			}
+		} else if err != nil {
+			return resp, fmt.Errorf("import supplier %s: %w", supplier.ID, err)
+		}
+		resp.Suppliers++
+	}
+	for _, product := range snapshot.SupplierProducts {
+		if _, err := s.repo.SetSupplierProduct(ctx, product); err != nil {
+			return resp, fmt.Errorf("import supplier product %s/%s: %w", product.SupplierID, product.SKU, err)
+		}
+		resp.SupplierProducts++
+	}
+
+	created, err := s.importUsers(ctx, snapshot.Users)
+	resp.Users = len(created)
+	resp.UsersNeedingPassword = append(resp.UsersNeedingPassword, created...)
+	if err != nil {
+		return resp, err
+	}
+
+	s.logAudit(ctx, storeID, "data_import", "store", storeID, fmt.Sprintf("products=%d lots=%d promos=%d suppliers=%d users=%d", resp.Products, resp.Lots, resp.Promos, resp.Suppliers, resp.Users))
+	return resp, nil
+}
+
+// importProduct creates product or, when the SKU exists, overwrites it.
+// Creation always activates a product, so inactive ones are updated after.
+func (s *Service) importProduct(ctx context.Context, product domain.Product) error {
+	marginRate, ok := store.NormalizeMarginRate(product.MarginRate)
+	if !ok {
+		return fmt.Errorf("%w: margin_rate %v out of range", store.ErrInvalidTransaction, product.MarginRate)
+	}
+	product.MarginRate = marginRate
+	created, err := s.repo.CreateProduct(ctx, product)
+	if errors.Is(err, store.ErrDuplicateID) {
+		_, err = s.repo.UpdateProduct(ctx, product)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if created.Active != product.Active {
+		_, err = s.repo.UpdateProduct(ctx, product)
+	}
+	return err
+}
+
+func (s *Service) importPromo(ctx context.Context, promo domain.PromoRule) error {
+	created, err := s.repo.CreatePromo(ctx, promo)
+	if errors.Is(err, store.ErrDuplicateID) {
+		_, err = s.repo.UpdatePromoActive(ctx, promo.ID, promo.Active)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	// An active promo of the same name already exists under another ID;
+	// keep it rather than importing a duplicate.
+	if created.ID != promo.ID {
+		return nil
+	}
+	if created.Active != promo.Active {
+		_, err = s.repo.UpdatePromoActive(ctx, promo.ID, promo.Active)
+	}
+	return err
+}
+
+// importUsers creates the snapshot users missing from the repository and
+// returns their usernames. Passwords are not exported, so each gets a random
+// password nobody knows until an admin resets it. Existing users are left
+// untouched.
+func (s *Service) importUsers(ctx context.Context, users []domain.SnapshotUser) ([]string, error) {
+	existing, err := s.repo.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(existing))
+	for _, user := range existing {
+		known[strings.ToLower(user.Username)] = true
+	}
+
+	created := make([]string, 0, len(users))
+	for _, user := range users {
+		username := strings.ToLower(strings.TrimSpace(user.Username))
+		if username == "" || known[username] {
+			continue
+		}
+		secret := make([]byte, 24)
+		if _, err := rand.Read(secret); err != nil {
+			return created, err
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(secret)), bcrypt.DefaultCost)
+		if err != nil {
+			return created, err
+		}
+		if err := s.repo.CreateUser(ctx, domain.UserAccount{
+			Username:  username,
+			Password:  string(hash),
+			Role:      user.Role,
+			Active:    user.Active,
+			CreatedAt: user.CreatedAt,
+		}); err != nil {
+			return created, fmt.Errorf("import user %s: %w", username, err)
+		}
+		// CreateUser always activates the account.
+		if !user.Active {
+			if err := s.repo.UpdateUserActive(ctx, username, false); err != nil {
+				return created, fmt.Errorf("import user %s: %w", username, err)
+			}
+		}
+		known[username] = true
+		created = append(created, username)
+	}
+	return created, nil
+}
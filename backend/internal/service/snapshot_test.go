@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"kasirinaja/backend/internal/cache"
+	"kasirinaja/backend/internal/domain"
+	"kasirinaja/backend/internal/recommendation"
+	"kasirinaja/backend/internal/store"
+	"kasirinaja/backend/internal/store/memory"
+)
+
+func TestExportImportRoundTripsIntoEmptyStore(t *testing.T) {
+	source := newTestService()
+	ctx := WithActor(context.Background(), domain.Actor{Username: "admin", Role: "admin"})
+
+	if _, err := source.ReceiveInventoryLot(ctx, domain.InventoryLotReceiveRequest{
+		StoreID:   "main-store",
+		SKU:       "SKU-SUSU-01",
+		LotCode:   "LOT-SUSU-A",
+		Qty:       12,
+		CostCents: 13000,
+	}); err != nil {
+		t.Fatalf("receive lot failed: %v", err)
+	}
+	inactive := false
+	if _, err := source.UpdateProduct(ctx, "SKU-ROTI-01", domain.ProductUpdateRequest{Active: &inactive}); err != nil {
+		t.Fatalf("deactivate product failed: %v", err)
+	}
+	promo, _, err := source.CreatePromo(ctx, domain.PromoCreateRequest{Name: "Diskon 5%", Type: "cart_percent", DiscountPercent: 5})
+	if err != nil {
+		t.Fatalf("create promo failed: %v", err)
+	}
+	supplier, err := source.CreateSupplier(ctx, domain.SupplierCreateRequest{Name: "Supplier Export"})
+	if err != nil {
+		t.Fatalf("create supplier failed: %v", err)
+	}
+	if _, err := source.SetSupplierProduct(ctx, supplier.ID, domain.SupplierProductSetRequest{SKU: "SKU-SUSU-01", DefaultCostCents: 12500, LeadTimeDays: 3}); err != nil {
+		t.Fatalf("set supplier product failed: %v", err)
+	}
+	if err := source.repo.CreateUser(ctx, domain.UserAccount{Username: "kasir2", Password: "x", Role: "cashier"}); err != nil {
+		t.Fatalf("create user failed: %v", err)
+	}
+
+	snapshot, err := source.ExportAll(ctx, "main-store")
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	if snapshot.Version != domain.DataSnapshotVersion || len(snapshot.Lots) != 1 {
+		t.Fatalf("unexpected snapshot: version %d, %d lots", snapshot.Version, len(snapshot.Lots))
+	}
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatalf("marshal snapshot failed: %v", err)
+	}
+	if strings.Contains(strings.ToLower(string(raw)), "password") {
+		t.Fatalf("snapshot must not contain passwords")
+	}
+	var decoded domain.DataSnapshot
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatalf("unmarshal snapshot failed: %v", err)
+	}
+
+	target := New(memory.NewEmpty(), recommendation.NewEngine(cache.NoopRecommendationCache{}, 5*time.Second), "main-store")
+	resp, err := target.ImportAll(ctx, decoded)
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if resp.Products != len(snapshot.Products) || resp.Lots != 1 || resp.Promos != 1 || resp.Suppliers != 1 || resp.SupplierProducts != 1 {
+		t.Fatalf("unexpected import counts: %+v", resp)
+	}
+	if !slices.Equal(resp.UsersNeedingPassword, []string{"kasir2"}) {
+		t.Fatalf("expected only the new user to need a password, got %v", resp.UsersNeedingPassword)
+	}
+
+	skus := make([]string, 0, len(snapshot.Stock))
+	for sku := range snapshot.Stock {
+		skus = append(skus, sku)
+	}
+	stock, err := target.repo.GetStockMap(ctx, "main-store", skus)
+	if err != nil {
+		t.Fatalf("get stock failed: %v", err)
+	}
+	for sku, qty := range snapshot.Stock {
+		if stock[sku] != qty {
+			t.Fatalf("expected %s stock %d after import, got %d", sku, qty, stock[sku])
+		}
+	}
+	roti, err := target.repo.GetProductBySKU(ctx, "SKU-ROTI-01")
+	if err != nil || roti.Active {
+		t.Fatalf("expected inactive product to stay inactive, got %+v err %v", roti, err)
+	}
+	promos, _ := target.repo.ListPromos(ctx)
+	if len(promos) != 1 || promos[0].ID != promo.ID {
+		t.Fatalf("expected promo %s to be imported, got %+v", promo.ID, promos)
+	}
+
+	// A second import updates in place instead of duplicating.
+	again, err := target.ImportAll(ctx, decoded)
+	if err != nil {
+		t.Fatalf("second import failed: %v", err)
+	}
+	if again.Lots != 0 || again.Users != 0 {
+		t.Fatalf("expected rerun to skip existing lots and users, got %+v", again)
+	}
+	stock, _ = target.repo.GetStockMap(ctx, "main-store", []string{"SKU-SUSU-01"})
+	if stock["SKU-SUSU-01"] != snapshot.Stock["SKU-SUSU-01"] {
+		t.Fatalf("expected stock unchanged by rerun, got %d", stock["SKU-SUSU-01"])
+	}
+
+	decoded.Version = 99
+	if _, err := target.ImportAll(ctx, decoded); !errors.Is(err, store.ErrInvalidTransaction) {
+		t.Fatalf("expected unknown version to be rejected, got %v", err)
+	}
+}
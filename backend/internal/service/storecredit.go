@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"kasirinaja/backend/internal/domain"
+	"kasirinaja/backend/internal/store"
+)
+
+// GetStoreCreditBalance returns the balance and ledger of a store credit
+// code.
+func (s *Service) GetStoreCreditBalance(ctx context.Context, code string) (domain.StoreCreditBalance, error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return domain.StoreCreditBalance{}, store.ErrInvalidTransaction
+	}
+	balance, err := s.repo.GetStoreCreditBalance(ctx, code)
+	if err != nil {
+		return domain.StoreCreditBalance{}, err
+	}
+	return *balance, nil
+}
+
+// RedeemStoreCredit takes credit off a code outside a sale, such as paying
+// out a voucher. Sales redeem credit through a store_credit payment split
+// instead, so the redemption is stored with the sale.
+func (s *Service) RedeemStoreCredit(ctx context.Context, code string, req domain.StoreCreditRedeemRequest) (domain.StoreCreditEntry, error) {
+	actor, ok := ActorFromContext(ctx)
+	if !ok || actor.Role != "admin" {
+		return domain.StoreCreditEntry{}, ErrAdminRequired
+	}
+	code = strings.TrimSpace(code)
+	if code == "" || req.AmountCents < 1 {
+		return domain.StoreCreditEntry{}, store.ErrInvalidTransaction
+	}
+	if err := s.resolveStoreID(&req.StoreID); err != nil {
+		return domain.StoreCreditEntry{}, err
+	}
+
+	entry, err := s.repo.RedeemStoreCredit(ctx, req.StoreID, code, req.AmountCents, actor.Username, time.Now().UTC())
+	if err != nil {
+		return domain.StoreCreditEntry{}, err
+	}
+	s.logAudit(ctx, req.StoreID, "store_credit_redeem", "store_credit", code, fmt.Sprintf("amount=%d", req.AmountCents))
+	return *entry, nil
+}
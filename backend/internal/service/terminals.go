@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"kasirinaja/backend/internal/domain"
+	"kasirinaja/backend/internal/store"
+	"kasirinaja/backend/internal/xid"
+)
+
+// ErrTerminalNotRegistered is returned by checkout and shift requests when
+// registered terminals are required and the request's terminal is unknown,
+// revoked or presented the wrong token.
+var ErrTerminalNotRegistered = errors.New("terminal is not registered or its token is invalid")
+
+type terminalTokenContextKey struct{}
+
+// WithTerminalToken attaches the token a device presented for its terminal.
+func WithTerminalToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, terminalTokenContextKey{}, token)
+}
+
+func terminalTokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(terminalTokenContextKey{}).(string)
+	return token
+}
+
+// SetRequireRegisteredTerminals makes checkout, offline sync and shift
+// open/close accept only terminals registered with RegisterTerminal and
+// presenting their token. It is off by default, so any terminal ID is
+// accepted.
+func (s *Service) SetRequireRegisteredTerminals(require bool) {
+	s.registeredTerminalsOnly = require
+}
+
+// RegisterTerminal registers terminalID in storeID and returns its token.
+// Registering a terminal again issues a new token, invalidating the old one,
+// and lifts a revocation.
+func (s *Service) RegisterTerminal(ctx context.Context, storeID string, terminalID string, label string) (domain.TerminalRegistration, error) {
+	actor, ok := ActorFromContext(ctx)
+	if !ok || actor.Role != "admin" {
+		return domain.TerminalRegistration{}, ErrAdminRequired
+	}
+	storeID = strings.TrimSpace(storeID)
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.TerminalRegistration{}, err
+	}
+	terminalID = strings.TrimSpace(terminalID)
+	if !xid.ValidClientID(terminalID) {
+		return domain.TerminalRegistration{}, fmt.Errorf("%w: terminal id %q must be 1-64 letters, digits, '.', '_' or '-'", store.ErrInvalidTransaction, terminalID)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return domain.TerminalRegistration{}, err
+	}
+	token := hex.EncodeToString(secret)
+	saved, err := s.repo.SaveTerminal(ctx, domain.Terminal{
+		StoreID:    storeID,
+		TerminalID: terminalID,
+		Label:      strings.TrimSpace(label),
+		TokenHash:  hashTerminalToken(token),
+		CreatedBy:  actor.Username,
+		CreatedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return domain.TerminalRegistration{}, err
+	}
+
+	s.logAudit(ctx, storeID, "terminal_register", "terminal", terminalID, saved.Label)
+	return domain.TerminalRegistration{Terminal: *saved, Token: token}, nil
+}
+
+func (s *Service) ListTerminals(ctx context.Context, storeID string) (domain.TerminalListResponse, error) {
+	actor, ok := ActorFromContext(ctx)
+	if !ok || actor.Role != "admin" {
+		return domain.TerminalListResponse{}, ErrAdminRequired
+	}
+	storeID = strings.TrimSpace(storeID)
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.TerminalListResponse{}, err
+	}
+	terminals, err := s.repo.ListTerminals(ctx, storeID)
+	if err != nil {
+		return domain.TerminalListResponse{}, err
+	}
+	return domain.TerminalListResponse{StoreID: storeID, Terminals: terminals}, nil
+}
+
+// RevokeTerminal stops terminalID's token from being accepted. Revoking an
+// already revoked terminal keeps its original revocation time.
+func (s *Service) RevokeTerminal(ctx context.Context, storeID string, terminalID string) (domain.Terminal, error) {
+	actor, ok := ActorFromContext(ctx)
+	if !ok || actor.Role != "admin" {
+		return domain.Terminal{}, ErrAdminRequired
+	}
+	storeID = strings.TrimSpace(storeID)
+	if err := s.resolveStoreID(&storeID); err != nil {
+		return domain.Terminal{}, err
+	}
+	terminal, err := s.repo.RevokeTerminal(ctx, storeID, strings.TrimSpace(terminalID), time.Now().UTC())
+	if err != nil {
+		return domain.Terminal{}, err
+	}
+
+	s.logAudit(ctx, storeID, "terminal_revoke", "terminal", terminal.TerminalID, terminal.Label)
+	return *terminal, nil
+}
+
+// checkTerminal rejects a request for terminalID unless registration is not
+// required or the terminal is registered, not revoked and the token in ctx
+// matches.
+func (s *Service) checkTerminal(ctx context.Context, storeID string, terminalID string) error {
+	if !s.registeredTerminalsOnly {
+		return nil
+	}
+	token := terminalTokenFromContext(ctx)
+	if token == "" {
+		return ErrTerminalNotRegistered
+	}
+	terminal, err := s.repo.GetTerminal(ctx, storeID, terminalID)
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrTerminalNotRegistered
+	}
+	if err != nil {
+		return err
+	}
+	if terminal.RevokedAt != nil || subtle.ConstantTimeCompare([]byte(terminal.TokenHash), []byte(hashTerminalToken(token))) != 1 {
+		return ErrTerminalNotRegistered
+	}
+	return nil
+}
+
+func hashTerminalToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,24 @@
+package service
+
+import "time"
+
+// TimestampFormat is the layout of every timestamp the service puts in a
+// response, such as created_at, voided_at and generated_at: RFC 3339 with an
+// explicit offset, e.g. "2026-03-01T07:30:00Z" or "2026-03-01T14:30:00+07:00".
+// Calendar dates such as DailyReport.Date are plain YYYY-MM-DD instead.
+const TimestampFormat = time.RFC3339
+
+// SetLocalTimestamps makes responses carry timestamps in the store's
+// timezone with its offset instead of UTC. Both name the same instant.
+func (s *Service) SetLocalTimestamps(local bool) {
+	s.localTimestamps = local
+}
+
+// formatTimestamp renders t in TimestampFormat, in UTC or, when enabled, the
+// store's timezone.
+func (s *Service) formatTimestamp(t time.Time) string {
+	if s.localTimestamps {
+		return t.In(s.storeLocation).Format(TimestampFormat)
+	}
+	return t.UTC().Format(TimestampFormat)
+}
@@ -0,0 +1,216 @@
+// Package breaker wraps a store.Repository with a circuit breaker that turns
+// the service read-only while the database keeps failing writes.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"kasirinaja/backend/internal/domain"
+	"kasirinaja/backend/internal/store"
+)
+
+const (
+	ModeReadWrite = "read_write"
+	ModeReadOnly  = "read_only"
+)
+
+// Repository passes reads straight to the wrapped repository and counts
+// consecutive write failures. After threshold of them it trips to read-only:
+// every write returns store.ErrServiceReadOnly without touching the
+// database, and product, promo and supplier lists are served from the last
+// successful read while it is younger than cacheTTL. A successful Ping
+// closes the breaker again.
+//
+// Writes are the methods overridden in writes.go; a mutating method added to
+// store.Repository must be added there too or it bypasses the breaker.
+type Repository struct {
+	store.Repository
+	threshold int
+	cacheTTL  time.Duration
+	now       func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	readOnly  bool
+	products  cached[[]domain.Product]
+	promos    cached[[]domain.PromoRule]
+	suppliers cached[[]domain.Supplier]
+}
+
+type cached[T any] struct {
+	value T
+	at    time.Time
+	ok    bool
+}
+
+func New(repo store.Repository, threshold int, cacheTTL time.Duration) *Repository {
+	if threshold < 1 {
+		threshold = 5
+	}
+	if cacheTTL <= 0 {
+		cacheTTL = 5 * time.Minute
+	}
+	return &Repository{
+		Repository: repo,
+		threshold:  threshold,
+		cacheTTL:   cacheTTL,
+		now:        time.Now,
+	}
+}
+
+// Mode reports ModeReadOnly while the breaker is open, else ModeReadWrite.
+func (r *Repository) Mode() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.readOnly {
+		return ModeReadOnly
+	}
+	return ModeReadWrite
+}
+
+// Ping checks the wrapped repository and leaves read-only mode when it
+// answers.
+func (r *Repository) Ping(ctx context.Context) error {
+	if err := r.Repository.Ping(ctx); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.readOnly {
+		log.Printf("repository: database reachable again, leaving read-only mode")
+	}
+	r.readOnly = false
+	r.failures = 0
+	return nil
+}
+
+// Run pings the database every interval while the breaker is open, so the
+// service recovers without waiting for a readiness probe. It stops when ctx
+// is cancelled.
+func (r *Repository) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if r.Mode() == ModeReadOnly {
+				_ = r.Ping(ctx)
+			}
+		}
+	}
+}
+
+func (r *Repository) ListProducts(ctx context.Context) ([]domain.Product, error) {
+	return read(r, &r.products, func() ([]domain.Product, error) { return r.Repository.ListProducts(ctx) })
+}
+
+func (r *Repository) ListPromos(ctx context.Context) ([]domain.PromoRule, error) {
+	return read(r, &r.promos, func() ([]domain.PromoRule, error) { return r.Repository.ListPromos(ctx) })
+}
+
+func (r *Repository) ListSuppliers(ctx context.Context) ([]domain.Supplier, error) {
+	return read(r, &r.suppliers, func() ([]domain.Supplier, error) { return r.Repository.ListSuppliers(ctx) })
+}
+
+// read serves a cached list while read-only and refreshes the cache after
+// every successful read.
+func read[T any](r *Repository, cache *cached[T], fn func() (T, error)) (T, error) {
+	r.mu.Lock()
+	if r.readOnly && cache.ok && r.now().Sub(cache.at) < r.cacheTTL {
+		value := cache.value
+		r.mu.Unlock()
+		return value, nil
+	}
+	r.mu.Unlock()
+
+	value, err := fn()
+	if err != nil {
+		return value, err
+	}
+	r.mu.Lock()
+	*cache = cached[T]{value: value, at: r.now(), ok: true}
+	r.mu.Unlock()
+	return value, nil
+}
+
+func write[T any](r *Repository, fn func() (T, error)) (T, error) {
+	if err := r.allowWrite(); err != nil {
+		var zero T
+		return zero, err
+	}
+	value, err := fn()
+	r.recordWrite(err)
+	return value, err
+}
+
+func (r *Repository) writeErr(fn func() error) error {
+	if err := r.allowWrite(); err != nil {
+		return err
+	}
+	err := fn()
+	r.recordWrite(err)
+	return err
+}
+
+func (r *Repository) allowWrite() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.readOnly {
+		return store.ErrServiceReadOnly
+	}
+	return nil
+}
+
+func (r *Repository) recordWrite(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !isOutage(err) {
+		r.failures = 0
+		return
+	}
+	r.failures++
+	if r.failures >= r.threshold && !r.readOnly {
+		r.readOnly = true
+		log.Printf("repository: %d consecutive write failures, switching to read-only mode: %v", r.failures, err)
+	}
+}
+
+// isOutage reports whether a write failed because of the database rather
+// than the request. Repository sentinels, cancelled requests and SQL errors
+// outside the connection, resource and system classes are the caller's
+// problem and do not count.
+func isOutage(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	for _, sentinel := range []error{
+		store.ErrNotFound,
+		store.ErrInsufficientStock,
+		store.ErrInvalidTransaction,
+		store.ErrShiftAlreadyOpen,
+	} {
+		if errors.Is(err, sentinel) {
+			return false
+		}
+	}
+	var sqlErr interface{ SQLState() string }
+	if errors.As(err, &sqlErr) {
+		state := sqlErr.SQLState()
+		if len(state) < 2 {
+			return true
+		}
+		switch state[:2] {
+		case "08", "53", "57", "58", "XX":
+			return true
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"kasirinaja/backend/internal/domain"
+	"kasirinaja/backend/internal/store"
+	"kasirinaja/backend/internal/store/memory"
+)
+
+var errConnectionRefused = errors.New("dial tcp 10.0.0.5:5432: connect: connection refused")
+
+// flakyRepo is a memory store whose database can be taken down.
+type flakyRepo struct {
+	*memory.Store
+	down bool
+}
+
+func (f *flakyRepo) Ping(ctx context.Context) error {
+	if f.down {
+		return errConnectionRefused
+	}
+	return f.Store.Ping(ctx)
+}
+
+func (f *flakyRepo) ListProducts(ctx context.Context) ([]domain.Product, error) {
+	if f.down {
+		return nil, errConnectionRefused
+	}
+	return f.Store.ListProducts(ctx)
+}
+
+func (f *flakyRepo) SetStock(ctx context.Context, storeID string, sku string, qty int) error {
+	if f.down {
+		return errConnectionRefused
+	}
+	return f.Store.SetStock(ctx, storeID, sku, qty)
+}
+
+func TestBreakerTripsToReadOnlyAndRecoversOnPing(t *testing.T) {
+	ctx := context.Background()
+	flaky := &flakyRepo{Store: memory.NewSeeded()}
+	repo := New(flaky, 3, 0)
+
+	products, err := repo.ListProducts(ctx)
+	if err != nil || len(products) == 0 {
+		t.Fatalf("expected products while healthy, got %d (%v)", len(products), err)
+	}
+
+	flaky.down = true
+	for range 3 {
+		if err := repo.SetStock(ctx, "main-store", "SKU-MIE-01", 10); !errors.Is(err, errConnectionRefused) {
+			t.Fatalf("expected the database error while still closed, got %v", err)
+		}
+	}
+	if repo.Mode() != ModeReadOnly {
+		t.Fatalf("expected read-only mode after 3 write failures, got %s", repo.Mode())
+	}
+	if err := repo.SetStock(ctx, "main-store", "SKU-MIE-01", 10); !errors.Is(err, store.ErrServiceReadOnly) {
+		t.Fatalf("expected ErrServiceReadOnly, got %v", err)
+	}
+	if _, err := repo.CreateProduct(ctx, domain.Product{SKU: "SKU-NEW-01"}); !errors.Is(err, store.ErrServiceReadOnly) {
+		t.Fatalf("expected every write to be refused, got %v", err)
+	}
+	cachedProducts, err := repo.ListProducts(ctx)
+	if err != nil || len(cachedProducts) != len(products) {
+		t.Fatalf("expected cached products while read-only, got %d (%v)", len(cachedProducts), err)
+	}
+
+	if err := repo.Ping(ctx); err == nil {
+		t.Fatalf("expected ping to fail while the database is down")
+	}
+	flaky.down = false
+	if err := repo.Ping(ctx); err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+	if repo.Mode() != ModeReadWrite {
+		t.Fatalf("expected read-write mode after a successful ping, got %s", repo.Mode())
+	}
+	if err := repo.SetStock(ctx, "main-store", "SKU-MIE-01", 10); err != nil {
+		t.Fatalf("expected writes after recovery, got %v", err)
+	}
+}
+
+func TestBreakerIgnoresRequestErrors(t *testing.T) {
+	ctx := context.Background()
+	repo := New(memory.NewSeeded(), 2, 0)
+
+	for range 4 {
+		if _, err := repo.VoidTransaction(ctx, "tx-missing", "typo", time.Now().UTC()); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	}
+	if repo.Mode() != ModeReadWrite {
+		t.Fatalf("expected request errors not to trip the breaker")
+	}
+}
@@ -0,0 +1,250 @@
+package breaker
+
+import (
+	"context"
+	"time"
+
+	"kasirinaja/backend/internal/domain"
+)
+
+func (r *Repository) CreateProduct(ctx context.Context, product domain.Product) (*domain.Product, error) {
+	return write(r, func() (*domain.Product, error) { return r.Repository.CreateProduct(ctx, product) })
+}
+
+func (r *Repository) UpdateProduct(ctx context.Context, product domain.Product) (*domain.Product, error) {
+	return write(r, func() (*domain.Product, error) { return r.Repository.UpdateProduct(ctx, product) })
+}
+
+func (r *Repository) CreatePriceHistory(ctx context.Context, entry domain.ProductPriceHistory) error {
+	return r.writeErr(func() error { return r.Repository.CreatePriceHistory(ctx, entry) })
+}
+
+func (r *Repository) SetStock(ctx context.Context, storeID string, sku string, qty int) error {
+	return r.writeErr(func() error { return r.Repository.SetStock(ctx, storeID, sku, qty) })
+}
+
+func (r *Repository) SetStockBulk(ctx context.Context, storeID string, quantities map[string]int) error {
+	return r.writeErr(func() error { return r.Repository.SetStockBulk(ctx, storeID, quantities) })
+}
+
+func (r *Repository) CreateStockOpname(ctx context.Context, record domain.StockOpnameRecord) (*domain.StockOpnameRecord, error) {
+	return write(r, func() (*domain.StockOpnameRecord, error) { return r.Repository.CreateStockOpname(ctx, record) })
+}
+
+func (r *Repository) CreateInventoryLot(ctx context.Context, lot domain.InventoryLot) (*domain.InventoryLot, error) {
+	return write(r, func() (*domain.InventoryLot, error) { return r.Repository.CreateInventoryLot(ctx, lot) })
+}
+
+func (r *Repository) CreateInventoryLots(ctx context.Context, lots []domain.InventoryLot) ([]domain.InventoryLot, error) {
+	return write(r, func() ([]domain.InventoryLot, error) { return r.Repository.CreateInventoryLots(ctx, lots) })
+}
+
+func (r *Repository) AdjustLotQty(ctx context.Context, lotID string, qtyAvailable int, audit domain.AuditLog) (*domain.InventoryLot, error) {
+	return write(r, func() (*domain.InventoryLot, error) {
+		return r.Repository.AdjustLotQty(ctx, lotID, qtyAvailable, audit)
+	})
+}
+
+func (r *Repository) CorrectLotCost(ctx context.Context, lotID string, costCents int64, audit domain.AuditLog) (*domain.InventoryLot, error) {
+	return write(r, func() (*domain.InventoryLot, error) { return r.Repository.CorrectLotCost(ctx, lotID, costCents, audit) })
+}
+
+func (r *Repository) WriteOffStock(ctx context.Context, writeOff domain.StockWriteOff, audit domain.AuditLog) (*domain.StockWriteOff, error) {
+	return write(r, func() (*domain.StockWriteOff, error) { return r.Repository.WriteOffStock(ctx, writeOff, audit) })
+}
+
+func (r *Repository) TransferStock(ctx context.Context, fromStoreID string, lot domain.InventoryLot, audits []domain.AuditLog) ([]domain.InventoryLot, error) {
+	return write(r, func() ([]domain.InventoryLot, error) {
+		return r.Repository.TransferStock(ctx, fromStoreID, lot, audits)
+	})
+}
+
+func (r *Repository) UpsertAssociationPair(ctx context.Context, sourceSKU string, targetSKU string, affinity float64) (*domain.AssociationPair, error) {
+	return write(r, func() (*domain.AssociationPair, error) {
+		return r.Repository.UpsertAssociationPair(ctx, sourceSKU, targetSKU, affinity)
+	})
+}
+
+func (r *Repository) DeleteAssociationPair(ctx context.Context, sourceSKU string, targetSKU string) error {
+	return r.writeErr(func() error { return r.Repository.DeleteAssociationPair(ctx, sourceSKU, targetSKU) })
+}
+
+func (r *Repository) IncreaseStock(ctx context.Context, storeID string, adjustments []domain.StockAdjustment) error {
+	return r.writeErr(func() error { return r.Repository.IncreaseStock(ctx, storeID, adjustments) })
+}
+
+func (r *Repository) CreateCheckout(ctx context.Context, tx domain.Transaction) (*domain.Transaction, error) {
+	return write(r, func() (*domain.Transaction, error) { return r.Repository.CreateCheckout(ctx, tx) })
+}
+
+func (r *Repository) CreateCheckoutBatch(ctx context.Context, txs []domain.Transaction) ([]*domain.Transaction, error) {
+	return write(r, func() ([]*domain.Transaction, error) { return r.Repository.CreateCheckoutBatch(ctx, txs) })
+}
+
+func (r *Repository) VoidTransaction(ctx context.Context, id string, reason string, at time.Time) (*domain.Transaction, error) {
+	return write(r, func() (*domain.Transaction, error) { return r.Repository.VoidTransaction(ctx, id, reason, at) })
+}
+
+func (r *Repository) RedeemStoreCredit(ctx context.Context, storeID string, code string, amountCents int64, createdBy string, at time.Time) (*domain.StoreCreditEntry, error) {
+	return write(r, func() (*domain.StoreCreditEntry, error) {
+		return r.Repository.RedeemStoreCredit(ctx, storeID, code, amountCents, createdBy, at)
+	})
+}
+
+func (r *Repository) CreateRefund(ctx context.Context, refund domain.Refund) (*domain.Refund, error) {
+	return write(r, func() (*domain.Refund, error) { return r.Repository.CreateRefund(ctx, refund) })
+}
+
+func (r *Repository) CreateItemReturn(ctx context.Context, itemReturn domain.ItemReturn) (*domain.ItemReturn, error) {
+	return write(r, func() (*domain.ItemReturn, error) { return r.Repository.CreateItemReturn(ctx, itemReturn) })
+}
+
+func (r *Repository) CreateRecommendationEvent(ctx context.Context, event domain.RecommendationEvent) error {
+	return r.writeErr(func() error { return r.Repository.CreateRecommendationEvent(ctx, event) })
+}
+
+func (r *Repository) CreateRecommendationEventsBatch(ctx context.Context, events []domain.RecommendationEvent) error {
+	return r.writeErr(func() error { return r.Repository.CreateRecommendationEventsBatch(ctx, events) })
+}
+
+func (r *Repository) CreateAuditLog(ctx context.Context, entry domain.AuditLog) error {
+	return r.writeErr(func() error { return r.Repository.CreateAuditLog(ctx, entry) })
+}
+
+func (r *Repository) RebuildAssociationPairs(ctx context.Context, storeID string, minLift float64) ([]domain.AssociationPair, error) {
+	return write(r, func() ([]domain.AssociationPair, error) {
+		return r.Repository.RebuildAssociationPairs(ctx, storeID, minLift)
+	})
+}
+
+func (r *Repository) CreateShift(ctx context.Context, shift domain.Shift) (*domain.Shift, error) {
+	return write(r, func() (*domain.Shift, error) { return r.Repository.CreateShift(ctx, shift) })
+}
+
+func (r *Repository) CloseActiveShift(ctx context.Context, storeID string, terminalID string, closingCashCents int64, closedAt time.Time) (*domain.Shift, error) {
+	return write(r, func() (*domain.Shift, error) {
+		return r.Repository.CloseActiveShift(ctx, storeID, terminalID, closingCashCents, closedAt)
+	})
+}
+
+func (r *Repository) UpdateOpenShift(ctx context.Context, shiftID string, openingFloatCents int64, notes string) (*domain.Shift, error) {
+	return write(r, func() (*domain.Shift, error) {
+		return r.Repository.UpdateOpenShift(ctx, shiftID, openingFloatCents, notes)
+	})
+}
+
+func (r *Repository) CreateShiftCashMovement(ctx context.Context, movement domain.ShiftCashMovement) (*domain.ShiftCashMovement, error) {
+	return write(r, func() (*domain.ShiftCashMovement, error) { return r.Repository.CreateShiftCashMovement(ctx, movement) })
+}
+
+func (r *Repository) CreatePromo(ctx context.Context, promo domain.PromoRule) (*domain.PromoRule, error) {
+	return write(r, func() (*domain.PromoRule, error) { return r.Repository.CreatePromo(ctx, promo) })
+}
+
+func (r *Repository) UpdatePromoActive(ctx context.Context, promoID string, active bool) (*domain.PromoRule, error) {
+	return write(r, func() (*domain.PromoRule, error) { return r.Repository.UpdatePromoActive(ctx, promoID, active) })
+}
+
+func (r *Repository) CreateHeldCart(ctx context.Context, held domain.HeldCart) (*domain.HeldCart, error) {
+	return write(r, func() (*domain.HeldCart, error) { return r.Repository.CreateHeldCart(ctx, held) })
+}
+
+func (r *Repository) PopHeldCart(ctx context.Context, holdID string) (*domain.HeldCart, error) {
+	return write(r, func() (*domain.HeldCart, error) { return r.Repository.PopHeldCart(ctx, holdID) })
+}
+
+func (r *Repository) DeleteHeldCart(ctx context.Context, holdID string) error {
+	return r.writeErr(func() error { return r.Repository.DeleteHeldCart(ctx, holdID) })
+}
+
+func (r *Repository) CreateSupplier(ctx context.Context, supplier domain.Supplier) (*domain.Supplier, error) {
+	return write(r, func() (*domain.Supplier, error) { return r.Repository.CreateSupplier(ctx, supplier) })
+}
+
+func (r *Repository) UpdateSupplier(ctx context.Context, supplier domain.Supplier) (*domain.Supplier, error) {
+	return write(r, func() (*domain.Supplier, error) { return r.Repository.UpdateSupplier(ctx, supplier) })
+}
+
+func (r *Repository) SetSupplierProduct(ctx context.Context, product domain.SupplierProduct) (*domain.SupplierProduct, error) {
+	return write(r, func() (*domain.SupplierProduct, error) { return r.Repository.SetSupplierProduct(ctx, product) })
+}
+
+func (r *Repository) CreatePurchaseOrder(ctx context.Context, po domain.PurchaseOrder) (*domain.PurchaseOrder, error) {
+	return write(r, func() (*domain.PurchaseOrder, error) { return r.Repository.CreatePurchaseOrder(ctx, po) })
+}
+
+func (r *Repository) ReceivePurchaseOrder(ctx context.Context, purchaseOrderID string, receivedBy string, receivedAt time.Time) (*domain.PurchaseOrder, error) {
+	return write(r, func() (*domain.PurchaseOrder, error) {
+		return r.Repository.ReceivePurchaseOrder(ctx, purchaseOrderID, receivedBy, receivedAt)
+	})
+}
+
+func (r *Repository) CancelPurchaseOrder(ctx context.Context, purchaseOrderID string, reason string, cancelledBy string, cancelledAt time.Time) (*domain.PurchaseOrder, error) {
+	return write(r, func() (*domain.PurchaseOrder, error) {
+		return r.Repository.CancelPurchaseOrder(ctx, purchaseOrderID, reason, cancelledBy, cancelledAt)
+	})
+}
+
+func (r *Repository) UpsertProductCost(ctx context.Context, storeID string, sku string, costCents int64) error {
+	return r.writeErr(func() error { return r.Repository.UpsertProductCost(ctx, storeID, sku, costCents) })
+}
+
+func (r *Repository) CreateUser(ctx context.Context, user domain.UserAccount) error {
+	return r.writeErr(func() error { return r.Repository.CreateUser(ctx, user) })
+}
+
+func (r *Repository) UpdateUserPassword(ctx context.Context, username string, password string) error {
+	return r.writeErr(func() error { return r.Repository.UpdateUserPassword(ctx, username, password) })
+}
+
+func (r *Repository) UpdateUserActive(ctx context.Context, username string, active bool) error {
+	return r.writeErr(func() error { return r.Repository.UpdateUserActive(ctx, username, active) })
+}
+
+func (r *Repository) UpdateUserRole(ctx context.Context, username string, role string) error {
+	return r.writeErr(func() error { return r.Repository.UpdateUserRole(ctx, username, role) })
+}
+
+func (r *Repository) SaveTerminal(ctx context.Context, terminal domain.Terminal) (*domain.Terminal, error) {
+	return write(r, func() (*domain.Terminal, error) { return r.Repository.SaveTerminal(ctx, terminal) })
+}
+
+func (r *Repository) RevokeTerminal(ctx context.Context, storeID string, terminalID string, at time.Time) (*domain.Terminal, error) {
+	return write(r, func() (*domain.Terminal, error) { return r.Repository.RevokeTerminal(ctx, storeID, terminalID, at) })
+}
+
+func (r *Repository) CreateRefreshToken(ctx context.Context, token domain.RefreshToken) error {
+	return r.writeErr(func() error { return r.Repository.CreateRefreshToken(ctx, token) })
+}
+
+func (r *Repository) ConsumeRefreshToken(ctx context.Context, tokenHash string, at time.Time) (*domain.RefreshToken, error) {
+	return write(r, func() (*domain.RefreshToken, error) { return r.Repository.ConsumeRefreshToken(ctx, tokenHash, at) })
+}
+
+func (r *Repository) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	return r.writeErr(func() error { return r.Repository.RevokeRefreshToken(ctx, tokenHash) })
+}
+
+func (r *Repository) RevokeUserRefreshTokens(ctx context.Context, username string) error {
+	return r.writeErr(func() error { return r.Repository.RevokeUserRefreshTokens(ctx, username) })
+}
+
+func (r *Repository) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	return r.writeErr(func() error { return r.Repository.RevokeAccessToken(ctx, jti, expiresAt) })
+}
+
+func (r *Repository) PruneRefreshTokens(ctx context.Context, before time.Time) (int, error) {
+	return write(r, func() (int, error) { return r.Repository.PruneRefreshTokens(ctx, before) })
+}
+
+func (r *Repository) PruneRevokedAccessTokens(ctx context.Context, before time.Time) (int, error) {
+	return write(r, func() (int, error) { return r.Repository.PruneRevokedAccessTokens(ctx, before) })
+}
+
+func (r *Repository) SaveOfflineEnvelope(ctx context.Context, storeID string, terminalID string, resp domain.OfflineSyncResponse, expiresAt time.Time) error {
+	return r.writeErr(func() error { return r.Repository.SaveOfflineEnvelope(ctx, storeID, terminalID, resp, expiresAt) })
+}
+
+func (r *Repository) PruneOfflineEnvelopes(ctx context.Context, before time.Time) (int, error) {
+	return write(r, func() (int, error) { return r.Repository.PruneOfflineEnvelopes(ctx, before) })
+}
@@ -1,9 +1,11 @@
 package memory
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"log"
+	"maps"
 	"math"
 	"os"
 	"slices"
@@ -24,6 +26,7 @@ type Store struct {
 	inventory          map[string]map[string]int
 	inventoryLots      map[string]map[string][]domain.InventoryLot
 	associationPairs   []domain.AssociationPair
+	categoryPairs      []domain.CategoryAssociationPair
 	transactionsByID   map[string]*domain.Transaction
 	transactionsByIdem map[string]*domain.Transaction
 	refundsByID        map[string]domain.Refund
@@ -36,9 +39,21 @@ type Store struct {
 	promosByID         map[string]domain.PromoRule
 	heldCartsByID      map[string]domain.HeldCart
 	suppliersByID      map[string]domain.Supplier
+	supplierProducts   map[string]domain.SupplierProduct
 	purchaseOrdersByID map[string]domain.PurchaseOrder
 	productCosts       map[string]map[string]int64
 	usersByUsername    map[string]domain.UserAccount
+	refreshTokens      map[string]domain.RefreshToken
+	revokedTokens      map[string]time.Time
+	offlineEnvelopes   map[string]offlineEnvelope
+	terminals          map[string]domain.Terminal
+	writeOffs          []domain.StockWriteOff
+	opnamesByID        map[string]domain.StockOpnameRecord
+	serialsByKey       map[string]domain.InventorySerial
+	movements          []domain.StockMovement
+	cashMovements      []domain.ShiftCashMovement
+	storeCredits       []domain.StoreCreditEntry
+	allowNegativeStock bool
 }
 
 // seedUsers builds the initial in-memory user accounts for dev/demo mode.
@@ -85,6 +100,8 @@ func envOr(key, fallback string) string {
 	return fallback
 }
 
+// NewSeeded returns a store filled with the demo catalog, 120 units of each
+// product in "main-store" and demo association pairs.
 func NewSeeded() *Store {
 	products := []domain.Product{
 		{SKU: "SKU-MIE-01", Name: "Mie Goreng Instan", Category: "grocery", PriceCents: 3500, MarginRate: 0.22, Active: true},
@@ -113,12 +130,33 @@ func NewSeeded() *Store {
 		{SourceSKU: "SKU-KERIPIK-01", TargetSKU: "SKU-AIR-01", Affinity: 0.47},
 	}
 
+	stock := make(map[string]int, len(products))
+	for i := range products {
+		products[i].PickingStrategy = domain.PickingStrategyFEFO
+		stock[products[i].SKU] = 120
+	}
+	return newStore(products, stock, pairs)
+}
+
+// NewEmpty returns a store with no products, stock or association pairs. The
+// admin and cashier accounts are still created so the store can be logged
+// into.
+func NewEmpty() *Store {
+	return newStore(nil, nil, nil)
+}
+
+// newStore builds a store holding products, with stock as the opening
+// quantities in "main-store".
+func newStore(products []domain.Product, stock map[string]int, pairs []domain.AssociationPair) *Store {
 	productMap := make(map[string]domain.Product, len(products))
 	inventory := make(map[string]map[string]int)
 	inventory["main-store"] = make(map[string]int)
 	for _, p := range products {
 		productMap[p.SKU] = p
-		inventory["main-store"][p.SKU] = 120
+		inventory["main-store"][p.SKU] = stock[p.SKU]
+	}
+	if pairs == nil {
+		pairs = []domain.AssociationPair{}
 	}
 
 	return &Store{
@@ -138,19 +176,46 @@ func NewSeeded() *Store {
 		promosByID:         make(map[string]domain.PromoRule),
 		heldCartsByID:      make(map[string]domain.HeldCart),
 		suppliersByID:      make(map[string]domain.Supplier),
+		supplierProducts:   make(map[string]domain.SupplierProduct),
 		purchaseOrdersByID: make(map[string]domain.PurchaseOrder),
 		productCosts:       map[string]map[string]int64{"main-store": {}},
 		usersByUsername: seedUsers(),
+		refreshTokens:      make(map[string]domain.RefreshToken),
+		revokedTokens:      make(map[string]time.Time),
+		offlineEnvelopes:   make(map[string]offlineEnvelope),
+		terminals:          make(map[string]domain.Terminal),
+		opnamesByID:        make(map[string]domain.StockOpnameRecord),
+		serialsByKey:       make(map[string]domain.InventorySerial),
 	}
 }
 
+// Ping always succeeds; the in-memory store has no backing connection.
+func (s *Store) Ping(_ context.Context) error {
+	return nil
+}
+
+// SetAllowNegativeStock lets checkout sell past the recorded quantity.
+func (s *Store) SetAllowNegativeStock(allow bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.allowNegativeStock = allow
+}
+
 func (s *Store) ListProducts(_ context.Context) ([]domain.Product, error) {
+	return s.listProducts(false), nil
+}
+
+func (s *Store) ListAllProducts(_ context.Context) ([]domain.Product, error) {
+	return s.listProducts(true), nil
+}
+
+func (s *Store) listProducts(includeInactive bool) []domain.Product {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	products := make([]domain.Product, 0, len(s.products))
 	for _, p := range s.products {
-		if !p.Active {
+		if !p.Active && !includeInactive {
 			continue
 		}
 		products = append(products, p)
@@ -163,7 +228,7 @@ func (s *Store) ListProducts(_ context.Context) ([]domain.Product, error) {
 		return cmpString(a.Category, b.Category)
 	})
 
-	return products, nil
+	return products
 }
 
 func (s *Store) CreateProduct(_ context.Context, product domain.Product) (*domain.Product, error) {
@@ -173,14 +238,15 @@ func (s *Store) CreateProduct(_ context.Context, product domain.Product) (*domai
 	if product.SKU == "" || product.Name == "" || product.Category == "" || product.PriceCents < 1 {
 		return nil, store.ErrInvalidTransaction
 	}
-	if product.MarginRate < 0 || product.MarginRate > 1 {
+	if product.MarginRate < 0 || product.MarginRate > 1 || !store.ValidTaxRate(product) || !store.ValidAvailability(product) || !store.ValidTags(product) {
 		return nil, store.ErrInvalidTransaction
 	}
 	if _, exists := s.products[product.SKU]; exists {
-		return nil, store.ErrInvalidTransaction
+		return nil, store.ErrDuplicateID
 	}
 
 	product.Active = true
+	product.Tags = slices.Clone(product.Tags)
 	s.products[product.SKU] = product
 	created := product
 	return &created, nil
@@ -205,13 +271,14 @@ func (s *Store) UpdateProduct(_ context.Context, product domain.Product) (*domai
 	if product.SKU == "" || product.Name == "" || product.Category == "" || product.PriceCents < 1 {
 		return nil, store.ErrInvalidTransaction
 	}
-	if product.MarginRate < 0 || product.MarginRate > 1 {
+	if product.MarginRate < 0 || product.MarginRate > 1 || !store.ValidTaxRate(product) || !store.ValidAvailability(product) || !store.ValidTags(product) {
 		return nil, store.ErrInvalidTransaction
 	}
 	if _, exists := s.products[product.SKU]; !exists {
 		return nil, store.ErrNotFound
 	}
 
+	product.Tags = slices.Clone(product.Tags)
 	s.products[product.SKU] = product
 	updated := product
 	return &updated, nil
@@ -257,6 +324,31 @@ func (s *Store) ListPriceHistory(_ context.Context, sku string, limit int) ([]do
 	return result, nil
 }
 
+func (s *Store) ListPriceChanges(_ context.Context, from time.Time, to time.Time) ([]domain.ProductPriceHistory, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]domain.ProductPriceHistory, 0)
+	for _, history := range s.priceHistoryBySKU {
+		for _, entry := range history {
+			if entry.ChangedAt.Before(from) || !entry.ChangedAt.Before(to) {
+				continue
+			}
+			result = append(result, entry)
+		}
+	}
+	slices.SortFunc(result, func(a, b domain.ProductPriceHistory) int {
+		if a.ChangedAt.Equal(b.ChangedAt) {
+			return cmpString(a.ID, b.ID)
+		}
+		if a.ChangedAt.Before(b.ChangedAt) {
+			return -1
+		}
+		return 1
+	})
+	return result, nil
+}
+
 func (s *Store) GetProductsBySKUs(_ context.Context, skus []string) (map[string]domain.Product, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -270,6 +362,14 @@ func (s *Store) GetProductsBySKUs(_ context.Context, skus []string) (map[string]
 	return result, nil
 }
 
+func (s *Store) GetProductsBySKUsDetailed(ctx context.Context, skus []string) (map[string]domain.Product, []string, error) {
+	result, err := s.GetProductsBySKUs(ctx, skus)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, store.MissingSKUs(skus, result), nil
+}
+
 func (s *Store) GetStockMap(_ context.Context, storeID string, skus []string) (map[string]int, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -295,38 +395,118 @@ func (s *Store) SetStock(_ context.Context, storeID string, sku string, qty int)
 	defer s.mu.Unlock()
 
 	if _, exists := s.products[sku]; !exists {
-		return fmt.Errorf("sku %s unavailable", sku)
+		return fmt.Errorf("%w: sku %s", store.ErrProductUnavailable, sku)
 	}
 	storeStock, ok := s.inventory[storeID]
 	if !ok {
 		storeStock = make(map[string]int)
 		s.inventory[storeID] = storeStock
 	}
+	s.recordMovementLocked(storeID, sku, qty-storeStock[sku], domain.MovementReasonManualSet, "", time.Now().UTC())
 	storeStock[sku] = qty
 	return nil
 }
 
-func (s *Store) CreateInventoryLot(_ context.Context, lot domain.InventoryLot) (*domain.InventoryLot, error) {
-	if lot.StoreID == "" || lot.SKU == "" || lot.QtyReceived < 1 || lot.CostCents < 1 {
-		return nil, store.ErrInvalidTransaction
+// SetStockBulk overwrites the quantity of every SKU in quantities. Nothing is
+// written unless every SKU exists and every quantity is non-negative.
+func (s *Store) SetStockBulk(_ context.Context, storeID string, quantities map[string]int) error {
+	if storeID == "" || len(quantities) == 0 {
+		return store.ErrInvalidTransaction
 	}
-	if lot.ID == "" {
-		lot.ID = xid.New("lot")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	skus := make([]string, 0, len(quantities))
+	for sku, qty := range quantities {
+		if qty < 0 {
+			return &store.SKUError{SKU: sku, Err: store.ErrInvalidTransaction}
+		}
+		if _, exists := s.products[sku]; !exists {
+			return &store.SKUError{SKU: sku, Err: store.ErrNotFound}
+		}
+		skus = append(skus, sku)
 	}
-	if strings.TrimSpace(lot.LotCode) == "" {
-		lot.LotCode = "MANUAL-" + lot.ID
+	slices.Sort(skus)
+
+	storeStock, ok := s.inventory[storeID]
+	if !ok {
+		storeStock = make(map[string]int)
+		s.inventory[storeID] = storeStock
 	}
-	if lot.QtyAvailable < 0 || lot.QtyAvailable > lot.QtyReceived {
+	now := time.Now().UTC()
+	for _, sku := range skus {
+		s.recordMovementLocked(storeID, sku, quantities[sku]-storeStock[sku], domain.MovementReasonManualSet, "", now)
+		storeStock[sku] = quantities[sku]
+	}
+	return nil
+}
+
+func (s *Store) CreateStockOpname(_ context.Context, record domain.StockOpnameRecord) (*domain.StockOpnameRecord, error) {
+	if record.StoreID == "" || len(record.Items) == 0 {
 		return nil, store.ErrInvalidTransaction
 	}
-	if lot.QtyAvailable == 0 {
-		lot.QtyAvailable = lot.QtyReceived
+	if record.ID == "" {
+		record.ID = xid.New("opname")
 	}
-	if lot.SourceType == "" {
-		lot.SourceType = "manual"
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now().UTC()
 	}
-	if lot.ReceivedAt.IsZero() {
-		lot.ReceivedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, item := range record.Items {
+		if item.SKU == "" || item.CountedQty < 0 {
+			return nil, store.ErrInvalidTransaction
+		}
+		if _, exists := s.products[item.SKU]; !exists {
+			return nil, store.ErrNotFound
+		}
+	}
+
+	storeStock, ok := s.inventory[record.StoreID]
+	if !ok {
+		storeStock = make(map[string]int)
+		s.inventory[record.StoreID] = storeStock
+	}
+	items := make([]domain.StockOpnameAdjustment, 0, len(record.Items))
+	for _, item := range record.Items {
+		systemQty := storeStock[item.SKU]
+		storeStock[item.SKU] = item.CountedQty
+		s.recordMovementLocked(record.StoreID, item.SKU, item.CountedQty-systemQty, domain.MovementReasonOpname, record.ID, record.CreatedAt)
+		items = append(items, domain.StockOpnameAdjustment{
+			SKU:        item.SKU,
+			SystemQty:  systemQty,
+			CountedQty: item.CountedQty,
+			DeltaQty:   item.CountedQty - systemQty,
+		})
+	}
+	record.Items = items
+	s.opnamesByID[record.ID] = record
+
+	created := record
+	created.Items = slices.Clone(items)
+	return &created, nil
+}
+
+func (s *Store) GetStockOpname(_ context.Context, opnameID string) (*domain.StockOpnameRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.opnamesByID[opnameID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	found := record
+	found.Items = slices.Clone(record.Items)
+	return &found, nil
+}
+
+func (s *Store) CreateInventoryLot(_ context.Context, lot domain.InventoryLot) (*domain.InventoryLot, error) {
+	lot, err := normalizeInventoryLot(lot)
+	if err != nil {
+		return nil, err
 	}
 
 	s.mu.Lock()
@@ -335,17 +515,193 @@ func (s *Store) CreateInventoryLot(_ context.Context, lot domain.InventoryLot) (
 	if _, exists := s.products[lot.SKU]; !exists {
 		return nil, store.ErrNotFound
 	}
+	if err := s.checkNewSerialsLocked([]domain.InventoryLot{lot}); err != nil {
+		return nil, err
+	}
+	s.appendLotLocked(lot)
+	s.addSerialsLocked(lot)
+	s.recordLotReceiveLocked(lot)
+	created := cloneInventoryLot(lot)
+	return &created, nil
+}
+
+func (s *Store) CreateInventoryLots(_ context.Context, lots []domain.InventoryLot) ([]domain.InventoryLot, error) {
+	if len(lots) == 0 {
+		return nil, store.ErrInvalidTransaction
+	}
+	normalized := make([]domain.InventoryLot, 0, len(lots))
+	for _, lot := range lots {
+		lot, err := normalizeInventoryLot(lot)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, lot)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, lot := range normalized {
+		if _, exists := s.products[lot.SKU]; !exists {
+			return nil, store.ErrNotFound
+		}
+	}
+	if err := s.checkNewSerialsLocked(normalized); err != nil {
+		return nil, err
+	}
+	created := make([]domain.InventoryLot, 0, len(normalized))
+	for _, lot := range normalized {
+		s.appendLotLocked(lot)
+		s.addSerialsLocked(lot)
+		s.recordLotReceiveLocked(lot)
+		created = append(created, cloneInventoryLot(lot))
+	}
+	return created, nil
+}
+
+// checkNewSerialsLocked rejects serials that are already registered for the
+// SKU or repeated within the incoming lots.
+func (s *Store) checkNewSerialsLocked(lots []domain.InventoryLot) error {
+	seen := map[string]struct{}{}
+	for _, lot := range lots {
+		for _, serial := range lot.Serials {
+			key := serialKey(lot.SKU, serial)
+			if _, exists := s.serialsByKey[key]; exists {
+				return store.ErrInvalidTransaction
+			}
+			if _, dup := seen[key]; dup {
+				return store.ErrInvalidTransaction
+			}
+			seen[key] = struct{}{}
+		}
+	}
+	return nil
+}
+
+func (s *Store) addSerialsLocked(lot domain.InventoryLot) {
+	for _, serial := range lot.Serials {
+		s.serialsByKey[serialKey(lot.SKU, serial)] = domain.InventorySerial{
+			Serial:     serial,
+			StoreID:    lot.StoreID,
+			SKU:        lot.SKU,
+			LotID:      lot.ID,
+			Status:     domain.SerialStatusAvailable,
+			ReceivedAt: lot.ReceivedAt,
+		}
+	}
+}
+
+func (s *Store) ListSerials(_ context.Context, storeID string, sku string, status string) ([]domain.InventorySerial, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	serials := make([]domain.InventorySerial, 0)
+	for _, entry := range s.serialsByKey {
+		if entry.StoreID != storeID || entry.SKU != sku {
+			continue
+		}
+		if status != "" && entry.Status != status {
+			continue
+		}
+		serials = append(serials, cloneInventorySerial(entry))
+	}
+	slices.SortFunc(serials, func(a, b domain.InventorySerial) int {
+		if c := a.ReceivedAt.Compare(b.ReceivedAt); c != 0 {
+			return c
+		}
+		return cmpString(a.Serial, b.Serial)
+	})
+	return serials, nil
+}
+
+func (s *Store) appendLotLocked(lot domain.InventoryLot) {
 	if _, ok := s.inventory[lot.StoreID]; !ok {
 		s.inventory[lot.StoreID] = map[string]int{}
 	}
 	if _, ok := s.inventoryLots[lot.StoreID]; !ok {
 		s.inventoryLots[lot.StoreID] = map[string][]domain.InventoryLot{}
 	}
-
 	s.inventoryLots[lot.StoreID][lot.SKU] = append(s.inventoryLots[lot.StoreID][lot.SKU], lot)
 	s.inventory[lot.StoreID][lot.SKU] += lot.QtyAvailable
-	created := cloneInventoryLot(lot)
-	return &created, nil
+}
+
+// recordLotReceiveLocked logs the stock a new lot brings in. Lots created on
+// behalf of another flow (returns, voids) keep that flow's source type as the
+// reason.
+func (s *Store) recordLotReceiveLocked(lot domain.InventoryLot) {
+	reason := domain.MovementReasonLotReceive
+	refID := lot.ID
+	if lot.SourceType != "" && lot.SourceType != "manual" {
+		reason = lot.SourceType
+		if lot.SourceID != "" {
+			refID = lot.SourceID
+		}
+	}
+	s.recordMovementLocked(lot.StoreID, lot.SKU, lot.QtyAvailable, reason, refID, lot.ReceivedAt)
+}
+
+func (s *Store) recordMovementLocked(storeID string, sku string, delta int, reason string, refID string, at time.Time) {
+	if delta == 0 {
+		return
+	}
+	s.movements = append(s.movements, domain.StockMovement{
+		ID:        int64(len(s.movements) + 1),
+		StoreID:   storeID,
+		SKU:       sku,
+		Delta:     delta,
+		Reason:    reason,
+		RefID:     refID,
+		CreatedAt: at,
+	})
+}
+
+func (s *Store) ListStockMovements(_ context.Context, storeID string, sku string, from time.Time, to time.Time) ([]domain.StockMovement, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	movements := make([]domain.StockMovement, 0)
+	for _, movement := range s.movements {
+		if movement.StoreID != storeID || (sku != "" && movement.SKU != sku) {
+			continue
+		}
+		if movement.CreatedAt.Before(from) || !movement.CreatedAt.Before(to) {
+			continue
+		}
+		movements = append(movements, movement)
+	}
+	slices.SortStableFunc(movements, func(a, b domain.StockMovement) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return movements, nil
+}
+
+// normalizeInventoryLot validates a lot before insert and fills in defaults.
+func normalizeInventoryLot(lot domain.InventoryLot) (domain.InventoryLot, error) {
+	if lot.StoreID == "" || lot.SKU == "" || lot.QtyReceived < 1 || lot.CostCents < 1 {
+		return lot, store.ErrInvalidTransaction
+	}
+	if lot.ID == "" {
+		lot.ID = xid.New("lot")
+	}
+	if strings.TrimSpace(lot.LotCode) == "" {
+		lot.LotCode = "MANUAL-" + lot.ID
+	}
+	if lot.QtyAvailable < 0 || lot.QtyAvailable > lot.QtyReceived {
+		return lot, store.ErrInvalidTransaction
+	}
+	if len(lot.Serials) > 0 && len(lot.Serials) != lot.QtyReceived {
+		return lot, store.ErrInvalidTransaction
+	}
+	if lot.QtyAvailable == 0 {
+		lot.QtyAvailable = lot.QtyReceived
+	}
+	if lot.SourceType == "" {
+		lot.SourceType = "manual"
+	}
+	if lot.ReceivedAt.IsZero() {
+		lot.ReceivedAt = time.Now().UTC()
+	}
+	return lot, nil
 }
 
 func (s *Store) ListInventoryLots(_ context.Context, storeID string, sku string, includeExpired bool, limit int) ([]domain.InventoryLot, error) {
@@ -392,66 +748,436 @@ func (s *Store) ListInventoryLots(_ context.Context, storeID string, sku string,
 	return result, nil
 }
 
-func (s *Store) IncreaseStock(_ context.Context, storeID string, adjustments []domain.StockAdjustment) error {
+func (s *Store) GetInventoryLot(_ context.Context, lotID string) (*domain.InventoryLot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lot, ok := s.findLotLocked(lotID)
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	found := cloneInventoryLot(*lot)
+	return &found, nil
+}
+
+func (s *Store) AdjustLotQty(_ context.Context, lotID string, qtyAvailable int, audit domain.AuditLog) (*domain.InventoryLot, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	storeStock, ok := s.inventory[storeID]
+	lot, ok := s.findLotLocked(lotID)
 	if !ok {
-		storeStock = make(map[string]int)
-		s.inventory[storeID] = storeStock
+		return nil, store.ErrNotFound
+	}
+	if qtyAvailable < 0 || qtyAvailable > lot.QtyReceived {
+		return nil, store.ErrInvalidTransaction
 	}
 
-	for _, adj := range adjustments {
-		if adj.Qty < 1 {
-			continue
-		}
-		if _, exists := s.products[adj.SKU]; !exists {
-			return fmt.Errorf("sku %s unavailable", adj.SKU)
-		}
-		storeStock[adj.SKU] += adj.Qty
+	delta := qtyAvailable - lot.QtyAvailable
+	lot.QtyAvailable = qtyAvailable
+	if _, ok := s.inventory[lot.StoreID]; !ok {
+		s.inventory[lot.StoreID] = map[string]int{}
 	}
+	before := s.inventory[lot.StoreID][lot.SKU]
+	s.inventory[lot.StoreID][lot.SKU] = max(0, before+delta)
+	s.recordMovementLocked(lot.StoreID, lot.SKU, s.inventory[lot.StoreID][lot.SKU]-before, domain.MovementReasonLotAdjust, lot.ID, time.Now().UTC())
 
-	return nil
+	if audit.ID == "" {
+		audit.ID = xid.New("audit")
+	}
+	if audit.CreatedAt.IsZero() {
+		audit.CreatedAt = time.Now().UTC()
+	}
+	s.auditLogs = append(s.auditLogs, audit)
+
+	updated := cloneInventoryLot(*lot)
+	return &updated, nil
 }
 
-func (s *Store) GetAssociationPairs(_ context.Context, sourceSKUs []string) ([]domain.AssociationPair, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+func (s *Store) CorrectLotCost(_ context.Context, lotID string, costCents int64, audit domain.AuditLog) (*domain.InventoryLot, error) {
+	if costCents < 1 {
+		return nil, store.ErrInvalidTransaction
+	}
 
-	sourceSet := make(map[string]struct{}, len(sourceSKUs))
-	for _, sku := range sourceSKUs {
-		sourceSet[sku] = struct{}{}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lot, ok := s.findLotLocked(lotID)
+	if !ok {
+		return nil, store.ErrNotFound
 	}
+	lot.CostCents = costCents
 
-	pairs := make([]domain.AssociationPair, 0, len(s.associationPairs))
-	for _, pair := range s.associationPairs {
-		if _, ok := sourceSet[pair.SourceSKU]; ok {
-			pairs = append(pairs, pair)
+	// Re-weight the SKU cost from every lot still on hand rather than
+	// incrementally, so the bad figure is fully removed.
+	totalValue := int64(0)
+	totalQty := 0
+	for _, candidate := range s.inventoryLots[lot.StoreID][lot.SKU] {
+		if candidate.QtyAvailable < 1 {
+			continue
 		}
+		totalValue += candidate.CostCents * int64(candidate.QtyAvailable)
+		totalQty += candidate.QtyAvailable
+	}
+	weighted := costCents
+	if totalQty > 0 {
+		weighted = maxInt64(1, int64(math.Round(float64(totalValue)/float64(totalQty))))
 	}
+	if _, ok := s.productCosts[lot.StoreID]; !ok {
+		s.productCosts[lot.StoreID] = make(map[string]int64)
+	}
+	s.productCosts[lot.StoreID][lot.SKU] = weighted
 
-	return pairs, nil
-}
+	if audit.ID == "" {
+		audit.ID = xid.New("audit")
+	}
+	if audit.CreatedAt.IsZero() {
+		audit.CreatedAt = time.Now().UTC()
+	}
+	s.auditLogs = append(s.auditLogs, audit)
 
-func (s *Store) FindTransactionByIdempotency(_ context.Context, key string) (*domain.Transaction, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	updated := cloneInventoryLot(*lot)
+	return &updated, nil
+}
 
-	tx, ok := s.transactionsByIdem[key]
-	if !ok {
-		return nil, store.ErrNotFound
+// findLotLocked returns a pointer into the lot slice so callers holding the
+// write lock can mutate the lot in place.
+func (s *Store) findLotLocked(lotID string) (*domain.InventoryLot, bool) {
+	for _, bySKU := range s.inventoryLots {
+		for sku, lots := range bySKU {
+			for i := range lots {
+				if lots[i].ID == lotID {
+					return &bySKU[sku][i], true
+				}
+			}
+		}
 	}
-	return cloneTransaction(tx), nil
+	return nil, false
 }
 
-func (s *Store) FindTransactionByID(_ context.Context, id string) (*domain.Transaction, error) {
+func (s *Store) ListExpiringLots(_ context.Context, storeID string, withinDays int) ([]domain.ExpiringLot, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	tx, ok := s.transactionsByID[id]
-	if !ok {
-		return nil, store.ErrNotFound
+	cutoff := nowDateUTC(time.Now().UTC()).AddDate(0, 0, withinDays)
+	lots := make([]domain.InventoryLot, 0)
+	for _, bySKU := range s.inventoryLots[storeID] {
+		for _, lot := range bySKU {
+			if lot.QtyAvailable < 1 || lot.ExpiryDate == nil || lot.ExpiryDate.After(cutoff) {
+				continue
+			}
+			lots = append(lots, lot)
+		}
+	}
+	slices.SortFunc(lots, compareLotForFEFO)
+
+	result := make([]domain.ExpiringLot, 0, len(lots))
+	for _, lot := range lots {
+		result = append(result, domain.ExpiringLot{
+			LotID:           lot.ID,
+			StoreID:         lot.StoreID,
+			SKU:             lot.SKU,
+			ProductName:     s.products[lot.SKU].Name,
+			LotCode:         lot.LotCode,
+			ExpiryDate:      *lot.ExpiryDate,
+			QtyAvailable:    lot.QtyAvailable,
+			CostCents:       lot.CostCents,
+			AtRiskCostCents: lot.CostCents * int64(lot.QtyAvailable),
+		})
+	}
+	return result, nil
+}
+
+func (s *Store) WriteOffStock(_ context.Context, writeOff domain.StockWriteOff, audit domain.AuditLog) (*domain.StockWriteOff, error) {
+	if writeOff.StoreID == "" || writeOff.SKU == "" || writeOff.Qty < 1 {
+		return nil, store.ErrInvalidTransaction
+	}
+	if writeOff.ID == "" {
+		writeOff.ID = xid.New("wo")
+	}
+	if writeOff.CreatedAt.IsZero() {
+		writeOff.CreatedAt = time.Now().UTC()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.products[writeOff.SKU]; !exists {
+		return nil, store.ErrNotFound
+	}
+	storeStock, ok := s.inventory[writeOff.StoreID]
+	if !ok || storeStock[writeOff.SKU] < writeOff.Qty {
+		return nil, store.ErrInsufficientStock
+	}
+
+	writeOff.CostCents = s.consumeLotsLocked(writeOff.StoreID, writeOff.SKU, writeOff.Qty)
+	storeStock[writeOff.SKU] -= writeOff.Qty
+	s.writeOffs = append(s.writeOffs, writeOff)
+	s.recordMovementLocked(writeOff.StoreID, writeOff.SKU, -writeOff.Qty, domain.MovementReasonWriteOff, writeOff.ID, writeOff.CreatedAt)
+
+	if audit.ID == "" {
+		audit.ID = xid.New("audit")
+	}
+	if audit.CreatedAt.IsZero() {
+		audit.CreatedAt = writeOff.CreatedAt
+	}
+	audit.EntityID = writeOff.ID
+	s.auditLogs = append(s.auditLogs, audit)
+
+	created := writeOff
+	return &created, nil
+}
+
+func (s *Store) TransferStock(_ context.Context, fromStoreID string, lot domain.InventoryLot, audits []domain.AuditLog) ([]domain.InventoryLot, error) {
+	if fromStoreID == "" || lot.StoreID == "" || lot.SKU == "" || lot.QtyReceived < 1 {
+		return nil, store.ErrInvalidTransaction
+	}
+	if fromStoreID == lot.StoreID {
+		return nil, store.ErrInvalidTransaction
+	}
+	if lot.ID == "" {
+		lot.ID = xid.New("lot")
+	}
+	if strings.TrimSpace(lot.LotCode) == "" {
+		lot.LotCode = "TRANSFER-" + lot.ID
+	}
+	if lot.ReceivedAt.IsZero() {
+		lot.ReceivedAt = time.Now().UTC()
+	}
+	lot.SourceType = "transfer"
+	lot.QtyAvailable = lot.QtyReceived
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.products[lot.SKU]; !exists {
+		return nil, store.ErrNotFound
+	}
+	sourceStock, ok := s.inventory[fromStoreID]
+	if !ok || sourceStock[lot.SKU] < lot.QtyReceived {
+		return nil, store.ErrInsufficientStock
+	}
+
+	pieces, ok := s.takeTransferLotsLocked(fromStoreID, lot, sourceStock[lot.SKU])
+	if !ok {
+		return nil, store.ErrInsufficientStock
+	}
+	sourceStock[lot.SKU] -= lot.QtyReceived
+
+	destQty := s.inventory[lot.StoreID][lot.SKU]
+	totalCost := int64(0)
+	for _, piece := range pieces {
+		totalCost += piece.CostCents * int64(piece.QtyReceived)
+		s.appendLotLocked(piece)
+	}
+	if _, ok := s.productCosts[lot.StoreID]; !ok {
+		s.productCosts[lot.StoreID] = make(map[string]int64)
+	}
+	unitCost := maxInt64(1, totalCost/int64(lot.QtyReceived))
+	s.productCosts[lot.StoreID][lot.SKU] = weightedCostCents(s.productCosts[lot.StoreID][lot.SKU], destQty, unitCost, lot.QtyReceived)
+	s.recordMovementLocked(fromStoreID, lot.SKU, -lot.QtyReceived, domain.MovementReasonTransferOut, lot.ID, lot.ReceivedAt)
+	s.recordMovementLocked(lot.StoreID, lot.SKU, lot.QtyReceived, domain.MovementReasonTransferIn, lot.ID, lot.ReceivedAt)
+
+	for _, audit := range audits {
+		if audit.ID == "" {
+			audit.ID = xid.New("audit")
+		}
+		if audit.CreatedAt.IsZero() {
+			audit.CreatedAt = lot.ReceivedAt
+		}
+		s.auditLogs = append(s.auditLogs, audit)
+	}
+
+	created := make([]domain.InventoryLot, 0, len(pieces))
+	for _, piece := range pieces {
+		created = append(created, cloneInventoryLot(piece))
+	}
+	return created, nil
+}
+
+// takeTransferLotsLocked takes lot.QtyReceived units out of the source
+// store's unexpired lots in FEFO order, then out of the stockQty no lot
+// tracks, and returns the destination lots. It reports false without taking
+// anything when the usable units fall short.
+func (s *Store) takeTransferLotsLocked(fromStoreID string, lot domain.InventoryLot, stockQty int) ([]domain.InventoryLot, bool) {
+	today := nowDateUTC(time.Now().UTC())
+	lots := s.inventoryLots[fromStoreID][lot.SKU]
+	slices.SortFunc(lots, compareLotForFEFO)
+
+	tracked := 0
+	usable := 0
+	for _, candidate := range lots {
+		tracked += candidate.QtyAvailable
+		if candidate.ExpiryDate == nil || !candidate.ExpiryDate.Before(today) {
+			usable += candidate.QtyAvailable
+		}
+	}
+	if usable+max(stockQty-tracked, 0) < lot.QtyReceived {
+		return nil, false
+	}
+
+	pieces := make([]domain.InventoryLot, 0, 2)
+	remaining := lot.QtyReceived
+	for i := range lots {
+		if remaining == 0 {
+			break
+		}
+		if lots[i].QtyAvailable < 1 || (lots[i].ExpiryDate != nil && lots[i].ExpiryDate.Before(today)) {
+			continue
+		}
+		used := min(remaining, lots[i].QtyAvailable)
+		lots[i].QtyAvailable -= used
+		remaining -= used
+		pieces = append(pieces, store.TransferLot(lot, len(pieces), used, lots[i].CostCents, lots[i].ExpiryDate))
+	}
+	if remaining > 0 {
+		pieces = append(pieces, store.TransferLot(lot, len(pieces), remaining, s.productCosts[fromStoreID][lot.SKU], nil))
+	}
+	return pieces, true
+}
+
+// consumeLotsLocked drains qty units from the SKU's lots in FEFO order,
+// expired lots included, and returns the cost of the units removed. Units
+// not covered by any lot are valued at the store's current product cost.
+func (s *Store) consumeLotsLocked(storeID string, sku string, qty int) int64 {
+	lots := s.inventoryLots[storeID][sku]
+	slices.SortFunc(lots, compareLotForFEFO)
+
+	cost := int64(0)
+	remaining := qty
+	for i := range lots {
+		if remaining == 0 {
+			break
+		}
+		if lots[i].QtyAvailable < 1 {
+			continue
+		}
+		used := remaining
+		if used > lots[i].QtyAvailable {
+			used = lots[i].QtyAvailable
+		}
+		lots[i].QtyAvailable -= used
+		cost += lots[i].CostCents * int64(used)
+		remaining -= used
+	}
+	if remaining > 0 {
+		cost += s.productCosts[storeID][sku] * int64(remaining)
+	}
+	return cost
+}
+
+func (s *Store) IncreaseStock(_ context.Context, storeID string, adjustments []domain.StockAdjustment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	storeStock, ok := s.inventory[storeID]
+	if !ok {
+		storeStock = make(map[string]int)
+		s.inventory[storeID] = storeStock
+	}
+
+	for _, adj := range adjustments {
+		if adj.Qty < 1 {
+			continue
+		}
+		if _, exists := s.products[adj.SKU]; !exists {
+			return fmt.Errorf("%w: sku %s", store.ErrProductUnavailable, adj.SKU)
+		}
+		storeStock[adj.SKU] += adj.Qty
+		s.recordMovementLocked(storeID, adj.SKU, adj.Qty, domain.MovementReasonRestock, "", time.Now().UTC())
+	}
+
+	return nil
+}
+
+func (s *Store) GetAssociationPairs(_ context.Context, sourceSKUs []string) ([]domain.AssociationPair, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sourceSet := make(map[string]struct{}, len(sourceSKUs))
+	for _, sku := range sourceSKUs {
+		sourceSet[sku] = struct{}{}
+	}
+
+	pairs := make([]domain.AssociationPair, 0, len(s.associationPairs))
+	for _, pair := range s.associationPairs {
+		if _, ok := sourceSet[pair.SourceSKU]; ok {
+			pairs = append(pairs, pair)
+		}
+	}
+
+	return pairs, nil
+}
+
+func (s *Store) GetCategoryAssociationPairs(_ context.Context, sourceCategories []string) ([]domain.CategoryAssociationPair, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pairs := make([]domain.CategoryAssociationPair, 0)
+	for _, pair := range s.categoryPairs {
+		if slices.Contains(sourceCategories, pair.SourceCategory) {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs, nil
+}
+
+// UpsertAssociationPair stores a manually curated pair. Manual pairs replace
+// any computed pair for the same SKUs and survive retraining.
+func (s *Store) UpsertAssociationPair(_ context.Context, sourceSKU string, targetSKU string, affinity float64) (*domain.AssociationPair, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.products[sourceSKU]; !ok {
+		return nil, store.ErrNotFound
+	}
+	if _, ok := s.products[targetSKU]; !ok {
+		return nil, store.ErrNotFound
+	}
+
+	pair := domain.AssociationPair{SourceSKU: sourceSKU, TargetSKU: targetSKU, Affinity: affinity, Manual: true}
+	idx := slices.IndexFunc(s.associationPairs, func(p domain.AssociationPair) bool {
+		return p.SourceSKU == sourceSKU && p.TargetSKU == targetSKU
+	})
+	if idx >= 0 {
+		s.associationPairs[idx] = pair
+	} else {
+		s.associationPairs = append(s.associationPairs, pair)
+	}
+	return &pair, nil
+}
+
+func (s *Store) DeleteAssociationPair(_ context.Context, sourceSKU string, targetSKU string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := slices.IndexFunc(s.associationPairs, func(p domain.AssociationPair) bool {
+		return p.SourceSKU == sourceSKU && p.TargetSKU == targetSKU
+	})
+	if idx < 0 {
+		return store.ErrNotFound
+	}
+	s.associationPairs = slices.Delete(s.associationPairs, idx, idx+1)
+	return nil
+}
+
+func (s *Store) FindTransactionByIdempotency(_ context.Context, key string) (*domain.Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tx, ok := s.transactionsByIdem[key]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return cloneTransaction(tx), nil
+}
+
+func (s *Store) FindTransactionByID(_ context.Context, id string) (*domain.Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tx, ok := s.transactionsByID[id]
+	if !ok {
+		return nil, store.ErrNotFound
 	}
 	return cloneTransaction(tx), nil
 }
@@ -459,7 +1185,56 @@ func (s *Store) FindTransactionByID(_ context.Context, id string) (*domain.Trans
 func (s *Store) CreateCheckout(_ context.Context, tx domain.Transaction) (*domain.Transaction, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.createCheckoutLocked(tx)
+}
+
+// CreateCheckoutBatch stores every sale or none: when one fails, the stock,
+// lots, serials and movements changed by the earlier ones are restored.
+func (s *Store) CreateCheckoutBatch(_ context.Context, txs []domain.Transaction) ([]*domain.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inventory := make(map[string]map[string]int, len(s.inventory))
+	for storeID, stock := range s.inventory {
+		inventory[storeID] = maps.Clone(stock)
+	}
+	inventoryLots := make(map[string]map[string][]domain.InventoryLot, len(s.inventoryLots))
+	for storeID, lotsBySKU := range s.inventoryLots {
+		inventoryLots[storeID] = make(map[string][]domain.InventoryLot, len(lotsBySKU))
+		for sku, lots := range lotsBySKU {
+			inventoryLots[storeID][sku] = slices.Clone(lots)
+		}
+	}
+	serials := maps.Clone(s.serialsByKey)
+	movementCount := len(s.movements)
+	creditCount := len(s.storeCredits)
+
+	created := make([]*domain.Transaction, 0, len(txs))
+	added := make([]*domain.Transaction, 0, len(txs))
+	for i, tx := range txs {
+		_, replay := s.transactionsByIdem[tx.IdempotencyKey]
+		saved, err := s.createCheckoutLocked(tx)
+		if err != nil {
+			for _, done := range added {
+				delete(s.transactionsByID, done.ID)
+				delete(s.transactionsByIdem, done.IdempotencyKey)
+			}
+			s.inventory = inventory
+			s.inventoryLots = inventoryLots
+			s.serialsByKey = serials
+			s.movements = s.movements[:movementCount]
+			s.storeCredits = s.storeCredits[:creditCount]
+			return nil, &store.BatchError{Index: i, Err: err}
+		}
+		created = append(created, saved)
+		if !replay {
+			added = append(added, saved)
+		}
+	}
+	return created, nil
+}
 
+func (s *Store) createCheckoutLocked(tx domain.Transaction) (*domain.Transaction, error) {
 	if tx.IdempotencyKey == "" {
 		return nil, store.ErrInvalidTransaction
 	}
@@ -469,12 +1244,12 @@ func (s *Store) CreateCheckout(_ context.Context, tx domain.Transaction) (*domai
 	}
 
 	if len(tx.Items) == 0 {
-		return nil, store.ErrInvalidTransaction
+		return nil, store.ErrEmptyCart
 	}
 
 	storeStock, ok := s.inventory[tx.StoreID]
 	if !ok {
-		return nil, fmt.Errorf("store %s unavailable", tx.StoreID)
+		return nil, fmt.Errorf("%w: store %s", store.ErrNotFound, tx.StoreID)
 	}
 	if _, ok := s.inventoryLots[tx.StoreID]; !ok {
 		s.inventoryLots[tx.StoreID] = map[string][]domain.InventoryLot{}
@@ -489,14 +1264,17 @@ func (s *Store) CreateCheckout(_ context.Context, tx domain.Transaction) (*domai
 		}
 		product, exists := s.products[item.SKU]
 		if !exists || !product.Active {
-			return nil, fmt.Errorf("sku %s unavailable", item.SKU)
+			return nil, fmt.Errorf("%w: sku %s", store.ErrProductUnavailable, item.SKU)
+		}
+		if err := s.checkSaleSerialsLocked(tx.StoreID, product, item); err != nil {
+			return nil, err
 		}
 		remaining := storeStock[item.SKU] - item.Qty
-		if remaining < 0 {
-			return nil, store.ErrInsufficientStock
+		if remaining < 0 && !s.allowNegativeStock {
+			return nil, &store.SKUError{SKU: item.SKU, Err: store.ErrInsufficientStock}
 		}
 		lots := s.inventoryLots[tx.StoreID][item.SKU]
-		if len(lots) > 0 {
+		if len(lots) > 0 && !s.allowNegativeStock {
 			availableByLot := 0
 			for _, lot := range lots {
 				if lot.ExpiryDate != nil && lot.ExpiryDate.Before(today) {
@@ -505,28 +1283,31 @@ func (s *Store) CreateCheckout(_ context.Context, tx domain.Transaction) (*domai
 				availableByLot += lot.QtyAvailable
 			}
 			if availableByLot < item.Qty {
-				return nil, store.ErrInsufficientStock
+				return nil, &store.SKUError{SKU: item.SKU, Err: store.ErrInsufficientStock}
 			}
 		}
 		recomputedItems = append(recomputedItems, domain.TransactionLine{
 			SKU:            item.SKU,
+			Name:           product.Name,
 			Qty:            item.Qty,
 			UnitPriceCents: product.PriceCents,
+			UnitCostCents:  store.SaleUnitCost(product, s.productCosts[tx.StoreID][item.SKU]),
 			MarginRate:     product.MarginRate,
+			Serials:        slices.Clone(item.Serials),
+			TaxRatePercent: store.LineTaxRate(product, tx.TaxRatePercent),
 		})
 		subtotal += int64(item.Qty) * product.PriceCents
 	}
 
 	if tx.DiscountCents < 0 || tx.DiscountCents > subtotal {
-		return nil, store.ErrInvalidTransaction
+		return nil, store.ErrInvalidDiscount
 	}
 	if tx.TaxRatePercent < 0 || tx.TaxRatePercent > 100 {
-		return nil, store.ErrInvalidTransaction
+		return nil, store.ErrInvalidTaxRate
 	}
 
-	taxBase := subtotal - tx.DiscountCents
-	taxCents := int64(math.Round(float64(taxBase) * tx.TaxRatePercent / 100))
-	total := taxBase + taxCents
+	taxCents := store.ApplyLineTaxes(recomputedItems, tx.DiscountCents)
+	total := subtotal - tx.DiscountCents + taxCents
 
 	if tx.ID == "" {
 		tx.ID = xid.New("tx")
@@ -544,20 +1325,31 @@ func (s *Store) CreateCheckout(_ context.Context, tx domain.Transaction) (*domai
 
 	if tx.PaymentMethod == "cash" {
 		if tx.CashReceivedCents < tx.TotalCents {
-			return nil, store.ErrInvalidTransaction
+			return nil, store.ErrInsufficientPayment
 		}
 		tx.ChangeCents = tx.CashReceivedCents - tx.TotalCents
 	} else {
 		tx.ChangeCents = 0
 	}
+	credits := store.CheckoutStoreCredits(&tx)
+	for _, entry := range credits {
+		if entry.Kind == domain.StoreCreditKindRedeem && s.storeCreditBalanceLocked(entry.Code) < -entry.AmountCents {
+			return nil, fmt.Errorf("%w: %s", store.ErrInsufficientStoreCredit, entry.Code)
+		}
+	}
 
 	for _, item := range tx.Items {
 		storeStock[item.SKU] -= item.Qty
+		s.recordMovementLocked(tx.StoreID, item.SKU, -item.Qty, domain.MovementReasonSale, tx.ID, tx.CreatedAt)
+		if len(item.Serials) > 0 {
+			s.sellSerialsLocked(item, tx.ID, tx.CreatedAt)
+			continue
+		}
 		lots := s.inventoryLots[tx.StoreID][item.SKU]
 		if len(lots) == 0 {
 			continue
 		}
-		slices.SortFunc(lots, compareLotForFEFO)
+		slices.SortFunc(lots, lotComparator(s.products[item.SKU].PickingStrategy))
 		remaining := item.Qty
 		for i := range lots {
 			if remaining == 0 {
@@ -579,6 +1371,11 @@ func (s *Store) CreateCheckout(_ context.Context, tx domain.Transaction) (*domai
 		s.inventoryLots[tx.StoreID][item.SKU] = lots
 	}
 
+	for _, entry := range credits {
+		entry.ID = xid.New("credit")
+		s.storeCredits = append(s.storeCredits, entry)
+	}
+
 	txCopy := cloneTransaction(&tx)
 	s.transactionsByID[tx.ID] = txCopy
 	s.transactionsByIdem[tx.IdempotencyKey] = txCopy
@@ -586,6 +1383,49 @@ func (s *Store) CreateCheckout(_ context.Context, tx domain.Transaction) (*domai
 	return cloneTransaction(txCopy), nil
 }
 
+// checkSaleSerialsLocked verifies that a serialized line names exactly one
+// available serial per unit in the selling store.
+func (s *Store) checkSaleSerialsLocked(storeID string, product domain.Product, item domain.TransactionLine) error {
+	if !product.Serialized {
+		if len(item.Serials) > 0 {
+			return store.ErrInvalidSerials
+		}
+		return nil
+	}
+	if len(item.Serials) != item.Qty {
+		return store.ErrInvalidSerials
+	}
+	seen := make(map[string]struct{}, len(item.Serials))
+	for _, serial := range item.Serials {
+		if _, dup := seen[serial]; dup {
+			return store.ErrInvalidSerials
+		}
+		seen[serial] = struct{}{}
+		entry, ok := s.serialsByKey[serialKey(item.SKU, serial)]
+		if !ok || entry.StoreID != storeID || entry.Status != domain.SerialStatusAvailable {
+			return store.ErrInvalidSerials
+		}
+	}
+	return nil
+}
+
+// sellSerialsLocked marks the line's serials sold and takes each unit out of
+// the lot the serial was received in rather than the FEFO head.
+func (s *Store) sellSerialsLocked(item domain.TransactionLine, transactionID string, soldAt time.Time) {
+	for _, serial := range item.Serials {
+		key := serialKey(item.SKU, serial)
+		entry := s.serialsByKey[key]
+		if lot, ok := s.findLotLocked(entry.LotID); ok && lot.QtyAvailable > 0 {
+			lot.QtyAvailable--
+		}
+		at := soldAt
+		entry.Status = domain.SerialStatusSold
+		entry.TransactionID = transactionID
+		entry.SoldAt = &at
+		s.serialsByKey[key] = entry
+	}
+}
+
 func (s *Store) VoidTransaction(_ context.Context, id string, reason string, at time.Time) (*domain.Transaction, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -595,15 +1435,22 @@ func (s *Store) VoidTransaction(_ context.Context, id string, reason string, at
 		return nil, store.ErrNotFound
 	}
 	if tx.Status != domain.TxStatusPaid {
-		return nil, store.ErrInvalidTransaction
+		return nil, store.ErrInvalidState
 	}
 
 	storeStock := s.inventory[tx.StoreID]
 	if _, ok := s.inventoryLots[tx.StoreID]; !ok {
 		s.inventoryLots[tx.StoreID] = map[string][]domain.InventoryLot{}
 	}
+	if _, ok := s.productCosts[tx.StoreID]; !ok {
+		s.productCosts[tx.StoreID] = make(map[string]int64)
+	}
+	storeCosts := s.productCosts[tx.StoreID]
 	for _, item := range tx.Items {
+		unitCost := store.VoidRestockCost(item, storeCosts[item.SKU])
+		storeCosts[item.SKU] = weightedCostCents(storeCosts[item.SKU], storeStock[item.SKU], unitCost, item.Qty)
 		storeStock[item.SKU] += item.Qty
+		s.recordMovementLocked(tx.StoreID, item.SKU, item.Qty, domain.MovementReasonVoid, tx.ID, at)
 		lot := domain.InventoryLot{
 			ID:           xid.New("lot"),
 			StoreID:      tx.StoreID,
@@ -611,15 +1458,29 @@ func (s *Store) VoidTransaction(_ context.Context, id string, reason string, at
 			LotCode:      "VOID-" + tx.ID,
 			QtyReceived:  item.Qty,
 			QtyAvailable: item.Qty,
-			CostCents:    maxInt64(1, item.UnitPriceCents),
+			CostCents:    maxInt64(1, unitCost),
 			SourceType:   "void",
 			SourceID:     tx.ID,
 			Notes:        "auto restock from void",
 			ReceivedAt:   at,
 		}
 		s.inventoryLots[tx.StoreID][item.SKU] = append(s.inventoryLots[tx.StoreID][item.SKU], lot)
+		for _, serial := range item.Serials {
+			key := serialKey(item.SKU, serial)
+			entry, ok := s.serialsByKey[key]
+			if !ok {
+				continue
+			}
+			entry.LotID = lot.ID
+			entry.Status = domain.SerialStatusAvailable
+			entry.TransactionID = ""
+			entry.SoldAt = nil
+			s.serialsByKey[key] = entry
+		}
 	}
 
+	s.reverseStoreCreditsLocked(tx.ID, at)
+
 	tx.Status = domain.TxStatusVoided
 	tx.VoidReason = reason
 	tx.VoidedAt = &at
@@ -627,6 +1488,86 @@ func (s *Store) VoidTransaction(_ context.Context, id string, reason string, at
 	return cloneTransaction(tx), nil
 }
 
+// reverseStoreCreditsLocked adds a void entry per code undoing the store
+// credit a voided sale issued or redeemed.
+func (s *Store) reverseStoreCreditsLocked(transactionID string, at time.Time) {
+	var reversals []domain.StoreCreditEntry
+	for _, entry := range s.storeCredits {
+		if entry.TransactionID != transactionID {
+			continue
+		}
+		i := slices.IndexFunc(reversals, func(r domain.StoreCreditEntry) bool { return r.Code == entry.Code })
+		if i < 0 {
+			reversals = append(reversals, domain.StoreCreditEntry{
+				StoreID:       entry.StoreID,
+				Code:          entry.Code,
+				Kind:          domain.StoreCreditKindVoid,
+				TransactionID: transactionID,
+				CreatedAt:     at,
+			})
+			i = len(reversals) - 1
+		}
+		reversals[i].AmountCents -= entry.AmountCents
+	}
+	for _, reversal := range reversals {
+		if reversal.AmountCents == 0 {
+			continue
+		}
+		reversal.ID = xid.New("credit")
+		s.storeCredits = append(s.storeCredits, reversal)
+	}
+}
+
+func (s *Store) storeCreditBalanceLocked(code string) int64 {
+	var balance int64
+	for _, entry := range s.storeCredits {
+		if entry.Code == code {
+			balance += entry.AmountCents
+		}
+	}
+	return balance
+}
+
+func (s *Store) GetStoreCreditBalance(_ context.Context, code string) (*domain.StoreCreditBalance, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	balance := domain.StoreCreditBalance{Code: code, Entries: []domain.StoreCreditEntry{}}
+	for _, entry := range s.storeCredits {
+		if entry.Code == code {
+			balance.BalanceCents += entry.AmountCents
+			balance.Entries = append(balance.Entries, entry)
+		}
+	}
+	if len(balance.Entries) == 0 {
+		return nil, store.ErrNotFound
+	}
+	return &balance, nil
+}
+
+func (s *Store) RedeemStoreCredit(_ context.Context, storeID string, code string, amountCents int64, createdBy string, at time.Time) (*domain.StoreCreditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if amountCents < 1 {
+		return nil, store.ErrInvalidTransaction
+	}
+	if s.storeCreditBalanceLocked(code) < amountCents {
+		return nil, fmt.Errorf("%w: %s", store.ErrInsufficientStoreCredit, code)
+	}
+	entry := domain.StoreCreditEntry{
+		ID:          xid.New("credit"),
+		StoreID:     storeID,
+		Code:        code,
+		Kind:        domain.StoreCreditKindRedeem,
+		AmountCents: -amountCents,
+		CreatedBy:   createdBy,
+		CreatedAt:   at,
+	}
+	s.storeCredits = append(s.storeCredits, entry)
+	return &entry, nil
+}
+
 func (s *Store) CreateRefund(_ context.Context, refund domain.Refund) (*domain.Refund, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -710,6 +1651,14 @@ func (s *Store) CreateRecommendationEvent(_ context.Context, event domain.Recomm
 	return nil
 }
 
+func (s *Store) CreateRecommendationEventsBatch(_ context.Context, events []domain.RecommendationEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recommendationLog = append(s.recommendationLog, events...)
+	return nil
+}
+
 func (s *Store) GetAttachMetrics(_ context.Context, storeID string, from time.Time, to time.Time) (domain.AttachMetrics, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -729,15 +1678,76 @@ func (s *Store) GetAttachMetrics(_ context.Context, storeID string, from time.Ti
 		if tx.RecommendationAccepted {
 			metrics.Accepted++
 		}
+		if tx.ExperimentBucket == "" {
+			continue
+		}
+		idx := slices.IndexFunc(metrics.ByBucket, func(b domain.AttachBucketMetrics) bool {
+			return b.Bucket == tx.ExperimentBucket
+		})
+		if idx < 0 {
+			metrics.ByBucket = append(metrics.ByBucket, domain.AttachBucketMetrics{Bucket: tx.ExperimentBucket})
+			idx = len(metrics.ByBucket) - 1
+		}
+		metrics.ByBucket[idx].Transactions++
+		if tx.RecommendationAccepted {
+			metrics.ByBucket[idx].Accepted++
+		}
 	}
 
 	if metrics.Transactions > 0 {
 		metrics.AttachRate = (float64(metrics.Accepted) / float64(metrics.Transactions)) * 100
 	}
-
+	for i := range metrics.ByBucket {
+		bucket := &metrics.ByBucket[i]
+		bucket.AttachRate = (float64(bucket.Accepted) / float64(bucket.Transactions)) * 100
+	}
+	slices.SortFunc(metrics.ByBucket, func(a, b domain.AttachBucketMetrics) int {
+		return strings.Compare(a.Bucket, b.Bucket)
+	})
+
 	return metrics, nil
 }
 
+func (s *Store) GetAttachMetricsByReason(_ context.Context, storeID string, from time.Time, to time.Time) ([]domain.AttachReasonMetrics, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	byReason := map[string]*domain.AttachReasonMetrics{}
+	for _, event := range s.recommendationLog {
+		if event.StoreID != storeID || event.ReasonCode == "" {
+			continue
+		}
+		if event.CreatedAt.Before(from) || event.CreatedAt.After(to) {
+			continue
+		}
+		if event.Action != domain.RecommendationShownAction && event.Action != domain.RecommendationAcceptedAction {
+			continue
+		}
+		entry := byReason[event.ReasonCode]
+		if entry == nil {
+			entry = &domain.AttachReasonMetrics{ReasonCode: event.ReasonCode}
+			byReason[event.ReasonCode] = entry
+		}
+		if event.Action == domain.RecommendationShownAction {
+			entry.Shown++
+		} else {
+			entry.Accepted++
+		}
+	}
+
+	result := make([]domain.AttachReasonMetrics, 0, len(byReason))
+	for _, entry := range byReason {
+		if entry.Shown > 0 {
+			entry.AttachRate = (float64(entry.Accepted) / float64(entry.Shown)) * 100
+		}
+		result = append(result, *entry)
+	}
+	slices.SortFunc(result, func(a, b domain.AttachReasonMetrics) int {
+		return cmpString(a.ReasonCode, b.ReasonCode)
+	})
+	return result, nil
+}
+
 func (s *Store) GetDailyReport(_ context.Context, storeID string, from time.Time, to time.Time) (domain.DailyReport, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -746,6 +1756,7 @@ func (s *Store) GetDailyReport(_ context.Context, storeID string, from time.Time
 		StoreID:    storeID,
 		ByPayment:  make([]domain.DailyReportPayment, 0, 4),
 		ByTerminal: make([]domain.DailyReportTerminal, 0, 8),
+		ByTaxRate:  make([]domain.TaxRateTotal, 0, 2),
 	}
 	byPayment := map[string]*domain.DailyReportPayment{}
 	byTerminal := map[string]*domain.DailyReportTerminal{}
@@ -766,9 +1777,19 @@ func (s *Store) GetDailyReport(_ context.Context, storeID string, from time.Time
 		report.DiscountCents += tx.DiscountCents
 		report.TaxCents += tx.TaxCents
 		report.NetSalesCents += tx.TotalCents
+		for _, rate := range store.TaxBreakdown(tx.Items) {
+			i := slices.IndexFunc(report.ByTaxRate, func(total domain.TaxRateTotal) bool { return total.RatePercent == rate.RatePercent })
+			if i < 0 {
+				report.ByTaxRate = append(report.ByTaxRate, domain.TaxRateTotal{RatePercent: rate.RatePercent})
+				i = len(report.ByTaxRate) - 1
+			}
+			report.ByTaxRate[i].TaxableBaseCents += rate.TaxableBaseCents
+			report.ByTaxRate[i].TaxCents += rate.TaxCents
+		}
 		for _, item := range tx.Items {
-			margin := int64(math.Round(float64(item.UnitPriceCents*int64(item.Qty)) * item.MarginRate))
-			report.EstimatedMarginCents += margin
+			unitCost := lineUnitCost(item)
+			report.EstimatedMarginCents += (item.UnitPriceCents - unitCost) * int64(item.Qty)
+			report.CostOfGoodsCents += unitCost * int64(item.Qty)
 		}
 
 		payment := byPayment[tx.PaymentMethod]
@@ -788,6 +1809,16 @@ func (s *Store) GetDailyReport(_ context.Context, storeID string, from time.Time
 		terminal.TotalCents += tx.TotalCents
 	}
 
+	for _, writeOff := range s.writeOffs {
+		if writeOff.StoreID != storeID {
+			continue
+		}
+		if writeOff.CreatedAt.Before(from) || !writeOff.CreatedAt.Before(to) {
+			continue
+		}
+		report.WriteOffCostCents += writeOff.CostCents
+	}
+
 	for _, entry := range byPayment {
 		report.ByPayment = append(report.ByPayment, *entry)
 	}
@@ -801,10 +1832,255 @@ func (s *Store) GetDailyReport(_ context.Context, storeID string, from time.Time
 	slices.SortFunc(report.ByTerminal, func(a, b domain.DailyReportTerminal) int {
 		return cmpString(a.TerminalID, b.TerminalID)
 	})
+	slices.SortFunc(report.ByTaxRate, func(a, b domain.TaxRateTotal) int {
+		return cmp.Compare(a.RatePercent, b.RatePercent)
+	})
 
 	return report, nil
 }
 
+// lineUnitCost is the cost frozen on a sold line. Lines recorded before costs
+// were captured fall back to the estimate derived from their margin rate.
+func lineUnitCost(item domain.TransactionLine) int64 {
+	if item.UnitCostCents > 0 {
+		return item.UnitCostCents
+	}
+	return store.SaleUnitCost(domain.Product{PriceCents: item.UnitPriceCents, MarginRate: item.MarginRate}, 0)
+}
+
+func (s *Store) GetHourlySales(_ context.Context, storeID string, from time.Time, to time.Time, loc *time.Location) ([]domain.HourlySalesBucket, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	buckets := make([]domain.HourlySalesBucket, 24)
+	for _, tx := range s.transactionsByID {
+		if tx.StoreID != storeID {
+			continue
+		}
+		if tx.CreatedAt.Before(from) || !tx.CreatedAt.Before(to) {
+			continue
+		}
+		if tx.Status == domain.TxStatusVoided {
+			continue
+		}
+		hour := tx.CreatedAt.In(loc).Hour()
+		buckets[hour].Transactions++
+		buckets[hour].TotalCents += tx.TotalCents
+	}
+
+	result := make([]domain.HourlySalesBucket, 0, 24)
+	for hour, bucket := range buckets {
+		if bucket.Transactions == 0 {
+			continue
+		}
+		bucket.Hour = hour
+		result = append(result, bucket)
+	}
+	return result, nil
+}
+
+func (s *Store) GetUnitsSoldBySKU(_ context.Context, storeID string, skus []string, from time.Time, to time.Time) (map[string]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	units := make(map[string]int, len(skus))
+	for _, tx := range s.transactionsByID {
+		if tx.StoreID != storeID {
+			continue
+		}
+		if tx.CreatedAt.Before(from) || !tx.CreatedAt.Before(to) {
+			continue
+		}
+		if tx.Status == domain.TxStatusVoided {
+			continue
+		}
+		for _, item := range tx.Items {
+			if slices.Contains(skus, item.SKU) {
+				units[item.SKU] += item.Qty
+			}
+		}
+	}
+	return units, nil
+}
+
+func (s *Store) GetRangeReport(_ context.Context, storeID string, from time.Time, to time.Time, groupBy string, loc *time.Location) ([]domain.RangeReportBucket, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	buckets := map[string]*domain.RangeReportBucket{}
+	for _, tx := range s.transactionsByID {
+		if tx.StoreID != storeID {
+			continue
+		}
+		if tx.CreatedAt.Before(from) || !tx.CreatedAt.Before(to) {
+			continue
+		}
+		if tx.Status == domain.TxStatusVoided {
+			continue
+		}
+
+		key := rangeBucketStart(tx.CreatedAt, groupBy, loc).Format("2006-01-02")
+		bucket := buckets[key]
+		if bucket == nil {
+			bucket = &domain.RangeReportBucket{PeriodStart: key}
+			buckets[key] = bucket
+		}
+		bucket.Transactions++
+		bucket.GrossSalesCents += tx.SubtotalCents
+		bucket.DiscountCents += tx.DiscountCents
+		bucket.TaxCents += tx.TaxCents
+		bucket.NetSalesCents += tx.TotalCents
+		for _, item := range tx.Items {
+			bucket.EstimatedMarginCents += (item.UnitPriceCents - lineUnitCost(item)) * int64(item.Qty)
+		}
+	}
+
+	result := make([]domain.RangeReportBucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		result = append(result, *bucket)
+	}
+	slices.SortFunc(result, func(a, b domain.RangeReportBucket) int {
+		return cmpString(a.PeriodStart, b.PeriodStart)
+	})
+	return result, nil
+}
+
+// rangeBucketStart truncates t to the start of its day, ISO week (Monday) or
+// month in loc, matching postgres date_trunc on the local timestamp.
+func rangeBucketStart(t time.Time, groupBy string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	switch groupBy {
+	case domain.ReportGroupByWeek:
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case domain.ReportGroupByMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	default:
+		return day
+	}
+}
+
+func (s *Store) GetInventoryValuation(_ context.Context, storeID string) ([]domain.InventoryValuationLine, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	storeCosts := s.productCosts[storeID]
+	lines := make([]domain.InventoryValuationLine, 0, len(s.inventory[storeID]))
+	for sku, qty := range s.inventory[storeID] {
+		if qty < 1 {
+			continue
+		}
+		product, ok := s.products[sku]
+		if !ok {
+			continue
+		}
+		lines = append(lines, domain.InventoryValuationLine{
+			SKU:           sku,
+			Category:      product.Category,
+			Qty:           qty,
+			UnitCostCents: storeCosts[sku],
+		})
+	}
+	slices.SortFunc(lines, func(a, b domain.InventoryValuationLine) int {
+		return cmpString(a.SKU, b.SKU)
+	})
+	return lines, nil
+}
+
+func (s *Store) GetSalesBySupplier(_ context.Context, storeID string, from time.Time, to time.Time) ([]domain.SupplierSalesLine, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type skuSales struct {
+		units, revenue, margin int64
+	}
+	sales := map[string]*skuSales{}
+	for _, tx := range s.transactionsByID {
+		if tx.StoreID != storeID || tx.Status == domain.TxStatusVoided {
+			continue
+		}
+		if tx.CreatedAt.Before(from) || !tx.CreatedAt.Before(to) {
+			continue
+		}
+		for _, item := range tx.Items {
+			line, ok := sales[item.SKU]
+			if !ok {
+				line = &skuSales{}
+				sales[item.SKU] = line
+			}
+			qty := int64(item.Qty)
+			line.units += qty
+			line.revenue += item.UnitPriceCents * qty
+			line.margin += (item.UnitPriceCents - lineUnitCost(item)) * qty
+		}
+	}
+
+	bySupplier := map[string]*domain.SupplierSalesLine{}
+	for sku, line := range sales {
+		supplierID := s.skuSupplierLocked(storeID, sku)
+		total, ok := bySupplier[supplierID]
+		if !ok {
+			total = &domain.SupplierSalesLine{SupplierID: supplierID, SupplierName: s.suppliersByID[supplierID].Name}
+			bySupplier[supplierID] = total
+		}
+		total.SKUs++
+		total.Units += line.units
+		total.RevenueCents += line.revenue
+		total.MarginCents += line.margin
+	}
+
+	lines := make([]domain.SupplierSalesLine, 0, len(bySupplier))
+	for _, total := range bySupplier {
+		lines = append(lines, *total)
+	}
+	slices.SortFunc(lines, func(a, b domain.SupplierSalesLine) int {
+		if a.RevenueCents != b.RevenueCents {
+			if a.RevenueCents > b.RevenueCents {
+				return -1
+			}
+			return 1
+		}
+		return cmpString(a.SupplierID, b.SupplierID)
+	})
+	return lines, nil
+}
+
+// skuSupplierLocked attributes sku to the supplier of its most recently
+// received purchase order in storeID, else to its most recently updated
+// supplier mapping, else to no supplier ("").
+func (s *Store) skuSupplierLocked(storeID string, sku string) string {
+	var latest *domain.PurchaseOrder
+	for _, po := range s.purchaseOrdersByID {
+		if po.StoreID != storeID || po.Status != "received" || po.ReceivedAt == nil {
+			continue
+		}
+		if !slices.ContainsFunc(po.Items, func(item domain.PurchaseOrderItem) bool { return item.SKU == sku }) {
+			continue
+		}
+		if latest == nil || po.ReceivedAt.After(*latest.ReceivedAt) || (po.ReceivedAt.Equal(*latest.ReceivedAt) && po.ID > latest.ID) {
+			candidate := po
+			latest = &candidate
+		}
+	}
+	if latest != nil {
+		return latest.SupplierID
+	}
+
+	supplierID := ""
+	var updatedAt time.Time
+	for _, mapping := range s.supplierProducts {
+		if mapping.SKU != sku {
+			continue
+		}
+		if supplierID == "" || mapping.UpdatedAt.After(updatedAt) || (mapping.UpdatedAt.Equal(updatedAt) && mapping.SupplierID > supplierID) {
+			supplierID = mapping.SupplierID
+			updatedAt = mapping.UpdatedAt
+		}
+	}
+	return supplierID
+}
+
 func (s *Store) CreateAuditLog(_ context.Context, entry domain.AuditLog) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -819,7 +2095,7 @@ func (s *Store) CreateAuditLog(_ context.Context, entry domain.AuditLog) error {
 	return nil
 }
 
-func (s *Store) ListAuditLogs(_ context.Context, storeID string, from time.Time, to time.Time, limit int) ([]domain.AuditLog, error) {
+func (s *Store) ListAuditLogs(_ context.Context, storeID string, from time.Time, to time.Time, filter domain.AuditLogFilter, before *domain.AuditLogCursor, limit int) ([]domain.AuditLog, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -831,6 +2107,15 @@ func (s *Store) ListAuditLogs(_ context.Context, storeID string, from time.Time,
 		if entry.CreatedAt.Before(from) || !entry.CreatedAt.Before(to) {
 			continue
 		}
+		if len(filter.Actions) > 0 && !slices.Contains(filter.Actions, entry.Action) {
+			continue
+		}
+		if filter.Actor != "" && entry.ActorUsername != filter.Actor {
+			continue
+		}
+		if before != nil && (entry.CreatedAt.After(before.CreatedAt) || (entry.CreatedAt.Equal(before.CreatedAt) && entry.ID >= before.ID)) {
+			continue
+		}
 		result = append(result, entry)
 	}
 
@@ -859,7 +2144,7 @@ func (s *Store) CreateShift(_ context.Context, shift domain.Shift) (*domain.Shif
 
 	key := shiftMapKey(shift.StoreID, shift.TerminalID)
 	if _, exists := s.activeShiftByKey[key]; exists {
-		return nil, store.ErrInvalidTransaction
+		return nil, store.ErrShiftAlreadyOpen
 	}
 	if shift.ID == "" {
 		shift.ID = xid.New("shift")
@@ -907,21 +2192,240 @@ func (s *Store) CloseActiveShift(_ context.Context, storeID string, terminalID s
 	return &copyShift, nil
 }
 
-func (s *Store) GetActiveShift(_ context.Context, storeID string, terminalID string) (*domain.Shift, error) {
+func (s *Store) GetActiveShift(_ context.Context, storeID string, terminalID string) (*domain.Shift, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := shiftMapKey(storeID, terminalID)
+	shiftID, exists := s.activeShiftByKey[key]
+	if !exists {
+		return nil, store.ErrNotFound
+	}
+	shift, exists := s.shiftsByID[shiftID]
+	if !exists || shift.Status != domain.ShiftStatusOpen {
+		return nil, store.ErrNotFound
+	}
+	copyShift := shift
+	return &copyShift, nil
+}
+
+func (s *Store) GetShift(_ context.Context, shiftID string) (*domain.Shift, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	shift, exists := s.shiftsByID[shiftID]
+	if !exists {
+		return nil, store.ErrNotFound
+	}
+	copyShift := shift
+	return &copyShift, nil
+}
+
+func (s *Store) UpdateOpenShift(_ context.Context, shiftID string, openingFloatCents int64, notes string) (*domain.Shift, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shift, exists := s.shiftsByID[shiftID]
+	if !exists {
+		return nil, store.ErrNotFound
+	}
+	if shift.Status != domain.ShiftStatusOpen {
+		return nil, fmt.Errorf("%w: %s", store.ErrShiftClosed, shiftID)
+	}
+	shift.OpeningFloatCents = openingFloatCents
+	shift.Notes = notes
+	s.shiftsByID[shiftID] = shift
+	copyShift := shift
+	return &copyShift, nil
+}
+
+func (s *Store) ListShifts(_ context.Context, storeID string, terminalID string, from time.Time, to time.Time, limit int) ([]domain.Shift, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if limit < 1 {
+		limit = 100
+	}
+	shifts := make([]domain.Shift, 0)
+	for _, shift := range s.shiftsByID {
+		if shift.StoreID != storeID {
+			continue
+		}
+		if terminalID != "" && shift.TerminalID != terminalID {
+			continue
+		}
+		if shift.OpenedAt.Before(from) || !shift.OpenedAt.Before(to) {
+			continue
+		}
+		shifts = append(shifts, shift)
+	}
+	slices.SortFunc(shifts, func(a, b domain.Shift) int {
+		return b.OpenedAt.Compare(a.OpenedAt)
+	})
+	if len(shifts) > limit {
+		shifts = shifts[:limit]
+	}
+	return shifts, nil
+}
+
+func (s *Store) ListShiftTransactions(_ context.Context, shiftID string) ([]domain.Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	transactions := make([]domain.Transaction, 0)
+	for _, tx := range s.transactionsByID {
+		if tx.ShiftID != shiftID {
+			continue
+		}
+		transactions = append(transactions, *cloneTransaction(tx))
+	}
+	slices.SortFunc(transactions, func(a, b domain.Transaction) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return transactions, nil
+}
+
+func (s *Store) ListTransactionsByCustomer(_ context.Context, customerID string, limit int) ([]domain.Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	transactions := make([]domain.Transaction, 0)
+	for _, tx := range s.transactionsByID {
+		if tx.CustomerID != customerID {
+			continue
+		}
+		transactions = append(transactions, *cloneTransaction(tx))
+	}
+	slices.SortFunc(transactions, func(a, b domain.Transaction) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	if limit > 0 && len(transactions) > limit {
+		transactions = transactions[:limit]
+	}
+	return transactions, nil
+}
+
+func (s *Store) ListRefundsByTerminal(_ context.Context, storeID string, terminalID string, from time.Time, to time.Time) ([]domain.Refund, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	refunds := make([]domain.Refund, 0)
+	for _, refund := range s.refundsByID {
+		if refund.CreatedAt.Before(from) || !refund.CreatedAt.Before(to) {
+			continue
+		}
+		tx, ok := s.transactionsByID[refund.OriginalTransactionID]
+		if !ok || tx.StoreID != storeID || tx.TerminalID != terminalID {
+			continue
+		}
+		refunds = append(refunds, refund)
+	}
+	slices.SortFunc(refunds, func(a, b domain.Refund) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return refunds, nil
+}
+
+// CreateShiftCashMovement records drawer cash that moved outside a sale. Only
+// open shifts accept movements.
+func (s *Store) SaveTerminal(_ context.Context, terminal domain.Terminal) (*domain.Terminal, error) {
+	if terminal.StoreID == "" || terminal.TerminalID == "" || terminal.TokenHash == "" {
+		return nil, store.ErrInvalidTransaction
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if terminal.CreatedAt.IsZero() {
+		terminal.CreatedAt = time.Now().UTC()
+	}
+	terminal.RevokedAt = nil
+	s.terminals[terminal.StoreID+"|"+terminal.TerminalID] = terminal
+	saved := terminal
+	return &saved, nil
+}
+
+func (s *Store) GetTerminal(_ context.Context, storeID string, terminalID string) (*domain.Terminal, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	terminal, exists := s.terminals[storeID+"|"+terminalID]
+	if !exists {
+		return nil, store.ErrNotFound
+	}
+	return &terminal, nil
+}
+
+func (s *Store) ListTerminals(_ context.Context, storeID string) ([]domain.Terminal, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	terminals := make([]domain.Terminal, 0, 8)
+	for _, terminal := range s.terminals {
+		if terminal.StoreID == storeID {
+			terminals = append(terminals, terminal)
+		}
+	}
+	slices.SortFunc(terminals, func(a, b domain.Terminal) int {
+		return cmpString(a.TerminalID, b.TerminalID)
+	})
+	return terminals, nil
+}
+
+func (s *Store) RevokeTerminal(_ context.Context, storeID string, terminalID string, at time.Time) (*domain.Terminal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := storeID + "|" + terminalID
+	terminal, exists := s.terminals[key]
+	if !exists {
+		return nil, store.ErrNotFound
+	}
+	if terminal.RevokedAt == nil {
+		revokedAt := at.UTC()
+		terminal.RevokedAt = &revokedAt
+		s.terminals[key] = terminal
+	}
+	return &terminal, nil
+}
+
+func (s *Store) CreateShiftCashMovement(_ context.Context, movement domain.ShiftCashMovement) (*domain.ShiftCashMovement, error) {
+	if movement.ShiftID == "" || movement.AmountCents < 1 {
+		return nil, store.ErrInvalidTransaction
+	}
+	if movement.ID == "" {
+		movement.ID = xid.New("cash")
+	}
+	if movement.CreatedAt.IsZero() {
+		movement.CreatedAt = time.Now().UTC()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shift, exists := s.shiftsByID[movement.ShiftID]
+	if !exists {
+		return nil, store.ErrNotFound
+	}
+	if shift.Status != domain.ShiftStatusOpen {
+		return nil, store.ErrInvalidTransaction
+	}
+	s.cashMovements = append(s.cashMovements, movement)
+	created := movement
+	return &created, nil
+}
+
+func (s *Store) ListShiftCashMovements(_ context.Context, shiftID string) ([]domain.ShiftCashMovement, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	key := shiftMapKey(storeID, terminalID)
-	shiftID, exists := s.activeShiftByKey[key]
-	if !exists {
-		return nil, store.ErrNotFound
-	}
-	shift, exists := s.shiftsByID[shiftID]
-	if !exists || shift.Status != domain.ShiftStatusOpen {
-		return nil, store.ErrNotFound
+	movements := make([]domain.ShiftCashMovement, 0)
+	for _, movement := range s.cashMovements {
+		if movement.ShiftID == shiftID {
+			movements = append(movements, movement)
+		}
 	}
-	copyShift := shift
-	return &copyShift, nil
+	return movements, nil
 }
 
 func (s *Store) CreatePromo(_ context.Context, promo domain.PromoRule) (*domain.PromoRule, error) {
@@ -944,6 +2448,12 @@ func (s *Store) CreatePromo(_ context.Context, promo domain.PromoRule) (*domain.
 	if promo.ID == "" {
 		promo.ID = xid.New("promo")
 	}
+	if _, exists := s.promosByID[promo.ID]; exists {
+		return nil, store.ErrDuplicateID
+	}
+	if existing, ok := s.activePromoNamedLocked(promo.Name, ""); ok {
+		return &existing, nil
+	}
 	if promo.CreatedAt.IsZero() {
 		promo.CreatedAt = time.Now().UTC()
 	}
@@ -973,6 +2483,17 @@ func (s *Store) ListPromos(_ context.Context) ([]domain.PromoRule, error) {
 	return promos, nil
 }
 
+func (s *Store) GetPromo(_ context.Context, promoID string) (*domain.PromoRule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	promo, exists := s.promosByID[promoID]
+	if !exists {
+		return nil, store.ErrNotFound
+	}
+	return &promo, nil
+}
+
 func (s *Store) UpdatePromoActive(_ context.Context, promoID string, active bool) (*domain.PromoRule, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -981,26 +2502,65 @@ func (s *Store) UpdatePromoActive(_ context.Context, promoID string, active bool
 	if !exists {
 		return nil, store.ErrNotFound
 	}
+	if _, taken := s.activePromoNamedLocked(promo.Name, promoID); active && taken {
+		return nil, store.ErrDuplicatePromoName
+	}
 	promo.Active = active
 	s.promosByID[promoID] = promo
 	copyPromo := promo
 	return &copyPromo, nil
 }
 
-func (s *Store) RebuildAssociationPairs(_ context.Context, storeID string) (int, error) {
+// activePromoNamedLocked finds an active promo other than exceptID named name,
+// ignoring case.
+func (s *Store) activePromoNamedLocked(name string, exceptID string) (domain.PromoRule, bool) {
+	for id, promo := range s.promosByID {
+		if id != exceptID && promo.Active && strings.EqualFold(promo.Name, name) {
+			return promo, true
+		}
+	}
+	return domain.PromoRule{}, false
+}
+
+func (s *Store) RebuildAssociationPairs(_ context.Context, storeID string, minLift float64) ([]domain.AssociationPair, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	sourceCount := map[string]int{}
 	pairCount := map[string]int{}
+	manualPairs := make([]domain.AssociationPair, 0)
+	manualKeys := map[string]struct{}{}
+	for _, pair := range s.associationPairs {
+		if pair.Manual {
+			manualPairs = append(manualPairs, pair)
+			manualKeys[pair.SourceSKU+"->"+pair.TargetSKU] = struct{}{}
+		}
+	}
+
+	categorySourceCount := map[string]int{}
+	categoryPairCount := map[[2]string]int{}
 
+	totalTransactions := 0
 	for _, tx := range s.transactionsByID {
 		if tx.StoreID != storeID || tx.Status != domain.TxStatusPaid {
 			continue
 		}
+		totalTransactions++
 		seen := map[string]struct{}{}
+		categories := map[string]struct{}{}
 		for _, item := range tx.Items {
 			seen[item.SKU] = struct{}{}
+			if category := s.products[item.SKU].Category; category != "" {
+				categories[category] = struct{}{}
+			}
+		}
+		for source := range categories {
+			categorySourceCount[source]++
+			for target := range categories {
+				if source != target {
+					categoryPairCount[[2]string{source, target}]++
+				}
+			}
 		}
 		skus := make([]string, 0, len(seen))
 		for sku := range seen {
@@ -1030,20 +2590,28 @@ func (s *Store) RebuildAssociationPairs(_ context.Context, storeID string) (int,
 		if arrow < 1 {
 			continue
 		}
+		if _, manual := manualKeys[key]; manual {
+			continue
+		}
 		source := key[:arrow]
 		target := key[arrow+2:]
 		srcCnt := sourceCount[source]
-		if srcCnt < 1 {
+		if srcCnt < 1 || totalTransactions < 1 {
 			continue
 		}
-		affinity := float64(cnt) / float64(srcCnt)
-		if affinity < 0.2 {
+		support := float64(cnt) / float64(totalTransactions)
+		confidence := float64(cnt) / float64(srcCnt)
+		lift := confidence / (float64(sourceCount[target]) / float64(totalTransactions))
+		if lift < minLift {
 			continue
 		}
 		nextPairs = append(nextPairs, domain.AssociationPair{
-			SourceSKU: source,
-			TargetSKU: target,
-			Affinity:  affinity,
+			SourceSKU:  source,
+			TargetSKU:  target,
+			Affinity:   confidence,
+			Support:    support,
+			Confidence: confidence,
+			Lift:       lift,
 		})
 	}
 
@@ -1064,10 +2632,22 @@ func (s *Store) RebuildAssociationPairs(_ context.Context, storeID string) (int,
 		nextPairs = nextPairs[:250]
 	}
 	if len(nextPairs) > 0 {
-		s.associationPairs = nextPairs
+		s.associationPairs = append(slices.Clone(nextPairs), manualPairs...)
+	}
+
+	categoryPairs := make([]domain.CategoryAssociationPair, 0, len(categoryPairCount))
+	for key, cnt := range categoryPairCount {
+		categoryPairs = append(categoryPairs, domain.CategoryAssociationPair{
+			SourceCategory: key[0],
+			TargetCategory: key[1],
+			Affinity:       float64(cnt) / float64(categorySourceCount[key[0]]),
+		})
+	}
+	if len(categoryPairs) > 0 {
+		s.categoryPairs = categoryPairs
 	}
 
-	return len(nextPairs), nil
+	return nextPairs, nil
 }
 
 func (s *Store) CreateHeldCart(_ context.Context, held domain.HeldCart) (*domain.HeldCart, error) {
@@ -1153,6 +2733,9 @@ func (s *Store) CreateSupplier(_ context.Context, supplier domain.Supplier) (*do
 	if supplier.ID == "" {
 		supplier.ID = xid.New("sup")
 	}
+	if _, exists := s.suppliersByID[supplier.ID]; exists {
+		return nil, store.ErrDuplicateID
+	}
 	if supplier.CreatedAt.IsZero() {
 		supplier.CreatedAt = time.Now().UTC()
 	}
@@ -1182,6 +2765,80 @@ func (s *Store) ListSuppliers(_ context.Context) ([]domain.Supplier, error) {
 	return suppliers, nil
 }
 
+func (s *Store) GetSupplierByID(_ context.Context, supplierID string) (*domain.Supplier, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	supplier, exists := s.suppliersByID[supplierID]
+	if !exists {
+		return nil, store.ErrNotFound
+	}
+	return &supplier, nil
+}
+
+func (s *Store) UpdateSupplier(_ context.Context, supplier domain.Supplier) (*domain.Supplier, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	supplier.Name = strings.TrimSpace(supplier.Name)
+	supplier.Phone = strings.TrimSpace(supplier.Phone)
+	if supplier.Name == "" {
+		return nil, store.ErrInvalidTransaction
+	}
+	existing, exists := s.suppliersByID[supplier.ID]
+	if !exists {
+		return nil, store.ErrNotFound
+	}
+	supplier.CreatedAt = existing.CreatedAt
+	s.suppliersByID[supplier.ID] = supplier
+	copySupplier := supplier
+	return &copySupplier, nil
+}
+
+func (s *Store) SetSupplierProduct(_ context.Context, product domain.SupplierProduct) (*domain.SupplierProduct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if product.DefaultCostCents < 0 || product.LeadTimeDays < 0 {
+		return nil, store.ErrInvalidTransaction
+	}
+	if _, exists := s.suppliersByID[product.SupplierID]; !exists {
+		return nil, store.ErrNotFound
+	}
+	if _, exists := s.products[product.SKU]; !exists {
+		return nil, store.ErrNotFound
+	}
+	if product.UpdatedAt.IsZero() {
+		product.UpdatedAt = time.Now().UTC()
+	}
+	s.supplierProducts[product.SupplierID+"|"+product.SKU] = product
+	saved := product
+	return &saved, nil
+}
+
+func (s *Store) ListSupplierProducts(_ context.Context, supplierID string, skus []string) ([]domain.SupplierProduct, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	products := make([]domain.SupplierProduct, 0, 16)
+	for _, product := range s.supplierProducts {
+		if supplierID != "" && product.SupplierID != supplierID {
+			continue
+		}
+		if len(skus) > 0 && !slices.Contains(skus, product.SKU) {
+			continue
+		}
+		products = append(products, product)
+	}
+	slices.SortFunc(products, func(a, b domain.SupplierProduct) int {
+		if a.SupplierID != b.SupplierID {
+			return cmpString(a.SupplierID, b.SupplierID)
+		}
+		return cmpString(a.SKU, b.SKU)
+	})
+	return products, nil
+}
+
 func (s *Store) CreatePurchaseOrder(_ context.Context, po domain.PurchaseOrder) (*domain.PurchaseOrder, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -1195,6 +2852,9 @@ func (s *Store) CreatePurchaseOrder(_ context.Context, po domain.PurchaseOrder)
 	if po.ID == "" {
 		po.ID = xid.New("po")
 	}
+	if _, exists := s.purchaseOrdersByID[po.ID]; exists {
+		return nil, store.ErrDuplicateID
+	}
 	if po.CreatedAt.IsZero() {
 		po.CreatedAt = time.Now().UTC()
 	}
@@ -1268,10 +2928,10 @@ func (s *Store) ReceivePurchaseOrder(_ context.Context, purchaseOrderID string,
 		return nil, store.ErrNotFound
 	}
 	if po.Status == "received" {
-		return nil, store.ErrInvalidTransaction
+		return nil, store.ErrInvalidState
 	}
 	if po.Status == "cancelled" {
-		return nil, store.ErrInvalidTransaction
+		return nil, store.ErrInvalidState
 	}
 	if receivedAt.IsZero() {
 		receivedAt = time.Now().UTC()
@@ -1301,6 +2961,7 @@ func (s *Store) ReceivePurchaseOrder(_ context.Context, purchaseOrderID string,
 		}
 		storeStock[item.SKU] = currentQty + item.Qty
 		storeCosts[item.SKU] = weightedCostCents(prevCost, currentQty, item.CostCents, item.Qty)
+		s.recordMovementLocked(po.StoreID, item.SKU, item.Qty, domain.MovementReasonPurchaseOrder, po.ID, receivedAt)
 		lot := domain.InventoryLot{
 			ID:           xid.New("lot"),
 			StoreID:      po.StoreID,
@@ -1328,6 +2989,33 @@ func (s *Store) ReceivePurchaseOrder(_ context.Context, purchaseOrderID string,
 	return &updated, nil
 }
 
+func (s *Store) CancelPurchaseOrder(_ context.Context, purchaseOrderID string, reason string, cancelledBy string, cancelledAt time.Time) (*domain.PurchaseOrder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	po, exists := s.purchaseOrdersByID[purchaseOrderID]
+	if !exists {
+		return nil, store.ErrNotFound
+	}
+	if po.Status == "received" || po.Status == "cancelled" {
+		return nil, store.ErrInvalidState
+	}
+	if cancelledAt.IsZero() {
+		cancelledAt = time.Now().UTC()
+	}
+
+	po.Status = "cancelled"
+	po.CancelledBy = strings.TrimSpace(cancelledBy)
+	if po.CancelledBy == "" {
+		po.CancelledBy = "system"
+	}
+	po.CancelReason = strings.TrimSpace(reason)
+	po.CancelledAt = &cancelledAt
+	s.purchaseOrdersByID[purchaseOrderID] = po
+	updated := clonePurchaseOrder(po)
+	return &updated, nil
+}
+
 func (s *Store) GetProductCosts(_ context.Context, storeID string, skus []string) (map[string]int64, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -1371,7 +3059,7 @@ func (s *Store) CreateUser(_ context.Context, user domain.UserAccount) error {
 		return store.ErrInvalidTransaction
 	}
 	if _, exists := s.usersByUsername[username]; exists {
-		return store.ErrInvalidTransaction
+		return store.ErrDuplicateID
 	}
 	user.Username = username
 	if user.Role == "" {
@@ -1399,6 +3087,17 @@ func (s *Store) ListUsers(_ context.Context) ([]domain.UserAccount, error) {
 	return users, nil
 }
 
+func (s *Store) GetUser(_ context.Context, username string) (*domain.UserAccount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.usersByUsername[strings.ToLower(strings.TrimSpace(username))]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &user, nil
+}
+
 func (s *Store) UpdateUserPassword(_ context.Context, username string, password string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -1416,6 +3115,204 @@ func (s *Store) UpdateUserPassword(_ context.Context, username string, password
 	return nil
 }
 
+func (s *Store) UpdateUserActive(_ context.Context, username string, active bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	username = strings.ToLower(strings.TrimSpace(username))
+	user, exists := s.usersByUsername[username]
+	if !exists {
+		return store.ErrNotFound
+	}
+	user.Active = active
+	s.usersByUsername[username] = user
+	return nil
+}
+
+func (s *Store) UpdateUserRole(_ context.Context, username string, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	username = strings.ToLower(strings.TrimSpace(username))
+	if role != "admin" && role != "cashier" {
+		return store.ErrInvalidTransaction
+	}
+	user, exists := s.usersByUsername[username]
+	if !exists {
+		return store.ErrNotFound
+	}
+	user.Role = role
+	s.usersByUsername[username] = user
+	return nil
+}
+
+func (s *Store) CreateRefreshToken(_ context.Context, token domain.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if token.TokenHash == "" || token.Username == "" {
+		return store.ErrInvalidTransaction
+	}
+	if _, exists := s.refreshTokens[token.TokenHash]; exists {
+		return store.ErrInvalidTransaction
+	}
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now().UTC()
+	}
+	s.refreshTokens[token.TokenHash] = token
+	return nil
+}
+
+// ConsumeRefreshToken revokes an active token and returns it, so each refresh
+// token can be exchanged only once.
+func (s *Store) ConsumeRefreshToken(_ context.Context, tokenHash string, at time.Time) (*domain.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, exists := s.refreshTokens[tokenHash]
+	if !exists || token.Revoked || !at.Before(token.ExpiresAt) {
+		return nil, store.ErrNotFound
+	}
+	token.Revoked = true
+	s.refreshTokens[tokenHash] = token
+	return &token, nil
+}
+
+func (s *Store) RevokeRefreshToken(_ context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, exists := s.refreshTokens[tokenHash]
+	if !exists {
+		return store.ErrNotFound
+	}
+	token.Revoked = true
+	s.refreshTokens[tokenHash] = token
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every refresh token issued to username.
+func (s *Store) RevokeUserRefreshTokens(_ context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	username = strings.ToLower(strings.TrimSpace(username))
+	for hash, token := range s.refreshTokens {
+		if token.Username == username && !token.Revoked {
+			token.Revoked = true
+			s.refreshTokens[hash] = token
+		}
+	}
+	return nil
+}
+
+// RevokeAccessToken records a token ID as revoked until the token would have
+// expired anyway.
+func (s *Store) RevokeAccessToken(_ context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if jti == "" {
+		return store.ErrInvalidTransaction
+	}
+	s.revokedTokens[jti] = expiresAt
+	return nil
+}
+
+func (s *Store) IsAccessTokenRevoked(_ context.Context, jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, revoked := s.revokedTokens[jti]
+	return revoked, nil
+}
+
+// PruneRevokedAccessTokens drops revocations for tokens that expired before
+// the given time and reports how many were removed.
+func (s *Store) PruneRevokedAccessTokens(_ context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pruned := 0
+	for jti, expiresAt := range s.revokedTokens {
+		if expiresAt.Before(before) {
+			delete(s.revokedTokens, jti)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+// PruneRefreshTokens drops refresh tokens that expired before the given time
+// or were revoked, and reports how many were removed.
+func (s *Store) PruneRefreshTokens(_ context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pruned := 0
+	for hash, token := range s.refreshTokens {
+		if token.Revoked || token.ExpiresAt.Before(before) {
+			delete(s.refreshTokens, hash)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+type offlineEnvelope struct {
+	resp      domain.OfflineSyncResponse
+	expiresAt time.Time
+}
+
+func offlineEnvelopeKey(storeID string, terminalID string, envelopeID string) string {
+	return storeID + "|" + terminalID + "|" + envelopeID
+}
+
+// GetOfflineEnvelope returns the response recorded for an envelope that has
+// not expired at the given time.
+func (s *Store) GetOfflineEnvelope(_ context.Context, storeID string, terminalID string, envelopeID string, at time.Time) (*domain.OfflineSyncResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	envelope, ok := s.offlineEnvelopes[offlineEnvelopeKey(storeID, terminalID, envelopeID)]
+	if !ok || !envelope.expiresAt.After(at) {
+		return nil, store.ErrNotFound
+	}
+	resp := envelope.resp
+	resp.Statuses = slices.Clone(envelope.resp.Statuses)
+	return &resp, nil
+}
+
+// SaveOfflineEnvelope records the response for an envelope, replacing any
+// earlier record for the same envelope.
+func (s *Store) SaveOfflineEnvelope(_ context.Context, storeID string, terminalID string, resp domain.OfflineSyncResponse, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if resp.EnvelopeID == "" {
+		return store.ErrInvalidTransaction
+	}
+	resp.Statuses = slices.Clone(resp.Statuses)
+	s.offlineEnvelopes[offlineEnvelopeKey(storeID, terminalID, resp.EnvelopeID)] = offlineEnvelope{resp: resp, expiresAt: expiresAt}
+	return nil
+}
+
+// PruneOfflineEnvelopes drops envelope records that expired before the given
+// time and reports how many were removed.
+func (s *Store) PruneOfflineEnvelopes(_ context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pruned := 0
+	for key, envelope := range s.offlineEnvelopes {
+		if envelope.expiresAt.Before(before) {
+			delete(s.offlineEnvelopes, key)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
 func weightedCostCents(oldCost int64, oldQty int, incomingCost int64, incomingQty int) int64 {
 	if incomingQty <= 0 || incomingCost <= 0 {
 		return oldCost
@@ -1435,6 +3332,10 @@ func weightedCostCents(oldCost int64, oldQty int, incomingCost int64, incomingQt
 	return weighted
 }
 
+func serialKey(sku string, serial string) string {
+	return sku + "|" + serial
+}
+
 func shiftMapKey(storeID string, terminalID string) string {
 	return storeID + "::" + terminalID
 }
@@ -1450,6 +3351,23 @@ func nowDateUTC(t time.Time) time.Time {
 	return time.Date(t.UTC().Year(), t.UTC().Month(), t.UTC().Day(), 0, 0, 0, 0, time.UTC)
 }
 
+// lotComparator returns the checkout picking order for a product's strategy.
+// Anything other than FIFO falls back to FEFO.
+func lotComparator(strategy string) func(a domain.InventoryLot, b domain.InventoryLot) int {
+	if strategy == domain.PickingStrategyFIFO {
+		return compareLotForFIFO
+	}
+	return compareLotForFEFO
+}
+
+// compareLotForFIFO orders lots by received date only; expiry is ignored.
+func compareLotForFIFO(a domain.InventoryLot, b domain.InventoryLot) int {
+	if c := a.ReceivedAt.Compare(b.ReceivedAt); c != 0 {
+		return c
+	}
+	return cmpString(a.ID, b.ID)
+}
+
 func compareLotForFEFO(a domain.InventoryLot, b domain.InventoryLot) int {
 	if a.ExpiryDate == nil && b.ExpiryDate != nil {
 		return 1
@@ -1523,6 +3441,16 @@ func cloneInventoryLot(src domain.InventoryLot) domain.InventoryLot {
 		expiry := src.ExpiryDate.UTC()
 		dup.ExpiryDate = &expiry
 	}
+	dup.Serials = slices.Clone(src.Serials)
+	return dup
+}
+
+func cloneInventorySerial(src domain.InventorySerial) domain.InventorySerial {
+	dup := src
+	if src.SoldAt != nil {
+		soldAt := src.SoldAt.UTC()
+		dup.SoldAt = &soldAt
+	}
 	return dup
 }
 
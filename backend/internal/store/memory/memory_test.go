@@ -0,0 +1,169 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"kasirinaja/backend/internal/domain"
+	"kasirinaja/backend/internal/store"
+)
+
+func checkoutOne(ctx context.Context, s *Store, idem string, sku string) error {
+	_, err := s.CreateCheckout(ctx, domain.Transaction{
+		StoreID:        "main-store",
+		TerminalID:     "terminal-a1",
+		IdempotencyKey: idem,
+		PaymentMethod:  "card",
+		Items:          []domain.TransactionLine{{SKU: sku, Qty: 1}},
+	})
+	return err
+}
+
+func TestConcurrentCheckoutDoesNotOversell(t *testing.T) {
+	s := NewSeeded()
+	ctx := context.Background()
+	if err := s.SetStock(ctx, "main-store", "SKU-COKLAT-01", 5); err != nil {
+		t.Fatalf("set stock failed: %v", err)
+	}
+
+	const terminals = 20
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < terminals; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := checkoutOne(ctx, s, "idem-race-"+strconv.Itoa(i), "SKU-COKLAT-01")
+			if err != nil && !errors.Is(err, store.ErrInsufficientStock) {
+				t.Errorf("unexpected checkout error: %v", err)
+				return
+			}
+			if err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if succeeded != 5 {
+		t.Fatalf("expected exactly 5 successful checkouts, got %d", succeeded)
+	}
+	stock, _ := s.GetStockMap(ctx, "main-store", []string{"SKU-COKLAT-01"})
+	if stock["SKU-COKLAT-01"] != 0 {
+		t.Fatalf("expected stock to end at 0, got %d", stock["SKU-COKLAT-01"])
+	}
+}
+
+func TestCheckoutAllowsNegativeStockWhenEnabled(t *testing.T) {
+	s := NewSeeded()
+	s.SetAllowNegativeStock(true)
+	ctx := context.Background()
+	if err := s.SetStock(ctx, "main-store", "SKU-COKLAT-01", 0); err != nil {
+		t.Fatalf("set stock failed: %v", err)
+	}
+
+	if err := checkoutOne(ctx, s, "idem-negative", "SKU-COKLAT-01"); err != nil {
+		t.Fatalf("expected checkout to succeed with negative stock allowed, got %v", err)
+	}
+	stock, _ := s.GetStockMap(ctx, "main-store", []string{"SKU-COKLAT-01"})
+	if stock["SKU-COKLAT-01"] != -1 {
+		t.Fatalf("expected stock -1, got %d", stock["SKU-COKLAT-01"])
+	}
+}
+
+func TestNewEmptyHasNoCatalog(t *testing.T) {
+	s := NewEmpty()
+	products, err := s.ListProducts(context.Background())
+	if err != nil {
+		t.Fatalf("list products failed: %v", err)
+	}
+	if len(products) != 0 {
+		t.Fatalf("expected no products, got %d", len(products))
+	}
+	users, err := s.ListUsers(context.Background())
+	if err != nil || len(users) == 0 {
+		t.Fatalf("expected seed accounts to exist, got %d users, err %v", len(users), err)
+	}
+}
+
+func TestLoadSeedProducts(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "products.json")
+	if err := os.WriteFile(path, []byte(`[
+		{"sku": " sku-beras-5 ", "name": "Beras 5kg", "category": "grocery", "price_cents": 72000, "margin_rate": 0.1, "stock": 40},
+		{"sku": "SKU-HP-01", "name": "Handphone", "category": "electronics", "price_cents": 1500000, "margin_rate": 0.08, "active": false, "serialized": true, "picking_strategy": "FIFO"}
+	]`), 0o600); err != nil {
+		t.Fatalf("write seed file failed: %v", err)
+	}
+
+	seed, err := LoadSeedProducts(path)
+	if err != nil {
+		t.Fatalf("load seed products failed: %v", err)
+	}
+	s := NewFromSeed(seed)
+	ctx := context.Background()
+
+	beras, err := s.GetProductBySKU(ctx, "SKU-BERAS-5")
+	if err != nil {
+		t.Fatalf("get seeded product failed: %v", err)
+	}
+	if !beras.Active || beras.PickingStrategy != domain.PickingStrategyFEFO {
+		t.Fatalf("expected active FEFO product by default, got %+v", beras)
+	}
+	hp, err := s.GetProductBySKU(ctx, "SKU-HP-01")
+	if err != nil {
+		t.Fatalf("get seeded product failed: %v", err)
+	}
+	if hp.Active || !hp.Serialized || hp.PickingStrategy != domain.PickingStrategyFIFO {
+		t.Fatalf("expected explicit fields to be kept, got %+v", hp)
+	}
+	stock, _ := s.GetStockMap(ctx, "main-store", []string{"SKU-BERAS-5", "SKU-HP-01"})
+	if stock["SKU-BERAS-5"] != 40 || stock["SKU-HP-01"] != 0 {
+		t.Fatalf("unexpected opening stock: %v", stock)
+	}
+
+	if err := os.WriteFile(path, []byte(`[{"sku": "A", "name": "A", "category": "x", "price_cents": 1},{"sku": "a", "name": "B", "category": "x", "price_cents": 1}]`), 0o600); err != nil {
+		t.Fatalf("write seed file failed: %v", err)
+	}
+	if _, err := LoadSeedProducts(path); err == nil {
+		t.Fatalf("expected duplicate sku to be rejected")
+	}
+}
+
+func TestPruneRefreshTokensDropsExpiredAndRevoked(t *testing.T) {
+	s := NewEmpty()
+	ctx := context.Background()
+	now := time.Now().UTC()
+	for _, token := range []domain.RefreshToken{
+		{TokenHash: "expired", Username: "admin", ExpiresAt: now.Add(-time.Minute)},
+		{TokenHash: "revoked", Username: "admin", ExpiresAt: now.Add(time.Hour)},
+		{TokenHash: "active", Username: "admin", ExpiresAt: now.Add(time.Hour)},
+	} {
+		if err := s.CreateRefreshToken(ctx, token); err != nil {
+			t.Fatalf("create refresh token %s: %v", token.TokenHash, err)
+		}
+	}
+	if err := s.RevokeRefreshToken(ctx, "revoked"); err != nil {
+		t.Fatalf("revoke refresh token: %v", err)
+	}
+
+	pruned, err := s.PruneRefreshTokens(ctx, now)
+	if err != nil || pruned != 2 {
+		t.Fatalf("expected 2 refresh tokens pruned, got %d, err %v", pruned, err)
+	}
+	if _, err := s.ConsumeRefreshToken(ctx, "active", now); err != nil {
+		t.Fatalf("expected the active refresh token to survive, got %v", err)
+	}
+	if len(s.refreshTokens) != 1 {
+		t.Fatalf("expected one refresh token left, got %d", len(s.refreshTokens))
+	}
+}
@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"kasirinaja/backend/internal/domain"
+	"kasirinaja/backend/internal/store"
+)
+
+// SeedProduct is one entry of a seed products file. Active defaults to true
+// and Stock is the opening quantity in "main-store".
+type SeedProduct struct {
+	SKU             string  `json:"sku"`
+	Name            string  `json:"name"`
+	Category        string  `json:"category"`
+	PriceCents      int64   `json:"price_cents"`
+	MarginRate      float64 `json:"margin_rate"`
+	Active          *bool   `json:"active,omitempty"`
+	Serialized      bool    `json:"serialized"`
+	PickingStrategy string  `json:"picking_strategy,omitempty"`
+	Stock           int     `json:"stock"`
+}
+
+// LoadSeedProducts reads a JSON array of SeedProduct from path and validates
+// it the way product creation does.
+func LoadSeedProducts(path string) ([]SeedProduct, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var products []SeedProduct
+	if err := json.Unmarshal(raw, &products); err != nil {
+		return nil, fmt.Errorf("parse seed products %s: %w", path, err)
+	}
+
+	seen := make(map[string]bool, len(products))
+	for i := range products {
+		p := &products[i]
+		p.SKU = strings.ToUpper(strings.TrimSpace(p.SKU))
+		p.Name = strings.TrimSpace(p.Name)
+		p.Category = strings.TrimSpace(p.Category)
+		p.PickingStrategy = strings.ToLower(strings.TrimSpace(p.PickingStrategy))
+		switch {
+		case p.SKU == "" || p.Name == "" || p.Category == "":
+			return nil, fmt.Errorf("seed product %d: sku, name and category are required", i)
+		case seen[p.SKU]:
+			return nil, fmt.Errorf("seed product %d: duplicate sku %s", i, p.SKU)
+		case p.PriceCents < 1:
+			return nil, fmt.Errorf("seed product %s: price_cents must be positive", p.SKU)
+		case p.Stock < 0:
+			return nil, fmt.Errorf("seed product %s: stock must not be negative", p.SKU)
+		}
+		marginRate, ok := store.NormalizeMarginRate(p.MarginRate)
+		if !ok {
+			return nil, fmt.Errorf("seed product %s: margin_rate must be a fraction from 0 to 1 or a percentage up to 100", p.SKU)
+		}
+		p.MarginRate = marginRate
+		switch p.PickingStrategy {
+		case "":
+			p.PickingStrategy = domain.PickingStrategyFEFO
+		case domain.PickingStrategyFEFO, domain.PickingStrategyFIFO:
+		default:
+			return nil, fmt.Errorf("seed product %s: unknown picking_strategy %q", p.SKU, p.PickingStrategy)
+		}
+		seen[p.SKU] = true
+	}
+	return products, nil
+}
+
+// NewFromSeed returns a store holding the given products and their opening
+// stock, without demo association pairs.
+func NewFromSeed(seed []SeedProduct) *Store {
+	products := make([]domain.Product, 0, len(seed))
+	stock := make(map[string]int, len(seed))
+	for _, p := range seed {
+		active := true
+		if p.Active != nil {
+			active = *p.Active
+		}
+		products = append(products, domain.Product{
+			SKU:             p.SKU,
+			Name:            p.Name,
+			Category:        p.Category,
+			PriceCents:      p.PriceCents,
+			MarginRate:      p.MarginRate,
+			Active:          active,
+			Serialized:      p.Serialized,
+			PickingStrategy: p.PickingStrategy,
+		})
+		stock[p.SKU] = p.Stock
+	}
+	return newStore(products, stock, nil)
+}
@@ -20,18 +20,51 @@ import (
 )
 
 type Store struct {
-	db *sql.DB
+	db                 *sql.DB
+	allowNegativeStock bool
 }
 
-func New(ctx context.Context, databaseURL string) (*Store, error) {
+// PoolConfig sizes the database connection pool.
+type PoolConfig struct {
+	MaxIdleConns    int
+	MaxOpenConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// DefaultPoolConfig returns the pool sizes used when none are configured.
+func DefaultPoolConfig() PoolConfig {
+	return PoolConfig{
+		MaxIdleConns:    8,
+		MaxOpenConns:    30,
+		ConnMaxLifetime: 30 * time.Minute,
+	}
+}
+
+// Validate reports the first pool setting that is not positive.
+func (c PoolConfig) Validate() error {
+	switch {
+	case c.MaxIdleConns < 1:
+		return fmt.Errorf("max idle connections must be positive, got %d", c.MaxIdleConns)
+	case c.MaxOpenConns < 1:
+		return fmt.Errorf("max open connections must be positive, got %d", c.MaxOpenConns)
+	case c.ConnMaxLifetime <= 0:
+		return fmt.Errorf("connection max lifetime must be positive, got %s", c.ConnMaxLifetime)
+	}
+	return nil
+}
+
+func New(ctx context.Context, databaseURL string, pool PoolConfig) (*Store, error) {
+	if err := pool.Validate(); err != nil {
+		return nil, err
+	}
 	db, err := sql.Open("pgx", databaseURL)
 	if err != nil {
 		return nil, err
 	}
 
-	db.SetMaxIdleConns(8)
-	db.SetMaxOpenConns(30)
-	db.SetConnMaxLifetime(30 * time.Minute)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
 
 	pingCtx, cancel := context.WithTimeout(ctx, 6*time.Second)
 	defer cancel()
@@ -43,17 +76,39 @@ func New(ctx context.Context, databaseURL string) (*Store, error) {
 	return &Store{db: db}, nil
 }
 
+// Ping checks that the database still accepts connections.
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
 func (s *Store) Close() error {
 	return s.db.Close()
 }
 
+// SetAllowNegativeStock lets checkout sell past the recorded quantity. When
+// disabled (the default) stock is decremented with a guarded update so two
+// terminals cannot oversell the last unit, and the qty >= 0 check on
+// inventory_stocks backs it up. Rows sold below zero are marked
+// allow_negative, which lifts the check for them only.
+func (s *Store) SetAllowNegativeStock(allow bool) {
+	s.allowNegativeStock = allow
+}
+
 func (s *Store) ListProducts(ctx context.Context) ([]domain.Product, error) {
+	return s.listProducts(ctx, false)
+}
+
+func (s *Store) ListAllProducts(ctx context.Context) ([]domain.Product, error) {
+	return s.listProducts(ctx, true)
+}
+
+func (s *Store) listProducts(ctx context.Context, includeInactive bool) ([]domain.Product, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT sku, name, category, price_cents, margin_rate, active
+		SELECT sku, name, category, price_cents, margin_rate, active, serialized, picking_strategy, tax_rate_percent::float8, available_from, available_until, brand, array_to_json(tags)
 		FROM products
-		WHERE active = true
+		WHERE active = true OR $1
 		ORDER BY category, name
-	`)
+	`, includeInactive)
 	if err != nil {
 		return nil, err
 	}
@@ -62,7 +117,7 @@ func (s *Store) ListProducts(ctx context.Context) ([]domain.Product, error) {
 	products := make([]domain.Product, 0, 128)
 	for rows.Next() {
 		var p domain.Product
-		if err := rows.Scan(&p.SKU, &p.Name, &p.Category, &p.PriceCents, &p.MarginRate, &p.Active); err != nil {
+		if err := rows.Scan(&p.SKU, &p.Name, &p.Category, &p.PriceCents, &p.MarginRate, &p.Active, &p.Serialized, &p.PickingStrategy, &p.TaxRatePercent, &p.AvailableFrom, &p.AvailableUntil, &p.Brand, (*tagList)(&p.Tags)); err != nil {
 			return nil, err
 		}
 		products = append(products, p)
@@ -78,18 +133,18 @@ func (s *Store) CreateProduct(ctx context.Context, product domain.Product) (*dom
 	if product.SKU == "" || product.Name == "" || product.Category == "" || product.PriceCents < 1 {
 		return nil, store.ErrInvalidTransaction
 	}
-	if product.MarginRate < 0 || product.MarginRate > 1 {
+	if product.MarginRate < 0 || product.MarginRate > 1 || !store.ValidTaxRate(product) || !store.ValidAvailability(product) || !store.ValidTags(product) {
 		return nil, store.ErrInvalidTransaction
 	}
 
 	product.Active = true
 	_, err := s.db.ExecContext(ctx, `
-		INSERT INTO products (sku, name, category, price_cents, margin_rate, active, created_at, updated_at)
-		VALUES ($1,$2,$3,$4,$5,$6,now(),now())
-	`, product.SKU, product.Name, product.Category, product.PriceCents, product.MarginRate, product.Active)
+		INSERT INTO products (sku, name, category, price_cents, margin_rate, active, serialized, picking_strategy, tax_rate_percent, available_from, available_until, brand, tags, created_at, updated_at)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,now(),now())
+	`, product.SKU, product.Name, product.Category, product.PriceCents, product.MarginRate, product.Active, product.Serialized, pickingStrategyOrDefault(product.PickingStrategy), product.TaxRatePercent, product.AvailableFrom, product.AvailableUntil, product.Brand, tagsOrEmpty(product.Tags))
 	if err != nil {
 		if isUniqueViolation(err) {
-			return nil, store.ErrInvalidTransaction
+			return nil, store.ErrDuplicateID
 		}
 		return nil, err
 	}
@@ -101,10 +156,10 @@ func (s *Store) CreateProduct(ctx context.Context, product domain.Product) (*dom
 func (s *Store) GetProductBySKU(ctx context.Context, sku string) (*domain.Product, error) {
 	var product domain.Product
 	err := s.db.QueryRowContext(ctx, `
-		SELECT sku, name, category, price_cents, margin_rate, active
+		SELECT sku, name, category, price_cents, margin_rate, active, serialized, picking_strategy, tax_rate_percent::float8, available_from, available_until, brand, array_to_json(tags)
 		FROM products
 		WHERE sku = $1
-	`, sku).Scan(&product.SKU, &product.Name, &product.Category, &product.PriceCents, &product.MarginRate, &product.Active)
+	`, sku).Scan(&product.SKU, &product.Name, &product.Category, &product.PriceCents, &product.MarginRate, &product.Active, &product.Serialized, &product.PickingStrategy, &product.TaxRatePercent, &product.AvailableFrom, &product.AvailableUntil, &product.Brand, (*tagList)(&product.Tags))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, store.ErrNotFound
@@ -118,15 +173,15 @@ func (s *Store) UpdateProduct(ctx context.Context, product domain.Product) (*dom
 	if product.SKU == "" || product.Name == "" || product.Category == "" || product.PriceCents < 1 {
 		return nil, store.ErrInvalidTransaction
 	}
-	if product.MarginRate < 0 || product.MarginRate > 1 {
+	if product.MarginRate < 0 || product.MarginRate > 1 || !store.ValidTaxRate(product) || !store.ValidAvailability(product) || !store.ValidTags(product) {
 		return nil, store.ErrInvalidTransaction
 	}
 
 	res, err := s.db.ExecContext(ctx, `
 		UPDATE products
-		SET name = $2, category = $3, price_cents = $4, margin_rate = $5, active = $6, updated_at = now()
+		SET name = $2, category = $3, price_cents = $4, margin_rate = $5, active = $6, serialized = $7, picking_strategy = $8, tax_rate_percent = $9, available_from = $10, available_until = $11, brand = $12, tags = $13, updated_at = now()
 		WHERE sku = $1
-	`, product.SKU, product.Name, product.Category, product.PriceCents, product.MarginRate, product.Active)
+	`, product.SKU, product.Name, product.Category, product.PriceCents, product.MarginRate, product.Active, product.Serialized, pickingStrategyOrDefault(product.PickingStrategy), product.TaxRatePercent, product.AvailableFrom, product.AvailableUntil, product.Brand, tagsOrEmpty(product.Tags))
 	if err != nil {
 		return nil, err
 	}
@@ -188,6 +243,33 @@ func (s *Store) ListPriceHistory(ctx context.Context, sku string, limit int) ([]
 	return history, nil
 }
 
+func (s *Store) ListPriceChanges(ctx context.Context, from time.Time, to time.Time) ([]domain.ProductPriceHistory, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, sku, old_price_cents, new_price_cents, changed_by, changed_at
+		FROM product_price_history
+		WHERE changed_at >= $1 AND changed_at < $2
+		ORDER BY changed_at ASC, id ASC
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]domain.ProductPriceHistory, 0, 16)
+	for rows.Next() {
+		var entry domain.ProductPriceHistory
+		if err := rows.Scan(&entry.ID, &entry.SKU, &entry.OldPriceCents, &entry.NewPriceCents, &entry.ChangedBy, &entry.ChangedAt); err != nil {
+			return nil, err
+		}
+		entry.ChangedAt = entry.ChangedAt.UTC()
+		history = append(history, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
 func (s *Store) GetProductsBySKUs(ctx context.Context, skus []string) (map[string]domain.Product, error) {
 	result := make(map[string]domain.Product, len(skus))
 	if len(skus) == 0 {
@@ -195,7 +277,7 @@ func (s *Store) GetProductsBySKUs(ctx context.Context, skus []string) (map[strin
 	}
 
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT sku, name, category, price_cents, margin_rate, active
+		SELECT sku, name, category, price_cents, margin_rate, active, serialized, picking_strategy, tax_rate_percent::float8, available_from, available_until, brand, array_to_json(tags)
 		FROM products
 		WHERE active = true AND sku = ANY($1)
 	`, skus)
@@ -206,7 +288,7 @@ func (s *Store) GetProductsBySKUs(ctx context.Context, skus []string) (map[strin
 
 	for rows.Next() {
 		var p domain.Product
-		if err := rows.Scan(&p.SKU, &p.Name, &p.Category, &p.PriceCents, &p.MarginRate, &p.Active); err != nil {
+		if err := rows.Scan(&p.SKU, &p.Name, &p.Category, &p.PriceCents, &p.MarginRate, &p.Active, &p.Serialized, &p.PickingStrategy, &p.TaxRatePercent, &p.AvailableFrom, &p.AvailableUntil, &p.Brand, (*tagList)(&p.Tags)); err != nil {
 			return nil, err
 		}
 		result[p.SKU] = p
@@ -218,6 +300,14 @@ func (s *Store) GetProductsBySKUs(ctx context.Context, skus []string) (map[strin
 	return result, nil
 }
 
+func (s *Store) GetProductsBySKUsDetailed(ctx context.Context, skus []string) (map[string]domain.Product, []string, error) {
+	result, err := s.GetProductsBySKUs(ctx, skus)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, store.MissingSKUs(skus, result), nil
+}
+
 func (s *Store) GetStockMap(ctx context.Context, storeID string, skus []string) (map[string]int, error) {
 	stockMap := make(map[string]int, len(skus))
 	if len(skus) == 0 {
@@ -260,643 +350,741 @@ func (s *Store) SetStock(ctx context.Context, storeID string, sku string, qty in
 		return store.ErrInvalidTransaction
 	}
 
-	_, err := s.db.ExecContext(ctx, `
+	pgTx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = pgTx.Rollback() }()
+
+	var current int
+	err = pgTx.QueryRowContext(ctx, `
+		SELECT qty
+		FROM inventory_stocks
+		WHERE store_id = $1 AND sku = $2
+		FOR UPDATE
+	`, storeID, sku).Scan(&current)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	_, err = pgTx.ExecContext(ctx, `
 		INSERT INTO inventory_stocks (store_id, sku, qty, updated_at)
 		VALUES ($1,$2,$3,now())
 		ON CONFLICT (store_id, sku)
 		DO UPDATE SET qty = EXCLUDED.qty, updated_at = now()
 	`, storeID, sku, qty)
-	return err
+	if err != nil {
+		return err
+	}
+	if err := insertMovementTx(ctx, pgTx, storeID, sku, qty-current, domain.MovementReasonManualSet, "", time.Now().UTC()); err != nil {
+		return err
+	}
+	return pgTx.Commit()
 }
 
-func (s *Store) CreateInventoryLot(ctx context.Context, lot domain.InventoryLot) (*domain.InventoryLot, error) {
-	if strings.TrimSpace(lot.StoreID) == "" || strings.TrimSpace(lot.SKU) == "" || lot.QtyReceived < 1 || lot.CostCents < 1 {
-		return nil, store.ErrInvalidTransaction
+// SetStockBulk overwrites the quantity of every SKU in quantities with one
+// multi-row upsert. Nothing is written unless every SKU exists and every
+// quantity is non-negative.
+func (s *Store) SetStockBulk(ctx context.Context, storeID string, quantities map[string]int) error {
+	if storeID == "" || len(quantities) == 0 {
+		return store.ErrInvalidTransaction
 	}
-	if lot.ID == "" {
-		lot.ID = xid.New("lot")
+	skus := make([]string, 0, len(quantities))
+	for sku, qty := range quantities {
+		if qty < 0 {
+			return &store.SKUError{SKU: sku, Err: store.ErrInvalidTransaction}
+		}
+		skus = append(skus, sku)
 	}
-	lot.SKU = strings.ToUpper(strings.TrimSpace(lot.SKU))
-	lot.LotCode = strings.TrimSpace(lot.LotCode)
-	if lot.LotCode == "" {
-		lot.LotCode = "MANUAL-" + lot.ID
+	sort.Strings(skus)
+
+	pgTx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
 	}
-	if lot.SourceType == "" {
-		lot.SourceType = "manual"
+	defer func() { _ = pgTx.Rollback() }()
+
+	known := make(map[string]bool, len(skus))
+	rows, err := pgTx.QueryContext(ctx, `SELECT sku FROM products WHERE sku = ANY($1)`, skus)
+	if err != nil {
+		return err
 	}
-	if lot.ReceivedAt.IsZero() {
-		lot.ReceivedAt = time.Now().UTC()
+	for rows.Next() {
+		var sku string
+		if err := rows.Scan(&sku); err != nil {
+			rows.Close()
+			return err
+		}
+		known[sku] = true
 	}
-	if lot.QtyAvailable < 0 || lot.QtyAvailable > lot.QtyReceived {
-		return nil, store.ErrInvalidTransaction
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
 	}
-	if lot.QtyAvailable == 0 {
-		lot.QtyAvailable = lot.QtyReceived
+	for _, sku := range skus {
+		if !known[sku] {
+			return &store.SKUError{SKU: sku, Err: store.ErrNotFound}
+		}
 	}
 
-	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	current := make(map[string]int, len(skus))
+	rows, err = pgTx.QueryContext(ctx, `
+		SELECT sku, qty
+		FROM inventory_stocks
+		WHERE store_id = $1 AND sku = ANY($2)
+		FOR UPDATE
+	`, storeID, skus)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer func() { _ = tx.Rollback() }()
-
-	_, err = tx.ExecContext(ctx, `
-		INSERT INTO inventory_lots (
-			id, store_id, sku, lot_code, expiry_date, qty_received, qty_available,
-			cost_cents, source_type, source_id, notes, received_at, updated_at
-		)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,now())
-	`, lot.ID, lot.StoreID, lot.SKU, lot.LotCode, nullDate(lot.ExpiryDate), lot.QtyReceived, lot.QtyAvailable, lot.CostCents, lot.SourceType, nullIfEmpty(lot.SourceID), strings.TrimSpace(lot.Notes), lot.ReceivedAt)
-	if err != nil {
-		return nil, err
+	for rows.Next() {
+		var sku string
+		var qty int
+		if err := rows.Scan(&sku, &qty); err != nil {
+			rows.Close()
+			return err
+		}
+		current[sku] = qty
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
-	_, err = tx.ExecContext(ctx, `
+	values := make([]string, 0, len(skus))
+	args := make([]any, 0, 1+2*len(skus))
+	args = append(args, storeID)
+	for _, sku := range skus {
+		values = append(values, fmt.Sprintf("($1,$%d,$%d,now())", len(args)+1, len(args)+2))
+		args = append(args, sku, quantities[sku])
+	}
+	if _, err := pgTx.ExecContext(ctx, `
 		INSERT INTO inventory_stocks (store_id, sku, qty, updated_at)
-		VALUES ($1,$2,$3,now())
+		VALUES `+strings.Join(values, ",")+`
 		ON CONFLICT (store_id, sku)
-		DO UPDATE SET qty = inventory_stocks.qty + EXCLUDED.qty, updated_at = now()
-	`, lot.StoreID, lot.SKU, lot.QtyAvailable)
-	if err != nil {
-		return nil, err
+		DO UPDATE SET qty = EXCLUDED.qty, updated_at = now()
+	`, args...); err != nil {
+		return err
 	}
 
-	if err := tx.Commit(); err != nil {
-		return nil, err
+	now := time.Now().UTC()
+	for _, sku := range skus {
+		if err := insertMovementTx(ctx, pgTx, storeID, sku, quantities[sku]-current[sku], domain.MovementReasonManualSet, "", now); err != nil {
+			return err
+		}
 	}
-	created := lot
-	return &created, nil
+	return pgTx.Commit()
 }
 
-func (s *Store) ListInventoryLots(ctx context.Context, storeID string, sku string, includeExpired bool, limit int) ([]domain.InventoryLot, error) {
-	if limit < 1 {
-		limit = 200
+func (s *Store) CreateStockOpname(ctx context.Context, record domain.StockOpnameRecord) (*domain.StockOpnameRecord, error) {
+	if record.StoreID == "" || len(record.Items) == 0 {
+		return nil, store.ErrInvalidTransaction
 	}
-	sku = strings.ToUpper(strings.TrimSpace(sku))
-
-	query := `
-		SELECT id, store_id, sku, lot_code, expiry_date, qty_received, qty_available,
-			cost_cents, source_type, source_id, notes, received_at
-		FROM inventory_lots
-		WHERE ($1 = '' OR store_id = $1)
-			AND ($2 = '' OR sku = $2)
-	`
-	if !includeExpired {
-		query += ` AND (expiry_date IS NULL OR expiry_date >= CURRENT_DATE)`
+	if record.ID == "" {
+		record.ID = xid.New("opname")
+	}
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now().UTC()
 	}
-	query += `
-		ORDER BY expiry_date ASC NULLS LAST, received_at ASC
-		LIMIT $3
-	`
 
-	rows, err := s.db.QueryContext(ctx, query, storeID, sku, limit)
+	pgTx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	defer func() { _ = pgTx.Rollback() }()
 
-	lots := make([]domain.InventoryLot, 0, limit)
-	for rows.Next() {
-		var lot domain.InventoryLot
-		var expiry sql.NullTime
-		var sourceID sql.NullString
-		if err := rows.Scan(&lot.ID, &lot.StoreID, &lot.SKU, &lot.LotCode, &expiry, &lot.QtyReceived, &lot.QtyAvailable, &lot.CostCents, &lot.SourceType, &sourceID, &lot.Notes, &lot.ReceivedAt); err != nil {
-			return nil, err
-		}
-		lot.ReceivedAt = lot.ReceivedAt.UTC()
-		if expiry.Valid {
-			e := time.Date(expiry.Time.UTC().Year(), expiry.Time.UTC().Month(), expiry.Time.UTC().Day(), 0, 0, 0, 0, time.UTC)
-			lot.ExpiryDate = &e
-		}
-		if sourceID.Valid {
-			lot.SourceID = sourceID.String
-		}
-		lots = append(lots, lot)
-	}
-	if err := rows.Err(); err != nil {
+	_, err = pgTx.ExecContext(ctx, `
+		INSERT INTO opname_records (id, store_id, notes, created_by, created_at)
+		VALUES ($1,$2,$3,$4,$5)
+	`, record.ID, record.StoreID, record.Notes, record.CreatedBy, record.CreatedAt)
+	if err != nil {
 		return nil, err
 	}
-	return lots, nil
-}
-
-func (s *Store) IncreaseStock(ctx context.Context, storeID string, adjustments []domain.StockAdjustment) error {
-	if len(adjustments) == 0 {
-		return nil
-	}
 
-	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
-	if err != nil {
-		return err
-	}
-	defer func() { _ = tx.Rollback() }()
+	items := make([]domain.StockOpnameAdjustment, 0, len(record.Items))
+	for _, item := range record.Items {
+		if item.SKU == "" || item.CountedQty < 0 {
+			return nil, store.ErrInvalidTransaction
+		}
 
-	for _, adj := range adjustments {
-		if adj.Qty < 1 {
-			continue
+		var systemQty int
+		err := pgTx.QueryRowContext(ctx, `
+			SELECT qty
+			FROM inventory_stocks
+			WHERE store_id = $1 AND sku = $2
+			FOR UPDATE
+		`, record.StoreID, item.SKU).Scan(&systemQty)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
 		}
-		_, err := tx.ExecContext(ctx, `
+
+		_, err = pgTx.ExecContext(ctx, `
 			INSERT INTO inventory_stocks (store_id, sku, qty, updated_at)
 			VALUES ($1,$2,$3,now())
 			ON CONFLICT (store_id, sku)
-			DO UPDATE SET qty = inventory_stocks.qty + EXCLUDED.qty, updated_at = now()
-		`, storeID, adj.SKU, adj.Qty)
+			DO UPDATE SET qty = EXCLUDED.qty, updated_at = now()
+		`, record.StoreID, item.SKU, item.CountedQty)
 		if err != nil {
-			return err
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+				return nil, store.ErrNotFound
+			}
+			return nil, err
+		}
+
+		adjustment := domain.StockOpnameAdjustment{
+			SKU:        item.SKU,
+			SystemQty:  systemQty,
+			CountedQty: item.CountedQty,
+			DeltaQty:   item.CountedQty - systemQty,
+		}
+		if err := insertMovementTx(ctx, pgTx, record.StoreID, item.SKU, adjustment.DeltaQty, domain.MovementReasonOpname, record.ID, record.CreatedAt); err != nil {
+			return nil, err
+		}
+		_, err = pgTx.ExecContext(ctx, `
+			INSERT INTO opname_items (opname_id, sku, system_qty, counted_qty, delta_qty)
+			VALUES ($1,$2,$3,$4,$5)
+		`, record.ID, adjustment.SKU, adjustment.SystemQty, adjustment.CountedQty, adjustment.DeltaQty)
+		if err != nil {
+			return nil, err
 		}
+		items = append(items, adjustment)
 	}
 
-	return tx.Commit()
+	if err := pgTx.Commit(); err != nil {
+		return nil, err
+	}
+	record.Items = items
+	return &record, nil
 }
 
-func (s *Store) GetAssociationPairs(ctx context.Context, sourceSKUs []string) ([]domain.AssociationPair, error) {
-	pairs := make([]domain.AssociationPair, 0)
-	if len(sourceSKUs) == 0 {
-		return pairs, nil
+func (s *Store) GetStockOpname(ctx context.Context, opnameID string) (*domain.StockOpnameRecord, error) {
+	var record domain.StockOpnameRecord
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, store_id, notes, created_by, created_at
+		FROM opname_records
+		WHERE id = $1
+	`, opnameID).Scan(&record.ID, &record.StoreID, &record.Notes, &record.CreatedBy, &record.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, store.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
 	}
+	record.CreatedAt = record.CreatedAt.UTC()
 
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT source_sku, target_sku, affinity_score
-		FROM association_item_pairs
-		WHERE source_sku = ANY($1)
-	`, sourceSKUs)
+		SELECT sku, system_qty, counted_qty, delta_qty
+		FROM opname_items
+		WHERE opname_id = $1
+		ORDER BY id ASC
+	`, opnameID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	record.Items = make([]domain.StockOpnameAdjustment, 0, 16)
 	for rows.Next() {
-		var pair domain.AssociationPair
-		if err := rows.Scan(&pair.SourceSKU, &pair.TargetSKU, &pair.Affinity); err != nil {
+		var item domain.StockOpnameAdjustment
+		if err := rows.Scan(&item.SKU, &item.SystemQty, &item.CountedQty, &item.DeltaQty); err != nil {
 			return nil, err
 		}
-		pairs = append(pairs, pair)
+		record.Items = append(record.Items, item)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-
-	return pairs, nil
+	return &record, nil
 }
 
-func (s *Store) FindTransactionByIdempotency(ctx context.Context, key string) (*domain.Transaction, error) {
-	return s.findTransaction(ctx, "idempotency_key", key)
+func (s *Store) CreateInventoryLot(ctx context.Context, lot domain.InventoryLot) (*domain.InventoryLot, error) {
+	created, err := s.CreateInventoryLots(ctx, []domain.InventoryLot{lot})
+	if err != nil {
+		return nil, err
+	}
+	return &created[0], nil
 }
 
-func (s *Store) FindTransactionByID(ctx context.Context, id string) (*domain.Transaction, error) {
-	return s.findTransaction(ctx, "id", id)
-}
+func (s *Store) CreateInventoryLots(ctx context.Context, lots []domain.InventoryLot) ([]domain.InventoryLot, error) {
+	if len(lots) == 0 {
+		return nil, store.ErrInvalidTransaction
+	}
+	normalized := make([]domain.InventoryLot, 0, len(lots))
+	for _, lot := range lots {
+		lot, err := normalizeInventoryLot(lot)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, lot)
+	}
 
-func (s *Store) findTransaction(ctx context.Context, column string, value string) (*domain.Transaction, error) {
-	if column != "id" && column != "idempotency_key" {
-		return nil, fmt.Errorf("unsupported lookup column")
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return nil, err
 	}
+	defer func() { _ = tx.Rollback() }()
 
-	var tx domain.Transaction
-	var recommendationSKU sql.NullString
-	var shiftID sql.NullString
-	var paymentReference sql.NullString
-	var voidReason sql.NullString
-	var voidedAt sql.NullTime
+	for _, lot := range normalized {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO inventory_lots (
+				id, store_id, sku, lot_code, expiry_date, qty_received, qty_available,
+				cost_cents, source_type, source_id, notes, received_at, updated_at
+			)
+			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,now())
+		`, lot.ID, lot.StoreID, lot.SKU, lot.LotCode, nullDate(lot.ExpiryDate), lot.QtyReceived, lot.QtyAvailable, lot.CostCents, lot.SourceType, nullIfEmpty(lot.SourceID), strings.TrimSpace(lot.Notes), lot.ReceivedAt)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+				return nil, store.ErrNotFound
+			}
+			return nil, err
+		}
 
-	query := fmt.Sprintf(`
-		SELECT id, store_id, terminal_id, COALESCE(shift_id,''), idempotency_key,
-			payment_method, payment_reference, subtotal_cents, discount_cents,
-			tax_rate_percent, tax_cents, total_cents, cash_received_cents, change_cents,
-			status, recommendation_shown, recommendation_accepted, recommendation_sku,
-			void_reason, voided_at, created_at
-		FROM transactions
-		WHERE %s = $1
-	`, column)
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO inventory_stocks (store_id, sku, qty, updated_at)
+			VALUES ($1,$2,$3,now())
+			ON CONFLICT (store_id, sku)
+			DO UPDATE SET qty = inventory_stocks.qty + EXCLUDED.qty, updated_at = now()
+		`, lot.StoreID, lot.SKU, lot.QtyAvailable)
+		if err != nil {
+			return nil, err
+		}
+		reason, refID := lotMovementReason(lot)
+		if err := insertMovementTx(ctx, tx, lot.StoreID, lot.SKU, lot.QtyAvailable, reason, refID, lot.ReceivedAt); err != nil {
+			return nil, err
+		}
 
-	err := s.db.QueryRowContext(ctx, query, value).Scan(
-		&tx.ID,
-		&tx.StoreID,
-		&tx.TerminalID,
-		&shiftID,
-		&tx.IdempotencyKey,
-		&tx.PaymentMethod,
-		&paymentReference,
-		&tx.SubtotalCents,
-		&tx.DiscountCents,
-		&tx.TaxRatePercent,
-		&tx.TaxCents,
-		&tx.TotalCents,
-		&tx.CashReceivedCents,
-		&tx.ChangeCents,
-		&tx.Status,
-		&tx.RecommendationShown,
-		&tx.RecommendationAccepted,
-		&recommendationSKU,
-		&voidReason,
-		&voidedAt,
-		&tx.CreatedAt,
-	)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, store.ErrNotFound
+		for _, serial := range lot.Serials {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO inventory_serials (sku, serial, store_id, lot_id, status, received_at)
+				VALUES ($1,$2,$3,$4,$5,$6)
+			`, lot.SKU, serial, lot.StoreID, lot.ID, domain.SerialStatusAvailable, lot.ReceivedAt)
+			if err != nil {
+				if isUniqueViolation(err) {
+					return nil, store.ErrInvalidTransaction
+				}
+				return nil, err
+			}
 		}
+	}
+
+	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
-	if shiftID.Valid {
-		tx.ShiftID = shiftID.String
+	return normalized, nil
+}
+
+// normalizeInventoryLot validates a lot before insert and fills in defaults.
+func normalizeInventoryLot(lot domain.InventoryLot) (domain.InventoryLot, error) {
+	if strings.TrimSpace(lot.StoreID) == "" || strings.TrimSpace(lot.SKU) == "" || lot.QtyReceived < 1 || lot.CostCents < 1 {
+		return lot, store.ErrInvalidTransaction
 	}
-	if paymentReference.Valid {
-		tx.PaymentReference = paymentReference.String
+	if lot.ID == "" {
+		lot.ID = xid.New("lot")
 	}
-	if recommendationSKU.Valid {
-		tx.RecommendationSKU = recommendationSKU.String
+	lot.SKU = strings.ToUpper(strings.TrimSpace(lot.SKU))
+	lot.LotCode = strings.TrimSpace(lot.LotCode)
+	if lot.LotCode == "" {
+		lot.LotCode = "MANUAL-" + lot.ID
 	}
-	if voidReason.Valid {
-		tx.VoidReason = voidReason.String
+	if lot.SourceType == "" {
+		lot.SourceType = "manual"
 	}
-	if voidedAt.Valid {
-		at := voidedAt.Time.UTC()
-		tx.VoidedAt = &at
+	if lot.ReceivedAt.IsZero() {
+		lot.ReceivedAt = time.Now().UTC()
 	}
-	tx.CreatedAt = tx.CreatedAt.UTC()
+	if lot.QtyAvailable < 0 || lot.QtyAvailable > lot.QtyReceived {
+		return lot, store.ErrInvalidTransaction
+	}
+	if lot.QtyAvailable == 0 {
+		lot.QtyAvailable = lot.QtyReceived
+	}
+	if len(lot.Serials) > 0 && len(lot.Serials) != lot.QtyReceived {
+		return lot, store.ErrInvalidTransaction
+	}
+	return lot, nil
+}
+
+// lotMovementReason picks the ledger reason for stock a new lot brings in.
+// Lots created on behalf of another flow (returns, voids) keep that flow's
+// source type and reference.
+func lotMovementReason(lot domain.InventoryLot) (string, string) {
+	if lot.SourceType == "" || lot.SourceType == "manual" {
+		return domain.MovementReasonLotReceive, lot.ID
+	}
+	if lot.SourceID != "" {
+		return lot.SourceType, lot.SourceID
+	}
+	return lot.SourceType, lot.ID
+}
+
+func insertMovementTx(ctx context.Context, pgTx *sql.Tx, storeID string, sku string, delta int, reason string, refID string, at time.Time) error {
+	if delta == 0 {
+		return nil
+	}
+	_, err := pgTx.ExecContext(ctx, `
+		INSERT INTO inventory_movements (store_id, sku, delta, reason, ref_id, created_at)
+		VALUES ($1,$2,$3,$4,$5,$6)
+	`, storeID, sku, delta, reason, nullIfEmpty(refID), at)
+	return err
+}
 
+func (s *Store) ListStockMovements(ctx context.Context, storeID string, sku string, from time.Time, to time.Time) ([]domain.StockMovement, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT sku, qty, unit_price_cents, margin_rate
-		FROM transaction_items
-		WHERE transaction_id = $1
-		ORDER BY id ASC
-	`, tx.ID)
+		SELECT id, store_id, sku, delta, reason, COALESCE(ref_id, ''), created_at
+		FROM inventory_movements
+		WHERE store_id = $1 AND ($2 = '' OR sku = $2) AND created_at >= $3 AND created_at < $4
+		ORDER BY created_at ASC, id ASC
+	`, storeID, sku, from, to)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	items := make([]domain.TransactionLine, 0, 8)
+	movements := make([]domain.StockMovement, 0)
 	for rows.Next() {
-		var item domain.TransactionLine
-		if err := rows.Scan(&item.SKU, &item.Qty, &item.UnitPriceCents, &item.MarginRate); err != nil {
+		var movement domain.StockMovement
+		if err := rows.Scan(&movement.ID, &movement.StoreID, &movement.SKU, &movement.Delta, &movement.Reason, &movement.RefID, &movement.CreatedAt); err != nil {
 			return nil, err
 		}
-		items = append(items, item)
+		movement.CreatedAt = movement.CreatedAt.UTC()
+		movements = append(movements, movement)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	tx.Items = items
+	return movements, nil
+}
 
-	return &tx, nil
+func (s *Store) ListSerials(ctx context.Context, storeID string, sku string, status string) ([]domain.InventorySerial, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT serial, store_id, sku, lot_id, status, COALESCE(transaction_id, ''), received_at, sold_at
+		FROM inventory_serials
+		WHERE store_id = $1 AND sku = $2 AND ($3 = '' OR status = $3)
+		ORDER BY received_at, serial
+	`, storeID, sku, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	serials := make([]domain.InventorySerial, 0)
+	for rows.Next() {
+		var entry domain.InventorySerial
+		var soldAt sql.NullTime
+		if err := rows.Scan(&entry.Serial, &entry.StoreID, &entry.SKU, &entry.LotID, &entry.Status, &entry.TransactionID, &entry.ReceivedAt, &soldAt); err != nil {
+			return nil, err
+		}
+		entry.ReceivedAt = entry.ReceivedAt.UTC()
+		if soldAt.Valid {
+			at := soldAt.Time.UTC()
+			entry.SoldAt = &at
+		}
+		serials = append(serials, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return serials, nil
 }
 
-func (s *Store) CreateCheckout(ctx context.Context, tx domain.Transaction) (*domain.Transaction, error) {
-	if tx.IdempotencyKey == "" {
-		return nil, store.ErrInvalidTransaction
+func (s *Store) ListInventoryLots(ctx context.Context, storeID string, sku string, includeExpired bool, limit int) ([]domain.InventoryLot, error) {
+	if limit < 1 {
+		limit = 200
 	}
-	if len(tx.Items) == 0 {
-		return nil, store.ErrInvalidTransaction
+	sku = strings.ToUpper(strings.TrimSpace(sku))
+
+	query := `
+		SELECT id, store_id, sku, lot_code, expiry_date, qty_received, qty_available,
+			cost_cents, source_type, source_id, notes, received_at
+		FROM inventory_lots
+		WHERE ($1 = '' OR store_id = $1)
+			AND ($2 = '' OR sku = $2)
+	`
+	if !includeExpired {
+		query += ` AND (expiry_date IS NULL OR expiry_date >= CURRENT_DATE)`
 	}
+	query += `
+		ORDER BY expiry_date ASC NULLS LAST, received_at ASC
+		LIMIT $3
+	`
 
-	pgTx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	rows, err := s.db.QueryContext(ctx, query, storeID, sku, limit)
 	if err != nil {
 		return nil, err
 	}
-	defer func() { _ = pgTx.Rollback() }()
+	defer rows.Close()
 
-	skus := uniqueSKUs(tx.Items)
-	if len(skus) == 0 {
-		return nil, store.ErrInvalidTransaction
+	lots := make([]domain.InventoryLot, 0, limit)
+	for rows.Next() {
+		var lot domain.InventoryLot
+		var expiry sql.NullTime
+		var sourceID sql.NullString
+		if err := rows.Scan(&lot.ID, &lot.StoreID, &lot.SKU, &lot.LotCode, &expiry, &lot.QtyReceived, &lot.QtyAvailable, &lot.CostCents, &lot.SourceType, &sourceID, &lot.Notes, &lot.ReceivedAt); err != nil {
+			return nil, err
+		}
+		lot.ReceivedAt = lot.ReceivedAt.UTC()
+		if expiry.Valid {
+			e := time.Date(expiry.Time.UTC().Year(), expiry.Time.UTC().Month(), expiry.Time.UTC().Day(), 0, 0, 0, 0, time.UTC)
+			lot.ExpiryDate = &e
+		}
+		if sourceID.Valid {
+			lot.SourceID = sourceID.String
+		}
+		lots = append(lots, lot)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return lots, nil
+}
 
-	productRows, err := pgTx.QueryContext(ctx, `
-		SELECT sku, price_cents, margin_rate
-		FROM products
-		WHERE active = true AND sku = ANY($1)
-	`, skus)
+func (s *Store) GetInventoryLot(ctx context.Context, lotID string) (*domain.InventoryLot, error) {
+	var lot domain.InventoryLot
+	var expiry sql.NullTime
+	var sourceID sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, store_id, sku, lot_code, expiry_date, qty_received, qty_available,
+			cost_cents, source_type, source_id, notes, received_at
+		FROM inventory_lots
+		WHERE id = $1
+	`, lotID).Scan(&lot.ID, &lot.StoreID, &lot.SKU, &lot.LotCode, &expiry, &lot.QtyReceived, &lot.QtyAvailable, &lot.CostCents, &lot.SourceType, &sourceID, &lot.Notes, &lot.ReceivedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, store.ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
-	productMap := make(map[string]domain.Product, len(skus))
-	for productRows.Next() {
-		var sku string
-		var priceCents int64
-		var marginRate float64
-		if err := productRows.Scan(&sku, &priceCents, &marginRate); err != nil {
-			_ = productRows.Close()
-			return nil, err
-		}
-		productMap[sku] = domain.Product{SKU: sku, PriceCents: priceCents, MarginRate: marginRate, Active: true}
+	lot.ReceivedAt = lot.ReceivedAt.UTC()
+	if expiry.Valid {
+		e := nowDateUTC(expiry.Time.UTC())
+		lot.ExpiryDate = &e
 	}
-	if err := productRows.Err(); err != nil {
-		_ = productRows.Close()
+	if sourceID.Valid {
+		lot.SourceID = sourceID.String
+	}
+	return &lot, nil
+}
+
+func (s *Store) AdjustLotQty(ctx context.Context, lotID string, qtyAvailable int, audit domain.AuditLog) (*domain.InventoryLot, error) {
+	pgTx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
 		return nil, err
 	}
-	_ = productRows.Close()
+	defer func() { _ = pgTx.Rollback() }()
 
-	stockRows, err := pgTx.QueryContext(ctx, `
-		SELECT sku, qty
-		FROM inventory_stocks
-		WHERE store_id = $1 AND sku = ANY($2)
+	var lot domain.InventoryLot
+	var expiry sql.NullTime
+	var sourceID sql.NullString
+	err = pgTx.QueryRowContext(ctx, `
+		SELECT id, store_id, sku, lot_code, expiry_date, qty_received, qty_available,
+			cost_cents, source_type, source_id, notes, received_at
+		FROM inventory_lots
+		WHERE id = $1
 		FOR UPDATE
-	`, tx.StoreID, skus)
+	`, lotID).Scan(&lot.ID, &lot.StoreID, &lot.SKU, &lot.LotCode, &expiry, &lot.QtyReceived, &lot.QtyAvailable, &lot.CostCents, &lot.SourceType, &sourceID, &lot.Notes, &lot.ReceivedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, store.ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
-	stockMap := make(map[string]int, len(skus))
-	for stockRows.Next() {
-		var sku string
-		var qty int
-		if err := stockRows.Scan(&sku, &qty); err != nil {
-			_ = stockRows.Close()
-			return nil, err
-		}
-		stockMap[sku] = qty
+	if qtyAvailable < 0 || qtyAvailable > lot.QtyReceived {
+		return nil, store.ErrInvalidTransaction
 	}
-	if err := stockRows.Err(); err != nil {
-		_ = stockRows.Close()
+
+	delta := qtyAvailable - lot.QtyAvailable
+	_, err = pgTx.ExecContext(ctx, `
+		UPDATE inventory_lots
+		SET qty_available = $1, updated_at = now()
+		WHERE id = $2
+	`, qtyAvailable, lot.ID)
+	if err != nil {
 		return nil, err
 	}
-	_ = stockRows.Close()
-
-	subtotalCents := int64(0)
-	recomputedItems := make([]domain.TransactionLine, 0, len(tx.Items))
-	today := nowDateUTC(time.Now().UTC())
-	for _, item := range tx.Items {
-		if item.Qty < 1 {
-			return nil, store.ErrInvalidTransaction
-		}
-
-		product, exists := productMap[item.SKU]
-		if !exists {
-			return nil, fmt.Errorf("sku %s unavailable", item.SKU)
-		}
-
-		stockQty, exists := stockMap[item.SKU]
-		if !exists || stockQty < item.Qty {
-			return nil, store.ErrInsufficientStock
-		}
-		lotRows, err := pgTx.QueryContext(ctx, `
-			SELECT id, expiry_date, qty_available
-			FROM inventory_lots
-			WHERE store_id = $1 AND sku = $2 AND qty_available > 0
-			ORDER BY expiry_date ASC NULLS LAST, received_at ASC
-			FOR UPDATE
-		`, tx.StoreID, item.SKU)
-		if err != nil {
-			return nil, err
-		}
-		type lotState struct {
-			id       string
-			expiry   *time.Time
-			available int
-		}
-		lots := make([]lotState, 0, 8)
-		for lotRows.Next() {
-			var lotID string
-			var expiry sql.NullTime
-			var available int
-			if err := lotRows.Scan(&lotID, &expiry, &available); err != nil {
-				_ = lotRows.Close()
-				return nil, err
-			}
-			var expiryDate *time.Time
-			if expiry.Valid {
-				e := nowDateUTC(expiry.Time.UTC())
-				expiryDate = &e
-			}
-			lots = append(lots, lotState{id: lotID, expiry: expiryDate, available: available})
-		}
-		if err := lotRows.Err(); err != nil {
-			_ = lotRows.Close()
-			return nil, err
-		}
-		_ = lotRows.Close()
-		if len(lots) > 0 {
-			availableFromLots := 0
-			for _, lot := range lots {
-				if lot.expiry != nil && lot.expiry.Before(today) {
-					continue
-				}
-				availableFromLots += lot.available
-			}
-			if availableFromLots < item.Qty {
-				return nil, store.ErrInsufficientStock
-			}
-			remainingFromLots := item.Qty
-			for _, lot := range lots {
-				if remainingFromLots == 0 {
-					break
-				}
-				if lot.available < 1 {
-					continue
-				}
-				if lot.expiry != nil && lot.expiry.Before(today) {
-					continue
-				}
-				used := remainingFromLots
-				if used > lot.available {
-					used = lot.available
-				}
-				_, err = pgTx.ExecContext(ctx, `
-					UPDATE inventory_lots
-					SET qty_available = qty_available - $1, updated_at = now()
-					WHERE id = $2
-				`, used, lot.id)
-				if err != nil {
-					return nil, err
-				}
-				remainingFromLots -= used
-			}
-			if remainingFromLots > 0 {
-				return nil, store.ErrInsufficientStock
-			}
-		}
-
-		_, err = pgTx.ExecContext(ctx, `
-			UPDATE inventory_stocks
-			SET qty = qty - $1, updated_at = now()
-			WHERE store_id = $2 AND sku = $3
-		`, item.Qty, tx.StoreID, item.SKU)
-		if err != nil {
-			return nil, err
-		}
-
-		recomputedItems = append(recomputedItems, domain.TransactionLine{
-			SKU:            item.SKU,
-			Qty:            item.Qty,
-			UnitPriceCents: product.PriceCents,
-			MarginRate:     product.MarginRate,
-		})
-		subtotalCents += product.PriceCents * int64(item.Qty)
-	}
 
-	if tx.DiscountCents < 0 || tx.DiscountCents > subtotalCents {
-		return nil, store.ErrInvalidTransaction
+	var stockBefore int
+	err = pgTx.QueryRowContext(ctx, `
+		SELECT qty
+		FROM inventory_stocks
+		WHERE store_id = $1 AND sku = $2
+		FOR UPDATE
+	`, lot.StoreID, lot.SKU).Scan(&stockBefore)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
 	}
-	if tx.TaxRatePercent < 0 || tx.TaxRatePercent > 100 {
-		return nil, store.ErrInvalidTransaction
+	_, err = pgTx.ExecContext(ctx, `
+		INSERT INTO inventory_stocks (store_id, sku, qty, updated_at)
+		VALUES ($1,$2,GREATEST($3,0),now())
+		ON CONFLICT (store_id, sku)
+		DO UPDATE SET qty = GREATEST(inventory_stocks.qty + $3, 0), updated_at = now()
+	`, lot.StoreID, lot.SKU, delta)
+	if err != nil {
+		return nil, err
 	}
-
-	taxBase := subtotalCents - tx.DiscountCents
-	taxCents := int64(math.Round(float64(taxBase) * tx.TaxRatePercent / 100))
-	totalCents := taxBase + taxCents
-
-	if tx.PaymentMethod == "cash" {
-		if tx.CashReceivedCents < totalCents {
-			return nil, store.ErrInvalidTransaction
-		}
-		tx.ChangeCents = tx.CashReceivedCents - totalCents
-	} else {
-		tx.ChangeCents = 0
+	stockAfter := max(0, stockBefore+delta)
+	if err := insertMovementTx(ctx, pgTx, lot.StoreID, lot.SKU, stockAfter-stockBefore, domain.MovementReasonLotAdjust, lot.ID, time.Now().UTC()); err != nil {
+		return nil, err
 	}
 
-	tx.SubtotalCents = subtotalCents
-	tx.TaxCents = taxCents
-	tx.TotalCents = totalCents
-	tx.Items = recomputedItems
-	if tx.ID == "" {
-		tx.ID = xid.New("tx")
-	}
-	if tx.CreatedAt.IsZero() {
-		tx.CreatedAt = time.Now().UTC()
+	if audit.ID == "" {
+		audit.ID = xid.New("audit")
 	}
-	if tx.Status == "" {
-		tx.Status = domain.TxStatusPaid
+	if audit.CreatedAt.IsZero() {
+		audit.CreatedAt = time.Now().UTC()
 	}
-
 	_, err = pgTx.ExecContext(ctx, `
-		INSERT INTO transactions (
-			id, store_id, terminal_id, shift_id, idempotency_key, payment_method,
-			payment_reference, subtotal_cents, discount_cents, tax_rate_percent, tax_cents,
-			total_cents, cash_received_cents, change_cents, status,
-			recommendation_shown, recommendation_accepted, recommendation_sku,
-			void_reason, voided_at, created_at
+		INSERT INTO audit_logs (
+			id, store_id, actor_username, actor_role, action, entity_type, entity_id, detail, created_at
 		)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21)
-	`, tx.ID, tx.StoreID, tx.TerminalID, nullIfEmpty(tx.ShiftID), tx.IdempotencyKey, tx.PaymentMethod,
-		nullIfEmpty(tx.PaymentReference), tx.SubtotalCents, tx.DiscountCents, tx.TaxRatePercent,
-		tx.TaxCents, tx.TotalCents, tx.CashReceivedCents, tx.ChangeCents, tx.Status,
-		tx.RecommendationShown, tx.RecommendationAccepted, nullIfEmpty(tx.RecommendationSKU),
-		nullIfEmpty(tx.VoidReason), nullTime(tx.VoidedAt), tx.CreatedAt)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+	`, audit.ID, lot.StoreID, audit.ActorUsername, audit.ActorRole, audit.Action, audit.EntityType, lot.ID, audit.Detail, audit.CreatedAt)
 	if err != nil {
-		if isUniqueViolation(err) {
-			existing, lookupErr := s.FindTransactionByIdempotency(ctx, tx.IdempotencyKey)
-			if lookupErr == nil {
-				return existing, nil
-			}
-		}
 		return nil, err
 	}
 
-	for _, item := range tx.Items {
-		_, err := pgTx.ExecContext(ctx, `
-			INSERT INTO transaction_items (transaction_id, sku, qty, unit_price_cents, margin_rate)
-			VALUES ($1,$2,$3,$4,$5)
-		`, tx.ID, item.SKU, item.Qty, item.UnitPriceCents, item.MarginRate)
-		if err != nil {
-			return nil, err
-		}
-	}
-
 	if err := pgTx.Commit(); err != nil {
 		return nil, err
 	}
 
-	return &tx, nil
+	lot.QtyAvailable = qtyAvailable
+	lot.ReceivedAt = lot.ReceivedAt.UTC()
+	if expiry.Valid {
+		e := nowDateUTC(expiry.Time.UTC())
+		lot.ExpiryDate = &e
+	}
+	if sourceID.Valid {
+		lot.SourceID = sourceID.String
+	}
+	return &lot, nil
 }
 
-func (s *Store) VoidTransaction(ctx context.Context, id string, reason string, at time.Time) (*domain.Transaction, error) {
+func (s *Store) CorrectLotCost(ctx context.Context, lotID string, costCents int64, audit domain.AuditLog) (*domain.InventoryLot, error) {
+	if costCents < 1 {
+		return nil, store.ErrInvalidTransaction
+	}
+
 	pgTx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
 	if err != nil {
 		return nil, err
 	}
 	defer func() { _ = pgTx.Rollback() }()
 
-	var tx domain.Transaction
+	var lot domain.InventoryLot
+	var expiry sql.NullTime
+	var sourceID sql.NullString
 	err = pgTx.QueryRowContext(ctx, `
-		SELECT id, store_id, status
-		FROM transactions
-		WHERE id = $1
-		FOR UPDATE
-	`, id).Scan(&tx.ID, &tx.StoreID, &tx.Status)
+		UPDATE inventory_lots
+		SET cost_cents = $1, updated_at = now()
+		WHERE id = $2
+		RETURNING id, store_id, sku, lot_code, expiry_date, qty_received, qty_available,
+			cost_cents, source_type, source_id, notes, received_at
+	`, costCents, lotID).Scan(&lot.ID, &lot.StoreID, &lot.SKU, &lot.LotCode, &expiry, &lot.QtyReceived, &lot.QtyAvailable, &lot.CostCents, &lot.SourceType, &sourceID, &lot.Notes, &lot.ReceivedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, store.ErrNotFound
+	}
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, store.ErrNotFound
-		}
 		return nil, err
 	}
-	if tx.Status != domain.TxStatusPaid {
-		return nil, store.ErrInvalidTransaction
-	}
 
-	itemRows, err := pgTx.QueryContext(ctx, `
-		SELECT sku, qty
-		FROM transaction_items
-		WHERE transaction_id = $1
-	`, id)
+	// Re-weight the SKU cost from every lot still on hand rather than
+	// incrementally, so the bad figure is fully removed.
+	var totalValue, totalQty int64
+	err = pgTx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(cost_cents * qty_available),0)::bigint, COALESCE(SUM(qty_available),0)::bigint
+		FROM inventory_lots
+		WHERE store_id = $1 AND sku = $2 AND qty_available > 0
+	`, lot.StoreID, lot.SKU).Scan(&totalValue, &totalQty)
 	if err != nil {
 		return nil, err
 	}
-	items := make([]domain.TransactionLine, 0, 8)
-	for itemRows.Next() {
-		var item domain.TransactionLine
-		if err := itemRows.Scan(&item.SKU, &item.Qty); err != nil {
-			_ = itemRows.Close()
-			return nil, err
-		}
-		items = append(items, item)
+	weighted := costCents
+	if totalQty > 0 {
+		weighted = maxInt64(1, int64(math.Round(float64(totalValue)/float64(totalQty))))
 	}
-	if err := itemRows.Err(); err != nil {
-		_ = itemRows.Close()
+	_, err = pgTx.ExecContext(ctx, `
+		INSERT INTO product_costs (store_id, sku, cost_cents, updated_at)
+		VALUES ($1,$2,$3,now())
+		ON CONFLICT (store_id, sku)
+		DO UPDATE SET cost_cents = EXCLUDED.cost_cents, updated_at = now()
+	`, lot.StoreID, lot.SKU, weighted)
+	if err != nil {
 		return nil, err
 	}
-	_ = itemRows.Close()
 
+	if audit.ID == "" {
+		audit.ID = xid.New("audit")
+	}
+	if audit.CreatedAt.IsZero() {
+		audit.CreatedAt = time.Now().UTC()
+	}
 	_, err = pgTx.ExecContext(ctx, `
-		UPDATE transactions
-		SET status = $2, void_reason = $3, voided_at = $4
-		WHERE id = $1 AND status = $5
-	`, id, domain.TxStatusVoided, reason, at, domain.TxStatusPaid)
+		INSERT INTO audit_logs (
+			id, store_id, actor_username, actor_role, action, entity_type, entity_id, detail, created_at
+		)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+	`, audit.ID, lot.StoreID, audit.ActorUsername, audit.ActorRole, audit.Action, audit.EntityType, lot.ID, audit.Detail, audit.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, item := range items {
-		lotID := xid.New("lot")
-		lotCode := "VOID-" + id
-		_, err := pgTx.ExecContext(ctx, `
-			INSERT INTO inventory_stocks (store_id, sku, qty, updated_at)
-			VALUES ($1,$2,$3,now())
-			ON CONFLICT (store_id, sku)
-			DO UPDATE SET qty = inventory_stocks.qty + EXCLUDED.qty, updated_at = now()
-		`, tx.StoreID, item.SKU, item.Qty)
-		if err != nil {
-			return nil, err
-		}
-		_, err = pgTx.ExecContext(ctx, `
-			INSERT INTO inventory_lots (
-				id, store_id, sku, lot_code, expiry_date, qty_received, qty_available,
-				cost_cents, source_type, source_id, notes, received_at, updated_at
-			)
-			VALUES ($1,$2,$3,$4,NULL,$5,$6,$7,'void',$8,$9,$10,now())
-		`, lotID, tx.StoreID, item.SKU, lotCode, item.Qty, item.Qty, maxInt64(1, item.UnitPriceCents), id, "auto restock from void", at)
-		if err != nil {
-			return nil, err
-		}
+	if err := pgTx.Commit(); err != nil {
+		return nil, err
 	}
 
-	if err := pgTx.Commit(); err != nil {
+	lot.ReceivedAt = lot.ReceivedAt.UTC()
+	if expiry.Valid {
+		e := nowDateUTC(expiry.Time.UTC())
+		lot.ExpiryDate = &e
+	}
+	if sourceID.Valid {
+		lot.SourceID = sourceID.String
+	}
+	return &lot, nil
+}
+
+func (s *Store) ListExpiringLots(ctx context.Context, storeID string, withinDays int) ([]domain.ExpiringLot, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT l.id, l.store_id, l.sku, p.name, l.lot_code, l.expiry_date, l.qty_available,
+			l.cost_cents, l.cost_cents * l.qty_available
+		FROM inventory_lots l
+		JOIN products p ON p.sku = l.sku
+		WHERE l.store_id = $1
+			AND l.qty_available > 0
+			AND l.expiry_date IS NOT NULL
+			AND l.expiry_date <= CURRENT_DATE + $2::int
+		ORDER BY l.expiry_date ASC, l.received_at ASC
+	`, storeID, withinDays)
+	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	tx.Status = domain.TxStatusVoided
-	tx.VoidReason = reason
-	tx.VoidedAt = &at
-	return &tx, nil
+	lots := make([]domain.ExpiringLot, 0)
+	for rows.Next() {
+		var lot domain.ExpiringLot
+		if err := rows.Scan(&lot.LotID, &lot.StoreID, &lot.SKU, &lot.ProductName, &lot.LotCode, &lot.ExpiryDate, &lot.QtyAvailable, &lot.CostCents, &lot.AtRiskCostCents); err != nil {
+			return nil, err
+		}
+		lot.ExpiryDate = nowDateUTC(lot.ExpiryDate)
+		lots = append(lots, lot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return lots, nil
 }
 
-func (s *Store) CreateRefund(ctx context.Context, refund domain.Refund) (*domain.Refund, error) {
-	if refund.ID == "" {
-		refund.ID = xid.New("refund")
+func (s *Store) WriteOffStock(ctx context.Context, writeOff domain.StockWriteOff, audit domain.AuditLog) (*domain.StockWriteOff, error) {
+	if writeOff.StoreID == "" || writeOff.SKU == "" || writeOff.Qty < 1 {
+		return nil, store.ErrInvalidTransaction
 	}
-	if refund.CreatedAt.IsZero() {
-		refund.CreatedAt = time.Now().UTC()
+	if writeOff.ID == "" {
+		writeOff.ID = xid.New("wo")
 	}
-	if refund.Status == "" {
-		refund.Status = domain.TxStatusRefunded
+	if writeOff.CreatedAt.IsZero() {
+		writeOff.CreatedAt = time.Now().UTC()
 	}
 
 	pgTx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
@@ -905,492 +1093,2645 @@ func (s *Store) CreateRefund(ctx context.Context, refund domain.Refund) (*domain
 	}
 	defer func() { _ = pgTx.Rollback() }()
 
-	var transactionTotal int64
-	var transactionStatus string
+	var stockQty int
 	err = pgTx.QueryRowContext(ctx, `
-		SELECT total_cents, status
-		FROM transactions
-		WHERE id = $1
+		SELECT qty
+		FROM inventory_stocks
+		WHERE store_id = $1 AND sku = $2
 		FOR UPDATE
-	`, refund.OriginalTransactionID).Scan(&transactionTotal, &transactionStatus)
+	`, writeOff.StoreID, writeOff.SKU).Scan(&stockQty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, store.ErrInsufficientStock
+	}
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, store.ErrNotFound
-		}
 		return nil, err
 	}
-	if transactionStatus == domain.TxStatusVoided || transactionStatus == domain.TxStatusRefunded {
-		return nil, store.ErrInvalidTransaction
+	if stockQty < writeOff.Qty {
+		return nil, store.ErrInsufficientStock
 	}
 
-	refundedSoFar := int64(0)
-	rows, err := pgTx.QueryContext(ctx, `
-		SELECT amount_cents
-		FROM refunds
-		WHERE original_transaction_id = $1 AND status = $2
-		FOR UPDATE
-	`, refund.OriginalTransactionID, domain.TxStatusRefunded)
+	cost, err := consumeLotsTx(ctx, pgTx, writeOff.StoreID, writeOff.SKU, writeOff.Qty)
 	if err != nil {
 		return nil, err
 	}
-	for rows.Next() {
-		var amount int64
-		if err := rows.Scan(&amount); err != nil {
-			_ = rows.Close()
-			return nil, err
-		}
-		refundedSoFar += amount
+	writeOff.CostCents = cost
+
+	_, err = pgTx.ExecContext(ctx, `
+		UPDATE inventory_stocks
+		SET qty = qty - $1, updated_at = now()
+		WHERE store_id = $2 AND sku = $3
+	`, writeOff.Qty, writeOff.StoreID, writeOff.SKU)
+	if err != nil {
+		return nil, err
 	}
-	if err := rows.Err(); err != nil {
-		_ = rows.Close()
+	if err := insertMovementTx(ctx, pgTx, writeOff.StoreID, writeOff.SKU, -writeOff.Qty, domain.MovementReasonWriteOff, writeOff.ID, writeOff.CreatedAt); err != nil {
 		return nil, err
 	}
-	_ = rows.Close()
 
-	remaining := transactionTotal - refundedSoFar
-	if refund.AmountCents > remaining {
+	_, err = pgTx.ExecContext(ctx, `
+		INSERT INTO stock_adjustments (
+			id, store_id, sku, adjustment_type, qty_delta, cost_cents, reason, created_by, created_at
+		)
+		VALUES ($1,$2,$3,'write_off',$4,$5,$6,$7,$8)
+	`, writeOff.ID, writeOff.StoreID, writeOff.SKU, -writeOff.Qty, writeOff.CostCents, writeOff.Reason, writeOff.CreatedBy, writeOff.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if audit.ID == "" {
+		audit.ID = xid.New("audit")
+	}
+	if audit.CreatedAt.IsZero() {
+		audit.CreatedAt = writeOff.CreatedAt
+	}
+	_, err = pgTx.ExecContext(ctx, `
+		INSERT INTO audit_logs (
+			id, store_id, actor_username, actor_role, action, entity_type, entity_id, detail, created_at
+		)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+	`, audit.ID, audit.StoreID, audit.ActorUsername, audit.ActorRole, audit.Action, audit.EntityType, writeOff.ID, audit.Detail, audit.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pgTx.Commit(); err != nil {
+		return nil, err
+	}
+	return &writeOff, nil
+}
+
+func (s *Store) TransferStock(ctx context.Context, fromStoreID string, lot domain.InventoryLot, audits []domain.AuditLog) ([]domain.InventoryLot, error) {
+	if fromStoreID == "" || lot.StoreID == "" || lot.SKU == "" || lot.QtyReceived < 1 {
+		return nil, store.ErrInvalidTransaction
+	}
+	if fromStoreID == lot.StoreID {
 		return nil, store.ErrInvalidTransaction
 	}
+	if lot.ID == "" {
+		lot.ID = xid.New("lot")
+	}
+	lot.LotCode = strings.TrimSpace(lot.LotCode)
+	if lot.LotCode == "" {
+		lot.LotCode = "TRANSFER-" + lot.ID
+	}
+	if lot.ReceivedAt.IsZero() {
+		lot.ReceivedAt = time.Now().UTC()
+	}
+	lot.SourceType = "transfer"
+	lot.QtyAvailable = lot.QtyReceived
+
+	pgTx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = pgTx.Rollback() }()
+
+	var stockQty int
+	err = pgTx.QueryRowContext(ctx, `
+		SELECT qty
+		FROM inventory_stocks
+		WHERE store_id = $1 AND sku = $2
+		FOR UPDATE
+	`, fromStoreID, lot.SKU).Scan(&stockQty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, store.ErrInsufficientStock
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stockQty < lot.QtyReceived {
+		return nil, store.ErrInsufficientStock
+	}
+
+	pieces, err := takeTransferLotsTx(ctx, pgTx, fromStoreID, lot, stockQty)
+	if err != nil {
+		return nil, err
+	}
 
 	_, err = pgTx.ExecContext(ctx, `
-		INSERT INTO refunds (id, original_transaction_id, reason, amount_cents, status, created_at)
-		VALUES ($1,$2,$3,$4,$5,$6)
-	`, refund.ID, refund.OriginalTransactionID, refund.Reason, refund.AmountCents, refund.Status, refund.CreatedAt)
+		UPDATE inventory_stocks
+		SET qty = qty - $1, updated_at = now()
+		WHERE store_id = $2 AND sku = $3
+	`, lot.QtyReceived, fromStoreID, lot.SKU)
 	if err != nil {
 		return nil, err
 	}
 
-	nextStatus := domain.TxStatusPaid
-	if refundedSoFar+refund.AmountCents >= transactionTotal {
-		nextStatus = domain.TxStatusRefunded
+	totalCost := int64(0)
+	for _, piece := range pieces {
+		totalCost += piece.CostCents * int64(piece.QtyReceived)
+		_, err = pgTx.ExecContext(ctx, `
+			INSERT INTO inventory_lots (
+				id, store_id, sku, lot_code, expiry_date, qty_received, qty_available,
+				cost_cents, source_type, source_id, notes, received_at, updated_at
+			)
+			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,now())
+		`, piece.ID, piece.StoreID, piece.SKU, piece.LotCode, nullDate(piece.ExpiryDate), piece.QtyReceived, piece.QtyAvailable, piece.CostCents, piece.SourceType, nullIfEmpty(piece.SourceID), strings.TrimSpace(piece.Notes), piece.ReceivedAt)
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	var destQty int
+	var prevCost int64
+	err = pgTx.QueryRowContext(ctx, `
+		SELECT
+			COALESCE((SELECT qty FROM inventory_stocks WHERE store_id = $1 AND sku = $2), 0),
+			COALESCE((SELECT cost_cents FROM product_costs WHERE store_id = $1 AND sku = $2), 0)
+	`, lot.StoreID, lot.SKU).Scan(&destQty, &prevCost)
+	if err != nil {
+		return nil, err
+	}
+	unitCost := maxInt64(1, totalCost/int64(lot.QtyReceived))
 	_, err = pgTx.ExecContext(ctx, `
-		UPDATE transactions
-		SET status = $2
-		WHERE id = $1
-	`, refund.OriginalTransactionID, nextStatus)
+		INSERT INTO product_costs (store_id, sku, cost_cents, updated_at)
+		VALUES ($1,$2,$3,now())
+		ON CONFLICT (store_id, sku)
+		DO UPDATE SET cost_cents = EXCLUDED.cost_cents, updated_at = now()
+	`, lot.StoreID, lot.SKU, weightedCostCents(prevCost, destQty, unitCost, lot.QtyReceived))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = pgTx.ExecContext(ctx, `
+		INSERT INTO inventory_stocks (store_id, sku, qty, updated_at)
+		VALUES ($1,$2,$3,now())
+		ON CONFLICT (store_id, sku)
+		DO UPDATE SET qty = inventory_stocks.qty + EXCLUDED.qty, updated_at = now()
+	`, lot.StoreID, lot.SKU, lot.QtyReceived)
 	if err != nil {
 		return nil, err
 	}
+	if err := insertMovementTx(ctx, pgTx, fromStoreID, lot.SKU, -lot.QtyReceived, domain.MovementReasonTransferOut, lot.ID, lot.ReceivedAt); err != nil {
+		return nil, err
+	}
+	if err := insertMovementTx(ctx, pgTx, lot.StoreID, lot.SKU, lot.QtyReceived, domain.MovementReasonTransferIn, lot.ID, lot.ReceivedAt); err != nil {
+		return nil, err
+	}
+
+	for _, audit := range audits {
+		if audit.ID == "" {
+			audit.ID = xid.New("audit")
+		}
+		if audit.CreatedAt.IsZero() {
+			audit.CreatedAt = lot.ReceivedAt
+		}
+		_, err = pgTx.ExecContext(ctx, `
+			INSERT INTO audit_logs (
+				id, store_id, actor_username, actor_role, action, entity_type, entity_id, detail, created_at
+			)
+			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+		`, audit.ID, audit.StoreID, audit.ActorUsername, audit.ActorRole, audit.Action, audit.EntityType, audit.EntityID, audit.Detail, audit.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	if err := pgTx.Commit(); err != nil {
 		return nil, err
 	}
+	return pieces, nil
+}
 
-	return &refund, nil
+// takeTransferLotsTx takes lot.QtyReceived units out of the source store's
+// unexpired lots in FEFO order, then out of the stockQty no lot tracks, and
+// returns the destination lots. Expired lots are left for write-off.
+func takeTransferLotsTx(ctx context.Context, pgTx *sql.Tx, fromStoreID string, lot domain.InventoryLot, stockQty int) ([]domain.InventoryLot, error) {
+	lotRows, err := pgTx.QueryContext(ctx, `
+		SELECT id, expiry_date, qty_available, cost_cents
+		FROM inventory_lots
+		WHERE store_id = $1 AND sku = $2 AND qty_available > 0
+		ORDER BY expiry_date ASC NULLS LAST, received_at ASC
+		FOR UPDATE
+	`, fromStoreID, lot.SKU)
+	if err != nil {
+		return nil, err
+	}
+	type lotState struct {
+		id        string
+		expiry    *time.Time
+		available int
+		cost      int64
+	}
+	today := nowDateUTC(time.Now().UTC())
+	lots := make([]lotState, 0, 8)
+	tracked := 0
+	for lotRows.Next() {
+		var state lotState
+		var expiry sql.NullTime
+		if err := lotRows.Scan(&state.id, &expiry, &state.available, &state.cost); err != nil {
+			_ = lotRows.Close()
+			return nil, err
+		}
+		tracked += state.available
+		if expiry.Valid {
+			e := nowDateUTC(expiry.Time.UTC())
+			if e.Before(today) {
+				continue
+			}
+			state.expiry = &e
+		}
+		lots = append(lots, state)
+	}
+	if err := lotRows.Err(); err != nil {
+		_ = lotRows.Close()
+		return nil, err
+	}
+	_ = lotRows.Close()
+
+	usable := max(stockQty-tracked, 0)
+	for _, state := range lots {
+		usable += state.available
+	}
+	if usable < lot.QtyReceived {
+		return nil, store.ErrInsufficientStock
+	}
+
+	pieces := make([]domain.InventoryLot, 0, 2)
+	remaining := lot.QtyReceived
+	for _, state := range lots {
+		if remaining == 0 {
+			break
+		}
+		used := min(remaining, state.available)
+		_, err := pgTx.ExecContext(ctx, `
+			UPDATE inventory_lots
+			SET qty_available = qty_available - $1, updated_at = now()
+			WHERE id = $2
+		`, used, state.id)
+		if err != nil {
+			return nil, err
+		}
+		remaining -= used
+		pieces = append(pieces, store.TransferLot(lot, len(pieces), used, state.cost, state.expiry))
+	}
+	if remaining > 0 {
+		var unitCost int64
+		err := pgTx.QueryRowContext(ctx, `
+			SELECT cost_cents
+			FROM product_costs
+			WHERE store_id = $1 AND sku = $2
+		`, fromStoreID, lot.SKU).Scan(&unitCost)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		pieces = append(pieces, store.TransferLot(lot, len(pieces), remaining, unitCost, nil))
+	}
+	return pieces, nil
 }
 
-func (s *Store) GetReturnedQtyByTransaction(ctx context.Context, transactionID string) (map[string]int, error) {
-	result := make(map[string]int)
+// consumeLotsTx drains qty units from the SKU's lots in FEFO order, expired
+// lots included, and returns the cost of the units removed. Units not
+// covered by any lot are valued at the store's current product cost.
+func consumeLotsTx(ctx context.Context, pgTx *sql.Tx, storeID string, sku string, qty int) (int64, error) {
+	lotRows, err := pgTx.QueryContext(ctx, `
+		SELECT id, qty_available, cost_cents
+		FROM inventory_lots
+		WHERE store_id = $1 AND sku = $2 AND qty_available > 0
+		ORDER BY expiry_date ASC NULLS LAST, received_at ASC
+		FOR UPDATE
+	`, storeID, sku)
+	if err != nil {
+		return 0, err
+	}
+	type lotState struct {
+		id        string
+		available int
+		cost      int64
+	}
+	lots := make([]lotState, 0, 8)
+	for lotRows.Next() {
+		var lot lotState
+		if err := lotRows.Scan(&lot.id, &lot.available, &lot.cost); err != nil {
+			_ = lotRows.Close()
+			return 0, err
+		}
+		lots = append(lots, lot)
+	}
+	if err := lotRows.Err(); err != nil {
+		_ = lotRows.Close()
+		return 0, err
+	}
+	_ = lotRows.Close()
+
+	cost := int64(0)
+	remaining := qty
+	for _, lot := range lots {
+		if remaining == 0 {
+			break
+		}
+		used := remaining
+		if used > lot.available {
+			used = lot.available
+		}
+		_, err := pgTx.ExecContext(ctx, `
+			UPDATE inventory_lots
+			SET qty_available = qty_available - $1, updated_at = now()
+			WHERE id = $2
+		`, used, lot.id)
+		if err != nil {
+			return 0, err
+		}
+		cost += lot.cost * int64(used)
+		remaining -= used
+	}
+
+	if remaining > 0 {
+		var unitCost int64
+		err := pgTx.QueryRowContext(ctx, `
+			SELECT cost_cents
+			FROM product_costs
+			WHERE store_id = $1 AND sku = $2
+		`, storeID, sku).Scan(&unitCost)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+		cost += unitCost * int64(remaining)
+	}
+	return cost, nil
+}
+
+func (s *Store) IncreaseStock(ctx context.Context, storeID string, adjustments []domain.StockAdjustment) error {
+	if len(adjustments) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, adj := range adjustments {
+		if adj.Qty < 1 {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO inventory_stocks (store_id, sku, qty, updated_at)
+			VALUES ($1,$2,$3,now())
+			ON CONFLICT (store_id, sku)
+			DO UPDATE SET qty = inventory_stocks.qty + EXCLUDED.qty, updated_at = now()
+		`, storeID, adj.SKU, adj.Qty)
+		if err != nil {
+			return err
+		}
+		if err := insertMovementTx(ctx, tx, storeID, adj.SKU, adj.Qty, domain.MovementReasonRestock, "", time.Now().UTC()); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) GetAssociationPairs(ctx context.Context, sourceSKUs []string) ([]domain.AssociationPair, error) {
+	pairs := make([]domain.AssociationPair, 0)
+	if len(sourceSKUs) == 0 {
+		return pairs, nil
+	}
+
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT iri.sku, COALESCE(SUM(iri.qty), 0)::int
-		FROM item_returns ir
-		JOIN item_return_items iri ON iri.item_return_id = ir.id
-		WHERE ir.original_transaction_id = $1 AND iri.kind = 'return'
-		GROUP BY iri.sku
-	`, transactionID)
+		SELECT source_sku, target_sku, affinity_score, support, confidence, lift, manual
+		FROM association_item_pairs
+		WHERE source_sku = ANY($1)
+	`, sourceSKUs)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var sku string
-		var qty int
-		if err := rows.Scan(&sku, &qty); err != nil {
+		var pair domain.AssociationPair
+		if err := rows.Scan(&pair.SourceSKU, &pair.TargetSKU, &pair.Affinity, &pair.Support, &pair.Confidence, &pair.Lift, &pair.Manual); err != nil {
 			return nil, err
 		}
-		result[sku] = qty
+		pairs = append(pairs, pair)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	return result, nil
+
+	return pairs, nil
 }
 
-func (s *Store) CreateItemReturn(ctx context.Context, itemReturn domain.ItemReturn) (*domain.ItemReturn, error) {
-	if itemReturn.ID == "" {
-		itemReturn.ID = xid.New("ret")
+func (s *Store) GetCategoryAssociationPairs(ctx context.Context, sourceCategories []string) ([]domain.CategoryAssociationPair, error) {
+	pairs := make([]domain.CategoryAssociationPair, 0)
+	if len(sourceCategories) == 0 {
+		return pairs, nil
 	}
-	if itemReturn.CreatedAt.IsZero() {
-		itemReturn.CreatedAt = time.Now().UTC()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT source_category, target_category, affinity_score
+		FROM association_category_pairs
+		WHERE source_category = ANY($1)
+	`, sourceCategories)
+	if err != nil {
+		return nil, err
 	}
-	if strings.TrimSpace(itemReturn.OriginalTransactionID) == "" || len(itemReturn.ReturnItems) == 0 {
-		return nil, store.ErrInvalidTransaction
+	defer rows.Close()
+
+	for rows.Next() {
+		var pair domain.CategoryAssociationPair
+		if err := rows.Scan(&pair.SourceCategory, &pair.TargetCategory, &pair.Affinity); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
 	}
-	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return pairs, nil
+}
+
+// UpsertAssociationPair stores a manually curated pair. Manual pairs replace
+// any computed pair for the same SKUs and survive retraining.
+func (s *Store) UpsertAssociationPair(ctx context.Context, sourceSKU string, targetSKU string, affinity float64) (*domain.AssociationPair, error) {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO association_item_pairs (source_sku, target_sku, confidence, affinity_score, manual, updated_at)
+		VALUES ($1,$2,$3,$3,true,now())
+		ON CONFLICT (source_sku, target_sku) DO UPDATE
+		SET confidence = EXCLUDED.confidence,
+			affinity_score = EXCLUDED.affinity_score,
+			manual = true,
+			updated_at = now()
+	`, sourceSKU, targetSKU, affinity)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return nil, store.ErrNotFound
+		}
 		return nil, err
 	}
-	defer func() { _ = tx.Rollback() }()
+	return &domain.AssociationPair{SourceSKU: sourceSKU, TargetSKU: targetSKU, Affinity: affinity, Manual: true}, nil
+}
 
-	_, err = tx.ExecContext(ctx, `
-		INSERT INTO item_returns (
+func (s *Store) DeleteAssociationPair(ctx context.Context, sourceSKU string, targetSKU string) error {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM association_item_pairs
+		WHERE source_sku = $1 AND target_sku = $2
+	`, sourceSKU, targetSKU)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) FindTransactionByIdempotency(ctx context.Context, key string) (*domain.Transaction, error) {
+	return s.findTransaction(ctx, "idempotency_key", key)
+}
+
+func (s *Store) FindTransactionByID(ctx context.Context, id string) (*domain.Transaction, error) {
+	return s.findTransaction(ctx, "id", id)
+}
+
+func (s *Store) findTransaction(ctx context.Context, column string, value string) (*domain.Transaction, error) {
+	if column != "id" && column != "idempotency_key" {
+		return nil, fmt.Errorf("unsupported lookup column")
+	}
+
+	var tx domain.Transaction
+	var recommendationSKU sql.NullString
+	var shiftID sql.NullString
+	var paymentReference sql.NullString
+	var voidReason sql.NullString
+	var voidedAt sql.NullTime
+
+	query := fmt.Sprintf(`
+		SELECT id, store_id, terminal_id, COALESCE(shift_id,''), idempotency_key,
+			payment_method, payment_reference, subtotal_cents, discount_cents,
+			tax_rate_percent, tax_cents, total_cents, cash_received_cents, change_cents,
+			status, recommendation_shown, recommendation_accepted, recommendation_sku,
+			experiment_bucket, void_reason, voided_at, created_at,
+			COALESCE(store_credit_code, ''), store_credit_cents, COALESCE(customer_id, '')
+		FROM transactions
+		WHERE %s = $1
+	`, column)
+
+	err := s.db.QueryRowContext(ctx, query, value).Scan(
+		&tx.ID,
+		&tx.StoreID,
+		&tx.TerminalID,
+		&shiftID,
+		&tx.IdempotencyKey,
+		&tx.PaymentMethod,
+		&paymentReference,
+		&tx.SubtotalCents,
+		&tx.DiscountCents,
+		&tx.TaxRatePercent,
+		&tx.TaxCents,
+		&tx.TotalCents,
+		&tx.CashReceivedCents,
+		&tx.ChangeCents,
+		&tx.Status,
+		&tx.RecommendationShown,
+		&tx.RecommendationAccepted,
+		&recommendationSKU,
+		&tx.ExperimentBucket,
+		&voidReason,
+		&voidedAt,
+		&tx.CreatedAt,
+		&tx.StoreCreditCode,
+		&tx.StoreCreditCents,
+		&tx.CustomerID,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, err
+	}
+	if shiftID.Valid {
+		tx.ShiftID = shiftID.String
+	}
+	if paymentReference.Valid {
+		tx.PaymentReference = paymentReference.String
+	}
+	if recommendationSKU.Valid {
+		tx.RecommendationSKU = recommendationSKU.String
+	}
+	if voidReason.Valid {
+		tx.VoidReason = voidReason.String
+	}
+	if voidedAt.Valid {
+		at := voidedAt.Time.UTC()
+		tx.VoidedAt = &at
+	}
+	tx.CreatedAt = tx.CreatedAt.UTC()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT sku, name, qty, unit_price_cents, unit_cost_cents, margin_rate, tax_rate_percent, taxable_base_cents, tax_cents
+		FROM transaction_items
+		WHERE transaction_id = $1
+		ORDER BY id ASC
+	`, tx.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]domain.TransactionLine, 0, 8)
+	for rows.Next() {
+		var item domain.TransactionLine
+		if err := rows.Scan(&item.SKU, &item.Name, &item.Qty, &item.UnitPriceCents, &item.UnitCostCents, &item.MarginRate, &item.TaxRatePercent, &item.TaxableBaseCents, &item.TaxCents); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	tx.Items = items
+
+	return &tx, nil
+}
+
+func (s *Store) CreateCheckout(ctx context.Context, tx domain.Transaction) (*domain.Transaction, error) {
+	pgTx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = pgTx.Rollback() }()
+
+	created, err := s.createCheckoutTx(ctx, pgTx, tx)
+	if err != nil {
+		if isUniqueViolation(err) {
+			existing, lookupErr := s.FindTransactionByIdempotency(ctx, tx.IdempotencyKey)
+			if lookupErr == nil {
+				return existing, nil
+			}
+		}
+		return nil, err
+	}
+	if err := pgTx.Commit(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// CreateCheckoutBatch persists every sale in one database transaction, so
+// either all of them are stored or none is. A failing sale is reported as a
+// *store.BatchError carrying its index.
+func (s *Store) CreateCheckoutBatch(ctx context.Context, txs []domain.Transaction) ([]*domain.Transaction, error) {
+	pgTx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = pgTx.Rollback() }()
+
+	created := make([]*domain.Transaction, 0, len(txs))
+	for i, tx := range txs {
+		saved, err := s.createCheckoutTx(ctx, pgTx, tx)
+		if err != nil {
+			return nil, &store.BatchError{Index: i, Err: err}
+		}
+		created = append(created, saved)
+	}
+	if err := pgTx.Commit(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// createCheckoutTx validates and stores a sale inside pgTx, recomputing
+// prices and costs and drawing down stock.
+func (s *Store) createCheckoutTx(ctx context.Context, pgTx *sql.Tx, tx domain.Transaction) (*domain.Transaction, error) {
+	if tx.IdempotencyKey == "" {
+		return nil, store.ErrInvalidTransaction
+	}
+	if len(tx.Items) == 0 {
+		return nil, store.ErrEmptyCart
+	}
+
+	skus := uniqueSKUs(tx.Items)
+	if len(skus) == 0 {
+		return nil, store.ErrInvalidTransaction
+	}
+
+	productRows, err := pgTx.QueryContext(ctx, `
+		SELECT p.sku, p.name, p.price_cents, p.margin_rate, p.serialized, p.picking_strategy, p.tax_rate_percent::float8, COALESCE(c.cost_cents, 0)::bigint
+		FROM products p
+		LEFT JOIN product_costs c ON c.store_id = $2 AND c.sku = p.sku
+		WHERE p.active = true AND p.sku = ANY($1)
+	`, skus, tx.StoreID)
+	if err != nil {
+		return nil, err
+	}
+	productMap := make(map[string]domain.Product, len(skus))
+	costMap := make(map[string]int64, len(skus))
+	for productRows.Next() {
+		var sku string
+		var name string
+		var priceCents int64
+		var marginRate float64
+		var serialized bool
+		var strategy string
+		var taxRate *float64
+		var costCents int64
+		if err := productRows.Scan(&sku, &name, &priceCents, &marginRate, &serialized, &strategy, &taxRate, &costCents); err != nil {
+			_ = productRows.Close()
+			return nil, err
+		}
+		productMap[sku] = domain.Product{SKU: sku, Name: name, PriceCents: priceCents, MarginRate: marginRate, Active: true, Serialized: serialized, PickingStrategy: strategy, TaxRatePercent: taxRate}
+		costMap[sku] = costCents
+	}
+	if err := productRows.Err(); err != nil {
+		_ = productRows.Close()
+		return nil, err
+	}
+	_ = productRows.Close()
+
+	stockRows, err := pgTx.QueryContext(ctx, `
+		SELECT sku, qty
+		FROM inventory_stocks
+		WHERE store_id = $1 AND sku = ANY($2)
+		FOR UPDATE
+	`, tx.StoreID, skus)
+	if err != nil {
+		return nil, err
+	}
+	stockMap := make(map[string]int, len(skus))
+	for stockRows.Next() {
+		var sku string
+		var qty int
+		if err := stockRows.Scan(&sku, &qty); err != nil {
+			_ = stockRows.Close()
+			return nil, err
+		}
+		stockMap[sku] = qty
+	}
+	if err := stockRows.Err(); err != nil {
+		_ = stockRows.Close()
+		return nil, err
+	}
+	_ = stockRows.Close()
+
+	subtotalCents := int64(0)
+	recomputedItems := make([]domain.TransactionLine, 0, len(tx.Items))
+	today := nowDateUTC(time.Now().UTC())
+	for _, item := range tx.Items {
+		if item.Qty < 1 {
+			return nil, store.ErrInvalidTransaction
+		}
+
+		product, exists := productMap[item.SKU]
+		if !exists {
+			return nil, fmt.Errorf("%w: sku %s", store.ErrProductUnavailable, item.SKU)
+		}
+
+		stockQty, exists := stockMap[item.SKU]
+		if !s.allowNegativeStock && (!exists || stockQty < item.Qty) {
+			return nil, &store.SKUError{SKU: item.SKU, Err: store.ErrInsufficientStock}
+		}
+		if product.Serialized != (len(item.Serials) > 0) {
+			return nil, store.ErrInvalidSerials
+		}
+		if product.Serialized {
+			if err := takeSerialLotsTx(ctx, pgTx, tx.StoreID, item); err != nil {
+				return nil, err
+			}
+		} else if err := takeLotsTx(ctx, pgTx, tx.StoreID, item, product.PickingStrategy, today, s.allowNegativeStock); err != nil {
+			return nil, err
+		}
+
+		if s.allowNegativeStock {
+			// allow_negative lifts the qty >= 0 check for this row only.
+			_, err = pgTx.ExecContext(ctx, `
+				INSERT INTO inventory_stocks (store_id, sku, qty, allow_negative, updated_at)
+				VALUES ($1,$2,$3,true,now())
+				ON CONFLICT (store_id, sku)
+				DO UPDATE SET qty = inventory_stocks.qty + EXCLUDED.qty, allow_negative = true, updated_at = now()
+			`, tx.StoreID, item.SKU, -item.Qty)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			result, err := pgTx.ExecContext(ctx, `
+				UPDATE inventory_stocks
+				SET qty = qty - $1, allow_negative = false, updated_at = now()
+				WHERE store_id = $2 AND sku = $3 AND qty >= $1
+			`, item.Qty, tx.StoreID, item.SKU)
+			if err != nil {
+				return nil, err
+			}
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return nil, err
+			}
+			if affected == 0 {
+				return nil, &store.SKUError{SKU: item.SKU, Err: store.ErrInsufficientStock}
+			}
+		}
+
+		recomputedItems = append(recomputedItems, domain.TransactionLine{
+			SKU:            item.SKU,
+			Name:           product.Name,
+			Qty:            item.Qty,
+			UnitPriceCents: product.PriceCents,
+			UnitCostCents:  store.SaleUnitCost(product, costMap[item.SKU]),
+			MarginRate:     product.MarginRate,
+			Serials:        item.Serials,
+			TaxRatePercent: store.LineTaxRate(product, tx.TaxRatePercent),
+		})
+		subtotalCents += product.PriceCents * int64(item.Qty)
+	}
+
+	if tx.DiscountCents < 0 || tx.DiscountCents > subtotalCents {
+		return nil, store.ErrInvalidDiscount
+	}
+	if tx.TaxRatePercent < 0 || tx.TaxRatePercent > 100 {
+		return nil, store.ErrInvalidTaxRate
+	}
+
+	taxCents := store.ApplyLineTaxes(recomputedItems, tx.DiscountCents)
+	totalCents := subtotalCents - tx.DiscountCents + taxCents
+
+	if tx.PaymentMethod == "cash" {
+		if tx.CashReceivedCents < totalCents {
+			return nil, store.ErrInsufficientPayment
+		}
+		tx.ChangeCents = tx.CashReceivedCents - totalCents
+	} else {
+		tx.ChangeCents = 0
+	}
+
+	tx.SubtotalCents = subtotalCents
+	tx.TaxCents = taxCents
+	tx.TotalCents = totalCents
+	tx.Items = recomputedItems
+	if tx.ID == "" {
+		tx.ID = xid.New("tx")
+	}
+	if tx.CreatedAt.IsZero() {
+		tx.CreatedAt = time.Now().UTC()
+	}
+	if tx.Status == "" {
+		tx.Status = domain.TxStatusPaid
+	}
+
+	credits := store.CheckoutStoreCredits(&tx)
+	for _, entry := range credits {
+		if entry.Kind != domain.StoreCreditKindRedeem {
+			continue
+		}
+		balance, err := storeCreditBalanceTx(ctx, pgTx, entry.Code)
+		if err != nil {
+			return nil, err
+		}
+		if balance < -entry.AmountCents {
+			return nil, fmt.Errorf("%w: %s", store.ErrInsufficientStoreCredit, entry.Code)
+		}
+	}
+
+	_, err = pgTx.ExecContext(ctx, `
+		INSERT INTO transactions (
+			id, store_id, terminal_id, shift_id, idempotency_key, payment_method,
+			payment_reference, subtotal_cents, discount_cents, tax_rate_percent, tax_cents,
+			total_cents, cash_received_cents, change_cents, status,
+			recommendation_shown, recommendation_accepted, recommendation_sku,
+			void_reason, voided_at, created_at, experiment_bucket,
+			store_credit_code, store_credit_cents, customer_id
+		)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23,$24,$25)
+	`, tx.ID, tx.StoreID, tx.TerminalID, nullIfEmpty(tx.ShiftID), tx.IdempotencyKey, tx.PaymentMethod,
+		nullIfEmpty(tx.PaymentReference), tx.SubtotalCents, tx.DiscountCents, tx.TaxRatePercent,
+		tx.TaxCents, tx.TotalCents, tx.CashReceivedCents, tx.ChangeCents, tx.Status,
+		tx.RecommendationShown, tx.RecommendationAccepted, nullIfEmpty(tx.RecommendationSKU),
+		nullIfEmpty(tx.VoidReason), nullTime(tx.VoidedAt), tx.CreatedAt, tx.ExperimentBucket,
+		nullIfEmpty(tx.StoreCreditCode), tx.StoreCreditCents, nullIfEmpty(tx.CustomerID))
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range credits {
+		entry.ID = xid.New("credit")
+		if err := insertStoreCreditTx(ctx, pgTx, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, item := range tx.Items {
+		_, err := pgTx.ExecContext(ctx, `
+			INSERT INTO transaction_items (transaction_id, sku, name, qty, unit_price_cents, unit_cost_cents, margin_rate, tax_rate_percent, taxable_base_cents, tax_cents)
+			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+		`, tx.ID, item.SKU, item.Name, item.Qty, item.UnitPriceCents, item.UnitCostCents, item.MarginRate, item.TaxRatePercent, item.TaxableBaseCents, item.TaxCents)
+		if err != nil {
+			return nil, err
+		}
+		if err := insertMovementTx(ctx, pgTx, tx.StoreID, item.SKU, -item.Qty, domain.MovementReasonSale, tx.ID, tx.CreatedAt); err != nil {
+			return nil, err
+		}
+		if len(item.Serials) > 0 {
+			_, err = pgTx.ExecContext(ctx, `
+				UPDATE inventory_serials
+				SET status = $4, transaction_id = $1, sold_at = $5
+				WHERE store_id = $2 AND sku = $3 AND serial = ANY($6)
+			`, tx.ID, tx.StoreID, item.SKU, domain.SerialStatusSold, tx.CreatedAt, item.Serials)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &tx, nil
+}
+
+// takeLotsTx draws a checkout line from the SKU's unexpired lots in the
+// product's picking order: earliest expiry first for FEFO, oldest receipt
+// first for FIFO.
+func takeLotsTx(ctx context.Context, pgTx *sql.Tx, storeID string, item domain.TransactionLine, strategy string, today time.Time, allowNegativeStock bool) error {
+	orderBy := "expiry_date ASC NULLS LAST, received_at ASC"
+	if strategy == domain.PickingStrategyFIFO {
+		orderBy = "received_at ASC, id ASC"
+	}
+	lotRows, err := pgTx.QueryContext(ctx, `
+		SELECT id, expiry_date, qty_available
+		FROM inventory_lots
+		WHERE store_id = $1 AND sku = $2 AND qty_available > 0
+		ORDER BY `+orderBy+`
+		FOR UPDATE
+	`, storeID, item.SKU)
+	if err != nil {
+		return err
+	}
+	type lotState struct {
+		id       string
+		expiry   *time.Time
+		available int
+	}
+	lots := make([]lotState, 0, 8)
+	for lotRows.Next() {
+		var lotID string
+		var expiry sql.NullTime
+		var available int
+		if err := lotRows.Scan(&lotID, &expiry, &available); err != nil {
+			_ = lotRows.Close()
+			return err
+		}
+		var expiryDate *time.Time
+		if expiry.Valid {
+			e := nowDateUTC(expiry.Time.UTC())
+			expiryDate = &e
+		}
+		lots = append(lots, lotState{id: lotID, expiry: expiryDate, available: available})
+	}
+	if err := lotRows.Err(); err != nil {
+		_ = lotRows.Close()
+		return err
+	}
+	_ = lotRows.Close()
+	if len(lots) > 0 {
+		availableFromLots := 0
+		for _, lot := range lots {
+			if lot.expiry != nil && lot.expiry.Before(today) {
+				continue
+			}
+			availableFromLots += lot.available
+		}
+		if availableFromLots < item.Qty && !allowNegativeStock {
+			return &store.SKUError{SKU: item.SKU, Err: store.ErrInsufficientStock}
+		}
+		remainingFromLots := item.Qty
+		for _, lot := range lots {
+			if remainingFromLots == 0 {
+				break
+			}
+			if lot.available < 1 {
+				continue
+			}
+			if lot.expiry != nil && lot.expiry.Before(today) {
+				continue
+			}
+			used := remainingFromLots
+			if used > lot.available {
+				used = lot.available
+			}
+			_, err = pgTx.ExecContext(ctx, `
+				UPDATE inventory_lots
+				SET qty_available = qty_available - $1, updated_at = now()
+				WHERE id = $2
+			`, used, lot.id)
+			if err != nil {
+				return err
+			}
+			remainingFromLots -= used
+		}
+		if remainingFromLots > 0 && !allowNegativeStock {
+			return &store.SKUError{SKU: item.SKU, Err: store.ErrInsufficientStock}
+		}
+	}
+	return nil
+}
+
+// takeSerialLotsTx locks the line's serials, checks each one is available in
+// the store and takes one unit from the lot every serial was received in.
+func takeSerialLotsTx(ctx context.Context, pgTx *sql.Tx, storeID string, item domain.TransactionLine) error {
+	if len(item.Serials) != item.Qty {
+		return store.ErrInvalidSerials
+	}
+	rows, err := pgTx.QueryContext(ctx, `
+		SELECT lot_id
+		FROM inventory_serials
+		WHERE store_id = $1 AND sku = $2 AND serial = ANY($3) AND status = $4
+		FOR UPDATE
+	`, storeID, item.SKU, item.Serials, domain.SerialStatusAvailable)
+	if err != nil {
+		return err
+	}
+	found := 0
+	byLot := map[string]int{}
+	for rows.Next() {
+		var lotID string
+		if err := rows.Scan(&lotID); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		byLot[lotID]++
+		found++
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return err
+	}
+	_ = rows.Close()
+	if found != len(item.Serials) {
+		return store.ErrInvalidSerials
+	}
+
+	for lotID, used := range byLot {
+		_, err = pgTx.ExecContext(ctx, `
+			UPDATE inventory_lots
+			SET qty_available = GREATEST(qty_available - $1, 0), updated_at = now()
+			WHERE id = $2
+		`, used, lotID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) VoidTransaction(ctx context.Context, id string, reason string, at time.Time) (*domain.Transaction, error) {
+	pgTx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = pgTx.Rollback() }()
+
+	var tx domain.Transaction
+	err = pgTx.QueryRowContext(ctx, `
+		SELECT id, store_id, status
+		FROM transactions
+		WHERE id = $1
+		FOR UPDATE
+	`, id).Scan(&tx.ID, &tx.StoreID, &tx.Status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, err
+	}
+	if tx.Status != domain.TxStatusPaid {
+		return nil, store.ErrInvalidState
+	}
+
+	itemRows, err := pgTx.QueryContext(ctx, `
+		SELECT sku, qty, unit_cost_cents
+		FROM transaction_items
+		WHERE transaction_id = $1
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]domain.TransactionLine, 0, 8)
+	for itemRows.Next() {
+		var item domain.TransactionLine
+		if err := itemRows.Scan(&item.SKU, &item.Qty, &item.UnitCostCents); err != nil {
+			_ = itemRows.Close()
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := itemRows.Err(); err != nil {
+		_ = itemRows.Close()
+		return nil, err
+	}
+	_ = itemRows.Close()
+
+	_, err = pgTx.ExecContext(ctx, `
+		UPDATE transactions
+		SET status = $2, void_reason = $3, voided_at = $4
+		WHERE id = $1 AND status = $5
+	`, id, domain.TxStatusVoided, reason, at, domain.TxStatusPaid)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		lotID := xid.New("lot")
+		lotCode := "VOID-" + id
+		var currentQty int
+		var prevCost int64
+		err := pgTx.QueryRowContext(ctx, `
+			SELECT
+				COALESCE((SELECT qty FROM inventory_stocks WHERE store_id = $1 AND sku = $2), 0),
+				COALESCE((SELECT cost_cents FROM product_costs WHERE store_id = $1 AND sku = $2), 0)
+		`, tx.StoreID, item.SKU).Scan(&currentQty, &prevCost)
+		if err != nil {
+			return nil, err
+		}
+		unitCost := store.VoidRestockCost(item, prevCost)
+		if unitCost > 0 {
+			_, err = pgTx.ExecContext(ctx, `
+				INSERT INTO product_costs (store_id, sku, cost_cents, updated_at)
+				VALUES ($1,$2,$3,now())
+				ON CONFLICT (store_id, sku)
+				DO UPDATE SET cost_cents = EXCLUDED.cost_cents, updated_at = now()
+			`, tx.StoreID, item.SKU, weightedCostCents(prevCost, currentQty, unitCost, item.Qty))
+			if err != nil {
+				return nil, err
+			}
+		}
+		_, err = pgTx.ExecContext(ctx, `
+			INSERT INTO inventory_stocks (store_id, sku, qty, updated_at)
+			VALUES ($1,$2,$3,now())
+			ON CONFLICT (store_id, sku)
+			DO UPDATE SET qty = inventory_stocks.qty + EXCLUDED.qty, updated_at = now()
+		`, tx.StoreID, item.SKU, item.Qty)
+		if err != nil {
+			return nil, err
+		}
+		if err := insertMovementTx(ctx, pgTx, tx.StoreID, item.SKU, item.Qty, domain.MovementReasonVoid, id, at); err != nil {
+			return nil, err
+		}
+		_, err = pgTx.ExecContext(ctx, `
+			INSERT INTO inventory_lots (
+				id, store_id, sku, lot_code, expiry_date, qty_received, qty_available,
+				cost_cents, source_type, source_id, notes, received_at, updated_at
+			)
+			VALUES ($1,$2,$3,$4,NULL,$5,$6,$7,'void',$8,$9,$10,now())
+		`, lotID, tx.StoreID, item.SKU, lotCode, item.Qty, item.Qty, maxInt64(1, unitCost), id, "auto restock from void", at)
+		if err != nil {
+			return nil, err
+		}
+		_, err = pgTx.ExecContext(ctx, `
+			UPDATE inventory_serials
+			SET status = $1, transaction_id = NULL, sold_at = NULL, lot_id = $2
+			WHERE transaction_id = $3 AND sku = $4
+		`, domain.SerialStatusAvailable, lotID, id, item.SKU)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := reverseStoreCreditsTx(ctx, pgTx, id, at); err != nil {
+		return nil, err
+	}
+
+	if err := pgTx.Commit(); err != nil {
+		return nil, err
+	}
+
+	tx.Status = domain.TxStatusVoided
+	tx.VoidReason = reason
+	tx.VoidedAt = &at
+	return &tx, nil
+}
+
+// reverseStoreCreditsTx adds a void entry per code undoing the store credit
+// a voided sale issued or redeemed.
+func reverseStoreCreditsTx(ctx context.Context, pgTx *sql.Tx, transactionID string, at time.Time) error {
+	rows, err := pgTx.QueryContext(ctx, `
+		SELECT store_id, code, SUM(amount_cents)
+		FROM store_credits
+		WHERE transaction_id = $1
+		GROUP BY store_id, code
+		HAVING SUM(amount_cents) <> 0
+	`, transactionID)
+	if err != nil {
+		return err
+	}
+	var reversals []domain.StoreCreditEntry
+	for rows.Next() {
+		entry := domain.StoreCreditEntry{Kind: domain.StoreCreditKindVoid, TransactionID: transactionID, CreatedAt: at}
+		if err := rows.Scan(&entry.StoreID, &entry.Code, &entry.AmountCents); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		entry.AmountCents = -entry.AmountCents
+		reversals = append(reversals, entry)
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return err
+	}
+	_ = rows.Close()
+
+	for _, entry := range reversals {
+		entry.ID = xid.New("credit")
+		if err := insertStoreCreditTx(ctx, pgTx, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func storeCreditBalanceTx(ctx context.Context, pgTx *sql.Tx, code string) (int64, error) {
+	var balance int64
+	err := pgTx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(amount_cents), 0)
+		FROM store_credits
+		WHERE code = $1
+	`, code).Scan(&balance)
+	return balance, err
+}
+
+func insertStoreCreditTx(ctx context.Context, pgTx *sql.Tx, entry domain.StoreCreditEntry) error {
+	_, err := pgTx.ExecContext(ctx, `
+		INSERT INTO store_credits (id, store_id, code, kind, amount_cents, transaction_id, created_by, created_at)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+	`, entry.ID, entry.StoreID, entry.Code, entry.Kind, entry.AmountCents,
+		nullIfEmpty(entry.TransactionID), nullIfEmpty(entry.CreatedBy), entry.CreatedAt)
+	return err
+}
+
+func (s *Store) GetStoreCreditBalance(ctx context.Context, code string) (*domain.StoreCreditBalance, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, store_id, code, kind, amount_cents, COALESCE(transaction_id, ''), COALESCE(created_by, ''), created_at
+		FROM store_credits
+		WHERE code = $1
+		ORDER BY created_at, id
+	`, code)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balance := domain.StoreCreditBalance{Code: code, Entries: []domain.StoreCreditEntry{}}
+	for rows.Next() {
+		var entry domain.StoreCreditEntry
+		if err := rows.Scan(&entry.ID, &entry.StoreID, &entry.Code, &entry.Kind, &entry.AmountCents, &entry.TransactionID, &entry.CreatedBy, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entry.CreatedAt = entry.CreatedAt.UTC()
+		balance.BalanceCents += entry.AmountCents
+		balance.Entries = append(balance.Entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(balance.Entries) == 0 {
+		return nil, store.ErrNotFound
+	}
+	return &balance, nil
+}
+
+func (s *Store) RedeemStoreCredit(ctx context.Context, storeID string, code string, amountCents int64, createdBy string, at time.Time) (*domain.StoreCreditEntry, error) {
+	if amountCents < 1 {
+		return nil, store.ErrInvalidTransaction
+	}
+
+	pgTx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = pgTx.Rollback() }()
+
+	balance, err := storeCreditBalanceTx(ctx, pgTx, code)
+	if err != nil {
+		return nil, err
+	}
+	if balance < amountCents {
+		return nil, fmt.Errorf("%w: %s", store.ErrInsufficientStoreCredit, code)
+	}
+	entry := domain.StoreCreditEntry{
+		ID:          xid.New("credit"),
+		StoreID:     storeID,
+		Code:        code,
+		Kind:        domain.StoreCreditKindRedeem,
+		AmountCents: -amountCents,
+		CreatedBy:   createdBy,
+		CreatedAt:   at,
+	}
+	if err := insertStoreCreditTx(ctx, pgTx, entry); err != nil {
+		return nil, err
+	}
+	if err := pgTx.Commit(); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (s *Store) CreateRefund(ctx context.Context, refund domain.Refund) (*domain.Refund, error) {
+	if refund.ID == "" {
+		refund.ID = xid.New("refund")
+	}
+	if refund.CreatedAt.IsZero() {
+		refund.CreatedAt = time.Now().UTC()
+	}
+	if refund.Status == "" {
+		refund.Status = domain.TxStatusRefunded
+	}
+
+	pgTx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = pgTx.Rollback() }()
+
+	var transactionTotal int64
+	var transactionStatus string
+	err = pgTx.QueryRowContext(ctx, `
+		SELECT total_cents, status
+		FROM transactions
+		WHERE id = $1
+		FOR UPDATE
+	`, refund.OriginalTransactionID).Scan(&transactionTotal, &transactionStatus)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, err
+	}
+	if transactionStatus == domain.TxStatusVoided || transactionStatus == domain.TxStatusRefunded {
+		return nil, store.ErrInvalidTransaction
+	}
+
+	refundedSoFar := int64(0)
+	rows, err := pgTx.QueryContext(ctx, `
+		SELECT amount_cents
+		FROM refunds
+		WHERE original_transaction_id = $1 AND status = $2
+		FOR UPDATE
+	`, refund.OriginalTransactionID, domain.TxStatusRefunded)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var amount int64
+		if err := rows.Scan(&amount); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		refundedSoFar += amount
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
+	_ = rows.Close()
+
+	remaining := transactionTotal - refundedSoFar
+	if refund.AmountCents > remaining {
+		return nil, store.ErrInvalidTransaction
+	}
+
+	_, err = pgTx.ExecContext(ctx, `
+		INSERT INTO refunds (id, original_transaction_id, reason, amount_cents, status, created_at)
+		VALUES ($1,$2,$3,$4,$5,$6)
+	`, refund.ID, refund.OriginalTransactionID, refund.Reason, refund.AmountCents, refund.Status, refund.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	nextStatus := domain.TxStatusPaid
+	if refundedSoFar+refund.AmountCents >= transactionTotal {
+		nextStatus = domain.TxStatusRefunded
+	}
+
+	_, err = pgTx.ExecContext(ctx, `
+		UPDATE transactions
+		SET status = $2
+		WHERE id = $1
+	`, refund.OriginalTransactionID, nextStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pgTx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &refund, nil
+}
+
+func (s *Store) GetReturnedQtyByTransaction(ctx context.Context, transactionID string) (map[string]int, error) {
+	result := make(map[string]int)
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT iri.sku, COALESCE(SUM(iri.qty), 0)::int
+		FROM item_returns ir
+		JOIN item_return_items iri ON iri.item_return_id = ir.id
+		WHERE ir.original_transaction_id = $1 AND iri.kind = 'return'
+		GROUP BY iri.sku
+	`, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sku string
+		var qty int
+		if err := rows.Scan(&sku, &qty); err != nil {
+			return nil, err
+		}
+		result[sku] = qty
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *Store) CreateItemReturn(ctx context.Context, itemReturn domain.ItemReturn) (*domain.ItemReturn, error) {
+	if itemReturn.ID == "" {
+		itemReturn.ID = xid.New("ret")
+	}
+	if itemReturn.CreatedAt.IsZero() {
+		itemReturn.CreatedAt = time.Now().UTC()
+	}
+	if strings.TrimSpace(itemReturn.OriginalTransactionID) == "" || len(itemReturn.ReturnItems) == 0 {
+		return nil, store.ErrInvalidTransaction
+	}
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO item_returns (
 			id, store_id, original_transaction_id, mode, reason, refund_amount_cents,
 			exchange_transaction_id, additional_payment_cents, processed_by, created_at
 		)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
-	`, itemReturn.ID, itemReturn.StoreID, itemReturn.OriginalTransactionID, itemReturn.Mode, itemReturn.Reason, itemReturn.RefundAmountCents, nullIfEmpty(itemReturn.ExchangeTransactionID), itemReturn.AdditionalPaymentCents, itemReturn.ProcessedBy, itemReturn.CreatedAt)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+	`, itemReturn.ID, itemReturn.StoreID, itemReturn.OriginalTransactionID, itemReturn.Mode, itemReturn.Reason, itemReturn.RefundAmountCents, nullIfEmpty(itemReturn.ExchangeTransactionID), itemReturn.AdditionalPaymentCents, itemReturn.ProcessedBy, itemReturn.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range itemReturn.ReturnItems {
+		if line.Qty < 1 {
+			return nil, store.ErrInvalidTransaction
+		}
+		if line.UnitPriceCents < 1 {
+			return nil, store.ErrInvalidTransaction
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO item_return_items (item_return_id, sku, qty, unit_price_cents, kind)
+			VALUES ($1,$2,$3,$4,'return')
+		`, itemReturn.ID, line.SKU, line.Qty, line.UnitPriceCents)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, line := range itemReturn.ExchangeItems {
+		if line.Qty < 1 {
+			return nil, store.ErrInvalidTransaction
+		}
+		if line.UnitPriceCents < 1 {
+			return nil, store.ErrInvalidTransaction
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO item_return_items (item_return_id, sku, qty, unit_price_cents, kind)
+			VALUES ($1,$2,$3,$4,'exchange')
+		`, itemReturn.ID, line.SKU, line.Qty, line.UnitPriceCents)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	created := itemReturn
+	return &created, nil
+}
+
+func (s *Store) CreateRecommendationEvent(ctx context.Context, event domain.RecommendationEvent) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO recommendation_events (
+			id, store_id, terminal_id, transaction_id,
+			sku, action, reason_code, confidence, latency_ms, created_at, experiment_bucket, clock_skew
+		)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+	`,
+		xid.New("reco"),
+		event.StoreID,
+		event.TerminalID,
+		nullIfEmpty(event.TransactionID),
+		nullIfEmpty(event.SKU),
+		event.Action,
+		nullIfEmpty(event.ReasonCode),
+		event.Confidence,
+		event.LatencyMS,
+		event.CreatedAt,
+		event.ExperimentBucket,
+		event.ClockSkew,
+	)
+	return err
+}
+
+func (s *Store) CreateRecommendationEventsBatch(ctx context.Context, events []domain.RecommendationEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	pgTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = pgTx.Rollback() }()
+
+	stmt, err := pgTx.PrepareContext(ctx, `
+		INSERT INTO recommendation_events (
+			id, store_id, terminal_id, transaction_id,
+			sku, action, reason_code, confidence, latency_ms, created_at, experiment_bucket, clock_skew
+		)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, event := range events {
+		if _, err := stmt.ExecContext(ctx,
+			xid.New("reco"),
+			event.StoreID,
+			event.TerminalID,
+			nullIfEmpty(event.TransactionID),
+			nullIfEmpty(event.SKU),
+			event.Action,
+			nullIfEmpty(event.ReasonCode),
+			event.Confidence,
+			event.LatencyMS,
+			event.CreatedAt,
+			event.ExperimentBucket,
+			event.ClockSkew,
+		); err != nil {
+			return err
+		}
+	}
+	return pgTx.Commit()
+}
+
+func (s *Store) GetAttachMetrics(ctx context.Context, storeID string, from time.Time, to time.Time) (domain.AttachMetrics, error) {
+	var metrics domain.AttachMetrics
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*)::bigint,
+			COALESCE(SUM(CASE WHEN recommendation_accepted THEN 1 ELSE 0 END),0)::bigint
+		FROM transactions
+		WHERE store_id = $1 AND created_at BETWEEN $2 AND $3 AND status <> $4
+	`, storeID, from, to, domain.TxStatusVoided).Scan(&metrics.Transactions, &metrics.Accepted)
+	if err != nil {
+		return metrics, err
+	}
+
+	if metrics.Transactions > 0 {
+		metrics.AttachRate = (float64(metrics.Accepted) / float64(metrics.Transactions)) * 100
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			experiment_bucket,
+			COUNT(*)::bigint,
+			COALESCE(SUM(CASE WHEN recommendation_accepted THEN 1 ELSE 0 END),0)::bigint
+		FROM transactions
+		WHERE store_id = $1 AND created_at BETWEEN $2 AND $3 AND status <> $4 AND experiment_bucket <> ''
+		GROUP BY experiment_bucket
+		ORDER BY experiment_bucket
+	`, storeID, from, to, domain.TxStatusVoided)
+	if err != nil {
+		return metrics, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bucket domain.AttachBucketMetrics
+		if err := rows.Scan(&bucket.Bucket, &bucket.Transactions, &bucket.Accepted); err != nil {
+			return metrics, err
+		}
+		bucket.AttachRate = (float64(bucket.Accepted) / float64(bucket.Transactions)) * 100
+		metrics.ByBucket = append(metrics.ByBucket, bucket)
+	}
+	if err := rows.Err(); err != nil {
+		return metrics, err
+	}
+
+	return metrics, nil
+}
+
+func (s *Store) GetAttachMetricsByReason(ctx context.Context, storeID string, from time.Time, to time.Time) ([]domain.AttachReasonMetrics, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			reason_code,
+			COALESCE(SUM(CASE WHEN action = $4 THEN 1 ELSE 0 END),0)::bigint,
+			COALESCE(SUM(CASE WHEN action = $5 THEN 1 ELSE 0 END),0)::bigint
+		FROM recommendation_events
+		WHERE store_id = $1 AND created_at BETWEEN $2 AND $3 AND reason_code <> ''
+			AND action IN ($4, $5)
+		GROUP BY reason_code
+		ORDER BY reason_code
+	`, storeID, from, to, domain.RecommendationShownAction, domain.RecommendationAcceptedAction)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]domain.AttachReasonMetrics, 0, 8)
+	for rows.Next() {
+		var row domain.AttachReasonMetrics
+		if err := rows.Scan(&row.ReasonCode, &row.Shown, &row.Accepted); err != nil {
+			return nil, err
+		}
+		if row.Shown > 0 {
+			row.AttachRate = (float64(row.Accepted) / float64(row.Shown)) * 100
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// lineUnitCostSQL is the cost frozen on a transaction_items row (alias ti).
+// Rows recorded before unit_cost_cents existed fall back to the estimate
+// derived from their margin_rate.
+const lineUnitCostSQL = `(CASE WHEN ti.unit_cost_cents > 0 THEN ti.unit_cost_cents
+			WHEN ti.unit_price_cents < 1 THEN 0
+			ELSE GREATEST(ROUND(ti.unit_price_cents * (1 - ti.margin_rate)), 1) END)`
+
+func (s *Store) GetDailyReport(ctx context.Context, storeID string, from time.Time, to time.Time) (domain.DailyReport, error) {
+	report := domain.DailyReport{
+		StoreID:    storeID,
+		ByPayment:  make([]domain.DailyReportPayment, 0, 4),
+		ByTerminal: make([]domain.DailyReportTerminal, 0, 8),
+		ByTaxRate:  make([]domain.TaxRateTotal, 0, 2),
+	}
+
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*)::bigint,
+			COALESCE(SUM(subtotal_cents),0)::bigint,
+			COALESCE(SUM(discount_cents),0)::bigint,
+			COALESCE(SUM(tax_cents),0)::bigint,
+			COALESCE(SUM(total_cents),0)::bigint
+		FROM transactions
+		WHERE store_id = $1
+			AND created_at >= $2
+			AND created_at < $3
+			AND status <> $4
+	`, storeID, from, to, domain.TxStatusVoided).Scan(
+		&report.Transactions,
+		&report.GrossSalesCents,
+		&report.DiscountCents,
+		&report.TaxCents,
+		&report.NetSalesCents,
+	)
+	if err != nil {
+		return report, err
+	}
+
+	var refundedCents int64
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(r.amount_cents),0)::bigint
+		FROM refunds r
+		JOIN transactions t ON t.id = r.original_transaction_id
+		WHERE t.store_id = $1
+			AND r.created_at >= $2
+			AND r.created_at < $3
+			AND r.status = $4
+	`, storeID, from, to, domain.TxStatusRefunded).Scan(&refundedCents)
+	if err != nil {
+		return report, err
+	}
+	if refundedCents > 0 {
+		report.NetSalesCents -= refundedCents
+		if report.NetSalesCents < 0 {
+			report.NetSalesCents = 0
+		}
+	}
+
+	err = s.db.QueryRowContext(ctx, `
+		SELECT
+			COALESCE(SUM((ti.unit_price_cents - `+lineUnitCostSQL+`) * ti.qty),0)::bigint,
+			COALESCE(SUM(`+lineUnitCostSQL+` * ti.qty),0)::bigint
+		FROM transaction_items ti
+		JOIN transactions t ON t.id = ti.transaction_id
+		WHERE t.store_id = $1
+			AND t.created_at >= $2
+			AND t.created_at < $3
+			AND t.status <> $4
+	`, storeID, from, to, domain.TxStatusVoided).Scan(&report.EstimatedMarginCents, &report.CostOfGoodsCents)
+	if err != nil {
+		return report, err
+	}
+
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(cost_cents),0)::bigint
+		FROM stock_adjustments
+		WHERE store_id = $1
+			AND adjustment_type = 'write_off'
+			AND created_at >= $2
+			AND created_at < $3
+	`, storeID, from, to).Scan(&report.WriteOffCostCents)
+	if err != nil {
+		return report, err
+	}
+
+	paymentRows, err := s.db.QueryContext(ctx, `
+		SELECT payment_method, COUNT(*)::bigint, COALESCE(SUM(total_cents),0)::bigint
+		FROM transactions
+		WHERE store_id = $1
+			AND created_at >= $2
+			AND created_at < $3
+			AND status <> $4
+		GROUP BY payment_method
+		ORDER BY payment_method
+	`, storeID, from, to, domain.TxStatusVoided)
+	if err != nil {
+		return report, err
+	}
+	for paymentRows.Next() {
+		var row domain.DailyReportPayment
+		if err := paymentRows.Scan(&row.PaymentMethod, &row.Transactions, &row.TotalCents); err != nil {
+			_ = paymentRows.Close()
+			return report, err
+		}
+		report.ByPayment = append(report.ByPayment, row)
+	}
+	if err := paymentRows.Err(); err != nil {
+		_ = paymentRows.Close()
+		return report, err
+	}
+	_ = paymentRows.Close()
+
+	terminalRows, err := s.db.QueryContext(ctx, `
+		SELECT terminal_id, COUNT(*)::bigint, COALESCE(SUM(total_cents),0)::bigint
+		FROM transactions
+		WHERE store_id = $1
+			AND created_at >= $2
+			AND created_at < $3
+			AND status <> $4
+		GROUP BY terminal_id
+		ORDER BY terminal_id
+	`, storeID, from, to, domain.TxStatusVoided)
+	if err != nil {
+		return report, err
+	}
+	for terminalRows.Next() {
+		var row domain.DailyReportTerminal
+		if err := terminalRows.Scan(&row.TerminalID, &row.Transactions, &row.TotalCents); err != nil {
+			_ = terminalRows.Close()
+			return report, err
+		}
+		report.ByTerminal = append(report.ByTerminal, row)
+	}
+	if err := terminalRows.Err(); err != nil {
+		_ = terminalRows.Close()
+		return report, err
+	}
+	_ = terminalRows.Close()
+
+	taxRows, err := s.db.QueryContext(ctx, `
+		SELECT ti.tax_rate_percent::float8, COALESCE(SUM(ti.taxable_base_cents),0)::bigint, COALESCE(SUM(ti.tax_cents),0)::bigint
+		FROM transaction_items ti
+		JOIN transactions t ON t.id = ti.transaction_id
+		WHERE t.store_id = $1
+			AND t.created_at >= $2
+			AND t.created_at < $3
+			AND t.status <> $4
+		GROUP BY ti.tax_rate_percent
+		ORDER BY ti.tax_rate_percent
+	`, storeID, from, to, domain.TxStatusVoided)
+	if err != nil {
+		return report, err
+	}
+	defer taxRows.Close()
+	for taxRows.Next() {
+		var row domain.TaxRateTotal
+		if err := taxRows.Scan(&row.RatePercent, &row.TaxableBaseCents, &row.TaxCents); err != nil {
+			return report, err
+		}
+		report.ByTaxRate = append(report.ByTaxRate, row)
+	}
+	return report, taxRows.Err()
+}
+
+func (s *Store) GetHourlySales(ctx context.Context, storeID string, from time.Time, to time.Time, loc *time.Location) ([]domain.HourlySalesBucket, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			EXTRACT(hour FROM created_at AT TIME ZONE $5)::int AS hour,
+			COUNT(*)::bigint,
+			COALESCE(SUM(total_cents),0)::bigint
+		FROM transactions
+		WHERE store_id = $1
+			AND created_at >= $2
+			AND created_at < $3
+			AND status <> $4
+		GROUP BY hour
+		ORDER BY hour
+	`, storeID, from, to, domain.TxStatusVoided, loc.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]domain.HourlySalesBucket, 0, 24)
+	for rows.Next() {
+		var row domain.HourlySalesBucket
+		if err := rows.Scan(&row.Hour, &row.Transactions, &row.TotalCents); err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+func (s *Store) GetUnitsSoldBySKU(ctx context.Context, storeID string, skus []string, from time.Time, to time.Time) (map[string]int, error) {
+	units := make(map[string]int, len(skus))
+	if len(skus) == 0 {
+		return units, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT ti.sku, COALESCE(SUM(ti.qty),0)::bigint
+		FROM transaction_items ti
+		JOIN transactions t ON t.id = ti.transaction_id
+		WHERE t.store_id = $1
+			AND t.created_at >= $2
+			AND t.created_at < $3
+			AND t.status <> $4
+			AND ti.sku = ANY($5)
+		GROUP BY ti.sku
+	`, storeID, from, to, domain.TxStatusVoided, skus)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sku string
+		var qty int64
+		if err := rows.Scan(&sku, &qty); err != nil {
+			return nil, err
+		}
+		units[sku] = int(qty)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return units, nil
+}
+
+func (s *Store) GetRangeReport(ctx context.Context, storeID string, from time.Time, to time.Time, groupBy string, loc *time.Location) ([]domain.RangeReportBucket, error) {
+	switch groupBy {
+	case domain.ReportGroupByDay, domain.ReportGroupByWeek, domain.ReportGroupByMonth:
+	default:
+		return nil, store.ErrInvalidTransaction
+	}
+
+	buckets := map[string]*domain.RangeReportBucket{}
+	order := make([]string, 0)
+	bucketFor := func(periodStart time.Time) *domain.RangeReportBucket {
+		key := periodStart.Format("2006-01-02")
+		bucket := buckets[key]
+		if bucket == nil {
+			bucket = &domain.RangeReportBucket{PeriodStart: key}
+			buckets[key] = bucket
+			order = append(order, key)
+		}
+		return bucket
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			date_trunc($5, created_at AT TIME ZONE $6) AS period_start,
+			COUNT(*)::bigint,
+			COALESCE(SUM(subtotal_cents),0)::bigint,
+			COALESCE(SUM(discount_cents),0)::bigint,
+			COALESCE(SUM(tax_cents),0)::bigint,
+			COALESCE(SUM(total_cents),0)::bigint
+		FROM transactions
+		WHERE store_id = $1
+			AND created_at >= $2
+			AND created_at < $3
+			AND status <> $4
+		GROUP BY period_start
+		ORDER BY period_start
+	`, storeID, from, to, domain.TxStatusVoided, groupBy, loc.String())
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var periodStart time.Time
+		var row domain.RangeReportBucket
+		if err := rows.Scan(&periodStart, &row.Transactions, &row.GrossSalesCents, &row.DiscountCents, &row.TaxCents, &row.NetSalesCents); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		bucket := bucketFor(periodStart)
+		row.PeriodStart = bucket.PeriodStart
+		*bucket = row
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
+	_ = rows.Close()
+
+	refundRows, err := s.db.QueryContext(ctx, `
+		SELECT date_trunc($5, r.created_at AT TIME ZONE $6) AS period_start, COALESCE(SUM(r.amount_cents),0)::bigint
+		FROM refunds r
+		JOIN transactions t ON t.id = r.original_transaction_id
+		WHERE t.store_id = $1
+			AND r.created_at >= $2
+			AND r.created_at < $3
+			AND r.status = $4
+		GROUP BY period_start
+	`, storeID, from, to, domain.TxStatusRefunded, groupBy, loc.String())
+	if err != nil {
+		return nil, err
+	}
+	for refundRows.Next() {
+		var periodStart time.Time
+		var refundedCents int64
+		if err := refundRows.Scan(&periodStart, &refundedCents); err != nil {
+			_ = refundRows.Close()
+			return nil, err
+		}
+		bucket := bucketFor(periodStart)
+		bucket.NetSalesCents -= refundedCents
+		if bucket.NetSalesCents < 0 {
+			bucket.NetSalesCents = 0
+		}
+	}
+	if err := refundRows.Err(); err != nil {
+		_ = refundRows.Close()
+		return nil, err
+	}
+	_ = refundRows.Close()
+
+	marginRows, err := s.db.QueryContext(ctx, `
+		SELECT
+			date_trunc($5, t.created_at AT TIME ZONE $6) AS period_start,
+			COALESCE(SUM((ti.unit_price_cents - `+lineUnitCostSQL+`) * ti.qty),0)::bigint
+		FROM transaction_items ti
+		JOIN transactions t ON t.id = ti.transaction_id
+		WHERE t.store_id = $1
+			AND t.created_at >= $2
+			AND t.created_at < $3
+			AND t.status <> $4
+		GROUP BY period_start
+	`, storeID, from, to, domain.TxStatusVoided, groupBy, loc.String())
+	if err != nil {
+		return nil, err
+	}
+	for marginRows.Next() {
+		var periodStart time.Time
+		var marginCents int64
+		if err := marginRows.Scan(&periodStart, &marginCents); err != nil {
+			_ = marginRows.Close()
+			return nil, err
+		}
+		bucketFor(periodStart).EstimatedMarginCents = marginCents
+	}
+	if err := marginRows.Err(); err != nil {
+		_ = marginRows.Close()
+		return nil, err
+	}
+	_ = marginRows.Close()
+
+	sort.Strings(order)
+	result := make([]domain.RangeReportBucket, 0, len(order))
+	for _, key := range order {
+		result = append(result, *buckets[key])
+	}
+	return result, nil
+}
+
+func (s *Store) GetInventoryValuation(ctx context.Context, storeID string) ([]domain.InventoryValuationLine, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT i.sku, p.category, i.qty, COALESCE(c.cost_cents, 0)::bigint
+		FROM inventory_stocks i
+		JOIN products p ON p.sku = i.sku
+		LEFT JOIN product_costs c ON c.store_id = i.store_id AND c.sku = i.sku
+		WHERE i.store_id = $1 AND i.qty > 0
+		ORDER BY i.sku
+	`, storeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := make([]domain.InventoryValuationLine, 0, 64)
+	for rows.Next() {
+		var line domain.InventoryValuationLine
+		if err := rows.Scan(&line.SKU, &line.Category, &line.Qty, &line.UnitCostCents); err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+func (s *Store) GetSalesBySupplier(ctx context.Context, storeID string, from time.Time, to time.Time) ([]domain.SupplierSalesLine, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		WITH sales AS (
+			SELECT
+				ti.sku,
+				SUM(ti.qty)::bigint AS units,
+				SUM(ti.unit_price_cents * ti.qty)::bigint AS revenue_cents,
+				SUM((ti.unit_price_cents - `+lineUnitCostSQL+`) * ti.qty)::bigint AS margin_cents
+			FROM transaction_items ti
+			JOIN transactions t ON t.id = ti.transaction_id
+			WHERE t.store_id = $1
+				AND t.created_at >= $2
+				AND t.created_at < $3
+				AND t.status <> $4
+			GROUP BY ti.sku
+		)
+		SELECT
+			COALESCE(src.supplier_id, ''),
+			COALESCE(sup.name, ''),
+			COUNT(*)::bigint,
+			SUM(sales.units)::bigint,
+			SUM(sales.revenue_cents)::bigint,
+			SUM(sales.margin_cents)::bigint
+		FROM sales
+		LEFT JOIN LATERAL (
+			SELECT candidates.supplier_id
+			FROM (
+				SELECT po.supplier_id, 0 AS priority, po.received_at AS at, po.id AS tiebreak
+				FROM purchase_orders po
+				JOIN purchase_order_items poi ON poi.purchase_order_id = po.id
+				WHERE po.store_id = $1
+					AND po.status = 'received'
+					AND po.received_at IS NOT NULL
+					AND poi.sku = sales.sku
+				UNION ALL
+				SELECT sp.supplier_id, 1, sp.updated_at, sp.supplier_id
+				FROM supplier_products sp
+				WHERE sp.sku = sales.sku
+			) candidates
+			ORDER BY candidates.priority, candidates.at DESC, candidates.tiebreak DESC
+			LIMIT 1
+		) src ON true
+		LEFT JOIN suppliers sup ON sup.id = src.supplier_id
+		GROUP BY 1, 2
+		ORDER BY 5 DESC, 1
+	`, storeID, from, to, domain.TxStatusVoided)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := make([]domain.SupplierSalesLine, 0)
+	for rows.Next() {
+		var line domain.SupplierSalesLine
+		var skus int64
+		if err := rows.Scan(&line.SupplierID, &line.SupplierName, &skus, &line.Units, &line.RevenueCents, &line.MarginCents); err != nil {
+			return nil, err
+		}
+		line.SKUs = int(skus)
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+func (s *Store) CreateAuditLog(ctx context.Context, entry domain.AuditLog) error {
+	if entry.ID == "" {
+		entry.ID = xid.New("audit")
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now().UTC()
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO audit_logs (
+			id, store_id, actor_username, actor_role, action, entity_type, entity_id, detail, created_at
+		)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+	`, entry.ID, entry.StoreID, entry.ActorUsername, entry.ActorRole, entry.Action, entry.EntityType, entry.EntityID, entry.Detail, entry.CreatedAt)
+	return err
+}
+
+func (s *Store) ListAuditLogs(ctx context.Context, storeID string, from time.Time, to time.Time, filter domain.AuditLogFilter, before *domain.AuditLogCursor, limit int) ([]domain.AuditLog, error) {
+	if limit < 1 {
+		limit = 100
+	}
+	var beforeAt any
+	beforeID := ""
+	actions := filter.Actions
+	if actions == nil {
+		actions = []string{}
+	}
+	if before != nil {
+		beforeAt = before.CreatedAt
+		beforeID = before.ID
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, store_id, actor_username, actor_role, action, entity_type, entity_id, detail, created_at
+		FROM audit_logs
+		WHERE store_id = $1
+			AND created_at >= $2
+			AND created_at < $3
+			AND ($4::timestamptz IS NULL OR (created_at, id) < ($4::timestamptz, $5))
+			AND (cardinality($6::text[]) = 0 OR action = ANY($6::text[]))
+			AND ($7 = '' OR actor_username = $7)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $8
+	`, storeID, from, to, beforeAt, beforeID, actions, filter.Actor, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := make([]domain.AuditLog, 0, limit)
+	for rows.Next() {
+		var entry domain.AuditLog
+		if err := rows.Scan(&entry.ID, &entry.StoreID, &entry.ActorUsername, &entry.ActorRole, &entry.Action, &entry.EntityType, &entry.EntityID, &entry.Detail, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entry.CreatedAt = entry.CreatedAt.UTC()
+		logs = append(logs, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+func (s *Store) CreateShift(ctx context.Context, shift domain.Shift) (*domain.Shift, error) {
+	if strings.TrimSpace(shift.StoreID) == "" || strings.TrimSpace(shift.TerminalID) == "" || strings.TrimSpace(shift.CashierName) == "" {
+		return nil, store.ErrInvalidTransaction
+	}
+	if shift.ID == "" {
+		shift.ID = xid.New("shift")
+	}
+	if shift.OpenedAt.IsZero() {
+		shift.OpenedAt = time.Now().UTC()
+	}
+	shift.Status = domain.ShiftStatusOpen
+	shift.ClosedAt = nil
+	shift.ClosingCashCents = 0
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO shifts (
+			id, store_id, terminal_id, cashier_name, opening_float_cents,
+			closing_cash_cents, status, opened_at, closed_at, opened_by, notes
+		)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
+	`, shift.ID, shift.StoreID, shift.TerminalID, shift.CashierName, shift.OpeningFloatCents,
+		shift.ClosingCashCents, shift.Status, shift.OpenedAt, nullTime(shift.ClosedAt), shift.OpenedBy, shift.Notes)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, store.ErrShiftAlreadyOpen
+		}
+		return nil, err
+	}
+	saved := shift
+	return &saved, nil
+}
+
+func (s *Store) CloseActiveShift(ctx context.Context, storeID string, terminalID string, closingCashCents int64, closedAt time.Time) (*domain.Shift, error) {
+	if strings.TrimSpace(storeID) == "" || strings.TrimSpace(terminalID) == "" {
+		return nil, store.ErrInvalidTransaction
+	}
+	if closedAt.IsZero() {
+		closedAt = time.Now().UTC()
+	}
+
+	var shift domain.Shift
+	var closedAtNull sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE shifts
+		SET status = 'closed', closing_cash_cents = $3, closed_at = $4
+		WHERE store_id = $1 AND terminal_id = $2 AND status = 'open'
+		RETURNING id, store_id, terminal_id, cashier_name, opening_float_cents,
+			closing_cash_cents, status, opened_at, closed_at, opened_by, notes
+	`, storeID, terminalID, closingCashCents, closedAt).Scan(
+		&shift.ID,
+		&shift.StoreID,
+		&shift.TerminalID,
+		&shift.CashierName,
+		&shift.OpeningFloatCents,
+		&shift.ClosingCashCents,
+		&shift.Status,
+		&shift.OpenedAt,
+		&closedAtNull,
+		&shift.OpenedBy,
+		&shift.Notes,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, err
+	}
+	shift.OpenedAt = shift.OpenedAt.UTC()
+	if closedAtNull.Valid {
+		at := closedAtNull.Time.UTC()
+		shift.ClosedAt = &at
+	}
+	return &shift, nil
+}
+
+func (s *Store) GetActiveShift(ctx context.Context, storeID string, terminalID string) (*domain.Shift, error) {
+	var shift domain.Shift
+	var closedAtNull sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, store_id, terminal_id, cashier_name, opening_float_cents,
+			closing_cash_cents, status, opened_at, closed_at, opened_by, notes
+		FROM shifts
+		WHERE store_id = $1 AND terminal_id = $2 AND status = 'open'
+		ORDER BY opened_at DESC
+		LIMIT 1
+	`, storeID, terminalID).Scan(
+		&shift.ID,
+		&shift.StoreID,
+		&shift.TerminalID,
+		&shift.CashierName,
+		&shift.OpeningFloatCents,
+		&shift.ClosingCashCents,
+		&shift.Status,
+		&shift.OpenedAt,
+		&closedAtNull,
+		&shift.OpenedBy,
+		&shift.Notes,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, err
+	}
+	shift.OpenedAt = shift.OpenedAt.UTC()
+	if closedAtNull.Valid {
+		at := closedAtNull.Time.UTC()
+		shift.ClosedAt = &at
+	}
+	return &shift, nil
+}
+
+func (s *Store) GetShift(ctx context.Context, shiftID string) (*domain.Shift, error) {
+	var shift domain.Shift
+	var closedAtNull sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, store_id, terminal_id, cashier_name, opening_float_cents,
+			closing_cash_cents, status, opened_at, closed_at, opened_by, notes
+		FROM shifts
+		WHERE id = $1
+	`, shiftID).Scan(
+		&shift.ID,
+		&shift.StoreID,
+		&shift.TerminalID,
+		&shift.CashierName,
+		&shift.OpeningFloatCents,
+		&shift.ClosingCashCents,
+		&shift.Status,
+		&shift.OpenedAt,
+		&closedAtNull,
+		&shift.OpenedBy,
+		&shift.Notes,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, err
+	}
+	shift.OpenedAt = shift.OpenedAt.UTC()
+	if closedAtNull.Valid {
+		at := closedAtNull.Time.UTC()
+		shift.ClosedAt = &at
+	}
+	return &shift, nil
+}
+
+func (s *Store) UpdateOpenShift(ctx context.Context, shiftID string, openingFloatCents int64, notes string) (*domain.Shift, error) {
+	var shift domain.Shift
+	var closedAtNull sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE shifts
+		SET opening_float_cents = $2, notes = $3
+		WHERE id = $1 AND status = 'open'
+		RETURNING id, store_id, terminal_id, cashier_name, opening_float_cents,
+			closing_cash_cents, status, opened_at, closed_at, opened_by, notes
+	`, shiftID, openingFloatCents, notes).Scan(
+		&shift.ID,
+		&shift.StoreID,
+		&shift.TerminalID,
+		&shift.CashierName,
+		&shift.OpeningFloatCents,
+		&shift.ClosingCashCents,
+		&shift.Status,
+		&shift.OpenedAt,
+		&closedAtNull,
+		&shift.OpenedBy,
+		&shift.Notes,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := s.GetShift(ctx, shiftID); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %s", store.ErrShiftClosed, shiftID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	shift.OpenedAt = shift.OpenedAt.UTC()
+	if closedAtNull.Valid {
+		at := closedAtNull.Time.UTC()
+		shift.ClosedAt = &at
+	}
+	return &shift, nil
+}
+
+func (s *Store) ListShifts(ctx context.Context, storeID string, terminalID string, from time.Time, to time.Time, limit int) ([]domain.Shift, error) {
+	if limit < 1 {
+		limit = 100
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, store_id, terminal_id, cashier_name, opening_float_cents,
+			closing_cash_cents, status, opened_at, closed_at, opened_by, notes
+		FROM shifts
+		WHERE store_id = $1
+			AND ($2 = '' OR terminal_id = $2)
+			AND opened_at >= $3
+			AND opened_at < $4
+		ORDER BY opened_at DESC
+		LIMIT $5
+	`, storeID, terminalID, from, to, limit)
 	if err != nil {
 		return nil, err
 	}
-	for _, line := range itemReturn.ReturnItems {
-		if line.Qty < 1 {
-			return nil, store.ErrInvalidTransaction
-		}
-		if line.UnitPriceCents < 1 {
-			return nil, store.ErrInvalidTransaction
-		}
-		_, err = tx.ExecContext(ctx, `
-			INSERT INTO item_return_items (item_return_id, sku, qty, unit_price_cents, kind)
-			VALUES ($1,$2,$3,$4,'return')
-		`, itemReturn.ID, line.SKU, line.Qty, line.UnitPriceCents)
-		if err != nil {
+	defer rows.Close()
+
+	shifts := make([]domain.Shift, 0, limit)
+	for rows.Next() {
+		var shift domain.Shift
+		var closedAtNull sql.NullTime
+		if err := rows.Scan(
+			&shift.ID,
+			&shift.StoreID,
+			&shift.TerminalID,
+			&shift.CashierName,
+			&shift.OpeningFloatCents,
+			&shift.ClosingCashCents,
+			&shift.Status,
+			&shift.OpenedAt,
+			&closedAtNull,
+			&shift.OpenedBy,
+			&shift.Notes,
+		); err != nil {
 			return nil, err
 		}
-	}
-	for _, line := range itemReturn.ExchangeItems {
-		if line.Qty < 1 {
-			return nil, store.ErrInvalidTransaction
-		}
-		if line.UnitPriceCents < 1 {
-			return nil, store.ErrInvalidTransaction
-		}
-		_, err = tx.ExecContext(ctx, `
-			INSERT INTO item_return_items (item_return_id, sku, qty, unit_price_cents, kind)
-			VALUES ($1,$2,$3,$4,'exchange')
-		`, itemReturn.ID, line.SKU, line.Qty, line.UnitPriceCents)
-		if err != nil {
-			return nil, err
+		shift.OpenedAt = shift.OpenedAt.UTC()
+		if closedAtNull.Valid {
+			at := closedAtNull.Time.UTC()
+			shift.ClosedAt = &at
 		}
+		shifts = append(shifts, shift)
 	}
-	if err := tx.Commit(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	created := itemReturn
-	return &created, nil
-}
-
-func (s *Store) CreateRecommendationEvent(ctx context.Context, event domain.RecommendationEvent) error {
-	_, err := s.db.ExecContext(ctx, `
-		INSERT INTO recommendation_events (
-			id, store_id, terminal_id, transaction_id,
-			sku, action, reason_code, confidence, latency_ms, created_at
-		)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
-	`,
-		xid.New("reco"),
-		event.StoreID,
-		event.TerminalID,
-		nullIfEmpty(event.TransactionID),
-		nullIfEmpty(event.SKU),
-		event.Action,
-		nullIfEmpty(event.ReasonCode),
-		event.Confidence,
-		event.LatencyMS,
-		event.CreatedAt,
-	)
-	return err
+	return shifts, nil
 }
 
-func (s *Store) GetAttachMetrics(ctx context.Context, storeID string, from time.Time, to time.Time) (domain.AttachMetrics, error) {
-	var metrics domain.AttachMetrics
-	err := s.db.QueryRowContext(ctx, `
-		SELECT
-			COUNT(*)::bigint,
-			COALESCE(SUM(CASE WHEN recommendation_accepted THEN 1 ELSE 0 END),0)::bigint
+func (s *Store) ListShiftTransactions(ctx context.Context, shiftID string) ([]domain.Transaction, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, store_id, terminal_id, payment_method, COALESCE(payment_reference, ''),
+			total_cents, cash_received_cents, change_cents, store_credit_cents, status, created_at
 		FROM transactions
-		WHERE store_id = $1 AND created_at BETWEEN $2 AND $3 AND status <> $4
-	`, storeID, from, to, domain.TxStatusVoided).Scan(&metrics.Transactions, &metrics.Accepted)
+		WHERE shift_id = $1
+		ORDER BY created_at ASC
+	`, shiftID)
 	if err != nil {
-		return metrics, err
+		return nil, err
 	}
+	defer rows.Close()
 
-	if metrics.Transactions > 0 {
-		metrics.AttachRate = (float64(metrics.Accepted) / float64(metrics.Transactions)) * 100
+	transactions := make([]domain.Transaction, 0, 64)
+	for rows.Next() {
+		tx := domain.Transaction{ShiftID: shiftID}
+		if err := rows.Scan(&tx.ID, &tx.StoreID, &tx.TerminalID, &tx.PaymentMethod, &tx.PaymentReference, &tx.TotalCents, &tx.CashReceivedCents, &tx.ChangeCents, &tx.StoreCreditCents, &tx.Status, &tx.CreatedAt); err != nil {
+			return nil, err
+		}
+		tx.CreatedAt = tx.CreatedAt.UTC()
+		transactions = append(transactions, tx)
 	}
-
-	return metrics, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return transactions, nil
 }
 
-func (s *Store) GetDailyReport(ctx context.Context, storeID string, from time.Time, to time.Time) (domain.DailyReport, error) {
-	report := domain.DailyReport{
-		StoreID:    storeID,
-		ByPayment:  make([]domain.DailyReportPayment, 0, 4),
-		ByTerminal: make([]domain.DailyReportTerminal, 0, 8),
+func (s *Store) ListTransactionsByCustomer(ctx context.Context, customerID string, limit int) ([]domain.Transaction, error) {
+	if limit < 1 {
+		limit = 100
 	}
-
-	err := s.db.QueryRowContext(ctx, `
-		SELECT
-			COUNT(*)::bigint,
-			COALESCE(SUM(subtotal_cents),0)::bigint,
-			COALESCE(SUM(discount_cents),0)::bigint,
-			COALESCE(SUM(tax_cents),0)::bigint,
-			COALESCE(SUM(total_cents),0)::bigint
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, store_id, terminal_id, payment_method, total_cents, status, created_at
 		FROM transactions
-		WHERE store_id = $1
-			AND created_at >= $2
-			AND created_at < $3
-			AND status <> $4
-	`, storeID, from, to, domain.TxStatusVoided).Scan(
-		&report.Transactions,
-		&report.GrossSalesCents,
-		&report.DiscountCents,
-		&report.TaxCents,
-		&report.NetSalesCents,
-	)
+		WHERE customer_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`, customerID, limit)
 	if err != nil {
-		return report, err
+		return nil, err
 	}
+	defer rows.Close()
 
-	var refundedCents int64
-	err = s.db.QueryRowContext(ctx, `
-		SELECT COALESCE(SUM(r.amount_cents),0)::bigint
-		FROM refunds r
-		JOIN transactions t ON t.id = r.original_transaction_id
-		WHERE t.store_id = $1
-			AND r.created_at >= $2
-			AND r.created_at < $3
-			AND r.status = $4
-	`, storeID, from, to, domain.TxStatusRefunded).Scan(&refundedCents)
-	if err != nil {
-		return report, err
-	}
-	if refundedCents > 0 {
-		report.NetSalesCents -= refundedCents
-		if report.NetSalesCents < 0 {
-			report.NetSalesCents = 0
+	transactions := make([]domain.Transaction, 0, 16)
+	index := map[string]int{}
+	ids := make([]string, 0, 16)
+	for rows.Next() {
+		tx := domain.Transaction{CustomerID: customerID}
+		if err := rows.Scan(&tx.ID, &tx.StoreID, &tx.TerminalID, &tx.PaymentMethod, &tx.TotalCents, &tx.Status, &tx.CreatedAt); err != nil {
+			return nil, err
 		}
+		tx.CreatedAt = tx.CreatedAt.UTC()
+		index[tx.ID] = len(transactions)
+		ids = append(ids, tx.ID)
+		transactions = append(transactions, tx)
 	}
-
-	err = s.db.QueryRowContext(ctx, `
-		SELECT COALESCE(SUM(ROUND((ti.unit_price_cents * ti.qty) * ti.margin_rate)),0)::bigint
-		FROM transaction_items ti
-		JOIN transactions t ON t.id = ti.transaction_id
-		WHERE t.store_id = $1
-			AND t.created_at >= $2
-			AND t.created_at < $3
-			AND t.status <> $4
-	`, storeID, from, to, domain.TxStatusVoided).Scan(&report.EstimatedMarginCents)
-	if err != nil {
-		return report, err
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return transactions, nil
 	}
 
-	paymentRows, err := s.db.QueryContext(ctx, `
-		SELECT payment_method, COUNT(*)::bigint, COALESCE(SUM(total_cents),0)::bigint
-		FROM transactions
-		WHERE store_id = $1
-			AND created_at >= $2
-			AND created_at < $3
-			AND status <> $4
-		GROUP BY payment_method
-		ORDER BY payment_method
-	`, storeID, from, to, domain.TxStatusVoided)
+	itemRows, err := s.db.QueryContext(ctx, `
+		SELECT transaction_id, sku, name, qty, unit_price_cents, unit_cost_cents, margin_rate, tax_rate_percent, taxable_base_cents, tax_cents
+		FROM transaction_items
+		WHERE transaction_id = ANY($1)
+		ORDER BY id ASC
+	`, ids)
 	if err != nil {
-		return report, err
+		return nil, err
 	}
-	for paymentRows.Next() {
-		var row domain.DailyReportPayment
-		if err := paymentRows.Scan(&row.PaymentMethod, &row.Transactions, &row.TotalCents); err != nil {
-			_ = paymentRows.Close()
-			return report, err
+	defer itemRows.Close()
+	for itemRows.Next() {
+		var transactionID string
+		var item domain.TransactionLine
+		if err := itemRows.Scan(&transactionID, &item.SKU, &item.Name, &item.Qty, &item.UnitPriceCents, &item.UnitCostCents, &item.MarginRate, &item.TaxRatePercent, &item.TaxableBaseCents, &item.TaxCents); err != nil {
+			return nil, err
 		}
-		report.ByPayment = append(report.ByPayment, row)
+		i := index[transactionID]
+		transactions[i].Items = append(transactions[i].Items, item)
 	}
-	if err := paymentRows.Err(); err != nil {
-		_ = paymentRows.Close()
-		return report, err
+	if err := itemRows.Err(); err != nil {
+		return nil, err
 	}
-	_ = paymentRows.Close()
+	return transactions, nil
+}
 
-	terminalRows, err := s.db.QueryContext(ctx, `
-		SELECT terminal_id, COUNT(*)::bigint, COALESCE(SUM(total_cents),0)::bigint
-		FROM transactions
-		WHERE store_id = $1
-			AND created_at >= $2
-			AND created_at < $3
-			AND status <> $4
-		GROUP BY terminal_id
-		ORDER BY terminal_id
-	`, storeID, from, to, domain.TxStatusVoided)
+func (s *Store) ListRefundsByTerminal(ctx context.Context, storeID string, terminalID string, from time.Time, to time.Time) ([]domain.Refund, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT r.id, r.original_transaction_id, r.reason, r.amount_cents, r.status, r.created_at
+		FROM refunds r
+		JOIN transactions t ON t.id = r.original_transaction_id
+		WHERE t.store_id = $1 AND t.terminal_id = $2 AND r.created_at >= $3 AND r.created_at < $4
+		ORDER BY r.created_at ASC
+	`, storeID, terminalID, from, to)
 	if err != nil {
-		return report, err
+		return nil, err
 	}
-	for terminalRows.Next() {
-		var row domain.DailyReportTerminal
-		if err := terminalRows.Scan(&row.TerminalID, &row.Transactions, &row.TotalCents); err != nil {
-			_ = terminalRows.Close()
-			return report, err
+	defer rows.Close()
+
+	refunds := make([]domain.Refund, 0, 8)
+	for rows.Next() {
+		var refund domain.Refund
+		if err := rows.Scan(&refund.ID, &refund.OriginalTransactionID, &refund.Reason, &refund.AmountCents, &refund.Status, &refund.CreatedAt); err != nil {
+			return nil, err
 		}
-		report.ByTerminal = append(report.ByTerminal, row)
+		refund.CreatedAt = refund.CreatedAt.UTC()
+		refunds = append(refunds, refund)
 	}
-	if err := terminalRows.Err(); err != nil {
-		_ = terminalRows.Close()
-		return report, err
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
-	_ = terminalRows.Close()
-
-	return report, nil
+	return refunds, nil
 }
 
-func (s *Store) CreateAuditLog(ctx context.Context, entry domain.AuditLog) error {
-	if entry.ID == "" {
-		entry.ID = xid.New("audit")
+// CreateShiftCashMovement records drawer cash that moved outside a sale. Only
+// open shifts accept movements.
+func (s *Store) SaveTerminal(ctx context.Context, terminal domain.Terminal) (*domain.Terminal, error) {
+	if terminal.StoreID == "" || terminal.TerminalID == "" || terminal.TokenHash == "" {
+		return nil, store.ErrInvalidTransaction
 	}
-	if entry.CreatedAt.IsZero() {
-		entry.CreatedAt = time.Now().UTC()
+	if terminal.CreatedAt.IsZero() {
+		terminal.CreatedAt = time.Now().UTC()
 	}
 
-	_, err := s.db.ExecContext(ctx, `
-		INSERT INTO audit_logs (
-			id, store_id, actor_username, actor_role, action, entity_type, entity_id, detail, created_at
-		)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
-	`, entry.ID, entry.StoreID, entry.ActorUsername, entry.ActorRole, entry.Action, entry.EntityType, entry.EntityID, entry.Detail, entry.CreatedAt)
-	return err
+	saved, err := scanTerminal(s.db.QueryRowContext(ctx, `
+		INSERT INTO terminals (store_id, terminal_id, label, token_hash, created_by, created_at, revoked_at)
+		VALUES ($1,$2,$3,$4,$5,$6,NULL)
+		ON CONFLICT (store_id, terminal_id) DO UPDATE
+		SET label = EXCLUDED.label, token_hash = EXCLUDED.token_hash, created_by = EXCLUDED.created_by,
+			created_at = EXCLUDED.created_at, revoked_at = NULL
+		RETURNING store_id, terminal_id, label, token_hash, created_by, created_at, revoked_at
+	`, terminal.StoreID, terminal.TerminalID, terminal.Label, terminal.TokenHash, terminal.CreatedBy, terminal.CreatedAt))
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
 }
 
-func (s *Store) ListAuditLogs(ctx context.Context, storeID string, from time.Time, to time.Time, limit int) ([]domain.AuditLog, error) {
-	if limit < 1 {
-		limit = 100
+func (s *Store) GetTerminal(ctx context.Context, storeID string, terminalID string) (*domain.Terminal, error) {
+	terminal, err := scanTerminal(s.db.QueryRowContext(ctx, `
+		SELECT store_id, terminal_id, label, token_hash, created_by, created_at, revoked_at
+		FROM terminals
+		WHERE store_id = $1 AND terminal_id = $2
+	`, storeID, terminalID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, store.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
 	}
+	return terminal, nil
+}
 
+func (s *Store) ListTerminals(ctx context.Context, storeID string) ([]domain.Terminal, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, store_id, actor_username, actor_role, action, entity_type, entity_id, detail, created_at
-		FROM audit_logs
+		SELECT store_id, terminal_id, label, token_hash, created_by, created_at, revoked_at
+		FROM terminals
 		WHERE store_id = $1
-			AND created_at >= $2
-			AND created_at < $3
-		ORDER BY created_at DESC
-		LIMIT $4
-	`, storeID, from, to, limit)
+		ORDER BY terminal_id
+	`, storeID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	logs := make([]domain.AuditLog, 0, limit)
+	terminals := make([]domain.Terminal, 0, 8)
 	for rows.Next() {
-		var entry domain.AuditLog
-		if err := rows.Scan(&entry.ID, &entry.StoreID, &entry.ActorUsername, &entry.ActorRole, &entry.Action, &entry.EntityType, &entry.EntityID, &entry.Detail, &entry.CreatedAt); err != nil {
+		terminal, err := scanTerminal(rows)
+		if err != nil {
 			return nil, err
 		}
-		entry.CreatedAt = entry.CreatedAt.UTC()
-		logs = append(logs, entry)
+		terminals = append(terminals, *terminal)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	return logs, nil
+	return terminals, nil
+}
+
+func (s *Store) RevokeTerminal(ctx context.Context, storeID string, terminalID string, at time.Time) (*domain.Terminal, error) {
+	terminal, err := scanTerminal(s.db.QueryRowContext(ctx, `
+		UPDATE terminals
+		SET revoked_at = COALESCE(revoked_at, $3)
+		WHERE store_id = $1 AND terminal_id = $2
+		RETURNING store_id, terminal_id, label, token_hash, created_by, created_at, revoked_at
+	`, storeID, terminalID, at))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, store.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return terminal, nil
+}
+
+func scanTerminal(row interface{ Scan(dest ...any) error }) (*domain.Terminal, error) {
+	var terminal domain.Terminal
+	var revokedAt sql.NullTime
+	if err := row.Scan(&terminal.StoreID, &terminal.TerminalID, &terminal.Label, &terminal.TokenHash, &terminal.CreatedBy, &terminal.CreatedAt, &revokedAt); err != nil {
+		return nil, err
+	}
+	terminal.CreatedAt = terminal.CreatedAt.UTC()
+	if revokedAt.Valid {
+		value := revokedAt.Time.UTC()
+		terminal.RevokedAt = &value
+	}
+	return &terminal, nil
 }
 
-func (s *Store) CreateShift(ctx context.Context, shift domain.Shift) (*domain.Shift, error) {
-	if strings.TrimSpace(shift.StoreID) == "" || strings.TrimSpace(shift.TerminalID) == "" || strings.TrimSpace(shift.CashierName) == "" {
+func (s *Store) CreateShiftCashMovement(ctx context.Context, movement domain.ShiftCashMovement) (*domain.ShiftCashMovement, error) {
+	if movement.ShiftID == "" || movement.AmountCents < 1 {
 		return nil, store.ErrInvalidTransaction
 	}
-	if shift.ID == "" {
-		shift.ID = xid.New("shift")
+	if movement.ID == "" {
+		movement.ID = xid.New("cash")
 	}
-	if shift.OpenedAt.IsZero() {
-		shift.OpenedAt = time.Now().UTC()
+	if movement.CreatedAt.IsZero() {
+		movement.CreatedAt = time.Now().UTC()
 	}
-	shift.Status = domain.ShiftStatusOpen
-	shift.ClosedAt = nil
-	shift.ClosingCashCents = 0
 
-	_, err := s.db.ExecContext(ctx, `
-		INSERT INTO shifts (
-			id, store_id, terminal_id, cashier_name, opening_float_cents,
-			closing_cash_cents, status, opened_at, closed_at
-		)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
-	`, shift.ID, shift.StoreID, shift.TerminalID, shift.CashierName, shift.OpeningFloatCents,
-		shift.ClosingCashCents, shift.Status, shift.OpenedAt, nullTime(shift.ClosedAt))
+	pgTx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
 	if err != nil {
-		if isUniqueViolation(err) {
-			return nil, store.ErrInvalidTransaction
-		}
 		return nil, err
 	}
-	saved := shift
-	return &saved, nil
-}
+	defer func() { _ = pgTx.Rollback() }()
 
-func (s *Store) CloseActiveShift(ctx context.Context, storeID string, terminalID string, closingCashCents int64, closedAt time.Time) (*domain.Shift, error) {
-	if strings.TrimSpace(storeID) == "" || strings.TrimSpace(terminalID) == "" {
-		return nil, store.ErrInvalidTransaction
+	var status string
+	err = pgTx.QueryRowContext(ctx, `
+		SELECT status
+		FROM shifts
+		WHERE id = $1
+		FOR UPDATE
+	`, movement.ShiftID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, store.ErrNotFound
 	}
-	if closedAt.IsZero() {
-		closedAt = time.Now().UTC()
+	if err != nil {
+		return nil, err
+	}
+	if status != domain.ShiftStatusOpen {
+		return nil, store.ErrInvalidTransaction
 	}
 
-	var shift domain.Shift
-	var closedAtNull sql.NullTime
-	err := s.db.QueryRowContext(ctx, `
-		UPDATE shifts
-		SET status = 'closed', closing_cash_cents = $3, closed_at = $4
-		WHERE store_id = $1 AND terminal_id = $2 AND status = 'open'
-		RETURNING id, store_id, terminal_id, cashier_name, opening_float_cents,
-			closing_cash_cents, status, opened_at, closed_at
-	`, storeID, terminalID, closingCashCents, closedAt).Scan(
-		&shift.ID,
-		&shift.StoreID,
-		&shift.TerminalID,
-		&shift.CashierName,
-		&shift.OpeningFloatCents,
-		&shift.ClosingCashCents,
-		&shift.Status,
-		&shift.OpenedAt,
-		&closedAtNull,
-	)
+	_, err = pgTx.ExecContext(ctx, `
+		INSERT INTO shift_cash_movements (id, shift_id, kind, amount_cents, note, created_by, created_at)
+		VALUES ($1,$2,$3,$4,$5,$6,$7)
+	`, movement.ID, movement.ShiftID, movement.Kind, movement.AmountCents, movement.Note, movement.CreatedBy, movement.CreatedAt)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, store.ErrNotFound
-		}
 		return nil, err
 	}
-	shift.OpenedAt = shift.OpenedAt.UTC()
-	if closedAtNull.Valid {
-		at := closedAtNull.Time.UTC()
-		shift.ClosedAt = &at
+	if err := pgTx.Commit(); err != nil {
+		return nil, err
 	}
-	return &shift, nil
+	return &movement, nil
 }
 
-func (s *Store) GetActiveShift(ctx context.Context, storeID string, terminalID string) (*domain.Shift, error) {
-	var shift domain.Shift
-	var closedAtNull sql.NullTime
-	err := s.db.QueryRowContext(ctx, `
-		SELECT id, store_id, terminal_id, cashier_name, opening_float_cents,
-			closing_cash_cents, status, opened_at, closed_at
-		FROM shifts
-		WHERE store_id = $1 AND terminal_id = $2 AND status = 'open'
-		ORDER BY opened_at DESC
-		LIMIT 1
-	`, storeID, terminalID).Scan(
-		&shift.ID,
-		&shift.StoreID,
-		&shift.TerminalID,
-		&shift.CashierName,
-		&shift.OpeningFloatCents,
-		&shift.ClosingCashCents,
-		&shift.Status,
-		&shift.OpenedAt,
-		&closedAtNull,
-	)
+func (s *Store) ListShiftCashMovements(ctx context.Context, shiftID string) ([]domain.ShiftCashMovement, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, shift_id, kind, amount_cents, note, created_by, created_at
+		FROM shift_cash_movements
+		WHERE shift_id = $1
+		ORDER BY created_at ASC, id ASC
+	`, shiftID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, store.ErrNotFound
-		}
 		return nil, err
 	}
-	shift.OpenedAt = shift.OpenedAt.UTC()
-	if closedAtNull.Valid {
-		at := closedAtNull.Time.UTC()
-		shift.ClosedAt = &at
+	defer rows.Close()
+
+	movements := make([]domain.ShiftCashMovement, 0, 8)
+	for rows.Next() {
+		var movement domain.ShiftCashMovement
+		if err := rows.Scan(&movement.ID, &movement.ShiftID, &movement.Kind, &movement.AmountCents, &movement.Note, &movement.CreatedBy, &movement.CreatedAt); err != nil {
+			return nil, err
+		}
+		movement.CreatedAt = movement.CreatedAt.UTC()
+		movements = append(movements, movement)
 	}
-	return &shift, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return movements, nil
 }
 
 func (s *Store) CreatePromo(ctx context.Context, promo domain.PromoRule) (*domain.PromoRule, error) {
@@ -1422,10 +3763,19 @@ func (s *Store) CreatePromo(ctx context.Context, promo domain.PromoRule) (*domai
 		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,now())
 	`, promo.ID, promo.Name, promo.Type, promo.MinSubtotalCents, promo.DiscountPercent, promo.FlatDiscountCents, promo.Active, promo.CreatedAt)
 	if err != nil {
-		if isUniqueViolation(err) {
-			return nil, store.ErrInvalidTransaction
+		if !isUniqueViolation(err) {
+			return nil, err
 		}
-		return nil, err
+		// Either the ID is taken or an active promo has this name; a taken
+		// ID wins so a reused client ID is reported as such.
+		if _, lookupErr := s.GetPromo(ctx, promo.ID); lookupErr == nil {
+			return nil, store.ErrDuplicateID
+		}
+		existing, lookupErr := s.activePromoByName(ctx, promo.Name)
+		if lookupErr != nil {
+			return nil, store.ErrDuplicateID
+		}
+		return existing, nil
 	}
 	saved := promo
 	return &saved, nil
@@ -1457,6 +3807,59 @@ func (s *Store) ListPromos(ctx context.Context) ([]domain.PromoRule, error) {
 	return promos, nil
 }
 
+func (s *Store) GetPromo(ctx context.Context, promoID string) (*domain.PromoRule, error) {
+	var promo domain.PromoRule
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, name, type, min_subtotal_cents, discount_percent, flat_discount_cents, active, created_at
+		FROM promo_rules
+		WHERE id = $1
+	`, promoID).Scan(
+		&promo.ID,
+		&promo.Name,
+		&promo.Type,
+		&promo.MinSubtotalCents,
+		&promo.DiscountPercent,
+		&promo.FlatDiscountCents,
+		&promo.Active,
+		&promo.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, err
+	}
+	promo.CreatedAt = promo.CreatedAt.UTC()
+	return &promo, nil
+}
+
+// activePromoByName returns the active promo named name, ignoring case.
+func (s *Store) activePromoByName(ctx context.Context, name string) (*domain.PromoRule, error) {
+	var promo domain.PromoRule
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, name, type, min_subtotal_cents, discount_percent, flat_discount_cents, active, created_at
+		FROM promo_rules
+		WHERE active AND lower(name) = lower($1)
+	`, name).Scan(
+		&promo.ID,
+		&promo.Name,
+		&promo.Type,
+		&promo.MinSubtotalCents,
+		&promo.DiscountPercent,
+		&promo.FlatDiscountCents,
+		&promo.Active,
+		&promo.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, err
+	}
+	promo.CreatedAt = promo.CreatedAt.UTC()
+	return &promo, nil
+}
+
 func (s *Store) UpdatePromoActive(ctx context.Context, promoID string, active bool) (*domain.PromoRule, error) {
 	var promo domain.PromoRule
 	err := s.db.QueryRowContext(ctx, `
@@ -1478,30 +3881,36 @@ func (s *Store) UpdatePromoActive(ctx context.Context, promoID string, active bo
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, store.ErrNotFound
 		}
+		if isUniqueViolation(err) {
+			return nil, store.ErrDuplicatePromoName
+		}
 		return nil, err
 	}
 	promo.CreatedAt = promo.CreatedAt.UTC()
 	return &promo, nil
 }
 
-func (s *Store) RebuildAssociationPairs(ctx context.Context, storeID string) (int, error) {
+func (s *Store) RebuildAssociationPairs(ctx context.Context, storeID string, minLift float64) ([]domain.AssociationPair, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT ti.transaction_id, ti.sku
+		SELECT ti.transaction_id, ti.sku, COALESCE(p.category, '')
 		FROM transaction_items ti
 		JOIN transactions t ON t.id = ti.transaction_id
+		LEFT JOIN products p ON p.sku = ti.sku
 		WHERE t.store_id = $1 AND t.status = $2
 	`, storeID, domain.TxStatusPaid)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	defer rows.Close()
 
 	txToSkus := map[string]map[string]struct{}{}
+	txToCategories := map[string]map[string]struct{}{}
 	for rows.Next() {
 		var txID string
 		var sku string
-		if err := rows.Scan(&txID, &sku); err != nil {
-			return 0, err
+		var category string
+		if err := rows.Scan(&txID, &sku, &category); err != nil {
+			return nil, err
 		}
 		bucket := txToSkus[txID]
 		if bucket == nil {
@@ -1509,9 +3918,30 @@ func (s *Store) RebuildAssociationPairs(ctx context.Context, storeID string) (in
 			txToSkus[txID] = bucket
 		}
 		bucket[sku] = struct{}{}
+		if category != "" {
+			categories := txToCategories[txID]
+			if categories == nil {
+				categories = map[string]struct{}{}
+				txToCategories[txID] = categories
+			}
+			categories[category] = struct{}{}
+		}
 	}
 	if err := rows.Err(); err != nil {
-		return 0, err
+		return nil, err
+	}
+
+	categorySourceCount := map[string]int{}
+	categoryPairCount := map[[2]string]int{}
+	for _, categories := range txToCategories {
+		for source := range categories {
+			categorySourceCount[source]++
+			for target := range categories {
+				if source != target {
+					categoryPairCount[[2]string{source, target}]++
+				}
+			}
+		}
 	}
 
 	sourceCount := map[string]int{}
@@ -1532,12 +3962,7 @@ func (s *Store) RebuildAssociationPairs(ctx context.Context, storeID string) (in
 		}
 	}
 
-	type computedPair struct {
-		source   string
-		target   string
-		affinity float64
-	}
-	computed := make([]computedPair, 0, len(pairCount))
+	computed := make([]domain.AssociationPair, 0, len(pairCount))
 	for key, cnt := range pairCount {
 		arrow := -1
 		for i := 0; i+1 < len(key); i++ {
@@ -1555,21 +3980,31 @@ func (s *Store) RebuildAssociationPairs(ctx context.Context, storeID string) (in
 		if srcCount < 1 {
 			continue
 		}
-		affinity := float64(cnt) / float64(srcCount)
-		if affinity < 0.2 {
+		totalTransactions := float64(len(txToSkus))
+		support := float64(cnt) / totalTransactions
+		confidence := float64(cnt) / float64(srcCount)
+		lift := confidence / (float64(sourceCount[target]) / totalTransactions)
+		if lift < minLift {
 			continue
 		}
-		computed = append(computed, computedPair{source: source, target: target, affinity: affinity})
+		computed = append(computed, domain.AssociationPair{
+			SourceSKU:  source,
+			TargetSKU:  target,
+			Affinity:   confidence,
+			Support:    support,
+			Confidence: confidence,
+			Lift:       lift,
+		})
 	}
 
 	sort.Slice(computed, func(i, j int) bool {
-		if computed[i].source == computed[j].source {
-			if computed[i].affinity == computed[j].affinity {
-				return computed[i].target < computed[j].target
+		if computed[i].SourceSKU == computed[j].SourceSKU {
+			if computed[i].Affinity == computed[j].Affinity {
+				return computed[i].TargetSKU < computed[j].TargetSKU
 			}
-			return computed[i].affinity > computed[j].affinity
+			return computed[i].Affinity > computed[j].Affinity
 		}
-		return computed[i].source < computed[j].source
+		return computed[i].SourceSKU < computed[j].SourceSKU
 	})
 	if len(computed) > 300 {
 		computed = computed[:300]
@@ -1577,30 +4012,45 @@ func (s *Store) RebuildAssociationPairs(ctx context.Context, storeID string) (in
 
 	pgTx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	defer func() { _ = pgTx.Rollback() }()
 
-	_, err = pgTx.ExecContext(ctx, `DELETE FROM association_item_pairs`)
+	_, err = pgTx.ExecContext(ctx, `DELETE FROM association_item_pairs WHERE manual = false`)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	for _, pair := range computed {
 		_, err := pgTx.ExecContext(ctx, `
 			INSERT INTO association_item_pairs (source_sku, target_sku, support, confidence, lift, affinity_score, updated_at)
 			VALUES ($1,$2,$3,$4,$5,$6,now())
-		`, pair.source, pair.target, 0.0, pair.affinity, 0.0, pair.affinity)
+			ON CONFLICT (source_sku, target_sku) DO NOTHING
+		`, pair.SourceSKU, pair.TargetSKU, pair.Support, pair.Confidence, pair.Lift, pair.Affinity)
 		if err != nil {
-			return 0, err
+			return nil, err
+		}
+	}
+
+	_, err = pgTx.ExecContext(ctx, `DELETE FROM association_category_pairs`)
+	if err != nil {
+		return nil, err
+	}
+	for key, cnt := range categoryPairCount {
+		_, err := pgTx.ExecContext(ctx, `
+			INSERT INTO association_category_pairs (source_category, target_category, affinity_score, updated_at)
+			VALUES ($1,$2,$3,now())
+		`, key[0], key[1], float64(cnt)/float64(categorySourceCount[key[0]]))
+		if err != nil {
+			return nil, err
 		}
 	}
 
 	if err := pgTx.Commit(); err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return len(computed), nil
+	return computed, nil
 }
 
 func (s *Store) CreateHeldCart(ctx context.Context, held domain.HeldCart) (*domain.HeldCart, error) {
@@ -1784,60 +4234,152 @@ func (s *Store) DeleteHeldCart(ctx context.Context, holdID string) error {
 	if affected == 0 {
 		return store.ErrNotFound
 	}
-	return nil
+	return nil
+}
+
+func (s *Store) CreateSupplier(ctx context.Context, supplier domain.Supplier) (*domain.Supplier, error) {
+	supplier.Name = strings.TrimSpace(supplier.Name)
+	supplier.Phone = strings.TrimSpace(supplier.Phone)
+	if supplier.Name == "" {
+		return nil, store.ErrInvalidTransaction
+	}
+	if supplier.ID == "" {
+		supplier.ID = xid.New("sup")
+	}
+	if supplier.CreatedAt.IsZero() {
+		supplier.CreatedAt = time.Now().UTC()
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO suppliers (id, name, phone, created_at)
+		VALUES ($1,$2,$3,$4)
+	`, supplier.ID, supplier.Name, nullIfEmpty(supplier.Phone), supplier.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, store.ErrDuplicateID
+		}
+		return nil, err
+	}
+	saved := supplier
+	return &saved, nil
+}
+
+func (s *Store) ListSuppliers(ctx context.Context) ([]domain.Supplier, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, name, COALESCE(phone,''), created_at
+		FROM suppliers
+		ORDER BY created_at ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suppliers := make([]domain.Supplier, 0, 64)
+	for rows.Next() {
+		var item domain.Supplier
+		if err := rows.Scan(&item.ID, &item.Name, &item.Phone, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		item.CreatedAt = item.CreatedAt.UTC()
+		suppliers = append(suppliers, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return suppliers, nil
+}
+
+func (s *Store) GetSupplierByID(ctx context.Context, supplierID string) (*domain.Supplier, error) {
+	var supplier domain.Supplier
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, name, COALESCE(phone,''), created_at
+		FROM suppliers
+		WHERE id = $1
+	`, supplierID).Scan(&supplier.ID, &supplier.Name, &supplier.Phone, &supplier.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, err
+	}
+	supplier.CreatedAt = supplier.CreatedAt.UTC()
+	return &supplier, nil
 }
 
-func (s *Store) CreateSupplier(ctx context.Context, supplier domain.Supplier) (*domain.Supplier, error) {
+func (s *Store) UpdateSupplier(ctx context.Context, supplier domain.Supplier) (*domain.Supplier, error) {
 	supplier.Name = strings.TrimSpace(supplier.Name)
 	supplier.Phone = strings.TrimSpace(supplier.Phone)
 	if supplier.Name == "" {
 		return nil, store.ErrInvalidTransaction
 	}
-	if supplier.ID == "" {
-		supplier.ID = xid.New("sup")
+
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE suppliers
+		SET name = $2, phone = $3
+		WHERE id = $1
+		RETURNING created_at
+	`, supplier.ID, supplier.Name, nullIfEmpty(supplier.Phone)).Scan(&supplier.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, err
 	}
-	if supplier.CreatedAt.IsZero() {
-		supplier.CreatedAt = time.Now().UTC()
+	supplier.CreatedAt = supplier.CreatedAt.UTC()
+	return &supplier, nil
+}
+
+func (s *Store) SetSupplierProduct(ctx context.Context, product domain.SupplierProduct) (*domain.SupplierProduct, error) {
+	if product.DefaultCostCents < 0 || product.LeadTimeDays < 0 {
+		return nil, store.ErrInvalidTransaction
+	}
+	if product.UpdatedAt.IsZero() {
+		product.UpdatedAt = time.Now().UTC()
 	}
 
 	_, err := s.db.ExecContext(ctx, `
-		INSERT INTO suppliers (id, name, phone, created_at)
-		VALUES ($1,$2,$3,$4)
-	`, supplier.ID, supplier.Name, nullIfEmpty(supplier.Phone), supplier.CreatedAt)
+		INSERT INTO supplier_products (supplier_id, sku, default_cost_cents, lead_time_days, updated_at)
+		VALUES ($1,$2,$3,$4,$5)
+		ON CONFLICT (supplier_id, sku)
+		DO UPDATE SET default_cost_cents = EXCLUDED.default_cost_cents, lead_time_days = EXCLUDED.lead_time_days, updated_at = EXCLUDED.updated_at
+	`, product.SupplierID, product.SKU, product.DefaultCostCents, product.LeadTimeDays, product.UpdatedAt)
 	if err != nil {
-		if isUniqueViolation(err) {
-			return nil, store.ErrInvalidTransaction
+		if isForeignKeyViolation(err) {
+			return nil, store.ErrNotFound
 		}
 		return nil, err
 	}
-	saved := supplier
+	saved := product
 	return &saved, nil
 }
 
-func (s *Store) ListSuppliers(ctx context.Context) ([]domain.Supplier, error) {
+func (s *Store) ListSupplierProducts(ctx context.Context, supplierID string, skus []string) ([]domain.SupplierProduct, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, name, COALESCE(phone,''), created_at
-		FROM suppliers
-		ORDER BY created_at ASC
-	`)
+		SELECT supplier_id, sku, default_cost_cents, lead_time_days, updated_at
+		FROM supplier_products
+		WHERE ($1 = '' OR supplier_id = $1)
+			AND (COALESCE(cardinality($2::text[]), 0) = 0 OR sku = ANY($2))
+		ORDER BY supplier_id ASC, sku ASC
+	`, supplierID, skus)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	suppliers := make([]domain.Supplier, 0, 64)
+	products := make([]domain.SupplierProduct, 0, 16)
 	for rows.Next() {
-		var item domain.Supplier
-		if err := rows.Scan(&item.ID, &item.Name, &item.Phone, &item.CreatedAt); err != nil {
+		var item domain.SupplierProduct
+		if err := rows.Scan(&item.SupplierID, &item.SKU, &item.DefaultCostCents, &item.LeadTimeDays, &item.UpdatedAt); err != nil {
 			return nil, err
 		}
-		item.CreatedAt = item.CreatedAt.UTC()
-		suppliers = append(suppliers, item)
+		item.UpdatedAt = item.UpdatedAt.UTC()
+		products = append(products, item)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	return suppliers, nil
+	return products, nil
 }
 
 func (s *Store) CreatePurchaseOrder(ctx context.Context, po domain.PurchaseOrder) (*domain.PurchaseOrder, error) {
@@ -1869,6 +4411,9 @@ func (s *Store) CreatePurchaseOrder(ctx context.Context, po domain.PurchaseOrder
 		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
 			return nil, store.ErrNotFound
 		}
+		if isUniqueViolation(err) {
+			return nil, store.ErrDuplicateID
+		}
 		return nil, err
 	}
 
@@ -1902,10 +4447,11 @@ func (s *Store) CreatePurchaseOrder(ctx context.Context, po domain.PurchaseOrder
 
 func (s *Store) GetPurchaseOrderByID(ctx context.Context, purchaseOrderID string) (*domain.PurchaseOrder, error) {
 	var po domain.PurchaseOrder
-	var receivedAt sql.NullTime
-	var receivedBy sql.NullString
+	var receivedAt, cancelledAt sql.NullTime
+	var receivedBy, cancelledBy sql.NullString
 	err := s.db.QueryRowContext(ctx, `
-		SELECT id, store_id, supplier_id, status, created_at, received_at, received_by
+		SELECT id, store_id, supplier_id, status, created_at, received_at, received_by,
+			cancelled_at, cancelled_by, cancel_reason
 		FROM purchase_orders
 		WHERE id = $1
 	`, purchaseOrderID).Scan(
@@ -1916,6 +4462,9 @@ func (s *Store) GetPurchaseOrderByID(ctx context.Context, purchaseOrderID string
 		&po.CreatedAt,
 		&receivedAt,
 		&receivedBy,
+		&cancelledAt,
+		&cancelledBy,
+		&po.CancelReason,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -1924,13 +4473,7 @@ func (s *Store) GetPurchaseOrderByID(ctx context.Context, purchaseOrderID string
 		return nil, err
 	}
 	po.CreatedAt = po.CreatedAt.UTC()
-	if receivedAt.Valid {
-		at := receivedAt.Time.UTC()
-		po.ReceivedAt = &at
-	}
-	if receivedBy.Valid {
-		po.ReceivedBy = receivedBy.String
-	}
+	setPurchaseOrderStatusFields(&po, receivedAt, receivedBy, cancelledAt, cancelledBy)
 
 	rows, err := s.db.QueryContext(ctx, `
 		SELECT sku, qty, cost_cents
@@ -1958,12 +4501,30 @@ func (s *Store) GetPurchaseOrderByID(ctx context.Context, purchaseOrderID string
 	return &po, nil
 }
 
+func setPurchaseOrderStatusFields(po *domain.PurchaseOrder, receivedAt sql.NullTime, receivedBy sql.NullString, cancelledAt sql.NullTime, cancelledBy sql.NullString) {
+	if receivedAt.Valid {
+		at := receivedAt.Time.UTC()
+		po.ReceivedAt = &at
+	}
+	if receivedBy.Valid {
+		po.ReceivedBy = receivedBy.String
+	}
+	if cancelledAt.Valid {
+		at := cancelledAt.Time.UTC()
+		po.CancelledAt = &at
+	}
+	if cancelledBy.Valid {
+		po.CancelledBy = cancelledBy.String
+	}
+}
+
 func (s *Store) ListPurchaseOrders(ctx context.Context, storeID string, status string, limit int) ([]domain.PurchaseOrder, error) {
 	if limit < 1 {
 		limit = 200
 	}
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, store_id, supplier_id, status, created_at, received_at, received_by
+		SELECT id, store_id, supplier_id, status, created_at, received_at, received_by,
+			cancelled_at, cancelled_by, cancel_reason
 		FROM purchase_orders
 		WHERE ($1 = '' OR store_id = $1)
 			AND ($2 = '' OR status = $2)
@@ -1979,19 +4540,13 @@ func (s *Store) ListPurchaseOrders(ctx context.Context, storeID string, status s
 	ids := make([]string, 0, limit)
 	for rows.Next() {
 		var po domain.PurchaseOrder
-		var receivedAt sql.NullTime
-		var receivedBy sql.NullString
-		if err := rows.Scan(&po.ID, &po.StoreID, &po.SupplierID, &po.Status, &po.CreatedAt, &receivedAt, &receivedBy); err != nil {
+		var receivedAt, cancelledAt sql.NullTime
+		var receivedBy, cancelledBy sql.NullString
+		if err := rows.Scan(&po.ID, &po.StoreID, &po.SupplierID, &po.Status, &po.CreatedAt, &receivedAt, &receivedBy, &cancelledAt, &cancelledBy, &po.CancelReason); err != nil {
 			return nil, err
 		}
 		po.CreatedAt = po.CreatedAt.UTC()
-		if receivedAt.Valid {
-			at := receivedAt.Time.UTC()
-			po.ReceivedAt = &at
-		}
-		if receivedBy.Valid {
-			po.ReceivedBy = receivedBy.String
-		}
+		setPurchaseOrderStatusFields(&po, receivedAt, receivedBy, cancelledAt, cancelledBy)
 		result = append(result, po)
 		ids = append(ids, po.ID)
 	}
@@ -2032,6 +4587,39 @@ func (s *Store) ListPurchaseOrders(ctx context.Context, storeID string, status s
 	return result, nil
 }
 
+// CancelPurchaseOrder guards the transition in the UPDATE itself, so a
+// concurrent receive or cancel of the same order makes this one fail instead
+// of overwriting it.
+func (s *Store) CancelPurchaseOrder(ctx context.Context, purchaseOrderID string, reason string, cancelledBy string, cancelledAt time.Time) (*domain.PurchaseOrder, error) {
+	if cancelledAt.IsZero() {
+		cancelledAt = time.Now().UTC()
+	}
+	cancelledBy = strings.TrimSpace(cancelledBy)
+	if cancelledBy == "" {
+		cancelledBy = "system"
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE purchase_orders
+		SET status = 'cancelled', cancelled_at = $2, cancelled_by = $3, cancel_reason = $4
+		WHERE id = $1 AND status NOT IN ('received', 'cancelled')
+	`, purchaseOrderID, cancelledAt, cancelledBy, strings.TrimSpace(reason))
+	if err != nil {
+		return nil, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		if _, err := s.GetPurchaseOrderByID(ctx, purchaseOrderID); err != nil {
+			return nil, err
+		}
+		return nil, store.ErrInvalidState
+	}
+	return s.GetPurchaseOrderByID(ctx, purchaseOrderID)
+}
+
 func (s *Store) ReceivePurchaseOrder(ctx context.Context, purchaseOrderID string, receivedBy string, receivedAt time.Time) (*domain.PurchaseOrder, error) {
 	if receivedAt.IsZero() {
 		receivedAt = time.Now().UTC()
@@ -2072,7 +4660,7 @@ func (s *Store) ReceivePurchaseOrder(ctx context.Context, purchaseOrderID string
 	}
 	po.CreatedAt = po.CreatedAt.UTC()
 	if po.Status == "received" || po.Status == "cancelled" {
-		return nil, store.ErrInvalidTransaction
+		return nil, store.ErrInvalidState
 	}
 
 	itemRows, err := tx.QueryContext(ctx, `
@@ -2175,6 +4763,9 @@ func (s *Store) ReceivePurchaseOrder(ctx context.Context, purchaseOrderID string
 		if err != nil {
 			return nil, err
 		}
+		if err := insertMovementTx(ctx, tx, po.StoreID, item.SKU, item.Qty, domain.MovementReasonPurchaseOrder, purchaseOrderID, receivedAt); err != nil {
+			return nil, err
+		}
 		_, err = tx.ExecContext(ctx, `
 			INSERT INTO product_costs (store_id, sku, cost_cents, updated_at)
 			VALUES ($1,$2,$3,now())
@@ -2296,7 +4887,7 @@ func (s *Store) CreateUser(ctx context.Context, user domain.UserAccount) error {
 	`, user.Username, user.Password, user.Role, user.Active, user.CreatedAt)
 	if err != nil {
 		if isUniqueViolation(err) {
-			return store.ErrInvalidTransaction
+			return store.ErrDuplicateID
 		}
 		return err
 	}
@@ -2329,6 +4920,23 @@ func (s *Store) ListUsers(ctx context.Context) ([]domain.UserAccount, error) {
 	return users, nil
 }
 
+func (s *Store) GetUser(ctx context.Context, username string) (*domain.UserAccount, error) {
+	var user domain.UserAccount
+	err := s.db.QueryRowContext(ctx, `
+		SELECT username, password, role, active, created_at
+		FROM app_users
+		WHERE username = $1
+	`, strings.ToLower(strings.TrimSpace(username))).Scan(&user.Username, &user.Password, &user.Role, &user.Active, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, store.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	user.CreatedAt = user.CreatedAt.UTC()
+	return &user, nil
+}
+
 func (s *Store) UpdateUserPassword(ctx context.Context, username string, password string) error {
 	username = strings.ToLower(strings.TrimSpace(username))
 	if username == "" || strings.TrimSpace(password) == "" {
@@ -2353,6 +4961,238 @@ func (s *Store) UpdateUserPassword(ctx context.Context, username string, passwor
 	return nil
 }
 
+func (s *Store) UpdateUserActive(ctx context.Context, username string, active bool) error {
+	username = strings.ToLower(strings.TrimSpace(username))
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE app_users
+		SET active = $2, updated_at = now()
+		WHERE username = $1
+	`, username, active)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) UpdateUserRole(ctx context.Context, username string, role string) error {
+	username = strings.ToLower(strings.TrimSpace(username))
+	if role != "admin" && role != "cashier" {
+		return store.ErrInvalidTransaction
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE app_users
+		SET role = $2, updated_at = now()
+		WHERE username = $1
+	`, username, role)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) CreateRefreshToken(ctx context.Context, token domain.RefreshToken) error {
+	if token.TokenHash == "" || token.Username == "" {
+		return store.ErrInvalidTransaction
+	}
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now().UTC()
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (token_hash, username, expires_at, revoked, created_at)
+		VALUES ($1,$2,$3,false,$4)
+	`, token.TokenHash, token.Username, token.ExpiresAt, token.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return store.ErrInvalidTransaction
+		}
+		return err
+	}
+	return nil
+}
+
+// ConsumeRefreshToken revokes an active token and returns it, so each refresh
+// token can be exchanged only once.
+func (s *Store) ConsumeRefreshToken(ctx context.Context, tokenHash string, at time.Time) (*domain.RefreshToken, error) {
+	var token domain.RefreshToken
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE refresh_tokens
+		SET revoked = true
+		WHERE token_hash = $1 AND revoked = false AND expires_at > $2
+		RETURNING token_hash, username, expires_at, revoked, created_at
+	`, tokenHash, at).Scan(&token.TokenHash, &token.Username, &token.ExpiresAt, &token.Revoked, &token.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, store.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	token.ExpiresAt = token.ExpiresAt.UTC()
+	token.CreatedAt = token.CreatedAt.UTC()
+	return &token, nil
+}
+
+func (s *Store) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE refresh_tokens
+		SET revoked = true
+		WHERE token_hash = $1
+	`, tokenHash)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every refresh token issued to username.
+func (s *Store) RevokeUserRefreshTokens(ctx context.Context, username string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE refresh_tokens
+		SET revoked = true
+		WHERE username = $1 AND revoked = false
+	`, strings.ToLower(strings.TrimSpace(username)))
+	return err
+}
+
+// RevokeAccessToken records a token ID as revoked until the token would have
+// expired anyway.
+func (s *Store) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return store.ErrInvalidTransaction
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO revoked_tokens (jti, expires_at, revoked_at)
+		VALUES ($1,$2,now())
+		ON CONFLICT (jti) DO NOTHING
+	`, jti, expiresAt)
+	return err
+}
+
+func (s *Store) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)
+	`, jti).Scan(&revoked)
+	return revoked, err
+}
+
+// PruneRevokedAccessTokens drops revocations for tokens that expired before
+// the given time and reports how many were removed.
+func (s *Store) PruneRevokedAccessTokens(ctx context.Context, before time.Time) (int, error) {
+	res, err := s.db.ExecContext(ctx, `
+		DELETE FROM revoked_tokens
+		WHERE expires_at < $1
+	`, before)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(affected), nil
+}
+
+// PruneRefreshTokens drops refresh tokens that expired before the given time
+// or were revoked, and reports how many were removed.
+func (s *Store) PruneRefreshTokens(ctx context.Context, before time.Time) (int, error) {
+	res, err := s.db.ExecContext(ctx, `
+		DELETE FROM refresh_tokens
+		WHERE expires_at < $1 OR revoked = true
+	`, before)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(affected), nil
+}
+
+// GetOfflineEnvelope returns the response recorded for an envelope that has
+// not expired at the given time.
+func (s *Store) GetOfflineEnvelope(ctx context.Context, storeID string, terminalID string, envelopeID string, at time.Time) (*domain.OfflineSyncResponse, error) {
+	var payload []byte
+	err := s.db.QueryRowContext(ctx, `
+		SELECT response
+		FROM offline_sync_envelopes
+		WHERE store_id = $1 AND terminal_id = $2 AND envelope_id = $3 AND expires_at > $4
+	`, storeID, terminalID, envelopeID, at).Scan(&payload)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, err
+	}
+
+	var resp domain.OfflineSyncResponse
+	if err := json.Unmarshal(payload, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SaveOfflineEnvelope records the response for an envelope, replacing any
+// earlier record for the same envelope.
+func (s *Store) SaveOfflineEnvelope(ctx context.Context, storeID string, terminalID string, resp domain.OfflineSyncResponse, expiresAt time.Time) error {
+	if resp.EnvelopeID == "" {
+		return store.ErrInvalidTransaction
+	}
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO offline_sync_envelopes (store_id, terminal_id, envelope_id, response, expires_at)
+		VALUES ($1,$2,$3,$4,$5)
+		ON CONFLICT (store_id, terminal_id, envelope_id)
+		DO UPDATE SET response = EXCLUDED.response, expires_at = EXCLUDED.expires_at, created_at = now()
+	`, storeID, terminalID, resp.EnvelopeID, payload, expiresAt)
+	return err
+}
+
+// PruneOfflineEnvelopes drops envelope records that expired before the given
+// time and reports how many were removed.
+func (s *Store) PruneOfflineEnvelopes(ctx context.Context, before time.Time) (int, error) {
+	res, err := s.db.ExecContext(ctx, `
+		DELETE FROM offline_sync_envelopes
+		WHERE expires_at < $1
+	`, before)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(affected), nil
+}
+
 func weightedCostCents(oldCost int64, oldQty int, incomingCost int64, incomingQty int) int64 {
 	if incomingQty <= 0 || incomingCost <= 0 {
 		return oldCost
@@ -2393,6 +5233,33 @@ func uniqueSKUs(items []domain.TransactionLine) []string {
 	return skus
 }
 
+// tagList scans a tags column selected as array_to_json(tags), which
+// database/sql can read as text unlike a text[].
+type tagList []string
+
+func (t *tagList) Scan(src any) error {
+	switch value := src.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(value, (*[]string)(t))
+	case string:
+		return json.Unmarshal([]byte(value), (*[]string)(t))
+	default:
+		return fmt.Errorf("scan tags: unsupported type %T", src)
+	}
+}
+
+// tagsOrEmpty keeps a product without tags from writing NULL into the
+// NOT NULL tags column.
+func tagsOrEmpty(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
 func isUniqueViolation(err error) bool {
 	var pgErr *pgconn.PgError
 	if errors.As(err, &pgErr) {
@@ -2401,6 +5268,14 @@ func isUniqueViolation(err error) bool {
 	return false
 }
 
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23503"
+	}
+	return false
+}
+
 func maxInt64(a int64, b int64) int64 {
 	if a > b {
 		return a
@@ -2412,6 +5287,13 @@ func nowDateUTC(t time.Time) time.Time {
 	return time.Date(t.UTC().Year(), t.UTC().Month(), t.UTC().Day(), 0, 0, 0, 0, time.UTC)
 }
 
+func pickingStrategyOrDefault(strategy string) string {
+	if strategy == "" {
+		return domain.PickingStrategyFEFO
+	}
+	return strategy
+}
+
 func nullIfEmpty(val string) any {
 	if val == "" {
 		return nil
@@ -0,0 +1,141 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"kasirinaja/backend/internal/domain"
+	"kasirinaja/backend/internal/store"
+)
+
+func TestCheckoutDoesNotOversell(t *testing.T) {
+	databaseURL := os.Getenv("KASIRINAJA_TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("set KASIRINAJA_TEST_DATABASE_URL to run postgres integration test")
+	}
+
+	ctx := context.Background()
+	s, err := New(ctx, databaseURL, DefaultPoolConfig())
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+
+	stamp := time.Now().UnixNano()
+	sku := fmt.Sprintf("SKU-OVERSELL-IT-%d", stamp)
+	terminalID := fmt.Sprintf("T-OVERSELL-IT-%d", stamp)
+	storeID := "main-store"
+
+	t.Cleanup(func() {
+		_, _ = s.db.ExecContext(ctx, `DELETE FROM transaction_items WHERE sku = $1`, sku)
+		_, _ = s.db.ExecContext(ctx, `DELETE FROM transactions WHERE terminal_id = $1`, terminalID)
+		_, _ = s.db.ExecContext(ctx, `DELETE FROM inventory_stocks WHERE store_id = $1 AND sku = $2`, storeID, sku)
+		_, _ = s.db.ExecContext(ctx, `DELETE FROM products WHERE sku = $1`, sku)
+	})
+
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO products (sku, name, category, price_cents, margin_rate, active, created_at, updated_at)
+		VALUES ($1, 'Produk Oversell IT', 'snack', 5000, 0.2, true, now(), now())
+	`, sku); err != nil {
+		t.Fatalf("insert product: %v", err)
+	}
+	const initial = 3
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO inventory_stocks (store_id, sku, qty, updated_at)
+		VALUES ($1, $2, $3, now())
+	`, storeID, sku, initial); err != nil {
+		t.Fatalf("seed stock: %v", err)
+	}
+
+	checkout := func(key string) error {
+		_, err := s.CreateCheckout(ctx, domain.Transaction{
+			StoreID:        storeID,
+			TerminalID:     terminalID,
+			IdempotencyKey: fmt.Sprintf("idem-oversell-it-%d-%s", stamp, key),
+			PaymentMethod:  "card",
+			Items:          []domain.TransactionLine{{SKU: sku, Qty: 1}},
+		})
+		return err
+	}
+	stockQty := func() int {
+		var qty int
+		if err := s.db.QueryRowContext(ctx, `
+			SELECT qty
+			FROM inventory_stocks
+			WHERE store_id = $1 AND sku = $2
+		`, storeID, sku).Scan(&qty); err != nil {
+			t.Fatalf("query stock: %v", err)
+		}
+		return qty
+	}
+
+	// Concurrent terminals either sell, find the stock gone or lose the
+	// serializable race; none may take stock below zero.
+	const terminals = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < terminals; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := checkout(fmt.Sprintf("race-%d", i))
+			var pgErr *pgconn.PgError
+			switch {
+			case err == nil:
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			case errors.Is(err, store.ErrInsufficientStock):
+			case errors.As(err, &pgErr) && pgErr.Code == "40001":
+			default:
+				t.Errorf("unexpected checkout error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if succeeded > initial {
+		t.Fatalf("expected at most %d concurrent sales, got %d", initial, succeeded)
+	}
+	if qty := stockQty(); qty != initial-succeeded {
+		t.Fatalf("expected stock %d after %d sales, got %d", initial-succeeded, succeeded, qty)
+	}
+
+	for i := succeeded; i < initial; i++ {
+		if err := checkout(fmt.Sprintf("drain-%d", i)); err != nil {
+			t.Fatalf("checkout %d of the remaining stock failed: %v", i, err)
+		}
+	}
+	if err := checkout("oversell"); !errors.Is(err, store.ErrInsufficientStock) {
+		t.Fatalf("expected ErrInsufficientStock once stock is gone, got %v", err)
+	}
+	if qty := stockQty(); qty != 0 {
+		t.Fatalf("expected stock to end at 0, got %d", qty)
+	}
+
+	// The qty >= 0 check still guards rows not sold with negative stock
+	// allowed.
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE inventory_stocks SET qty = -1 WHERE store_id = $1 AND sku = $2
+	`, storeID, sku); err == nil {
+		t.Fatalf("expected the database to reject negative stock")
+	}
+
+	s.SetAllowNegativeStock(true)
+	if err := checkout("negative"); err != nil {
+		t.Fatalf("expected checkout with negative stock allowed to succeed, got %v", err)
+	}
+	if qty := stockQty(); qty != -1 {
+		t.Fatalf("expected stock -1 with negative stock allowed, got %d", qty)
+	}
+}
@@ -15,7 +15,7 @@ func TestVoidTransactionRestocksInventory(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	s, err := New(ctx, databaseURL)
+	s, err := New(ctx, databaseURL, DefaultPoolConfig())
 	if err != nil {
 		t.Fatalf("new store: %v", err)
 	}
@@ -1,8 +1,13 @@
 package store
 
 import (
+	"cmp"
 	"context"
 	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
 	"time"
 
 	"kasirinaja/backend/internal/domain"
@@ -12,40 +17,205 @@ var (
 	ErrNotFound           = errors.New("not found")
 	ErrInsufficientStock  = errors.New("insufficient stock")
 	ErrInvalidTransaction = errors.New("invalid transaction")
+	ErrShiftAlreadyOpen   = errors.New("shift already open on this terminal")
+	// ErrDuplicateID is returned when a record is created with an ID or SKU
+	// that is already taken. It wraps ErrInvalidTransaction.
+	ErrDuplicateID = fmt.Errorf("%w: id already exists", ErrInvalidTransaction)
+	// ErrDuplicatePromoName is returned when a promo is activated while
+	// another active promo has the same name.
+	ErrDuplicatePromoName = fmt.Errorf("%w: an active promo already uses this name", ErrInvalidTransaction)
+	// ErrProductUnavailable is returned when a sale names a SKU that is not
+	// in the catalog or has been deactivated.
+	ErrProductUnavailable = fmt.Errorf("%w: product not found or inactive", ErrInvalidTransaction)
+	// ErrProductOutOfSeason is returned when a sale names a product outside
+	// its AvailableFrom/AvailableUntil dates.
+	ErrProductOutOfSeason = fmt.Errorf("%w: product not available on this date", ErrInvalidTransaction)
+	// ErrInsufficientStoreCredit is returned when a redemption exceeds the
+	// balance of a store credit code. It wraps ErrInvalidTransaction.
+	ErrInsufficientStoreCredit = fmt.Errorf("%w: insufficient store credit", ErrInvalidTransaction)
+	// ErrShiftClosed is returned when an edit targets a shift that has
+	// already been closed. It wraps ErrInvalidTransaction.
+	ErrShiftClosed = fmt.Errorf("%w: shift is closed", ErrInvalidTransaction)
+	// ErrInvalidState is returned when a sale or purchase order is already
+	// in a status the change cannot apply to, such as voiding a voided sale
+	// or receiving a cancelled order. It wraps ErrInvalidTransaction.
+	ErrInvalidState = fmt.Errorf("%w: not allowed in the current status", ErrInvalidTransaction)
+	// ErrEmptyCart is returned when a checkout has no items.
+	ErrEmptyCart = fmt.Errorf("%w: cart is empty", ErrInvalidTransaction)
+	// ErrInvalidDiscount is returned when a checkout discount is negative or
+	// larger than the subtotal.
+	ErrInvalidDiscount = fmt.Errorf("%w: invalid discount", ErrInvalidTransaction)
+	// ErrInvalidTaxRate is returned when a tax rate is outside 0 to 100
+	// percent.
+	ErrInvalidTaxRate = fmt.Errorf("%w: tax rate must be between 0 and 100", ErrInvalidTransaction)
+	// ErrUnsupportedPaymentMethod is returned for a payment method, or split
+	// leg method, that checkout does not accept.
+	ErrUnsupportedPaymentMethod = fmt.Errorf("%w: unsupported payment method", ErrInvalidTransaction)
+	// ErrInsufficientPayment is returned when the cash received or the sum
+	// of the split legs is below the transaction total.
+	ErrInsufficientPayment = fmt.Errorf("%w: payment is below the total", ErrInvalidTransaction)
+	// ErrInvalidSplitPayment is returned for a split payment with fewer than
+	// two legs, a leg below one cent or change it cannot give.
+	ErrInvalidSplitPayment = fmt.Errorf("%w: invalid split payment", ErrInvalidTransaction)
+	// ErrInvalidSerials is returned when a sale line's serials do not match
+	// its quantity, repeat, or are not available in the store.
+	ErrInvalidSerials = fmt.Errorf("%w: invalid serials", ErrInvalidTransaction)
+	// ErrInvalidInput is returned for settings and account changes that fail
+	// validation, such as a weak password or an oversized receipt line.
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrServiceReadOnly is returned for writes while the database is
+	// unavailable and the service only serves reads.
+	ErrServiceReadOnly = errors.New("service is read-only while the database is unavailable; try again shortly")
 )
 
+// SKUError attaches the SKU a sale failed on to an underlying error such as
+// ErrInsufficientStock, so callers can tell which line to fix.
+type SKUError struct {
+	SKU string
+	Err error
+}
+
+func (e *SKUError) Error() string {
+	return fmt.Sprintf("%v: sku %s", e.Err, e.SKU)
+}
+
+func (e *SKUError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError reports which entry of a batch write failed. The batch was
+// rolled back as a whole.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch entry %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// MissingSKUs returns the SKUs of skus absent from found, in order and
+// without duplicates.
+func MissingSKUs(skus []string, found map[string]domain.Product) []string {
+	var missing []string
+	for _, sku := range skus {
+		if _, ok := found[sku]; ok || slices.Contains(missing, sku) {
+			continue
+		}
+		missing = append(missing, sku)
+	}
+	return missing
+}
+
 type Repository interface {
+	Ping(ctx context.Context) error
 	ListProducts(ctx context.Context) ([]domain.Product, error)
+	// ListAllProducts is ListProducts including inactive products.
+	ListAllProducts(ctx context.Context) ([]domain.Product, error)
 	CreateProduct(ctx context.Context, product domain.Product) (*domain.Product, error)
 	GetProductBySKU(ctx context.Context, sku string) (*domain.Product, error)
 	UpdateProduct(ctx context.Context, product domain.Product) (*domain.Product, error)
 	CreatePriceHistory(ctx context.Context, entry domain.ProductPriceHistory) error
 	ListPriceHistory(ctx context.Context, sku string, limit int) ([]domain.ProductPriceHistory, error)
+	ListPriceChanges(ctx context.Context, from time.Time, to time.Time) ([]domain.ProductPriceHistory, error)
 	GetProductsBySKUs(ctx context.Context, skus []string) (map[string]domain.Product, error)
+	// GetProductsBySKUsDetailed is GetProductsBySKUs that also returns, in
+	// request order and without duplicates, the SKUs that are unknown or
+	// inactive.
+	GetProductsBySKUsDetailed(ctx context.Context, skus []string) (map[string]domain.Product, []string, error)
 	GetStockMap(ctx context.Context, storeID string, skus []string) (map[string]int, error)
 	SetStock(ctx context.Context, storeID string, sku string, qty int) error
+	SetStockBulk(ctx context.Context, storeID string, quantities map[string]int) error
+	CreateStockOpname(ctx context.Context, record domain.StockOpnameRecord) (*domain.StockOpnameRecord, error)
+	GetStockOpname(ctx context.Context, opnameID string) (*domain.StockOpnameRecord, error)
 	CreateInventoryLot(ctx context.Context, lot domain.InventoryLot) (*domain.InventoryLot, error)
+	CreateInventoryLots(ctx context.Context, lots []domain.InventoryLot) ([]domain.InventoryLot, error)
+	GetInventoryLot(ctx context.Context, lotID string) (*domain.InventoryLot, error)
 	ListInventoryLots(ctx context.Context, storeID string, sku string, includeExpired bool, limit int) ([]domain.InventoryLot, error)
+	AdjustLotQty(ctx context.Context, lotID string, qtyAvailable int, audit domain.AuditLog) (*domain.InventoryLot, error)
+	CorrectLotCost(ctx context.Context, lotID string, costCents int64, audit domain.AuditLog) (*domain.InventoryLot, error)
+	ListExpiringLots(ctx context.Context, storeID string, withinDays int) ([]domain.ExpiringLot, error)
+	WriteOffStock(ctx context.Context, writeOff domain.StockWriteOff, audit domain.AuditLog) (*domain.StockWriteOff, error)
+	// TransferStock moves lot.QtyReceived units of lot.SKU from fromStoreID
+	// to lot.StoreID. Units come from the source's unexpired lots in FEFO
+	// order, then from stock no lot tracks; expired lots stay behind. Each
+	// source lot drawn arrives as its own lot with the same expiry and cost
+	// (see TransferLot), and the destination's product cost is re-weighted.
+	TransferStock(ctx context.Context, fromStoreID string, lot domain.InventoryLot, audits []domain.AuditLog) ([]domain.InventoryLot, error)
+	ListSerials(ctx context.Context, storeID string, sku string, status string) ([]domain.InventorySerial, error)
+	ListStockMovements(ctx context.Context, storeID string, sku string, from time.Time, to time.Time) ([]domain.StockMovement, error)
 	GetAssociationPairs(ctx context.Context, sourceSKUs []string) ([]domain.AssociationPair, error)
+	GetCategoryAssociationPairs(ctx context.Context, sourceCategories []string) ([]domain.CategoryAssociationPair, error)
+	UpsertAssociationPair(ctx context.Context, sourceSKU string, targetSKU string, affinity float64) (*domain.AssociationPair, error)
+	DeleteAssociationPair(ctx context.Context, sourceSKU string, targetSKU string) error
 	IncreaseStock(ctx context.Context, storeID string, adjustments []domain.StockAdjustment) error
 	FindTransactionByIdempotency(ctx context.Context, key string) (*domain.Transaction, error)
 	FindTransactionByID(ctx context.Context, id string) (*domain.Transaction, error)
 	CreateCheckout(ctx context.Context, tx domain.Transaction) (*domain.Transaction, error)
+	CreateCheckoutBatch(ctx context.Context, txs []domain.Transaction) ([]*domain.Transaction, error)
+	// VoidTransaction also reverses the store credit the sale issued or
+	// redeemed.
 	VoidTransaction(ctx context.Context, id string, reason string, at time.Time) (*domain.Transaction, error)
+	GetStoreCreditBalance(ctx context.Context, code string) (*domain.StoreCreditBalance, error)
+	// RedeemStoreCredit takes amountCents off code's balance, failing with
+	// ErrInsufficientStoreCredit when the balance does not cover it.
+	RedeemStoreCredit(ctx context.Context, storeID string, code string, amountCents int64, createdBy string, at time.Time) (*domain.StoreCreditEntry, error)
 	CreateRefund(ctx context.Context, refund domain.Refund) (*domain.Refund, error)
 	GetReturnedQtyByTransaction(ctx context.Context, transactionID string) (map[string]int, error)
 	CreateItemReturn(ctx context.Context, itemReturn domain.ItemReturn) (*domain.ItemReturn, error)
 	CreateRecommendationEvent(ctx context.Context, event domain.RecommendationEvent) error
+	CreateRecommendationEventsBatch(ctx context.Context, events []domain.RecommendationEvent) error
 	GetAttachMetrics(ctx context.Context, storeID string, from time.Time, to time.Time) (domain.AttachMetrics, error)
+	GetAttachMetricsByReason(ctx context.Context, storeID string, from time.Time, to time.Time) ([]domain.AttachReasonMetrics, error)
 	GetDailyReport(ctx context.Context, storeID string, from time.Time, to time.Time) (domain.DailyReport, error)
+	GetHourlySales(ctx context.Context, storeID string, from time.Time, to time.Time, loc *time.Location) ([]domain.HourlySalesBucket, error)
+	GetRangeReport(ctx context.Context, storeID string, from time.Time, to time.Time, groupBy string, loc *time.Location) ([]domain.RangeReportBucket, error)
+	// GetUnitsSoldBySKU sums the quantities of skus sold in non-voided
+	// transactions created in [from, to). SKUs with no sales are omitted.
+	GetUnitsSoldBySKU(ctx context.Context, storeID string, skus []string, from time.Time, to time.Time) (map[string]int, error)
+	GetInventoryValuation(ctx context.Context, storeID string) ([]domain.InventoryValuationLine, error)
+	// GetSalesBySupplier sums non-voided sales in [from, to) per supplier,
+	// largest revenue first. A SKU is attributed to the supplier of its most
+	// recently received purchase order in storeID or, failing that, to its
+	// most recently updated supplier_products mapping.
+	GetSalesBySupplier(ctx context.Context, storeID string, from time.Time, to time.Time) ([]domain.SupplierSalesLine, error)
 	CreateAuditLog(ctx context.Context, entry domain.AuditLog) error
-	ListAuditLogs(ctx context.Context, storeID string, from time.Time, to time.Time, limit int) ([]domain.AuditLog, error)
-	RebuildAssociationPairs(ctx context.Context, storeID string) (int, error)
+	ListAuditLogs(ctx context.Context, storeID string, from time.Time, to time.Time, filter domain.AuditLogFilter, before *domain.AuditLogCursor, limit int) ([]domain.AuditLog, error)
+	RebuildAssociationPairs(ctx context.Context, storeID string, minLift float64) ([]domain.AssociationPair, error)
 	CreateShift(ctx context.Context, shift domain.Shift) (*domain.Shift, error)
 	CloseActiveShift(ctx context.Context, storeID string, terminalID string, closingCashCents int64, closedAt time.Time) (*domain.Shift, error)
 	GetActiveShift(ctx context.Context, storeID string, terminalID string) (*domain.Shift, error)
+	GetShift(ctx context.Context, shiftID string) (*domain.Shift, error)
+	// UpdateOpenShift replaces an open shift's opening float and notes. A
+	// closed shift is rejected with ErrShiftClosed.
+	UpdateOpenShift(ctx context.Context, shiftID string, openingFloatCents int64, notes string) (*domain.Shift, error)
+	ListShifts(ctx context.Context, storeID string, terminalID string, from time.Time, to time.Time, limit int) ([]domain.Shift, error)
+	ListShiftTransactions(ctx context.Context, shiftID string) ([]domain.Transaction, error)
+	// ListTransactionsByCustomer returns up to limit of a customer's sales,
+	// newest first, with their lines.
+	ListTransactionsByCustomer(ctx context.Context, customerID string, limit int) ([]domain.Transaction, error)
+	ListRefundsByTerminal(ctx context.Context, storeID string, terminalID string, from time.Time, to time.Time) ([]domain.Refund, error)
+	// SaveTerminal registers a terminal or, when it is already registered,
+	// replaces its label and token and lifts any revocation.
+	SaveTerminal(ctx context.Context, terminal domain.Terminal) (*domain.Terminal, error)
+	GetTerminal(ctx context.Context, storeID string, terminalID string) (*domain.Terminal, error)
+	ListTerminals(ctx context.Context, storeID string) ([]domain.Terminal, error)
+	RevokeTerminal(ctx context.Context, storeID string, terminalID string, at time.Time) (*domain.Terminal, error)
+	CreateShiftCashMovement(ctx context.Context, movement domain.ShiftCashMovement) (*domain.ShiftCashMovement, error)
+	ListShiftCashMovements(ctx context.Context, shiftID string) ([]domain.ShiftCashMovement, error)
+	// CreatePromo creates an active promo. When an active promo already has
+	// the same name, ignoring case, it is returned instead, so re-running a
+	// provisioning script does not create duplicates. A reused ID is still
+	// ErrDuplicateID.
 	CreatePromo(ctx context.Context, promo domain.PromoRule) (*domain.PromoRule, error)
 	ListPromos(ctx context.Context) ([]domain.PromoRule, error)
+	GetPromo(ctx context.Context, promoID string) (*domain.PromoRule, error)
+	// UpdatePromoActive activates or deactivates a promo. Activating one
+	// whose name another active promo uses is ErrDuplicatePromoName.
 	UpdatePromoActive(ctx context.Context, promoID string, active bool) (*domain.PromoRule, error)
 	CreateHeldCart(ctx context.Context, held domain.HeldCart) (*domain.HeldCart, error)
 	ListHeldCarts(ctx context.Context, storeID string, terminalID string, limit int) ([]domain.HeldCart, error)
@@ -53,13 +223,272 @@ type Repository interface {
 	DeleteHeldCart(ctx context.Context, holdID string) error
 	CreateSupplier(ctx context.Context, supplier domain.Supplier) (*domain.Supplier, error)
 	ListSuppliers(ctx context.Context) ([]domain.Supplier, error)
+	GetSupplierByID(ctx context.Context, supplierID string) (*domain.Supplier, error)
+	UpdateSupplier(ctx context.Context, supplier domain.Supplier) (*domain.Supplier, error)
+	SetSupplierProduct(ctx context.Context, product domain.SupplierProduct) (*domain.SupplierProduct, error)
+	// ListSupplierProducts filters by supplier when supplierID is set and by
+	// SKU when skus is non-empty.
+	ListSupplierProducts(ctx context.Context, supplierID string, skus []string) ([]domain.SupplierProduct, error)
 	CreatePurchaseOrder(ctx context.Context, po domain.PurchaseOrder) (*domain.PurchaseOrder, error)
 	GetPurchaseOrderByID(ctx context.Context, purchaseOrderID string) (*domain.PurchaseOrder, error)
 	ListPurchaseOrders(ctx context.Context, storeID string, status string, limit int) ([]domain.PurchaseOrder, error)
 	ReceivePurchaseOrder(ctx context.Context, purchaseOrderID string, receivedBy string, receivedAt time.Time) (*domain.PurchaseOrder, error)
+	CancelPurchaseOrder(ctx context.Context, purchaseOrderID string, reason string, cancelledBy string, cancelledAt time.Time) (*domain.PurchaseOrder, error)
 	GetProductCosts(ctx context.Context, storeID string, skus []string) (map[string]int64, error)
 	UpsertProductCost(ctx context.Context, storeID string, sku string, costCents int64) error
 	CreateUser(ctx context.Context, user domain.UserAccount) error
 	ListUsers(ctx context.Context) ([]domain.UserAccount, error)
+	GetUser(ctx context.Context, username string) (*domain.UserAccount, error)
 	UpdateUserPassword(ctx context.Context, username string, password string) error
+	UpdateUserActive(ctx context.Context, username string, active bool) error
+	UpdateUserRole(ctx context.Context, username string, role string) error
+	CreateRefreshToken(ctx context.Context, token domain.RefreshToken) error
+	ConsumeRefreshToken(ctx context.Context, tokenHash string, at time.Time) (*domain.RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, tokenHash string) error
+	RevokeUserRefreshTokens(ctx context.Context, username string) error
+	PruneRefreshTokens(ctx context.Context, before time.Time) (int, error)
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+	PruneRevokedAccessTokens(ctx context.Context, before time.Time) (int, error)
+	GetOfflineEnvelope(ctx context.Context, storeID string, terminalID string, envelopeID string, at time.Time) (*domain.OfflineSyncResponse, error)
+	SaveOfflineEnvelope(ctx context.Context, storeID string, terminalID string, resp domain.OfflineSyncResponse, expiresAt time.Time) error
+	PruneOfflineEnvelopes(ctx context.Context, before time.Time) (int, error)
+}
+
+// TransferLot returns the n-th destination lot of a transfer, carrying qty
+// units at costCents each with the source lot's expiry. The first lot keeps
+// template's ID and lot code; later ones get a "-2", "-3", ... suffix.
+func TransferLot(template domain.InventoryLot, n int, qty int, costCents int64, expiry *time.Time) domain.InventoryLot {
+	lot := template
+	if n > 0 {
+		lot.ID = fmt.Sprintf("%s-%d", template.ID, n+1)
+		lot.LotCode = fmt.Sprintf("%s-%d", template.LotCode, n+1)
+	}
+	lot.QtyReceived = qty
+	lot.QtyAvailable = qty
+	lot.CostCents = max(costCents, 1)
+	lot.ExpiryDate = nil
+	if expiry != nil {
+		date := *expiry
+		lot.ExpiryDate = &date
+	}
+	return lot
+}
+
+// SaleUnitCost returns the cost frozen on a sold line: the store's recorded
+// cost for the SKU, or a margin-derived estimate when none is recorded.
+func SaleUnitCost(product domain.Product, costCents int64) int64 {
+	if costCents > 0 {
+		return costCents
+	}
+	if product.PriceCents < 1 {
+		return 0
+	}
+	return max(int64(math.Round(float64(product.PriceCents)*(1-product.MarginRate))), 1)
+}
+
+// VoidRestockCost returns the unit cost a voided line goes back into stock
+// at: the cost frozen on the line, or the SKU's current cost for lines sold
+// before costs were frozen. It is zero when neither is known.
+func VoidRestockCost(line domain.TransactionLine, currentCostCents int64) int64 {
+	if line.UnitCostCents > 0 {
+		return line.UnitCostCents
+	}
+	return max(currentCostCents, 0)
+}
+
+// CheckoutStoreCredits returns the ledger entries a sale makes, without IDs:
+// one redemption per store credit code in its payment splits and, when
+// tx.StoreCreditCode is set, an issue entry for what was paid over the total.
+// That change is moved from tx.ChangeCents to tx.StoreCreditCents. Callers
+// must check each redeemed code's balance.
+func CheckoutStoreCredits(tx *domain.Transaction) []domain.StoreCreditEntry {
+	var entries []domain.StoreCreditEntry
+	redeemed := map[string]int{}
+	for _, split := range tx.PaymentSplits {
+		if split.Method != "store_credit" {
+			continue
+		}
+		if i, ok := redeemed[split.Reference]; ok {
+			entries[i].AmountCents -= split.AmountCents
+			continue
+		}
+		redeemed[split.Reference] = len(entries)
+		entries = append(entries, domain.StoreCreditEntry{
+			StoreID:       tx.StoreID,
+			Code:          split.Reference,
+			Kind:          domain.StoreCreditKindRedeem,
+			AmountCents:   -split.AmountCents,
+			TransactionID: tx.ID,
+			CreatedAt:     tx.CreatedAt,
+		})
+	}
+
+	if tx.StoreCreditCode != "" {
+		tx.StoreCreditCents = max(tx.CashReceivedCents-tx.TotalCents, 0)
+		tx.ChangeCents = 0
+		if tx.StoreCreditCents > 0 {
+			entries = append(entries, domain.StoreCreditEntry{
+				StoreID:       tx.StoreID,
+				Code:          tx.StoreCreditCode,
+				Kind:          domain.StoreCreditKindIssue,
+				AmountCents:   tx.StoreCreditCents,
+				TransactionID: tx.ID,
+				CreatedAt:     tx.CreatedAt,
+			})
+		}
+	}
+	return entries
+}
+
+// LineTaxRate is the tax rate charged on a line of product: the product's own
+// rate when it has one, otherwise the sale's default rate.
+func LineTaxRate(product domain.Product, defaultRatePercent float64) float64 {
+	if product.TaxRatePercent != nil {
+		return *product.TaxRatePercent
+	}
+	return defaultRatePercent
+}
+
+// NormalizeMarginRate returns rate as a fraction of the price. Rates up to 1
+// are already fractions; rates above 1 and up to 100 are read as percentages,
+// so 30 means 0.3. It reports false for negative rates and rates above 100.
+func NormalizeMarginRate(rate float64) (float64, bool) {
+	switch {
+	case rate < 0 || rate > 100 || math.IsNaN(rate):
+		return 0, false
+	case rate > 1:
+		return rate / 100, true
+	}
+	return rate, true
+}
+
+// ValidTaxRate reports whether product's own tax rate, if set, is a
+// percentage between 0 and 100.
+func ValidTaxRate(product domain.Product) bool {
+	return product.TaxRatePercent == nil || (*product.TaxRatePercent >= 0 && *product.TaxRatePercent <= 100)
+}
+
+// ValidAvailability reports whether product's availability window, if both
+// ends are set, does not end before it starts.
+func ValidAvailability(product domain.Product) bool {
+	return product.AvailableFrom == nil || product.AvailableUntil == nil || !product.AvailableUntil.Before(*product.AvailableFrom)
+}
+
+// AvailableOn reports whether day, a calendar date at midnight UTC, falls
+// inside product's availability window. Both ends are inclusive and a nil end
+// is open.
+func AvailableOn(product domain.Product, day time.Time) bool {
+	if product.AvailableFrom != nil && day.Before(*product.AvailableFrom) {
+		return false
+	}
+	if product.AvailableUntil != nil && day.After(*product.AvailableUntil) {
+		return false
+	}
+	return true
+}
+
+// Limits on product tags, so a tag stays a short label rather than a
+// description.
+const (
+	MaxProductTags   = 20
+	MaxProductTagLen = 32
+)
+
+// NormalizeTags trims and lowercases tags and drops empty ones and repeats,
+// keeping the order they were first given in.
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// ValidTags reports whether product's tags are normalized as NormalizeTags
+// leaves them and within MaxProductTags and MaxProductTagLen.
+func ValidTags(product domain.Product) bool {
+	if len(product.Tags) > MaxProductTags {
+		return false
+	}
+	for i, tag := range product.Tags {
+		if tag == "" || len(tag) > MaxProductTagLen || tag != strings.ToLower(strings.TrimSpace(tag)) || slices.Contains(product.Tags[:i], tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// ApplyLineTaxes spreads discountCents over lines in proportion to their
+// gross amounts, then sets each line's taxable base and tax from its
+// TaxRatePercent, and returns the sale's tax. Tax is rounded to the nearest
+// cent once per rate, so a sale with a single rate is taxed exactly
+// (subtotal - discount) * rate as before per-line rates.
+func ApplyLineTaxes(lines []domain.TransactionLine, discountCents int64) int64 {
+	gross := make([]int64, len(lines))
+	var subtotalCents int64
+	for i, line := range lines {
+		gross[i] = line.UnitPriceCents * int64(line.Qty)
+		subtotalCents += gross[i]
+	}
+	discounts := allocate(discountCents, gross, subtotalCents)
+	for i := range lines {
+		lines[i].TaxableBaseCents = gross[i] - discounts[i]
+	}
+
+	var taxCents int64
+	for _, rate := range TaxBreakdown(lines) {
+		tax := int64(math.Round(float64(rate.TaxableBaseCents) * rate.RatePercent / 100))
+		indexes := make([]int, 0, len(lines))
+		bases := make([]int64, 0, len(lines))
+		for i, line := range lines {
+			if line.TaxRatePercent == rate.RatePercent {
+				indexes = append(indexes, i)
+				bases = append(bases, line.TaxableBaseCents)
+			}
+		}
+		for j, share := range allocate(tax, bases, rate.TaxableBaseCents) {
+			lines[indexes[j]].TaxCents = share
+		}
+		taxCents += tax
+	}
+	return taxCents
+}
+
+// allocate splits amount over weights in proportion, rounding on running
+// totals so the shares add up to amount and none exceeds its weight when
+// amount is at most total.
+func allocate(amount int64, weights []int64, total int64) []int64 {
+	shares := make([]int64, len(weights))
+	if total <= 0 {
+		return shares
+	}
+	var running, allocated int64
+	for i, weight := range weights {
+		running += weight
+		next := amount * running / total
+		shares[i] = next - allocated
+		allocated = next
+	}
+	return shares
+}
+
+// TaxBreakdown totals the taxable base and tax of lines by rate, lowest rate
+// first.
+func TaxBreakdown(lines []domain.TransactionLine) []domain.TaxRateTotal {
+	totals := make([]domain.TaxRateTotal, 0, 2)
+	for _, line := range lines {
+		i := slices.IndexFunc(totals, func(total domain.TaxRateTotal) bool { return total.RatePercent == line.TaxRatePercent })
+		if i < 0 {
+			totals = append(totals, domain.TaxRateTotal{RatePercent: line.TaxRatePercent})
+			i = len(totals) - 1
+		}
+		totals[i].TaxableBaseCents += line.TaxableBaseCents
+		totals[i].TaxCents += line.TaxCents
+	}
+	slices.SortFunc(totals, func(a, b domain.TaxRateTotal) int { return cmp.Compare(a.RatePercent, b.RatePercent) })
+	return totals
 }
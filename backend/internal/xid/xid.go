@@ -2,15 +2,118 @@ package xid
 
 import (
 	"crypto/rand"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 )
 
-func New(prefix string) string {
+// Strategy names accepted by NewGenerator.
+const (
+	StrategyRandom = "random"
+	StrategyULID   = "ulid"
+)
+
+// Generator creates IDs of the form "<prefix>-<suffix>".
+type Generator interface {
+	New(prefix string) string
+}
+
+// Random is the original format: prefix, Unix nanoseconds and 8 random
+// bytes in hex.
+type Random struct{}
+
+func (Random) New(prefix string) string {
 	buf := make([]byte, 8)
 	if _, err := rand.Read(buf); err != nil {
 		return fmt.Sprintf("%s-%d", prefix, time.Now().UnixNano())
 	}
 	return fmt.Sprintf("%s-%d-%s", prefix, time.Now().UnixNano(), hex.EncodeToString(buf))
 }
+
+// ULID suffixes the prefix with a ULID: a millisecond timestamp and 80 random
+// bits in Crockford base32, so IDs with the same prefix sort by creation
+// time as plain strings.
+type ULID struct{}
+
+func (ULID) New(prefix string) string {
+	return prefix + "-" + newULID(time.Now())
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func newULID(at time.Time) string {
+	var raw [16]byte
+	ms := uint64(at.UnixMilli())
+	var stamp [8]byte
+	binary.BigEndian.PutUint64(stamp[:], ms)
+	copy(raw[:6], stamp[2:])
+	if _, err := rand.Read(raw[6:]); err != nil {
+		binary.BigEndian.PutUint64(raw[8:], uint64(at.UnixNano()))
+	}
+
+	// 128 bits encode to 26 characters of 5 bits; the first character only
+	// carries the top 3 bits.
+	out := make([]byte, 26)
+	for i := range out {
+		bit := i*5 - 2
+		value := 0
+		for j := range 5 {
+			value <<= 1
+			if b := bit + j; b >= 0 && raw[b/8]&(0x80>>(b%8)) != 0 {
+				value |= 1
+			}
+		}
+		out[i] = crockford[value]
+	}
+	return string(out)
+}
+
+// NewGenerator returns the generator for a strategy name. An empty name
+// selects Random.
+func NewGenerator(strategy string) (Generator, error) {
+	switch strings.ToLower(strings.TrimSpace(strategy)) {
+	case "", StrategyRandom:
+		return Random{}, nil
+	case StrategyULID:
+		return ULID{}, nil
+	}
+	return nil, fmt.Errorf("unknown id strategy %q, want %s or %s", strategy, StrategyRandom, StrategyULID)
+}
+
+var (
+	mu        sync.RWMutex
+	generator Generator = Random{}
+)
+
+// SetDefault replaces the generator used by New.
+func SetDefault(g Generator) {
+	if g == nil {
+		g = Random{}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	generator = g
+}
+
+// Default returns the generator used by New.
+func Default() Generator {
+	mu.RLock()
+	defer mu.RUnlock()
+	return generator
+}
+
+func New(prefix string) string {
+	return Default().New(prefix)
+}
+
+var clientIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// ValidClientID reports whether id is acceptable as a caller-supplied ID:
+// 1 to 64 letters, digits, '.', '_' or '-', starting with a letter or digit.
+func ValidClientID(id string) bool {
+	return clientIDPattern.MatchString(id)
+}
@@ -0,0 +1,51 @@
+package xid
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestULIDSortsByCreationTime(t *testing.T) {
+	earlier := newULID(time.UnixMilli(1_700_000_000_000))
+	later := newULID(time.UnixMilli(1_700_000_000_001))
+	if len(earlier) != 26 || len(later) != 26 {
+		t.Fatalf("expected 26 character ULIDs, got %q and %q", earlier, later)
+	}
+	if earlier >= later {
+		t.Fatalf("expected %q to sort before %q", earlier, later)
+	}
+	if earlier[:10] != "01HF7YAT00" {
+		t.Fatalf("unexpected timestamp encoding %q", earlier[:10])
+	}
+
+	id := ULID{}.New("tx")
+	if !strings.HasPrefix(id, "tx-") || !ValidClientID(id) {
+		t.Fatalf("unexpected ULID id %q", id)
+	}
+}
+
+func TestNewGenerator(t *testing.T) {
+	for strategy, want := range map[string]Generator{"": Random{}, "random": Random{}, " ULID ": ULID{}} {
+		got, err := NewGenerator(strategy)
+		if err != nil || got != want {
+			t.Fatalf("strategy %q: expected %T, got %T (%v)", strategy, want, got, err)
+		}
+	}
+	if _, err := NewGenerator("uuid"); err == nil {
+		t.Fatalf("expected an unknown strategy to be rejected")
+	}
+}
+
+func TestValidClientID(t *testing.T) {
+	for _, id := range []string{"promo-ramadan-2026", "SUP_001", "po.2026.07"} {
+		if !ValidClientID(id) {
+			t.Fatalf("expected %q to be valid", id)
+		}
+	}
+	for _, id := range []string{"", "-leading", "has space", "semi;colon", strings.Repeat("a", 65)} {
+		if ValidClientID(id) {
+			t.Fatalf("expected %q to be rejected", id)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS stock_adjustments (
+    id TEXT PRIMARY KEY,
+    store_id TEXT NOT NULL,
+    sku TEXT NOT NULL REFERENCES products(sku) ON DELETE CASCADE,
+    adjustment_type TEXT NOT NULL CHECK (adjustment_type IN ('write_off')),
+    qty_delta INTEGER NOT NULL CHECK (qty_delta <> 0),
+    cost_cents BIGINT NOT NULL DEFAULT 0 CHECK (cost_cents >= 0),
+    reason TEXT NOT NULL DEFAULT '',
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_adjustments_store_created_at
+    ON stock_adjustments (store_id, created_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_stock_adjustments_type_created_at
+    ON stock_adjustments (adjustment_type, created_at DESC);
@@ -0,0 +1,3 @@
+ALTER TABLE inventory_lots DROP CONSTRAINT IF EXISTS inventory_lots_source_type_check;
+ALTER TABLE inventory_lots ADD CONSTRAINT inventory_lots_source_type_check
+    CHECK (source_type IN ('manual', 'purchase_order', 'void', 'return', 'transfer'));
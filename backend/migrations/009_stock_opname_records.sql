@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS opname_records (
+    id TEXT PRIMARY KEY,
+    store_id TEXT NOT NULL,
+    notes TEXT NOT NULL DEFAULT '',
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS opname_items (
+    id BIGSERIAL PRIMARY KEY,
+    opname_id TEXT NOT NULL REFERENCES opname_records(id) ON DELETE CASCADE,
+    sku TEXT NOT NULL REFERENCES products(sku) ON DELETE CASCADE,
+    system_qty INTEGER NOT NULL,
+    counted_qty INTEGER NOT NULL CHECK (counted_qty >= 0),
+    delta_qty INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_opname_records_store_created_at
+    ON opname_records (store_id, created_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_opname_items_opname_id
+    ON opname_items (opname_id);
@@ -0,0 +1,6 @@
+-- Stock may only go below zero on rows written while ALLOW_NEGATIVE_STOCK is
+-- on. Every other row keeps the database-level guard against overselling.
+ALTER TABLE inventory_stocks ADD COLUMN IF NOT EXISTS allow_negative BOOLEAN NOT NULL DEFAULT false;
+UPDATE inventory_stocks SET allow_negative = true WHERE qty < 0;
+ALTER TABLE inventory_stocks DROP CONSTRAINT IF EXISTS inventory_stocks_qty_check;
+ALTER TABLE inventory_stocks ADD CONSTRAINT inventory_stocks_qty_check CHECK (qty >= 0 OR allow_negative);
@@ -0,0 +1,19 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS serialized BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS inventory_serials (
+    sku TEXT NOT NULL REFERENCES products(sku) ON DELETE CASCADE,
+    serial TEXT NOT NULL,
+    store_id TEXT NOT NULL,
+    lot_id TEXT NOT NULL REFERENCES inventory_lots(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'available' CHECK (status IN ('available', 'sold')),
+    transaction_id TEXT NULL REFERENCES transactions(id) ON DELETE SET NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    sold_at TIMESTAMPTZ NULL,
+    PRIMARY KEY (sku, serial)
+);
+
+CREATE INDEX IF NOT EXISTS idx_inventory_serials_store_sku_status
+    ON inventory_serials (store_id, sku, status);
+
+CREATE INDEX IF NOT EXISTS idx_inventory_serials_transaction
+    ON inventory_serials (transaction_id);
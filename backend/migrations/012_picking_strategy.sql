@@ -0,0 +1,4 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS picking_strategy TEXT NOT NULL DEFAULT 'fefo';
+
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_picking_strategy_check;
+ALTER TABLE products ADD CONSTRAINT products_picking_strategy_check CHECK (picking_strategy IN ('fefo', 'fifo'));
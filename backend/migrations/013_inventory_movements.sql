@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS inventory_movements (
+    id BIGSERIAL PRIMARY KEY,
+    store_id TEXT NOT NULL,
+    sku TEXT NOT NULL REFERENCES products(sku) ON DELETE CASCADE,
+    delta INTEGER NOT NULL CHECK (delta <> 0),
+    reason TEXT NOT NULL,
+    ref_id TEXT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_inventory_movements_store_sku_created_at
+    ON inventory_movements (store_id, sku, created_at);
+
+CREATE INDEX IF NOT EXISTS idx_inventory_movements_store_created_at
+    ON inventory_movements (store_id, created_at);
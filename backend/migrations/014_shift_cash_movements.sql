@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS shift_cash_movements (
+    id TEXT PRIMARY KEY,
+    shift_id TEXT NOT NULL REFERENCES shifts(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('drop', 'paid_in', 'paid_out')),
+    amount_cents BIGINT NOT NULL CHECK (amount_cents > 0),
+    note TEXT NOT NULL DEFAULT '',
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_shift_cash_movements_shift_created_at
+    ON shift_cash_movements (shift_id, created_at);
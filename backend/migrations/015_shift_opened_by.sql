@@ -0,0 +1 @@
+ALTER TABLE shifts ADD COLUMN IF NOT EXISTS opened_by TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE recommendation_events ADD COLUMN IF NOT EXISTS experiment_bucket TEXT NOT NULL DEFAULT '';
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS experiment_bucket TEXT NOT NULL DEFAULT '';
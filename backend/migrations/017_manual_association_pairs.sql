@@ -0,0 +1 @@
+ALTER TABLE association_item_pairs ADD COLUMN IF NOT EXISTS manual BOOLEAN NOT NULL DEFAULT false;
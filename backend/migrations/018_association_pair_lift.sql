@@ -0,0 +1 @@
+ALTER TABLE association_item_pairs ALTER COLUMN lift TYPE NUMERIC(12,6);
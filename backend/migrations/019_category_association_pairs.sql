@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS association_category_pairs (
+    source_category TEXT NOT NULL,
+    target_category TEXT NOT NULL,
+    affinity_score NUMERIC(8,6) NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (source_category, target_category)
+);
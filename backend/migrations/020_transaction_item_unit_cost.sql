@@ -0,0 +1 @@
+ALTER TABLE transaction_items ADD COLUMN IF NOT EXISTS unit_cost_cents BIGINT NOT NULL DEFAULT 0;
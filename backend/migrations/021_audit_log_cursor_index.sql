@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_audit_logs_store_created_at_id
+    ON audit_logs (store_id, created_at DESC, id DESC);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS offline_sync_envelopes (
+    store_id TEXT NOT NULL,
+    terminal_id TEXT NOT NULL,
+    envelope_id TEXT NOT NULL,
+    response JSONB NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (store_id, terminal_id, envelope_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_offline_sync_envelopes_expires_at
+    ON offline_sync_envelopes (expires_at);
@@ -0,0 +1,4 @@
+ALTER TABLE purchase_orders
+    ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS cancelled_by TEXT,
+    ADD COLUMN IF NOT EXISTS cancel_reason TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS supplier_products (
+    supplier_id TEXT NOT NULL REFERENCES suppliers(id) ON DELETE CASCADE,
+    sku TEXT NOT NULL REFERENCES products(sku),
+    default_cost_cents BIGINT NOT NULL DEFAULT 0 CHECK (default_cost_cents >= 0),
+    lead_time_days INTEGER NOT NULL DEFAULT 0 CHECK (lead_time_days >= 0),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (supplier_id, sku)
+);
+
+CREATE INDEX IF NOT EXISTS idx_supplier_products_sku ON supplier_products (sku);
@@ -0,0 +1,17 @@
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS store_credit_code TEXT,
+    ADD COLUMN IF NOT EXISTS store_credit_cents BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS store_credits (
+    id TEXT PRIMARY KEY,
+    store_id TEXT NOT NULL,
+    code TEXT NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('issue', 'redeem', 'void')),
+    amount_cents BIGINT NOT NULL CHECK (amount_cents <> 0),
+    transaction_id TEXT REFERENCES transactions(id),
+    created_by TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_store_credits_code ON store_credits (code, created_at);
+CREATE INDEX IF NOT EXISTS idx_store_credits_transaction ON store_credits (transaction_id);
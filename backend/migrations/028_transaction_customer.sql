@@ -0,0 +1,6 @@
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS customer_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_transactions_customer
+    ON transactions (customer_id, created_at DESC)
+    WHERE customer_id IS NOT NULL;
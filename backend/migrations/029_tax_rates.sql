@@ -0,0 +1,21 @@
+-- Per-product tax rates. NULL charges the rate given at checkout.
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS tax_rate_percent NUMERIC(6,3);
+
+ALTER TABLE transaction_items
+    ADD COLUMN IF NOT EXISTS tax_rate_percent NUMERIC(6,3) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS taxable_base_cents BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS tax_cents BIGINT NOT NULL DEFAULT 0;
+
+-- Lines sold before per-line tax take the sale's rate and a share of its
+-- discount and tax in proportion to their amount. Rounding may leave these
+-- a cent off the sale's totals.
+UPDATE transaction_items ti
+SET tax_rate_percent = t.tax_rate_percent,
+    taxable_base_cents = ROUND(ti.unit_price_cents * ti.qty * (t.subtotal_cents - t.discount_cents)::numeric / t.subtotal_cents),
+    tax_cents = ROUND(ti.unit_price_cents * ti.qty * t.tax_cents::numeric / t.subtotal_cents)
+FROM transactions t
+WHERE t.id = ti.transaction_id
+    AND t.subtotal_cents > 0
+    AND ti.taxable_base_cents = 0
+    AND ti.tax_cents = 0;
@@ -0,0 +1,3 @@
+-- Set when the terminal's timestamp was ignored for being too far from
+-- server time.
+ALTER TABLE recommendation_events ADD COLUMN IF NOT EXISTS clock_skew BOOLEAN NOT NULL DEFAULT FALSE;
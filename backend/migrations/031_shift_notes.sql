@@ -0,0 +1,2 @@
+-- Free-text notes attached to a shift while it is open.
+ALTER TABLE shifts ADD COLUMN IF NOT EXISTS notes TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,10 @@
+-- Product name at the time of sale, so receipts reprint what was sold after
+-- the product is renamed.
+ALTER TABLE transaction_items ADD COLUMN IF NOT EXISTS name TEXT NOT NULL DEFAULT '';
+
+-- Lines sold before names were kept take the product's current name.
+UPDATE transaction_items ti
+SET name = p.name
+FROM products p
+WHERE p.sku = ti.sku
+    AND ti.name = '';
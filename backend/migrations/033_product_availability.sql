@@ -0,0 +1,8 @@
+-- Seasonal availability: outside these dates a product is listed and sold
+-- as if inactive. NULL leaves that end open.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS available_from DATE;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS available_until DATE;
+
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_availability_order;
+ALTER TABLE products ADD CONSTRAINT products_availability_order
+    CHECK (available_from IS NULL OR available_until IS NULL OR available_from <= available_until);
@@ -0,0 +1,13 @@
+-- Registered POS terminals. With REQUIRE_REGISTERED_TERMINALS on, checkout
+-- and shift requests must present the terminal's token; only its SHA-256
+-- hash is stored.
+CREATE TABLE IF NOT EXISTS terminals (
+    store_id TEXT NOT NULL,
+    terminal_id TEXT NOT NULL,
+    label TEXT NOT NULL DEFAULT '',
+    token_hash TEXT NOT NULL,
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ,
+    PRIMARY KEY (store_id, terminal_id)
+);
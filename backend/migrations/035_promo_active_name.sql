@@ -0,0 +1,18 @@
+-- At most one active promo per name, ignoring case, so re-running a
+-- provisioning script reuses the promo instead of stacking a second one.
+-- Inactive promos are left out, so a retired name can be used again.
+-- Existing duplicates keep only their oldest active row.
+UPDATE promo_rules AS dup
+SET active = false, updated_at = now()
+WHERE dup.active
+  AND EXISTS (
+      SELECT 1
+      FROM promo_rules AS kept
+      WHERE kept.active
+        AND lower(kept.name) = lower(dup.name)
+        AND (kept.created_at, kept.id) < (dup.created_at, dup.id)
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_promo_rules_active_name
+    ON promo_rules (lower(name))
+    WHERE active;
@@ -0,0 +1,4 @@
+-- Brand and free-form tags (e.g. 'halal') group products across categories
+-- for filtering and reporting. Tags are stored lowercase and unique.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS brand TEXT NOT NULL DEFAULT '';
+ALTER TABLE products ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
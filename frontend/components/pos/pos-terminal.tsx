@@ -16,6 +16,7 @@ import {
   fetchAttachRate,
   fetchAuditLogs,
   fetchCashiers,
+  fetchClientConfig,
   fetchDailyReport,
   fetchDailyReportCSV,
   fetchDailyReportPrintableHTML,
@@ -75,6 +76,7 @@ import type {
   AuditLog,
   AttachRateMetrics,
   CashierUser,
+  ClientConfig,
   CartItem,
   CheckoutRequest,
   CheckoutResponse,
@@ -111,6 +113,13 @@ import {
 import { Input } from "@/components/ui/input";
 
 const STORE_ID = "main-store";
+const DEFAULT_PAYMENT_METHODS: ClientConfig["payment_methods"] = ["cash", "card", "qris", "ewallet"];
+const PAYMENT_METHOD_LABELS: Record<ClientConfig["payment_methods"][number], string> = {
+  cash: "Tunai",
+  card: "Kartu",
+  qris: "QRIS",
+  ewallet: "E-Wallet",
+};
 const TERMINAL_ID = "terminal-a1";
 
 type CartLine = {
@@ -259,6 +268,8 @@ export function POSTerminal() {
   const [cart, setCart] = useState<CartLine[]>([]);
   const [cashInput, setCashInput] = useState("");
   const [paymentMethod, setPaymentMethod] = useState<PaymentMethod>("cash");
+  const [enabledPaymentMethods, setEnabledPaymentMethods] =
+    useState<ClientConfig["payment_methods"]>(DEFAULT_PAYMENT_METHODS);
   const [paymentReference, setPaymentReference] = useState("");
   const [splitCashInput, setSplitCashInput] = useState("");
   const [splitCardInput, setSplitCardInput] = useState("");
@@ -554,6 +565,19 @@ export function POSTerminal() {
         setProducts(productList);
         setMetrics(attachRate);
         setActiveShift(shift?.shift ?? null);
+        try {
+          const config = await fetchClientConfig(authToken, STORE_ID);
+          if (mounted) {
+            setEnabledPaymentMethods(config.payment_methods);
+            setPaymentMethod((current) =>
+              current === "split" || config.payment_methods.some((method) => method === current)
+                ? current
+                : config.payment_methods[0],
+            );
+          }
+        } catch (error) {
+          console.error("[pos] config hydration failed:", error);
+        }
         try {
           const holds = await fetchHeldCarts(authToken, STORE_ID, TERMINAL_ID);
           if (mounted) {
@@ -568,7 +592,7 @@ export function POSTerminal() {
             fetchPromos(authToken),
             fetchAuditLogs(authToken, STORE_ID, reportDate, 50),
             fetchSuppliers(authToken),
-            fetchPurchaseOrders(authToken).then((payload) => payload.purchase_orders),
+            fetchPurchaseOrders(authToken, STORE_ID).then((payload) => payload.purchase_orders),
             fetchReorderSuggestions(authToken, STORE_ID).then((payload) => payload.suggestions),
             fetchOperationalAlerts(authToken, STORE_ID, reportDate).then((payload) => payload.alerts),
             fetchCashiers(authToken),
@@ -1039,7 +1063,7 @@ export function POSTerminal() {
     try {
       const [supplierList, poList, reorder, lots] = await Promise.all([
         fetchSuppliers(auth.accessToken),
-        fetchPurchaseOrders(auth.accessToken).then((payload) => payload.purchase_orders),
+        fetchPurchaseOrders(auth.accessToken, STORE_ID).then((payload) => payload.purchase_orders),
         fetchReorderSuggestions(auth.accessToken, STORE_ID).then((payload) => payload.suggestions),
         fetchInventoryLots(auth.accessToken, STORE_ID, lotFilterSKUInput.trim().toUpperCase(), true, 120),
       ]);
@@ -2208,10 +2232,11 @@ export function POSTerminal() {
                           value={paymentMethod}
                           onChange={(event) => setPaymentMethod(event.target.value as PaymentMethod)}
                         >
-                          <option value="cash">Tunai</option>
-                          <option value="card">Kartu</option>
-                          <option value="qris">QRIS</option>
-                          <option value="ewallet">E-Wallet</option>
+                          {enabledPaymentMethods.map((method) => (
+                            <option key={method} value={method}>
+                              {PAYMENT_METHOD_LABELS[method]}
+                            </option>
+                          ))}
                           <option value="split">Split Payment</option>
                         </select>
                       </div>
@@ -2245,30 +2270,42 @@ export function POSTerminal() {
 
                       {paymentMethod === "split" ? (
                         <>
-                          <div>
-                            <p className="mb-1 text-xs uppercase tracking-[0.08em] text-[var(--c-text-muted)]">Split Tunai</p>
-                            <Input inputMode="numeric" value={splitCashInput} onChange={(event) => setSplitCashInput(event.target.value)} placeholder="0" />
-                          </div>
-                          <div>
-                            <p className="mb-1 text-xs uppercase tracking-[0.08em] text-[var(--c-text-muted)]">Split Kartu</p>
-                            <Input inputMode="numeric" value={splitCardInput} onChange={(event) => setSplitCardInput(event.target.value)} placeholder="0" />
-                          </div>
-                          <div>
-                            <p className="mb-1 text-xs uppercase tracking-[0.08em] text-[var(--c-text-muted)]">Split QRIS</p>
-                            <Input inputMode="numeric" value={splitQrisInput} onChange={(event) => setSplitQrisInput(event.target.value)} placeholder="0" />
-                          </div>
-                          <div>
-                            <p className="mb-1 text-xs uppercase tracking-[0.08em] text-[var(--c-text-muted)]">Ref QRIS</p>
-                            <Input value={splitQrisReference} onChange={(event) => setSplitQrisReference(event.target.value)} placeholder="Opsional" />
-                          </div>
-                          <div>
-                            <p className="mb-1 text-xs uppercase tracking-[0.08em] text-[var(--c-text-muted)]">Split E-Wallet</p>
-                            <Input inputMode="numeric" value={splitEwalletInput} onChange={(event) => setSplitEwalletInput(event.target.value)} placeholder="0" />
-                          </div>
-                          <div>
-                            <p className="mb-1 text-xs uppercase tracking-[0.08em] text-[var(--c-text-muted)]">Ref E-Wallet</p>
-                            <Input value={splitEwalletReference} onChange={(event) => setSplitEwalletReference(event.target.value)} placeholder="Opsional" />
-                          </div>
+                          {enabledPaymentMethods.includes("cash") ? (
+                            <div>
+                              <p className="mb-1 text-xs uppercase tracking-[0.08em] text-[var(--c-text-muted)]">Split Tunai</p>
+                              <Input inputMode="numeric" value={splitCashInput} onChange={(event) => setSplitCashInput(event.target.value)} placeholder="0" />
+                            </div>
+                          ) : null}
+                          {enabledPaymentMethods.includes("card") ? (
+                            <div>
+                              <p className="mb-1 text-xs uppercase tracking-[0.08em] text-[var(--c-text-muted)]">Split Kartu</p>
+                              <Input inputMode="numeric" value={splitCardInput} onChange={(event) => setSplitCardInput(event.target.value)} placeholder="0" />
+                            </div>
+                          ) : null}
+                          {enabledPaymentMethods.includes("qris") ? (
+                            <>
+                              <div>
+                                <p className="mb-1 text-xs uppercase tracking-[0.08em] text-[var(--c-text-muted)]">Split QRIS</p>
+                                <Input inputMode="numeric" value={splitQrisInput} onChange={(event) => setSplitQrisInput(event.target.value)} placeholder="0" />
+                              </div>
+                              <div>
+                                <p className="mb-1 text-xs uppercase tracking-[0.08em] text-[var(--c-text-muted)]">Ref QRIS</p>
+                                <Input value={splitQrisReference} onChange={(event) => setSplitQrisReference(event.target.value)} placeholder="Opsional" />
+                              </div>
+                            </>
+                          ) : null}
+                          {enabledPaymentMethods.includes("ewallet") ? (
+                            <>
+                              <div>
+                                <p className="mb-1 text-xs uppercase tracking-[0.08em] text-[var(--c-text-muted)]">Split E-Wallet</p>
+                                <Input inputMode="numeric" value={splitEwalletInput} onChange={(event) => setSplitEwalletInput(event.target.value)} placeholder="0" />
+                              </div>
+                              <div>
+                                <p className="mb-1 text-xs uppercase tracking-[0.08em] text-[var(--c-text-muted)]">Ref E-Wallet</p>
+                                <Input value={splitEwalletReference} onChange={(event) => setSplitEwalletReference(event.target.value)} placeholder="Opsional" />
+                              </div>
+                            </>
+                          ) : null}
                         </>
                       ) : null}
 
@@ -2510,6 +2547,11 @@ export function POSTerminal() {
                             <p className="text-xs text-[var(--c-text-muted)]">
                               Potensi margin: {formatCurrency(recommendation.expected_margin_lift_cents)}
                             </p>
+                            {recommendation.available_qty > 0 && recommendation.available_qty <= 5 ? (
+                              <p className="text-xs font-semibold text-[var(--c-title)]">
+                                Tinggal {recommendation.available_qty} lagi
+                              </p>
+                            ) : null}
                             <div className="flex items-center gap-2">
                               <Button className="flex-1" onClick={acceptRecommendation}>
                                 Tambah 1 Item
@@ -5,8 +5,14 @@ import type {
   CashDrawerOpenResponse,
   CashierCreateRequest,
   CashierUser,
+  ClientConfig,
   DailyReport,
+  DataImportRequest,
+  DataImportResponse,
+  DataSnapshot,
   CheckoutLookupResponse,
+  CheckoutQuoteResponse,
+  CustomerTransactionsResponse,
   CheckoutRequest,
   CheckoutResponse,
   HardwareReceiptRequest,
@@ -29,9 +35,14 @@ import type {
   PurchaseOrderCreateRequest,
   PurchaseOrderListResponse,
   PurchaseOrderResponse,
+  PurchaseOrdersFromReorderRequest,
+  PurchaseOrdersFromReorderResponse,
   ProductUpdateRequest,
   PromoCreateRequest,
   PromoRule,
+  StoreCreditBalance,
+  StoreCreditEntry,
+  StoreCreditRedeemRequest,
   ReorderSuggestionResponse,
   RefundRequest,
   RefundResponse,
@@ -39,11 +50,20 @@ import type {
   RecommendationResponse,
   Supplier,
   SupplierCreateRequest,
+  SupplierProduct,
+  SupplierProductListResponse,
+  SupplierProductSetRequest,
+  SupplierUpdateRequest,
   StockOpnameRequest,
   StockOpnameResponse,
   ShiftCloseRequest,
   ShiftOpenRequest,
   ShiftResponse,
+  ShiftUpdateRequest,
+  Terminal,
+  TerminalListResponse,
+  TerminalRegisterRequest,
+  TerminalRegistration,
   VoidTransactionRequest,
   VoidTransactionResponse,
 } from "@/lib/types";
@@ -52,15 +72,22 @@ const API_BASE =
   process.env.NEXT_PUBLIC_API_BASE_URL?.replace(/\/$/, "") ??
   "http://127.0.0.1:8080";
 
+// Token of this device's registered terminal, required by the backend when
+// REQUIRE_REGISTERED_TERMINALS is on.
+const TERMINAL_TOKEN = process.env.NEXT_PUBLIC_TERMINAL_TOKEN ?? "";
+
 const REQUEST_TIMEOUT_MS = 15_000;
 
 export class ApiError extends Error {
   readonly status: number;
+  // Stable error code from the backend, e.g. "insufficient_stock".
+  readonly code?: string;
 
-  constructor(message: string, status: number) {
+  constructor(message: string, status: number, code?: string) {
     super(message);
     this.name = "ApiError";
     this.status = status;
+    this.code = code;
   }
 }
 
@@ -86,6 +113,9 @@ async function request<T>(
   if (token) {
     headers.set("Authorization", `Bearer ${token}`);
   }
+  if (TERMINAL_TOKEN && !headers.has("X-Terminal-Token")) {
+    headers.set("X-Terminal-Token", TERMINAL_TOKEN);
+  }
 
   const { init: timedInit, cleanup } = withTimeout({ ...init, headers });
   try {
@@ -93,15 +123,18 @@ async function request<T>(
 
     if (!response.ok) {
       let errorMessage = `Request failed with status ${response.status}`;
+      let errorCode: string | undefined;
       try {
-        const payload = (await response.json()) as { error?: string };
-        if (payload.error) {
-          errorMessage = payload.error;
+        const payload = (await response.json()) as { error?: string; code?: string; message?: string };
+        // Prefer the message localized for the browser's Accept-Language.
+        if (payload.message || payload.error) {
+          errorMessage = payload.message || payload.error || errorMessage;
         }
+        errorCode = payload.code;
       } catch {
         // Ignore non-JSON error payloads.
       }
-      throw new ApiError(errorMessage, response.status);
+      throw new ApiError(errorMessage, response.status, errorCode);
     }
 
     return (await response.json()) as T;
@@ -142,9 +175,9 @@ export async function login(body: LoginRequest): Promise<LoginResponse> {
   });
 }
 
-export async function fetchProducts(token: string): Promise<Product[]> {
+export async function fetchProducts(token: string, tag?: string): Promise<Product[]> {
   const payload = await request<{ products: Product[] }>(
-    "/api/v1/products",
+    tag ? `/api/v1/products?tag=${encodeURIComponent(tag)}` : "/api/v1/products",
     {
       method: "GET",
       cache: "no-store",
@@ -154,6 +187,17 @@ export async function fetchProducts(token: string): Promise<Product[]> {
   return payload.products;
 }
 
+export async function fetchClientConfig(token: string, storeID: string): Promise<ClientConfig> {
+  return request<ClientConfig>(
+    `/api/v1/config?store_id=${encodeURIComponent(storeID)}`,
+    {
+      method: "GET",
+      cache: "no-store",
+    },
+    token,
+  );
+}
+
 export async function createProduct(
   token: string,
   body: ProductCreateRequest,
@@ -231,6 +275,62 @@ export async function checkout(
   );
 }
 
+export async function fetchCustomerTransactions(
+  token: string,
+  customerId: string,
+  limit = 100,
+): Promise<CustomerTransactionsResponse> {
+  return request<CustomerTransactionsResponse>(
+    `/api/v1/customers/${encodeURIComponent(customerId)}/transactions?limit=${limit}`,
+    {
+      method: "GET",
+    },
+    token,
+  );
+}
+
+export async function fetchStoreCredit(
+  token: string,
+  code: string,
+): Promise<StoreCreditBalance> {
+  return request<StoreCreditBalance>(
+    `/api/v1/store-credits/${encodeURIComponent(code)}`,
+    {
+      method: "GET",
+    },
+    token,
+  );
+}
+
+export async function redeemStoreCredit(
+  token: string,
+  code: string,
+  body: StoreCreditRedeemRequest,
+): Promise<{ entry: StoreCreditEntry }> {
+  return request<{ entry: StoreCreditEntry }>(
+    `/api/v1/store-credits/${encodeURIComponent(code)}/redeem`,
+    {
+      method: "POST",
+      body: JSON.stringify(body),
+    },
+    token,
+  );
+}
+
+export async function quoteCheckout(
+  token: string,
+  body: CheckoutRequest,
+): Promise<CheckoutQuoteResponse> {
+  return request<CheckoutQuoteResponse>(
+    "/api/v1/checkout/quote",
+    {
+      method: "POST",
+      body: JSON.stringify(body),
+    },
+    token,
+  );
+}
+
 export async function lookupCheckoutByIdempotency(
   token: string,
   idempotencyKey: string,
@@ -274,6 +374,21 @@ export async function closeShift(
   );
 }
 
+export async function updateShift(
+  token: string,
+  shiftID: string,
+  body: ShiftUpdateRequest,
+): Promise<ShiftResponse> {
+  return request<ShiftResponse>(
+    `/api/v1/shifts/${encodeURIComponent(shiftID)}`,
+    {
+      method: "PATCH",
+      body: JSON.stringify(body),
+    },
+    token,
+  );
+}
+
 export async function fetchActiveShift(
   token: string,
   storeID: string,
@@ -469,6 +584,22 @@ export async function fetchPromos(token: string): Promise<PromoRule[]> {
   return payload.promos;
 }
 
+export async function fetchPromo(
+  token: string,
+  promoID: string,
+): Promise<PromoRule> {
+  const encodedID = encodeURIComponent(promoID);
+  const payload = await request<{ promo: PromoRule }>(
+    `/api/v1/promos/${encodedID}`,
+    {
+      method: "GET",
+      cache: "no-store",
+    },
+    token,
+  );
+  return payload.promo;
+}
+
 export async function createPromo(
   token: string,
   body: PromoCreateRequest,
@@ -638,13 +769,64 @@ export async function createSupplier(
   return payload.supplier;
 }
 
+export async function updateSupplier(
+  token: string,
+  supplierID: string,
+  body: SupplierUpdateRequest,
+): Promise<Supplier> {
+  const encodedID = encodeURIComponent(supplierID);
+  const payload = await request<{ supplier: Supplier }>(
+    `/api/v1/suppliers/${encodedID}`,
+    {
+      method: "PATCH",
+      body: JSON.stringify(body),
+    },
+    token,
+  );
+  return payload.supplier;
+}
+
+export async function fetchSupplierProducts(
+  token: string,
+  supplierID: string,
+): Promise<SupplierProductListResponse> {
+  const encodedID = encodeURIComponent(supplierID);
+  return request<SupplierProductListResponse>(
+    `/api/v1/suppliers/${encodedID}/products`,
+    {
+      method: "GET",
+      cache: "no-store",
+    },
+    token,
+  );
+}
+
+export async function setSupplierProduct(
+  token: string,
+  supplierID: string,
+  body: SupplierProductSetRequest,
+): Promise<SupplierProduct> {
+  const encodedID = encodeURIComponent(supplierID);
+  const payload = await request<{ product: SupplierProduct }>(
+    `/api/v1/suppliers/${encodedID}/products`,
+    {
+      method: "POST",
+      body: JSON.stringify(body),
+    },
+    token,
+  );
+  return payload.product;
+}
+
 export async function fetchPurchaseOrders(
   token: string,
+  storeID: string,
   status?: string,
 ): Promise<PurchaseOrderListResponse> {
-  const suffix = status ? `?status=${encodeURIComponent(status)}` : "";
+  const encodedStoreID = encodeURIComponent(storeID);
+  const suffix = status ? `&status=${encodeURIComponent(status)}` : "";
   return request<PurchaseOrderListResponse>(
-    `/api/v1/purchase-orders${suffix}`,
+    `/api/v1/purchase-orders?store_id=${encodedStoreID}${suffix}`,
     {
       method: "GET",
       cache: "no-store",
@@ -667,6 +849,20 @@ export async function createPurchaseOrder(
   );
 }
 
+export async function createPurchaseOrdersFromReorder(
+  token: string,
+  body: PurchaseOrdersFromReorderRequest,
+): Promise<PurchaseOrdersFromReorderResponse> {
+  return request<PurchaseOrdersFromReorderResponse>(
+    "/api/v1/purchase-orders/from-reorder",
+    {
+      method: "POST",
+      body: JSON.stringify(body),
+    },
+    token,
+  );
+}
+
 export async function receivePurchaseOrder(
   token: string,
   purchaseOrderID: string,
@@ -683,6 +879,22 @@ export async function receivePurchaseOrder(
   );
 }
 
+export async function cancelPurchaseOrder(
+  token: string,
+  purchaseOrderID: string,
+  reason: string,
+): Promise<PurchaseOrderResponse> {
+  const encodedID = encodeURIComponent(purchaseOrderID);
+  return request<PurchaseOrderResponse>(
+    `/api/v1/purchase-orders/${encodedID}/cancel`,
+    {
+      method: "POST",
+      body: JSON.stringify({ reason }),
+    },
+    token,
+  );
+}
+
 export async function fetchOperationalAlerts(
   token: string,
   storeID: string,
@@ -741,6 +953,20 @@ export async function generateEscposReceipt(
   );
 }
 
+export async function generateKitchenTicket(
+  token: string,
+  body: HardwareReceiptRequest,
+): Promise<HardwareReceiptResponse> {
+  return request<HardwareReceiptResponse>(
+    "/api/v1/hardware/kitchen-ticket",
+    {
+      method: "POST",
+      body: JSON.stringify(body),
+    },
+    token,
+  );
+}
+
 export async function openCashDrawer(
   token: string,
   body: CashDrawerOpenRequest,
@@ -754,3 +980,65 @@ export async function openCashDrawer(
     token,
   );
 }
+
+export async function exportData(token: string, managerPin: string, storeId?: string): Promise<DataSnapshot> {
+  const query = storeId ? `?store_id=${encodeURIComponent(storeId)}` : "";
+  return request<DataSnapshot>(
+    `/api/v1/admin/export${query}`,
+    {
+      headers: { "X-Manager-PIN": managerPin },
+    },
+    token,
+  );
+}
+
+export async function importData(token: string, body: DataImportRequest): Promise<DataImportResponse> {
+  return request<DataImportResponse>(
+    "/api/v1/admin/import",
+    {
+      method: "POST",
+      body: JSON.stringify(body),
+    },
+    token,
+  );
+}
+
+export async function fetchTerminals(token: string, storeID: string): Promise<TerminalListResponse> {
+  return request<TerminalListResponse>(
+    `/api/v1/terminals?store_id=${encodeURIComponent(storeID)}`,
+    {
+      method: "GET",
+      cache: "no-store",
+    },
+    token,
+  );
+}
+
+export async function registerTerminal(
+  token: string,
+  body: TerminalRegisterRequest,
+): Promise<TerminalRegistration> {
+  return request<TerminalRegistration>(
+    "/api/v1/terminals",
+    {
+      method: "POST",
+      body: JSON.stringify(body),
+    },
+    token,
+  );
+}
+
+export async function revokeTerminal(
+  token: string,
+  storeID: string,
+  terminalID: string,
+): Promise<Terminal> {
+  const payload = await request<{ terminal: Terminal }>(
+    `/api/v1/terminals/${encodeURIComponent(terminalID)}/revoke?store_id=${encodeURIComponent(storeID)}`,
+    {
+      method: "POST",
+    },
+    token,
+  );
+  return payload.terminal;
+}
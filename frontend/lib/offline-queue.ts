@@ -73,6 +73,7 @@ export async function listOfflineCheckouts(): Promise<OfflineTransaction[]> {
   return records.map((entry) => ({
     client_transaction_id: entry.client_transaction_id,
     checkout: entry.checkout,
+    queued_at: entry.queued_at,
   }));
 }
 
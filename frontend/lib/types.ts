@@ -2,8 +2,14 @@ export type Role = "cashier" | "admin";
 
 export type PaymentMethod = "cash" | "card" | "qris" | "ewallet" | "split";
 
+export type ClientConfig = {
+  store_id: string;
+  currency: string;
+  payment_methods: Array<Exclude<PaymentMethod, "split">>;
+};
+
 export type PaymentSplit = {
-  method: "cash" | "card" | "qris" | "ewallet";
+  method: "cash" | "card" | "qris" | "ewallet" | "store_credit";
   amount_cents: number;
   reference?: string;
 };
@@ -15,6 +21,14 @@ export type Product = {
   price_cents: number;
   margin_rate: number;
   active: boolean;
+  // Own tax rate; absent means the checkout rate applies.
+  tax_rate_percent?: number;
+  // Seasonal availability window; absent ends are open.
+  available_from?: string;
+  available_until?: string;
+  brand?: string;
+  // Lowercase, unique labels such as "halal".
+  tags?: string[];
 };
 
 export type ProductCreateRequest = {
@@ -25,6 +39,11 @@ export type ProductCreateRequest = {
   price_cents: number;
   margin_rate: number;
   initial_stock: number;
+  tax_rate_percent?: number;
+  available_from?: string;
+  available_until?: string;
+  brand?: string;
+  tags?: string[];
 };
 
 export type ProductUpdateRequest = {
@@ -33,6 +52,14 @@ export type ProductUpdateRequest = {
   price_cents?: number;
   margin_rate?: number;
   active?: boolean;
+  tax_rate_percent?: number;
+  clear_tax_rate?: boolean;
+  // YYYY-MM-DD; an empty string clears that end.
+  available_from?: string;
+  available_until?: string;
+  // Replace the product's brand or tags; empty values clear them.
+  brand?: string;
+  tags?: string[];
 };
 
 export type ProductPriceHistory = {
@@ -65,6 +92,7 @@ export type Recommendation = {
   expected_margin_lift_cents: number;
   reason_code: string;
   confidence: number;
+  available_qty: number;
 };
 
 export type RecommendationResponse = {
@@ -97,6 +125,7 @@ export type Shift = {
   status: "open" | "closed";
   opened_at: string;
   closed_at?: string;
+  notes?: string;
 };
 
 export type ShiftOpenRequest = {
@@ -113,10 +142,42 @@ export type ShiftCloseRequest = {
   notes: string;
 };
 
+export type ShiftUpdateRequest = {
+  opening_float_cents?: number;
+  notes?: string;
+  manager_pin: string;
+};
+
 export type ShiftResponse = {
   shift: Shift;
 };
 
+export type Terminal = {
+  store_id: string;
+  terminal_id: string;
+  label: string;
+  created_by: string;
+  created_at: string;
+  revoked_at?: string;
+};
+
+export type TerminalRegisterRequest = {
+  store_id: string;
+  terminal_id: string;
+  label: string;
+};
+
+// The token is shown once; the device sends it as X-Terminal-Token.
+export type TerminalRegistration = {
+  terminal: Terminal;
+  token: string;
+};
+
+export type TerminalListResponse = {
+  store_id: string;
+  terminals: Terminal[];
+};
+
 export type StockOpnameItem = {
   sku: string;
   counted_qty: number;
@@ -160,6 +221,9 @@ export type CheckoutRequest = {
     reason_code: string;
     confidence: number;
   };
+  change_as_credit?: boolean;
+  store_credit_code?: string;
+  customer_id?: string;
 };
 
 export type CheckoutResponse = {
@@ -178,6 +242,26 @@ export type CheckoutResponse = {
   recommendation_sku?: string;
   duplicate: boolean;
   created_at: string;
+  store_credit_code?: string;
+  store_credit_cents?: number;
+  customer_id?: string;
+};
+
+export type CustomerTransaction = {
+  transaction_id: string;
+  store_id: string;
+  terminal_id: string;
+  status: string;
+  payment_method: PaymentMethod;
+  total_cents: number;
+  item_count: number;
+  created_at: string;
+};
+
+export type CustomerTransactionsResponse = {
+  customer_id: string;
+  paid_total_cents: number;
+  transactions: CustomerTransaction[];
 };
 
 export type CheckoutLookupResponse = {
@@ -185,9 +269,63 @@ export type CheckoutLookupResponse = {
   checkout?: CheckoutResponse;
 };
 
+export type QuoteLine = {
+  sku: string;
+  name: string;
+  qty: number;
+  unit_price_cents: number;
+  line_total_cents: number;
+  tax_rate_percent: number;
+  tax_cents: number;
+};
+
+export type AppliedPromo = {
+  promo_id: string;
+  name: string;
+  discount_cents: number;
+};
+
+export type StoreCreditEntry = {
+  id: string;
+  store_id: string;
+  code: string;
+  kind: "issue" | "redeem" | "void";
+  amount_cents: number;
+  transaction_id?: string;
+  created_by?: string;
+  created_at: string;
+};
+
+export type StoreCreditBalance = {
+  code: string;
+  balance_cents: number;
+  entries: StoreCreditEntry[];
+};
+
+export type StoreCreditRedeemRequest = {
+  store_id?: string;
+  amount_cents: number;
+};
+
+export type CheckoutQuoteResponse = {
+  store_id: string;
+  lines: QuoteLine[];
+  subtotal_cents: number;
+  promo_discount_cents: number;
+  discount_cents: number;
+  tax_cents: number;
+  total_cents: number;
+  cash_received_cents: number;
+  change_cents: number;
+  store_credit_cents: number;
+  applied_promos: AppliedPromo[];
+  item_count: number;
+};
+
 export type VoidTransactionRequest = {
   reason: string;
   manager_pin: string;
+  override_daily_cap?: boolean;
 };
 
 export type VoidTransactionResponse = {
@@ -201,6 +339,9 @@ export type RefundRequest = {
   reason: string;
   amount_cents: number;
   manager_pin: string;
+  override_refund_window?: boolean;
+  override_note?: string;
+  override_daily_cap?: boolean;
 };
 
 export type RefundResponse = {
@@ -232,6 +373,8 @@ export type ItemReturnRequest = {
   cash_received_cents?: number;
   return_items: ItemReturnLine[];
   exchange_items?: CartItem[];
+  override_refund_window?: boolean;
+  override_note?: string;
 };
 
 export type ItemReturnResponse = {
@@ -282,6 +425,9 @@ export type InventoryLotListResponse = {
 
 export type HardwareReceiptRequest = {
   transaction_id: string;
+  printer_width?: 32 | 48;
+  // Receipt label language, e.g. "en"; defaults to Accept-Language.
+  language?: string;
 };
 
 export type HardwareReceiptResponse = {
@@ -304,6 +450,7 @@ export type CashDrawerOpenResponse = {
 export type OfflineTransaction = {
   client_transaction_id: string;
   checkout: CheckoutRequest;
+  queued_at?: string;
 };
 
 export type OfflineSyncRequest = {
@@ -311,6 +458,7 @@ export type OfflineSyncRequest = {
   terminal_id: string;
   envelope_id: string;
   transactions: OfflineTransaction[];
+  all_or_nothing?: boolean;
 };
 
 export type OfflineSyncResponse = {
@@ -319,6 +467,14 @@ export type OfflineSyncResponse = {
     client_transaction_id: string;
     status: "accepted" | "duplicate" | "rejected";
     reason?: string;
+    reason_code?:
+      | "insufficient_stock"
+      | "no_active_shift"
+      | "shift_not_owned"
+      | "invalid"
+      | "batch_aborted"
+      | "error";
+    conflict_sku?: string;
     transaction_id?: string;
   }>;
 };
@@ -348,6 +504,11 @@ export type DailyReport = {
     transactions: number;
     total_cents: number;
   }>;
+  by_tax_rate: Array<{
+    rate: number;
+    taxable_base_cents: number;
+    tax_cents: number;
+  }>;
 };
 
 export type AuditLog = {
@@ -374,6 +535,7 @@ export type PromoRule = {
 };
 
 export type PromoCreateRequest = {
+  id?: string;
   name: string;
   type: "cart_percent" | "flat_cart";
   min_subtotal_cents: number;
@@ -428,10 +590,72 @@ export type Supplier = {
 };
 
 export type SupplierCreateRequest = {
+  id?: string;
   name: string;
   phone: string;
 };
 
+export type SupplierUpdateRequest = {
+  name?: string;
+  phone?: string;
+};
+
+export type SupplierProduct = {
+  supplier_id: string;
+  sku: string;
+  default_cost_cents: number;
+  lead_time_days: number;
+  updated_at: string;
+};
+
+export type SupplierProductSetRequest = {
+  sku: string;
+  default_cost_cents: number;
+  lead_time_days: number;
+};
+
+export type SupplierProductListResponse = {
+  supplier_id: string;
+  products: SupplierProduct[];
+};
+
+export type SnapshotUser = {
+  username: string;
+  role: string;
+  active: boolean;
+  created_at: string;
+};
+
+export type DataSnapshot = {
+  version: number;
+  exported_at: string;
+  store_id: string;
+  products: Product[];
+  stock: Record<string, number>;
+  lots: InventoryLot[];
+  promos: PromoRule[];
+  suppliers: Supplier[];
+  supplier_products: SupplierProduct[];
+  users: SnapshotUser[];
+};
+
+export type DataImportRequest = {
+  manager_pin: string;
+  snapshot: DataSnapshot;
+};
+
+export type DataImportResponse = {
+  store_id: string;
+  products: number;
+  lots: number;
+  stock_skus: number;
+  promos: number;
+  suppliers: number;
+  supplier_products: number;
+  users: number;
+  users_needing_password: string[];
+};
+
 export type PurchaseOrderItem = {
   sku: string;
   qty: number;
@@ -446,10 +670,14 @@ export type PurchaseOrder = {
   created_at: string;
   received_at?: string;
   received_by?: string;
+  cancelled_at?: string;
+  cancelled_by?: string;
+  cancel_reason?: string;
   items: PurchaseOrderItem[];
 };
 
 export type PurchaseOrderCreateRequest = {
+  id?: string;
   store_id: string;
   supplier_id: string;
   items: PurchaseOrderItem[];
@@ -472,6 +700,9 @@ export type ReorderSuggestion = {
   recommended_qty: number;
   last_cost_cents: number;
   estimated_purchase_cents: number;
+  basis: "velocity" | "reorder_point";
+  velocity_per_day: number;
+  lead_time_days: number;
 };
 
 export type ReorderSuggestionResponse = {
@@ -480,6 +711,18 @@ export type ReorderSuggestionResponse = {
   suggestions: ReorderSuggestion[];
 };
 
+export type PurchaseOrdersFromReorderRequest = {
+  store_id: string;
+  supplier_id_by_sku?: Record<string, string>;
+  default_supplier_id_by_category?: Record<string, string>;
+};
+
+export type PurchaseOrdersFromReorderResponse = {
+  store_id: string;
+  purchase_order_ids: string[];
+  unmapped_skus: string[];
+};
+
 export type OperationalAlert = {
   id: string;
   code: string;